@@ -16,7 +16,6 @@ import (
 	"github.com/84hero/evm-scanner/pkg/storage"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 )
 
@@ -41,18 +40,6 @@ func main() {
 		log.Crit("Failed to load config", "err", err)
 	}
 
-	// [Feature 1: Use presets to fill default values]
-	// If BatchSize is not specified in config, use the chain's default
-	if preset, ok := chain.Get(cfg.Scanner.ChainID); ok {
-		if cfg.Scanner.BatchSize == 0 {
-			cfg.Scanner.BatchSize = preset.BatchSize
-		}
-		if cfg.Scanner.Confirmations == 0 {
-			cfg.Scanner.Confirmations = preset.ReorgSafe
-		}
-		log.Info("Loaded chain preset", "chain", cfg.Scanner.ChainID)
-	}
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -63,19 +50,17 @@ func main() {
 	}
 	defer client.Close()
 
-	// 3. Initialize Decoder
-	usdtDecoder, err := decoder.NewFromJSON(usdtABI)
-	if err != nil {
+	// 3. Initialize Decoder, scoping the ABI to the USDT contract
+	usdtAddress := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	decoders := decoder.NewRegistry()
+	if err := decoders.AddABI(usdtABI, decoder.WithAddresses(usdtAddress)); err != nil {
 		log.Crit("Failed to init decoder", "err", err)
 	}
 
-	// 4. Build filter
-	usdtAddress := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
-	transferTopic := crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
-
+	// 4. Build filter on the events of the ABI
 	filter := scanner.NewFilter().
 		AddContract(usdtAddress).
-		SetTopic(0, transferTopic)
+		SetTopic(0, decoders.Topics()...)
 
 	// 5. Configure Storage [Feature 2: Multiple Storage Engine Support]
 	var store storage.Persistence
@@ -120,8 +105,17 @@ func main() {
 		CursorRewind: cfg.Scanner.CursorRewind,
 		BatchSize:    cfg.Scanner.BatchSize,
 		Interval:     cfg.Scanner.Interval,
-		ReorgSafe:    cfg.Scanner.Confirmations, // Using merged preset values
+		ReorgSafe:    cfg.Scanner.Confirmations,
 		UseBloom:     cfg.Scanner.UseBloom,
+		MaxLogsRange: cfg.Scanner.MaxLogsRange,
+		FinalityMode: scanner.FinalityMode(cfg.Scanner.Finality),
+	}
+
+	// [Feature 1: Use presets to fill default values]
+	// Settings missing from the config, e.g. BatchSize, take the chain's default
+	if preset, ok := chain.Get(cfg.Scanner.ChainID); ok {
+		chain.ApplyDefaults(&scanCfg, preset)
+		log.Info("Loaded chain preset", "chain", cfg.Scanner.ChainID)
 	}
 
 	s := scanner.New(client, store, scanCfg, filter)
@@ -130,7 +124,7 @@ func main() {
 	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
 		// [Logic: Local processing]
 		for _, l := range logs {
-			decoded, err := usdtDecoder.Decode(l)
+			decoded, err := decoders.Decode(l)
 			if err != nil {
 				log.Error("Failed to decode log", "tx", l.TxHash.Hex(), "err", err)
 				continue
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/84hero/evm-scanner/pkg/app"
+	"github.com/84hero/evm-scanner/pkg/chain"
+)
+
+// Build information, set with -ldflags "-X main.version=... -X main.commit=...
+// -X main.date=...", as goreleaser does. Unset, the commit and date are taken
+// from the VCS information of the build.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+const usage = `usage: scanner-cli [command] [flags]
+
+Commands:
+  run       Scan the configured chains (default)
+  validate  Check the configuration and exit
+  version   Print the version
+  cursors   List, set and delete the cursors of the store
+  replay    Re-deliver the events of a file output to an output
+  rescan    Reprocess a range of blocks into the outputs
+
+Run "scanner-cli <command> -h" for the flags of a command. The flags take
+precedence over the environment variables, e.g. CONFIG_FILE for --config.
+`
+
+// execute runs the command of args, without the program name: run unless the
+// first argument names another.
+func execute(ctx context.Context, args []string, stdout io.Writer) error {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	switch name {
+	case "run":
+		return Run(ctx, args)
+	case "validate":
+		return RunValidate(args, stdout)
+	case "version":
+		fmt.Fprintln(stdout, versionString())
+		return nil
+	case "cursors":
+		return RunCursors(ctx, args)
+	case "replay":
+		return RunReplay(ctx, args)
+	case "rescan":
+		return RunRescan(ctx, args)
+	case "help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q\n%s", name, usage)
+}
+
+// configFlags are the config files named by the --config and --app-config
+// flags, empty when unset.
+type configFlags struct {
+	path, appPath string
+}
+
+// newFlagSet returns the flag set of command, whose usage shows args, the
+// arguments following the flags, and the flags of the set.
+func newFlagSet(command, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: scanner-cli %s\n\nFlags:\n", strings.TrimSpace(command+" [flags] "+args))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// addConfigFlags adds the --config and --app-config flags to fs.
+func addConfigFlags(fs *flag.FlagSet) *configFlags {
+	f := &configFlags{}
+	fs.StringVar(&f.path, "config", "", "Config file (default: $CONFIG_FILE, else config.yaml)")
+	fs.StringVar(&f.appPath, "app-config", "", "Deprecated: separate file of filters and outputs (default: $APP_CONFIG_FILE, else app.yaml if it exists)")
+	return f
+}
+
+// errHelp stops a command after its usage was printed, and is not reported.
+var errHelp = errors.New("help requested")
+
+// parseFlags parses args into fs, returning errHelp when -h asked for the usage.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return errHelp
+	}
+	return err
+}
+
+// RunValidate implements "scanner-cli validate": it loads the configuration,
+// checks what can be checked without connecting to the nodes, store and
+// outputs, i.e. the storage, chain presets, filters and postgres event tables, and
+// prints the chains it would scan to w.
+func RunValidate(args []string, w io.Writer) error {
+	fs := newFlagSet("validate", "")
+	files := addConfigFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("validate: unexpected arguments %q", fs.Args())
+	}
+
+	cfg, err := loadConfig(*files)
+	if err != nil {
+		return err
+	}
+	if path := os.Getenv("CHAINS_FILE"); path != "" {
+		if err := chain.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	if err := app.Validate(cfg); err != nil {
+		return err
+	}
+
+	path, _ := configFiles(*files)
+	fmt.Fprintf(w, "%s: ok\n", path)
+	for _, scan := range cfg.ChainScans() {
+		fmt.Fprintf(w, "chain %s: %d filters\n", scan.ChainID, len(scan.Filters))
+	}
+	return nil
+}
+
+// versionString returns the version, commit and build date of the binary.
+func versionString() string {
+	rev, built := commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && rev == "":
+				rev = s.Value
+			case s.Key == "vcs.time" && built == "":
+				built = s.Value
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+	return fmt.Sprintf("scanner-cli %s (commit %s, built %s, %s)", version, rev, built, runtime.Version())
+}
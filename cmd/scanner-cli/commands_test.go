@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/chain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCLI_Execute(t *testing.T) {
+	ctx := context.Background()
+	var out bytes.Buffer
+	assert.NoError(t, execute(ctx, []string{"version"}, &out))
+	assert.Contains(t, out.String(), "scanner-cli dev (commit ")
+
+	out.Reset()
+	assert.NoError(t, execute(ctx, []string{"help"}, &out))
+	assert.Contains(t, out.String(), "validate  Check the configuration and exit")
+
+	assert.ErrorContains(t, execute(ctx, []string{"scan"}, &out), `unknown command "scan"`)
+	assert.ErrorIs(t, execute(ctx, []string{"validate", "-h"}, &out), errHelp)
+	assert.ErrorIs(t, execute(ctx, []string{"-h"}, &out), errHelp) // Flags of run
+	assert.ErrorContains(t, execute(ctx, []string{"--verbose"}, &out), "flag provided but not defined: -verbose")
+	assert.ErrorContains(t, execute(ctx, []string{"run", "config.yaml"}, &out), `run: unexpected arguments ["config.yaml"]`)
+	assert.ErrorContains(t, execute(ctx, []string{"cursors", "--config", "testdata/valid.yaml"}, &out), "usage: scanner-cli cursors")
+}
+
+func TestCLI_ConfigFiles(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("APP_CONFIG_FILE", "")
+	path, appPath := configFiles(configFlags{})
+	assert.Equal(t, "config.yaml", path)
+	assert.Empty(t, appPath)
+
+	// The environment is the fallback of the flags
+	t.Setenv("CONFIG_FILE", "env.yaml")
+	t.Setenv("APP_CONFIG_FILE", "env_app.yaml")
+	path, appPath = configFiles(configFlags{})
+	assert.Equal(t, "env.yaml", path)
+	assert.Equal(t, "env_app.yaml", appPath)
+	path, appPath = configFiles(configFlags{path: "flag.yaml", appPath: "flag_app.yaml"})
+	assert.Equal(t, "flag.yaml", path)
+	assert.Equal(t, "flag_app.yaml", appPath)
+}
+
+func TestCLI_Validate(t *testing.T) {
+	t.Setenv("APP_CONFIG_FILE", "")
+	var out bytes.Buffer
+	assert.NoError(t, execute(context.Background(), []string{"validate", "--config", "testdata/valid.yaml"}, &out))
+	assert.Equal(t, "testdata/valid.yaml: ok\nchain bsc: 1 filters\n", out.String())
+
+	t.Setenv("CONFIG_FILE", "testdata/valid.yaml")
+	out.Reset()
+	assert.NoError(t, RunValidate(nil, &out))
+	assert.Contains(t, out.String(), "testdata/valid.yaml: ok")
+
+	assert.ErrorContains(t, RunValidate([]string{"--config", "testdata/invalid_filter.yaml"}, &out), `filter "USDT transfers": invalid contract address "0x55d3"`)
+	assert.ErrorContains(t, RunValidate([]string{"--config", "testdata/invalid_scanners.yaml"}, &out), `scanners[1]: chain "bsc" is listed twice`)
+	assert.ErrorContains(t, RunValidate([]string{"--config", "testdata/missing.yaml"}, &out), "missing.yaml")
+	assert.ErrorContains(t, RunValidate([]string{"--config", "testdata/valid.yaml", "extra"}, &out), "validate: unexpected arguments")
+
+	// The presets of CHAINS_FILE are loaded first
+	path := filepath.Join(t.TempDir(), "chains.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("chains:\n  - name: cli-file-chain\n    chain_id: \"7100\"\n    block_time: 1s\n"), 0o644))
+	t.Setenv("CHAINS_FILE", path)
+	assert.NoError(t, RunValidate([]string{"--config", "testdata/valid.yaml"}, &out))
+	_, ok := chain.Get("7100")
+	assert.True(t, ok)
+	t.Setenv("CHAINS_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, RunValidate([]string{"--config", "testdata/valid.yaml"}, &out))
+}
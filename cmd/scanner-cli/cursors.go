@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/84hero/evm-scanner/pkg/app"
+	"github.com/84hero/evm-scanner/pkg/storage"
+)
+
+const cursorsUsage = "usage: scanner-cli cursors [flags] list | set <key> <height> | delete <key>"
+
+// RunCursors implements "scanner-cli cursors": it lists, sets and deletes the
+// cursors of the store the scanner would use, to inspect and fix scan tasks
+// without a database client.
+func RunCursors(ctx context.Context, args []string) error {
+	fs := newFlagSet("cursors", "list | set <key> <height> | delete <key>")
+	files := addConfigFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if args = fs.Args(); len(args) == 0 {
+		return errors.New(cursorsUsage)
+	}
+
+	cfg, err := loadConfig(*files)
+	if err != nil {
+		return err
+	}
+	store, err := app.OpenStore(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return runCursors(ctx, store, args, os.Stdout)
+}
+
+// runCursors runs the cursors subcommand args against store, printing to w.
+func runCursors(ctx context.Context, store storage.Persistence, args []string, w io.Writer) error {
+	admin, ok := store.(storage.CursorAdmin)
+	if !ok {
+		return fmt.Errorf("store %T cannot list or delete cursors", store)
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		cursors, err := admin.ListCursors(ctx)
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(cursors))
+		for key := range cursors {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%d\n", key, cursors[key])
+		}
+		return nil
+
+	case args[0] == "set" && len(args) == 3:
+		height, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid height %q: %w", args[2], err)
+		}
+		// Setting is deliberate, so it may move the cursor backwards
+		if rewinder, ok := store.(storage.Rewinder); ok {
+			err = rewinder.ForceRewind(ctx, args[1], height)
+		} else {
+			err = store.SaveCursor(ctx, args[1], height)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\n", args[1], height)
+		return nil
+
+	case args[0] == "delete" && len(args) == 2:
+		return admin.DeleteCursor(ctx, args[1])
+	}
+	return errors.New(cursorsUsage)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCursors(t *testing.T) {
+	store := storage.NewMemoryStore("evm_")
+	assert.NoError(t, store.SaveCursor(context.Background(), "eth", 500))
+	assert.NoError(t, store.SaveCursor(context.Background(), "bsc", 100))
+
+	var out bytes.Buffer
+	assert.NoError(t, runCursors(context.Background(), store, []string{"list"}, &out))
+	assert.Equal(t, "bsc\t100\neth\t500\n", out.String())
+
+	// Set rewinds past the monotonic protection
+	out.Reset()
+	assert.NoError(t, runCursors(context.Background(), store, []string{"set", "eth", "400"}, &out))
+	assert.Equal(t, "eth\t400\n", out.String())
+	h, err := store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(400), h)
+
+	assert.NoError(t, runCursors(context.Background(), store, []string{"delete", "bsc"}, &out))
+	cursors, err := store.ListCursors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"eth": 400}, cursors)
+
+	assert.ErrorContains(t, runCursors(context.Background(), store, []string{"set", "eth", "x"}, &out), "invalid height")
+	assert.ErrorContains(t, runCursors(context.Background(), store, []string{"set", "eth"}, &out), "usage")
+	assert.ErrorContains(t, runCursors(context.Background(), store, []string{"rename"}, &out), "usage")
+}
+
+func TestRunCursors_Store(t *testing.T) {
+	dir := t.TempDir()
+	coreFile := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(coreFile, []byte("project: demo\nscanner:\n  chain_id: eth\n"), 0o644))
+	t.Setenv("CONFIG_FILE", coreFile)
+	t.Setenv("CURSOR_FILE", filepath.Join(dir, "cursors.json"))
+
+	// Subcommands share the scanner's store and key prefix
+	assert.NoError(t, RunCursors(context.Background(), []string{"set", "eth", "123"}))
+	store, err := storage.NewFileStore(filepath.Join(dir, "cursors.json"), "demo_")
+	assert.NoError(t, err)
+	h, err := store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(123), h)
+	assert.NoError(t, store.Close())
+
+	assert.ErrorContains(t, RunCursors(context.Background(), nil), "usage")
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// logging is the default logger of the CLI, whose level reloads and the
+// admin API change at runtime.
+type logging struct {
+	level *slog.LevelVar
+	file  *logFile // Nil when logging to stderr
+}
+
+// setupLogging installs the default logger of cfg, adding the project and,
+// when a single chain is scanned, its chain_id to every record.
+func setupLogging(cfg *config.Config) (*logging, error) {
+	l := &logging{level: new(slog.LevelVar)}
+	l.level.Set(logLevel(cfg.Log.Level))
+
+	var w io.Writer = os.Stderr
+	if cfg.Log.File != "" {
+		f, err := openLogFile(cfg.Log.File)
+		if err != nil {
+			return nil, err
+		}
+		l.file, w = f, f
+	}
+	var attrs []slog.Attr
+	if cfg.Project != "" {
+		attrs = append(attrs, slog.String("project", cfg.Project))
+	}
+	if len(cfg.Scanners) == 0 && cfg.Scanner.ChainID != "" {
+		attrs = append(attrs, slog.String("chain_id", cfg.Scanner.ChainID))
+	}
+	h, err := newLogHandler(w, cfg.Log.Format, l.level, attrs)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	log.SetDefault(log.NewLogger(h))
+	return l, nil
+}
+
+// reopen reopens the log file, if any, after it was moved, e.g. by logrotate.
+func (l *logging) reopen() {
+	if l.file == nil {
+		return
+	}
+	if err := l.file.reopen(); err != nil {
+		log.Error("Failed to reopen log file", "file", l.file.path, "err", err)
+	}
+}
+
+// Close closes the log file, if any.
+func (l *logging) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// logLevel returns the level named "debug", "warn", "error" or else info.
+func logLevel(name string) slog.Level {
+	switch name {
+	case "debug":
+		return log.LevelDebug
+	case "warn":
+		return log.LevelWarn
+	case "error":
+		return log.LevelError
+	}
+	return log.LevelInfo
+}
+
+// newLogHandler returns the handler writing records of level or above to w
+// in format, text (the default) or json, with attrs.
+func newLogHandler(w io.Writer, format string, level slog.Leveler, attrs []slog.Attr) (slog.Handler, error) {
+	var h slog.Handler
+	switch format {
+	case "", "text":
+		h = log.NewTerminalHandlerWithLevel(w, log.LevelTrace, w == os.Stderr)
+	case "json":
+		h = log.JSONHandlerWithLevel(w, log.LevelTrace)
+	default:
+		return nil, fmt.Errorf("unsupported log format: %q", format)
+	}
+	return &logHandler{inner: h, level: level, attrs: attrs}, nil
+}
+
+// logHandler filters the records of inner below level, adding attrs to those
+// that lack their keys.
+type logHandler struct {
+	inner slog.Handler
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if len(h.attrs) > 0 {
+		has := make(map[string]bool, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			has[a.Key] = true
+			return true
+		})
+		r = r.Clone()
+		for _, a := range h.attrs {
+			if !has[a.Key] {
+				r.AddAttrs(a)
+			}
+		}
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var kept []slog.Attr
+	for _, a := range h.attrs {
+		if !hasAttr(attrs, a.Key) {
+			kept = append(kept, a)
+		}
+	}
+	return &logHandler{inner: h.inner.WithAttrs(attrs), level: h.level, attrs: kept}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	// The static attributes stay outside the group
+	return &logHandler{inner: h.inner.WithAttrs(h.attrs).WithGroup(name), level: h.level}
+}
+
+// hasAttr reports whether attrs has one named key.
+func hasAttr(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// logFile is a log file appended to, which reopen opens again.
+type logFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// openLogFile opens the log file at path, creating it if need be.
+func openLogFile(path string) (*logFile, error) {
+	l := &logFile{path: path}
+	if err := l.reopen(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// reopen opens the file at path again, keeping the current one on failure.
+func (l *logFile) reopen() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		l.f.Close()
+	}
+	l.f = f
+	return nil
+}
+
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
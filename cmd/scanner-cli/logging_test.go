@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCLI_Logging(t *testing.T) {
+	defer log.SetDefault(log.Root())
+	dir := t.TempDir()
+	cfg := &config.Config{Project: "logs", Scanner: config.ScannerConfig{ChainID: "eth"}}
+
+	// JSON records carry the project and chain, unless they have their own
+	cfg.Log = config.LogConfig{Level: "warn", Format: "json", File: filepath.Join(dir, "scanner.log")}
+	logs, err := setupLogging(cfg)
+	assert.NoError(t, err)
+	log.Info("Hidden")
+	log.Warn("Scanner failed", "err", "boom")
+	log.Error("Output failed", "chain_id", "base")
+	logs.level.Set(log.LevelDebug)
+	log.Debug("Debugging")
+
+	// Reopened after logrotate moved it
+	assert.NoError(t, os.Rename(cfg.Log.File, cfg.Log.File+".1"))
+	logs.reopen()
+	log.Warn("Rotated")
+	assert.NoError(t, logs.Close())
+
+	data, err := os.ReadFile(cfg.Log.File + ".1")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, 3) {
+		var records []map[string]any
+		for _, line := range lines {
+			var rec map[string]any
+			assert.NoError(t, json.Unmarshal([]byte(line), &rec), line)
+			records = append(records, rec)
+		}
+		assert.Equal(t, "Scanner failed", records[0]["msg"])
+		assert.Equal(t, "warn", records[0]["lvl"])
+		assert.Equal(t, "boom", records[0]["err"])
+		assert.Equal(t, "logs", records[0]["project"])
+		assert.Equal(t, "eth", records[0]["chain_id"])
+		assert.Equal(t, "base", records[1]["chain_id"])
+		assert.Equal(t, 1, strings.Count(lines[1], `"chain_id"`))
+		assert.Equal(t, "Debugging", records[2]["msg"])
+	}
+	data, err = os.ReadFile(cfg.Log.File)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"msg":"Rotated"`)
+
+	// Text records, without the chain of a multi-chain config
+	cfg.Log = config.LogConfig{File: filepath.Join(dir, "text.log")}
+	cfg.Scanners = []config.ChainScanConfig{{ScannerConfig: config.ScannerConfig{ChainID: "eth"}}}
+	logs, err = setupLogging(cfg)
+	assert.NoError(t, err)
+	log.Info("Scanner started", "start_block", 100)
+	assert.NoError(t, logs.Close())
+	data, err = os.ReadFile(cfg.Log.File)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Scanner started")
+	assert.Contains(t, string(data), "start_block=100 project=logs")
+	assert.NotContains(t, string(data), "chain_id")
+	assert.NotContains(t, string(data), "{")
+
+	cfg.Log = config.LogConfig{Format: "xml"}
+	_, err = setupLogging(cfg)
+	assert.EqualError(t, err, `unsupported log format: "xml"`)
+}
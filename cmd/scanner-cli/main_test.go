@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
-	"github.com/ethereum/go-ethereum/common"
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/redisconfig"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,77 +30,100 @@ outputs:
 	_, _ = tmpFile.WriteString(content)
 	tmpFile.Close()
 
-	cfg, err := loadAppConfig(tmpFile.Name())
+	cfg, err := config.Load(tmpFile.Name())
 	assert.NoError(t, err)
 	assert.Len(t, cfg.Filters, 1)
 	assert.True(t, cfg.Outputs.Console.Enabled)
 	assert.True(t, cfg.Outputs.Webhook.Async)
 }
 
-func TestCLI_LoadAppConfig_Fail(t *testing.T) {
-	_, err := loadAppConfig("non_existent.yaml")
-	assert.Error(t, err)
+func TestCLI_LoadAppConfig_RedisSentinel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+outputs:
+  redis:
+    enabled: true
+    key: "events"
+    master_name: "mymaster"
+    sentinel_addrs: ["sentinel-0:26379", "sentinel-1:26379"]
+    username: "scanner"
+    password: "secret"
+    read_timeout: 2s
+    tls_config:
+      ca_file: "/etc/ssl/redis-ca.pem"
+`), 0o644))
+
+	cfg, err := config.Load(path)
+	assert.NoError(t, err)
+	r := cfg.Outputs.Redis
+	assert.Equal(t, "events", r.Key)
+	assert.Equal(t, "mymaster", r.MasterName)
+	assert.Equal(t, []string{"sentinel-0:26379", "sentinel-1:26379"}, r.SentinelAddrs)
+	assert.Equal(t, "scanner", r.Username)
+	assert.Equal(t, "secret", r.Password)
+	assert.Equal(t, 2*time.Second, r.ReadTimeout)
+	assert.Equal(t, "/etc/ssl/redis-ca.pem", r.TLSConfig.CAFile)
 }
 
-func TestCLI_InitFilters(t *testing.T) {
-	configs := []CLIFilterConfig{
-		{
-			Description: "Test",
-			Contracts:   []string{"0xdAC17F958D2ee523a2206206994597C13D831ec7"},
-			Topics:      [][]string{{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}},
-		},
-	}
-
-	filter, _ := initFilters(configs)
-	assert.NotNil(t, filter)
-	assert.True(t, common.IsHexAddress(configs[0].Contracts[0]))
+func TestCLI_RedisEnvConfig(t *testing.T) {
+	t.Setenv("REDIS_PASSWORD", "secret")
+	assert.Equal(t, redisconfig.Config{Addr: "localhost:6379", Password: "secret"}, redisEnvConfig("localhost:6379"))
+
+	t.Setenv("REDIS_MASTER_NAME", "mymaster")
+	t.Setenv("REDIS_TLS", "true")
+	cfg := redisEnvConfig("sentinel-0:26379,sentinel-1:26379")
+	assert.Equal(t, "mymaster", cfg.MasterName)
+	assert.Equal(t, []string{"sentinel-0:26379", "sentinel-1:26379"}, cfg.SentinelAddrs)
+	assert.True(t, cfg.TLS)
+
+	t.Setenv("REDIS_MASTER_NAME", "")
+	t.Setenv("REDIS_CLUSTER", "true")
+	cfg = redisEnvConfig("node-0:6379,node-1:6379")
+	assert.Equal(t, []string{"node-0:6379", "node-1:6379"}, cfg.ClusterAddrs)
+	assert.Empty(t, cfg.Addr)
 }
 
-func TestCLI_InitFilters_Empty(t *testing.T) {
-	filter, decoders := initFilters([]CLIFilterConfig{})
-	assert.NotNil(t, filter)
-	assert.Empty(t, decoders)
+// unsetStoreEnv clears the environment variables selecting the cursor store.
+func unsetStoreEnv(t *testing.T) {
+	for _, name := range []string{"PG_URL", "REDIS_ADDR", "ETCD_ENDPOINTS", "CONSUL_ADDR", "SQLITE_PATH", "CURSOR_FILE"} {
+		t.Setenv(name, "")
+	}
 }
 
-func TestCLI_InitFilters_WithABI(t *testing.T) {
-	configs := []CLIFilterConfig{
-		{
-			Description: "USDT",
-			Contracts:   []string{"0xdAC17F958D2ee523a2206206994597C13D831ec7"},
-			Topics:      [][]string{{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}},
-			ABI:         `[{"anonymous":false,"inputs":[],"name":"Transfer","type":"event"}]`,
-		},
-	}
+func TestCLI_StorageConfig(t *testing.T) {
+	unsetStoreEnv(t)
+	cfg := &config.Config{Storage: config.StorageConfig{Type: config.StorageFile, File: config.FileStorageConfig{Path: "cursors.json"}}}
+	st, err := storageConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg.Storage, st)
 
-	filter, decoders := initFilters(configs)
-	assert.NotNil(t, filter)
-	assert.Len(t, decoders, 1)
-}
+	t.Setenv("CURSOR_FILE", "env.json")
+	t.Setenv("CURSOR_FILE_FLUSH_INTERVAL", "5s")
+	st, err = storageConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, config.FileStorageConfig{Path: "env.json", FlushInterval: 5 * time.Second}, st.File)
 
-func TestCLI_InitOutputs_Empty(t *testing.T) {
-	outputs := initOutputs(&AppConfig{})
-	assert.Empty(t, outputs)
-}
+	t.Setenv("CURSOR_FILE_FLUSH_INTERVAL", "often")
+	_, err = storageConfig(cfg)
+	assert.ErrorContains(t, err, "invalid CURSOR_FILE_FLUSH_INTERVAL")
 
-func TestCLI_InitOutputs_ConsoleFile(t *testing.T) {
-	appCfg := &AppConfig{
-		Outputs: OutputsConfig{
-			Console: ConsoleOutputConfig{Enabled: true},
-			File:    FileOutputConfig{Enabled: true, Path: "/tmp/test.log"},
-		},
-	}
-	defer os.Remove("/tmp/test.log")
+	t.Setenv("CURSOR_FILE", "")
+	t.Setenv("REDIS_ADDR", "redis:6379")
+	st, err = storageConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, config.StorageRedis, st.Type)
+	assert.Equal(t, "redis:6379", st.Redis.Addr)
 
-	outputs := initOutputs(appCfg)
-	assert.GreaterOrEqual(t, len(outputs), 1)
+	// The loaded configuration has the storage of the environment
+	t.Setenv("APP_CONFIG_FILE", "")
+	loaded, err := loadConfig(configFlags{path: "testdata/valid.yaml"})
+	assert.NoError(t, err)
+	assert.Equal(t, config.StorageRedis, loaded.Storage.Type)
+}
 
-	foundConsole := false
-	for _, o := range outputs {
-		if o.Name() == "console" {
-			foundConsole = true
-		}
-	}
-	assert.True(t, foundConsole)
+func TestCLI_LoadAppConfig_Fail(t *testing.T) {
+	_, err := config.Load("non_existent.yaml")
+	assert.Error(t, err)
 }
 
 func TestCLI_Run(t *testing.T) {
@@ -128,6 +153,6 @@ outputs: {console: {enabled: true}}
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
 
-	err := Run(ctx)
+	err := Run(ctx, nil)
 	assert.Error(t, err)
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/app"
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay debounces the file events of a single save: editors often write
+// a file in several steps.
+const reloadDelay = 200 * time.Millisecond
+
+// reloader applies the changes of the config files to the running app, see
+// App.Reload, and to the log level. The other changes need a restart, and
+// those of the chains or the cursors are rejected.
+type reloader struct {
+	files configFlags
+	logs  *logging
+	log   config.LogConfig // Of the running configuration
+	app   *app.App
+}
+
+// watch reloads the configuration on SIGHUP, also reopening the log file, and
+// when a config file changes, until ctx is done.
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	files := make(map[string]bool)
+	if watcher, err := fsnotify.NewWatcher(); err != nil {
+		log.Warn("Failed to watch the config files, reload them with SIGHUP", "err", err)
+	} else {
+		defer watcher.Close()
+		// Directories are watched, files replaced by a rename would be lost
+		path, appPath := configFiles(r.files)
+		for _, p := range []string{path, appPath} {
+			if p == "" {
+				continue
+			}
+			abs, err := filepath.Abs(p)
+			if err == nil {
+				err = watcher.Add(filepath.Dir(abs))
+			}
+			if err != nil {
+				log.Warn("Failed to watch config file, reload it with SIGHUP", "file", p, "err", err)
+				continue
+			}
+			files[abs] = true
+		}
+		events, errs = watcher.Events, watcher.Errors
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logs.reopen()
+			r.apply()
+		case ev := <-events:
+			if files[filepath.Clean(ev.Name)] && !ev.Has(fsnotify.Chmod) {
+				pending = time.After(reloadDelay)
+			}
+		case err := <-errs:
+			log.Warn("Config file watcher failed", "err", err)
+		case <-pending:
+			pending = nil
+			r.apply()
+		}
+	}
+}
+
+// apply reloads the configuration, logging the outcome.
+func (r *reloader) apply() {
+	if err := r.reload(); err != nil {
+		log.Warn("Configuration reload rejected, keeping the running configuration", "err", err)
+		return
+	}
+	log.Info("Configuration reloaded")
+}
+
+// reload reads the config files and applies them. Nothing is applied unless
+// the whole configuration is valid.
+func (r *reloader) reload() error {
+	cfg, err := loadConfig(r.files)
+	if err != nil {
+		return err
+	}
+	restart, err := r.app.Reload(cfg)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Log.Level != r.log.Level {
+		// Else the level set through the admin API is kept
+		r.logs.level.Set(logLevel(cfg.Log.Level))
+	}
+	if cfg.Log.Format != r.log.Format || cfg.Log.File != r.log.File {
+		restart = append(restart, "log")
+		sort.Strings(restart)
+	}
+	if len(restart) > 0 {
+		log.Warn("Configuration changes need a restart to apply", "sections", restart)
+	}
+	r.log = cfg.Log
+	return nil
+}
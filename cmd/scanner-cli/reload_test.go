@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNode is an RPC node at block head, with one log per queried contract
+// in every batch.
+type testNode struct {
+	head uint64
+
+	mu      sync.Mutex
+	queried map[common.Address]bool
+	scanned uint64 // Highest block queried
+}
+
+// newTestNode serves a testNode at head, returning it and its URL.
+func newTestNode(t *testing.T, head uint64) (*testNode, string) {
+	node := &testNode{head: head, queried: make(map[common.Address]bool)}
+	server := gethrpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", node))
+	srv := httptest.NewServer(server)
+	t.Cleanup(func() {
+		srv.Close()
+		server.Stop()
+	})
+	return node, srv.URL
+}
+
+func (n *testNode) BlockNumber() hexutil.Uint64 { return hexutil.Uint64(n.head) }
+
+func (n *testNode) ChainId() *hexutil.Big { return (*hexutil.Big)(big.NewInt(7777)) }
+
+func (n *testNode) GetLogs(q struct {
+	FromBlock *hexutil.Big     `json:"fromBlock"`
+	ToBlock   *hexutil.Big     `json:"toBlock"`
+	Address   []common.Address `json:"address"`
+}) []types.Log {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.scanned = max(n.scanned, q.ToBlock.ToInt().Uint64())
+	logs := make([]types.Log, 0, len(q.Address))
+	for _, a := range q.Address {
+		n.queried[a] = true
+		logs = append(logs, types.Log{Address: a, Topics: []common.Hash{}, BlockNumber: q.FromBlock.ToInt().Uint64()})
+	}
+	return logs
+}
+
+func (n *testNode) wasQueried(a common.Address) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.queried[a]
+}
+
+func (n *testNode) scannedTo() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.scanned
+}
+
+func TestCLI_RunReload(t *testing.T) {
+	// Far ahead of the scanner, which keeps scanning
+	node, url := newTestNode(t, 1_000_000)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeConfig := func(chainID string, output string, contracts ...string) {
+		cfg := fmt.Sprintf(`
+project: "reload"
+rpc_nodes: [{url: %q, priority: 1}]
+scanner: {chain_id: %q, start_block: 100, batch_size: 10, interval: 20ms}
+filters: [{contracts: ["%s"]}]
+outputs: {file: {enabled: true, path: %q}}
+`, url, chainID, strings.Join(contracts, `", "`), filepath.Join(dir, output))
+		assert.NoError(t, os.WriteFile(path, []byte(cfg), 0o644))
+	}
+	a, b, c := common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToAddress("0x0c")
+	writeConfig("reload-chain", "a.jsonl", a.Hex())
+	t.Setenv("CONFIG_FILE", path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, nil) }()
+	assert.Eventually(t, func() bool { return node.wasQueried(a) }, 5*time.Second, 20*time.Millisecond)
+
+	// New contracts are scanned and the events go to the new file
+	writeConfig("reload-chain", "b.jsonl", a.Hex(), b.Hex())
+	assert.Eventually(t, func() bool {
+		data, _ := os.ReadFile(filepath.Join(dir, "b.jsonl"))
+		return node.wasQueried(b) && strings.Contains(strings.ToLower(string(data)), "0x000000000000000000000000000000000000000b")
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Invalid configurations and chain changes are rejected
+	writeConfig("reload-chain", "c.jsonl", "not-an-address")
+	time.Sleep(2 * reloadDelay)
+	writeConfig("other-chain", "c.jsonl", c.Hex())
+	time.Sleep(2 * reloadDelay)
+	assert.False(t, node.wasQueried(c))
+	assert.NoFileExists(t, filepath.Join(dir, "c.jsonl"))
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/84hero/evm-scanner/pkg/app"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// RunReplay implements "scanner-cli replay": it re-delivers events from a JSONL
+// file written by the file output to one of the configured outputs,
+// e.g. after that output was misconfigured, without rescanning the chain.
+func RunReplay(ctx context.Context, args []string) error {
+	log.SetDefault(log.NewLogger(log.NewTerminalHandlerWithLevel(os.Stderr, log.LevelInfo, true)))
+
+	fs := newFlagSet("replay", "")
+	files := addConfigFlags(fs)
+	fromFile := fs.String("from-file", "", "JSONL file written by the file output, optionally gzipped (.gz)")
+	to := fs.String("to", "", "Configured output to replay into, e.g. kafka")
+	fromBlock := fs.Uint64("from-block", 0, "First block to replay")
+	toBlock := fs.Uint64("to-block", 0, "Last block to replay, 0 = no limit")
+	events := fs.String("events", "", "Comma-separated event names to replay, empty = all")
+	batchSize := fs.Int("batch-size", 100, "Events per send")
+	rateLimit := fs.Float64("rate", 0, "Maximum events per second, 0 = unlimited")
+	dryRun := fs.Bool("dry-run", false, "Count the events that would be replayed without sending them")
+	offset := fs.Int64("offset", -1, "Byte offset to start at (default: the checkpoint, else 0)")
+	checkpoint := fs.String("checkpoint", "", "File recording the offset replayed so far, to resume an interrupted replay")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *fromFile == "" || (*to == "" && !*dryRun) {
+		return errors.New("replay: --from-file and --to are required")
+	}
+
+	opts := sink.ReplayOptions{
+		FromBlock: *fromBlock,
+		ToBlock:   *toBlock,
+		BatchSize: *batchSize,
+		RateLimit: *rateLimit,
+		DryRun:    *dryRun,
+		Offset:    *offset,
+	}
+	if *events != "" {
+		opts.Events = strings.Split(*events, ",")
+	}
+	if *checkpoint != "" {
+		if opts.Offset < 0 {
+			saved, err := readCheckpoint(*checkpoint)
+			if err != nil {
+				return err
+			}
+			opts.Offset = saved
+		}
+		opts.Checkpoint = func(offset int64) error { return writeCheckpoint(*checkpoint, offset) }
+	}
+	if opts.Offset < 0 {
+		opts.Offset = 0
+	}
+
+	in, err := openReplayFile(*fromFile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var out sink.Output
+	if !*dryRun {
+		cfg, err := loadConfig(*files)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if out, err = app.NewOutput(cfg, *to); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	log.Info("Replaying events", "file", *fromFile, "to", *to, "offset", opts.Offset, "dry_run", opts.DryRun)
+	stats, err := sink.Replay(ctx, in, out, opts)
+	log.Info("Replay finished", "read", stats.Read, "skipped", stats.Skipped, "sent", stats.Sent, "offset", stats.Offset)
+	return err
+}
+
+// openReplayFile opens path, decompressing it if it ends in ".gz" as rotated
+// files of the file output do. Offsets then count decompressed bytes.
+func openReplayFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// readCheckpoint returns the offset saved in path, or 0 if it does not exist.
+func readCheckpoint(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return offset, nil
+}
+
+// writeCheckpoint replaces the offset saved in path atomically.
+func writeCheckpoint(path string, offset int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := fmt.Fprintln(tmp, offset); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
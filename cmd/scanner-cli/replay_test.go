@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeEvents writes n events of blocks 1..n to a JSONL file in dir.
+func writeEvents(t *testing.T, dir string, n int) string {
+	path := filepath.Join(dir, "events.jsonl")
+	fo, err := sink.NewFileOutput(path)
+	assert.NoError(t, err)
+	logs := make([]sink.DecodedLog, n)
+	for i := range logs {
+		logs[i] = sink.DecodedLog{Log: types.Log{BlockNumber: uint64(i + 1), Topics: []common.Hash{}}, EventName: "Transfer"}
+	}
+	assert.NoError(t, fo.Send(context.Background(), logs))
+	assert.NoError(t, fo.Close())
+	return path
+}
+
+func countLines(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	assert.NoError(t, err)
+	defer f.Close()
+	n := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); n++ {
+	}
+	return n
+}
+
+func TestCLI_Replay(t *testing.T) {
+	dir := t.TempDir()
+	src := writeEvents(t, dir, 10)
+	dst := filepath.Join(dir, "replayed.jsonl")
+	cfgFile := filepath.Join(dir, "config.yaml")
+	// The file output is disabled for live scanning but can still be replayed into
+	assert.NoError(t, os.WriteFile(cfgFile, []byte("outputs:\n  file:\n    enabled: false\n    path: "+dst+"\n    filter: \"block_number >= 3\"\n"), 0o644))
+	t.Setenv("CONFIG_FILE", cfgFile)
+	ckpt := filepath.Join(dir, "replay.offset")
+
+	err := RunReplay(context.Background(), []string{"--from-file", src, "--to", "file", "--to-block", "6", "--checkpoint", ckpt})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, countLines(t, dst)) // Blocks 3 to 6
+
+	// The checkpoint covers the whole file, so running again replays nothing
+	info, _ := os.Stat(src)
+	saved, err := readCheckpoint(ckpt)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), saved)
+	assert.NoError(t, RunReplay(context.Background(), []string{"--from-file", src, "--to", "file", "--checkpoint", ckpt}))
+	assert.Equal(t, 4, countLines(t, dst))
+
+	// An explicit offset overrides the checkpoint
+	assert.NoError(t, RunReplay(context.Background(), []string{"--from-file", src, "--to", "file", "--offset", "0", "--events", "Approval"}))
+	assert.Equal(t, 4, countLines(t, dst))
+
+	err = RunReplay(context.Background(), []string{"--from-file", src, "--to", "carrier-pigeon"})
+	assert.ErrorContains(t, err, `unknown output "carrier-pigeon"`)
+
+	err = RunReplay(context.Background(), []string{"--from-file", src})
+	assert.EqualError(t, err, "replay: --from-file and --to are required")
+
+	assert.NoError(t, RunReplay(context.Background(), []string{"--from-file", src, "--dry-run"}))
+}
+
+func TestCLI_OpenReplayFile_Gzip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl.gz")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	_, _ = gz.Write([]byte("line\n"))
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, f.Close())
+
+	r, err := openReplayFile(path)
+	assert.NoError(t, err)
+	data := new(strings.Builder)
+	_, err = bufio.NewReader(r).WriteTo(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "line\n", data.String())
+	assert.NoError(t, r.Close())
+
+	assert.NoError(t, os.WriteFile(path, []byte("plain"), 0o644))
+	_, err = openReplayFile(path)
+	assert.Error(t, err)
+}
+
+func TestCLI_Checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.offset")
+	offset, err := readCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), offset)
+
+	assert.NoError(t, writeCheckpoint(path, 12345))
+	offset, err = readCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12345), offset)
+
+	assert.NoError(t, os.WriteFile(path, []byte("abc"), 0o644))
+	_, err = readCheckpoint(path)
+	assert.ErrorContains(t, err, "invalid checkpoint")
+}
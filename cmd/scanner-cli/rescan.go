@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/84hero/evm-scanner/pkg/app"
+	"github.com/84hero/evm-scanner/pkg/chain"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// RunRescan implements "scanner-cli rescan": it reprocesses a range of blocks
+// through the configured filters, decoders and outputs, e.g. after fixing a
+// decoder, without moving the cursor of the scanner, which may keep running.
+func RunRescan(ctx context.Context, args []string) error {
+	log.SetDefault(log.NewLogger(log.NewTerminalHandlerWithLevel(os.Stderr, log.LevelInfo, true)))
+
+	fs := newFlagSet("rescan", "")
+	files := addConfigFlags(fs)
+	from := fs.Uint64("from", 0, "First block to rescan")
+	to := fs.Uint64("to", 0, "Last block to rescan")
+	chainID := fs.String("chain", "", "Chain to rescan, required when several are scanned")
+	filter := fs.String("filter", "", "Description of the only filter to rescan, empty = all")
+	outputs := fs.String("outputs", "", "Comma-separated outputs to deliver to, e.g. kafka,postgres, empty = the enabled ones")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("rescan: unexpected arguments %q", fs.Args())
+	}
+	if *to == 0 {
+		return errors.New("rescan: --from and --to are required")
+	}
+
+	cfg, err := loadConfig(*files)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if path := os.Getenv("CHAINS_FILE"); path != "" {
+		if err := chain.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	opts := app.RescanOptions{ChainID: *chainID, From: *from, To: *to, Filter: *filter}
+	if *outputs != "" {
+		opts.Outputs = strings.Split(*outputs, ",")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := app.Rescan(ctx, cfg, opts); err != nil {
+		return err
+	}
+	log.Info("Rescan finished", "from", *from, "to", *to)
+	return nil
+}
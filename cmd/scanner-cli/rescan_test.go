@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCLI_Rescan(t *testing.T) {
+	node, url := newTestNode(t, 1000)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	cursors := filepath.Join(dir, "cursors.json")
+	events := filepath.Join(dir, "events.jsonl")
+	// The file output is disabled for live scanning but can still be rescanned into
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+project: "rescan"
+rpc_nodes: [{url: %q}]
+scanner: {chain_id: rescan-chain, batch_size: 10}
+filters:
+  - {description: usdt, contracts: ["0x000000000000000000000000000000000000000a"]}
+  - {description: usdc, contracts: ["0x000000000000000000000000000000000000000b"]}
+outputs: {file: {enabled: false, path: %q}}
+`, url, events)), 0o644))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("CURSOR_FILE", cursors)
+
+	// The cursor of the running scanner
+	store, err := storage.NewFileStoreWithConfig(storage.FileStoreConfig{Path: cursors, Prefix: "rescan_"})
+	assert.NoError(t, err)
+	assert.NoError(t, store.SaveCursor(context.Background(), "rescan-chain", 5000))
+	assert.NoError(t, store.Close())
+
+	assert.NoError(t, RunRescan(context.Background(), []string{"--from", "100", "--to", "149", "--filter", "usdt", "--outputs", "file"}))
+	assert.Equal(t, uint64(149), node.scannedTo())
+	assert.False(t, node.wasQueried(common.HexToAddress("0xb")))
+
+	// One event of the usdt contract per batch, marked replayed
+	data, err := os.ReadFile(events)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 5)
+	for _, line := range lines {
+		assert.Contains(t, line, `"replayed":true`)
+	}
+
+	store, err = storage.NewFileStoreWithConfig(storage.FileStoreConfig{Path: cursors, Prefix: "rescan_"})
+	assert.NoError(t, err)
+	defer store.Close()
+	saved, err := store.ListCursors(context.Background())
+	assert.NoError(t, err)
+	// The main cursor is untouched, the rescan cursor deleted once done
+	assert.Equal(t, uint64(5000), saved["rescan-chain"])
+	assert.NotContains(t, saved, scanner.BackfillKey("rescan-chain", "rescan-100-149-usdt"))
+
+	err = RunRescan(context.Background(), []string{"--from", "100", "--to", "149", "--filter", "dai"})
+	assert.EqualError(t, err, `rescan: no filter "dai" on chain rescan-chain`)
+	err = RunRescan(context.Background(), []string{"--from", "100"})
+	assert.EqualError(t, err, "rescan: --from and --to are required")
+	err = RunRescan(context.Background(), []string{"--from", "200", "--to", "100"})
+	assert.EqualError(t, err, "rescan: from 200 is after to 100")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/admin"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCLI_RunScanners(t *testing.T) {
+	nodeA, urlA := newTestNode(t, 1000)
+	nodeB, urlB := newTestNode(t, 2000)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	cursors := filepath.Join(dir, "cursors.json")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	adminAddr := l.Addr().String()
+	l.Close()
+	// chain-c fails on start, the others keep scanning
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+project: "multi"
+scanners:
+  - {chain_id: chain-a, rpc_nodes: [{url: %q}], start_block: 100, batch_size: 50, interval: 20ms, filters: [{contracts: ["0x000000000000000000000000000000000000000a"]}]}
+  - {chain_id: chain-b, rpc_nodes: [{url: %q}], start_block: 200, batch_size: 50, interval: 20ms, filters: [{contracts: ["0x000000000000000000000000000000000000000b"]}]}
+  - {chain_id: chain-c, rpc_nodes: [{url: %q}], finality: latest}
+outputs: {file: {enabled: true, path: %q}}
+admin: {listen: %q, token: admin-token}
+`, urlA, urlB, urlA, filepath.Join(dir, "events.jsonl"), adminAddr)), 0o644))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("CURSOR_FILE", cursors)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, nil) }()
+	assert.Eventually(t, func() bool {
+		return nodeA.scannedTo() == 1000 && nodeB.scannedTo() == 2000
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// The admin API lists every chain
+	req, err := http.NewRequest("GET", "http://"+adminAddr+"/status", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		var status admin.Status
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		resp.Body.Close()
+		assert.Len(t, status.Chains, 3)
+		if assert.Len(t, status.Outputs, 1) {
+			assert.Equal(t, "file", status.Outputs[0].Name)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+
+	store, err := storage.NewFileStoreWithConfig(storage.FileStoreConfig{Path: cursors, Prefix: "multi_"})
+	assert.NoError(t, err)
+	defer store.Close()
+	for chainID, want := range map[string]uint64{"chain-a": 1001, "chain-b": 2001, "chain-c": 0} {
+		got, err := store.LoadCursor(context.Background(), chainID)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got, chainID)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "events.jsonl"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"chain_id":"chain-a"`)
+	assert.Contains(t, string(data), `"chain_id":"chain-b"`)
+}
+
+func TestCLI_RunScanners_AllFailed(t *testing.T) {
+	_, url := newTestNode(t, 1000)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+scanners: [{chain_id: chain-a, rpc_nodes: [{url: %q}], finality: latest}]
+`, url)), 0o644))
+	t.Setenv("CONFIG_FILE", path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.EqualError(t, Run(ctx, nil), "every scanner failed")
+}
+
+func TestCLI_RunDryRun(t *testing.T) {
+	node, url := newTestNode(t, 1000)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	cursors := filepath.Join(dir, "cursors.json")
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`
+project: "dry"
+rpc_nodes: [{url: %q}]
+scanner: {chain_id: dry-chain, start_block: 100, end_block: 500, batch_size: 50, interval: 20ms}
+filters: [{contracts: ["0x000000000000000000000000000000000000000a", "0x000000000000000000000000000000000000000b"]}]
+outputs: {file: {enabled: true, path: %q}}
+dry_run: {samples: 1}
+`, url, filepath.Join(dir, "events.jsonl"))), 0o644))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("CURSOR_FILE", cursors)
+
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	assert.NoError(t, err)
+	defer stdout.Close()
+	orig := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = orig }()
+
+	// Ends at the end block on its own
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, Run(ctx, []string{"--dry-run"}))
+	os.Stdout = orig
+	assert.Equal(t, uint64(500), node.scannedTo())
+
+	// Nothing delivered nor saved
+	assert.NoFileExists(t, filepath.Join(dir, "events.jsonl"))
+	store, err := storage.NewFileStoreWithConfig(storage.FileStoreConfig{Path: cursors, Prefix: "dry_"})
+	assert.NoError(t, err)
+	defer store.Close()
+	saved, err := store.LoadCursor(context.Background(), "dry-chain")
+	assert.NoError(t, err)
+	assert.Zero(t, saved)
+
+	// One sample, then the report of the 9 batches of 100-500
+	out, err := os.ReadFile(stdout.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(out), "| Log |"), string(out))
+	assert.Contains(t, string(out), "dry-chain  0x000000000000000000000000000000000000000A  Log    9\n")
+	assert.Contains(t, string(out), "dry-chain  0x000000000000000000000000000000000000000b  Log    9\n")
+	assert.Regexp(t, `TOTAL +18\n$`, string(out))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+func main() {
+	log.SetDefault(log.NewLogger(log.NewTerminalHandlerWithLevel(os.Stderr, log.LevelWarn, true)))
+
+	url := flag.String("rpc", "https://eth.llamarpc.com", "RPC node to scan")
+	contract := flag.String("contract", "0xdAC17F958D2ee523a2206206994597C13D831ec7", "contract whose Transfer events are scanned (default USDT)")
+	blocks := flag.Uint64("blocks", 2000, "blocks to scan, ending at the safe head")
+	batches := flag.String("batch", "10,100,1000", "comma-separated batch sizes to compare")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	client, err := rpc.NewClient(ctx, []rpc.NodeConfig{{URL: *url, RateLimit: 50, MaxConcurrent: 10}})
+	if err != nil {
+		log.Crit("Failed to init client", "err", err)
+	}
+	defer client.Close()
+
+	// The same range for every batch size, ending a few blocks below the head
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		log.Crit("Failed to get block number", "err", err)
+	}
+	if *blocks == 0 || head < *blocks+12 {
+		log.Crit("Invalid block count", "blocks", *blocks, "head", head)
+	}
+	to := head - 12
+	from := to - *blocks + 1
+
+	// Read-only: only logs are fetched and counted, nothing is written
+	filter := scanner.NewFilter().
+		AddContract(common.HexToAddress(*contract)).
+		SetTopic(0, decoder.TopicERC20Transfer)
+
+	fmt.Printf("Scanning blocks %d-%d of %s\n", from, to, *url)
+	for _, field := range strings.Split(*batches, ",") {
+		batchSize, err := strconv.ParseUint(strings.TrimSpace(field), 10, 64)
+		if err != nil || batchSize == 0 {
+			log.Crit("Invalid batch size", "batch", field)
+		}
+
+		var logs atomic.Uint64
+		s := scanner.New(client, storage.NewMemoryStore("bench_"), scanner.Config{
+			ChainID:    "bench",
+			StartBlock: from,
+			EndBlock:   to,
+			BatchSize:  batchSize,
+			Interval:   time.Millisecond,
+		}, filter)
+		s.SetHandler(func(ctx context.Context, l []types.Log) error {
+			logs.Add(uint64(len(l)))
+			return nil
+		})
+
+		start := time.Now()
+		if err := s.Start(ctx); err != nil {
+			log.Crit("Scan failed", "batch", batchSize, "err", err)
+		}
+		elapsed := time.Since(start)
+
+		// In the format of go test -bench, so that runs can be compared with benchstat
+		fmt.Printf("BenchmarkBackfill/batch=%d \t1\t%d ns/op\t%.2f blocks/s\t%.2f logs/s\n",
+			batchSize, elapsed.Nanoseconds(), float64(*blocks)/elapsed.Seconds(), float64(logs.Load())/elapsed.Seconds())
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/84hero/evm-scanner/pkg/chain"
@@ -10,6 +11,7 @@ import (
 	"github.com/84hero/evm-scanner/pkg/scanner"
 	"github.com/84hero/evm-scanner/pkg/storage"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 func main() {
@@ -28,20 +30,25 @@ func main() {
 
 	// 2. Setup Scanner with the Registered Preset
 	ctx := context.Background()
-	client, _ := rpc.NewClient(ctx, []rpc.NodeConfig{{URL: "https://rpc.herochain.io"}})
+	// A single node needs no MultiClient: wrap a plain ethclient
+	// (use rpc.NewClient for failover between several nodes)
+	ec, err := ethclient.DialContext(ctx, "https://rpc.herochain.io")
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := rpc.WrapEthClient(ec)
+	defer client.Close()
 	store := storage.NewMemoryStore("herochain_")
 
-	// Get preset values
-	preset, _ := chain.Get("herochain")
-
 	config := scanner.Config{
-		ChainID:   "herochain",
-		BatchSize: preset.BatchSize, // Use value from preset
-		ReorgSafe: preset.ReorgSafe, // Use value from preset
-		Interval:  preset.BlockTime, // Sync interval matches block time
-		UseBloom:  true,             // Enable bloom filter for performance
+		ChainID:  "herochain",
+		UseBloom: true, // Enable bloom filter for performance
 	}
 
+	// Batch size, confirmations and sync interval (the block time) come from the preset
+	preset, _ := chain.Get("herochain")
+	chain.ApplyDefaults(&config, preset)
+
 	filter := scanner.NewFilter() // Scan all logs for demonstration
 
 	s := scanner.New(client, store, config, filter)
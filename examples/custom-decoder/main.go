@@ -12,10 +12,10 @@ import (
 	"github.com/84hero/evm-scanner/pkg/decoder"
 	"github.com/84hero/evm-scanner/pkg/rpc"
 	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
 	"github.com/84hero/evm-scanner/pkg/storage"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // Minimal ERC20 ABI for Transfer event
@@ -30,32 +30,46 @@ func main() {
 	client, _ := rpc.NewClient(ctx, rpcCfg)
 	store := storage.NewMemoryStore("decoder_demo_")
 
-	// 2. Setup Decoder
-	erc20Decoder, err := decoder.NewFromJSON(erc20ABI)
-	if err != nil {
+	// 2. Setup Decoder: the registry resolves ABIs by contract and topic0,
+	// and knows the topic0 of each event
+	usdtAddr := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	decoders := decoder.NewRegistry()
+	if err := decoders.AddABI(erc20ABI, decoder.WithAddresses(usdtAddr)); err != nil {
 		log.Fatal(err)
 	}
 
 	// 3. Define Filter (USDT)
-	usdtAddr := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
-	transferTopic := crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
-	filter := scanner.NewFilter().AddContract(usdtAddr).SetTopic(0, transferTopic)
+	filter := scanner.NewFilter().AddContract(usdtAddr).SetTopic(0, decoders.Topics()...)
 
 	// 4. Scanner with Decoding Logic
 	s := scanner.New(client, store, scanner.Config{
 		ChainID: "ethereum", Rewind: 5, Interval: 5 * time.Second,
 	}, filter)
 
+	// 5. Decoding pipeline: logs that cannot be decoded are kept raw, with
+	// their DecodeStatus, rather than dropped
+	dec, err := sink.NewDecoderWithConfig(sink.DecoderConfig{
+		Registry:      decoders,
+		OnDecodeError: sink.DecodeKeepRaw,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
-		for _, l := range logs {
-			// Try to decode the log using our ERC20 decoder
-			decoded, err := erc20Decoder.Decode(l)
-			if err != nil {
-				fmt.Printf("Decode failed for tx %s: %v\n", l.TxHash.Hex(), err)
+		events, err := dec.Decode(logs)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			l := e.Log
+			if e.DecodeStatus != sink.StatusDecoded {
+				fmt.Printf("Undecoded log in tx %s (%s): %s\n", l.TxHash.Hex(), e.DecodeStatus, e.DecodeError)
 				continue
 			}
 
 			// Access decoded fields in a type-safe way
+			decoded := e.DecodedData
 			from := decoded.Inputs["from"].(common.Address)
 			to := decoded.Inputs["to"].(common.Address)
 			value := decoded.Inputs["value"]
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/84hero/evm-scanner/pkg/app"
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// TallySink is a custom output counting the events of every contract, e.g.
+// to feed the metrics of the embedding service.
+type TallySink struct {
+	mu     sync.Mutex
+	counts map[common.Address]int
+}
+
+func (s *TallySink) Name() string { return "tally" }
+
+func (s *TallySink) Send(ctx context.Context, logs []sink.DecodedLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range logs {
+		s.counts[l.Log.Address]++
+	}
+	return nil
+}
+
+// Close logs the counts: the app closes its outputs when it stops.
+func (s *TallySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for contract, n := range s.counts {
+		log.Info("Events tallied", "contract", contract, "count", n)
+	}
+	return nil
+}
+
+func main() {
+	log.SetDefault(log.NewLogger(log.NewTerminalHandlerWithLevel(os.Stderr, log.LevelInfo, true)))
+
+	// 1. Load the same configuration as scanner-cli: chains, filters, outputs, storage
+	cfg, err := config.Load("config.yaml")
+	if err != nil {
+		log.Crit("Failed to load config", "err", err)
+	}
+
+	// 2. Set up the scanners, delivering to the configured outputs and to ours
+	tally := &TallySink{counts: make(map[common.Address]int)}
+	a, err := app.New(cfg, app.WithOutputs(tally))
+	if err != nil {
+		log.Crit("Failed to set up the scanners", "err", err)
+	}
+
+	// 3. Scan until interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := a.Run(ctx); err != nil {
+		log.Crit("Scanner failed", "err", err)
+	}
+}
@@ -64,6 +64,20 @@ func main() {
 		fmt.Println("File sink enabled: events.jsonl")
 	}
 
+	// Fan out to every sink in parallel. Best-effort: a failing sink is logged
+	// but never blocks the cursor; use sink.PolicyAll to retry the range instead.
+	pipeline := sink.NewMultiSink(outputs,
+		sink.WithPolicy(sink.PolicyBestEffort),
+		sink.WithTimeout(10*time.Second),
+		sink.WithErrorHandler(func(name string, err error) {
+			log.Printf("Sink %s error: %v", name, err)
+		}),
+		sink.WithLatencyHook(func(name string, elapsed time.Duration, err error) {
+			fmt.Printf("    sink %s took %s\n", name, elapsed)
+		}),
+	)
+	defer pipeline.Close()
+
 	// 5. Initialize Scanner
 	scanCfg := scanner.Config{
 		ChainID:   "ethereum",
@@ -83,12 +97,7 @@ func main() {
 		}
 
 		fmt.Printf(">>> Processed %d logs\n", len(logs))
-		for _, out := range outputs {
-			if err := out.Send(ctx, decodedLogs); err != nil {
-				log.Printf("Sink %s error: %v", out.Name(), err)
-			}
-		}
-		return nil
+		return pipeline.Send(ctx, decodedLogs)
 	})
 
 	// 7. Start & Handle Signals
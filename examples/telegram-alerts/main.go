@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// USDT ABI fragment (Transfer event only)
+const usdtABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"}]`
+
+// Message template rendered for every event, see transfer.tmpl
+//
+//go:embed transfer.tmpl
+var transferTemplate string
+
+func main() {
+	token, chatID := os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("TELEGRAM_CHAT_ID")
+	if token == "" || chatID == "" {
+		log.Fatal("TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID must be set")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 1. Setup RPC Client (Using public nodes for demo)
+	client, err := rpc.NewClient(ctx, []rpc.NodeConfig{
+		{URL: "https://rpc.ankr.com/eth", Priority: 1},
+	})
+	if err != nil {
+		log.Fatalf("Failed to init RPC client: %v", err)
+	}
+
+	// 2. Decoder and Filter (USDT Transfer events)
+	usdt := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	decoders := decoder.NewRegistry()
+	if err := decoders.AddABI(usdtABI, decoder.WithAddresses(usdt)); err != nil {
+		log.Fatalf("Failed to init decoder: %v", err)
+	}
+	filter := scanner.NewFilter().
+		AddContract(usdt).
+		SetTopic(0, decoders.Topics()...)
+
+	// 3. Telegram Sink: a webhook whose JSON body is replaced by the rendered
+	// template. The chat ID travels in the query string, the text in the body.
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage?chat_id=%s", token, chatID)
+	telegram, err := sink.WithTemplate(sink.NewWebhookOutput(url, "", 3, time.Second, 10*time.Second, false, 0, 0), transferTemplate)
+	if err != nil {
+		log.Fatalf("Invalid template: %v", err)
+	}
+	defer telegram.Close()
+
+	// 4. Initialize Scanner
+	s := scanner.New(client, storage.NewMemoryStore("telegram_"), scanner.Config{
+		ChainID:   "eth-mainnet",
+		Rewind:    5,
+		Interval:  12 * time.Second,
+		ReorgSafe: 2,
+		BatchSize: 10,
+	}, filter)
+
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		decodedLogs := make([]sink.DecodedLog, 0, len(logs))
+		for _, l := range logs {
+			decoded, err := decoders.Decode(l)
+			if err != nil {
+				continue
+			}
+			decodedLogs = append(decodedLogs, sink.DecodedLog{Log: l, DecodedData: decoded, EventName: decoded.Name})
+		}
+		return telegram.Send(ctx, decodedLogs)
+	})
+
+	// 5. Start & Handle Signals
+	go s.Start(ctx)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	fmt.Println("Shutting down...")
+}
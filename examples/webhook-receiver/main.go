@@ -1,13 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/sink"
 )
 
+// tolerance is how far from now a request may have been signed, bounding
+// the window in which a captured request can be replayed.
+const tolerance = 5 * time.Minute
+
 // DecodedLog represents the structure sent by the scanner
 type DecodedLog struct {
 	EventName   string                 `json:"event_name"`
@@ -18,6 +28,9 @@ type DecodedLog struct {
 }
 
 func main() {
+	// The secret of the webhook output; requests are not verified without it
+	secret := os.Getenv("WEBHOOK_SECRET")
+
 	http.HandleFunc("/webhook", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -30,6 +43,27 @@ func main() {
 			return
 		}
 
+		if secret != "" {
+			err := sink.VerifyWebhookSignature(secret, r.Header.Get("X-Scanner-Signature"), r.Header.Get("X-Scanner-Timestamp"), body, tolerance)
+			if err != nil {
+				fmt.Printf("Rejected request: %v\n", err)
+				http.Error(w, "Invalid signature", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// The signature covers the compressed bytes, so decompress after verifying
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(body))
+			if err == nil {
+				body, err = io.ReadAll(zr)
+			}
+			if err != nil {
+				http.Error(w, "Invalid gzip body", http.StatusBadRequest)
+				return
+			}
+		}
+
 		var logs []DecodedLog
 		if err := json.Unmarshal(body, &logs); err != nil {
 			fmt.Printf("Received raw body: %s\n", string(body))
@@ -0,0 +1,161 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenRuntime is the code of a minimal token: every call emits the ERC20
+// Transfer event from the caller to the address of the first word of the
+// calldata, for the value of the second one.
+//
+//	CALLDATACOPY(0, 32, 32)  value to memory
+//	LOG3(0, 32, Transfer, CALLER, CALLDATALOAD(0))
+var tokenRuntime = append(append(
+	common.FromHex("0x60206020600037600035337f"), decoder.TopicERC20Transfer.Bytes()...),
+	common.FromHex("0x60206000a300")...)
+
+// tokenInit deploys tokenRuntime: CODECOPY(0, 12, len) and RETURN(0, len).
+var tokenInit = append([]byte{
+	0x60, byte(len(tokenRuntime)), 0x60, 0x0c, 0x60, 0x00, 0x39,
+	0x60, byte(len(tokenRuntime)), 0x60, 0x00, 0xf3,
+}, tokenRuntime...)
+
+// erc20ABI is the ABI the logs of the token are decoded with.
+const erc20ABI = `[{"anonymous":false,"inputs":[
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"}]`
+
+// chain is a simulated chain with a deployed token and funded accounts.
+type chain struct {
+	t       *testing.T
+	backend *simulated.Backend
+	client  simulated.Client
+	keys    []*ecdsa.PrivateKey
+	token   common.Address
+	// nonces are those of the next transactions of the accounts: the pending
+	// ones of the pool lag behind its asynchronous updates.
+	nonces map[common.Address]uint64
+}
+
+// newChain starts a simulated chain of accounts funded accounts, deploying
+// the token from the first one.
+func newChain(t *testing.T, accounts int) *chain {
+	alloc := types.GenesisAlloc{}
+	c := &chain{t: t, nonces: map[common.Address]uint64{}}
+	for range accounts {
+		key, err := crypto.GenerateKey()
+		assert.NoError(t, err)
+		c.keys = append(c.keys, key)
+		alloc[crypto.PubkeyToAddress(key.PublicKey)] = types.Account{Balance: new(big.Int).Lsh(big.NewInt(1), 100)}
+	}
+	c.backend = simulated.NewBackend(alloc)
+	t.Cleanup(func() { c.backend.Close() })
+	c.client = c.backend.Client()
+
+	deployer := crypto.PubkeyToAddress(c.keys[0].PublicKey)
+	c.token = crypto.CreateAddress(deployer, 0)
+	c.send(c.keys[0], nil, tokenInit)
+	c.backend.Commit()
+	code, err := c.client.CodeAt(context.Background(), c.token, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tokenRuntime, code)
+	return c
+}
+
+// send signs and sends a transaction of key to to, a deployment if nil.
+func (c *chain) send(key *ecdsa.PrivateKey, to *common.Address, data []byte) {
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1337),
+		Nonce:     c.nonces[from],
+		GasTipCap: big.NewInt(params.GWei),
+		GasFeeCap: big.NewInt(100 * params.GWei),
+		Gas:       200000,
+		To:        to,
+		Data:      data,
+	})
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(big.NewInt(1337)), key)
+	assert.NoError(c.t, err)
+	assert.NoError(c.t, c.client.SendTransaction(context.Background(), signed))
+	c.nonces[from]++
+}
+
+// transfer emits a token Transfer from the account of key, mined at the next
+// Commit.
+func (c *chain) transfer(key *ecdsa.PrivateKey, to common.Address, value int64) {
+	data := append(common.LeftPadBytes(to.Bytes(), 32), common.LeftPadBytes(big.NewInt(value).Bytes(), 32)...)
+	c.send(key, &c.token, data)
+}
+
+// mine commits blocks blocks of transfers per block transfers of key each,
+// returning the hashes of the blocks.
+func (c *chain) mine(key *ecdsa.PrivateKey, blocks, transfers int) []common.Hash {
+	var hashes []common.Hash
+	for range blocks {
+		for i := range transfers {
+			c.transfer(key, common.BigToAddress(big.NewInt(int64(i+1))), int64(len(hashes)*100+i+1))
+		}
+		hashes = append(hashes, c.backend.Commit())
+	}
+	return hashes
+}
+
+// head returns the number of the latest block.
+func (c *chain) head() uint64 {
+	head, err := c.client.BlockNumber(context.Background())
+	assert.NoError(c.t, err)
+	return head
+}
+
+// hash returns the hash of the canonical block number.
+func (c *chain) hash(number uint64) common.Hash {
+	header, err := c.client.HeaderByNumber(context.Background(), new(big.Int).SetUint64(number))
+	assert.NoError(c.t, err)
+	return header.Hash()
+}
+
+// logs returns the token logs of the canonical blocks from to to, the ground
+// truth of the scans.
+func (c *chain) logs(from, to uint64) []types.Log {
+	logs, err := c.client.FilterLogs(context.Background(), ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{c.token},
+	})
+	assert.NoError(c.t, err)
+	return logs
+}
+
+// node returns the chain as the rpc node the scanner reads it through.
+func (c *chain) node() *rpc.Node {
+	return rpc.NewNodeWithClient(rpc.NodeConfig{URL: "simulated", Priority: 100}, ethClient{c.client})
+}
+
+// ethClient adapts the simulated client to rpc.EthClient.
+type ethClient struct {
+	simulated.Client
+}
+
+func (ethClient) BlockReceipts(context.Context, gethrpc.BlockNumberOrHash) ([]*types.Receipt, error) {
+	return nil, errors.New("block receipts not supported by the simulated client")
+}
+
+func (ethClient) Close() {}
@@ -0,0 +1,6 @@
+// Package integration holds the end-to-end tests of the scanner: the real
+// Scanner, rpc node, decoder and outputs against a go-ethereum simulated
+// chain producing reorgs. They need no external services and run with
+//
+//	go test -tags=integration ./integration/...
+package integration
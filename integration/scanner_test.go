@@ -0,0 +1,200 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is an output recording the logs sent to it.
+type recorder struct {
+	mu   sync.Mutex
+	logs []sink.DecodedLog
+}
+
+func (r *recorder) Name() string { return "recorder" }
+
+func (r *recorder) Send(ctx context.Context, logs []sink.DecodedLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs = append(r.logs, logs...)
+	return nil
+}
+
+func (r *recorder) Close() error { return nil }
+
+func (r *recorder) received() []sink.DecodedLog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]sink.DecodedLog(nil), r.logs...)
+}
+
+// logID identifies a log of a block, telling apart those of reorganized ones.
+func logID(l types.Log) string {
+	return fmt.Sprintf("%s/%s/%d", l.BlockHash.Hex(), l.TxHash.Hex(), l.Index)
+}
+
+// counts returns how many times each log of logs was received.
+func counts(logs []sink.DecodedLog) map[string]int {
+	n := map[string]int{}
+	for _, l := range logs {
+		n[logID(l.Log)]++
+	}
+	return n
+}
+
+const (
+	chainID   = "sim"
+	reorgSafe = 3
+)
+
+// run scans c into store with cfg until ctx is done, sending the decoded
+// logs to out, and returns the error of Start.
+func run(t *testing.T, ctx context.Context, c *chain, store storage.Persistence, cfg scanner.Config, out sink.Output) <-chan error {
+	registry := decoder.NewRegistry()
+	assert.NoError(t, registry.AddABI(erc20ABI))
+	d, err := sink.NewDecoderWithConfig(sink.DecoderConfig{Registry: registry, ChainID: chainID})
+	assert.NoError(t, err)
+
+	filter := scanner.NewFilter().AddContract(c.token).SetTopic(0, decoder.TopicERC20Transfer)
+	s := scanner.New(c.node(), store, cfg, filter)
+	s.SetHandler(sink.HandleDecoded(d, out.Send))
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+	return done
+}
+
+func config() scanner.Config {
+	return scanner.Config{
+		ChainID:             chainID,
+		StartBlock:          1,
+		BatchSize:           4,
+		ReorgSafe:           reorgSafe,
+		Interval:            10 * time.Millisecond,
+		CursorFlushInterval: -1,
+	}
+}
+
+// waitCursor waits for the cursor of store to reach next.
+func waitCursor(t *testing.T, store storage.Persistence, next uint64) {
+	assert.Eventually(t, func() bool {
+		cursor, err := store.LoadCursor(context.Background(), chainID)
+		return err == nil && cursor == next
+	}, 10*time.Second, 5*time.Millisecond)
+}
+
+// assertExactlyOnce checks that out received each canonical log up to block
+// to exactly once, decoded, and no other log.
+func assertExactlyOnce(t *testing.T, c *chain, out *recorder, to uint64) {
+	want := c.logs(1, to)
+	got := counts(out.received())
+	assert.Len(t, got, len(want))
+	for _, l := range want {
+		assert.Equal(t, 1, got[logID(l)], "log %d of block %d", l.Index, l.BlockNumber)
+	}
+	for _, l := range out.received() {
+		assert.Equal(t, "Transfer", l.EventName)
+		assert.Equal(t, chainID, l.ChainID)
+	}
+}
+
+func TestScanner_ExactlyOnce(t *testing.T) {
+	c := newChain(t, 1)
+	c.mine(c.keys[0], 10, 3)
+	store := storage.NewMemoryStore("")
+	out := &recorder{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := run(t, ctx, c, store, config(), out)
+
+	// The cursor stops ReorgSafe blocks below the head
+	head := c.head()
+	waitCursor(t, store, head-reorgSafe+1)
+	assertExactlyOnce(t, c, out, head-reorgSafe)
+
+	// and follows it as blocks are mined
+	c.mine(c.keys[0], 5, 2)
+	head = c.head()
+	waitCursor(t, store, head-reorgSafe+1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assertExactlyOnce(t, c, out, head-reorgSafe)
+}
+
+func TestScanner_Reorg(t *testing.T) {
+	c := newChain(t, 2)
+	c.mine(c.keys[0], 10, 2)
+	store := storage.NewMemoryStore("")
+	out := &recorder{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := run(t, ctx, c, store, config(), out)
+	head := c.head()
+	waitCursor(t, store, head-reorgSafe+1)
+
+	// Replace the last two blocks, above the scanned ones, by a longer side
+	// chain of transfers of another account
+	orphaned := map[common.Hash]bool{c.hash(head - 1): true, c.hash(head): true}
+	assert.NoError(t, c.backend.Fork(c.hash(head-2)))
+	c.mine(c.keys[1], 6, 2)
+	assert.False(t, orphaned[c.hash(head)])
+
+	head = c.head()
+	waitCursor(t, store, head-reorgSafe+1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	for _, l := range out.received() {
+		assert.False(t, orphaned[l.Log.BlockHash], "log of orphaned block %d", l.Log.BlockNumber)
+	}
+	assertExactlyOnce(t, c, out, head-reorgSafe)
+}
+
+func TestScanner_Restart(t *testing.T) {
+	c := newChain(t, 1)
+	c.mine(c.keys[0], 10, 2)
+	store := storage.NewMemoryStore("")
+	out := &recorder{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := run(t, ctx, c, store, config(), out)
+	head := c.head()
+	stopped := head - reorgSafe + 1
+	waitCursor(t, store, stopped)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// Restarting on the same store rescans the CursorRewind blocks below the
+	// cursor, and only those
+	c.mine(c.keys[0], 4, 2)
+	cfg := config()
+	cfg.CursorRewind = 2
+	ctx, cancel = context.WithCancel(context.Background())
+	done = run(t, ctx, c, store, cfg, out)
+	head = c.head()
+	waitCursor(t, store, head-reorgSafe+1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	got := counts(out.received())
+	want := c.logs(1, head-reorgSafe)
+	assert.Len(t, got, len(want))
+	for _, l := range want {
+		times := 1
+		if l.BlockNumber >= stopped-2 && l.BlockNumber < stopped {
+			times = 2
+		}
+		assert.Equal(t, times, got[logID(l)], "log %d of block %d", l.Index, l.BlockNumber)
+	}
+}
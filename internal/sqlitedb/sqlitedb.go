@@ -0,0 +1,80 @@
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	_ "modernc.org/sqlite"
+)
+
+// BusyTimeout is how long (ms) a writer waits for a competing lock before failing.
+const BusyTimeout = 5000
+
+var (
+	mu      sync.Mutex
+	handles = make(map[string]*DB)
+)
+
+// DB is a reference-counted *sql.DB shared by every user of the same SQLite file.
+// Sharing a single handle (with a single connection) serializes writers inside the
+// process, so the cursor store and the event sink can safely use the same file.
+type DB struct {
+	*sql.DB
+	path string
+	refs int
+}
+
+// Open returns the shared handle for path, opening the file in WAL mode on first use.
+// Every successful Open must be paired with a Close.
+func Open(path string) (*DB, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if h, ok := handles[abs]; ok {
+		h.refs++
+		return h, nil
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)",
+		(&url.URL{Path: abs}).EscapedPath(), BusyTimeout)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	h := &DB{DB: db, path: abs, refs: 1}
+	handles[abs] = h
+	return h, nil
+}
+
+// Close releases this reference and closes the file once the last user is done.
+func (d *DB) Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	d.refs--
+	if d.refs > 0 {
+		return nil
+	}
+	delete(handles, d.path)
+	return d.DB.Close()
+}
+
+// QuoteIdent quotes an identifier (e.g. a table name) for use in SQL statements.
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
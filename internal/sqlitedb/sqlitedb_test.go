@@ -0,0 +1,39 @@
+package sqlitedb
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen_SharedHandle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.db")
+
+	a, err := Open(path)
+	assert.NoError(t, err)
+	b, err := Open(path)
+	assert.NoError(t, err)
+	assert.Same(t, a, b)
+
+	var mode string
+	assert.NoError(t, a.QueryRow("PRAGMA journal_mode").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+
+	// First Close only drops a reference
+	assert.NoError(t, a.Close())
+	assert.NoError(t, b.Ping())
+
+	assert.NoError(t, b.Close())
+	assert.Error(t, b.Ping())
+}
+
+func TestOpen_InvalidPath(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing", "dir", "x.db"))
+	assert.Error(t, err)
+}
+
+func TestQuoteIdent(t *testing.T) {
+	assert.Equal(t, `"evm-scanner_checkpoints"`, QuoteIdent("evm-scanner_checkpoints"))
+	assert.Equal(t, `"a""b"`, QuoteIdent(`a"b`))
+}
@@ -2,15 +2,22 @@ package webhook
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
@@ -21,6 +28,49 @@ type Config struct {
 	MaxAttempts    int           `mapstructure:"max_attempts"`
 	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
 	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+
+	// Headers are added to every request, e.g. API gateway keys.
+	Headers map[string]string `mapstructure:"headers"`
+	// BearerToken, when set, is sent as "Authorization: Bearer <token>".
+	BearerToken string `mapstructure:"bearer_token"`
+
+	// MaxEventsPerRequest and MaxPayloadBytes split a batch into several
+	// sequential requests, each signed and retried on its own. 0 means no limit.
+	MaxEventsPerRequest int `mapstructure:"max_events_per_request"`
+	MaxPayloadBytes     int `mapstructure:"max_payload_bytes"`
+
+	// TLS configures client certificates and trusted CAs for HTTPS endpoints.
+	TLS tlsconfig.Config `mapstructure:"tls"`
+
+	// Timeout bounds each request attempt, 10s by default.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// MaxIdleConns is the number of keep-alive connections kept open to the
+	// endpoint, 100 by default, and IdleConnTimeout how long an idle one is
+	// kept, 90s by default.
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	IdleConnTimeout time.Duration `mapstructure:"idle_conn_timeout"`
+	// HTTPClient, when set, sends the requests instead of a client built from
+	// Timeout, MaxIdleConns, IdleConnTimeout and TLS, which are then ignored.
+	HTTPClient *http.Client `mapstructure:"-"`
+
+	// EnableCompression gzips bodies above CompressionThreshold bytes, 1024
+	// by default, with Content-Encoding: gzip; the signature is that of the
+	// compressed bytes sent. An endpoint answering 415 gets the body again
+	// uncompressed, and no compressed ones afterwards.
+	EnableCompression    bool `mapstructure:"enable_compression"`
+	CompressionThreshold int  `mapstructure:"compression_threshold"`
+
+	// LegacySignature signs the body alone, without X-Scanner-Timestamp, for
+	// receivers not yet verifying the v1 scheme of Sign. Deprecated: to be
+	// removed in the next release.
+	LegacySignature bool `mapstructure:"legacy_signature"`
+
+	// Sender, when set, sends the bodies instead of the HTTP requests to URL,
+	// with the same retries: errors are retried like network errors, those
+	// wrapping a StatusError by its status.
+	Sender interface {
+		Send(ctx context.Context, body []byte) error
+	} `mapstructure:"-"`
 }
 
 // Client defines the Webhook client
@@ -28,10 +78,11 @@ type Client struct {
 	cfg        Config
 	secret     []byte
 	httpClient *http.Client
+	noGzip     atomic.Bool // The endpoint answered 415 to a compressed body
 }
 
-// NewClient initializes a new Webhook client
-func NewClient(cfg Config) *Client {
+// NewClient initializes a new Webhook client. It fails if the TLS files cannot be loaded.
+func NewClient(cfg Config) (*Client, error) {
 	if cfg.MaxAttempts <= 0 {
 		cfg.MaxAttempts = 1
 	}
@@ -41,36 +92,194 @@ func NewClient(cfg Config) *Client {
 	if cfg.MaxBackoff <= 0 {
 		cfg.MaxBackoff = 10 * time.Second
 	}
+	if cfg.CompressionThreshold <= 0 {
+		cfg.CompressionThreshold = 1024
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		var err error
+		if httpClient, err = newHTTPClient(cfg); err != nil {
+			return nil, fmt.Errorf("webhook: %w", err)
+		}
+	}
 
 	return &Client{
-		cfg:    cfg,
-		secret: []byte(cfg.Secret),
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		cfg:        cfg,
+		secret:     []byte(cfg.Secret),
+		httpClient: httpClient,
+	}, nil
+}
+
+// newHTTPClient builds the HTTP client of cfg. All its connections go to the
+// one endpoint, so MaxIdleConns bounds those per host too.
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	transport, err := cfg.TLS.Transport()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
 	}
+	transport.MaxIdleConnsPerHost = transport.MaxIdleConns
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
 }
 
 // Payload defines the data structure sent via webhook to consumers.
 type Payload struct {
-	Timestamp int64       `json:"timestamp"`
-	Logs      []types.Log `json:"logs"`
+	Timestamp      int64       `json:"timestamp"`
+	ChainID        string      `json:"chain_id,omitempty"`
+	NumericChainID uint64      `json:"numeric_chain_id,omitempty"`
+	Logs           []types.Log `json:"logs"`
+}
+
+// Chain identifies the chain a batch of logs was scanned from.
+type Chain struct {
+	ID        string // Configured chain name or id, e.g. "eth-mainnet"
+	NumericID uint64 // EIP-155 chain id, 0 when unknown
 }
 
-// Send pushes logs with retry logic
+// Send pushes logs with retry logic. Batches above MaxEventsPerRequest or
+// MaxPayloadBytes are sent as several requests in order; Send stops at the
+// first chunk that still fails after its retries.
 func (c *Client) Send(ctx context.Context, logs []types.Log) error {
+	return c.SendChain(ctx, Chain{}, logs)
+}
+
+// SendChain is Send with the chain the logs were scanned from in the payload.
+func (c *Client) SendChain(ctx context.Context, chain Chain, logs []types.Log) error {
 	if len(logs) == 0 {
 		return nil
 	}
 
-	payload := Payload{
-		Timestamp: time.Now().Unix(),
-		Logs:      logs,
+	header := Payload{Timestamp: time.Now().Unix(), ChainID: chain.ID, NumericChainID: chain.NumericID}
+	chunks, err := c.chunk(header, logs)
+	if err != nil {
+		return err
+	}
+	for i, chunk := range chunks {
+		if err := c.sendBody(ctx, chunk.body, "application/json", IdempotencyKey(chain.ID, chunk.logs)); err != nil {
+			if len(chunks) > 1 {
+				return fmt.Errorf("chunk %d/%d: %w", i+1, len(chunks), err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// IdempotencyKey returns the X-Scanner-Idempotency-Key of a payload of logs
+// from chain: the hex SHA-256 of the chain and the tx hash and log index of
+// each log, so that a batch sent again, e.g. after a restart, keeps its key
+// although the payload timestamp changed. Removed logs are keyed apart from
+// the logs they revert.
+func IdempotencyKey(chain string, logs []types.Log) string {
+	h := sha256.New()
+	h.Write([]byte(chain))
+	for _, l := range logs {
+		fmt.Fprintf(h, "\n%s:%d", l.TxHash.Hex(), l.Index)
+		if l.Removed {
+			h.Write([]byte(":removed"))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// payloadChunk is a request body and the logs it carries.
+type payloadChunk struct {
+	body []byte
+	logs []types.Log
+}
+
+// chunk encodes logs into request bodies within the configured limits.
+func (c *Client) chunk(header Payload, logs []types.Log) ([]payloadChunk, error) {
+	size := len(logs)
+	if c.cfg.MaxEventsPerRequest > 0 && c.cfg.MaxEventsPerRequest < size {
+		size = c.cfg.MaxEventsPerRequest
+	}
+
+	var chunks []payloadChunk
+	for start := 0; start < len(logs); start += size {
+		end := min(start+size, len(logs))
+		encoded, err := c.encode(header, logs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, encoded...)
 	}
+	return chunks, nil
+}
 
-	body, err := json.Marshal(payload)
+// encode marshals logs into header, halving the batch while it exceeds MaxPayloadBytes.
+func (c *Client) encode(header Payload, logs []types.Log) ([]payloadChunk, error) {
+	header.Logs = logs
+	body, err := json.Marshal(header)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if c.cfg.MaxPayloadBytes <= 0 || len(body) <= c.cfg.MaxPayloadBytes {
+		return []payloadChunk{{body: body, logs: logs}}, nil
+	}
+	if len(logs) == 1 {
+		return nil, fmt.Errorf("webhook payload of a single event is %d bytes, above the %d byte limit", len(body), c.cfg.MaxPayloadBytes)
+	}
+
+	half := len(logs) / 2
+	first, err := c.encode(header, logs[:half])
+	if err != nil {
+		return nil, err
+	}
+	second, err := c.encode(header, logs[half:])
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// StatusError is returned when the endpoint answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration // Parsed Retry-After header, 0 if absent
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d", e.StatusCode)
+}
+
+// Temporary reports whether retrying may succeed: 5xx, 408 and 429.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// SendBody pushes a pre-rendered body with retry logic. Network errors, 5xx,
+// 408 and 429 are retried with jittered exponential backoff, or after the
+// Retry-After the server asked for (capped by MaxBackoff); other 4xx responses
+// fail immediately.
+//
+// The idempotency key of a pre-rendered body is its hex SHA-256, the same
+// across retries, so consumers can drop replays.
+func (c *Client) SendBody(ctx context.Context, body []byte, contentType string) error {
+	sum := sha256.Sum256(body)
+	return c.sendBody(ctx, body, contentType, hex.EncodeToString(sum[:]))
+}
+
+// sendBody is SendBody with the idempotency key of the body.
+func (c *Client) sendBody(ctx context.Context, body []byte, contentType, idempotencyKey string) error {
+	// Compressed once for all attempts
+	var gzipped []byte
+	if c.cfg.Sender == nil && c.cfg.EnableCompression && len(body) > c.cfg.CompressionThreshold && !c.noGzip.Load() {
+		var err error
+		if gzipped, err = gzipBody(body); err != nil {
+			return fmt.Errorf("webhook compression: %w", err)
+		}
 	}
 
 	var lastErr error
@@ -85,8 +294,13 @@ func (c *Client) Send(ctx context.Context, logs []types.Log) error {
 		}
 
 		if i > 0 {
-			// Wait for backoff
-			timer := time.NewTimer(backoff)
+			wait := jitter(backoff)
+			var statusErr *StatusError
+			if errors.As(lastErr, &statusErr) && statusErr.RetryAfter > 0 {
+				wait = min(statusErr.RetryAfter, c.cfg.MaxBackoff)
+			}
+
+			timer := time.NewTimer(wait)
 			select {
 			case <-ctx.Done():
 				timer.Stop()
@@ -95,40 +309,109 @@ func (c *Client) Send(ctx context.Context, logs []types.Log) error {
 			}
 
 			// Exponential backoff
-			backoff *= 2
-			if backoff > c.cfg.MaxBackoff {
-				backoff = c.cfg.MaxBackoff
-			}
+			backoff = min(backoff*2, c.cfg.MaxBackoff)
 		}
 
-		err := c.attemptSend(ctx, body)
+		var err error
+		if c.cfg.Sender != nil {
+			err = c.cfg.Sender.Send(ctx, body)
+		} else {
+			err = c.attemptCompressed(ctx, body, gzipped, contentType, idempotencyKey)
+		}
 		if err == nil {
 			return nil // Success
 		}
 
 		lastErr = err
-		// For 4xx client errors (e.g., 400 Bad Request), retries usually don't help.
-		// Simplified logic: retry for network errors and 5xx.
-		// attemptSend already encapsulates StatusCode check.
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && !statusErr.Temporary() {
+			return fmt.Errorf("webhook rejected: %w", err)
+		}
 	}
 
 	return fmt.Errorf("webhook failed after %d attempts: %w", c.cfg.MaxAttempts, lastErr)
 }
 
-func (c *Client) attemptSend(ctx context.Context, body []byte) error {
+// jitter spreads retries of concurrent senders over [d/2, d).
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + rand.N(d-half)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// gzipBody returns body compressed with gzip.
+func gzipBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// attemptCompressed sends gzipped, the compressed body, unless nil or the
+// endpoint does not accept gzip, falling back to body on a 415 answer.
+func (c *Client) attemptCompressed(ctx context.Context, body, gzipped []byte, contentType, idempotencyKey string) error {
+	if gzipped != nil && !c.noGzip.Load() {
+		err := c.attemptSend(ctx, gzipped, "gzip", contentType, idempotencyKey)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnsupportedMediaType {
+			return err
+		}
+		c.noGzip.Store(true)
+	}
+	return c.attemptSend(ctx, body, "", contentType, idempotencyKey)
+}
+
+func (c *Client) attemptSend(ctx context.Context, body []byte, contentEncoding, contentType, idempotencyKey string) error {
 	req, err := http.NewRequestWithContext(ctx, "POST", c.cfg.URL, bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
 	req.Header.Set("User-Agent", "evm-scanner-cli/v1")
+	for k, v := range c.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if c.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.BearerToken)
+	}
+	req.Header.Set("X-Scanner-Idempotency-Key", idempotencyKey)
 
 	if len(c.secret) > 0 {
-		h := hmac.New(sha256.New, c.secret)
-		h.Write(body)
-		signature := hex.EncodeToString(h.Sum(nil))
-		req.Header.Set("X-Scanner-Signature", signature)
+		if c.cfg.LegacySignature {
+			req.Header.Set("X-Scanner-Signature", SignLegacy(c.secret, body))
+		} else {
+			// Per attempt: a retry is a fresh request, not a replay
+			timestamp := time.Now().Unix()
+			req.Header.Set("X-Scanner-Timestamp", strconv.FormatInt(timestamp, 10))
+			req.Header.Set("X-Scanner-Signature", Sign(c.secret, timestamp, body))
+		}
 	}
 
 	resp, err := c.httpClient.Do(req)
@@ -138,10 +421,61 @@ func (c *Client) attemptSend(ctx context.Context, body []byte) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		// Typically only 5xx or 429 should be retried.
-		// Simplified: any non-2xx is considered a failure.
-		return fmt.Errorf("status %d", resp.StatusCode)
+		return &StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
 	return nil
 }
+
+// Errors of Verify.
+var (
+	ErrSignature      = errors.New("invalid webhook signature")
+	ErrStaleTimestamp = errors.New("webhook timestamp outside the tolerance")
+)
+
+// Sign returns the X-Scanner-Signature of body sent at timestamp, in Unix
+// seconds: "v1=" and the hex HMAC-SHA256 with secret of the timestamp, a dot
+// and body. The scheme prefix lets later schemes be sent alongside, comma
+// separated.
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	h.Write(body)
+	return "v1=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// SignLegacy returns the X-Scanner-Signature of body with LegacySignature:
+// the hex HMAC-SHA256 of body alone, which can be replayed.
+func SignLegacy(secret, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks the X-Scanner-Signature and X-Scanner-Timestamp headers of a
+// request of body: it fails with ErrSignature unless a v1 signature of the
+// header matches, and with ErrStaleTimestamp if the timestamp is further than
+// tolerance from now, rejecting replays of older requests.
+func Verify(secret []byte, signature, timestamp string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrSignature, timestamp)
+	}
+	want := Sign(secret, ts, body)
+	valid := false
+	for _, sig := range strings.Split(signature, ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(sig)), []byte(want)) {
+			valid = true
+		}
+	}
+	if !valid {
+		return ErrSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: %s old", ErrStaleTimestamp, age.Truncate(time.Second))
+	}
+	return nil
+}
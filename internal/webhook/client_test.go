@@ -1,22 +1,33 @@
 package webhook
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/84hero/evm-scanner/internal/tlstest"
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/stretchr/testify/assert"
 )
 
+func newTestClient(t *testing.T, cfg Config) *Client {
+	client, err := NewClient(cfg)
+	assert.NoError(t, err)
+	return client
+}
+
 func TestWebhookSend(t *testing.T) {
 	secret := "my-secret"
 
@@ -33,18 +44,21 @@ func TestWebhookSend(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Len(t, p.Logs, 1)
 
-		// Validate HMAC signature
+		// Validate HMAC signature: v1= over the timestamp, a dot and the body
+		timestamp := r.Header.Get("X-Scanner-Timestamp")
 		h := hmac.New(sha256.New, []byte(secret))
+		h.Write([]byte(timestamp + "."))
 		h.Write(body)
-		expectedSig := hex.EncodeToString(h.Sum(nil))
+		expectedSig := "v1=" + hex.EncodeToString(h.Sum(nil))
 		assert.Equal(t, expectedSig, r.Header.Get("X-Scanner-Signature"))
+		assert.NoError(t, Verify([]byte(secret), expectedSig, timestamp, body, time.Minute, time.Now()))
 
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer ts.Close()
 
 	// 2. Test Sending
-	client := NewClient(Config{URL: ts.URL, Secret: "my-secret"})
+	client := newTestClient(t, Config{URL: ts.URL, Secret: "my-secret"})
 	logs := []types.Log{
 		{
 			Index:   1,
@@ -57,6 +71,39 @@ func TestWebhookSend(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestWebhook_LegacySignature(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		h := hmac.New(sha256.New, []byte("my-secret"))
+		h.Write(body)
+		assert.Equal(t, hex.EncodeToString(h.Sum(nil)), r.Header.Get("X-Scanner-Signature"))
+		assert.Empty(t, r.Header.Get("X-Scanner-Timestamp"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, Config{URL: ts.URL, Secret: "my-secret", LegacySignature: true})
+	assert.NoError(t, client.Send(context.Background(), []types.Log{{Topics: []common.Hash{}, Data: []byte{}}}))
+}
+
+func TestVerify(t *testing.T) {
+	secret, body := []byte("my-secret"), []byte(`{"logs":[]}`)
+	now := time.Unix(1700000000, 0)
+	sig := Sign(secret, now.Unix(), body)
+	assert.Regexp(t, "^v1=[0-9a-f]{64}$", sig)
+
+	assert.NoError(t, Verify(secret, sig, "1700000000", body, 5*time.Minute, now.Add(4*time.Minute)))
+	// Later schemes may be sent alongside
+	assert.NoError(t, Verify(secret, "v2=abc, "+sig, "1700000000", body, 5*time.Minute, now))
+
+	assert.ErrorIs(t, Verify(secret, sig, "1700000000", []byte(`{"logs":[1]}`), 5*time.Minute, now), ErrSignature)
+	assert.ErrorIs(t, Verify(secret, sig, "1700000001", body, 5*time.Minute, now), ErrSignature)
+	assert.ErrorIs(t, Verify(secret, sig, "soon", body, 5*time.Minute, now), ErrSignature)
+	assert.ErrorIs(t, Verify(secret, SignLegacy(secret, body), "1700000000", body, 5*time.Minute, now), ErrSignature)
+	assert.ErrorIs(t, Verify(secret, sig, "1700000000", body, 5*time.Minute, now.Add(6*time.Minute)), ErrStaleTimestamp)
+	assert.ErrorIs(t, Verify(secret, sig, "1700000000", body, 5*time.Minute, now.Add(-6*time.Minute)), ErrStaleTimestamp)
+}
+
 func TestWebhook_Retry(t *testing.T) {
 	attempts := 0
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -70,7 +117,7 @@ func TestWebhook_Retry(t *testing.T) {
 	defer ts.Close()
 
 	// Set short backoff for faster test
-	client := NewClient(Config{
+	client := newTestClient(t, Config{
 		URL:            ts.URL,
 		MaxAttempts:    3,
 		InitialBackoff: 1 * time.Millisecond,
@@ -90,10 +137,381 @@ func TestWebhook_ContextCancel(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	client := NewClient(Config{URL: ts.URL, MaxAttempts: 3})
+	client := newTestClient(t, Config{URL: ts.URL, MaxAttempts: 3})
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
 
 	err := client.Send(ctx, []types.Log{{Index: 1}})
 	assert.Error(t, err)
 }
+
+func TestWebhook_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	client := newTestClient(t, Config{URL: ts.URL, Timeout: 20 * time.Millisecond})
+	start := time.Now()
+	assert.ErrorContains(t, client.SendBody(context.Background(), []byte("hello"), "text/plain"), "Client.Timeout")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWebhook_HTTPClient(t *testing.T) {
+	// The connection settings apply to the transport, one endpoint sharing all
+	client := newTestClient(t, Config{URL: "http://localhost", MaxIdleConns: 32, IdleConnTimeout: time.Minute, Timeout: 30 * time.Second})
+	transport := client.httpClient.Transport.(*http.Transport)
+	assert.Equal(t, 32, transport.MaxIdleConns)
+	assert.Equal(t, 32, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.Equal(t, 30*time.Second, client.httpClient.Timeout)
+
+	client = newTestClient(t, Config{URL: "http://localhost"})
+	assert.Equal(t, 10*time.Second, client.httpClient.Timeout)
+
+	// A custom client sends the requests
+	var requests int
+	custom := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})}
+	client = newTestClient(t, Config{URL: "http://localhost", HTTPClient: custom})
+	assert.Same(t, custom, client.httpClient)
+	assert.NoError(t, client.SendBody(context.Background(), []byte("hello"), "text/plain"))
+	assert.Equal(t, 1, requests)
+}
+
+// roundTripFunc is an http.RoundTripper of a function.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestWebhook_Compression(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 2048)
+	var encodings []string
+	var bodies [][]byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		// The signature covers the bytes sent, compressed or not
+		assert.NoError(t, Verify([]byte("my-secret"), r.Header.Get("X-Scanner-Signature"), r.Header.Get("X-Scanner-Timestamp"), raw, time.Minute, time.Now()))
+		body := raw
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(bytes.NewReader(raw))
+			assert.NoError(t, err)
+			body, _ = io.ReadAll(zr)
+			assert.Less(t, len(raw), len(body))
+		}
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, Config{URL: ts.URL, Secret: "my-secret", EnableCompression: true})
+	assert.NoError(t, client.SendBody(context.Background(), large, "text/plain"))
+	// Bodies within the threshold are sent as they are
+	assert.NoError(t, client.SendBody(context.Background(), []byte("small"), "text/plain"))
+	assert.Equal(t, []string{"gzip", ""}, encodings)
+	assert.Equal(t, [][]byte{large, []byte("small")}, bodies)
+}
+
+func TestWebhook_CompressionUnsupported(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 2048)
+	var encodings []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		if r.Header.Get("Content-Encoding") != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, large, body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// Sent again uncompressed within the same attempt, then never compressed
+	client := newTestClient(t, Config{URL: ts.URL, MaxAttempts: 1, EnableCompression: true, CompressionThreshold: 100})
+	assert.NoError(t, client.SendBody(context.Background(), large, "text/plain"))
+	assert.NoError(t, client.SendBody(context.Background(), large, "text/plain"))
+	assert.Equal(t, []string{"gzip", "", ""}, encodings)
+}
+
+func TestWebhook_SendBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "hello", string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, Config{URL: ts.URL})
+	assert.NoError(t, client.SendBody(context.Background(), []byte("hello"), "text/plain; charset=utf-8"))
+}
+
+func TestWebhook_Headers(t *testing.T) {
+	var keys []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer s3cret", r.Header.Get("Authorization"))
+		assert.Equal(t, "gw-key", r.Header.Get("X-Api-Key"))
+		assert.NotEmpty(t, r.Header.Get("X-Scanner-Signature"))
+
+		keys = append(keys, r.Header.Get("X-Scanner-Idempotency-Key"))
+		if len(keys) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, Config{
+		URL:            ts.URL,
+		Secret:         "my-secret",
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Headers:        map[string]string{"X-Api-Key": "gw-key"},
+		BearerToken:    "s3cret",
+	})
+	assert.NoError(t, client.Send(context.Background(), []types.Log{{Index: 1}}))
+
+	// Retries of the same batch reuse the key
+	assert.Len(t, keys, 3)
+	assert.Equal(t, IdempotencyKey("", []types.Log{{Index: 1}}), keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, keys[0], keys[2])
+
+	// A pre-rendered body is keyed by its hash
+	assert.NoError(t, client.SendBody(context.Background(), []byte("other"), "text/plain"))
+	sum := sha256.Sum256([]byte("other"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), keys[3])
+}
+
+func TestWebhook_IdempotencyKeyOfLogs(t *testing.T) {
+	var keys []string
+	var timestamps []int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p struct {
+			Timestamp int64 `json:"timestamp"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		timestamps = append(timestamps, p.Timestamp)
+		keys = append(keys, r.Header.Get("X-Scanner-Idempotency-Key"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, Config{URL: ts.URL, MaxAttempts: 1})
+	logs := []types.Log{{TxHash: common.HexToHash("0x1"), Index: 3}, {TxHash: common.HexToHash("0x2"), Index: 4}}
+
+	// The same logs sent again later, e.g. after a restart, keep their key
+	// although the payload timestamp changed
+	assert.NoError(t, client.Send(context.Background(), logs))
+	time.Sleep(time.Second)
+	assert.NoError(t, client.Send(context.Background(), logs))
+	assert.NotEqual(t, timestamps[0], timestamps[1])
+	assert.Equal(t, keys[0], keys[1])
+
+	// Other logs, other chains and removals get their own key
+	assert.NoError(t, client.Send(context.Background(), logs[:1]))
+	assert.NoError(t, client.SendChain(context.Background(), Chain{ID: "bsc"}, logs))
+	logs[1].Removed = true
+	assert.NoError(t, client.Send(context.Background(), logs))
+	unique := make(map[string]bool)
+	for _, key := range keys {
+		unique[key] = true
+	}
+	assert.Len(t, keys, 5)
+	assert.Len(t, unique, 4)
+}
+
+func TestWebhook_NoRetryOn4xx(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, Config{URL: ts.URL, MaxAttempts: 5, InitialBackoff: time.Millisecond})
+	err := client.Send(context.Background(), []types.Log{{Index: 1}})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	assert.Contains(t, err.Error(), "status 400")
+}
+
+func TestWebhook_RetryAfter(t *testing.T) {
+	var times []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, Config{
+		URL:            ts.URL,
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	})
+	assert.NoError(t, client.Send(context.Background(), []types.Log{{Index: 1}}))
+	assert.Len(t, times, 2)
+	assert.GreaterOrEqual(t, times[1].Sub(times[0]), time.Second)
+
+	t.Run("CappedByMaxBackoff", func(t *testing.T) {
+		times = nil
+		client := newTestClient(t, Config{
+			URL:            ts.URL,
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     20 * time.Millisecond,
+		})
+		assert.NoError(t, client.Send(context.Background(), []types.Log{{Index: 1}}))
+		assert.Len(t, times, 2)
+		assert.Less(t, times[1].Sub(times[0]), 500*time.Millisecond)
+	})
+}
+
+func TestWebhook_ExponentialBackoff(t *testing.T) {
+	var times []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		times = append(times, time.Now())
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	client := newTestClient(t, Config{
+		URL:            ts.URL,
+		MaxAttempts:    4,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	})
+	err := client.Send(context.Background(), []types.Log{{Index: 1}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "after 4 attempts: status 500")
+	assert.Len(t, times, 4)
+
+	// Waits are jittered within [backoff/2, backoff): 10-20ms, 20-40ms, 40-80ms
+	for i, minWait := range []time.Duration{10, 20, 40} {
+		assert.GreaterOrEqual(t, times[i+1].Sub(times[i]), minWait*time.Millisecond)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+
+	d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.Greater(t, d, 50*time.Second)
+	assert.LessOrEqual(t, d, time.Minute)
+}
+
+func TestWebhook_Chunking(t *testing.T) {
+	logs := make([]types.Log, 250)
+	for i := range logs {
+		logs[i] = types.Log{Index: uint(i), Topics: []common.Hash{}, Data: []byte{}}
+	}
+
+	var chunks [][]types.Log
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, Verify([]byte("my-secret"), r.Header.Get("X-Scanner-Signature"), r.Header.Get("X-Scanner-Timestamp"), body, time.Minute, time.Now()))
+
+		var p Payload
+		assert.NoError(t, json.Unmarshal(body, &p))
+		chunks = append(chunks, p.Logs)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	t.Run("MaxEventsPerRequest", func(t *testing.T) {
+		chunks = nil
+		client := newTestClient(t, Config{URL: ts.URL, Secret: "my-secret", MaxEventsPerRequest: 100})
+		assert.NoError(t, client.Send(context.Background(), logs))
+
+		assert.Len(t, chunks, 3)
+		assert.Len(t, chunks[0], 100)
+		assert.Len(t, chunks[1], 100)
+		assert.Len(t, chunks[2], 50)
+		next := uint(0)
+		for _, chunk := range chunks {
+			for _, l := range chunk {
+				assert.Equal(t, next, l.Index)
+				next++
+			}
+		}
+	})
+
+	t.Run("MaxPayloadBytes", func(t *testing.T) {
+		chunks = nil
+		client := newTestClient(t, Config{URL: ts.URL, Secret: "my-secret", MaxPayloadBytes: 16 * 1024})
+		assert.NoError(t, client.Send(context.Background(), logs))
+
+		assert.Greater(t, len(chunks), 1)
+		total := 0
+		for _, chunk := range chunks {
+			total += len(chunk)
+		}
+		assert.Equal(t, 250, total)
+		assert.Equal(t, uint(249), chunks[len(chunks)-1][len(chunks[len(chunks)-1])-1].Index)
+	})
+
+	t.Run("SingleEventTooLarge", func(t *testing.T) {
+		client := newTestClient(t, Config{URL: ts.URL, MaxPayloadBytes: 10})
+		err := client.Send(context.Background(), logs[:1])
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "above the 10 byte limit")
+	})
+}
+
+func TestWebhook_ChunkFailure(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 2 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	logs := make([]types.Log, 5)
+	client := newTestClient(t, Config{URL: ts.URL, MaxAttempts: 3, MaxEventsPerRequest: 2})
+	err := client.Send(context.Background(), logs)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "chunk 2/3")
+	assert.Equal(t, 2, requests, "later chunks are not sent after a failure")
+}
+
+func TestWebhook_MutualTLS(t *testing.T) {
+	srv, files := tlstest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	client := newTestClient(t, Config{
+		URL: srv.URL,
+		TLS: tlsconfig.Config{CAFile: files.CAFile, CertFile: files.CertFile, KeyFile: files.KeyFile},
+	})
+	assert.NoError(t, client.Send(context.Background(), []types.Log{{Index: 1}}))
+
+	client = newTestClient(t, Config{URL: srv.URL, TLS: tlsconfig.Config{CAFile: files.CAFile}})
+	assert.Error(t, client.Send(context.Background(), []types.Log{{Index: 1}}))
+
+	_, err := NewClient(Config{URL: srv.URL, TLS: tlsconfig.Config{CertFile: files.CertFile}})
+	assert.ErrorContains(t, err, "must be set together")
+}
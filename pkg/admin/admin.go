@@ -0,0 +1,408 @@
+// Package admin serves an administration API for running scanners over HTTP:
+// their status, pausing and resuming them, and inspecting and moving their
+// cursors and filters. Mount the handler of NewHandler on a listener reachable
+// by operators only, with a Token.
+//
+// Endpoints, all answering JSON, with ?chain=<chain_id> selecting a scanner
+// when there are several:
+//
+//	GET  /status   scanner stats, node health and output stats
+//	POST /pause    pause the scanner, or all of them without ?chain
+//	POST /resume   resume the scanner, or all of them without ?chain
+//	GET  /cursor   next block of the scanner and its saved cursor
+//	POST /cursor   move the scanner to {"block": N, "force": true}
+//	GET  /filters  contracts and topics scanned
+//	GET  /log      level of the logs, with Config.LogLevel
+//	POST /log      set the level to {"level": "debug"}
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Chain is a scanner administered by the handler.
+type Chain struct {
+	Scanner *scanner.Scanner
+	Client  *rpc.MultiClient    // Optional, for the health of its nodes
+	Store   storage.Persistence // Optional, for the saved cursor
+}
+
+// Config configures the handler of NewHandler.
+type Config struct {
+	// Token is required from every request, as "Authorization: Bearer <token>".
+	// Empty disables authentication.
+	Token  string
+	Chains []Chain
+	// Outputs returns the stats of the outputs the scanners deliver to, optional.
+	Outputs func() []sink.SinkStats
+	// LogLevel is the level of the logs, served and set by /log, optional.
+	LogLevel *slog.LevelVar
+}
+
+// Status is the answer of GET /status.
+type Status struct {
+	Chains  []ChainStatus  `json:"chains"`
+	Outputs []OutputStatus `json:"outputs,omitempty"`
+}
+
+// ChainStatus is the progress of a scanner, see scanner.Stats.
+type ChainStatus struct {
+	ChainID       string       `json:"chain_id"`
+	Running       bool         `json:"running"`
+	Paused        bool         `json:"paused"`
+	NextBlock     uint64       `json:"next_block"`
+	SafeHead      uint64       `json:"safe_head"`
+	LogsScanned   uint64       `json:"logs_scanned"`
+	LastScan      time.Time    `json:"last_scan"`
+	HandlerPanics uint64       `json:"handler_panics,omitempty"`
+	LastError     string       `json:"last_error,omitempty"`
+	Nodes         []NodeStatus `json:"nodes,omitempty"`
+
+	Start *StartStatus `json:"start,omitempty"` // Unset until the scanner started
+	// CursorSaveFailures counts the consecutive failed cursor saves.
+	CursorSaveFailures uint64 `json:"cursor_save_failures,omitempty"`
+	// SampledOut counts the logs dropped by the sampling of filters.
+	SampledOut uint64 `json:"sampled_out,omitempty"`
+}
+
+// StartStatus is how a scanner chose its first block, see
+// scanner.StartDecision.
+type StartStatus struct {
+	Strategy     string `json:"strategy"`
+	Block        uint64 `json:"block"`
+	Reason       string `json:"reason"`
+	Explicit     bool   `json:"explicit"`
+	SavedCursor  uint64 `json:"saved_cursor"`
+	StartBlock   uint64 `json:"start_block"`
+	ForceStart   bool   `json:"force_start"`
+	Rewind       uint64 `json:"rewind"`
+	CursorRewind uint64 `json:"cursor_rewind"`
+	Head         uint64 `json:"head"`
+	Clamped      bool   `json:"clamped"`
+}
+
+// NodeStatus is the health of an RPC node, see rpc.NodeStats. Its URL is
+// reduced to the scheme and host, leaving out API keys in paths or queries.
+type NodeStatus struct {
+	URL         string `json:"url"`
+	Priority    int    `json:"priority"`
+	LatestBlock uint64 `json:"latest_block"`
+	LatencyMs   int64  `json:"latency_ms"`
+	Errors      uint64 `json:"errors"`
+	TotalErrors uint64 `json:"total_errors"`
+	CircuitOpen bool   `json:"circuit_open"`
+}
+
+// OutputStatus is the metrics of an output, see sink.SinkStats.
+type OutputStatus struct {
+	Name                string    `json:"name"`
+	Sends               uint64    `json:"sends"`
+	Failures            uint64    `json:"failures"`
+	ConsecutiveFailures uint64    `json:"consecutive_failures"`
+	Events              uint64    `json:"events"`
+	Bytes               uint64    `json:"bytes"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastErrorAt         time.Time `json:"last_error_at"`
+	Pressure            float64   `json:"pressure"`
+
+	HighWater map[string]uint64 `json:"high_water,omitempty"` // Highest block delivered, by chain id
+}
+
+// Cursor is the answer of GET /cursor: the next block of the scanner, and
+// the cursor saved in its store, which may lag behind it.
+type Cursor struct {
+	ChainID   string  `json:"chain_id"`
+	NextBlock uint64  `json:"next_block"`
+	Saved     *uint64 `json:"saved,omitempty"` // Without a Store
+}
+
+// CursorRequest is the body of POST /cursor. Force confirms the move: blocks
+// are scanned again, or skipped.
+type CursorRequest struct {
+	Block uint64 `json:"block"`
+	Force bool   `json:"force"`
+}
+
+// LogLevel is the answer of GET /log and the body of POST /log: debug, info,
+// warn or error.
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+// Filters is the filter of a scanner, answered by GET /filters: the
+// contracts and topics of the union of its filters, and the digest and
+// summary of each of them.
+type Filters struct {
+	ChainID   string           `json:"chain_id"`
+	Contracts []common.Address `json:"contracts"`
+	Topics    [][]common.Hash  `json:"topics"`
+	Hash      common.Hash      `json:"hash"`    // See scanner.FilterSet.Hash
+	Summary   string           `json:"summary"` // See scanner.FilterSet.String
+}
+
+// handler serves the endpoints of Config.
+type handler struct {
+	cfg Config
+	mux *http.ServeMux
+}
+
+// NewHandler returns the handler of the administration API of cfg.Chains.
+func NewHandler(cfg Config) http.Handler {
+	h := &handler{cfg: cfg, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /status", h.status)
+	h.mux.HandleFunc("POST /pause", h.pause(true))
+	h.mux.HandleFunc("POST /resume", h.pause(false))
+	h.mux.HandleFunc("GET /cursor", h.cursor)
+	h.mux.HandleFunc("POST /cursor", h.seek)
+	h.mux.HandleFunc("GET /filters", h.filters)
+	if cfg.LogLevel != nil {
+		h.mux.HandleFunc("GET /log", h.logLevel)
+		h.mux.HandleFunc("POST /log", h.setLogLevel)
+	}
+	return h
+}
+
+// ServeHTTP authenticates the request and serves it.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.Token != "" {
+		want := "Bearer " + h.cfg.Token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing bearer token"))
+			return
+		}
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) {
+	chains, err := h.chains(r, true)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	status := Status{Chains: make([]ChainStatus, len(chains))}
+	for i, ch := range chains {
+		st := ch.Scanner.Stats()
+		status.Chains[i] = ChainStatus{
+			ChainID:       st.ChainID,
+			Running:       st.Running,
+			Paused:        st.Paused,
+			NextBlock:     st.NextBlock,
+			SafeHead:      st.SafeHead,
+			LogsScanned:   st.LogsScanned,
+			LastScan:      st.LastScan,
+			HandlerPanics: st.HandlerPanics,
+			LastError:     st.LastError,
+
+			CursorSaveFailures: st.CursorSaveFailures,
+			SampledOut:         st.SampledOut,
+		}
+		if d := st.Start; d.Strategy != "" {
+			status.Chains[i].Start = &StartStatus{
+				Strategy:     string(d.Strategy),
+				Block:        d.Block,
+				Reason:       d.Reason,
+				Explicit:     d.Explicit,
+				SavedCursor:  d.SavedCursor,
+				StartBlock:   d.StartBlock,
+				ForceStart:   d.ForceStart,
+				Rewind:       d.Rewind,
+				CursorRewind: d.CursorRewind,
+				Head:         d.Head,
+				Clamped:      d.Clamped,
+			}
+		}
+		if ch.Client != nil {
+			for _, n := range ch.Client.NodeStats() {
+				status.Chains[i].Nodes = append(status.Chains[i].Nodes, NodeStatus{
+					URL:         redactURL(n.URL),
+					Priority:    n.Priority,
+					LatestBlock: n.LatestBlock,
+					LatencyMs:   n.Latency,
+					Errors:      n.Errors,
+					TotalErrors: n.TotalErrors,
+					CircuitOpen: n.CircuitOpen,
+				})
+			}
+		}
+	}
+	if h.cfg.Outputs != nil {
+		for _, st := range h.cfg.Outputs() {
+			status.Outputs = append(status.Outputs, OutputStatus{
+				Name:                st.Name,
+				Sends:               st.Sends,
+				Failures:            st.Failures,
+				ConsecutiveFailures: st.ConsecutiveFailures,
+				Events:              st.Events,
+				Bytes:               st.Bytes,
+				LastError:           st.LastError,
+				LastErrorAt:         st.LastErrorAt,
+				Pressure:            st.Pressure,
+				HighWater:           st.HighWater,
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// pause returns the handler pausing, or else resuming, the selected scanners.
+func (h *handler) pause(pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chains, err := h.chains(r, true)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		for _, ch := range chains {
+			if pause {
+				ch.Scanner.Pause()
+				log.Info("Scanner paused by admin request", "chain_id", ch.Scanner.Stats().ChainID)
+			} else {
+				ch.Scanner.Resume()
+				log.Info("Scanner resumed by admin request", "chain_id", ch.Scanner.Stats().ChainID)
+			}
+		}
+		h.status(w, r)
+	}
+}
+
+func (h *handler) cursor(w http.ResponseWriter, r *http.Request) {
+	chains, err := h.chains(r, false)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	ch := chains[0]
+	st := ch.Scanner.Stats()
+	cursor := Cursor{ChainID: st.ChainID, NextBlock: st.NextBlock}
+	if ch.Store != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		saved, err := ch.Store.LoadCursor(ctx, st.ChainID)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("load cursor: %w", err))
+			return
+		}
+		cursor.Saved = &saved
+	}
+	writeJSON(w, http.StatusOK, cursor)
+}
+
+func (h *handler) seek(w http.ResponseWriter, r *http.Request) {
+	chains, err := h.chains(r, false)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	var req CursorRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return
+	}
+	if !req.Force {
+		writeError(w, http.StatusConflict, errors.New("moving the cursor scans blocks again or skips them, set force to confirm"))
+		return
+	}
+	ch := chains[0]
+	ch.Scanner.Seek(req.Block)
+	st := ch.Scanner.Stats()
+	log.Warn("Scanner moved by admin request", "chain_id", st.ChainID, "from", st.NextBlock, "to", req.Block)
+	// Applied by the scanner before its next batch
+	writeJSON(w, http.StatusAccepted, Cursor{ChainID: st.ChainID, NextBlock: req.Block})
+}
+
+func (h *handler) filters(w http.ResponseWriter, r *http.Request) {
+	chains, err := h.chains(r, true)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	filters := make([]Filters, len(chains))
+	for i, ch := range chains {
+		filters[i] = Filters{ChainID: ch.Scanner.Stats().ChainID, Contracts: []common.Address{}, Topics: [][]common.Hash{}}
+		if f := ch.Scanner.Filter(); f != nil {
+			filters[i].Contracts = append(filters[i].Contracts, f.Contracts...)
+			filters[i].Topics = append(filters[i].Topics, f.Topics...)
+			set := ch.Scanner.FilterSet()
+			filters[i].Hash, filters[i].Summary = set.Hash(), set.String()
+		}
+	}
+	writeJSON(w, http.StatusOK, filters)
+}
+
+func (h *handler) logLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, LogLevel{Level: log.LevelString(h.cfg.LogLevel.Level())})
+}
+
+func (h *handler) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevel
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return
+	}
+	var level slog.Level
+	switch strings.ToLower(req.Level) {
+	case "debug", "info", "warn", "error":
+		_ = level.UnmarshalText([]byte(req.Level))
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported log level %q, use debug, info, warn or error", req.Level))
+		return
+	}
+	h.cfg.LogLevel.Set(level)
+	log.Info("Log level set by admin request", "level", log.LevelString(level))
+	h.logLevel(w, r)
+}
+
+// chains returns the scanner of ?chain, or without it all the scanners if
+// all is set, else the only one.
+func (h *handler) chains(r *http.Request, all bool) ([]Chain, error) {
+	id := r.URL.Query().Get("chain")
+	if id == "" {
+		if all || len(h.cfg.Chains) == 1 {
+			return h.cfg.Chains, nil
+		}
+		return nil, errors.New("several chains are scanned, select one with ?chain=<chain_id>")
+	}
+	for _, ch := range h.cfg.Chains {
+		if ch.Scanner.Stats().ChainID == id {
+			return []Chain{ch}, nil
+		}
+	}
+	return nil, fmt.Errorf("chain %q is not scanned", id)
+}
+
+// redactURL returns the scheme and host of rawURL.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "REDACTED"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
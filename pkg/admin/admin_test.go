@@ -0,0 +1,197 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNode is an RPC node at block 1000 without logs.
+type testNode struct{}
+
+func (testNode) BlockNumber() hexutil.Uint64 { return 1000 }
+
+func (testNode) GetLogs(map[string]any) []types.Log { return []types.Log{} }
+
+// startScanner runs a scanner of chainID from block 100 against a testNode,
+// returning it with its client.
+func startScanner(t *testing.T, chainID string, store storage.Persistence) (*scanner.Scanner, *rpc.MultiClient) {
+	server := gethrpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", testNode{}))
+	srv := httptest.NewServer(server)
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := rpc.NewClient(ctx, []rpc.NodeConfig{{URL: srv.URL + "/v2/secret-key", Priority: 5}})
+	assert.NoError(t, err)
+
+	filter := scanner.NewFilter().AddContract(common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"))
+	s := scanner.New(client, store, scanner.Config{ChainID: chainID, StartBlock: 100, Interval: 5 * time.Millisecond, CursorFlushInterval: -1}, filter)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		client.Close()
+		srv.Close()
+		server.Stop()
+	})
+	return s, client
+}
+
+// call sends a request to h, decoding the JSON answer into v.
+func call(t *testing.T, h http.Handler, method, target, body string, v any) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if v != nil {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+	}
+	return rec.Code
+}
+
+func TestHandler(t *testing.T) {
+	store := storage.NewMemoryStore("")
+	eth, client := startScanner(t, "eth", store)
+	bsc, _ := startScanner(t, "bsc", store)
+	h := NewHandler(Config{
+		Token:   "admin-token",
+		Chains:  []Chain{{Scanner: eth, Client: client, Store: store}, {Scanner: bsc}},
+		Outputs: func() []sink.SinkStats { return []sink.SinkStats{{Name: "kafka", Sends: 3, Events: 42}} },
+	})
+	assert.Eventually(t, func() bool { return eth.Stats().NextBlock == 1001 && bsc.Stats().NextBlock == 1001 }, 5*time.Second, 5*time.Millisecond)
+
+	var status Status
+	assert.Equal(t, http.StatusOK, call(t, h, "GET", "/status", "", &status))
+	if assert.Len(t, status.Chains, 2) {
+		assert.Equal(t, "eth", status.Chains[0].ChainID)
+		assert.True(t, status.Chains[0].Running)
+		assert.Equal(t, uint64(1000), status.Chains[0].SafeHead)
+		if assert.Len(t, status.Chains[0].Nodes, 1) {
+			assert.NotContains(t, status.Chains[0].Nodes[0].URL, "secret-key")
+			assert.Equal(t, 5, status.Chains[0].Nodes[0].Priority)
+		}
+		assert.Empty(t, status.Chains[1].Nodes)
+		assert.Equal(t, &StartStatus{Strategy: "resume", Block: 100, Reason: "no saved cursor, start_block", StartBlock: 100}, status.Chains[0].Start)
+	}
+	assert.Equal(t, []OutputStatus{{Name: "kafka", Sends: 3, Events: 42}}, status.Outputs)
+
+	// Pause and resume
+	assert.Equal(t, http.StatusOK, call(t, h, "POST", "/pause?chain=eth", "", &status))
+	assert.Len(t, status.Chains, 1)
+	assert.True(t, eth.Stats().Paused)
+	assert.False(t, bsc.Stats().Paused)
+	assert.Equal(t, http.StatusOK, call(t, h, "POST", "/pause", "", nil))
+	assert.True(t, bsc.Stats().Paused)
+	assert.Equal(t, http.StatusOK, call(t, h, "POST", "/resume", "", nil))
+	assert.False(t, eth.Stats().Paused)
+	assert.False(t, bsc.Stats().Paused)
+
+	// Cursors
+	var cursor Cursor
+	assert.Equal(t, http.StatusOK, call(t, h, "GET", "/cursor?chain=eth", "", &cursor))
+	assert.Equal(t, uint64(1001), cursor.NextBlock)
+	if assert.NotNil(t, cursor.Saved) {
+		assert.Equal(t, uint64(1001), *cursor.Saved)
+	}
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusNotFound, call(t, h, "GET", "/cursor", "", &apiErr))
+	assert.Contains(t, apiErr["error"], "select one with ?chain=<chain_id>")
+	assert.Equal(t, http.StatusNotFound, call(t, h, "GET", "/cursor?chain=base", "", &apiErr))
+	assert.Equal(t, `chain "base" is not scanned`, apiErr["error"])
+
+	assert.Equal(t, http.StatusConflict, call(t, h, "POST", "/cursor?chain=eth", `{"block": 500}`, &apiErr))
+	assert.Contains(t, apiErr["error"], "set force to confirm")
+	assert.Equal(t, http.StatusBadRequest, call(t, h, "POST", "/cursor?chain=eth", `{"block": "x"}`, nil))
+	eth.Pause()
+	assert.Equal(t, http.StatusAccepted, call(t, h, "POST", "/cursor?chain=eth", `{"block": 500, "force": true}`, &cursor))
+	assert.Equal(t, uint64(500), cursor.NextBlock)
+	assert.Eventually(t, func() bool {
+		call(t, h, "GET", "/cursor?chain=eth", "", &cursor)
+		return cursor.NextBlock == 500 && *cursor.Saved == 500
+	}, 5*time.Second, 5*time.Millisecond)
+	// Rescanned up to the head again
+	eth.Resume()
+	assert.Eventually(t, func() bool { return eth.Stats().NextBlock == 1001 }, 5*time.Second, 5*time.Millisecond)
+
+	// Filters
+	var filters []Filters
+	assert.Equal(t, http.StatusOK, call(t, h, "GET", "/filters?chain=bsc", "", &filters))
+	assert.Equal(t, []Filters{{
+		ChainID:   "bsc",
+		Contracts: []common.Address{common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")},
+		Topics:    [][]common.Hash{},
+		Hash:      bsc.Filter().Hash(),
+		Summary:   "contracts=[0xdAC1…1ec7] topics=*",
+	}}, filters)
+}
+
+func TestHandler_Token(t *testing.T) {
+	s, _ := startScanner(t, "eth", storage.NewMemoryStore(""))
+	h := NewHandler(Config{Token: "admin-token", Chains: []Chain{{Scanner: s}}})
+
+	for _, auth := range []string{"", "Bearer wrong", "admin-token"} {
+		req := httptest.NewRequest("POST", "/pause", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, auth)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	}
+	assert.False(t, s.Stats().Paused)
+
+	// A single chain needs no ?chain, and the routes take one method
+	var cursor Cursor
+	assert.Equal(t, http.StatusOK, call(t, h, "GET", "/cursor", "", &cursor))
+	assert.Equal(t, "eth", cursor.ChainID)
+	assert.Nil(t, cursor.Saved)
+	assert.Equal(t, http.StatusMethodNotAllowed, call(t, h, "GET", "/pause", "", nil))
+
+	// Without a token, requests are not authenticated
+	req := httptest.NewRequest("GET", "/status", nil)
+	rec := httptest.NewRecorder()
+	NewHandler(Config{Chains: []Chain{{Scanner: s}}}).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body, _ := io.ReadAll(rec.Body)
+	assert.Contains(t, string(body), `"chain_id":"eth"`)
+}
+
+func TestHandler_LogLevel(t *testing.T) {
+	level := new(slog.LevelVar)
+	h := NewHandler(Config{Token: "admin-token", LogLevel: level})
+
+	var got LogLevel
+	assert.Equal(t, http.StatusOK, call(t, h, "GET", "/log", "", &got))
+	assert.Equal(t, "info", got.Level)
+	assert.Equal(t, http.StatusOK, call(t, h, "POST", "/log", `{"level": "debug"}`, &got))
+	assert.Equal(t, "debug", got.Level)
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusBadRequest, call(t, h, "POST", "/log", `{"level": "verbose"}`, &apiErr))
+	assert.Equal(t, `unsupported log level "verbose", use debug, info, warn or error`, apiErr["error"])
+	assert.Equal(t, slog.LevelDebug, level.Level())
+
+	// Without a LogLevel, the level cannot be set
+	assert.Equal(t, http.StatusNotFound, call(t, NewHandler(Config{}), "POST", "/log", `{"level": "debug"}`, nil))
+}
@@ -0,0 +1,454 @@
+// Package app runs the scanners of a configuration the way scanner-cli does:
+// chain presets, filters and decoders, the shared and per-chain outputs, the
+// cursor store, the health and admin servers, configuration reloads and dry
+// runs. Programs embed it to reuse that wiring with their own outputs,
+// decoders, cursor store or handler middleware:
+//
+//	cfg, err := config.Load("config.yaml")
+//	if err != nil {
+//		return err
+//	}
+//	a, err := app.New(cfg, app.WithOutputs(mySink))
+//	if err != nil {
+//		return err
+//	}
+//	return a.Run(ctx)
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/84hero/evm-scanner/pkg/chain"
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ErrClosed is returned by Reload once the App is closed.
+var ErrClosed = errors.New("app: closed")
+
+// Option customizes an App.
+type Option func(*options)
+
+type options struct {
+	outputs    []sink.Output
+	decoders   []func(chainID string, reg *decoder.Registry) error
+	store      storage.Persistence
+	middleware []scanner.Middleware
+	logLevel   *slog.LevelVar
+	healthAddr string
+	report     io.Writer
+}
+
+// WithOutputs adds outputs to the shared outputs of the configuration, kept
+// across reloads. They are closed with the App. Dry runs do not send to them.
+// outputs.number_format does not apply to them, see sink.WithNumberFormat.
+func WithOutputs(outputs ...sink.Output) Option {
+	return func(o *options) { o.outputs = append(o.outputs, outputs...) }
+}
+
+// WithDecoders calls add with the decoder registry of every chain, once its
+// filters are registered, e.g. to register more ABIs. Reloads call it again
+// for the new registries.
+func WithDecoders(add func(chainID string, reg *decoder.Registry) error) Option {
+	return func(o *options) { o.decoders = append(o.decoders, add) }
+}
+
+// WithStore saves the cursors in store instead of the store of the storage
+// section. The App does not close it.
+func WithStore(store storage.Persistence) Option {
+	return func(o *options) { o.store = store }
+}
+
+// WithMiddleware wraps the handler of every scanner, which decodes the logs of
+// a batch and sends them to the outputs, with mw. The first middleware added
+// is the outermost one. An error returned by a middleware fails the batch,
+// which is retried without advancing the cursor.
+func WithMiddleware(mw ...scanner.Middleware) Option {
+	return func(o *options) { o.middleware = append(o.middleware, mw...) }
+}
+
+// WithLogLevel lets the admin API read and set level, see admin.Config.
+func WithLogLevel(level *slog.LevelVar) Option {
+	return func(o *options) { o.logLevel = level }
+}
+
+// WithHealthAddr serves the health check on addr, e.g. ":8080": GET /healthz
+// answers 200 while the cursor store is reachable and no scanner has failed.
+func WithHealthAddr(addr string) Option {
+	return func(o *options) { o.healthAddr = addr }
+}
+
+// WithReportWriter makes dry runs print their preview and report to w
+// instead of os.Stdout.
+func WithReportWriter(w io.Writer) Option {
+	return func(o *options) { o.report = w }
+}
+
+// App is the scanners of a configuration with their outputs and cursor store,
+// set up by New and run by Run.
+type App struct {
+	ctx    context.Context // Of the RPC clients, canceled by Close
+	cancel context.CancelFunc
+	opts   options
+
+	store      storage.Persistence
+	closeStore bool // Opened by New rather than given with WithStore
+	outputs    *outputSwitch
+	extra      []sink.Output // The outputs of WithOutputs, instrumented
+	preview    *sink.DryRunOutput
+	atomicOut  *atomicOutput
+	chains     []*chainScan // In the order of cfg.ChainScans
+
+	mu       sync.Mutex // Serializes Reload and Close
+	closed   bool
+	cfg      *config.Config
+	postgres config.PostgresOutputConfig // Before prepareOutputs
+	atomic   bool
+	built    map[string]builtOutput
+}
+
+// New sets up the scanners of cfg: it registers the presets of the chains
+// section, connects to the RPC nodes of every chain and opens the outputs and
+// the cursor store. With dry_run enabled, the outputs of cfg are dropped and
+// the cursors are not saved. cfg must not be modified afterwards.
+func New(cfg *config.Config, opts ...Option) (_ *App, err error) {
+	a := &App{opts: options{report: os.Stdout}}
+	for _, opt := range opts {
+		opt(&a.opts)
+	}
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	defer func() {
+		if err != nil {
+			a.Close()
+		}
+	}()
+
+	if err := registerChains(cfg.Chains); err != nil {
+		return nil, err
+	}
+	if cfg.DryRun.Enabled {
+		dropOutputs(cfg)
+	}
+
+	// Outputs, shared by the chains
+	a.postgres, a.atomic = prepareOutputs(cfg)
+	for _, out := range a.opts.outputs {
+		a.extra = append(a.extra, sink.Instrument(out))
+	}
+	multi, built, err := buildOutputs(sharedOutputs(cfg), nil, a.sharedExtra(cfg)...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DryRun.Enabled {
+		a.preview = sink.NewDryRunOutput(a.opts.report, cfg.DryRun.Samples)
+		multi = sink.NewMultiSink([]sink.Output{sink.Instrument(a.preview)})
+	}
+	a.outputs, a.built = &outputSwitch{out: multi}, built
+
+	// Storage, with the cursors of the chains saved by chain id
+	if a.store = a.opts.store; a.store == nil {
+		if a.store, err = OpenStore(cfg); err != nil {
+			return nil, err
+		}
+		a.closeStore = true
+	}
+	if cfg.DryRun.Enabled {
+		log.Warn("Dry run: events are counted instead of delivered, and cursors are not saved")
+		a.store = storage.Shadow(a.store)
+	}
+	if a.atomic {
+		pg, filter, err := atomicPostgres(a.postgres, cfg.AllFilters(), a.store, cfg.Storage.Postgres.URL)
+		if err != nil {
+			return nil, err
+		}
+		numbers, err := sink.ParseNumberFormat(cfg.Outputs.NumberFormat)
+		if err != nil {
+			return nil, err
+		}
+		a.atomicOut = &atomicOutput{pg: pg, filter: filter, numbers: numbers}
+	}
+
+	// Scanners
+	a.cfg = cfg
+	for i, scan := range cfg.ChainScans() {
+		ch, err := a.newChainScan(scan)
+		if err != nil {
+			if len(cfg.Scanners) > 0 {
+				err = fmt.Errorf("scanners[%d] (%s): %w", i, scan.ChainID, err)
+			}
+			return nil, err
+		}
+		a.chains = append(a.chains, ch)
+	}
+	for outputs, chainIDs := range a.positionOutputs() {
+		if err := outputs.loadPositions(a.ctx, a.store, chainIDs...); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// sharedExtra returns the outputs of WithOutputs the shared outputs of cfg
+// send to, none in dry runs.
+func (a *App) sharedExtra(cfg *config.Config) []sink.Output {
+	if cfg.DryRun.Enabled {
+		return nil
+	}
+	return a.extra
+}
+
+// Run scans until ctx is done or every scanner stopped, failed or reached its
+// end block, then closes the App and, for dry runs, writes the report. A
+// failed scanner leaves the others scanning: Run returns an error if any
+// failed, but nil once ctx is done. Run must be called once.
+func (a *App) Run(ctx context.Context) error {
+	defer a.Close()
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	a.mu.Lock()
+	adminCfg := a.cfg.Admin
+	a.mu.Unlock()
+	if a.opts.healthAddr != "" {
+		go serveHTTP(runCtx, "health", a.opts.healthAddr, healthHandler(a.store, chainStats(a.chains)))
+	}
+	if adminCfg.Listen != "" {
+		if adminCfg.Token == "" {
+			log.Warn("The admin API is served without authentication, set admin.token", "addr", adminCfg.Listen)
+		}
+		go serveHTTP(runCtx, "admin", adminCfg.Listen, adminHandler(adminCfg.Token, a.chains, a.store, a.outputs, a.opts.logLevel))
+	}
+
+	// Waited for before Close, which closes the store and the outputs their
+	// final cursor flushes and position saves go to
+	var wg sync.WaitGroup
+	wg.Add(1 + len(a.chains))
+	go func() {
+		defer wg.Done()
+		a.persistPositions(runCtx)
+	}()
+
+	var failed, stopped atomic.Int32
+	for _, ch := range a.chains {
+		go func() {
+			defer wg.Done()
+			err := ch.scanner.Start(runCtx)
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			if err != nil {
+				log.Error("Scanner failed", "chain_id", ch.chainID, "err", err)
+				failed.Add(1)
+			}
+			if int(stopped.Add(1)) == len(a.chains) {
+				cancel()
+			}
+		}()
+	}
+
+	<-runCtx.Done()
+	var runErr error
+	switch n := int(failed.Load()); {
+	case ctx.Err() != nil:
+		log.Info("Shutting down...")
+	case n == len(a.chains):
+		runErr = errors.New("every scanner failed")
+	case n > 0:
+		runErr = fmt.Errorf("%d of %d scanners failed", n, len(a.chains))
+	}
+
+	cancel()
+	wg.Wait()
+	logOutputStats(a.outputs)
+	for _, ch := range a.chains {
+		ch.logStats()
+	}
+	if a.preview != nil {
+		if err := a.preview.WriteReport(a.opts.report); err != nil {
+			log.Warn("Failed to write the dry run report", "err", err)
+		}
+	}
+	return runErr
+}
+
+// Reload applies cfg to the running scanners: their filters and decoders, and
+// the shared outputs, keeping those whose section is unchanged. Nothing is
+// applied unless the whole configuration is valid, and changes of the chains
+// scanned or of their cursors are errors. The other changes need a restart:
+// Reload returns the sections they are in, sorted. cfg must not be modified
+// afterwards.
+func (a *App) Reload(cfg *config.Config) (restart []string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil, ErrClosed
+	}
+
+	if a.cfg.DryRun.Enabled {
+		cfg.DryRun.Enabled = true
+		dropOutputs(cfg)
+	}
+	pgCfg, atomic := prepareOutputs(cfg)
+	scans, running := cfg.ChainScans(), a.cfg.ChainScans()
+	switch {
+	case !sameChains(scans, running):
+		return nil, errors.New("the chains scanned (scanner.chain_id or scanners) cannot change at runtime")
+	case cfg.Project != a.cfg.Project || cfg.Scanner.StoragePrefix != a.cfg.Scanner.StoragePrefix:
+		return nil, errors.New("project and scanner.storage_prefix select the cursors and cannot change at runtime")
+	case atomic != a.atomic || atomic && !reflect.DeepEqual(pgCfg, a.postgres):
+		return nil, errors.New("outputs.postgres with atomic_cursor shares the cursor store and cannot change at runtime")
+	}
+
+	filters := make([]*scanner.FilterSet, len(scans))
+	registries := make([]*decoder.Registry, len(scans))
+	for i, scan := range scans {
+		if filters[i], registries[i], err = a.initFilters(scan); err != nil {
+			if len(cfg.Scanners) > 0 {
+				err = fmt.Errorf("scanners[%d] (%s): %w", i, scan.ChainID, err)
+			}
+			return nil, err
+		}
+	}
+	var (
+		outputs *sink.MultiSink
+		built   map[string]builtOutput
+	)
+	if shared := sharedOutputs(cfg); !reflect.DeepEqual(shared, sharedOutputs(a.cfg)) {
+		if outputs, built, err = buildOutputs(shared, a.built, a.sharedExtra(cfg)...); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, ch := range a.chains {
+		if !filters[i].Equal(ch.scanner.FilterSet()) {
+			log.Info("Filter updated", "chain_id", ch.chainID, "filter", filters[i])
+			ch.scanner.SetFilterSet(filters[i])
+		}
+		ch.decoder.SetRegistry(registries[i])
+		if !ch.ownOutputs {
+			ch.scanner.SetBlockTimestamps(scans[i].BlockTimestamps || needsBlockTime(cfg.Outputs))
+		}
+	}
+	if outputs != nil {
+		// Carry the marks over to the outputs built anew
+		if err := outputs.LoadPositions(a.ctx, a.store, a.positionOutputs()[a.outputs]...); err != nil {
+			log.Warn("Failed to load output positions", "err", err)
+		}
+		a.outputs.swap(outputs)
+		for name, prev := range a.built {
+			if built[name].out != prev.out {
+				if err := prev.out.Close(); err != nil {
+					log.Warn("Failed to close output", "output", name, "err", err)
+				}
+			}
+		}
+		a.built = built
+	}
+
+	sections := map[string]bool{
+		"rpc_nodes": !reflect.DeepEqual(cfg.RPC, a.cfg.RPC),
+		"scanner":   !reflect.DeepEqual(cfg.Scanner, a.cfg.Scanner),
+		"storage":   !reflect.DeepEqual(cfg.Storage, a.cfg.Storage),
+		"admin":     cfg.Admin != a.cfg.Admin,
+		"dry_run":   cfg.DryRun != a.cfg.DryRun,
+		"tokens":    !reflect.DeepEqual(cfg.Tokens, a.cfg.Tokens),
+		"decoding":  !reflect.DeepEqual(cfg.Decoding, a.cfg.Decoding),
+		"chains":    !reflect.DeepEqual(cfg.Chains, a.cfg.Chains),
+		// The atomic postgres output maps its event tables from the filter ABIs
+		"outputs.postgres.event_tables": atomic && len(pgCfg.EventTables) > 0 && !reflect.DeepEqual(cfg.AllFilters(), a.cfg.AllFilters()),
+		"outputs.number_format":         atomic && cfg.Outputs.NumberFormat != a.cfg.Outputs.NumberFormat,
+	}
+	for i, scan := range cfg.Scanners {
+		prev := a.cfg.Scanners[i]
+		sections[fmt.Sprintf("scanners[%d]", i)] = scan.ScannerConfig != prev.ScannerConfig ||
+			!reflect.DeepEqual(scan.RPC, prev.RPC) || !reflect.DeepEqual(scan.Outputs, prev.Outputs)
+	}
+	for name, changed := range sections {
+		if changed {
+			restart = append(restart, name)
+		}
+	}
+	sort.Strings(restart)
+	a.cfg = cfg
+	return restart, nil
+}
+
+// Close stops the RPC clients and closes the outputs and the cursor store. Run
+// closes the App when it returns, Close releases an App that is not run.
+func (a *App) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	if a.store != nil {
+		a.savePositions(context.Background())
+	}
+	a.cancel()
+
+	var errs []error
+	for _, ch := range a.chains {
+		ch.Close()
+	}
+	if a.atomicOut != nil {
+		errs = append(errs, a.atomicOut.pg.Close())
+	}
+	if a.store != nil && a.closeStore {
+		errs = append(errs, a.store.Close()) // Flushes cursors buffered by the file store
+	}
+	if a.outputs != nil {
+		errs = append(errs, a.outputs.Close())
+	}
+	if a.outputs == nil || a.preview != nil {
+		// Not in the shared outputs
+		for _, out := range a.extra {
+			errs = append(errs, out.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks what New checks of cfg before connecting to anything: the
+// presets of the chains section, which it registers, and the filters and
+// postgres event tables.
+func Validate(cfg *config.Config) error {
+	if err := registerChains(cfg.Chains); err != nil {
+		return err
+	}
+	for i, scan := range cfg.ChainScans() {
+		if _, _, err := initFilters(scan.Filters); err != nil {
+			if len(cfg.Scanners) > 0 {
+				err = fmt.Errorf("scanners[%d] (%s): %w", i, scan.ChainID, err)
+			}
+			return err
+		}
+	}
+	if pg := cfg.Outputs.Postgres; pg.Enabled {
+		if _, err := eventTables(pg.EventTables, cfg.AllFilters()); err != nil {
+			return fmt.Errorf("output postgres: %w", err)
+		}
+	}
+	return nil
+}
+
+// registerChains registers the chain presets of entries.
+func registerChains(entries []chain.Entry) error {
+	if err := chain.RegisterEntries(entries); err != nil {
+		return fmt.Errorf("chains: %w", err)
+	}
+	return nil
+}
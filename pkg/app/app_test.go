@@ -0,0 +1,314 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/chain"
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNode is an RPC node at block head, with one log per queried contract
+// in every batch.
+type testNode struct {
+	head uint64
+}
+
+// newTestNode serves a testNode at head, returning its URL.
+func newTestNode(t *testing.T, head uint64) string {
+	server := gethrpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", &testNode{head: head}))
+	srv := httptest.NewServer(server)
+	t.Cleanup(func() {
+		srv.Close()
+		server.Stop()
+	})
+	return srv.URL
+}
+
+func (n *testNode) BlockNumber() hexutil.Uint64 { return hexutil.Uint64(n.head) }
+
+func (n *testNode) ChainId() *hexutil.Big { return (*hexutil.Big)(big.NewInt(7777)) }
+
+func (n *testNode) GetLogs(q struct {
+	FromBlock *hexutil.Big     `json:"fromBlock"`
+	Address   []common.Address `json:"address"`
+}) []types.Log {
+	logs := make([]types.Log, 0, len(q.Address))
+	for _, a := range q.Address {
+		logs = append(logs, types.Log{Address: a, Topics: []common.Hash{}, BlockNumber: q.FromBlock.ToInt().Uint64()})
+	}
+	return logs
+}
+
+// recordSink records the logs sent to it.
+type recordSink struct {
+	mu     sync.Mutex
+	logs   []sink.DecodedLog
+	closed bool
+}
+
+func (s *recordSink) Name() string { return "record" }
+
+func (s *recordSink) Send(ctx context.Context, logs []sink.DecodedLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, logs...)
+	return nil
+}
+
+func (s *recordSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// testConfig returns the configuration scanning the blocks 100 to 150 of the
+// node at url for one contract.
+func testConfig(url string) *config.Config {
+	return &config.Config{
+		Project: "app",
+		RPC:     []rpc.NodeConfig{{URL: url}},
+		Scanner: config.ScannerConfig{ChainID: "app-chain", StartBlock: 100, EndBlock: 150, BatchSize: 10, Interval: 20 * time.Millisecond},
+		AppConfig: config.AppConfig{
+			Filters: []config.FilterConfig{{Contracts: []string{"0x000000000000000000000000000000000000000a"}}},
+		},
+	}
+}
+
+func TestApp_Run(t *testing.T) {
+	store := storage.NewMemoryStore("app_")
+	out := &recordSink{}
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(name string) func(scanner.Handler) scanner.Handler {
+		return func(next scanner.Handler) scanner.Handler {
+			return func(ctx context.Context, logs []types.Log) error {
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+				return next(ctx, logs)
+			}
+		}
+	}
+	var registries []string
+	a, err := New(testConfig(newTestNode(t, 1000)),
+		WithOutputs(out),
+		WithStore(store),
+		WithMiddleware(record("outer"), record("inner")),
+		WithDecoders(func(chainID string, reg *decoder.Registry) error {
+			registries = append(registries, chainID)
+			return nil
+		}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app-chain"}, registries)
+
+	// Ends at the end block on its own
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, a.Run(ctx))
+
+	// The 6 batches of 100-150, through the middleware in order
+	assert.Len(t, out.logs, 6)
+	assert.Nil(t, out.logs[0].Provenance, "opt-in")
+	assert.True(t, out.closed)
+	assert.Len(t, calls, 12)
+	assert.Equal(t, []string{"outer", "inner"}, calls[:2])
+	saved, err := store.LoadCursor(context.Background(), "app-chain")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(151), saved)
+	// The high-water mark of the output, saved on close
+	saved, err = store.LoadCursor(context.Background(), sink.PositionKey("app-chain", "record"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(150), saved)
+}
+
+// slowStore delays the saves of the scanner cursors once slow is set.
+type slowStore struct {
+	*storage.MemoryStore
+	slow atomic.Bool
+}
+
+func (s *slowStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	if s.slow.Load() && !strings.HasPrefix(key, "sinkpos:") {
+		time.Sleep(time.Second)
+	}
+	return s.MemoryStore.SaveCursor(ctx, key, height)
+}
+
+func (s *slowStore) SaveCheckpoint(ctx context.Context, key string, cp storage.Checkpoint) error {
+	if s.slow.Load() && !strings.HasPrefix(key, "sinkpos:") {
+		time.Sleep(time.Second)
+	}
+	return s.MemoryStore.SaveCheckpoint(ctx, key, cp)
+}
+
+func TestApp_Run_FlushesOnShutdown(t *testing.T) {
+	store := &slowStore{MemoryStore: storage.NewMemoryStore("app_")}
+	cfg := testConfig(newTestNode(t, 1000))
+	cfg.Scanner.EndBlock = 0
+	cfg.Scanner.CursorFlushInterval = time.Hour
+	out := &recordSink{}
+	a, err := New(cfg, WithOutputs(out), WithStore(store))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+	assert.Eventually(t, func() bool {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		return len(out.logs) >= 3
+	}, 5*time.Second, time.Millisecond)
+	store.slow.Store(true)
+	cancel()
+	assert.NoError(t, <-done)
+
+	// The coalesced cursor is flushed before Run returns, however slow: past
+	// the last batch of 10 blocks delivered
+	last := out.logs[len(out.logs)-1].Log.BlockNumber
+	saved, err := store.LoadCursor(context.Background(), "app-chain")
+	assert.NoError(t, err)
+	assert.Equal(t, last+10, saved)
+}
+
+func TestApp_Provenance(t *testing.T) {
+	url := newTestNode(t, 1000)
+	cfg := testConfig(url)
+	cfg.Scanner.EndBlock = 109
+	cfg.Decoding.Provenance = true
+	out := &recordSink{}
+	var seen []scanner.Provenance
+	a, err := New(cfg, WithOutputs(out), WithStore(storage.NewMemoryStore("app_")),
+		WithMiddleware(func(next scanner.Handler) scanner.Handler {
+			return func(ctx context.Context, logs []types.Log) error {
+				p, ok := scanner.BatchProvenance(ctx)
+				assert.True(t, ok)
+				seen = append(seen, p)
+				return next(ctx, logs)
+			}
+		}))
+	assert.NoError(t, err)
+
+	before := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, a.Run(ctx))
+
+	// The envelope of the batch names the node that served it
+	if assert.Len(t, seen, 1) {
+		assert.Equal(t, uint64(100), seen[0].FromBlock)
+		assert.Equal(t, uint64(109), seen[0].ToBlock)
+		assert.Equal(t, []string{url}, seen[0].Nodes)
+		assert.Equal(t, 1, seen[0].Attempts)
+		assert.False(t, seen[0].FetchedAt.Before(before))
+	}
+	// And is carried by the decoded logs when enabled
+	if assert.Len(t, out.logs, 1) {
+		assert.Equal(t, &seen[0], out.logs[0].Provenance)
+	}
+}
+
+func TestApp_MiddlewareError(t *testing.T) {
+	store := storage.NewMemoryStore("app_")
+	out := &recordSink{}
+	a, err := New(testConfig(newTestNode(t, 1000)), WithOutputs(out), WithStore(store),
+		WithMiddleware(func(next scanner.Handler) scanner.Handler {
+			return func(ctx context.Context, logs []types.Log) error {
+				return errors.New("rejected")
+			}
+		}))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, a.Run(ctx))
+
+	// The failed batch is neither delivered nor passed
+	assert.Empty(t, out.logs)
+	saved, err := store.LoadCursor(context.Background(), "app-chain")
+	assert.NoError(t, err)
+	assert.Zero(t, saved)
+}
+
+func TestApp_Reload(t *testing.T) {
+	cfg := testConfig(newTestNode(t, 1000))
+	a, err := New(cfg, WithStore(storage.NewMemoryStore("app_")))
+	assert.NoError(t, err)
+
+	// An equal filter is not swapped in
+	filter := a.chains[0].scanner.FilterSet()
+	next := testConfig(cfg.RPC[0].URL)
+	next.Filters[0].Contracts = append(next.Filters[0].Contracts, next.Filters[0].Contracts...)
+	restart, err := a.Reload(next)
+	assert.NoError(t, err)
+	assert.Empty(t, restart)
+	assert.Same(t, filter, a.chains[0].scanner.FilterSet())
+
+	next = testConfig(cfg.RPC[0].URL)
+	next.Filters[0].Contracts = append(next.Filters[0].Contracts, "0x000000000000000000000000000000000000000b")
+	next.Scanner.BatchSize = 20
+	next.Tokens.Lookup = true
+	restart, err = a.Reload(next)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"scanner", "tokens"}, restart)
+	assert.NotSame(t, filter, a.chains[0].scanner.FilterSet())
+
+	next = testConfig(cfg.RPC[0].URL)
+	next.Scanner.ChainID = "other-chain"
+	_, err = a.Reload(next)
+	assert.ErrorContains(t, err, "cannot change at runtime")
+
+	next = testConfig(cfg.RPC[0].URL)
+	next.Filters[0].Contracts = []string{"not-an-address"}
+	_, err = a.Reload(next)
+	assert.ErrorContains(t, err, "invalid contract address")
+
+	assert.NoError(t, a.Close())
+	_, err = a.Reload(testConfig(cfg.RPC[0].URL))
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := &config.Config{AppConfig: config.AppConfig{Chains: []chain.Entry{{Name: "app-validate-chain", Aliases: []string{"app-validate"}, ChainID: "7102", BlockTime: time.Second, BatchSize: 50}}}}
+	assert.NoError(t, Validate(cfg))
+	p, ok := chain.Get("app-validate")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(50), p.BatchSize)
+
+	cfg = &config.Config{AppConfig: config.AppConfig{Chains: []chain.Entry{{Name: "eth-mainnet", ChainID: "1", BlockTime: time.Second}}}}
+	assert.ErrorContains(t, Validate(cfg), "chains: chain 0 (eth-mainnet): already registered")
+
+	cfg = &config.Config{Scanners: []config.ChainScanConfig{
+		{ScannerConfig: config.ScannerConfig{ChainID: "eth"}},
+		{ScannerConfig: config.ScannerConfig{ChainID: "bsc"}, Filters: []config.FilterConfig{{Description: "Bad", Contracts: []string{"0x55d3"}}}},
+	}}
+	assert.EqualError(t, Validate(cfg), `scanners[1] (bsc): filter "Bad": invalid contract address "0x55d3"`)
+
+	cfg = &config.Config{AppConfig: config.AppConfig{Outputs: config.OutputsConfig{Postgres: config.PostgresOutputConfig{
+		Enabled:     true,
+		EventTables: []config.EventTableConfig{{Event: "Transfer", Table: "transfers"}},
+	}}}}
+	assert.EqualError(t, Validate(cfg), `output postgres: event table transfers: event "Transfer" not found in any filter abi`)
+}
@@ -0,0 +1,358 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/84hero/evm-scanner/pkg/chain"
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// chainScan is the scanner of one of the chains of the configuration, with
+// its RPC client and decoder.
+type chainScan struct {
+	chainID string
+	client  *rpc.MultiClient
+	scanner *scanner.Scanner
+	decoder *sink.Decoder
+	outputs *outputSwitch
+	// ownOutputs is set when outputs are those of the chain, closed with it,
+	// instead of the shared ones
+	ownOutputs bool
+}
+
+// newChainScan sets up the scanner of scan, delivering to the shared outputs
+// unless the chain has its own. The atomic postgres output, if any, is
+// written in the transactions of the cursors.
+func (a *App) newChainScan(scan config.ChainScanConfig) (_ *chainScan, err error) {
+	ctx, cfg, atomic := a.ctx, a.cfg, a.atomicOut
+	ch := &chainScan{chainID: scan.ChainID, outputs: a.outputs}
+	defer func() {
+		if err != nil {
+			ch.Close()
+		}
+	}()
+
+	client, err := newRPCClient(ctx, scan)
+	if err != nil {
+		return nil, err
+	}
+	ch.client = client
+
+	filters, decoders, err := a.initFilters(scan)
+	if err != nil {
+		return nil, err
+	}
+	if scan.Outputs != nil {
+		appCfg := &config.AppConfig{Filters: scan.Filters, Outputs: *scan.Outputs}
+		if appCfg.Outputs.Postgres.Enabled && appCfg.Outputs.Postgres.AtomicCursor {
+			return nil, errors.New("outputs.postgres.atomic_cursor is only supported by the shared outputs")
+		}
+		if appCfg.Outputs.Kafka.ChainID == "" {
+			appCfg.Outputs.Kafka.ChainID = scan.ChainID
+		}
+		own, err := initOutputs(appCfg)
+		if err != nil {
+			return nil, err
+		}
+		ch.outputs, ch.ownOutputs = &outputSwitch{out: own}, true
+	}
+
+	// Scanner, with the unset settings taken from the chain preset
+	scanCfg := scanner.Config{
+		ChainID:             scan.ChainID,
+		StartBlock:          scan.StartBlock,
+		ForceStart:          scan.ForceStart,
+		Rewind:              scan.Rewind,
+		CursorRewind:        scan.CursorRewind,
+		EndBlock:            scan.EndBlock,
+		BatchSize:           scan.BatchSize,
+		Interval:            scan.Interval,
+		ReorgSafe:           scan.Confirmations,
+		UseBloom:            scan.UseBloom,
+		TrackBlockHash:      scan.TrackBlockHash,
+		CursorFlushInterval: scan.CursorFlushInterval,
+		StoreOutageLimit:    scan.StoreOutageLimit,
+		MaxLogsRange:        scan.MaxLogsRange,
+		FinalityMode:        scanner.FinalityMode(scan.Finality),
+		DisableLogSort:      scan.DisableLogSort,
+
+		StartStrategy: scanner.StartStrategy(scan.StartStrategy),
+
+		CursorSaveRetries:   scan.CursorSaveRetries,
+		CursorSaveBackoff:   scan.CursorSaveBackoff,
+		MaxUnsavedBlocks:    scan.MaxUnsavedBlocks,
+		CursorFailurePolicy: scanner.CursorFailurePolicy(scan.CursorFailurePolicy),
+		PressureThreshold:   scan.PressureThreshold,
+		PressureDelay:       scan.PressureDelay,
+		BlockTimestamps:     scan.BlockTimestamps,
+	}
+	if scan.Outputs != nil {
+		scanCfg.BlockTimestamps = scanCfg.BlockTimestamps || needsBlockTime(*scan.Outputs)
+	} else {
+		scanCfg.BlockTimestamps = scanCfg.BlockTimestamps || needsBlockTime(cfg.Outputs)
+	}
+	if preset, ok := chain.Get(scan.ChainID); ok {
+		chain.ApplyDefaults(&scanCfg, preset)
+		client.SetReceiptStrategy(chain.ReceiptStrategy(preset))
+		if scan.UseBloom && !scanCfg.UseBloom {
+			log.Info("Bloom filter checks disabled, block blooms are not useful on this chain", "chain", scan.ChainID)
+		}
+	}
+
+	numericID := numericChainID(ctx, scan.ChainID, client)
+	norm, err := newNormalizer(cfg.Tokens, client, numericID)
+	if err != nil {
+		return nil, err
+	}
+	ch.decoder, err = sink.NewDecoderWithConfig(sink.DecoderConfig{
+		Registry:       decoders,
+		Normalizer:     norm,
+		OnDecodeError:  sink.DecodeErrorPolicy(cfg.Decoding.OnError),
+		Provenance:     cfg.Decoding.Provenance,
+		ChainID:        scan.ChainID,
+		NumericChainID: numericID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ch.scanner = scanner.New(client, a.store, scanCfg, scanner.NewFilter())
+	ch.scanner.SetFilterSet(filters)
+	ch.scanner.SetPressure(ch.outputs.Pressure)
+	if atomic != nil {
+		ch.scanner.SetTxHandler(func(ctx context.Context, tx *sql.Tx, logs []types.Log) error {
+			return a.wrap(func(ctx context.Context, logs []types.Log) error {
+				decoded, err := decodeLogs(ctx, ch.decoder, logs)
+				if err != nil {
+					return err
+				}
+				kept := decoded
+				if atomic.filter != nil {
+					kept = nil
+					for _, l := range decoded {
+						if atomic.filter(l) {
+							kept = append(kept, l)
+						}
+					}
+				}
+				if err := atomic.pg.SendTx(ctx, tx, sink.FormatNumbers(kept, atomic.numbers)); err != nil {
+					return fmt.Errorf("output postgres: %w", err)
+				}
+				// Other outputs are delivered before the commit, at least once
+				return ch.outputs.Send(ctx, decoded)
+			})(ctx, logs)
+		})
+	} else {
+		ch.scanner.SetHandler(a.wrap(func(ctx context.Context, logs []types.Log) error {
+			decoded, err := decodeLogs(ctx, ch.decoder, logs)
+			if err != nil {
+				return err
+			}
+			return ch.outputs.Send(ctx, decoded)
+		}))
+	}
+	return ch, nil
+}
+
+// wrap returns h behind the middleware of WithMiddleware, the first one
+// registered outermost.
+func (a *App) wrap(h scanner.Handler) scanner.Handler {
+	for i := len(a.opts.middleware) - 1; i >= 0; i-- {
+		h = a.opts.middleware[i](h)
+	}
+	return h
+}
+
+// initFilters is initFilters for the filters of scan, with the decoders of
+// WithDecoders added to the registry.
+func (a *App) initFilters(scan config.ChainScanConfig) (*scanner.FilterSet, *decoder.Registry, error) {
+	filters, decoders, err := initFilters(scan.Filters)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, add := range a.opts.decoders {
+		if err := add(scan.ChainID, decoders); err != nil {
+			return nil, nil, fmt.Errorf("decoders: %w", err)
+		}
+	}
+	return filters, decoders, nil
+}
+
+// logStats logs the progress of the chain, and the stats of its own outputs.
+func (ch *chainScan) logStats() {
+	st := ch.scanner.Stats()
+	log.Info("Scanner stats", "chain_id", ch.chainID, "next_block", st.NextBlock, "safe_head", st.SafeHead,
+		"logs", st.LogsScanned, "handler_panics", st.HandlerPanics, "last_error", st.LastError)
+	ds := ch.decoder.Stats()
+	log.Info("Decode stats", "chain_id", ch.chainID, "decoded", ds.Decoded, "unknown_events", ds.UnknownEvents, "failed", ds.Failures)
+	if ch.ownOutputs {
+		logOutputStats(ch.outputs, "chain_id", ch.chainID)
+	}
+}
+
+// Close closes the outputs of the chain, if it has its own, and its client.
+func (ch *chainScan) Close() {
+	if ch.ownOutputs {
+		ch.outputs.Close()
+	}
+	if ch.client != nil {
+		ch.client.Close()
+	}
+}
+
+// initFilters builds the scanner filters, one per config in the order of
+// configs, and the decoder registry of configs. Without configs, the set
+// holds one filter of any logs.
+func initFilters(configs []config.FilterConfig) (*scanner.FilterSet, *decoder.Registry, error) {
+	set := scanner.NewFilterSet()
+	decoders := decoder.NewRegistry()
+	for _, f := range configs {
+		filter := scanner.NewFilter()
+		set.Filters = append(set.Filters, filter)
+		var contracts []common.Address
+		for _, c := range f.Contracts {
+			if !common.IsHexAddress(c) {
+				return nil, nil, fmt.Errorf("filter %q: invalid contract address %q", f.Description, c)
+			}
+			contracts = append(contracts, common.HexToAddress(c))
+		}
+		filter.AddContract(contracts...)
+		for c, start := range f.ContractStarts {
+			addr := common.HexToAddress(c)
+			if !common.IsHexAddress(c) || !slices.Contains(contracts, addr) {
+				return nil, nil, fmt.Errorf("filter %q: contract start of %q, not one of its contracts", f.Description, c)
+			}
+			filter.AddContractFrom(start, addr)
+		}
+		filter.SampleRate = f.SampleRate
+		for i, topicGroup := range f.Topics {
+			var hashes []common.Hash
+			for _, t := range topicGroup {
+				hashes = append(hashes, common.HexToHash(t))
+			}
+			filter.SetTopic(i, hashes...)
+		}
+		for _, c := range f.ExcludeContracts {
+			if !common.IsHexAddress(c) {
+				return nil, nil, fmt.Errorf("filter %q: invalid excluded contract address %q", f.Description, c)
+			}
+			filter.ExcludeContract(common.HexToAddress(c))
+		}
+		for i, topicGroup := range f.ExcludeTopics {
+			for _, t := range topicGroup {
+				filter.ExcludeTopic(i, common.HexToHash(t))
+			}
+		}
+		// The ABI decodes the logs of the filter contracts, or of any contract without one
+		var err error
+		switch {
+		case f.ABI != "" && len(f.Signatures) > 0:
+			return nil, nil, fmt.Errorf("filter %q: abi and signatures are mutually exclusive", f.Description)
+		case f.ABI != "":
+			err = decoders.AddABI(f.ABI, decoder.WithAddresses(contracts...))
+		case len(f.Signatures) > 0:
+			err = decoders.AddSignatures(f.Signatures, decoder.WithAddresses(contracts...))
+		}
+		if err != nil {
+			log.Error("Failed to parse filter ABI", "filter", f.Description, "err", err)
+			return nil, nil, fmt.Errorf("filter %q: invalid abi: %w", f.Description, err)
+		}
+	}
+	if len(set.Filters) == 0 {
+		set.Filters = append(set.Filters, scanner.NewFilter())
+	}
+	return set, decoders, nil
+}
+
+// newNormalizer builds the token normalizer of cfg, nil when it has no tokens.
+func newNormalizer(cfg config.TokensConfig, client rpc.Client, numericID uint64) (*decoder.Normalizer, error) {
+	if cfg.List == "" && !cfg.Lookup {
+		return nil, nil
+	}
+	var caller decoder.TokenCaller
+	if cfg.Lookup {
+		caller = client
+	}
+	norm := decoder.NewNormalizer(caller)
+	if cfg.List != "" {
+		f, err := os.Open(cfg.List)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := norm.LoadTokenList(f, numericID); err != nil {
+			return nil, fmt.Errorf("token list %s: %w", cfg.List, err)
+		}
+	}
+	return norm, nil
+}
+
+// decodeLogs decodes the logs a handler gets with ctx with dec, see
+// sink.Decoder.DecodeContext, logging the logs it could not decode.
+func decodeLogs(ctx context.Context, dec *sink.Decoder, logs []types.Log) ([]sink.DecodedLog, error) {
+	before := dec.Stats()
+	decoded, err := dec.DecodeContext(ctx, logs)
+	after := dec.Stats()
+	if unknown, failed := after.UnknownEvents-before.UnknownEvents, after.Failures-before.Failures; unknown+failed > 0 {
+		log.Warn("Failed to decode logs", "unknown_events", unknown, "failed", failed, "total", len(logs))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode logs: %w", err)
+	}
+	return decoded, nil
+}
+
+// newRPCClient connects to the rpc_nodes of scan, or else to the public
+// endpoints of its chain preset.
+func newRPCClient(ctx context.Context, scan config.ChainScanConfig) (*rpc.MultiClient, error) {
+	if len(scan.RPC) > 0 {
+		return rpc.NewClient(ctx, scan.RPC)
+	}
+	log.Warn("NO RPC_NODES CONFIGURED, falling back to the public endpoints of the chain preset. "+
+		"They are shared and rate limited: configure your own nodes in production", "chain", scan.ChainID)
+	return rpc.NewClientForChain(ctx, scan.ChainID)
+}
+
+// numericChainID resolves the EIP-155 chain id of scanner.chain_id from its
+// preset, the value itself when numeric, or else the RPC nodes. It returns 0
+// when none of them knows it.
+func numericChainID(ctx context.Context, chainID string, client rpc.Client) uint64 {
+	if preset, ok := chain.Get(chainID); ok {
+		chainID = preset.ChainID
+	}
+	if id, err := strconv.ParseUint(chainID, 10, 64); err == nil {
+		return id
+	}
+	id, err := client.ChainID(ctx)
+	if err != nil || !id.IsUint64() {
+		log.Warn("Failed to resolve numeric chain id", "chain_id", chainID, "err", err)
+		return 0
+	}
+	return id.Uint64()
+}
+
+// sameChains reports whether scans and running list the same chains.
+func sameChains(scans, running []config.ChainScanConfig) bool {
+	if len(scans) != len(running) {
+		return false
+	}
+	for i := range scans {
+		if scans[i].ChainID != running[i].ChainID {
+			return false
+		}
+	}
+	return true
+}
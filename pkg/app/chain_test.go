@@ -0,0 +1,225 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitFilters(t *testing.T) {
+	configs := []config.FilterConfig{
+		{
+			Description: "Test",
+			Contracts:   []string{"0xdAC17F958D2ee523a2206206994597C13D831ec7"},
+			Topics:      [][]string{{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}},
+		},
+	}
+
+	filter, _, err := initFilters(configs)
+	assert.NoError(t, err)
+	assert.NotNil(t, filter)
+	assert.True(t, common.IsHexAddress(configs[0].Contracts[0]))
+}
+
+func TestInitFilters_Empty(t *testing.T) {
+	filter, decoders, err := initFilters([]config.FilterConfig{})
+	assert.NoError(t, err)
+	assert.NotNil(t, filter)
+	assert.Empty(t, decoders.ListEvents())
+}
+
+func TestInitFilters_WithABI(t *testing.T) {
+	configs := []config.FilterConfig{
+		{
+			Description: "USDT",
+			Contracts:   []string{"0xdAC17F958D2ee523a2206206994597C13D831ec7"},
+			Topics:      [][]string{{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}},
+			ABI:         `[{"anonymous":false,"inputs":[],"name":"Transfer","type":"event"}]`,
+		},
+	}
+
+	filter, decoders, err := initFilters(configs)
+	assert.NoError(t, err)
+	assert.NotNil(t, filter)
+	events := decoders.ListEvents()
+	assert.Len(t, events, 1)
+	assert.Equal(t, []common.Address{common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")}, events[0].Addresses)
+}
+
+func TestInitFilters_InvalidABI(t *testing.T) {
+	configs := []config.FilterConfig{
+		{
+			Description: "Broken ABI",
+			Topics:      [][]string{{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}},
+			ABI:         `[{"inputs":`,
+		},
+	}
+
+	_, _, err := initFilters(configs)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Broken ABI")
+}
+
+func TestInitFilters_Signatures(t *testing.T) {
+	usdt := "0xdAC17F958D2ee523a2206206994597C13D831ec7"
+	_, decoders, err := initFilters([]config.FilterConfig{{
+		Description: "USDT",
+		Contracts:   []string{usdt},
+		Signatures:  []string{"event Transfer(address indexed from, address indexed to, uint256 value)"},
+	}})
+	assert.NoError(t, err)
+	events := decoders.ListEvents()
+	assert.Len(t, events, 1)
+	assert.Equal(t, common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"), events[0].Topic0)
+
+	_, _, err = initFilters([]config.FilterConfig{{Description: "Broken", Signatures: []string{"event Transfer(address"}}})
+	assert.ErrorContains(t, err, `filter "Broken": invalid abi: signature "event Transfer(address"`)
+
+	_, _, err = initFilters([]config.FilterConfig{{Description: "Both", ABI: "[]", Signatures: []string{"event Ok()"}}})
+	assert.ErrorContains(t, err, "mutually exclusive")
+}
+
+func TestInitFilters_InvalidContract(t *testing.T) {
+	_, _, err := initFilters([]config.FilterConfig{{Description: "Bad", Contracts: []string{"not-an-address"}}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not-an-address")
+
+	_, _, err = initFilters([]config.FilterConfig{{Description: "Bad", ExcludeContracts: []string{"0xbad"}}})
+	assert.EqualError(t, err, `filter "Bad": invalid excluded contract address "0xbad"`)
+}
+
+func TestInitFilters_Exclusions(t *testing.T) {
+	filters, _, err := initFilters([]config.FilterConfig{{
+		Topics:           [][]string{{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}},
+		ExcludeContracts: []string{"0x0000000000000000000000000000000000000bad"},
+		ExcludeTopics:    [][]string{{}, {"0xdead"}},
+	}})
+	assert.NoError(t, err)
+	filter := filters.Filters[0]
+	assert.Equal(t, []common.Address{common.HexToAddress("0x0bad")}, filter.ExcludedContracts)
+	assert.Equal(t, [][]common.Hash{nil, {common.HexToHash("0xdead")}}, filter.ExcludedTopics)
+}
+
+func TestInitFilters_ContractStarts(t *testing.T) {
+	usdt := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	filters, _, err := initFilters([]config.FilterConfig{{
+		Contracts: []string{usdt.Hex(), usdc.Hex()},
+		// Viper lowercases map keys
+		ContractStarts: map[string]uint64{strings.ToLower(usdc.Hex()): 19000000},
+	}})
+	assert.NoError(t, err)
+	filter := filters.Filters[0]
+	assert.Equal(t, []common.Address{usdt, usdc}, filter.Contracts)
+	assert.Equal(t, map[common.Address]uint64{usdc: 19000000}, filter.ContractStarts)
+
+	_, _, err = initFilters([]config.FilterConfig{{
+		Description:    "Bad",
+		Contracts:      []string{usdt.Hex()},
+		ContractStarts: map[string]uint64{usdc.Hex(): 19000000},
+	}})
+	assert.ErrorContains(t, err, "not one of its contracts")
+}
+
+func TestInitFilters_Independent(t *testing.T) {
+	usdt := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	approval := common.HexToHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+	filters, _, err := initFilters([]config.FilterConfig{
+		{Description: "USDT", Contracts: []string{usdt.Hex()}},
+		{Description: "Approvals", Topics: [][]string{{approval.Hex()}}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, filters.Filters, 2)
+
+	// Regression: the filters were merged into one, the contracts of the
+	// first constraining the topics of the second, matching none of these
+	other := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	assert.Equal(t, []int{0}, filters.Matches(types.Log{Address: usdt, Topics: []common.Hash{transfer}}))
+	assert.Equal(t, []int{1}, filters.Matches(types.Log{Address: other, Topics: []common.Hash{approval}}))
+	assert.Equal(t, []int{0, 1}, filters.Matches(types.Log{Address: usdt, Topics: []common.Hash{approval}}))
+	assert.Empty(t, filters.Matches(types.Log{Address: other, Topics: []common.Hash{transfer}}))
+}
+
+func TestTokenNormalization(t *testing.T) {
+	norm, err := newNormalizer(config.TokensConfig{}, nil, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, norm)
+
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"tokens":[{"chainId":1,"address":"0xdAC17F958D2ee523a2206206994597C13D831ec7","symbol":"USDT","decimals":6}]}`), 0o644))
+	norm, err = newNormalizer(config.TokensConfig{List: path}, nil, 1)
+	assert.NoError(t, err)
+
+	_, decoders, err := initFilters([]config.FilterConfig{{
+		Description: "USDT",
+		Signatures:  []string{"event Transfer(address indexed from, address indexed to, uint256 value)"},
+	}})
+	assert.NoError(t, err)
+	usdt := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	l := types.Log{
+		Address: usdt,
+		Topics:  []common.Hash{decoders.Topics()[0], common.BytesToHash(usdt.Bytes()), {}},
+		Data:    common.LeftPadBytes(big.NewInt(2500000).Bytes(), 32),
+	}
+	dec, err := sink.NewDecoderWithConfig(sink.DecoderConfig{Registry: decoders, Normalizer: norm, ChainID: "eth", NumericChainID: 1})
+	assert.NoError(t, err)
+	logs, err := decodeLogs(context.Background(), dec, []types.Log{l})
+	assert.NoError(t, err)
+	assert.Equal(t, "2.5", logs[0].DecodedData.Inputs["value_decimal"])
+	assert.Equal(t, "USDT", logs[0].DecodedData.Inputs["value_symbol"])
+
+	_, err = newNormalizer(config.TokensConfig{List: filepath.Join(t.TempDir(), "missing.json")}, nil, 1)
+	assert.Error(t, err)
+}
+
+// chainIDClient answers ChainID; other methods are not used.
+type chainIDClient struct {
+	rpc.Client
+	id  *big.Int
+	err error
+}
+
+func (c chainIDClient) ChainID(context.Context) (*big.Int, error) { return c.id, c.err }
+
+func TestNumericChainID(t *testing.T) {
+	ctx := context.Background()
+	unused := chainIDClient{err: errors.New("unexpected call")}
+	assert.Equal(t, uint64(56), numericChainID(ctx, "bsc-mainnet", unused))
+	assert.Equal(t, uint64(10), numericChainID(ctx, "10", unused))
+	assert.Equal(t, uint64(42161), numericChainID(ctx, "arbitrum", unused))
+	assert.Equal(t, uint64(1), numericChainID(ctx, "ethereum", unused))
+	assert.Equal(t, uint64(7000), numericChainID(ctx, "herochain", chainIDClient{id: big.NewInt(7000)}))
+	assert.Equal(t, uint64(0), numericChainID(ctx, "herochain", unused))
+}
+
+func TestNewRPCClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Without rpc_nodes, the preset endpoints are used
+	client, err := newRPCClient(ctx, config.ChainScanConfig{ScannerConfig: config.ScannerConfig{ChainID: "base"}})
+	assert.NoError(t, err)
+	client.Close()
+
+	_, err = newRPCClient(ctx, config.ChainScanConfig{ScannerConfig: config.ScannerConfig{ChainID: "herochain"}})
+	assert.ErrorIs(t, err, rpc.ErrNoChainNodes)
+
+	client, err = newRPCClient(ctx, config.ChainScanConfig{
+		ScannerConfig: config.ScannerConfig{ChainID: "herochain"},
+		RPC:           []rpc.NodeConfig{{URL: "http://127.0.0.1:1"}},
+	})
+	assert.NoError(t, err)
+	client.Close()
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/admin"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// healthHandler answers GET /healthz with 200 while the cursor store is
+// reachable and no scanner has failed, and 503 otherwise. The body lists the
+// status of every chain returned by chains, which may be nil.
+func healthHandler(store storage.Persistence, chains func() []scanner.Stats) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+		if err := store.Ping(ctx); err != nil {
+			http.Error(w, "store: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		var body strings.Builder
+		healthy := true
+		if chains != nil {
+			for _, st := range chains() {
+				status := "running"
+				switch {
+				case !st.Running && st.LastError != "":
+					status, healthy = "failed", false
+				case !st.Running:
+					status = "stopped"
+				}
+				fmt.Fprintf(&body, "%s\t%s\tnext_block=%d safe_head=%d", st.ChainID, status, st.NextBlock, st.SafeHead)
+				if st.LastError != "" {
+					fmt.Fprintf(&body, " last_error=%q", st.LastError)
+				}
+				body.WriteString("\n")
+			}
+		}
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("scanner failed\n" + body.String()))
+			return
+		}
+		_, _ = w.Write([]byte("ok\n" + body.String()))
+	})
+	return mux
+}
+
+// chainStats returns the stats of the scanners of chains.
+func chainStats(chains []*chainScan) func() []scanner.Stats {
+	return func() []scanner.Stats {
+		stats := make([]scanner.Stats, len(chains))
+		for i, ch := range chains {
+			stats[i] = ch.scanner.Stats()
+		}
+		return stats
+	}
+}
+
+// adminHandler returns the admin API of chains, authenticated with token. It
+// sets level, if not nil.
+func adminHandler(token string, chains []*chainScan, store storage.Persistence, outputs *outputSwitch, level *slog.LevelVar) http.Handler {
+	cfg := admin.Config{Token: token, LogLevel: level}
+	for _, ch := range chains {
+		cfg.Chains = append(cfg.Chains, admin.Chain{Scanner: ch.scanner, Client: ch.client, Store: store})
+	}
+	cfg.Outputs = func() []sink.SinkStats {
+		stats := outputs.Stats()
+		for _, ch := range chains {
+			if !ch.ownOutputs {
+				continue
+			}
+			for _, st := range ch.outputs.Stats() {
+				st.Name = ch.chainID + "/" + st.Name
+				stats = append(stats, st)
+			}
+		}
+		return stats
+	}
+	return admin.NewHandler(cfg)
+}
+
+// serveHTTP serves the handler h of the name server on addr until ctx is done.
+func serveHTTP(ctx context.Context, name, addr string, h http.Handler) {
+	srv := &http.Server{Addr: addr, Handler: h, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	log.Info("Serving HTTP", "server", name, "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("HTTP server failed", "server", name, "err", err)
+	}
+}
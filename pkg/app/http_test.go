@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// downStore is a memory store whose Ping fails.
+type downStore struct {
+	*storage.MemoryStore
+}
+
+func (downStore) Ping(context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestHealthHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	healthHandler(storage.NewMemoryStore(""), nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	healthHandler(downStore{storage.NewMemoryStore("")}, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "connection refused")
+
+	rec = httptest.NewRecorder()
+	healthHandler(storage.NewMemoryStore(""), nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHealthHandler_Chains(t *testing.T) {
+	stats := []scanner.Stats{
+		{ChainID: "ethereum", Running: true, NextBlock: 101, SafeHead: 100},
+		{ChainID: "base", Running: true, NextBlock: 51, SafeHead: 60, LastError: "rate limited"},
+	}
+	chains := func() []scanner.Stats { return stats }
+
+	rec := httptest.NewRecorder()
+	healthHandler(storage.NewMemoryStore(""), chains).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok\nethereum\trunning\tnext_block=101 safe_head=100\nbase\trunning\tnext_block=51 safe_head=60 last_error=\"rate limited\"\n", rec.Body.String())
+
+	// A failed scanner fails the check, the others are still listed
+	stats[1].Running = false
+	rec = httptest.NewRecorder()
+	healthHandler(storage.NewMemoryStore(""), chains).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "ethereum\trunning")
+	assert.Contains(t, rec.Body.String(), "base\tfailed")
+}
@@ -0,0 +1,619 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// outputSwitch dispatches to the outputs of the running configuration, which a
+// reload swaps.
+type outputSwitch struct {
+	mu  sync.RWMutex
+	out *sink.MultiSink
+}
+
+// Send delivers logs to the current outputs. A swap waits for it to return.
+func (o *outputSwitch) Send(ctx context.Context, logs []sink.DecodedLog) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.out.Send(ctx, logs)
+}
+
+// swap replaces the outputs, once no Send uses them.
+func (o *outputSwitch) swap(out *sink.MultiSink) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.out = out
+}
+
+// Stats returns the stats of the current outputs.
+func (o *outputSwitch) Stats() []sink.SinkStats {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.out.Stats()
+}
+
+// Pressure returns the pressure of the current outputs.
+func (o *outputSwitch) Pressure() float64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.out.Pressure()
+}
+
+// loadPositions loads the high-water marks of the chains into the current
+// outputs.
+func (o *outputSwitch) loadPositions(ctx context.Context, store storage.Persistence, chainIDs ...string) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.out.LoadPositions(ctx, store, chainIDs...)
+}
+
+// savePositions saves the high-water marks of the current outputs.
+func (o *outputSwitch) savePositions(ctx context.Context, store storage.Persistence) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.out.SavePositions(ctx, store)
+}
+
+// Close closes the current outputs.
+func (o *outputSwitch) Close() error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.out.Close()
+}
+
+// sharedOutputs returns the app config the shared outputs are built from,
+// with the filters of every chain for the postgres event tables.
+func sharedOutputs(cfg *config.Config) *config.AppConfig {
+	appCfg := cfg.AppConfig
+	appCfg.Filters = cfg.AllFilters()
+	return &appCfg
+}
+
+// needsBlockTime reports whether outputs place events by the time of their
+// block, so that the scanner has to fill it in.
+func needsBlockTime(o config.OutputsConfig) bool {
+	return o.S3.Enabled || o.Elastic.Enabled && sink.ElasticsearchIndexDated(o.Elastic.Index)
+}
+
+// prepareOutputs fills the output settings derived from the rest of cfg. With
+// outputs.postgres.atomic_cursor, postgres is written by the scanner instead
+// of the dispatcher: it is disabled in cfg and its section returned.
+func prepareOutputs(cfg *config.Config) (config.PostgresOutputConfig, bool) {
+	if cfg.Outputs.Kafka.ChainID == "" {
+		cfg.Outputs.Kafka.ChainID = cfg.Scanner.ChainID
+	}
+	pgCfg := cfg.Outputs.Postgres
+	atomic := pgCfg.Enabled && pgCfg.AtomicCursor
+	if atomic {
+		cfg.Outputs.Postgres.Enabled = false
+	}
+	return pgCfg, atomic
+}
+
+// dropOutputs disables the outputs of cfg, for dry runs.
+func dropOutputs(cfg *config.Config) {
+	cfg.Outputs = config.OutputsConfig{}
+	cfg.Webhook = config.WebhookOutputConfig{}
+	for i := range cfg.Scanners {
+		cfg.Scanners[i].Outputs = nil
+	}
+}
+
+// outputSpec describes a configured output and how to construct it.
+type outputSpec struct {
+	name     string
+	config   any // The section, unchanged sections keep their output on reload
+	enabled  bool
+	optional bool
+	timeout  time.Duration
+	filter   string
+	build    func() (sink.Output, error)
+}
+
+// withTemplate wraps the output built by build with a message template, if set.
+func withTemplate(tmpl string, build func() (sink.Output, error)) func() (sink.Output, error) {
+	if tmpl == "" {
+		return build
+	}
+	return func() (sink.Output, error) {
+		out, err := build()
+		if err != nil {
+			return nil, err
+		}
+		templated, err := sink.WithTemplate(out, tmpl)
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		return templated, nil
+	}
+}
+
+// outputSpecs describes every output section of appCfg, enabled or not.
+func outputSpecs(appCfg *config.AppConfig) []outputSpec {
+	// Webhook (legacy top-level section is used when outputs.webhook is disabled)
+	wh := appCfg.Outputs.Webhook
+	if !wh.Enabled && appCfg.Webhook.URL != "" {
+		wh = appCfg.Webhook
+		wh.Enabled = true
+	}
+
+	o := appCfg.Outputs
+	return []outputSpec{
+		{"webhook", wh, wh.Enabled, wh.Optional, wh.Timeout, wh.Filter, withTemplate(wh.Template, func() (sink.Output, error) {
+			return sink.NewWebhookOutputWithConfig(sink.WebhookConfig{
+				URL:            wh.URL,
+				Secret:         wh.Secret,
+				MaxAttempts:    wh.Retry.MaxAttempts,
+				InitialBackoff: wh.Retry.InitialBackoff,
+				MaxBackoff:     wh.Retry.MaxBackoff,
+				Async:          wh.Async,
+				BufferSize:     wh.BufferSize,
+				Workers:        wh.Workers,
+				Headers:        wh.Headers,
+				BearerToken:    wh.BearerToken,
+
+				MaxEventsPerRequest: wh.MaxEventsPerRequest,
+				MaxPayloadBytes:     wh.MaxPayloadBytes,
+				TLS:                 wh.TLS,
+				RequestTimeout:      wh.RequestTimeout,
+				MaxIdleConns:        wh.MaxIdleConns,
+				IdleConnTimeout:     wh.IdleConnTimeout,
+				DrainTimeout:        wh.DrainTimeout,
+				LegacySignature:     wh.LegacySignature,
+
+				EnableCompression:    wh.EnableCompression,
+				CompressionThreshold: wh.CompressionThreshold,
+				CloudEvents:          wh.CloudEvents,
+				DeadLetter: func(l sink.DecodedLog, err error) {
+					log.Error("Webhook delivery failed", "tx", l.Log.TxHash.Hex(), "index", l.Log.Index, "block", l.Log.BlockNumber, "err", err)
+				},
+			})
+		})},
+		{"file", o.File, o.File.Enabled, o.File.Optional, o.File.Timeout, o.File.Filter, func() (sink.Output, error) {
+			return sink.NewFileOutputWithConfig(sink.FileConfig{
+				Path:           o.File.Path,
+				Format:         o.File.Format,
+				MaxSize:        o.File.MaxSizeMB * 1024 * 1024,
+				MaxAge:         o.File.MaxAge,
+				RotateOnSIGHUP: o.File.RotateOnSIGHUP,
+				Compress:       o.File.Compress,
+				MaxBackups:     o.File.MaxBackups,
+			})
+		}},
+		{"console", o.Console, o.Console.Enabled, false, 0, o.Console.Filter, func() (sink.Output, error) {
+			format, err := sink.ParseConsoleFormat(o.Console.Format)
+			if err != nil {
+				return nil, err
+			}
+			opts := []sink.ConsoleOption{sink.WithConsoleFormat(format), sink.WithConsoleMaxFieldWidth(o.Console.MaxFieldWidth)}
+			if o.Console.Stderr {
+				opts = append(opts, sink.WithConsoleWriter(os.Stderr))
+			}
+			return sink.NewConsoleOutput(opts...), nil
+		}},
+		{"postgres", []any{o.Postgres, appCfg.Filters}, o.Postgres.Enabled, o.Postgres.Optional, o.Postgres.Timeout, o.Postgres.Filter, func() (sink.Output, error) {
+			return newPostgresOutput(o.Postgres, appCfg.Filters)
+		}},
+		{"mysql", o.MySQL, o.MySQL.Enabled, o.MySQL.Optional, o.MySQL.Timeout, o.MySQL.Filter, func() (sink.Output, error) {
+			return sink.NewMySQLOutput(o.MySQL.DSN, o.MySQL.Table)
+		}},
+		{"sqlite", o.SQLite, o.SQLite.Enabled, o.SQLite.Optional, o.SQLite.Timeout, o.SQLite.Filter, func() (sink.Output, error) {
+			return sink.NewSQLiteOutput(o.SQLite.Path, o.SQLite.Table)
+		}},
+		{"redis", o.Redis, o.Redis.Enabled, o.Redis.Optional, o.Redis.Timeout, o.Redis.Filter, withTemplate(o.Redis.Template, func() (sink.Output, error) {
+			return sink.NewRedisOutputWithConfig(sink.RedisConfig{
+				Config: o.Redis.Config,
+				Key:    o.Redis.Key,
+				Mode:   o.Redis.Mode,
+				MaxLen: o.Redis.MaxLen,
+				TTL:    o.Redis.TTL,
+			})
+		})},
+		{"kafka", o.Kafka, o.Kafka.Enabled, o.Kafka.Optional, o.Kafka.Timeout, o.Kafka.Filter, func() (sink.Output, error) {
+			var dead sink.Output
+			if o.Kafka.Async && o.Kafka.DeadLetterFile != "" {
+				file, err := sink.NewFileOutput(o.Kafka.DeadLetterFile)
+				if err != nil {
+					return nil, fmt.Errorf("dead letter file: %w", err)
+				}
+				dead = file
+			}
+			out, err := sink.NewKafkaOutputWithConfig(sink.KafkaConfig{
+				Brokers:            o.Kafka.Brokers,
+				Topic:              o.Kafka.Topic,
+				User:               o.Kafka.User,
+				Password:           o.Kafka.Password,
+				SASLMechanism:      o.Kafka.SASLMechanism,
+				TLS:                o.Kafka.TLS,
+				TLSCAFile:          o.Kafka.TLSCAFile,
+				InsecureSkipVerify: o.Kafka.InsecureSkipVerify,
+				Acks:               o.Kafka.Acks,
+				Compression:        o.Kafka.Compression,
+				Idempotent:         o.Kafka.Idempotent,
+				FlushBytes:         o.Kafka.FlushBytes,
+				FlushMessages:      o.Kafka.FlushMessages,
+				FlushFrequency:     o.Kafka.FlushFrequency,
+				PartitionKey:       o.Kafka.PartitionKey,
+				ChainID:            o.Kafka.ChainID,
+				Async:              o.Kafka.Async,
+				QueueSize:          o.Kafka.QueueSize,
+				BlockOnFull:        o.Kafka.BlockOnFull,
+				CloudEvents:        o.Kafka.CloudEvents,
+				DeadLetter: func(l sink.DecodedLog, err error) {
+					log.Error("Kafka delivery failed", "tx", l.Log.TxHash.Hex(), "index", l.Log.Index, "block", l.Log.BlockNumber, "err", err)
+				},
+				DeadLetterOutput: dead,
+			})
+			if err != nil && dead != nil {
+				dead.Close()
+			}
+			return out, err
+		}},
+		{"rabbitmq", o.RabbitMQ, o.RabbitMQ.Enabled, o.RabbitMQ.Optional, o.RabbitMQ.Timeout, o.RabbitMQ.Filter, withTemplate(o.RabbitMQ.Template, func() (sink.Output, error) {
+			return sink.NewRabbitMQOutputWithConfig(sink.RabbitMQConfig{
+				URL:            o.RabbitMQ.URL,
+				Exchange:       o.RabbitMQ.Exchange,
+				ExchangeType:   o.RabbitMQ.ExchangeType,
+				RoutingKey:     o.RabbitMQ.RoutingKey,
+				QueueName:      o.RabbitMQ.QueueName,
+				Durable:        o.RabbitMQ.Durable,
+				Confirm:        o.RabbitMQ.Confirm,
+				ConfirmTimeout: o.RabbitMQ.ConfirmTimeout,
+			})
+		})},
+		{"elasticsearch", o.Elastic, o.Elastic.Enabled, o.Elastic.Optional, o.Elastic.Timeout, o.Elastic.Filter, func() (sink.Output, error) {
+			return sink.NewElasticsearchOutput(o.Elastic.URLs, o.Elastic.Index, sink.ElasticsearchAuth{
+				Username: o.Elastic.Username,
+				Password: o.Elastic.Password,
+				APIKey:   o.Elastic.APIKey,
+			})
+		}},
+		{"websocket", o.Websocket, o.Websocket.Enabled, o.Websocket.Optional, o.Websocket.Timeout, o.Websocket.Filter, func() (sink.Output, error) {
+			return sink.NewWebsocketBroadcastOutput(o.Websocket.Listen, o.Websocket.Path)
+		}},
+		{"slack", o.Slack, o.Slack.Enabled, o.Slack.Optional, o.Slack.Timeout, o.Slack.Filter, func() (sink.Output, error) {
+			return sink.NewSlackOutputWithConfig(sink.SlackConfig{
+				WebhookURL: o.Slack.WebhookURL,
+				SlackChannelOptions: sink.SlackChannelOptions{
+					Channel:   o.Slack.Channel,
+					Username:  o.Slack.Username,
+					IconEmoji: o.Slack.IconEmoji,
+				},
+				Digest:    o.Slack.Digest,
+				Explorer:  o.Slack.Explorer,
+				RateLimit: o.Slack.RateLimit,
+			})
+		}},
+		{"telegram", o.Telegram, o.Telegram.Enabled, o.Telegram.Optional, o.Telegram.Timeout, o.Telegram.Filter, func() (sink.Output, error) {
+			return sink.NewTelegramOutputWithConfig(sink.TelegramConfig{
+				BotToken:  o.Telegram.BotToken,
+				ChatID:    o.Telegram.ChatID,
+				Digest:    o.Telegram.Digest,
+				Explorer:  o.Telegram.Explorer,
+				RateLimit: o.Telegram.RateLimit,
+			})
+		}},
+		{"s3", o.S3, o.S3.Enabled, o.S3.Optional, o.S3.Timeout, o.S3.Filter, func() (sink.Output, error) {
+			awsCfg, err := s3AWSConfig(o.S3)
+			if err != nil {
+				return nil, err
+			}
+			return sink.NewS3OutputWithConfig(sink.S3Config{
+				Bucket:        o.S3.Bucket,
+				Prefix:        o.S3.Prefix,
+				Format:        o.S3.Format,
+				FlushSize:     o.S3.FlushSize,
+				FlushInterval: o.S3.FlushInterval,
+				AWS:           awsCfg,
+				Endpoint:      o.S3.Endpoint,
+				UsePathStyle:  o.S3.UsePathStyle,
+			})
+		}},
+	}
+}
+
+// initOutputs constructs every enabled output behind a dispatcher. A construction
+// failure aborts startup unless the output is marked optional, in which case it is skipped.
+func initOutputs(appCfg *config.AppConfig) (*sink.MultiSink, error) {
+	outputs, _, err := buildOutputs(appCfg, nil)
+	return outputs, err
+}
+
+// builtOutput is an output constructed from its config section.
+type builtOutput struct {
+	config  any
+	numbers sink.NumberFormat
+	out     sink.Output
+}
+
+// buildOutputs is initOutputs keeping the outputs of running whose section is
+// unchanged instead of constructing them again, and dispatching to extra as
+// well. It also returns the outputs of the dispatcher by section name. On
+// failure, no output of running is closed.
+func buildOutputs(appCfg *config.AppConfig, running map[string]builtOutput, extra ...sink.Output) (*sink.MultiSink, map[string]builtOutput, error) {
+	o := appCfg.Outputs
+	numbers, err := sink.ParseNumberFormat(o.NumberFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	specs := outputSpecs(appCfg)
+	policy, err := sink.ParsePolicy(o.Policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := []sink.MultiSinkOption{
+		sink.WithPolicy(policy),
+		sink.WithErrorHandler(func(name string, err error) {
+			log.Error("Output failed", "output", name, "err", err)
+		}),
+		sink.WithLatencyHook(func(name string, elapsed time.Duration, err error) {
+			log.Debug("Output sent", "output", name, "elapsed", elapsed, "ok", err == nil)
+		}),
+	}
+
+	// Filters are configuration errors, reported before connecting to anything
+	filters := make([]func(sink.DecodedLog) bool, len(specs))
+	for i, spec := range specs {
+		if !spec.enabled || spec.filter == "" {
+			continue
+		}
+		if filters[i], err = sink.ParseFilterExpr(spec.filter); err != nil {
+			return nil, nil, fmt.Errorf("output %s: %w", spec.name, err)
+		}
+	}
+
+	var outputs []sink.Output
+	built := make(map[string]builtOutput)
+	for i, spec := range specs {
+		if !spec.enabled {
+			continue
+		}
+		if prev, ok := running[spec.name]; ok && reflect.DeepEqual(prev.config, spec.config) && prev.numbers == numbers {
+			built[spec.name] = prev
+			outputs = append(outputs, prev.out)
+			if spec.timeout > 0 {
+				opts = append(opts, sink.WithSinkTimeout(prev.out.Name(), spec.timeout))
+			}
+			continue
+		}
+		out, err := spec.build()
+		if err != nil {
+			if spec.optional {
+				log.Warn("Skipping optional output", "output", spec.name, "err", err)
+				continue
+			}
+			for name, created := range built {
+				if running[name].out != created.out {
+					created.out.Close()
+				}
+			}
+			return nil, nil, fmt.Errorf("output %s: %w", spec.name, err)
+		}
+		if filters[i] != nil {
+			out = sink.WithFilter(out, filters[i])
+		}
+		out = sink.Instrument(sink.WithNumberFormat(out, numbers))
+		built[spec.name] = builtOutput{config: spec.config, numbers: numbers, out: out}
+		outputs = append(outputs, out)
+		if spec.timeout > 0 {
+			opts = append(opts, sink.WithSinkTimeout(out.Name(), spec.timeout))
+		}
+	}
+
+	return sink.NewMultiSink(append(outputs, extra...), opts...), built, nil
+}
+
+// NewOutput builds the shared output named name, e.g. "webhook", from its
+// section in cfg, whether or not it is enabled there, behind its configured
+// filter. It is how "scanner-cli replay" resends events to an output.
+func NewOutput(cfg *config.Config, name string) (sink.Output, error) {
+	appCfg := sharedOutputs(cfg)
+	numbers, err := sink.ParseNumberFormat(appCfg.Outputs.NumberFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, spec := range outputSpecs(appCfg) {
+		names = append(names, spec.name)
+		if spec.name != name {
+			continue
+		}
+		var filter func(sink.DecodedLog) bool
+		if spec.filter != "" {
+			if filter, err = sink.ParseFilterExpr(spec.filter); err != nil {
+				return nil, fmt.Errorf("output %s: %w", name, err)
+			}
+		}
+		out, err := spec.build()
+		if err != nil {
+			return nil, fmt.Errorf("output %s: %w", name, err)
+		}
+		if filter != nil {
+			out = sink.WithFilter(out, filter)
+		}
+		return sink.WithNumberFormat(out, numbers), nil
+	}
+	return nil, fmt.Errorf("unknown output %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// s3AWSConfig loads the AWS configuration from the environment and shared
+// config files, overridden by the region and static keys set in cfg.
+func s3AWSConfig(cfg config.S3OutputConfig) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load aws config: %w", err)
+	}
+	return awsCfg, nil
+}
+
+// atomicOutput is the postgres output written in the transactions saving the
+// cursors, see atomicPostgres.
+type atomicOutput struct {
+	pg      *sink.PostgresOutput
+	filter  func(sink.DecodedLog) bool
+	numbers sink.NumberFormat
+}
+
+// newPostgresOutput builds the postgres output with its event tables.
+func newPostgresOutput(cfg config.PostgresOutputConfig, filters []config.FilterConfig) (*sink.PostgresOutput, error) {
+	tables, err := eventTables(cfg.EventTables, filters)
+	if err != nil {
+		return nil, err
+	}
+	pg, err := sink.NewPostgresOutputWithConfig(sink.PostgresConfig{
+		URL:           cfg.URL,
+		Table:         cfg.Table,
+		BulkThreshold: cfg.BulkThreshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		if err := pg.MapEvent(t); err != nil {
+			pg.Close()
+			return nil, err
+		}
+	}
+	return pg, nil
+}
+
+// atomicPostgres builds the postgres output of outputs.postgres.atomic_cursor,
+// whose events are written in the transactions saving the cursor of store.
+// Both must use the same database, so store must be the postgres store of storeURL.
+func atomicPostgres(cfg config.PostgresOutputConfig, filters []config.FilterConfig, store storage.Persistence, storeURL string) (*sink.PostgresOutput, func(sink.DecodedLog) bool, error) {
+	if _, ok := store.(storage.TxPersistence); !ok || storeURL == "" {
+		return nil, nil, errors.New("outputs.postgres.atomic_cursor requires the postgres cursor store (storage.type postgres or PG_URL)")
+	}
+	if cfg.URL != storeURL {
+		return nil, nil, errors.New("outputs.postgres.atomic_cursor requires outputs.postgres.url to be the database of the cursor store")
+	}
+	var pred func(sink.DecodedLog) bool
+	if cfg.Filter != "" {
+		var err error
+		if pred, err = sink.ParseFilterExpr(cfg.Filter); err != nil {
+			return nil, nil, fmt.Errorf("output postgres: %w", err)
+		}
+	}
+	pg, err := newPostgresOutput(cfg, filters)
+	if err != nil {
+		return nil, nil, fmt.Errorf("output postgres: %w", err)
+	}
+	return pg, pred, nil
+}
+
+// eventTables resolves configured event tables against the events declared in
+// the filter ABIs.
+func eventTables(configs []config.EventTableConfig, filters []config.FilterConfig) ([]sink.EventTable, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+	events := make(map[string]abi.Event)
+	for _, f := range filters {
+		var (
+			parsed abi.ABI
+			err    error
+		)
+		switch {
+		case f.ABI != "":
+			parsed, err = abi.JSON(strings.NewReader(f.ABI))
+		case len(f.Signatures) > 0:
+			parsed, err = decoder.ParseSignatures(f.Signatures)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: invalid abi: %w", f.Description, err)
+		}
+		for _, e := range parsed.Events {
+			events[e.Name] = e
+		}
+	}
+	tables := make([]sink.EventTable, 0, len(configs))
+	for _, c := range configs {
+		e, ok := events[c.Event]
+		if !ok {
+			return nil, fmt.Errorf("event table %s: event %q not found in any filter abi", c.Table, c.Event)
+		}
+		t, err := sink.NewEventTable(e, c.Table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// logOutputStats logs the stats of every output of outputs, with ctx.
+// positionsInterval is how often the high-water marks of the outputs are
+// saved, see sink.PositionKey.
+var positionsInterval = 30 * time.Second
+
+// positionOutputs returns the outputs of the chains, with the ids of the
+// chains sending to them.
+func (a *App) positionOutputs() map[*outputSwitch][]string {
+	outputs := make(map[*outputSwitch][]string)
+	for _, ch := range a.chains {
+		outputs[ch.outputs] = append(outputs[ch.outputs], ch.chainID)
+	}
+	return outputs
+}
+
+// savePositions saves the high-water marks of the outputs, logging failures:
+// they are only diagnostics.
+func (a *App) savePositions(ctx context.Context) {
+	for outputs := range a.positionOutputs() {
+		if err := outputs.savePositions(ctx, a.store); err != nil {
+			log.Warn("Failed to save output positions", "err", err)
+		}
+	}
+}
+
+// persistPositions saves the high-water marks of the outputs every
+// positionsInterval until ctx is done.
+func (a *App) persistPositions(ctx context.Context) {
+	ticker := time.NewTicker(positionsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.savePositions(ctx)
+		}
+	}
+}
+
+func logOutputStats(outputs *outputSwitch, ctx ...any) {
+	for _, st := range outputs.Stats() {
+		log.Info("Output stats", append([]any{"output", st.Name, "events", st.Events, "bytes", st.Bytes,
+			"sends", st.Sends, "failures", st.Failures, "last_error", st.LastError}, ctx...)...)
+	}
+}
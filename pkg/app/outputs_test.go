@@ -0,0 +1,333 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/internal/webhook"
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitOutputs_Empty(t *testing.T) {
+	outputs, err := initOutputs(&config.AppConfig{})
+	assert.NoError(t, err)
+	assert.Empty(t, outputs.Outputs())
+}
+
+func TestInitOutputs_ConsoleFile(t *testing.T) {
+	appCfg := &config.AppConfig{
+		Outputs: config.OutputsConfig{
+			Console: config.ConsoleOutputConfig{Enabled: true},
+			File:    config.FileOutputConfig{Enabled: true, Path: "/tmp/test.log"},
+		},
+	}
+	defer os.Remove("/tmp/test.log")
+
+	outputs, err := initOutputs(appCfg)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, len(outputs.Outputs()), 1)
+
+	foundConsole := false
+	for _, o := range outputs.Outputs() {
+		if o.Name() == "console" {
+			foundConsole = true
+		}
+	}
+	assert.True(t, foundConsole)
+}
+
+func TestInitOutputs_Strict(t *testing.T) {
+	appCfg := &config.AppConfig{
+		Outputs: config.OutputsConfig{
+			Console: config.ConsoleOutputConfig{Enabled: true},
+			File:    config.FileOutputConfig{Enabled: true, Path: "/"},
+		},
+	}
+
+	outputs, err := initOutputs(appCfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "output file")
+	assert.Nil(t, outputs)
+}
+
+func TestInitOutputs_OptionalSkip(t *testing.T) {
+	appCfg := &config.AppConfig{
+		Outputs: config.OutputsConfig{
+			Console: config.ConsoleOutputConfig{Enabled: true},
+			File:    config.FileOutputConfig{Enabled: true, Optional: true, Path: "/"},
+		},
+	}
+
+	outputs, err := initOutputs(appCfg)
+	assert.NoError(t, err)
+	assert.Len(t, outputs.Outputs(), 1)
+	assert.Equal(t, "console", outputs.Outputs()[0].Name())
+}
+
+func TestInitOutputs_Instrumented(t *testing.T) {
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{Console: config.ConsoleOutputConfig{Enabled: true}}}
+	outputs, err := initOutputs(appCfg)
+	assert.NoError(t, err)
+	assert.NoError(t, outputs.Send(context.Background(), []sink.DecodedLog{{EventName: "Transfer"}}))
+
+	stats := outputs.Stats()
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "console", stats[0].Name)
+	assert.Equal(t, uint64(1), stats[0].Events)
+}
+
+func TestInitOutputs_Policy(t *testing.T) {
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{Policy: "majority"}}
+	_, err := initOutputs(appCfg)
+	assert.Error(t, err)
+
+	appCfg.Outputs = config.OutputsConfig{
+		Policy:  "best-effort",
+		Console: config.ConsoleOutputConfig{Enabled: true},
+		File:    config.FileOutputConfig{Enabled: true, Path: filepath.Join(t.TempDir(), "events.jsonl"), Timeout: time.Second},
+	}
+	outputs, err := initOutputs(appCfg)
+	assert.NoError(t, err)
+	assert.Len(t, outputs.Outputs(), 2)
+	assert.NoError(t, outputs.Close())
+}
+
+func TestInitOutputs_Template(t *testing.T) {
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{
+		Webhook: config.WebhookOutputConfig{Enabled: true, URL: "http://localhost", Template: "{{.EventName}}"},
+	}}
+	outputs, err := initOutputs(appCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "webhook", outputs.Outputs()[0].Name())
+
+	appCfg.Outputs.Webhook.Template = "{{.EventName"
+	_, err = initOutputs(appCfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid webhook template")
+}
+
+func TestInitOutputs_Filter(t *testing.T) {
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{
+		Console: config.ConsoleOutputConfig{Enabled: true, Filter: `event_name == "Transfer" && value > 1e18`},
+	}}
+	outputs, err := initOutputs(appCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, "console", outputs.Outputs()[0].Name())
+	// Nothing matches, so nothing is printed
+	assert.NoError(t, outputs.Send(context.Background(), []sink.DecodedLog{{EventName: "Approval"}}))
+
+	appCfg.Outputs.Console.Filter = "value >"
+	_, err = initOutputs(appCfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "output console: filter expression")
+}
+
+func TestInitOutputs_ConsoleFormat(t *testing.T) {
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{
+		Console: config.ConsoleOutputConfig{Enabled: true, Format: "table", Stderr: true},
+	}}
+	_, err := initOutputs(appCfg)
+	assert.NoError(t, err)
+
+	appCfg.Outputs.Console.Format = "yaml"
+	_, err = initOutputs(appCfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported console format: "yaml"`)
+}
+
+func TestInitOutputs_S3(t *testing.T) {
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{
+		S3: config.S3OutputConfig{
+			Enabled:         true,
+			Bucket:          "events",
+			Region:          "us-east-1",
+			Endpoint:        "http://localhost:9000",
+			UsePathStyle:    true,
+			AccessKeyID:     "minio",
+			SecretAccessKey: "minio123",
+		},
+	}}
+	outputs, err := initOutputs(appCfg)
+	assert.NoError(t, err)
+	assert.NoError(t, outputs.Close())
+
+	appCfg.Outputs.S3.Format = "csv"
+	_, err = initOutputs(appCfg)
+	assert.EqualError(t, err, `output s3: unsupported s3 format: "csv"`)
+}
+
+func TestInitOutputs_WebhookTLS(t *testing.T) {
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{Webhook: config.WebhookOutputConfig{
+		Enabled: true,
+		URL:     "https://hooks.internal/scanner",
+		TLS:     tlsconfig.Config{CertFile: "missing.pem", KeyFile: "missing-key.pem"},
+	}}}
+	_, err := initOutputs(appCfg)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "output webhook")
+	assert.Contains(t, err.Error(), "missing.pem")
+}
+
+func TestEventTables(t *testing.T) {
+	filters := []config.FilterConfig{{
+		Description: "USDT",
+		ABI:         `[{"type":"event","name":"Transfer","inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}]`,
+	}}
+
+	tables, err := eventTables([]config.EventTableConfig{{Event: "Transfer", Table: "transfer_events"}}, filters)
+	assert.NoError(t, err)
+	assert.Len(t, tables, 1)
+	assert.Equal(t, "transfer_events", tables[0].Table)
+	assert.Equal(t, "from_addr", tables[0].Columns[0].Name)
+
+	_, err = eventTables([]config.EventTableConfig{{Event: "Approval", Table: "approval_events"}}, filters)
+	assert.EqualError(t, err, `event table approval_events: event "Approval" not found in any filter abi`)
+
+	_, err = eventTables([]config.EventTableConfig{{Event: "Transfer", Table: "bad-name"}}, filters)
+	assert.EqualError(t, err, "invalid table name: bad-name")
+
+	// Signatures declare the same columns
+	filters = []config.FilterConfig{{Signatures: []string{"event Transfer(address indexed from, address indexed to, uint256 value)"}}}
+	fromSigs, err := eventTables([]config.EventTableConfig{{Event: "Transfer", Table: "transfer_events"}}, filters)
+	assert.NoError(t, err)
+	assert.Equal(t, tables, fromSigs)
+}
+
+func TestAtomicPostgres(t *testing.T) {
+	cfg := config.PostgresOutputConfig{Enabled: true, URL: "postgres://localhost/events", AtomicCursor: true}
+
+	_, _, err := atomicPostgres(cfg, nil, storage.NewMemoryStore(""), "")
+	assert.EqualError(t, err, "outputs.postgres.atomic_cursor requires the postgres cursor store (storage.type postgres or PG_URL)")
+
+	_, _, err = atomicPostgres(cfg, nil, &storage.PostgresStore{}, "postgres://localhost/cursors")
+	assert.EqualError(t, err, "outputs.postgres.atomic_cursor requires outputs.postgres.url to be the database of the cursor store")
+
+	cfg.Filter = "value >"
+	_, _, err = atomicPostgres(cfg, nil, &storage.PostgresStore{}, cfg.URL)
+	assert.ErrorContains(t, err, "output postgres: filter expression")
+}
+
+func TestNeedsBlockTime(t *testing.T) {
+	var o config.OutputsConfig
+	assert.False(t, needsBlockTime(o))
+	o.Elastic = config.ElasticOutputConfig{Enabled: true, Index: "events"}
+	assert.False(t, needsBlockTime(o))
+	o.Elastic.Index = "events-{2006.01.02}"
+	assert.True(t, needsBlockTime(o))
+	o.Elastic.Enabled = false
+	assert.False(t, needsBlockTime(o))
+	o.S3.Enabled = true
+	assert.True(t, needsBlockTime(o))
+}
+
+func TestChainIDInOutputs(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	outputs, err := initOutputs(&config.AppConfig{Outputs: config.OutputsConfig{
+		Webhook: config.WebhookOutputConfig{Enabled: true, URL: ts.URL},
+		File:    config.FileOutputConfig{Enabled: true, Path: path},
+	}})
+	assert.NoError(t, err)
+
+	dec, err := sink.NewDecoderWithConfig(sink.DecoderConfig{Registry: decoder.NewRegistry(), ChainID: "bsc-mainnet", NumericChainID: 56})
+	assert.NoError(t, err)
+	logs, err := decodeLogs(context.Background(), dec, []types.Log{{BlockNumber: 7, Topics: []common.Hash{{}}}})
+	assert.NoError(t, err)
+	assert.Equal(t, sink.StatusUnknownEvent, logs[0].DecodeStatus)
+	assert.NoError(t, outputs.Send(context.Background(), logs))
+	assert.NoError(t, outputs.Close())
+
+	var payload webhook.Payload
+	assert.NoError(t, json.Unmarshal(<-bodies, &payload))
+	assert.Equal(t, "bsc-mainnet", payload.ChainID)
+	assert.Equal(t, uint64(56), payload.NumericChainID)
+	assert.Len(t, payload.Logs, 1)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &line))
+	assert.Equal(t, "bsc-mainnet", line["chain_id"])
+}
+
+func TestBuildOutputs_KeepsUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{
+		Console: config.ConsoleOutputConfig{Enabled: true},
+		File:    config.FileOutputConfig{Enabled: true, Path: filepath.Join(dir, "a.jsonl")},
+	}}
+	_, running, err := buildOutputs(appCfg, nil)
+	assert.NoError(t, err)
+
+	appCfg.Outputs.File.Path = filepath.Join(dir, "b.jsonl")
+	outputs, built, err := buildOutputs(appCfg, running)
+	assert.NoError(t, err)
+	assert.Len(t, outputs.Outputs(), 2)
+	assert.Same(t, running["console"].out, built["console"].out)
+	assert.NotSame(t, running["file"].out, built["file"].out)
+	assert.NoError(t, outputs.Close())
+	assert.NoError(t, running["file"].out.Close())
+
+	// An output failing to build fails the whole build
+	appCfg.Outputs.Webhook = config.WebhookOutputConfig{Enabled: true, URL: "https://hooks.internal", TLS: tlsconfig.Config{CertFile: "missing.pem", KeyFile: "missing-key.pem"}}
+	_, _, err = buildOutputs(appCfg, built)
+	assert.ErrorContains(t, err, "output webhook")
+}
+
+func TestBuildOutputs_NumberFormat(t *testing.T) {
+	dir := t.TempDir()
+	appCfg := &config.AppConfig{Outputs: config.OutputsConfig{
+		NumberFormat: "hex",
+		File:         config.FileOutputConfig{Enabled: true, Path: filepath.Join(dir, "hex.jsonl")},
+	}}
+	hex, running, err := buildOutputs(appCfg, nil)
+	assert.NoError(t, err)
+	// Another App writing decimal at the same time
+	decCfg := &config.AppConfig{Outputs: config.OutputsConfig{
+		File: config.FileOutputConfig{Enabled: true, Path: filepath.Join(dir, "decimal.jsonl")},
+	}}
+	dec, _, err := buildOutputs(decCfg, nil)
+	assert.NoError(t, err)
+
+	logs := []sink.DecodedLog{{
+		Log:         types.Log{Topics: []common.Hash{}},
+		DecodedData: &decoder.DecodedLog{Name: "Transfer", Inputs: map[string]interface{}{"value": big.NewInt(255)}},
+	}}
+	assert.NoError(t, hex.Send(context.Background(), logs))
+	assert.NoError(t, dec.Send(context.Background(), logs))
+	assert.NoError(t, hex.Close())
+	assert.NoError(t, dec.Close())
+	for file, want := range map[string]string{"hex.jsonl": `"value":"0xff"`, "decimal.jsonl": `"value":"255"`} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), want)
+	}
+
+	// A new format builds the outputs anew
+	appCfg.Outputs.NumberFormat = "decimal"
+	_, built, err := buildOutputs(appCfg, running)
+	assert.NoError(t, err)
+	assert.NotSame(t, running["file"].out, built["file"].out)
+	assert.NoError(t, built["file"].out.Close())
+}
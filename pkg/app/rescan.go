@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/sink"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// RescanOptions selects the blocks, filters and outputs of Rescan.
+type RescanOptions struct {
+	ChainID  string // Chain to rescan, optional with a single chain
+	From, To uint64 // Blocks to rescan, both included
+	// Filter is the description of the only filter to rescan, all of them
+	// when empty.
+	Filter string
+	// Outputs are the names of the only outputs to deliver to, e.g.
+	// "kafka", built whether or not they are enabled. Empty means the
+	// enabled outputs of the chain.
+	Outputs []string
+}
+
+// name returns the name of the backfill cursor of the rescan.
+func (o RescanOptions) name() string {
+	name := "rescan-" + strconv.FormatUint(o.From, 10) + "-" + strconv.FormatUint(o.To, 10)
+	if o.Filter != "" {
+		name += "-" + o.Filter
+	}
+	return name
+}
+
+// Rescan reprocesses the blocks From to To of a chain of cfg through its
+// filters, decoders, middleware and outputs, e.g. after fixing a decoder,
+// while its scanner keeps running elsewhere. The blocks are fetched like the
+// batches of the scanner and the cursor of the scanner is left alone: the
+// rescan saves its progress under scanner.BackfillKey, resuming there when
+// interrupted, and deletes it once done if the store is a
+// storage.CursorAdmin. The events are marked Replayed so that idempotent
+// outputs can upsert them; outputs.postgres with atomic_cursor is written
+// like the other outputs. cfg is not modified.
+func Rescan(ctx context.Context, cfg *config.Config, opts RescanOptions, appOpts ...Option) error {
+	if opts.From > opts.To {
+		return fmt.Errorf("rescan: from %d is after to %d", opts.From, opts.To)
+	}
+	c, err := rescanConfig(cfg, opts)
+	if err != nil {
+		return err
+	}
+	var outputs []sink.Output
+	for _, name := range opts.Outputs {
+		out, err := NewOutput(c, name)
+		if err != nil {
+			for _, out := range outputs {
+				out.Close()
+			}
+			return err
+		}
+		outputs = append(outputs, out)
+	}
+	if len(outputs) > 0 {
+		// In place of the configured ones, closed with the App
+		dropOutputs(c)
+		appOpts = append(appOpts, WithOutputs(outputs...))
+	}
+
+	a, err := New(c, appOpts...)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	ch := a.chains[0]
+	name := opts.name()
+	log.Info("Rescanning", "chain_id", ch.chainID, "from", opts.From, "to", opts.To, "filter", opts.Filter, "outputs", opts.Outputs)
+	if err := ch.scanner.BackfillSet(sink.WithReplayed(ctx), name, ch.scanner.FilterSet(), opts.From, opts.To); err != nil {
+		return err
+	}
+	logOutputStats(ch.outputs, "chain_id", ch.chainID)
+	if cursors, ok := a.store.(storage.CursorAdmin); ok {
+		if err := cursors.DeleteCursor(ctx, scanner.BackfillKey(ch.chainID, name)); err != nil {
+			log.Warn("Failed to delete the rescan cursor", "err", err)
+		}
+	}
+	return nil
+}
+
+// rescanConfig returns the configuration of the chain, filter and outputs of
+// opts alone, as a single chain.
+func rescanConfig(cfg *config.Config, opts RescanOptions) (*config.Config, error) {
+	scans := cfg.ChainScans()
+	var scan *config.ChainScanConfig
+	for i := range scans {
+		if scans[i].ChainID == opts.ChainID || opts.ChainID == "" && len(scans) == 1 {
+			scan = &scans[i]
+		}
+	}
+	switch {
+	case scan == nil && opts.ChainID == "":
+		return nil, errors.New("rescan: the configuration scans several chains, select one")
+	case scan == nil:
+		return nil, fmt.Errorf("rescan: chain %q is not scanned by the configuration", opts.ChainID)
+	}
+
+	c := *cfg
+	c.Scanners = nil
+	c.Scanner, c.RPC, c.Filters = scan.ScannerConfig, scan.RPC, nil
+	c.Scanner.StoragePrefix = cfg.Scanner.StoragePrefix
+	if scan.Outputs != nil {
+		c.Outputs = *scan.Outputs
+	}
+	for _, f := range scan.Filters {
+		if opts.Filter == "" || f.Description == opts.Filter {
+			c.Filters = append(c.Filters, f)
+		}
+	}
+	if opts.Filter != "" && len(c.Filters) == 0 {
+		return nil, fmt.Errorf("rescan: no filter %q on chain %s", opts.Filter, scan.ChainID)
+	}
+	// Written by the handler, BackfillSet does not support the TxHandler
+	c.Outputs.Postgres.AtomicCursor = false
+	return &c, nil
+}
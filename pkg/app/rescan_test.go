@@ -0,0 +1,41 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRescanConfig(t *testing.T) {
+	own := &config.OutputsConfig{Postgres: config.PostgresOutputConfig{Enabled: true, AtomicCursor: true}}
+	cfg := &config.Config{
+		Scanner: config.ScannerConfig{StoragePrefix: "prod_"},
+		Scanners: []config.ChainScanConfig{
+			{ScannerConfig: config.ScannerConfig{ChainID: "eth"}, Filters: []config.FilterConfig{{Description: "usdt"}, {Description: "usdc"}}},
+			{ScannerConfig: config.ScannerConfig{ChainID: "bsc"}, Outputs: own},
+		},
+	}
+
+	c, err := rescanConfig(cfg, RescanOptions{ChainID: "eth", Filter: "usdc"})
+	assert.NoError(t, err)
+	assert.Empty(t, c.Scanners)
+	assert.Equal(t, "eth", c.Scanner.ChainID)
+	assert.Equal(t, "prod_", c.Scanner.StoragePrefix)
+	assert.Equal(t, []config.FilterConfig{{Description: "usdc"}}, c.Filters)
+
+	// The own outputs of the chain, written by the handler
+	c, err = rescanConfig(cfg, RescanOptions{ChainID: "bsc"})
+	assert.NoError(t, err)
+	assert.True(t, c.Outputs.Postgres.Enabled)
+	assert.False(t, c.Outputs.Postgres.AtomicCursor)
+	assert.True(t, own.Postgres.AtomicCursor, "cfg is not modified")
+	assert.Len(t, cfg.Scanners, 2)
+
+	_, err = rescanConfig(cfg, RescanOptions{})
+	assert.EqualError(t, err, "rescan: the configuration scans several chains, select one")
+	_, err = rescanConfig(cfg, RescanOptions{ChainID: "polygon"})
+	assert.EqualError(t, err, `rescan: chain "polygon" is not scanned by the configuration`)
+	_, err = rescanConfig(cfg, RescanOptions{ChainID: "bsc", Filter: "usdt"})
+	assert.EqualError(t, err, `rescan: no filter "usdt" on chain bsc`)
+}
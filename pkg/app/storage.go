@@ -0,0 +1,62 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// OpenStore opens the cursor store of the storage section of coreCfg, with
+// the key prefix of the project. A store that cannot be opened is an error,
+// unless the storage falls back to memory.
+func OpenStore(coreCfg *config.Config) (storage.Persistence, error) {
+	st := coreCfg.Storage
+	storePrefix := coreCfg.Scanner.StoragePrefix
+	if storePrefix == "" {
+		storePrefix = coreCfg.Project + "_"
+	}
+	store, err := newStore(st, storePrefix)
+	if err != nil {
+		err = fmt.Errorf("storage %s: %w", st.Type, err)
+		if st.Fallback != config.StorageMemory {
+			return nil, err
+		}
+		log.Error("Cursor store unavailable, scanning from memory: the cursors are lost on exit", "err", err)
+		return storage.NewMemoryStore(storePrefix), nil
+	}
+	return store, nil
+}
+
+// newStore opens the store of st with prefix.
+func newStore(st config.StorageConfig, prefix string) (storage.Persistence, error) {
+	switch st.Type {
+	case config.StoragePostgres:
+		return storage.NewPostgresStoreWithConfig(storage.PostgresStoreConfig{
+			URL:              st.Postgres.URL,
+			TablePrefix:      prefix,
+			MaxOpenConns:     st.Postgres.MaxOpenConns,
+			MaxIdleConns:     st.Postgres.MaxIdleConns,
+			ConnMaxLifetime:  st.Postgres.ConnMaxLifetime,
+			StatementTimeout: st.Postgres.StatementTimeout,
+		})
+	case config.StorageRedis:
+		return storage.NewRedisStoreWithConfig(storage.RedisStoreConfig{Config: st.Redis, Prefix: prefix})
+	case config.StorageEtcd:
+		auth := storage.EtcdAuth{Username: st.Etcd.Username, Password: st.Etcd.Password, TLS: st.Etcd.TLS}
+		return storage.NewEtcdStore(st.Etcd.Endpoints, prefix, auth)
+	case config.StorageConsul:
+		return storage.NewConsulStoreWithConfig(storage.ConsulStoreConfig{
+			Addr:       st.Consul.Addr,
+			Token:      st.Consul.Token,
+			Datacenter: st.Consul.Datacenter,
+			Prefix:     prefix,
+		})
+	case config.StorageSQLite:
+		return storage.NewSQLiteStore(st.SQLite.Path, prefix)
+	case config.StorageFile:
+		return storage.NewFileStoreWithConfig(storage.FileStoreConfig{Path: st.File.Path, Prefix: prefix, FlushInterval: st.File.FlushInterval})
+	}
+	return storage.NewMemoryStore(prefix), nil
+}
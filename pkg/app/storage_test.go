@@ -0,0 +1,50 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/config"
+	"github.com/84hero/evm-scanner/pkg/redisconfig"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenStore(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		storage config.StorageConfig
+		want    storage.Persistence
+	}{
+		{config.StorageConfig{}, &storage.MemoryStore{}},
+		{config.StorageConfig{Type: config.StorageMemory}, &storage.MemoryStore{}},
+		{config.StorageConfig{Type: config.StorageFile, File: config.FileStorageConfig{Path: filepath.Join(dir, "cursors.json")}}, &storage.FileStore{}},
+		{config.StorageConfig{Type: config.StorageSQLite, SQLite: config.SQLiteStorageConfig{Path: filepath.Join(dir, "cursors.db")}}, &storage.SQLiteStore{}},
+	} {
+		store, err := OpenStore(&config.Config{Project: "store", Storage: tc.storage})
+		assert.NoError(t, err, tc.storage.Type)
+		assert.IsType(t, tc.want, store, tc.storage.Type)
+		if store != nil {
+			assert.NoError(t, store.SaveCursor(context.Background(), "eth", 10))
+			store.Close()
+		}
+	}
+}
+
+func TestOpenStore_Unreachable(t *testing.T) {
+	for _, st := range []config.StorageConfig{
+		{Type: config.StoragePostgres, Postgres: config.PostgresStorageConfig{URL: "postgres://scanner@127.0.0.1:1/cursors?sslmode=disable"}},
+		{Type: config.StorageRedis, Redis: redisconfig.Config{Addr: "127.0.0.1:1", MaxRetries: -1}},
+	} {
+		// An unreachable store fails the start instead of leaving no store
+		store, err := OpenStore(&config.Config{Storage: st})
+		assert.ErrorContains(t, err, "storage "+st.Type+": ")
+		assert.Nil(t, store)
+
+		st.Fallback = config.StorageMemory
+		store, err = OpenStore(&config.Config{Storage: st})
+		assert.NoError(t, err)
+		assert.IsType(t, &storage.MemoryStore{}, store)
+	}
+}
@@ -0,0 +1,52 @@
+package chain
+
+import (
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+)
+
+// MinInterval floors the polling interval ApplyDefaults derives from the
+// block time, so that fast chains are not polled more than twice a second.
+const MinInterval = 500 * time.Millisecond
+
+// ApplyDefaults fills the fields of cfg left unset with the values of p: the
+// polling interval from its block time, floored at MinInterval, its batch
+// size, confirmations, eth_getLogs range limit and finality mode.
+//
+// The Capabilities of p, if known, gate features: UseBloom is turned off on
+// chains whose blooms are not useful, and a "safe" or "finalized" preset
+// finality mode falls back to confirmations on chains without the tags.
+func ApplyDefaults(cfg *scanner.Config, p Preset) {
+	if cfg.Interval == 0 && p.BlockTime > 0 {
+		cfg.Interval = max(p.BlockTime, MinInterval)
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = p.BatchSize
+	}
+	if cfg.ReorgSafe == 0 {
+		cfg.ReorgSafe = p.ReorgSafe
+	}
+	if cfg.MaxLogsRange == 0 {
+		cfg.MaxLogsRange = p.DefaultMaxLogsRange
+	}
+	if cfg.FinalityMode == "" {
+		cfg.FinalityMode = p.FinalityMode
+		if caps := p.Capabilities; caps != nil && !caps.SupportsFinalizedTag && cfg.FinalityMode != "" {
+			cfg.FinalityMode = scanner.FinalityConfirmations
+		}
+	}
+	if caps := p.Capabilities; caps != nil && !caps.BloomUseful {
+		cfg.UseBloom = false
+	}
+}
+
+// ReceiptStrategy returns how to fetch the receipts of a block on the chain
+// of p: per transaction if its nodes lack eth_getBlockReceipts.
+func ReceiptStrategy(p Preset) rpc.ReceiptStrategy {
+	if caps := p.Capabilities; caps != nil && !caps.SupportsBlockReceipts {
+		return rpc.ReceiptsByTx
+	}
+	return rpc.ReceiptsByBlock
+}
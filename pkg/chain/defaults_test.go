@@ -0,0 +1,119 @@
+package chain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	tests := []struct {
+		chain string
+		want  scanner.Config
+	}{
+		{"eth-mainnet", scanner.Config{Interval: 12 * time.Second, BatchSize: 100, ReorgSafe: 12}},
+		{"bsc-mainnet", scanner.Config{Interval: 3 * time.Second, BatchSize: 200, ReorgSafe: 15, MaxLogsRange: 5000}},
+		{"polygon-mainnet", scanner.Config{Interval: 2 * time.Second, BatchSize: 200, ReorgSafe: 32, MaxLogsRange: 3500}},
+		{"arbitrum-one", scanner.Config{Interval: MinInterval, BatchSize: 2000, ReorgSafe: 20, MaxLogsRange: 10000}},
+		{"optimism-mainnet", scanner.Config{Interval: 2 * time.Second, BatchSize: 500, ReorgSafe: 10, MaxLogsRange: 10000}},
+		{"base-mainnet", scanner.Config{Interval: 2 * time.Second, BatchSize: 500, ReorgSafe: 10, MaxLogsRange: 10000}},
+		{"avalanche-mainnet", scanner.Config{Interval: 2 * time.Second, BatchSize: 500, ReorgSafe: 3, MaxLogsRange: 2048}},
+		{"fantom-mainnet", scanner.Config{Interval: time.Second, BatchSize: 500, ReorgSafe: 3, MaxLogsRange: 10000}},
+		{"gnosis-mainnet", scanner.Config{Interval: 5 * time.Second, BatchSize: 200, ReorgSafe: 12, MaxLogsRange: 10000}},
+		{"linea-mainnet", scanner.Config{Interval: 2 * time.Second, BatchSize: 500, ReorgSafe: 10, MaxLogsRange: 10000}},
+		{"scroll-mainnet", scanner.Config{Interval: 3 * time.Second, BatchSize: 500, ReorgSafe: 10, MaxLogsRange: 10000}},
+		{"zksync-era", scanner.Config{Interval: time.Second, BatchSize: 500, ReorgSafe: 10, MaxLogsRange: 10000}},
+		{"sepolia", scanner.Config{Interval: 12 * time.Second, BatchSize: 100, ReorgSafe: 12}},
+		{"holesky", scanner.Config{Interval: 12 * time.Second, BatchSize: 100, ReorgSafe: 12}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.chain, func(t *testing.T) {
+			p, ok := Get(tt.chain)
+			assert.True(t, ok)
+			var cfg scanner.Config
+			ApplyDefaults(&cfg, p)
+			assert.Equal(t, tt.want, cfg)
+
+			// Explicit settings always win
+			explicit := scanner.Config{
+				Interval:     7 * time.Second,
+				BatchSize:    42,
+				ReorgSafe:    64,
+				MaxLogsRange: 99,
+				FinalityMode: scanner.FinalitySafe,
+			}
+			want := explicit
+			ApplyDefaults(&explicit, p)
+			assert.Equal(t, want, explicit)
+		})
+	}
+}
+
+func TestApplyDefaults_FinalityMode(t *testing.T) {
+	var cfg scanner.Config
+	ApplyDefaults(&cfg, Preset{FinalityMode: scanner.FinalityFinalized})
+	assert.Equal(t, scanner.FinalityFinalized, cfg.FinalityMode)
+	assert.Zero(t, cfg.Interval)
+
+	err := RegisterEntries([]Entry{{Name: "final-chain", ChainID: "7200", BlockTime: time.Second, FinalityMode: "latest"}})
+	assert.ErrorContains(t, err, `chain 0 (final-chain): unsupported finality mode: "latest"`)
+	assert.NoError(t, RegisterEntries([]Entry{{Name: "final-chain", ChainID: "7200", BlockTime: time.Second, FinalityMode: "finalized", MaxLogsRange: 500}}))
+	p, _ := Get("final-chain")
+	assert.Equal(t, scanner.FinalityFinalized, p.FinalityMode)
+	assert.Equal(t, uint64(500), p.DefaultMaxLogsRange)
+}
+
+func TestApplyDefaults_Capabilities(t *testing.T) {
+	derive := func(name string) scanner.Config {
+		p, ok := Get(name)
+		assert.True(t, ok)
+		cfg := scanner.Config{UseBloom: true}
+		ApplyDefaults(&cfg, p)
+		return cfg
+	}
+
+	eth, arb := derive("ethereum"), derive("arbitrum")
+	assert.True(t, eth.UseBloom)
+	assert.False(t, arb.UseBloom, "arbitrum blooms are not useful")
+	assert.Equal(t, 12*time.Second, eth.Interval)
+	assert.Equal(t, MinInterval, arb.Interval)
+	assert.Zero(t, eth.MaxLogsRange)
+	assert.Equal(t, uint64(10000), arb.MaxLogsRange)
+
+	// Finality tags fall back to confirmations where they are unsupported
+	Register("tagless-chain", Preset{ChainID: "7030", BlockTime: time.Second, FinalityMode: scanner.FinalityFinalized})
+	cfg := scanner.Config{}
+	ApplyDefaults(&cfg, mustGet(t, "tagless-chain"))
+	assert.Equal(t, scanner.FinalityFinalized, cfg.FinalityMode, "unknown capabilities gate nothing")
+
+	assert.NoError(t, RegisterCapabilities("7030", Capabilities{BloomUseful: true}))
+	p := mustGet(t, "tagless-chain")
+	assert.Equal(t, time.Second, p.BlockTime, "the rest of the preset is kept")
+	cfg = scanner.Config{UseBloom: true}
+	ApplyDefaults(&cfg, p)
+	assert.Equal(t, scanner.FinalityConfirmations, cfg.FinalityMode)
+	assert.True(t, cfg.UseBloom)
+
+	// An explicit finality mode still wins
+	cfg = scanner.Config{FinalityMode: scanner.FinalitySafe}
+	ApplyDefaults(&cfg, p)
+	assert.Equal(t, scanner.FinalitySafe, cfg.FinalityMode)
+
+	assert.EqualError(t, RegisterCapabilities("ghost-chain", Capabilities{}), `chain "ghost-chain" is not registered`)
+}
+
+func TestReceiptStrategy(t *testing.T) {
+	assert.Equal(t, rpc.ReceiptsByBlock, ReceiptStrategy(mustGet(t, "eth-mainnet")))
+	assert.Equal(t, rpc.ReceiptsByBlock, ReceiptStrategy(mustGet(t, "arbitrum-one")))
+	assert.Equal(t, rpc.ReceiptsByTx, ReceiptStrategy(mustGet(t, "avalanche")))
+	assert.Equal(t, rpc.ReceiptsByBlock, ReceiptStrategy(Preset{}))
+}
+
+func mustGet(t *testing.T, name string) Preset {
+	p, ok := Get(name)
+	assert.True(t, ok, name)
+	return p
+}
@@ -0,0 +1,173 @@
+package chain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/spf13/viper"
+)
+
+// MaxReorgSafe bounds the confirmations of a preset loaded from a file; deeper
+// ones are surely typos.
+const MaxReorgSafe = 1000
+
+// Entry is a preset as written in a chains file or config section.
+type Entry struct {
+	Name      string           `mapstructure:"name"`
+	Aliases   []string         `mapstructure:"aliases"`
+	ChainID   string           `mapstructure:"chain_id"`
+	BlockTime time.Duration    `mapstructure:"block_time"`
+	ReorgSafe uint64           `mapstructure:"reorg_safe"`
+	BatchSize uint64           `mapstructure:"batch_size"`
+	Endpoints []rpc.NodeConfig `mapstructure:"endpoints"`
+	Explorer  string           `mapstructure:"explorer"`
+
+	FinalityMode string        `mapstructure:"finality_mode"`
+	MaxLogsRange uint64        `mapstructure:"max_logs_range"`
+	Capabilities *Capabilities `mapstructure:"capabilities"` // Replaces the overridden ones as a whole
+	// Override must be set to change a registered preset: the fields set in
+	// the entry replace its own, the others are kept.
+	Override bool `mapstructure:"override"`
+}
+
+// LoadFile registers the presets listed under "chains" in a YAML or JSON
+// file, see RegisterEntries.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return load(path, data)
+}
+
+// LoadFS is LoadFile reading from fsys, e.g. an embedded file system.
+func LoadFS(fsys fs.FS, path string) error {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return err
+	}
+	return load(path, data)
+}
+
+func load(path string, data []byte) error {
+	v := viper.New()
+	v.SetConfigType(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("chains file %s: %w", path, err)
+	}
+	var file struct {
+		Chains []Entry `mapstructure:"chains"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return fmt.Errorf("chains file %s: %w", path, err)
+	}
+	if err := RegisterEntries(file.Chains); err != nil {
+		return fmt.Errorf("chains file %s: %w", path, err)
+	}
+	return nil
+}
+
+// RegisterEntries validates entries and registers them along with their
+// aliases, merged over the registered presets they override. An entry naming
+// a registered preset without Override is invalid. If any entry is, none is
+// registered and the error lists every invalid one.
+func RegisterEntries(entries []Entry) error {
+	presets := make([]Preset, len(entries))
+	seen := make(map[string]bool)
+	var errs []error
+	for i, e := range entries {
+		p, err := e.merge()
+		if err == nil && seen[e.Name] {
+			err = errors.New("listed twice")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chain %d (%s): %w", i, e.Name, err))
+		}
+		seen[e.Name] = true
+		presets[i] = p
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for i, e := range entries {
+		Register(e.Name, presets[i])
+		for _, alias := range e.Aliases {
+			RegisterAlias(alias, e.Name)
+		}
+	}
+	return nil
+}
+
+// merge returns the preset of e, over the one it overrides.
+func (e Entry) merge() (Preset, error) {
+	if e.Name == "" {
+		return Preset{}, errors.New("name is required")
+	}
+	mu.RLock()
+	p, registered := registry[e.Name]
+	mu.RUnlock()
+	switch {
+	case registered && !e.Override:
+		return Preset{}, errors.New("already registered, set override to change it")
+	case !registered && e.Override:
+		return Preset{}, errors.New("no registered preset to override")
+	}
+
+	if e.ChainID != "" {
+		p.ChainID = e.ChainID
+	}
+	if e.BlockTime != 0 {
+		p.BlockTime = e.BlockTime
+	}
+	if e.ReorgSafe != 0 {
+		p.ReorgSafe = e.ReorgSafe
+	}
+	if e.BatchSize != 0 {
+		p.BatchSize = e.BatchSize
+	}
+	if len(e.Endpoints) > 0 {
+		p.Endpoints = e.Endpoints
+	}
+	if e.Explorer != "" {
+		p.Explorer = e.Explorer
+	}
+	if e.FinalityMode != "" {
+		mode, err := scanner.ParseFinalityMode(e.FinalityMode)
+		if err != nil {
+			return Preset{}, err
+		}
+		p.FinalityMode = mode
+	}
+	if e.MaxLogsRange != 0 {
+		p.DefaultMaxLogsRange = e.MaxLogsRange
+	}
+	if e.Capabilities != nil {
+		p.Capabilities = e.Capabilities
+	}
+
+	if _, err := strconv.ParseUint(p.ChainID, 10, 64); err != nil {
+		return Preset{}, fmt.Errorf("chain_id %q is not a number", p.ChainID)
+	}
+	if p.BlockTime <= 0 {
+		return Preset{}, errors.New("block_time must be positive")
+	}
+	if p.ReorgSafe > MaxReorgSafe {
+		return Preset{}, fmt.Errorf("reorg_safe %d exceeds %d", p.ReorgSafe, MaxReorgSafe)
+	}
+	for i, n := range e.Endpoints {
+		if n.URL == "" {
+			return Preset{}, fmt.Errorf("endpoint %d: url is required", i)
+		}
+	}
+	return p, nil
+}
@@ -1,59 +1,303 @@
 package chain
 
 import (
+	"fmt"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+)
+
+// Limits of the public endpoints of the built-in presets. They are shared by
+// everyone, so stay well below the rate at which they start refusing requests.
+const (
+	PublicRateLimit     = 5
+	PublicMaxConcurrent = 2
 )
 
 // Preset defines the default behavior parameters for a chain
 type Preset struct {
 	ChainID   string
-	BlockTime time.Duration // Average block time (affects polling interval)
-	ReorgSafe uint64        // Recommended safety confirmations
-	BatchSize uint64        // Recommended scan batch size
-	Endpoint  string        // (Optional) Default public RPC
+	BlockTime time.Duration    // Average block time (affects polling interval)
+	ReorgSafe uint64           // Recommended safety confirmations
+	BatchSize uint64           // Recommended scan batch size
+	Endpoints []rpc.NodeConfig // (Optional) Default public RPC nodes, see rpc.NewClientForChain
+	Explorer  string           // (Optional) Block explorer base URL, e.g. https://etherscan.io
+
+	FinalityMode        scanner.FinalityMode // (Optional) Default scanner.Config.FinalityMode
+	DefaultMaxLogsRange uint64               // (Optional) Blocks public nodes serve per eth_getLogs request
+
+	// Capabilities of the chain's nodes, nil if unknown: then no feature is
+	// turned off for lack of them.
+	Capabilities *Capabilities
+}
+
+// Capabilities are what the nodes of a chain support, which ApplyDefaults and
+// ReceiptStrategy consult to gate scanner and rpc features.
+type Capabilities struct {
+	SupportsFinalizedTag  bool `mapstructure:"supports_finalized_tag"`  // Nodes resolve the "safe" and "finalized" block tags
+	SupportsBlockReceipts bool `mapstructure:"supports_block_receipts"` // Nodes serve eth_getBlockReceipts
+	BloomUseful           bool `mapstructure:"bloom_useful"`            // Block blooms rule out enough blocks to be worth checking
+	TraceAPI              bool `mapstructure:"trace_api"`               // Nodes commonly expose trace_* or debug_trace* methods
 }
 
 var (
-	registry = make(map[string]Preset)
-	mu       sync.RWMutex
+	registry  = make(map[string]Preset)
+	aliases   = make(map[string]string) // Alias to preset name
+	byChainID = make(map[string]string) // Numeric chain ID to the first preset name registered with it
+	mu        sync.RWMutex
 )
 
-// Register adds a new chain preset to the global registry.
+// Register adds a new chain preset to the global registry. The preset can
+// then also be looked up by its numeric ChainID, unless another preset
+// registered earlier has the same one.
 func Register(name string, p Preset) {
 	mu.Lock()
 	defer mu.Unlock()
+	if prev, ok := registry[name]; ok && byChainID[prev.ChainID] == name {
+		delete(byChainID, prev.ChainID)
+	}
 	registry[name] = p
+	if _, ok := byChainID[p.ChainID]; !ok && p.ChainID != "" {
+		byChainID[p.ChainID] = name
+	}
+}
+
+// RegisterAlias makes Get resolve alias to the preset registered as name.
+func RegisterAlias(alias, name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	aliases[alias] = name
 }
 
-// Get retrieves a preset configuration from the registry by its name.
+// Get retrieves a preset configuration from the registry by its name, one of
+// its aliases or its numeric chain ID, e.g. "eth-mainnet", "ethereum" or "1".
 func Get(name string) (Preset, bool) {
 	mu.RLock()
 	defer mu.RUnlock()
-	p, ok := registry[name]
+	if p, ok := registry[name]; ok {
+		return p, true
+	}
+	if p, ok := registry[aliases[name]]; ok {
+		return p, true
+	}
+	p, ok := registry[byChainID[name]]
+	return p, ok
+}
+
+// RegisterCapabilities sets the capabilities of the registered preset name,
+// which may be an alias or numeric chain ID, keeping the rest of it.
+func RegisterCapabilities(name string, c Capabilities) error {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range []string{name, aliases[name], byChainID[name]} {
+		if p, ok := registry[key]; ok {
+			p.Capabilities = &c
+			registry[key] = p
+			return nil
+		}
+	}
+	return fmt.Errorf("chain %q is not registered", name)
+}
+
+// GetByChainID retrieves a preset configuration by its numeric chain ID.
+func GetByChainID(id uint64) (Preset, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := registry[byChainID[strconv.FormatUint(id, 10)]]
 	return p, ok
 }
 
+// publicNodes returns the nodes of public endpoints, at the lowest priority
+// and within the PublicRateLimit and PublicMaxConcurrent limits.
+func publicNodes(urls ...string) []rpc.NodeConfig {
+	nodes := make([]rpc.NodeConfig, len(urls))
+	for i, url := range urls {
+		nodes[i] = rpc.NodeConfig{URL: url, Priority: 1, RateLimit: PublicRateLimit, MaxConcurrent: PublicMaxConcurrent}
+	}
+	return nodes
+}
+
 // Built-in presets
 func init() {
+	rpc.SetChainResolver(func(name string) ([]rpc.NodeConfig, bool) {
+		p, ok := Get(name)
+		return p.Endpoints, ok
+	})
+
 	Register("eth-mainnet", Preset{
-		ChainID:   "1",
-		BlockTime: 12 * time.Second,
-		ReorgSafe: 12,
-		BatchSize: 100,
+		ChainID:      "1",
+		BlockTime:    12 * time.Second,
+		ReorgSafe:    12,
+		BatchSize:    100,
+		Endpoints:    publicNodes("https://ethereum-rpc.publicnode.com", "https://eth.llamarpc.com"),
+		Explorer:     "https://etherscan.io",
+		Capabilities: &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true, TraceAPI: true},
 	})
 
 	Register("bsc-mainnet", Preset{
-		ChainID:   "56",
-		BlockTime: 3 * time.Second,
-		ReorgSafe: 15, // BSC reorgs are relatively frequent
-		BatchSize: 200,
+		ChainID:             "56",
+		BlockTime:           3 * time.Second,
+		ReorgSafe:           15, // BSC reorgs are relatively frequent
+		BatchSize:           200,
+		Endpoints:           publicNodes("https://bsc-dataseed.bnbchain.org", "https://bsc-rpc.publicnode.com"),
+		Explorer:            "https://bscscan.com",
+		DefaultMaxLogsRange: 5000,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true, TraceAPI: true},
 	})
 
 	Register("polygon-mainnet", Preset{
-		ChainID:   "137",
-		BlockTime: 2 * time.Second,
-		ReorgSafe: 32, // Polygon recommends deeper confirmations
-		BatchSize: 200,
+		ChainID:             "137",
+		BlockTime:           2 * time.Second,
+		ReorgSafe:           32, // Polygon recommends deeper confirmations
+		BatchSize:           200,
+		Endpoints:           publicNodes("https://polygon-rpc.com", "https://polygon-bor-rpc.publicnode.com"),
+		Explorer:            "https://polygonscan.com",
+		DefaultMaxLogsRange: 3500,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true, TraceAPI: true},
 	})
+
+	Register("arbitrum-one", Preset{
+		ChainID:             "42161",
+		BlockTime:           250 * time.Millisecond,
+		ReorgSafe:           20, // The sequencer does not reorg, but its blocks are tiny
+		BatchSize:           2000,
+		Endpoints:           publicNodes("https://arb1.arbitrum.io/rpc", "https://arbitrum-one-rpc.publicnode.com"),
+		Explorer:            "https://arbiscan.io",
+		DefaultMaxLogsRange: 10000,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, TraceAPI: true}, // Blocks are too frequent for blooms to save requests
+	})
+
+	Register("optimism-mainnet", Preset{
+		ChainID:             "10",
+		BlockTime:           2 * time.Second,
+		ReorgSafe:           10,
+		BatchSize:           500,
+		Endpoints:           publicNodes("https://mainnet.optimism.io", "https://optimism-rpc.publicnode.com"),
+		Explorer:            "https://optimistic.etherscan.io",
+		DefaultMaxLogsRange: 10000,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true, TraceAPI: true},
+	})
+
+	Register("base-mainnet", Preset{
+		ChainID:             "8453",
+		BlockTime:           2 * time.Second,
+		ReorgSafe:           10,
+		BatchSize:           500,
+		Endpoints:           publicNodes("https://mainnet.base.org", "https://base-rpc.publicnode.com"),
+		Explorer:            "https://basescan.org",
+		DefaultMaxLogsRange: 10000,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true, TraceAPI: true},
+	})
+
+	Register("avalanche-mainnet", Preset{
+		ChainID:             "43114",
+		BlockTime:           2 * time.Second,
+		ReorgSafe:           3, // Snowman consensus finalizes blocks within seconds
+		BatchSize:           500,
+		Endpoints:           publicNodes("https://api.avax.network/ext/bc/C/rpc", "https://avalanche-c-chain-rpc.publicnode.com"),
+		Explorer:            "https://snowtrace.io",
+		DefaultMaxLogsRange: 2048,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, BloomUseful: true, TraceAPI: true},
+	})
+
+	Register("fantom-mainnet", Preset{
+		ChainID:             "250",
+		BlockTime:           time.Second,
+		ReorgSafe:           3, // Lachesis blocks are final once emitted
+		BatchSize:           500,
+		Endpoints:           publicNodes("https://rpcapi.fantom.network", "https://fantom-rpc.publicnode.com"),
+		Explorer:            "https://ftmscan.com",
+		DefaultMaxLogsRange: 10000,
+		Capabilities:        &Capabilities{BloomUseful: true, TraceAPI: true},
+	})
+
+	Register("gnosis-mainnet", Preset{
+		ChainID:             "100",
+		BlockTime:           5 * time.Second,
+		ReorgSafe:           12,
+		BatchSize:           200,
+		Endpoints:           publicNodes("https://rpc.gnosischain.com", "https://gnosis-rpc.publicnode.com"),
+		Explorer:            "https://gnosisscan.io",
+		DefaultMaxLogsRange: 10000,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true, TraceAPI: true},
+	})
+
+	Register("linea-mainnet", Preset{
+		ChainID:             "59144",
+		BlockTime:           2 * time.Second,
+		ReorgSafe:           10,
+		BatchSize:           500,
+		Endpoints:           publicNodes("https://rpc.linea.build", "https://linea-rpc.publicnode.com"),
+		Explorer:            "https://lineascan.build",
+		DefaultMaxLogsRange: 10000,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true},
+	})
+
+	Register("scroll-mainnet", Preset{
+		ChainID:             "534352",
+		BlockTime:           3 * time.Second,
+		ReorgSafe:           10,
+		BatchSize:           500,
+		Endpoints:           publicNodes("https://rpc.scroll.io", "https://scroll-rpc.publicnode.com"),
+		Explorer:            "https://scrollscan.com",
+		DefaultMaxLogsRange: 10000,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true},
+	})
+
+	Register("zksync-era", Preset{
+		ChainID:             "324",
+		BlockTime:           time.Second,
+		ReorgSafe:           10,
+		BatchSize:           500,
+		Endpoints:           publicNodes("https://mainnet.era.zksync.io"),
+		Explorer:            "https://explorer.zksync.io",
+		DefaultMaxLogsRange: 10000,
+		Capabilities:        &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, TraceAPI: true}, // Block blooms are left empty
+	})
+
+	Register("sepolia", Preset{
+		ChainID:      "11155111",
+		BlockTime:    12 * time.Second,
+		ReorgSafe:    12,
+		BatchSize:    100,
+		Endpoints:    publicNodes("https://ethereum-sepolia-rpc.publicnode.com", "https://rpc.sepolia.org"),
+		Explorer:     "https://sepolia.etherscan.io",
+		Capabilities: &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true},
+	})
+
+	Register("holesky", Preset{
+		ChainID:      "17000",
+		BlockTime:    12 * time.Second,
+		ReorgSafe:    12,
+		BatchSize:    100,
+		Endpoints:    publicNodes("https://ethereum-holesky-rpc.publicnode.com"),
+		Explorer:     "https://holesky.etherscan.io",
+		Capabilities: &Capabilities{SupportsFinalizedTag: true, SupportsBlockReceipts: true, BloomUseful: true},
+	})
+
+	for alias, name := range map[string]string{
+		"ethereum":  "eth-mainnet",
+		"eth":       "eth-mainnet",
+		"mainnet":   "eth-mainnet",
+		"bsc":       "bsc-mainnet",
+		"bnb":       "bsc-mainnet",
+		"polygon":   "polygon-mainnet",
+		"matic":     "polygon-mainnet",
+		"arbitrum":  "arbitrum-one",
+		"optimism":  "optimism-mainnet",
+		"base":      "base-mainnet",
+		"avalanche": "avalanche-mainnet",
+		"avax":      "avalanche-mainnet",
+		"fantom":    "fantom-mainnet",
+		"gnosis":    "gnosis-mainnet",
+		"xdai":      "gnosis-mainnet",
+		"linea":     "linea-mainnet",
+		"scroll":    "scroll-mainnet",
+		"zksync":    "zksync-era",
+	} {
+		RegisterAlias(alias, name)
+	}
 }
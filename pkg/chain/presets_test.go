@@ -1,9 +1,12 @@
 package chain
 
 import (
+	"context"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	"github.com/84hero/evm-scanner/pkg/rpc"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,3 +31,142 @@ func TestRegistry(t *testing.T) {
 	_, ok = Get("unknown-chain")
 	assert.False(t, ok)
 }
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		key     string
+		chainID string
+	}{
+		{"eth-mainnet", "1"},
+		{"ethereum", "1"},
+		{"1", "1"},
+		{"arbitrum-one", "42161"},
+		{"arbitrum", "42161"},
+		{"42161", "42161"},
+		{"optimism", "10"},
+		{"base", "8453"},
+		{"avax", "43114"},
+		{"fantom", "250"},
+		{"xdai", "100"},
+		{"linea", "59144"},
+		{"scroll", "534352"},
+		{"zksync", "324"},
+		{"11155111", "11155111"},
+		{"holesky", "17000"},
+	}
+	for _, tt := range tests {
+		p, ok := Get(tt.key)
+		assert.True(t, ok, tt.key)
+		assert.Equal(t, tt.chainID, p.ChainID, tt.key)
+		assert.NotZero(t, p.BlockTime, tt.key)
+		assert.NotZero(t, p.BatchSize, tt.key)
+	}
+
+	p, ok := GetByChainID(8453)
+	assert.True(t, ok)
+	assert.Equal(t, "https://basescan.org", p.Explorer)
+	_, ok = GetByChainID(999999)
+	assert.False(t, ok)
+
+	// Presets sharing a chain ID keep resolving it to the first one
+	Register("eth-fork", Preset{ChainID: "1", BlockTime: time.Second})
+	p, _ = GetByChainID(1)
+	assert.Equal(t, 12*time.Second, p.BlockTime)
+
+	RegisterAlias("fork", "eth-fork")
+	p, ok = Get("fork")
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, p.BlockTime)
+	RegisterAlias("dangling", "missing-chain")
+	_, ok = Get("dangling")
+	assert.False(t, ok)
+}
+
+func TestLoadFile(t *testing.T) {
+	assert.NoError(t, LoadFile("testdata/chains.yaml"))
+
+	p, ok := Get("hero")
+	assert.True(t, ok)
+	assert.Equal(t, Preset{
+		ChainID:   "7000",
+		BlockTime: 2 * time.Second,
+		ReorgSafe: 6,
+		BatchSize: 500,
+		Endpoints: []rpc.NodeConfig{{URL: "https://rpc.herochain.example", Priority: 5, RateLimit: 20}},
+		Explorer:  "https://scan.herochain.example",
+
+		Capabilities: &Capabilities{SupportsFinalizedTag: true, BloomUseful: true},
+	}, p)
+	p, _ = GetByChainID(7000)
+	assert.Equal(t, "7000", p.ChainID)
+
+	// The override only replaces the fields it sets
+	p, _ = Get("gnosis-mainnet")
+	assert.Equal(t, uint64(20), p.ReorgSafe)
+	assert.Equal(t, 5*time.Second, p.BlockTime)
+	assert.Equal(t, "https://gnosisscan.io", p.Explorer)
+
+	// herochain is registered now, so loading it again needs override
+	assert.ErrorContains(t, LoadFile("testdata/chains.yaml"), "chain 0 (herochain): already registered")
+	assert.Error(t, LoadFile("testdata/missing.yaml"))
+}
+
+func TestLoadFile_Invalid(t *testing.T) {
+	err := LoadFile("testdata/chains_invalid.json")
+	for _, msg := range []string{
+		"chain 1 (eth-mainnet): already registered, set override to change it",
+		"chain 2 (slow-chain): block_time must be positive",
+		"chain 3 (deep-chain): reorg_safe 5000 exceeds 1000",
+		`chain 4 (named-chain): chain_id "seven" is not a number`,
+		"chain 5 (ghost-chain): no registered preset to override",
+		"chain 6 (lost-chain): endpoint 0: url is required",
+	} {
+		assert.ErrorContains(t, err, msg)
+	}
+	assert.NotContains(t, err.Error(), "valid-chain")
+
+	// Nothing is registered from an invalid file
+	_, ok := Get("valid-chain")
+	assert.False(t, ok)
+
+	err = RegisterEntries([]Entry{
+		{Name: "twin-chain", ChainID: "7004", BlockTime: time.Second},
+		{Name: "twin-chain", ChainID: "7005", BlockTime: time.Second},
+		{ChainID: "7006"},
+	})
+	assert.ErrorContains(t, err, "chain 1 (twin-chain): listed twice")
+	assert.ErrorContains(t, err, "chain 2 (): name is required")
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{"chains.json": {Data: []byte(`{"chains": [{"name": "embedded-chain", "chain_id": "7010", "block_time": "500ms"}]}`)}}
+	assert.NoError(t, LoadFS(fsys, "chains.json"))
+	p, ok := Get("7010")
+	assert.True(t, ok)
+	assert.Equal(t, 500*time.Millisecond, p.BlockTime)
+
+	assert.ErrorContains(t, LoadFS(fstest.MapFS{"chains.yaml": {Data: []byte("chains: [")}}, "chains.yaml"), "chains file chains.yaml")
+}
+
+func TestEndpoints(t *testing.T) {
+	for _, name := range []string{"eth-mainnet", "bsc-mainnet", "arbitrum-one", "zksync-era", "sepolia"} {
+		p, _ := Get(name)
+		assert.NotEmpty(t, p.Endpoints, name)
+		for _, n := range p.Endpoints {
+			assert.Equal(t, 1, n.Priority, n.URL)
+			assert.Equal(t, PublicRateLimit, n.RateLimit, n.URL)
+			assert.Equal(t, PublicMaxConcurrent, n.MaxConcurrent, n.URL)
+		}
+	}
+
+	// rpc.NewClientForChain resolves presets through this package
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mc, err := rpc.NewClientForChain(ctx, "arbitrum")
+	assert.NoError(t, err)
+	mc.Close()
+
+	Register("offline-chain", Preset{ChainID: "7020", BlockTime: time.Second})
+	_, err = rpc.NewClientForChain(ctx, "offline-chain")
+	assert.ErrorIs(t, err, rpc.ErrNoChainNodes)
+}
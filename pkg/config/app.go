@@ -0,0 +1,328 @@
+package config
+
+import (
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/chain"
+	"github.com/84hero/evm-scanner/pkg/redisconfig"
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
+)
+
+// AppConfig holds the application sections of the configuration: what to
+// scan for and where to deliver it.
+type AppConfig struct {
+	Filters []FilterConfig `mapstructure:"filters"`
+	Outputs OutputsConfig  `mapstructure:"outputs"`
+	// Deprecated: Webhook is the legacy top-level webhook section, used when
+	// outputs.webhook is not enabled.
+	Webhook  WebhookOutputConfig `mapstructure:"webhook"`
+	Tokens   TokensConfig        `mapstructure:"tokens"`
+	Decoding DecodingConfig      `mapstructure:"decoding"`
+	// Chains registers presets for chains without a built-in one, or overrides them
+	Chains []chain.Entry `mapstructure:"chains"`
+}
+
+// DecodingConfig decides what happens to the logs that cannot be decoded.
+type DecodingConfig struct {
+	// OnError is "keep-raw" (default) to deliver them undecoded, "drop" or "error" to fail the batch
+	OnError string `mapstructure:"on_error"`
+	// Provenance adds to every event the nodes that served its batch and
+	// when, as "provenance"
+	Provenance bool `mapstructure:"provenance"`
+}
+
+// TokensConfig adds value_decimal, value_symbol and checksummed address fields
+// to the decoded events of known tokens.
+type TokensConfig struct {
+	List   string `mapstructure:"list"`   // Token list file in the tokenlists.org format
+	Lookup bool   `mapstructure:"lookup"` // Read decimals() and symbol() of unlisted contracts on chain
+}
+
+// OutputsConfig holds every output section. Each output also accepts
+// "timeout", bounding a single Send so a hung sink cannot stall the scanner,
+// and "filter", an expression selecting the events it receives.
+type OutputsConfig struct {
+	// Policy decides when a failing output fails the batch: "all" (default), "any" or "best-effort"
+	Policy string `mapstructure:"policy"`
+	// NumberFormat writes decoded integers in JSON as "decimal" (default) or "hex" strings
+	NumberFormat string                `mapstructure:"number_format"`
+	Webhook      WebhookOutputConfig   `mapstructure:"webhook"`
+	File         FileOutputConfig      `mapstructure:"file"`
+	Console      ConsoleOutputConfig   `mapstructure:"console"`
+	Postgres     PostgresOutputConfig  `mapstructure:"postgres"`
+	MySQL        MySQLOutputConfig     `mapstructure:"mysql"`
+	SQLite       SQLiteOutputConfig    `mapstructure:"sqlite"`
+	Redis        RedisOutputConfig     `mapstructure:"redis"`
+	Kafka        KafkaOutputConfig     `mapstructure:"kafka"`
+	RabbitMQ     RabbitMQOutputConfig  `mapstructure:"rabbitmq"`
+	Elastic      ElasticOutputConfig   `mapstructure:"elasticsearch"`
+	Websocket    WebsocketOutputConfig `mapstructure:"websocket"`
+	Slack        SlackOutputConfig     `mapstructure:"slack"`
+	Telegram     TelegramOutputConfig  `mapstructure:"telegram"`
+	S3           S3OutputConfig        `mapstructure:"s3"`
+}
+
+// WebhookOutputConfig configures the webhook output.
+type WebhookOutputConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Optional   bool          `mapstructure:"optional"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	Filter     string        `mapstructure:"filter"`
+	URL        string        `mapstructure:"url"`
+	Secret     string        `mapstructure:"secret"`
+	Retry      RetryConfig   `mapstructure:"retry"`
+	Async      bool          `mapstructure:"async"`
+	BufferSize int           `mapstructure:"buffer_size"` // Events buffered in async mode
+	Workers    int           `mapstructure:"workers"`
+	Template   string        `mapstructure:"template"` // Optional text/template replacing the JSON body
+
+	Headers     map[string]string `mapstructure:"headers"`      // Added to every request
+	BearerToken string            `mapstructure:"bearer_token"` // Sent as "Authorization: Bearer <token>"
+
+	// Split large batches into several requests, 0 means no limit
+	MaxEventsPerRequest int `mapstructure:"max_events_per_request"`
+	MaxPayloadBytes     int `mapstructure:"max_payload_bytes"`
+
+	TLS tlsconfig.Config `mapstructure:"tls"` // Client certificate and CA for mutual TLS
+
+	// HTTP client, 0 for the defaults: 10s per request, 100 idle connections kept 90s
+	RequestTimeout  time.Duration `mapstructure:"request_timeout"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	IdleConnTimeout time.Duration `mapstructure:"idle_conn_timeout"`
+
+	// Gzip bodies above the threshold in bytes (1024 when 0), signed compressed
+	EnableCompression    bool `mapstructure:"enable_compression"`
+	CompressionThreshold int  `mapstructure:"compression_threshold"`
+
+	CloudEvents string `mapstructure:"cloudevents"` // "structured" or "batch" CloudEvents instead of the built-in payload
+
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"` // Max wait for queued events on shutdown in async mode
+
+	// LegacySignature signs the body alone, without X-Scanner-Timestamp (deprecated, removed in the next release)
+	LegacySignature bool `mapstructure:"legacy_signature"`
+}
+
+// FileOutputConfig configures the file output.
+type FileOutputConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Optional       bool          `mapstructure:"optional"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	Filter         string        `mapstructure:"filter"`
+	Path           string        `mapstructure:"path"`
+	Format         string        `mapstructure:"format"`
+	MaxSizeMB      int64         `mapstructure:"max_size_mb"`
+	MaxAge         time.Duration `mapstructure:"max_age"`
+	RotateOnSIGHUP bool          `mapstructure:"rotate_on_sighup"`
+	Compress       bool          `mapstructure:"compress"`
+	MaxBackups     int           `mapstructure:"max_backups"`
+}
+
+// ConsoleOutputConfig configures the console output.
+type ConsoleOutputConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Format        string `mapstructure:"format"` // json (default), pretty or table
+	Stderr        bool   `mapstructure:"stderr"`
+	MaxFieldWidth int    `mapstructure:"max_field_width"`
+	Filter        string `mapstructure:"filter"`
+}
+
+// PostgresOutputConfig configures the PostgreSQL output.
+type PostgresOutputConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Optional bool          `mapstructure:"optional"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Filter   string        `mapstructure:"filter"`
+	URL      string        `mapstructure:"url"`
+	Table    string        `mapstructure:"table"`
+	// BulkThreshold loads batches of at least this many rows with COPY, 0 disables it
+	BulkThreshold int `mapstructure:"bulk_threshold"`
+	// EventTables stores the listed events in dedicated tables with a column per input
+	EventTables []EventTableConfig `mapstructure:"event_tables"`
+	// AtomicCursor writes events in the transaction saving the cursor; url must be the PG_URL store database
+	AtomicCursor bool `mapstructure:"atomic_cursor"`
+}
+
+// EventTableConfig maps an event from one of the filter ABIs to a table.
+type EventTableConfig struct {
+	Event string `mapstructure:"event"`
+	Table string `mapstructure:"table"`
+}
+
+// MySQLOutputConfig configures the MySQL output.
+type MySQLOutputConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Optional bool          `mapstructure:"optional"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Filter   string        `mapstructure:"filter"`
+	DSN      string        `mapstructure:"dsn"`
+	Table    string        `mapstructure:"table"`
+}
+
+// SQLiteOutputConfig configures the SQLite output.
+type SQLiteOutputConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Optional bool          `mapstructure:"optional"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Filter   string        `mapstructure:"filter"`
+	Path     string        `mapstructure:"path"`
+	Table    string        `mapstructure:"table"`
+}
+
+// RedisOutputConfig configures the Redis output.
+type RedisOutputConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Optional bool          `mapstructure:"optional"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Filter   string        `mapstructure:"filter"`
+	Key      string        `mapstructure:"key"`  // Static name or template, e.g. "events:{{.EventName}}"
+	Mode     string        `mapstructure:"mode"` // list (default), pubsub, stream or hash
+	MaxLen   int64         `mapstructure:"max_len"`
+	TTL      time.Duration `mapstructure:"ttl"`
+	Template string        `mapstructure:"template"`
+
+	// Connection: addr, password and db, or sentinel or cluster settings, plus tls
+	redisconfig.Config `mapstructure:",squash"`
+}
+
+// KafkaOutputConfig configures the Kafka output.
+type KafkaOutputConfig struct {
+	Enabled            bool          `mapstructure:"enabled"`
+	Optional           bool          `mapstructure:"optional"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	Filter             string        `mapstructure:"filter"`
+	Brokers            []string      `mapstructure:"brokers"`
+	Topic              string        `mapstructure:"topic"`
+	User               string        `mapstructure:"user"`
+	Password           string        `mapstructure:"password"`
+	SASLMechanism      string        `mapstructure:"sasl_mechanism"`
+	TLS                bool          `mapstructure:"tls"`
+	TLSCAFile          string        `mapstructure:"tls_ca_file"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"`
+	Acks               string        `mapstructure:"acks"`
+	Compression        string        `mapstructure:"compression"`
+	Idempotent         bool          `mapstructure:"idempotent"`
+	FlushBytes         int           `mapstructure:"flush_bytes"`
+	FlushMessages      int           `mapstructure:"flush_messages"`
+	FlushFrequency     time.Duration `mapstructure:"flush_frequency"`
+	PartitionKey       string        `mapstructure:"partition_key"`
+	ChainID            string        `mapstructure:"chain_id"` // Defaults to scanner.chain_id
+	Async              bool          `mapstructure:"async"`
+	QueueSize          int           `mapstructure:"queue_size"`
+	BlockOnFull        bool          `mapstructure:"block_on_full"`
+	CloudEvents        string        `mapstructure:"cloudevents"` // "structured" or "batch" CloudEvents records
+
+	// DeadLetterFile: JSON lines file the events failing delivery in async mode are appended to; without it they are only logged
+	DeadLetterFile string `mapstructure:"dead_letter_file"`
+}
+
+// RabbitMQOutputConfig configures the RabbitMQ output.
+type RabbitMQOutputConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Optional       bool          `mapstructure:"optional"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	Filter         string        `mapstructure:"filter"`
+	URL            string        `mapstructure:"url"`
+	Exchange       string        `mapstructure:"exchange"`
+	ExchangeType   string        `mapstructure:"exchange_type"`
+	RoutingKey     string        `mapstructure:"routing_key"`
+	QueueName      string        `mapstructure:"queue_name"`
+	Durable        bool          `mapstructure:"durable"`
+	Confirm        bool          `mapstructure:"confirm"`
+	ConfirmTimeout time.Duration `mapstructure:"confirm_timeout"`
+	Template       string        `mapstructure:"template"`
+}
+
+// ElasticOutputConfig configures the Elasticsearch output.
+type ElasticOutputConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Optional bool          `mapstructure:"optional"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Filter   string        `mapstructure:"filter"`
+	URLs     []string      `mapstructure:"urls"`
+	Index    string        `mapstructure:"index"`
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	APIKey   string        `mapstructure:"api_key"`
+}
+
+// WebsocketOutputConfig configures the WebSocket broadcast output.
+type WebsocketOutputConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Optional bool          `mapstructure:"optional"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Filter   string        `mapstructure:"filter"`
+	Listen   string        `mapstructure:"listen"`
+	Path     string        `mapstructure:"path"`
+}
+
+// SlackOutputConfig configures the Slack output.
+type SlackOutputConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Optional   bool          `mapstructure:"optional"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	Filter     string        `mapstructure:"filter"`
+	WebhookURL string        `mapstructure:"webhook_url"`
+	Channel    string        `mapstructure:"channel"`
+	Username   string        `mapstructure:"username"`
+	IconEmoji  string        `mapstructure:"icon_emoji"`
+	Digest     int           `mapstructure:"digest"`
+	Explorer   string        `mapstructure:"explorer"`
+	RateLimit  float64       `mapstructure:"rate_limit"`
+}
+
+// TelegramOutputConfig configures the Telegram output.
+type TelegramOutputConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Optional  bool          `mapstructure:"optional"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	Filter    string        `mapstructure:"filter"`
+	BotToken  string        `mapstructure:"bot_token"`
+	ChatID    string        `mapstructure:"chat_id"`
+	Digest    int           `mapstructure:"digest"`
+	Explorer  string        `mapstructure:"explorer"`
+	RateLimit float64       `mapstructure:"rate_limit"`
+}
+
+// S3OutputConfig configures the S3 archive output.
+type S3OutputConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Optional      bool          `mapstructure:"optional"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	Filter        string        `mapstructure:"filter"`
+	Bucket        string        `mapstructure:"bucket"`
+	Prefix        string        `mapstructure:"prefix"` // Key prefix template, e.g. "chain={{.Chain}}/date={{.Date}}"
+	Format        string        `mapstructure:"format"` // jsonl (default, gzipped) or parquet
+	FlushSize     int           `mapstructure:"flush_size"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	Region        string        `mapstructure:"region"`
+	// Endpoint and UsePathStyle target S3-compatible stores such as MinIO or R2
+	Endpoint     string `mapstructure:"endpoint"`
+	UsePathStyle bool   `mapstructure:"use_path_style"`
+	// Static credentials; the default AWS credential chain is used when empty
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+}
+
+// RetryConfig bounds the retries of the webhook output.
+type RetryConfig struct {
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+}
+
+// FilterConfig selects logs by contract and topics, and decodes them with an
+// ABI or event signatures.
+type FilterConfig struct {
+	Description string     `mapstructure:"description"`
+	Contracts   []string   `mapstructure:"contracts"`
+	Topics      [][]string `mapstructure:"topics"`
+	ABI         string     `mapstructure:"abi"`
+	Signatures  []string   `mapstructure:"signatures"` // Human-readable events, instead of abi
+	// Logs dropped after fetching, see scanner.Filter.ExcludedContracts
+	ExcludeContracts []string   `mapstructure:"exclude_contracts"`
+	ExcludeTopics    [][]string `mapstructure:"exclude_topics"`
+	// First block to scan per contract, see scanner.Filter.ContractStarts
+	ContractStarts map[string]uint64 `mapstructure:"contract_starts"`
+	// Keep one matching log in sample_rate, see scanner.Filter.SampleRate
+	SampleRate uint64 `mapstructure:"sample_rate"`
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -8,18 +10,54 @@ import (
 	"github.com/spf13/viper"
 )
 
-// Config represents the global configuration for the scanner application.
+// Config represents the global configuration for the scanner application:
+// the core sections and, in the same file, the application ones.
 type Config struct {
 	Project string           `mapstructure:"project"`
 	Log     LogConfig        `mapstructure:"log"`
 	Scanner ScannerConfig    `mapstructure:"scanner"`
 	RPC     []rpc.NodeConfig `mapstructure:"rpc_nodes"`
+	Storage StorageConfig    `mapstructure:"storage"`
+	Admin   AdminConfig      `mapstructure:"admin"`
+	DryRun  DryRunConfig     `mapstructure:"dry_run"`
+
+	// Scanners lists the chains scanned by the process, replacing the chain
+	// of the scanner, rpc_nodes and filters sections.
+	Scanners []ChainScanConfig `mapstructure:"scanners"`
+
+	AppConfig `mapstructure:",squash"`
+
+	resolved map[string]bool // Keys of the values resolved from references
 }
 
 // LogConfig holds configuration for application logging.
 type LogConfig struct {
 	Level  string `mapstructure:"level"`  // debug, info, warn, error
 	Format string `mapstructure:"format"` // text, json
+	File   string `mapstructure:"file"`   // Appended to instead of stderr, reopened on SIGHUP
+}
+
+// Validate checks the format.
+func (c LogConfig) Validate() error {
+	switch c.Format {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("log: unsupported format %q, use text or json", c.Format)
+}
+
+// AdminConfig enables the admin HTTP API of scanner-cli, see package admin.
+type AdminConfig struct {
+	Listen string `mapstructure:"listen"` // e.g. "127.0.0.1:8081", empty disables it
+	Token  string `mapstructure:"token"`  // Bearer token required by every request
+}
+
+// DryRunConfig makes scanner-cli count and preview the events instead of
+// delivering them to the outputs, without saving the cursors, see
+// sink.DryRunOutput.
+type DryRunConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Samples int  `mapstructure:"samples"` // Events printed per event name (default 0: all)
 }
 
 // ScannerConfig holds specific settings for the EVM scanning process.
@@ -37,14 +75,118 @@ type ScannerConfig struct {
 	Rewind       uint64 `mapstructure:"start_rewind"`  // If no saved cursor, start from Latest - Rewind
 	CursorRewind uint64 `mapstructure:"cursor_rewind"` // If saved cursor exists, start from Cursor - CursorRewind (safety buffer)
 
+	// StartStrategy: Pick the start explicitly: force, resume, rewind or genesis (default: the precedence above)
+	StartStrategy string `mapstructure:"start_strategy"`
+
+	// EndBlock: Stop once this block is scanned, e.g. for backfills (default 0: follow the chain)
+	EndBlock uint64 `mapstructure:"end_block"`
+
+	// TrackBlockHash: Save the last scanned block hash with the cursor and check it on restart
+	TrackBlockHash bool `mapstructure:"track_block_hash"`
+
+	// CursorFlushInterval: Write the cursor at most this often while catching up (default 2s, negative: every batch)
+	CursorFlushInterval time.Duration `mapstructure:"cursor_flush_interval"`
+
+	// StoreOutageLimit: Pause scanning once the cursor could not be saved for this long (default 0: keep scanning)
+	StoreOutageLimit time.Duration `mapstructure:"store_outage_limit"`
+
+	// CursorSaveRetries, CursorSaveBackoff: Retries of a failed cursor save and the first wait between them, doubled on each (default 2 after 100ms, negative: no retry)
+	CursorSaveRetries int           `mapstructure:"cursor_save_retries"`
+	CursorSaveBackoff time.Duration `mapstructure:"cursor_save_backoff"`
+
+	// MaxUnsavedBlocks: Blocks scanned past the last saved cursor before cursor_failure_policy applies (default 0: no limit)
+	MaxUnsavedBlocks uint64 `mapstructure:"max_unsaved_blocks"`
+	// CursorFailurePolicy: pause (default) until the cursor is saved, or stop the scanner with an error
+	CursorFailurePolicy string `mapstructure:"cursor_failure_policy"`
+
+	// PressureThreshold, PressureDelay: Wait before the next batch while an asynchronous output is this full, checking it every delay (default 0.8 and 100ms)
+	PressureThreshold float64       `mapstructure:"pressure_threshold"`
+	PressureDelay     time.Duration `mapstructure:"pressure_delay"`
+
 	UseBloom bool `mapstructure:"use_bloom"`
 
+	// MaxLogsRange: Most blocks asked per eth_getLogs request, longer batches are split (default 0: no limit)
+	MaxLogsRange uint64 `mapstructure:"max_logs_range"`
+
+	// Finality: How the safe head is found: confirmations (default), safe or finalized
+	Finality string `mapstructure:"finality"`
+
+	// DisableLogSort: Pass the logs of a batch in node order, without sorting them by block, tx and log index
+	DisableLogSort bool `mapstructure:"disable_log_sort"`
+
+	// BlockTimestamps: Fill the block timestamp of the logs from the block headers, one request per block with logs (default: only for outputs partitioning by date)
+	BlockTimestamps bool `mapstructure:"block_timestamps"`
+
 	// StoragePrefix: Prefix for storage layer (e.g., PG table prefix or Redis Key prefix)
 	StoragePrefix string `mapstructure:"storage_prefix"`
 }
 
-// Load reads and parses configuration from a YAML file and environment variables.
+// ChainScanConfig is a chain scanned along with the others of Config.Scanners,
+// into the shared cursor store and outputs.
+type ChainScanConfig struct {
+	ScannerConfig `mapstructure:",squash"` // chain_id and the scanner settings
+
+	RPC     []rpc.NodeConfig `mapstructure:"rpc_nodes"` // Default: the public endpoints of the chain preset
+	Filters []FilterConfig   `mapstructure:"filters"`
+	// Outputs replaces the shared outputs for the events of the chain
+	Outputs *OutputsConfig `mapstructure:"outputs"`
+}
+
+// ChainScans returns the chains to scan: the scanners list, or else the
+// chain of the scanner, rpc_nodes and filters sections.
+func (c *Config) ChainScans() []ChainScanConfig {
+	if len(c.Scanners) > 0 {
+		return c.Scanners
+	}
+	return []ChainScanConfig{{ScannerConfig: c.Scanner, RPC: c.RPC, Filters: c.Filters}}
+}
+
+// AllFilters returns the filters of every chain scanned.
+func (c *Config) AllFilters() []FilterConfig {
+	var filters []FilterConfig
+	for _, scan := range c.ChainScans() {
+		filters = append(filters, scan.Filters...)
+	}
+	return filters
+}
+
+// validateScanners checks that the scanners list is the only chain set, with
+// distinct chain ids: the cursors of the chains are saved by chain id.
+func (c *Config) validateScanners() error {
+	if len(c.Scanners) == 0 {
+		return nil
+	}
+	// The storage prefix is shared by the chains, it stays in the scanner section
+	if c.Scanner != (ScannerConfig{StoragePrefix: c.Scanner.StoragePrefix}) || len(c.RPC) > 0 || len(c.Filters) > 0 {
+		return errors.New("scanners: the scanner (but storage_prefix), rpc_nodes and filters sections cannot be set with scanners, set them in its entries")
+	}
+	seen := make(map[string]bool)
+	for i, scan := range c.Scanners {
+		switch {
+		case scan.ChainID == "":
+			return fmt.Errorf("scanners[%d]: chain_id is required", i)
+		case seen[scan.ChainID]:
+			return fmt.Errorf("scanners[%d]: chain %q is listed twice", i, scan.ChainID)
+		case scan.StoragePrefix != "":
+			return fmt.Errorf("scanners[%d]: storage_prefix is shared by the chains, set it in the scanner section", i)
+		}
+		seen[scan.ChainID] = true
+	}
+	return nil
+}
+
+// Load reads and parses configuration from a YAML file and environment
+// variables, e.g. SCANNER_SCANNER_BATCH_SIZE or SCANNER_OUTPUTS_WEBHOOK_URL.
+// String values may reference secrets, as ${PG_PASSWORD} or
+// file:///run/secrets/pg_password.
 func Load(path string) (*Config, error) {
+	return LoadFiles(path)
+}
+
+// LoadFiles is Load for a configuration split across files, read in order
+// with later files overriding the keys they repeat. It reads the legacy
+// layout of core settings in config.yaml and filters and outputs in app.yaml.
+func LoadFiles(path string, more ...string) (*Config, error) {
 	v := viper.New()
 	v.SetConfigFile(path)
 	v.SetEnvPrefix("SCANNER")
@@ -54,19 +196,31 @@ func Load(path string) (*Config, error) {
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
 	}
+	for _, p := range more {
+		v.SetConfigFile(p)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, err
+		}
+	}
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
-
-	// Set default values
-	if cfg.Scanner.BatchSize == 0 {
-		cfg.Scanner.BatchSize = 100
+	if err := cfg.resolveRefs(); err != nil {
+		return nil, err
 	}
-	if cfg.Scanner.Interval == 0 {
-		cfg.Scanner.Interval = 3 * time.Second
+	if err := cfg.validateScanners(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Storage.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Log.Validate(); err != nil {
+		return nil, err
 	}
 
+	// BatchSize and Interval are left unset: the chain preset, if any, or
+	// else scanner.New fills them
 	return &cfg, nil
 }
@@ -2,9 +2,11 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/84hero/evm-scanner/pkg/rpc"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,6 +21,8 @@ scanner:
 rpc_nodes:
   - url: "http://localhost:8545"
     priority: 1
+    rate_limit: 25
+    max_concurrent: 10
 `
 	tmpFile, err := os.CreateTemp("", "config_*.yaml")
 	assert.NoError(t, err)
@@ -33,6 +37,7 @@ rpc_nodes:
 	assert.Equal(t, "test-proj", cfg.Project)
 	assert.Equal(t, uint64(50), cfg.Scanner.BatchSize)
 	assert.Equal(t, 1*time.Second, cfg.Scanner.Interval)
+	assert.Equal(t, []rpc.NodeConfig{{URL: "http://localhost:8545", Priority: 1, RateLimit: 25, MaxConcurrent: 10}}, cfg.RPC)
 
 	// 2. File not found test
 	_, err = Load("non_existent_file.yaml")
@@ -66,9 +71,9 @@ scanner:
 	cfg, err := Load(tmpFile.Name())
 	assert.NoError(t, err)
 
-	// Verify default values (BatchSize=100, Interval=3s)
-	assert.Equal(t, uint64(100), cfg.Scanner.BatchSize)
-	assert.Equal(t, 3*time.Second, cfg.Scanner.Interval)
+	// Unset values stay zero, for chain.ApplyDefaults and scanner.New to fill
+	assert.Zero(t, cfg.Scanner.BatchSize)
+	assert.Zero(t, cfg.Scanner.Interval)
 }
 
 func TestLoad_EnvVars(t *testing.T) {
@@ -101,3 +106,141 @@ scanner:
 	assert.Equal(t, "env-project", cfg.Project)
 	assert.Equal(t, uint64(999), cfg.Scanner.BatchSize)
 }
+
+func TestLoadFiles_Migration(t *testing.T) {
+	legacy, err := LoadFiles("testdata/legacy_config.yaml", "testdata/legacy_app.yaml")
+	assert.NoError(t, err)
+	unified, err := Load("testdata/config.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, unified, legacy)
+
+	assert.Equal(t, "debug", unified.Log.Level)
+	assert.Equal(t, uint64(20), unified.Scanner.Confirmations)
+	assert.Equal(t, 25, unified.RPC[0].RateLimit)
+	if assert.Len(t, unified.Filters, 1) {
+		assert.Len(t, unified.Filters[0].Signatures, 1)
+	}
+	assert.Equal(t, "any", unified.Outputs.Policy)
+	assert.Equal(t, 5, unified.Outputs.Webhook.Retry.MaxAttempts)
+	assert.Equal(t, []EventTableConfig{{Event: "Transfer", Table: "transfers"}}, unified.Outputs.Postgres.EventTables)
+	assert.True(t, unified.Tokens.Lookup)
+	assert.Equal(t, "drop", unified.Decoding.OnError)
+	if assert.Len(t, unified.Chains, 1) {
+		assert.Equal(t, time.Second, unified.Chains[0].BlockTime)
+	}
+
+	// Core-only files still load, and a missing app file fails
+	core, err := Load("testdata/legacy_config.yaml")
+	assert.NoError(t, err)
+	assert.Empty(t, core.Filters)
+	_, err = LoadFiles("testdata/legacy_config.yaml", "testdata/missing.yaml")
+	assert.Error(t, err)
+}
+
+func TestLoadFiles_EnvVars(t *testing.T) {
+	t.Setenv("SCANNER_SCANNER_CONFIRMATIONS", "30")
+	t.Setenv("SCANNER_OUTPUTS_WEBHOOK_URL", "http://env/events")
+	t.Setenv("SCANNER_DECODING_ON_ERROR", "error")
+
+	legacy, err := LoadFiles("testdata/legacy_config.yaml", "testdata/legacy_app.yaml")
+	assert.NoError(t, err)
+	unified, err := Load("testdata/config.yaml")
+	assert.NoError(t, err)
+	for _, cfg := range []*Config{legacy, unified} {
+		assert.Equal(t, uint64(30), cfg.Scanner.Confirmations)
+		assert.Equal(t, "http://env/events", cfg.Outputs.Webhook.URL)
+		assert.Equal(t, "error", cfg.Decoding.OnError)
+	}
+}
+
+func TestLoad_Scanners(t *testing.T) {
+	load := func(content string) (*Config, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return Load(path)
+	}
+
+	cfg, err := load(`
+scanner: {storage_prefix: "idx_"}
+scanners:
+  - {chain_id: ethereum, batch_size: 50, filters: [{contracts: ["0x01"]}]}
+  - chain_id: base
+    rpc_nodes: [{url: "http://base:8545"}]
+    outputs: {console: {enabled: true}}
+`)
+	assert.NoError(t, err)
+	scans := cfg.ChainScans()
+	if assert.Len(t, scans, 2) {
+		assert.Equal(t, uint64(50), scans[0].BatchSize)
+		assert.Nil(t, scans[0].Outputs)
+		assert.Equal(t, "http://base:8545", scans[1].RPC[0].URL)
+		assert.True(t, scans[1].Outputs.Console.Enabled)
+	}
+	assert.Len(t, cfg.AllFilters(), 1)
+
+	// Without scanners, the chain of the scanner section is scanned
+	cfg, err = load(`{scanner: {chain_id: bsc, confirmations: 15}, filters: [{contracts: ["0x01"]}]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []ChainScanConfig{{ScannerConfig: cfg.Scanner, Filters: cfg.Filters}}, cfg.ChainScans())
+
+	_, err = load(`{scanner: {chain_id: bsc}, scanners: [{chain_id: base}]}`)
+	assert.ErrorContains(t, err, "cannot be set with scanners")
+	_, err = load(`{scanners: [{chain_id: base}, {chain_id: base}]}`)
+	assert.EqualError(t, err, `scanners[1]: chain "base" is listed twice`)
+	_, err = load(`{scanners: [{batch_size: 10}]}`)
+	assert.EqualError(t, err, "scanners[0]: chain_id is required")
+	_, err = load(`{scanners: [{chain_id: base, storage_prefix: "x_"}]}`)
+	assert.ErrorContains(t, err, "scanners[0]: storage_prefix is shared by the chains")
+}
+
+func TestLoad_Storage(t *testing.T) {
+	load := func(content string) (*Config, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return Load(path)
+	}
+
+	cfg, err := load(`
+storage:
+  type: postgres
+  fallback: memory
+  postgres: {url: "postgres://db/cursors", max_open_conns: 4, statement_timeout: 2s}
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, StorageConfig{
+		Type:     StoragePostgres,
+		Fallback: StorageMemory,
+		Postgres: PostgresStorageConfig{URL: "postgres://db/cursors", MaxOpenConns: 4, StatementTimeout: 2 * time.Second},
+	}, cfg.Storage)
+
+	cfg, err = load(`{storage: {type: redis, redis: {master_name: mymaster, sentinel_addrs: ["sentinel:26379"]}}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sentinel:26379"}, cfg.Storage.Redis.SentinelAddrs)
+
+	cfg, err = load(`{storage: {type: file, file: {path: cursors.json, flush_interval: 5s}}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, cfg.Storage.File.FlushInterval)
+
+	_, err = load(`{storage: {type: mongodb}}`)
+	assert.EqualError(t, err, `storage: unknown type "mongodb", use memory, postgres, redis, etcd, consul, sqlite or file`)
+	_, err = load(`{storage: {type: sqlite}}`)
+	assert.EqualError(t, err, "storage: type sqlite requires sqlite.path")
+	_, err = load(`{storage: {type: redis, redis: {master_name: mymaster}}}`)
+	assert.EqualError(t, err, "storage: type redis requires redis.addr, redis.sentinel_addrs or redis.cluster_addrs")
+	_, err = load(`{storage: {type: redis, redis: {addr: "redis:6379", master_name: mymaster}}}`)
+	assert.EqualError(t, err, "storage: redis master_name and sentinel_addrs must be set together")
+	_, err = load(`{storage: {type: etcd, etcd: {endpoints: ["etcd:2379"]}, fallback: file}}`)
+	assert.EqualError(t, err, "storage: fallback can only be memory")
+}
+
+func TestLoad_LogFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`{log: {format: json, file: /var/log/scanner.log}}`), 0o644))
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, LogConfig{Format: "json", File: "/var/log/scanner.log"}, cfg.Log)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{log: {format: logfmt}}`), 0o644))
+	_, err = Load(path)
+	assert.EqualError(t, err, `log: unsupported format "logfmt", use text or json`)
+}
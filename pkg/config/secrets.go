@@ -0,0 +1,245 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// References in string values, resolved by Load: ${VAR} is replaced by the
+// environment variable VAR ($${VAR} is a literal ${VAR}), and a value
+// file:///path by the content of the file, e.g. a Docker or Kubernetes secret.
+var envRef = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+const fileRef = "file://"
+
+// Redacted replaces secret values in the dump of String.
+const Redacted = "REDACTED"
+
+// secretKeys are the keys whose values String always redacts.
+var secretKeys = map[string]bool{
+	"password":          true,
+	"sentinel_password": true,
+	"secret":            true,
+	"secret_access_key": true,
+	"api_key":           true,
+	"bearer_token":      true,
+	"token":             true, // admin, consul
+	"bot_token":         true,
+	"webhook_url":       true, // Slack webhook URLs embed their token
+}
+
+// dsnPassword matches the password of a MySQL DSN, user:password@...
+var dsnPassword = regexp.MustCompile(`^([^:@/]*):([^@]*)@`)
+
+// resolveRefs replaces the references in the string fields of cfg and
+// records the keys of the values they were in, which String redacts. A
+// reference that cannot be resolved is an error naming its key.
+func (cfg *Config) resolveRefs() error {
+	resolved := make(map[string]bool)
+	errs := walkStrings(reflect.ValueOf(cfg).Elem(), "", func(key, s string) (string, error) {
+		out, err := resolveRef(s)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		if out != s {
+			resolved[key] = true
+		}
+		return out, nil
+	})
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if len(resolved) > 0 {
+		cfg.resolved = resolved
+	}
+	return nil
+}
+
+// resolveRef resolves the references of a single value.
+func resolveRef(s string) (string, error) {
+	var missing []string
+	s = envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		name := ref[2 : len(ref)-1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	if path, ok := strings.CutPrefix(s, fileRef); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("secret file: %w", err)
+		}
+		s = strings.TrimRight(string(data), "\r\n")
+	}
+	return s, nil
+}
+
+// walkStrings replaces every string reachable from v with fn of its key, the
+// dotted path of mapstructure names, e.g. "outputs.kafka.password". It
+// returns the errors of fn, leaving the strings they failed on unchanged.
+func walkStrings(v reflect.Value, key string, fn func(key, s string) (string, error)) []error {
+	var errs []error
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			errs = walkStrings(v.Elem(), key, fn)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			if f := t.Field(i); f.IsExported() {
+				errs = append(errs, walkStrings(v.Field(i), fieldKey(key, f), fn)...)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			errs = append(errs, walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", key, i), fn)...)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			break
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			s, err := fn(key+"."+iter.Key().String(), iter.Value().String())
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(s).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		s, err := fn(key, v.String())
+		if err != nil {
+			return []error{err}
+		}
+		if v.CanSet() {
+			v.SetString(s)
+		}
+	}
+	return errs
+}
+
+// fieldKey returns the key of field f of the struct at key.
+func fieldKey(key string, f reflect.StructField) string {
+	name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+	switch {
+	case opts == "squash":
+		return key
+	case name == "":
+		name = strings.ToLower(f.Name)
+	}
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// String dumps the configuration as JSON, without its unset values and with
+// its secrets redacted: the values of secret keys, the values resolved from
+// references and the passwords of URLs and DSNs.
+func (cfg Config) String() string {
+	data, err := json.Marshal(dump(reflect.ValueOf(cfg), "", cfg.resolved))
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(data)
+}
+
+// LogValue logs the configuration as String, for the handlers that would
+// otherwise log its fields.
+func (cfg Config) LogValue() slog.Value {
+	return slog.StringValue(cfg.String())
+}
+
+// dump returns v as maps, slices and values, nil when unset.
+func dump(v reflect.Value, key string, resolved map[string]bool) any {
+	if !v.IsValid() || v.IsZero() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		return dump(v.Elem(), key, resolved)
+	case reflect.Struct:
+		fields := make(map[string]any)
+		dumpFields(v, key, resolved, fields)
+		if len(fields) == 0 {
+			return nil
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		items := make([]any, v.Len())
+		for i := range v.Len() {
+			items[i] = dump(v.Index(i), fmt.Sprintf("%s[%d]", key, i), resolved)
+		}
+		return items
+	case reflect.Map:
+		entries := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k := fmt.Sprint(iter.Key().Interface())
+			entries[k] = dump(iter.Value(), key+"."+k, resolved)
+		}
+		return entries
+	case reflect.String:
+		return redact(key, v.String(), resolved)
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	return v.Interface()
+}
+
+// dumpFields adds the set fields of the struct v to fields, those of its
+// squashed structs included.
+func dumpFields(v reflect.Value, key string, resolved map[string]bool, fields map[string]any) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fkey := fieldKey(key, f)
+		if fkey == key && f.Type.Kind() == reflect.Struct {
+			dumpFields(v.Field(i), key, resolved, fields)
+			continue
+		}
+		if d := dump(v.Field(i), fkey, resolved); d != nil {
+			fields[fkey[strings.LastIndex(fkey, ".")+1:]] = d
+		}
+	}
+}
+
+// redact returns the value s of key as String dumps it.
+func redact(key, s string, resolved map[string]bool) string {
+	parts := strings.Split(key, ".")
+	header := len(parts) > 1 && parts[len(parts)-2] == "headers" // e.g. Authorization
+	switch {
+	case resolved[key] || secretKeys[parts[len(parts)-1]] || header:
+		return Redacted
+	case dsnPassword.MatchString(s) && !strings.Contains(s, "://"):
+		return dsnPassword.ReplaceAllString(s, "$1:"+Redacted+"@")
+	}
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), Redacted)
+			return u.String()
+		}
+	}
+	return s
+}
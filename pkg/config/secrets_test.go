@@ -0,0 +1,83 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSecretsConfig writes content to a config file in dir.
+func writeSecretsConfig(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoad_SecretRefs(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "kafka_password")
+	assert.NoError(t, os.WriteFile(secret, []byte("s3cr3t\n"), 0o600))
+	t.Setenv("TEST_PG_PASSWORD", "pg-pass")
+	t.Setenv("TEST_BEARER", "bearer-token")
+
+	cfg, err := Load(writeSecretsConfig(t, dir, `
+project: "secrets"
+outputs:
+  postgres: {enabled: true, url: "postgres://scanner:${TEST_PG_PASSWORD}@db:5432/events"}
+  kafka: {enabled: true, brokers: ["kafka:9092"], password: "file://`+secret+`"}
+  webhook: {url: "https://hooks.example/$${path}", headers: {Authorization: "Bearer ${TEST_BEARER}"}}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://scanner:pg-pass@db:5432/events", cfg.Outputs.Postgres.URL)
+	assert.Equal(t, "s3cr3t", cfg.Outputs.Kafka.Password)
+	assert.Equal(t, "https://hooks.example/${path}", cfg.Outputs.Webhook.URL)
+	assert.Equal(t, "Bearer bearer-token", cfg.Outputs.Webhook.Headers["authorization"])
+}
+
+func TestLoad_MissingSecretRefs(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Load(writeSecretsConfig(t, dir, `
+outputs:
+  postgres: {url: "postgres://scanner:${TEST_MISSING_PASSWORD}@db/events"}
+  redis: {password: "file://`+filepath.Join(dir, "missing")+`"}
+rpc_nodes: [{url: "https://node.example/${TEST_MISSING_KEY}"}]
+`))
+	assert.ErrorContains(t, err, "outputs.postgres.url: environment variable TEST_MISSING_PASSWORD is not set")
+	assert.ErrorContains(t, err, "outputs.redis.password: secret file: open ")
+	assert.ErrorContains(t, err, "rpc_nodes[0].url: environment variable TEST_MISSING_KEY is not set")
+}
+
+func TestConfig_String(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_RPC_KEY", "rpc-key")
+	cfg, err := Load(writeSecretsConfig(t, dir, `
+project: "dump"
+scanner: {chain_id: "ethereum", interval: 2s}
+rpc_nodes: [{url: "https://node.example/${TEST_RPC_KEY}", priority: 1}]
+outputs:
+  postgres: {enabled: true, url: "postgres://scanner:pg-pass@db/events"}
+  mysql: {dsn: "scanner:my-pass@tcp(db:3306)/events"}
+  redis: {addr: "redis:6379", password: "redis-pass"}
+  webhook: {url: "https://hooks.example", secret: "hmac-key", headers: {X-Api-Key: "header-key"}}
+  slack: {webhook_url: "https://hooks.slack.com/services/T0/B0/slack-token"}
+`))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	log.NewLogger(log.NewTerminalHandler(&buf, false)).Info("Configuration loaded", "config", cfg)
+	for _, dump := range []string{cfg.String(), buf.String()} {
+		for _, secret := range []string{"rpc-key", "pg-pass", "my-pass", "redis-pass", "hmac-key", "header-key", "slack-token"} {
+			assert.NotContains(t, dump, secret)
+		}
+		assert.Contains(t, dump, "dump")
+		assert.Contains(t, dump, "redis:6379")
+	}
+	assert.Contains(t, cfg.String(), `"interval":"2s"`)
+	assert.Contains(t, cfg.String(), `"url":"postgres://scanner:REDACTED@db/events"`)
+	assert.Contains(t, cfg.String(), `"dsn":"scanner:REDACTED@tcp(db:3306)/events"`)
+	assert.Contains(t, cfg.String(), `"rpc_nodes":[{"priority":1,"url":"REDACTED"}]`)
+}
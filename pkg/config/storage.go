@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/redisconfig"
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
+)
+
+// Cursor store types of StorageConfig.
+const (
+	StorageMemory   = "memory"
+	StoragePostgres = "postgres"
+	StorageRedis    = "redis"
+	StorageEtcd     = "etcd"
+	StorageConsul   = "consul"
+	StorageSQLite   = "sqlite"
+	StorageFile     = "file"
+)
+
+// StorageConfig selects the cursor store of the scanners, keyed by
+// scanner.storage_prefix, with the connection settings of its type.
+type StorageConfig struct {
+	Type string `mapstructure:"type"` // memory (default), postgres, redis, etcd, consul, sqlite or file
+
+	// Fallback: memory scans from a memory store, losing the cursors on exit,
+	// when the store cannot be opened. Default "": fail to start.
+	Fallback string `mapstructure:"fallback"`
+
+	Postgres PostgresStorageConfig `mapstructure:"postgres"`
+	Redis    redisconfig.Config    `mapstructure:"redis"`
+	Etcd     EtcdStorageConfig     `mapstructure:"etcd"`
+	Consul   ConsulStorageConfig   `mapstructure:"consul"`
+	SQLite   SQLiteStorageConfig   `mapstructure:"sqlite"`
+	File     FileStorageConfig     `mapstructure:"file"`
+}
+
+// PostgresStorageConfig configures the postgres cursor store.
+type PostgresStorageConfig struct {
+	URL              string        `mapstructure:"url"`
+	MaxOpenConns     int           `mapstructure:"max_open_conns"`
+	MaxIdleConns     int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime  time.Duration `mapstructure:"conn_max_lifetime"`
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"` // Default 5s
+}
+
+// EtcdStorageConfig configures the etcd cursor store.
+type EtcdStorageConfig struct {
+	Endpoints []string         `mapstructure:"endpoints"`
+	Username  string           `mapstructure:"username"`
+	Password  string           `mapstructure:"password"`
+	TLS       tlsconfig.Config `mapstructure:"tls"`
+}
+
+// ConsulStorageConfig configures the Consul KV cursor store.
+type ConsulStorageConfig struct {
+	Addr       string `mapstructure:"addr"` // HTTP API address, e.g. "localhost:8500"
+	Token      string `mapstructure:"token"`
+	Datacenter string `mapstructure:"datacenter"`
+}
+
+// SQLiteStorageConfig configures the SQLite cursor store.
+type SQLiteStorageConfig struct {
+	Path string `mapstructure:"path"`
+}
+
+// FileStorageConfig configures the JSON file cursor store.
+type FileStorageConfig struct {
+	Path string `mapstructure:"path"`
+	// FlushInterval batches writes, rescanning up to this interval after a crash (default 0: every save)
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+// Validate checks that the type is known and its connection is set.
+func (c StorageConfig) Validate() error {
+	var missing string
+	switch c.Type {
+	case "", StorageMemory:
+	case StoragePostgres:
+		if c.Postgres.URL == "" {
+			missing = "postgres.url"
+		}
+	case StorageRedis:
+		if c.Redis.Addr == "" && len(c.Redis.SentinelAddrs) == 0 && len(c.Redis.ClusterAddrs) == 0 {
+			missing = "redis.addr, redis.sentinel_addrs or redis.cluster_addrs"
+		} else if err := c.Redis.Validate(); err != nil {
+			return fmt.Errorf("storage: %w", err)
+		}
+	case StorageEtcd:
+		if len(c.Etcd.Endpoints) == 0 {
+			missing = "etcd.endpoints"
+		}
+	case StorageConsul:
+		if c.Consul.Addr == "" {
+			missing = "consul.addr"
+		}
+	case StorageSQLite:
+		if c.SQLite.Path == "" {
+			missing = "sqlite.path"
+		}
+	case StorageFile:
+		if c.File.Path == "" {
+			missing = "file.path"
+		}
+	default:
+		return fmt.Errorf("storage: unknown type %q, use memory, postgres, redis, etcd, consul, sqlite or file", c.Type)
+	}
+	if missing != "" {
+		return fmt.Errorf("storage: type %s requires %s", c.Type, missing)
+	}
+	if c.Fallback != "" && c.Fallback != StorageMemory {
+		return errors.New("storage: fallback can only be memory")
+	}
+	return nil
+}
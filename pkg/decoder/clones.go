@@ -0,0 +1,149 @@
+package decoder
+
+import (
+	"context"
+	"encoding/binary"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// CodeReader reads contract code, implemented by rpc.Client.
+type CodeReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// CodeHashStore keeps the code hashes of contracts across restarts. It is the
+// cursor part of storage.Persistence, which so serves as one.
+type CodeHashStore interface {
+	LoadCursor(ctx context.Context, key string) (uint64, error)
+	SaveCursor(ctx context.Context, key string, height uint64) error
+}
+
+// addressRule applies an ABI to the contracts matching a predicate or a code hash.
+type addressRule struct {
+	predicate func(common.Address) bool
+	codeHash  uint64 // Prefix of the code hash, when there is no predicate
+	abi       *ABIWrapper
+}
+
+func (rule addressRule) matches(address common.Address, codeHash uint64) bool {
+	if rule.predicate != nil {
+		return rule.predicate(address)
+	}
+	return codeHash != 0 && codeHash == rule.codeHash
+}
+
+// codeHashPrefix shortens a code hash to the 64 bits a CodeHashStore holds,
+// still far too many to match another code by chance.
+func codeHashPrefix(hash common.Hash) uint64 {
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
+// MinimalProxyCodeHash returns the code hash of the EIP-1167 minimal proxies,
+// or clones, of implementation, which all share it.
+func MinimalProxyCodeHash(implementation common.Address) common.Hash {
+	code := make([]byte, 0, 45)
+	code = append(code, common.FromHex("0x363d3d373d3d3d363d73")...)
+	code = append(code, implementation.Bytes()...)
+	code = append(code, common.FromHex("0x5af43d82803e903d91602b57fd5bf3")...)
+	return crypto.Keccak256Hash(code)
+}
+
+// RegisterForAddressPredicate registers the events of a JSON ABI for the
+// contracts match accepts. match must be cheap and safe for concurrent use.
+func (r *Registry) RegisterForAddressPredicate(match func(common.Address) bool, jsonStr string) error {
+	w, err := NewFromJSON(jsonStr)
+	if err != nil {
+		return err
+	}
+	r.addRule(addressRule{predicate: match, abi: w})
+	return nil
+}
+
+// RegisterForCodeHash registers the events of a JSON ABI for the contracts
+// whose code hashes to codeHash, e.g. the clones of an implementation, see
+// MinimalProxyCodeHash. It requires a code reader, see SetCodeReader.
+func (r *Registry) RegisterForCodeHash(codeHash common.Hash, jsonStr string) error {
+	w, err := NewFromJSON(jsonStr)
+	if err != nil {
+		return err
+	}
+	r.addRule(addressRule{codeHash: codeHashPrefix(codeHash), abi: w})
+	return nil
+}
+
+func (r *Registry) addRule(rule addressRule) {
+	r.abisMu.Lock()
+	defer r.abisMu.Unlock()
+	r.rules = append(r.rules, rule)
+}
+
+// SetCodeReader makes Decode read the code of the contracts it needs the code
+// hash of once, keeping it in store if not nil. Set it before decoding.
+func (r *Registry) SetCodeReader(reader CodeReader, store CodeHashStore) {
+	r.code = reader
+	r.codeStore = store
+}
+
+// codeHashFor returns the code hash prefix of the contract of log if a code
+// hash rule could decode it, 0 otherwise or if it cannot be read.
+func (r *Registry) codeHashFor(l types.Log) uint64 {
+	if r.code == nil || !r.needsCodeHash(l) {
+		return 0
+	}
+	r.codeMu.Lock()
+	defer r.codeMu.Unlock()
+	if hash, ok := r.codeHashes[l.Address]; ok {
+		return hash
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	key := "codehash:" + l.Address.Hex()
+	if r.codeStore != nil {
+		if hash, err := r.codeStore.LoadCursor(ctx, key); err != nil {
+			log.Warn("Failed to load code hash", "address", l.Address, "err", err)
+		} else if hash != 0 {
+			r.codeHashes[l.Address] = hash
+			return hash
+		}
+	}
+	code, err := r.code.CodeAt(ctx, l.Address, nil)
+	if err != nil {
+		log.Warn("Failed to read contract code", "address", l.Address, "err", err)
+		return 0
+	}
+	hash := codeHashPrefix(crypto.Keccak256Hash(code))
+	r.codeHashes[l.Address] = hash
+	if r.codeStore != nil {
+		if err := r.codeStore.SaveCursor(ctx, key, hash); err != nil {
+			log.Warn("Failed to save code hash", "address", l.Address, "err", err)
+		}
+	}
+	return hash
+}
+
+// needsCodeHash reports whether a code hash rule has an event log could be.
+func (r *Registry) needsCodeHash(l types.Log) bool {
+	r.abisMu.RLock()
+	defer r.abisMu.RUnlock()
+	for _, rule := range r.rules {
+		if rule.predicate != nil {
+			continue
+		}
+		if len(rule.abi.anonymous) > 0 {
+			return true
+		}
+		if len(l.Topics) > 0 {
+			if _, ok := rule.abi.layouts[l.Topics[0]]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package decoder
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+const vaultABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"user","type":"address"},{"indexed":false,"name":"amount","type":"uint256"}],"name":"Deposit","type":"event"}]`
+
+var (
+	vaultImpl = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	clone1    = common.HexToAddress("0xc100000000000000000000000000000000000001")
+	clone2    = common.HexToAddress("0xc200000000000000000000000000000000000002")
+	impostor  = common.HexToAddress("0xbad0000000000000000000000000000000000bad")
+)
+
+func cloneCode(implementation common.Address) []byte {
+	return append(append(common.FromHex("0x363d3d373d3d3d363d73"), implementation.Bytes()...), common.FromHex("0x5af43d82803e903d91602b57fd5bf3")...)
+}
+
+// codeReader serves the code of two clones of vaultImpl and of an impostor
+// cloning another implementation.
+type codeReader struct {
+	mu    sync.Mutex
+	calls map[common.Address]int
+	err   error
+}
+
+func (c *codeReader) CodeAt(_ context.Context, account common.Address, _ *big.Int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[common.Address]int)
+	}
+	c.calls[account]++
+	if c.err != nil {
+		return nil, c.err
+	}
+	if account == impostor {
+		return cloneCode(sender), nil
+	}
+	return cloneCode(vaultImpl), nil
+}
+
+// memoryCodeStore is a CodeHashStore in memory.
+type memoryCodeStore map[string]uint64
+
+func (m memoryCodeStore) LoadCursor(_ context.Context, key string) (uint64, error) {
+	return m[key], nil
+}
+
+func (m memoryCodeStore) SaveCursor(_ context.Context, key string, height uint64) error {
+	m[key] = height
+	return nil
+}
+
+func depositLog(address common.Address) types.Log {
+	return types.Log{
+		Address: address,
+		Topics:  []common.Hash{crypto.Keccak256Hash([]byte("Deposit(address,uint256)")), common.BytesToHash(sender.Bytes())},
+		Data:    common.LeftPadBytes(big.NewInt(100).Bytes(), 32),
+	}
+}
+
+func TestRegistry_CodeHash(t *testing.T) {
+	assert.Equal(t, crypto.Keccak256Hash(cloneCode(vaultImpl)), MinimalProxyCodeHash(vaultImpl))
+
+	reader := &codeReader{}
+	store := memoryCodeStore{}
+	r := NewRegistry()
+	r.SetCodeReader(reader, store)
+	assert.NoError(t, r.RegisterForCodeHash(MinimalProxyCodeHash(vaultImpl), vaultABI))
+	assert.NoError(t, r.AddABI(erc20TransferABI))
+
+	for _, clone := range []common.Address{clone1, clone2, clone1} {
+		decoded, err := r.Decode(depositLog(clone))
+		assert.NoError(t, err)
+		assert.Equal(t, "Deposit", decoded.Name)
+		assert.Equal(t, big.NewInt(100), decoded.Inputs["amount"])
+	}
+	_, err := r.Decode(depositLog(impostor))
+	assert.ErrorContains(t, err, "not found in registry")
+
+	// Code is read once per contract, and only for events of code hash rules
+	_, err = r.Decode(types.Log{Address: sender, Topics: []common.Hash{transferID, {}, {}}, Data: make([]byte, 32)})
+	assert.NoError(t, err)
+	assert.Equal(t, map[common.Address]int{clone1: 1, clone2: 1, impostor: 1}, reader.calls)
+	assert.Len(t, store, 3)
+	assert.Contains(t, r.Topics(), crypto.Keccak256Hash([]byte("Deposit(address,uint256)")))
+
+	// Batches resolve the rules too
+	results, errs := r.DecodeBatch([]types.Log{depositLog(clone2), depositLog(impostor)})
+	assert.Equal(t, "Deposit", results[0].Name)
+	assert.Len(t, errs, 1)
+
+	// Code hashes are kept in the store across restarts, and contracts whose
+	// code cannot be read stay undecoded
+	offline := &codeReader{err: errors.New("connection refused")}
+	r = NewRegistry()
+	r.SetCodeReader(offline, store)
+	assert.NoError(t, r.RegisterForCodeHash(MinimalProxyCodeHash(vaultImpl), vaultABI))
+	_, err = r.Decode(depositLog(clone1))
+	assert.NoError(t, err)
+	_, err = r.Decode(depositLog(common.HexToAddress("0xc3")))
+	assert.ErrorContains(t, err, "not found in registry")
+	assert.Equal(t, map[common.Address]int{common.HexToAddress("0xc3"): 1}, offline.calls)
+}
+
+func TestRegistry_AddressPredicate(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.RegisterForAddressPredicate(func(a common.Address) bool { return a == clone1 || a == clone2 }, vaultABI))
+	assert.Error(t, r.RegisterForAddressPredicate(func(common.Address) bool { return true }, "invalid json"))
+
+	decoded, err := r.Decode(depositLog(clone2))
+	assert.NoError(t, err)
+	assert.Equal(t, sender, decoded.Inputs["user"])
+	_, err = r.Decode(depositLog(impostor))
+	assert.ErrorContains(t, err, "not found in registry")
+}
@@ -1,16 +1,26 @@
 package decoder
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
+// ErrUnknownEvent is wrapped by the errors of the logs no known event
+// matches, as opposed to those of known events that failed to decode.
+var ErrUnknownEvent = errors.New("event signature not found")
+
 // ABIWrapper wraps the decoding logic using go-ethereum's ABI parser.
 type ABIWrapper struct {
 	parsedABI abi.ABI
+	layouts   map[common.Hash]*eventLayout // Events by topic0, without the anonymous ones
+	anonymous []*eventLayout               // Sorted by name
 }
 
 // NewFromJSON creates a decoder from a JSON ABI string
@@ -19,57 +29,280 @@ func NewFromJSON(jsonStr string) (*ABIWrapper, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ABIWrapper{parsedABI: parsed}, nil
+	return newABIWrapper(parsed), nil
+}
+
+func newABIWrapper(parsed abi.ABI) *ABIWrapper {
+	w := &ABIWrapper{parsedABI: parsed, layouts: make(map[common.Hash]*eventLayout)}
+	for _, event := range parsed.Events {
+		if event.Anonymous {
+			w.anonymous = append(w.anonymous, newEventLayout(event))
+		} else {
+			w.layouts[event.ID] = newEventLayout(event)
+		}
+	}
+	sort.Slice(w.anonymous, func(i, j int) bool { return w.anonymous[i].event.Name < w.anonymous[j].event.Name })
+	return w
 }
 
 // DecodedLog contains parsed human-readable data from a transaction log.
 type DecodedLog struct {
-	Name   string                 // Event name (e.g., Transfer)
-	Inputs map[string]interface{} // Parameter key-value pairs (e.g., from: 0x..., value: 100)
+	Name string // Event name (e.g., Transfer)
+	// Parameter key-value pairs (e.g., from: 0x..., value: 100). Indexed string,
+	// bytes, array and tuple parameters are IndexedHash values.
+	Inputs map[string]interface{}
+	// Heuristic is set when the log was decoded from a resolved text signature
+	// rather than an ABI: inputs are named arg0, arg1... and the leading ones
+	// assumed to be the indexed ones.
+	Heuristic bool `json:",omitempty"`
+}
+
+// IndexedHash is the value of an indexed string, bytes, array or tuple
+// parameter. Its topic holds the keccak256 hash of the value, which cannot be
+// decoded back; compare it with crypto.Keccak256Hash of a known value instead.
+type IndexedHash common.Hash
+
+// Hex returns the 0x-prefixed hash.
+func (h IndexedHash) Hex() string {
+	return common.Hash(h).Hex()
+}
+
+func (h IndexedHash) String() string {
+	return h.Hex()
 }
 
-// Decode parses a single Log
+// MarshalText encodes the hash as hex.
+func (h IndexedHash) MarshalText() ([]byte, error) {
+	return []byte(h.Hex()), nil
+}
+
+// Decode parses a single Log. Logs whose topic0 matches no event are decoded
+// as the anonymous event of the ABI whose indexed and data parameters they fit,
+// if there is exactly one.
 func (w *ABIWrapper) Decode(log types.Log) (*DecodedLog, error) {
-	if len(log.Topics) == 0 {
-		return nil, fmt.Errorf("log has no topics")
+	layout, topics, err := w.eventFor(log)
+	if err != nil {
+		return nil, err
 	}
+	return layout.decode(topics, log.Data)
+}
 
-	// 1. Find the Event definition in ABI based on Topic[0] (Event Signature)
-	event, err := w.parsedABI.EventByID(log.Topics[0])
+// DecodeReuse is Decode storing the result in dst, whose Inputs map is
+// cleared and reused, so that decoding a stream of logs allocates less. The
+// previous inputs are lost: callers must be done with them.
+func (w *ABIWrapper) DecodeReuse(log types.Log, dst *DecodedLog) error {
+	layout, topics, err := w.eventFor(log)
 	if err != nil {
-		return nil, fmt.Errorf("event signature not found in ABI")
+		return err
+	}
+	if dst.Inputs == nil {
+		dst.Inputs = make(map[string]interface{}, len(layout.event.Inputs))
+	} else {
+		clear(dst.Inputs)
+	}
+	dst.Name, dst.Heuristic = layout.event.Name, false
+	return layout.decodeInto(dst.Inputs, topics, log.Data)
+}
+
+// eventFor returns the layout of the event log is an instance of, along with
+// the topics of its indexed parameters.
+func (w *ABIWrapper) eventFor(log types.Log) (*eventLayout, []common.Hash, error) {
+	// 1. Find the Event definition in ABI based on Topic[0] (Event Signature)
+	if len(log.Topics) > 0 {
+		if layout, ok := w.layouts[log.Topics[0]]; ok {
+			return layout, log.Topics[1:], nil
+		}
+	}
+	if layout, err := w.anonymousEvent(log); layout != nil || err != nil {
+		return layout, log.Topics, err
 	}
+	if len(log.Topics) == 0 {
+		return nil, nil, fmt.Errorf("log has no topics: %w", ErrUnknownEvent)
+	}
+	return nil, nil, fmt.Errorf("%w in ABI", ErrUnknownEvent)
+}
 
-	result := &DecodedLog{
-		Name:   event.Name,
-		Inputs: make(map[string]interface{}),
+// decodeAnonymous decodes log as the only anonymous event it fits. It returns
+// nil and no error if none does.
+func (w *ABIWrapper) decodeAnonymous(log types.Log) (*DecodedLog, error) {
+	layout, err := w.anonymousEvent(log)
+	if layout == nil || err != nil {
+		return nil, err
 	}
+	return layout.decode(log.Topics, log.Data)
+}
 
-	// 2. Parse Data (non-indexed parameters)
-	if len(log.Data) > 0 {
-		if err := w.parsedABI.UnpackIntoMap(result.Inputs, event.Name, log.Data); err != nil {
-			return nil, err
+// anonymousEvent returns the layout of the only anonymous event log fits, nil
+// if there is none.
+func (w *ABIWrapper) anonymousEvent(log types.Log) (*eventLayout, error) {
+	var matches []*eventLayout
+	for _, layout := range w.anonymous {
+		if fitsEvent(layout.event, log.Topics, log.Data) {
+			matches = append(matches, layout)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, layout := range matches {
+			names[i] = layout.event.String()
 		}
+		return nil, fmt.Errorf("log fits several anonymous events: %s", strings.Join(names, "; "))
 	}
+}
 
-	// 3. Parse Topics (indexed parameters)
-	// Iterate through arguments to find indexed ones
-	var indexedArgs abi.Arguments
+// fitsEvent reports whether event has one indexed parameter per topic, without
+// the signature topic, and its data parameters re-encode to exactly data.
+func fitsEvent(event abi.Event, topics []common.Hash, data []byte) bool {
+	indexed := 0
 	for _, arg := range event.Inputs {
 		if arg.Indexed {
-			indexedArgs = append(indexedArgs, arg)
+			indexed++
 		}
 	}
+	if indexed != len(topics) {
+		return false
+	}
+	args := event.Inputs.NonIndexed()
+	values, err := args.Unpack(data)
+	if err != nil {
+		return false
+	}
+	packed, err := args.Pack(values...)
+	return err == nil && bytes.Equal(packed, data)
+}
 
-	// Validate topics count (Topics[0] is signature, subsequent ones are indexed parameters)
-	if len(log.Topics)-1 != len(indexedArgs) {
-		return nil, fmt.Errorf("topic count mismatch: expected %d, got %d", len(indexedArgs), len(log.Topics)-1)
+// decodeEvent decodes the indexed parameters of event from topics, without
+// the signature topic, and the others from data.
+func decodeEvent(event abi.Event, topics []common.Hash, data []byte) (*DecodedLog, error) {
+	return newEventLayout(event).decode(topics, data)
+}
+
+// eventLayout is where the parameters of an event are found in a log, worked
+// out once to decode many logs of the event.
+type eventLayout struct {
+	event      abi.Event
+	nonIndexed abi.Arguments
+	// wordData is set when every data parameter is a single word read in place
+	wordData bool
+	topics   int           // Indexed parameters, without the signature topic
+	indexed  abi.Arguments // in order
+}
+
+func newEventLayout(event abi.Event) *eventLayout {
+	l := &eventLayout{event: event, nonIndexed: event.Inputs.NonIndexed(), wordData: true}
+	for _, arg := range l.nonIndexed {
+		l.wordData = l.wordData && isWord(arg.Type)
+	}
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			l.indexed = append(l.indexed, arg)
+			l.topics++
+		}
 	}
+	return l
+}
 
-	// Parse indexed parameters one by one
-	if err := abi.ParseTopicsIntoMap(result.Inputs, indexedArgs, log.Topics[1:]); err != nil {
+func (l *eventLayout) decode(topics []common.Hash, data []byte) (*DecodedLog, error) {
+	result := &DecodedLog{
+		Name:   l.event.Name,
+		Inputs: make(map[string]interface{}, len(l.event.Inputs)),
+	}
+	if err := l.decodeInto(result.Inputs, topics, data); err != nil {
 		return nil, err
 	}
-
 	return result, nil
 }
+
+func (l *eventLayout) decodeInto(inputs map[string]interface{}, topics []common.Hash, data []byte) error {
+	// Parse Data (non-indexed parameters)
+	if len(data) > 0 {
+		if err := l.unpackData(inputs, data); err != nil {
+			return err
+		}
+	}
+
+	// Validate topics count (Topics[0] is signature, subsequent ones are indexed parameters)
+	if len(topics) != l.topics {
+		return fmt.Errorf("topic count mismatch for %s: expected %d indexed topics, got %d", l.event.String(), l.topics, len(topics))
+	}
+
+	// Parse indexed parameters; dynamic ones are only hashes
+	for i, arg := range l.indexed {
+		switch {
+		case arg.Type.T == abi.StringTy || arg.Type.T == abi.BytesTy || arg.Type.T == abi.SliceTy || arg.Type.T == abi.ArrayTy || arg.Type.T == abi.TupleTy:
+			inputs[arg.Name] = IndexedHash(topics[i])
+		case isWord(arg.Type):
+			value, err := readWord(arg.Type, topics[i][:])
+			if err != nil {
+				return err
+			}
+			inputs[arg.Name] = value
+		default:
+			if err := abi.ParseTopicsIntoMap(inputs, abi.Arguments{arg}, topics[i:i+1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unpackData decodes the non-indexed parameters as abi.Arguments.UnpackIntoMap
+// does, reading single-word parameters in place.
+func (l *eventLayout) unpackData(inputs map[string]interface{}, data []byte) error {
+	if !l.wordData {
+		return l.nonIndexed.UnpackIntoMap(inputs, data)
+	}
+	for i, arg := range l.nonIndexed {
+		offset := i * 32
+		if offset+32 > len(data) {
+			return fmt.Errorf("abi: cannot marshal in to go type: length insufficient %d require %d", len(data), offset+32)
+		}
+		value, err := readWord(arg.Type, data[offset:offset+32])
+		if err != nil {
+			return err
+		}
+		inputs[arg.Name] = value
+	}
+	return nil
+}
+
+// isWord reports whether values of t are encoded in a single word.
+func isWord(t abi.Type) bool {
+	switch t.T {
+	case abi.IntTy, abi.UintTy, abi.BoolTy, abi.AddressTy, abi.FixedBytesTy:
+		return true
+	}
+	return false
+}
+
+// readWord decodes a value of a single-word type as go-ethereum does.
+func readWord(t abi.Type, word []byte) (interface{}, error) {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		return abi.ReadInteger(t, word)
+	case abi.BoolTy:
+		for _, b := range word[:31] {
+			if b != 0 {
+				return nil, errBadBool
+			}
+		}
+		switch word[31] {
+		case 0:
+			return false, nil
+		case 1:
+			return true, nil
+		}
+		return nil, errBadBool
+	case abi.AddressTy:
+		return common.BytesToAddress(word), nil
+	default:
+		return abi.ReadFixedBytes(t, word)
+	}
+}
+
+var errBadBool = errors.New("abi: improperly encoded boolean value")
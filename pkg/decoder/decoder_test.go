@@ -83,4 +83,207 @@ func TestDecode_ErrorCases(t *testing.T) {
 	_, err = d2.Decode(types.Log{Topics: []common.Hash{event.ID}}) // Missing indexed topic
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "topic count mismatch")
+	assert.Contains(t, err.Error(), "event Event(address indexed a): expected 1 indexed topics, got 0")
+}
+
+// MakerDAO's LogNote: four indexed topics and no event signature
+const logNoteABI = `[{"anonymous":true,"inputs":[{"indexed":true,"name":"sig","type":"bytes4"},{"indexed":true,"name":"guy","type":"address"},{"indexed":true,"name":"foo","type":"bytes32"},{"indexed":true,"name":"bar","type":"bytes32"},{"indexed":false,"name":"wad","type":"uint256"},{"indexed":false,"name":"fax","type":"bytes"}],"name":"LogNote","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"name":"guy","type":"address"}],"name":"Rely","type":"event"}]`
+
+func logNote(t *testing.T) types.Log {
+	parsed, err := abi.JSON(strings.NewReader(logNoteABI))
+	assert.NoError(t, err)
+	data, err := parsed.Events["LogNote"].Inputs.NonIndexed().Pack(big.NewInt(42), []byte{0xde, 0xad})
+	assert.NoError(t, err)
+	return types.Log{
+		Address: common.HexToAddress("0x35d1b3f3d7966a1dfe207aa4514c12a259a0492b"),
+		Topics: []common.Hash{
+			common.HexToHash("0x1a0b287e00000000000000000000000000000000000000000000000000000000"), // Function selector
+			common.BytesToHash(common.HexToAddress("0x1111111111111111111111111111111111111111").Bytes()),
+			common.HexToHash("0x01"),
+			common.HexToHash("0x02"),
+		},
+		Data: data,
+	}
+}
+
+func TestDecode_Anonymous(t *testing.T) {
+	d, err := NewFromJSON(logNoteABI)
+	assert.NoError(t, err)
+
+	decoded, err := d.Decode(logNote(t))
+	assert.NoError(t, err)
+	assert.Equal(t, "LogNote", decoded.Name)
+	assert.Equal(t, [4]byte{0x1a, 0x0b, 0x28, 0x7e}, decoded.Inputs["sig"])
+	assert.Equal(t, common.HexToAddress("0x1111111111111111111111111111111111111111"), decoded.Inputs["guy"])
+	assert.Equal(t, big.NewInt(42), decoded.Inputs["wad"])
+	assert.Equal(t, []byte{0xde, 0xad}, decoded.Inputs["fax"])
+
+	// Another topic count or data layout does not fit
+	l := logNote(t)
+	l.Topics = l.Topics[:3]
+	_, err = d.Decode(l)
+	assert.ErrorContains(t, err, "signature not found")
+	l = logNote(t)
+	l.Data = l.Data[:32]
+	_, err = d.Decode(l)
+	assert.ErrorContains(t, err, "signature not found")
+
+	// The non-anonymous event still matches by its signature only
+	decoded, err = d.Decode(types.Log{Topics: []common.Hash{crypto.Keccak256Hash([]byte("Rely(address)")), {}}})
+	assert.NoError(t, err)
+	assert.Equal(t, "Rely", decoded.Name)
+}
+
+func TestRegistry_Anonymous(t *testing.T) {
+	l := logNote(t)
+	r := NewRegistry()
+	assert.NoError(t, r.AddABI(logNoteABI))
+	_, err := r.Decode(l)
+	assert.ErrorContains(t, err, "not found in registry")
+
+	// Anonymous events only match the contracts they are scoped to
+	r = NewRegistry()
+	assert.NoError(t, r.AddABI(logNoteABI, WithAddresses(l.Address)))
+	decoded, err := r.Decode(l)
+	assert.NoError(t, err)
+	assert.Equal(t, "LogNote", decoded.Name)
+
+	events := r.ListEvents()
+	assert.Len(t, events, 2)
+	assert.True(t, events[0].Anonymous)
+	assert.Equal(t, common.Hash{}, events[0].Topic0)
+	assert.Equal(t, []common.Address{l.Address}, events[0].Addresses)
+	assert.Equal(t, []common.Hash{crypto.Keccak256Hash([]byte("Rely(address)"))}, r.Topics())
+}
+
+func TestDecode_IndexedDynamic(t *testing.T) {
+	const abiJSON = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"name","type":"string"},{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"ids","type":"uint256[]"},{"indexed":false,"name":"label","type":"string"}],"name":"Registered","type":"event"}]`
+	d, err := NewFromJSON(abiJSON)
+	assert.NoError(t, err)
+
+	nameHash := crypto.Keccak256Hash([]byte("alice"))
+	idsHash := crypto.Keccak256Hash(common.LeftPadBytes([]byte{1}, 32))
+	data, err := d.parsedABI.Events["Registered"].Inputs.NonIndexed().Pack("Alice")
+	assert.NoError(t, err)
+	decoded, err := d.Decode(types.Log{
+		Topics: []common.Hash{crypto.Keccak256Hash([]byte("Registered(string,address,uint256[],string)")), nameHash, common.BytesToHash(sender.Bytes()), idsHash},
+		Data:   data,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, IndexedHash(nameHash), decoded.Inputs["name"])
+	assert.Equal(t, IndexedHash(idsHash), decoded.Inputs["ids"])
+	assert.Equal(t, sender, decoded.Inputs["owner"])
+	assert.Equal(t, "Alice", decoded.Inputs["label"])
+	assert.Equal(t, nameHash.Hex(), decoded.Inputs["name"].(IndexedHash).String())
+
+	text, err := IndexedHash(nameHash).MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, nameHash.Hex(), string(text))
+}
+
+// referenceDecode is the plain go-ethereum decoding, which the precomputed
+// layouts must match.
+func referenceDecode(event abi.Event, topics []common.Hash, data []byte) (map[string]interface{}, error) {
+	inputs := make(map[string]interface{})
+	if len(data) > 0 {
+		if err := event.Inputs.UnpackIntoMap(inputs, data); err != nil {
+			return nil, err
+		}
+	}
+	var indexed abi.Arguments
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(inputs, indexed, topics); err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+func TestDecode_MatchesReference(t *testing.T) {
+	w, err := NewFromSignatures([]string{
+		"event Transfer(address indexed from, address indexed to, uint256 value)",
+		"event Flags(bool indexed on, int8 indexed level, bytes4 indexed tag, bool off, int64 delta, bytes32 id)",
+		"event Mixed(uint16 indexed kind, uint256[2] pair, string memo, address who)",
+	})
+	assert.NoError(t, err)
+
+	word := func(b ...byte) common.Hash { return common.BytesToHash(b) }
+	minus := common.HexToHash("0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff6")
+	mixedArgs := w.parsedABI.Events["Mixed"].Inputs.NonIndexed()
+	mixedData, err := mixedArgs.Pack([2]*big.Int{big.NewInt(1), big.NewInt(2)}, "hello", receiver)
+	assert.NoError(t, err)
+	flagsData := append(append(word(1).Bytes(), minus.Bytes()...), crypto.Keccak256([]byte("id"))...)
+
+	for _, c := range []struct {
+		event  string
+		topics []common.Hash
+		data   []byte
+	}{
+		{"Transfer", []common.Hash{common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())}, common.LeftPadBytes(big.NewInt(500).Bytes(), 32)},
+		{"Flags", []common.Hash{word(1), minus, common.HexToHash("0xcafebabe00000000000000000000000000000000000000000000000000000000")}, flagsData},
+		{"Mixed", []common.Hash{word(0x01, 0x02)}, mixedData},
+	} {
+		event := w.parsedABI.Events[c.event]
+		want, err := referenceDecode(event, c.topics, c.data)
+		assert.NoError(t, err)
+		decoded, err := w.Decode(types.Log{Topics: append([]common.Hash{event.ID}, c.topics...), Data: c.data})
+		assert.NoError(t, err)
+		assert.Equal(t, want, decoded.Inputs, c.event)
+	}
+
+	// Malformed words fail as they do in go-ethereum
+	event := w.parsedABI.Events["Flags"]
+	_, want := referenceDecode(event, []common.Hash{word(2), minus, {}}, flagsData)
+	_, err = w.Decode(types.Log{Topics: []common.Hash{event.ID, word(2), minus, {}}, Data: flagsData})
+	assert.EqualError(t, err, want.Error())
+	_, want = referenceDecode(event, []common.Hash{word(1), minus, {}}, flagsData[:40])
+	_, err = w.Decode(types.Log{Topics: []common.Hash{event.ID, word(1), minus, {}}, Data: flagsData[:40]})
+	assert.EqualError(t, err, want.Error())
+}
+
+func TestDecodeReuse(t *testing.T) {
+	w, err := NewFromJSON(erc20TransferABI)
+	assert.NoError(t, err)
+	l := types.Log{
+		Topics: []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:   common.LeftPadBytes(big.NewInt(500).Bytes(), 32),
+	}
+	want, err := w.Decode(l)
+	assert.NoError(t, err)
+
+	dst := DecodedLog{Name: "Stale", Inputs: map[string]interface{}{"stale": true}, Heuristic: true}
+	assert.NoError(t, w.DecodeReuse(l, &dst))
+	assert.Equal(t, *want, dst)
+	assert.Error(t, w.DecodeReuse(types.Log{}, &dst))
+}
+
+func BenchmarkDecodeTransfer(b *testing.B) {
+	w, _ := NewFromJSON(erc20TransferABI)
+	event := w.parsedABI.Events["Transfer"]
+	l := types.Log{
+		Topics: []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:   common.LeftPadBytes(big.NewInt(500).Bytes(), 32),
+	}
+	b.Run("reference", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = referenceDecode(event, l.Topics[1:], l.Data)
+		}
+	})
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = w.Decode(l)
+		}
+	})
+	b.Run("DecodeReuse", func(b *testing.B) {
+		var dst DecodedLog
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = w.DecodeReuse(l, &dst)
+		}
+	})
 }
@@ -0,0 +1,286 @@
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/time/rate"
+)
+
+// ABIFetcher fetches the ABIs of a contract, e.g. from a block explorer. It
+// returns no ABI and no error for a contract it knows nothing about.
+type ABIFetcher interface {
+	FetchABI(ctx context.Context, address common.Address) ([]string, error)
+}
+
+// ABICache keeps fetched ABIs, e.g. across restarts.
+type ABICache interface {
+	LoadABI(ctx context.Context, address common.Address) (abiJSON string, found bool, err error)
+	SaveABI(ctx context.Context, address common.Address, abiJSON string) error
+}
+
+// ContractReader reads contract state, implemented by rpc.Client.
+type ContractReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// Storage slots holding the implementation address of a proxy
+var (
+	eip1967ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	eip1822ProxiableSlot      = common.HexToHash("0xc5f16f0fcc639fa48a6947836d9850f504798523bf8c9a3a87d5876cf622bcf7")
+)
+
+// EtherscanConfig configures an EtherscanFetcher.
+type EtherscanConfig struct {
+	URL    string // API endpoint, e.g. "https://api.etherscan.io/v2/api?chainid=1"
+	APIKey string
+	Cache  ABICache // Optional
+	// Reader detects EIP-1967 and EIP-1822 proxies, whose implementation ABI
+	// is fetched along with their own, and skips accounts without code. Optional
+	Reader      ContractReader
+	RateLimit   float64       // Requests per second, default 5
+	NegativeTTL time.Duration // How long contracts without a verified ABI are not asked for again, default 1h
+	RetryAfter  time.Duration // How long failed lookups are not retried, e.g. when offline, default 1m
+	Timeout     time.Duration // Per request, default 10s
+}
+
+// EtherscanFetcher is an ABIFetcher on the contract API of Etherscan and the
+// explorers compatible with it.
+type EtherscanFetcher struct {
+	url         string
+	apiKey      string
+	cache       ABICache
+	reader      ContractReader
+	client      *http.Client
+	limiter     *rate.Limiter
+	negativeTTL time.Duration
+	retryAfter  time.Duration
+
+	mu      sync.Mutex
+	skipped map[common.Address]time.Time // Contracts not asked for again until then
+}
+
+var _ ABIFetcher = (*EtherscanFetcher)(nil)
+
+// NewEtherscanFetcher creates a fetcher on the Etherscan-compatible API at
+// apiBaseURL. cache may be nil.
+func NewEtherscanFetcher(apiBaseURL, apiKey string, cache ABICache) *EtherscanFetcher {
+	return NewEtherscanFetcherWithConfig(EtherscanConfig{URL: apiBaseURL, APIKey: apiKey, Cache: cache})
+}
+
+// NewEtherscanFetcherWithConfig creates a fetcher from cfg.
+func NewEtherscanFetcherWithConfig(cfg EtherscanConfig) *EtherscanFetcher {
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = 5
+	}
+	if cfg.NegativeTTL <= 0 {
+		cfg.NegativeTTL = time.Hour
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &EtherscanFetcher{
+		url:         cfg.URL,
+		apiKey:      cfg.APIKey,
+		cache:       cfg.Cache,
+		reader:      cfg.Reader,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		limiter:     rate.NewLimiter(rate.Limit(cfg.RateLimit), 1),
+		negativeTTL: cfg.NegativeTTL,
+		retryAfter:  cfg.RetryAfter,
+		skipped:     make(map[common.Address]time.Time),
+	}
+}
+
+// FetchABI returns the verified ABI of address, followed by the one of its
+// implementation if it is a proxy.
+func (e *EtherscanFetcher) FetchABI(ctx context.Context, address common.Address) ([]string, error) {
+	e.mu.Lock()
+	until, skipped := e.skipped[address]
+	e.mu.Unlock()
+	if skipped && time.Now().Before(until) {
+		return nil, nil
+	}
+
+	abis, err := e.fetch(ctx, address)
+	switch {
+	case err != nil:
+		e.skip(address, e.retryAfter)
+		return nil, err
+	case len(abis) == 0:
+		e.skip(address, e.negativeTTL)
+	}
+	return abis, nil
+}
+
+func (e *EtherscanFetcher) skip(address common.Address, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.skipped[address] = time.Now().Add(d)
+}
+
+func (e *EtherscanFetcher) fetch(ctx context.Context, address common.Address) ([]string, error) {
+	var implementation common.Address
+	if e.reader != nil {
+		code, err := e.reader.CodeAt(ctx, address, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(code) == 0 {
+			return nil, nil // Not a contract
+		}
+		if implementation, err = e.implementation(ctx, address); err != nil {
+			return nil, err
+		}
+	}
+
+	var abis []string
+	for _, addr := range []common.Address{address, implementation} {
+		if addr == (common.Address{}) {
+			continue
+		}
+		abiJSON, found, err := e.fetchOne(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			abis = append(abis, abiJSON)
+		}
+	}
+	return abis, nil
+}
+
+// implementation returns the implementation address of a proxy, zero otherwise.
+func (e *EtherscanFetcher) implementation(ctx context.Context, address common.Address) (common.Address, error) {
+	for _, slot := range []common.Hash{eip1967ImplementationSlot, eip1822ProxiableSlot} {
+		value, err := e.reader.StorageAt(ctx, address, slot, nil)
+		if err != nil {
+			return common.Address{}, err
+		}
+		if impl := common.BytesToAddress(value); impl != (common.Address{}) {
+			return impl, nil
+		}
+	}
+	return common.Address{}, nil
+}
+
+// fetchOne returns the verified ABI of address from the cache or the API.
+func (e *EtherscanFetcher) fetchOne(ctx context.Context, address common.Address) (string, bool, error) {
+	if e.cache != nil {
+		if abiJSON, found, err := e.cache.LoadABI(ctx, address); err != nil || found {
+			return abiJSON, found, err
+		}
+	}
+	if err := e.limiter.Wait(ctx); err != nil {
+		return "", false, err
+	}
+
+	u, err := url.Parse(e.url)
+	if err != nil {
+		return "", false, err
+	}
+	q := u.Query()
+	q.Set("module", "contract")
+	q.Set("action", "getabi")
+	q.Set("address", address.Hex())
+	if e.apiKey != "" {
+		q.Set("apikey", e.apiKey)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("etherscan: unexpected status %d", resp.StatusCode)
+	}
+	var body struct {
+		Status string `json:"status"`
+		Result string `json:"result"`
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return "", false, err
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return "", false, fmt.Errorf("etherscan: %w", err)
+	}
+	if body.Status != "1" {
+		if strings.Contains(strings.ToLower(body.Result), "not verified") {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("etherscan: %s", body.Result) // E.g. rate limited or invalid key
+	}
+	if _, err := abi.JSON(strings.NewReader(body.Result)); err != nil {
+		return "", false, fmt.Errorf("etherscan: invalid abi for %s: %w", address.Hex(), err)
+	}
+
+	if e.cache != nil {
+		if err := e.cache.SaveABI(ctx, address, body.Result); err != nil {
+			return "", false, err
+		}
+	}
+	return body.Result, true, nil
+}
+
+// DirABICache is an ABICache keeping each ABI in a JSON file of a directory.
+type DirABICache struct {
+	dir string
+}
+
+var _ ABICache = (*DirABICache)(nil)
+
+// NewDirABICache creates dir if needed and returns a cache in it.
+func NewDirABICache(dir string) (*DirABICache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DirABICache{dir: dir}, nil
+}
+
+func (c *DirABICache) path(address common.Address) string {
+	return filepath.Join(c.dir, strings.ToLower(address.Hex())+".json")
+}
+
+// LoadABI reads the ABI of address, if cached.
+func (c *DirABICache) LoadABI(_ context.Context, address common.Address) (string, bool, error) {
+	data, err := os.ReadFile(c.path(address))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
+
+// SaveABI writes the ABI of address.
+func (c *DirABICache) SaveABI(_ context.Context, address common.Address, abiJSON string) error {
+	tmp := c.path(address) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(abiJSON), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path(address))
+}
@@ -0,0 +1,144 @@
+package decoder
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+const upgradedABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"implementation","type":"address"}],"name":"Upgraded","type":"event"}]`
+
+var implementationC = common.HexToAddress("0xcccccccccccccccccccccccccccccccccccccccc")
+
+// fakeChain is a ContractReader where tokenA is an EIP-1967 proxy of
+// implementationC and sender holds no code.
+type fakeChain struct{}
+
+func (fakeChain) CodeAt(_ context.Context, account common.Address, _ *big.Int) ([]byte, error) {
+	if account == sender {
+		return nil, nil
+	}
+	return []byte{0x60, 0x80}, nil
+}
+
+func (fakeChain) StorageAt(_ context.Context, account common.Address, key common.Hash, _ *big.Int) ([]byte, error) {
+	if account == tokenA && key == eip1967ImplementationSlot {
+		return common.BytesToHash(implementationC.Bytes()).Bytes(), nil
+	}
+	return make([]byte, 32), nil
+}
+
+// etherscanMock serves the proxy ABI for tokenA and the token ABI for
+// implementationC; other contracts are not verified.
+func etherscanMock(t *testing.T, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		q := r.URL.Query()
+		assert.Equal(t, "contract", q.Get("module"))
+		assert.Equal(t, "getabi", q.Get("action"))
+		assert.Equal(t, "key", q.Get("apikey"))
+		resp := map[string]string{"status": "0", "message": "NOTOK", "result": "Contract source code not verified"}
+		switch common.HexToAddress(q.Get("address")) {
+		case tokenA:
+			resp = map[string]string{"status": "1", "message": "OK", "result": upgradedABI}
+		case implementationC:
+			resp = map[string]string{"status": "1", "message": "OK", "result": erc20TransferABI}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestEtherscanFetcher_Proxy(t *testing.T) {
+	var requests atomic.Int32
+	srv := etherscanMock(t, &requests)
+	defer srv.Close()
+
+	cache, err := NewDirABICache(t.TempDir())
+	assert.NoError(t, err)
+	fetcher := NewEtherscanFetcherWithConfig(EtherscanConfig{URL: srv.URL, APIKey: "key", Cache: cache, Reader: fakeChain{}, RateLimit: 1000})
+	r := NewRegistry()
+	r.SetFetcher(fetcher)
+
+	// The proxy emits the events of its implementation
+	transfer := types.Log{
+		Address: tokenA,
+		Topics:  []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:    common.LeftPadBytes(big.NewInt(42).Bytes(), 32),
+	}
+	decoded, err := r.Decode(transfer)
+	assert.NoError(t, err)
+	assert.Equal(t, "Transfer", decoded.Name)
+	assert.Equal(t, big.NewInt(42), decoded.Inputs["value"])
+	assert.Equal(t, int32(2), requests.Load())
+
+	// Along with its own, scoped to it
+	decoded, err = r.Decode(types.Log{Address: tokenA, Topics: []common.Hash{crypto.Keccak256Hash([]byte("Upgraded(address)")), common.BytesToHash(implementationC.Bytes())}})
+	assert.NoError(t, err)
+	assert.Equal(t, implementationC, decoded.Inputs["implementation"])
+	transfer.Address = nftB
+	_, err = r.Decode(transfer)
+	assert.ErrorContains(t, err, "not found in registry")
+	assert.Equal(t, int32(3), requests.Load())
+
+	// Contracts without a verified ABI are not asked for again, accounts
+	// without code not at all
+	_, _ = r.Decode(transfer)
+	transfer.Address = sender
+	_, err = r.Decode(transfer)
+	assert.ErrorContains(t, err, "not found in registry")
+	assert.Equal(t, int32(3), requests.Load())
+
+	// A new fetcher reads the ABIs from the cache
+	r = NewRegistry()
+	r.SetFetcher(NewEtherscanFetcherWithConfig(EtherscanConfig{URL: srv.URL, APIKey: "key", Cache: cache, Reader: fakeChain{}}))
+	transfer.Address = tokenA
+	_, err = r.Decode(transfer)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestEtherscanFetcher_RateLimit(t *testing.T) {
+	var requests atomic.Int32
+	srv := etherscanMock(t, &requests)
+	defer srv.Close()
+
+	fetcher := NewEtherscanFetcher(srv.URL, "key", nil)
+	start := time.Now()
+	for _, addr := range []common.Address{tokenA, nftB, sender} {
+		_, err := fetcher.FetchABI(context.Background(), addr)
+		assert.NoError(t, err)
+	}
+	// 5 requests per second: the first at once, the others 200ms apart
+	assert.GreaterOrEqual(t, time.Since(start), 350*time.Millisecond)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestEtherscanFetcher_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"0","message":"NOTOK","result":"Max rate limit reached"}`))
+	}))
+	fetcher := NewEtherscanFetcherWithConfig(EtherscanConfig{URL: srv.URL, RateLimit: 1000, RetryAfter: time.Hour})
+	_, err := fetcher.FetchABI(context.Background(), tokenA)
+	assert.ErrorContains(t, err, "etherscan: Max rate limit reached")
+
+	// Offline, logs stay unresolved and the contract is not retried at once
+	srv.Close()
+	fetcher = NewEtherscanFetcherWithConfig(EtherscanConfig{URL: srv.URL, RateLimit: 1000, RetryAfter: time.Hour})
+	r := NewRegistry()
+	r.SetFetcher(fetcher)
+	_, err = r.Decode(types.Log{Address: tokenA, Topics: []common.Hash{transferID}})
+	assert.ErrorContains(t, err, "not found in registry")
+	abis, err := fetcher.FetchABI(context.Background(), tokenA)
+	assert.NoError(t, err)
+	assert.Empty(t, abis)
+}
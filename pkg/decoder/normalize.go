@@ -0,0 +1,203 @@
+package decoder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// TokenCaller executes read-only contract calls, implemented by rpc.Client.
+type TokenCaller interface {
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// Token describes an ERC20 token.
+type Token struct {
+	Decimals uint8
+	Symbol   string
+}
+
+// ERC20 metadata selectors: decimals() and symbol()
+var (
+	decimalsSelector = []byte{0x31, 0x3c, 0xe5, 0x67}
+	symbolSelector   = []byte{0x95, 0xd8, 0x9b, 0x41}
+)
+
+// Failed token lookups, e.g. while the node is unreachable, are retried after this delay.
+const tokenRetryAfter = 10 * time.Minute
+
+// Normalizer adds human-readable fields to the decoded events of known
+// tokens: for each integer input, e.g. value, value_decimal holds it scaled by
+// the token decimals ("1234.56") and value_symbol the token symbol; for each
+// address input, e.g. from, from_checksum holds its EIP-55 form. The raw
+// inputs are left as they are, and the events of other contracts untouched.
+type Normalizer struct {
+	caller TokenCaller
+
+	mu     sync.RWMutex
+	tokens map[common.Address]*Token    // nil for contracts found not to be tokens
+	failed map[common.Address]time.Time // Lookups not retried until then
+}
+
+// NewNormalizer creates a Normalizer. With a caller, the decimals and symbol
+// of unregistered contracts are read on chain once; caller may be nil.
+func NewNormalizer(caller TokenCaller) *Normalizer {
+	return &Normalizer{
+		caller: caller,
+		tokens: make(map[common.Address]*Token),
+		failed: make(map[common.Address]time.Time),
+	}
+}
+
+// RegisterToken declares the token at address.
+func (n *Normalizer) RegisterToken(address common.Address, decimals uint8, symbol string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.tokens[address] = &Token{Decimals: decimals, Symbol: symbol}
+}
+
+// LoadTokenList registers the tokens of a token list, as published in the
+// tokenlists.org format: {"tokens": [{"chainId": 1, "address": "0x...",
+// "symbol": "USDC", "decimals": 6}]}. Only the tokens of chainID are kept,
+// unless it is 0.
+func (n *Normalizer) LoadTokenList(r io.Reader, chainID uint64) error {
+	var list struct {
+		Tokens []struct {
+			ChainID  uint64 `json:"chainId"`
+			Address  string `json:"address"`
+			Symbol   string `json:"symbol"`
+			Decimals uint8  `json:"decimals"`
+		} `json:"tokens"`
+	}
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return err
+	}
+	for i, t := range list.Tokens {
+		if !common.IsHexAddress(t.Address) {
+			return fmt.Errorf("token %d: invalid address %q", i, t.Address)
+		}
+		if chainID == 0 || t.ChainID == chainID {
+			n.RegisterToken(common.HexToAddress(t.Address), t.Decimals, t.Symbol)
+		}
+	}
+	return nil
+}
+
+// Normalize adds the derived fields to the inputs of decoded, an event
+// emitted by log.Address.
+func (n *Normalizer) Normalize(decoded *DecodedLog, log types.Log) {
+	if decoded == nil {
+		return
+	}
+	token := n.token(log.Address)
+	if token == nil {
+		return
+	}
+	derived := make(map[string]interface{})
+	for name, v := range decoded.Inputs {
+		switch v := v.(type) {
+		case *big.Int:
+			derived[name+"_decimal"] = FormatUnits(v, int(token.Decimals))
+			if token.Symbol != "" {
+				derived[name+"_symbol"] = token.Symbol
+			}
+		case common.Address:
+			derived[name+"_checksum"] = v.Hex()
+		}
+	}
+	for name, v := range derived {
+		if _, ok := decoded.Inputs[name]; !ok {
+			decoded.Inputs[name] = v
+		}
+	}
+}
+
+// token returns the token at address, looking it up on chain if needed; nil
+// if it is not a known token.
+func (n *Normalizer) token(address common.Address) *Token {
+	n.mu.RLock()
+	token, known := n.tokens[address]
+	retry, failed := n.failed[address]
+	n.mu.RUnlock()
+	if known || n.caller == nil || failed && time.Now().Before(retry) {
+		return token
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	token, err := n.lookup(ctx, address)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		log.Warn("Failed to look token up", "address", address, "err", err)
+		n.failed[address] = time.Now().Add(tokenRetryAfter)
+		return nil
+	}
+	delete(n.failed, address)
+	n.tokens[address] = token
+	return token
+}
+
+// lookup reads the decimals and symbol of the contract at address, returning
+// nil if it has no valid decimals.
+func (n *Normalizer) lookup(ctx context.Context, address common.Address) (*Token, error) {
+	result, err := n.caller.CallContract(ctx, ethereum.CallMsg{To: &address, Data: decimalsSelector}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != 32 || new(big.Int).SetBytes(result).Cmp(big.NewInt(255)) > 0 {
+		return nil, nil // Not an ERC20 token
+	}
+	token := &Token{Decimals: result[31]}
+
+	// The symbol is optional, and a bytes32 in some early tokens
+	result, err = n.caller.CallContract(ctx, ethereum.CallMsg{To: &address, Data: symbolSelector}, nil)
+	if err == nil {
+		token.Symbol = decodeSymbol(result)
+	}
+	return token, nil
+}
+
+func decodeSymbol(data []byte) string {
+	stringType, _ := abi.NewType("string", "", nil)
+	if values, err := (abi.Arguments{{Type: stringType}}).Unpack(data); err == nil {
+		return values[0].(string)
+	}
+	if len(data) == 32 {
+		return string(bytes.TrimRight(data, "\x00"))
+	}
+	return ""
+}
+
+// FormatUnits formats n scaled down by 10^decimals, without trailing zeros,
+// e.g. "1234.56" for 1234560000 with 6 decimals.
+func FormatUnits(n *big.Int, decimals int) string {
+	if decimals <= 0 {
+		return n.String()
+	}
+	abs := new(big.Int).Abs(n)
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(abs, unit, new(big.Int))
+
+	s := whole.String()
+	if frac.Sign() != 0 {
+		digits := fmt.Sprintf("%0*s", decimals, frac.String())
+		s += "." + strings.TrimRight(digits, "0")
+	}
+	if n.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
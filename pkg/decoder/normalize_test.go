@@ -0,0 +1,115 @@
+package decoder
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenCaller answers decimals() and symbol() for tokenA only.
+type tokenCaller struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (c *tokenCaller) CallContract(_ context.Context, msg ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	c.calls.Add(1)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if *msg.To != tokenA {
+		return nil, errors.New("execution reverted")
+	}
+	if string(msg.Data) == string(decimalsSelector) {
+		return common.LeftPadBytes([]byte{8}, 32), nil
+	}
+	stringType, _ := abi.NewType("string", "", nil)
+	return abi.Arguments{{Type: stringType}}.Pack("WBTC")
+}
+
+func transferLog(token common.Address, value *big.Int) (*DecodedLog, types.Log) {
+	l := types.Log{Address: token}
+	return &DecodedLog{Name: "Transfer", Inputs: map[string]interface{}{
+		"from":  sender,
+		"to":    receiver,
+		"value": value,
+	}}, l
+}
+
+func TestNormalizer_Decimals(t *testing.T) {
+	n := NewNormalizer(nil)
+	n.RegisterToken(tokenA, 6, "USDC")
+	n.RegisterToken(nftB, 18, "")
+	usdt := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	assert.NoError(t, n.LoadTokenList(strings.NewReader(`{"name":"Test","tokens":[
+		{"chainId":1,"address":"0xdAC17F958D2ee523a2206206994597C13D831ec7","symbol":"USDT","decimals":8},
+		{"chainId":56,"address":"0x55d398326f99059fF775485246999027B3197955","symbol":"USDT","decimals":18}]}`), 1))
+
+	decoded, l := transferLog(tokenA, big.NewInt(1234560000))
+	n.Normalize(decoded, l)
+	assert.Equal(t, "1234.56", decoded.Inputs["value_decimal"])
+	assert.Equal(t, "USDC", decoded.Inputs["value_symbol"])
+	assert.Equal(t, big.NewInt(1234560000), decoded.Inputs["value"])
+	assert.Equal(t, sender.Hex(), decoded.Inputs["from_checksum"])
+	assert.Equal(t, sender, decoded.Inputs["from"])
+
+	decoded, l = transferLog(usdt, big.NewInt(150000001))
+	n.Normalize(decoded, l)
+	assert.Equal(t, "1.50000001", decoded.Inputs["value_decimal"])
+	assert.Equal(t, "USDT", decoded.Inputs["value_symbol"])
+
+	value, _ := new(big.Int).SetString("2000000000000000000", 10)
+	decoded, l = transferLog(nftB, value)
+	n.Normalize(decoded, l)
+	assert.Equal(t, "2", decoded.Inputs["value_decimal"])
+	assert.NotContains(t, decoded.Inputs, "value_symbol")
+
+	// Tokens of other chains and unknown contracts pass through untouched
+	decoded, l = transferLog(common.HexToAddress("0x55d398326f99059fF775485246999027B3197955"), big.NewInt(1))
+	n.Normalize(decoded, l)
+	assert.Len(t, decoded.Inputs, 3)
+	n.Normalize(nil, l)
+
+	assert.ErrorContains(t, n.LoadTokenList(strings.NewReader(`{"tokens":[{"address":"usdt"}]}`), 0), `token 0: invalid address "usdt"`)
+}
+
+func TestNormalizer_Lookup(t *testing.T) {
+	caller := &tokenCaller{}
+	n := NewNormalizer(caller)
+
+	decoded, l := transferLog(tokenA, big.NewInt(-50000000))
+	n.Normalize(decoded, l)
+	assert.Equal(t, "-0.5", decoded.Inputs["value_decimal"])
+	assert.Equal(t, "WBTC", decoded.Inputs["value_symbol"])
+
+	// Contracts without decimals() are not tokens; both are looked up once
+	decoded, l = transferLog(nftB, big.NewInt(7))
+	n.Normalize(decoded, l)
+	assert.Len(t, decoded.Inputs, 3)
+	n.Normalize(transferLog(tokenA, big.NewInt(1)))
+	assert.Equal(t, int32(3), caller.calls.Load())
+
+	// Failed lookups leave events untouched and are not retried at once
+	caller = &tokenCaller{err: errors.New("connection refused")}
+	n = NewNormalizer(caller)
+	decoded, l = transferLog(tokenA, big.NewInt(1))
+	n.Normalize(decoded, l)
+	n.Normalize(decoded, l)
+	assert.Len(t, decoded.Inputs, 3)
+	assert.Equal(t, int32(1), caller.calls.Load())
+}
+
+func TestDecodeSymbol(t *testing.T) {
+	// MKR returns its symbol as a bytes32
+	assert.Equal(t, "MKR", decodeSymbol(common.RightPadBytes([]byte("MKR"), 32)))
+	assert.Equal(t, "", decodeSymbol(nil))
+}
@@ -0,0 +1,520 @@
+package decoder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ABIOption configures an ABI added to a Registry.
+type ABIOption func(*abiOptions)
+
+type abiOptions struct {
+	addresses []common.Address
+}
+
+// WithAddresses scopes an ABI to logs emitted by the given contracts. Without
+// it, the ABI decodes logs of any contract not covered by a scoped ABI, but
+// not as its anonymous events, which only scoped ABIs match.
+func WithAddresses(addresses ...common.Address) ABIOption {
+	return func(o *abiOptions) {
+		o.addresses = append(o.addresses, addresses...)
+	}
+}
+
+// EventInfo describes an event known to a Registry.
+type EventInfo struct {
+	Name      string           // Event name (e.g., Transfer)
+	Signature string           // Full declaration, e.g. "event Transfer(address indexed from, address indexed to, uint256 value)"
+	Topic0    common.Hash      // Event ID matched against log.Topics[0], zero for anonymous events
+	Anonymous bool             // Matched by the topic count and data layout instead
+	Addresses []common.Address // Contracts the event is scoped to, empty for any contract
+}
+
+// Registry decodes logs with several ABIs, resolving the event of a log by its
+// contract address and topic0 first, then by the address rules and topic0,
+// then by topic0 alone, and last as an anonymous event of its contract. ABIs
+// sharing an event signature with different layouts can so be scoped to their
+// contracts. A Registry is safe for concurrent use.
+type Registry struct {
+	abisMu    sync.RWMutex // Guards the ABIs, which a fetcher adds while decoding
+	scoped    map[common.Address]eventScope
+	rules     []addressRule
+	global    eventScope
+	anonymous map[common.Address][]*ABIWrapper // Scoped ABIs with anonymous events
+	fetched   map[common.Address]bool
+
+	code       CodeReader
+	codeStore  CodeHashStore
+	codeMu     sync.Mutex
+	codeHashes map[common.Address]uint64 // Code hash prefixes, see codeHashPrefix
+
+	fetcher   ABIFetcher
+	resolver  SignatureResolver
+	mu        sync.Mutex
+	heuristic map[heuristicKey][]abi.Event // Events built from resolved signatures
+}
+
+// eventScope holds the ABIs declaring each topic0 in a scope. Several ABIs
+// only declare a topic0 with different numbers of indexed parameters, as the
+// ERC20 and ERC721 Transfer events do.
+type eventScope map[common.Hash][]*ABIWrapper
+
+// find returns the ABI declaring topic0 with topics indexed parameters, or
+// else the first one declaring it.
+func (s eventScope) find(topic0 common.Hash, topics int) (*ABIWrapper, bool) {
+	ws := s[topic0]
+	for _, w := range ws {
+		if w.layouts[topic0].topics == topics {
+			return w, true
+		}
+	}
+	if len(ws) > 0 {
+		return ws[0], true
+	}
+	return nil, false
+}
+
+// declares reports whether an ABI of the scope declares the event of layout.
+func (s eventScope) declares(id common.Hash, layout *eventLayout) bool {
+	for _, w := range s[id] {
+		if w.layouts[id].event.String() == layout.event.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// heuristicKey identifies the events built from the signatures of a topic0
+// for logs with a number of indexed topics.
+type heuristicKey struct {
+	topic0  common.Hash
+	indexed int
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		scoped:     make(map[common.Address]eventScope),
+		global:     make(eventScope),
+		anonymous:  make(map[common.Address][]*ABIWrapper),
+		fetched:    make(map[common.Address]bool),
+		codeHashes: make(map[common.Address]uint64),
+		heuristic:  make(map[heuristicKey][]abi.Event),
+	}
+}
+
+// SetFetcher makes Decode fetch the ABIs of the contracts it first sees, and
+// register them scoped to the contract. Set it before decoding.
+func (r *Registry) SetFetcher(fetcher ABIFetcher) {
+	r.fetcher = fetcher
+}
+
+// SetResolver makes Decode fall back to the signatures resolved by resolver
+// for logs no registered ABI matches, flagging the results as Heuristic.
+func (r *Registry) SetResolver(resolver SignatureResolver) {
+	r.resolver = resolver
+}
+
+// AddABI registers the events of a JSON ABI. Registering an event with the
+// same signature and number of indexed parameters but a different layout
+// twice for the same scope is an error.
+func (r *Registry) AddABI(jsonStr string, opts ...ABIOption) error {
+	w, err := NewFromJSON(jsonStr)
+	if err != nil {
+		return err
+	}
+	return r.add(w, opts...)
+}
+
+// AddSignatures registers the events of human-readable fragments, see
+// NewFromSignatures.
+func (r *Registry) AddSignatures(signatures []string, opts ...ABIOption) error {
+	w, err := NewFromSignatures(signatures)
+	if err != nil {
+		return err
+	}
+	return r.add(w, opts...)
+}
+
+func (r *Registry) add(w *ABIWrapper, opts ...ABIOption) error {
+	var o abiOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	r.abisMu.Lock()
+	defer r.abisMu.Unlock()
+
+	targets := []eventScope{r.global}
+	if len(o.addresses) > 0 {
+		targets = targets[:0]
+		for _, addr := range o.addresses {
+			if r.scoped[addr] == nil {
+				r.scoped[addr] = make(eventScope)
+			}
+			targets = append(targets, r.scoped[addr])
+		}
+	}
+	// Check all scopes before registering, so that a failed ABI leaves no trace
+	for _, target := range targets {
+		for id, layout := range w.layouts {
+			for _, prev := range target[id] {
+				existing := prev.layouts[id].event
+				if prev.layouts[id].topics == layout.topics && existing.String() != layout.event.String() {
+					return fmt.Errorf("%s conflicts with registered %s", layout.event.String(), existing.String())
+				}
+			}
+		}
+	}
+	for _, target := range targets {
+		for id, layout := range w.layouts {
+			if !target.declares(id, layout) {
+				target[id] = append(target[id], w)
+			}
+		}
+	}
+	if len(w.anonymous) > 0 {
+		for _, addr := range o.addresses {
+			r.anonymous[addr] = append(r.anonymous[addr], w)
+		}
+	}
+	return nil
+}
+
+// Decode parses a log with the ABI registered for its contract and topic0,
+// falling back to the unscoped ABIs, then to the anonymous events registered
+// for its contract, and last to the signature resolver if one is set. With a
+// fetcher, the ABIs of the contract are fetched first if it is new.
+func (r *Registry) Decode(log types.Log) (*DecodedLog, error) {
+	if r.fetcher != nil {
+		r.fetch(log.Address)
+	}
+	codeHash := r.codeHashFor(log)
+	r.abisMu.RLock()
+	result, ok, err := r.decodeRegistered(log, codeHash)
+	r.abisMu.RUnlock()
+	switch {
+	case ok:
+		return result, err
+	case len(log.Topics) == 0:
+		return nil, fmt.Errorf("log has no topics: %w", ErrUnknownEvent)
+	case r.resolver != nil:
+		return r.decodeHeuristic(log)
+	default:
+		return nil, fmt.Errorf("%w in registry", ErrUnknownEvent)
+	}
+}
+
+// DecodeError reports a log of a batch that could not be decoded.
+type DecodeError struct {
+	Index    int // Position of the log in the batch
+	TxHash   common.Hash
+	LogIndex uint
+	Err      error
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("log %d (tx %s, index %d): %v", e.Index, e.TxHash.Hex(), e.LogIndex, e.Err)
+}
+
+func (e DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeBatch decodes logs like Decode, looking the event of each contract
+// and topic0 up once for the whole batch. results[i] is the decoded logs[i],
+// nil if it failed, in which case errs reports why, in log order.
+func (r *Registry) DecodeBatch(logs []types.Log) (results []*DecodedLog, errs []DecodeError) {
+	results = make([]*DecodedLog, len(logs))
+	layouts := make(map[batchKey]*eventLayout)
+	for i, l := range logs {
+		var (
+			decoded *DecodedLog
+			err     error
+		)
+		if layout := r.batchLayout(l, layouts); layout != nil {
+			decoded, err = layout.decode(l.Topics[1:], l.Data)
+		} else {
+			decoded, err = r.Decode(l)
+		}
+		if err != nil {
+			errs = append(errs, DecodeError{Index: i, TxHash: l.TxHash, LogIndex: l.Index, Err: err})
+			continue
+		}
+		results[i] = decoded
+	}
+	return results, errs
+}
+
+type batchKey struct {
+	address common.Address
+	topic0  common.Hash
+	topics  int
+}
+
+// batchLayout returns the layout of the registered event of log, nil if it
+// needs the other lookups of Decode. Layouts are memoized in layouts.
+func (r *Registry) batchLayout(log types.Log, layouts map[batchKey]*eventLayout) *eventLayout {
+	if len(log.Topics) == 0 {
+		return nil
+	}
+	key := batchKey{log.Address, log.Topics[0], len(log.Topics)}
+	if layout, ok := layouts[key]; ok {
+		return layout
+	}
+	if r.fetcher != nil {
+		r.fetch(log.Address)
+	}
+	codeHash := r.codeHashFor(log)
+
+	r.abisMu.RLock()
+	w := r.lookup(log, codeHash)
+	r.abisMu.RUnlock()
+	var layout *eventLayout
+	if w != nil {
+		layout = w.layouts[log.Topics[0]]
+	}
+	layouts[key] = layout
+	return layout
+}
+
+// lookup returns the ABI registered for the contract and topic0 of log, by
+// address, address rule or topic0 alone; nil if there is none.
+func (r *Registry) lookup(log types.Log, codeHash uint64) *ABIWrapper {
+	if len(log.Topics) == 0 {
+		return nil
+	}
+	if w, ok := r.scoped[log.Address].find(log.Topics[0], len(log.Topics)-1); ok {
+		return w
+	}
+	for _, rule := range r.rules {
+		if _, ok := rule.abi.layouts[log.Topics[0]]; ok && rule.matches(log.Address, codeHash) {
+			return rule.abi
+		}
+	}
+	w, _ := r.global.find(log.Topics[0], len(log.Topics)-1)
+	return w
+}
+
+// decodeRegistered decodes log with the registered ABIs, reporting whether one
+// matched. codeHash is the code hash prefix of its contract, if needed.
+func (r *Registry) decodeRegistered(log types.Log, codeHash uint64) (*DecodedLog, bool, error) {
+	if w := r.lookup(log, codeHash); w != nil {
+		result, err := w.Decode(log)
+		return result, true, err
+	}
+	candidates := r.anonymous[log.Address]
+	for _, rule := range r.rules {
+		if len(rule.abi.anonymous) > 0 && rule.matches(log.Address, codeHash) {
+			candidates = append(candidates[:len(candidates):len(candidates)], rule.abi)
+		}
+	}
+	var found *DecodedLog
+	for _, w := range candidates {
+		result, err := w.decodeAnonymous(log)
+		if err != nil {
+			return nil, true, err
+		}
+		if result != nil && found != nil {
+			return nil, true, fmt.Errorf("log fits anonymous events %s and %s", found.Name, result.Name)
+		}
+		if result != nil {
+			found = result
+		}
+	}
+	return found, found != nil, nil
+}
+
+// fetch registers the fetched ABIs of address once. Failures leave it
+// unresolved and are retried as the fetcher allows.
+func (r *Registry) fetch(address common.Address) {
+	r.abisMu.RLock()
+	done := r.fetched[address]
+	r.abisMu.RUnlock()
+	if done {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	abis, err := r.fetcher.FetchABI(ctx, address)
+	if err != nil {
+		log.Warn("Failed to fetch contract ABI", "address", address, "err", err)
+		return
+	}
+	for _, abiJSON := range abis {
+		if err := r.AddABI(abiJSON, WithAddresses(address)); err != nil {
+			log.Warn("Failed to register fetched ABI", "address", address, "err", err)
+		}
+	}
+	if len(abis) > 0 {
+		r.abisMu.Lock()
+		r.fetched[address] = true
+		r.abisMu.Unlock()
+	}
+}
+
+// decodeHeuristic decodes log with the first resolved signature of its topic0
+// that fits its topics and data.
+func (r *Registry) decodeHeuristic(log types.Log) (*DecodedLog, error) {
+	key := heuristicKey{topic0: log.Topics[0], indexed: len(log.Topics) - 1}
+	r.mu.Lock()
+	events, ok := r.heuristic[key]
+	r.mu.Unlock()
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		signatures, err := r.resolver.ResolveEvent(ctx, key.topic0)
+		if err != nil {
+			return nil, fmt.Errorf("resolve event signature: %w", err)
+		}
+		for _, sig := range signatures {
+			if event, err := heuristicEvent(sig, key.indexed); err == nil {
+				events = append(events, event)
+			}
+		}
+		r.mu.Lock()
+		if len(r.heuristic) >= 10000 {
+			r.heuristic = make(map[heuristicKey][]abi.Event) // Start over rather than track usage
+		}
+		r.heuristic[key] = events
+		r.mu.Unlock()
+	}
+
+	for _, event := range events {
+		if !fitsEvent(event, log.Topics[1:], log.Data) {
+			continue
+		}
+		if result, err := decodeEvent(event, log.Topics[1:], log.Data); err == nil {
+			result.Heuristic = true
+			return result, nil
+		}
+	}
+	return nil, fmt.Errorf("%w in registry", ErrUnknownEvent)
+}
+
+// heuristicEvent builds the event of a text signature such as
+// "Transfer(address,address,uint256)", taking its first parameters as the
+// indexed ones and leaving them unnamed.
+func heuristicEvent(signature string, indexed int) (abi.Event, error) {
+	p := &sigParser{src: "event " + signature}
+	event, err := p.event()
+	if err != nil {
+		return abi.Event{}, err
+	}
+	if len(event.Inputs) < indexed {
+		return abi.Event{}, fmt.Errorf("%s has fewer than %d parameters", signature, indexed)
+	}
+	for i := range event.Inputs {
+		event.Inputs[i].Name = ""
+		event.Inputs[i].Indexed = i < indexed
+	}
+	parsed, err := eventsABI([]jsonEvent{event})
+	if err != nil {
+		return abi.Event{}, err
+	}
+	return parsed.Events[event.Name], nil
+}
+
+// Topics returns the topic0 of every registered event, e.g. to filter on them.
+func (r *Registry) Topics() []common.Hash {
+	r.abisMu.RLock()
+	defer r.abisMu.RUnlock()
+	seen := make(map[common.Hash]bool)
+	var topics []common.Hash
+	add := func(events eventScope) {
+		for id := range events {
+			if !seen[id] {
+				seen[id] = true
+				topics = append(topics, id)
+			}
+		}
+	}
+	add(r.global)
+	for _, events := range r.scoped {
+		add(events)
+	}
+	for _, rule := range r.rules {
+		for id := range rule.abi.layouts {
+			if !seen[id] {
+				seen[id] = true
+				topics = append(topics, id)
+			}
+		}
+	}
+	sort.Slice(topics, func(i, j int) bool { return bytes.Compare(topics[i][:], topics[j][:]) < 0 })
+	return topics
+}
+
+// ListEvents returns the registered events sorted by name, one entry per
+// distinct declaration and scope.
+func (r *Registry) ListEvents() []EventInfo {
+	r.abisMu.RLock()
+	defer r.abisMu.RUnlock()
+	byKey := make(map[string]*EventInfo)
+	add := func(events eventScope, addr *common.Address) {
+		for id, ws := range events {
+			for _, w := range ws {
+				event := w.layouts[id].event
+				key := event.String()
+				if addr == nil {
+					key += " global"
+				}
+				info, ok := byKey[key]
+				if !ok {
+					info = &EventInfo{Name: event.Name, Signature: event.String(), Topic0: id}
+					byKey[key] = info
+				}
+				if addr != nil {
+					info.Addresses = append(info.Addresses, *addr)
+				}
+			}
+		}
+	}
+	add(r.global, nil)
+	for addr, events := range r.scoped {
+		add(events, &addr)
+	}
+	for addr, wrappers := range r.anonymous {
+		for _, w := range wrappers {
+			for _, event := range w.parsedABI.Events {
+				if !event.Anonymous {
+					continue
+				}
+				key := event.String() + " anonymous"
+				info, ok := byKey[key]
+				if !ok {
+					info = &EventInfo{Name: event.Name, Signature: key, Anonymous: true}
+					byKey[key] = info
+				}
+				info.Addresses = append(info.Addresses, addr)
+			}
+		}
+	}
+
+	infos := make([]EventInfo, 0, len(byKey))
+	for _, info := range byKey {
+		sort.Slice(info.Addresses, func(i, j int) bool {
+			return bytes.Compare(info.Addresses[i][:], info.Addresses[j][:]) < 0
+		})
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		if infos[i].Signature != infos[j].Signature {
+			return infos[i].Signature < infos[j].Signature
+		}
+		return len(infos[i].Addresses) < len(infos[j].Addresses)
+	})
+	return infos
+}
@@ -0,0 +1,192 @@
+package decoder
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	erc20TransferABI  = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"}]`
+	erc721TransferABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":true,"name":"tokenId","type":"uint256"}],"name":"Transfer","type":"event"}]`
+	// A token packing the amount with a memo in the data
+	memoTransferABI = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"memo","type":"string"}],"name":"Memo","type":"event"}]`
+)
+
+var (
+	transferID = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	tokenA     = common.HexToAddress("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	nftB       = common.HexToAddress("0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	sender     = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	receiver   = common.HexToAddress("0x2222222222222222222222222222222222222222")
+)
+
+func TestRegistry_OverlappingSignatures(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.AddABI(erc20TransferABI, WithAddresses(tokenA)))
+	assert.NoError(t, r.AddABI(erc721TransferABI, WithAddresses(nftB)))
+
+	// The ERC20 transfer carries the amount in the data
+	amount := common.LeftPadBytes(big.NewInt(500).Bytes(), 32)
+	decoded, err := r.Decode(types.Log{
+		Address: tokenA,
+		Topics:  []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:    amount,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Transfer", decoded.Name)
+	assert.Equal(t, big.NewInt(500), decoded.Inputs["value"])
+
+	// The ERC721 one the token id in a third topic
+	decoded, err = r.Decode(types.Log{
+		Address: nftB,
+		Topics:  []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes()), common.BigToHash(big.NewInt(7))},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(7), decoded.Inputs["tokenId"])
+	assert.Equal(t, receiver, decoded.Inputs["to"])
+
+	// Other contracts have no ABI
+	_, err = r.Decode(types.Log{Address: sender, Topics: []common.Hash{transferID}})
+	assert.ErrorContains(t, err, "not found in registry")
+}
+
+func TestRegistry_GlobalFallback(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.AddABI(erc20TransferABI))
+	assert.NoError(t, r.AddABI(erc721TransferABI, WithAddresses(nftB)))
+
+	// Any contract but the scoped one decodes with the unscoped ABI
+	decoded, err := r.Decode(types.Log{
+		Address: tokenA,
+		Topics:  []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:    common.LeftPadBytes(big.NewInt(1).Bytes(), 32),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(1), decoded.Inputs["value"])
+
+	_, err = r.Decode(types.Log{})
+	assert.ErrorContains(t, err, "no topics")
+}
+
+func TestRegistry_Conflict(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.AddABI(erc20TransferABI))
+	// The same declaration again is accepted, along with its new events
+	assert.NoError(t, r.AddABI(memoTransferABI))
+	assert.Len(t, r.Topics(), 2)
+
+	// A different layout with as many indexed parameters in the same scope is
+	// ambiguous, unlike one told apart by its topic count
+	err := r.AddABI(`[{"anonymous":false,"inputs":[{"indexed":false,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":true,"name":"amount","type":"uint256"}],"name":"Transfer","type":"event"}]`)
+	assert.ErrorContains(t, err, "conflicts with registered")
+	assert.NoError(t, r.AddABI(erc721TransferABI))
+	assert.NoError(t, r.AddABI(erc721TransferABI, WithAddresses(nftB)))
+
+	decoded, err := r.Decode(types.Log{Topics: []common.Hash{transferID, {}, {}, common.BigToHash(big.NewInt(7))}})
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(7), decoded.Inputs["tokenId"])
+	decoded, err = r.Decode(types.Log{Topics: []common.Hash{transferID, {}, {}}, Data: common.LeftPadBytes([]byte{7}, 32)})
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(7), decoded.Inputs["value"])
+
+	assert.Error(t, r.AddABI("invalid json"))
+}
+
+func TestRegistry_ListEvents(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.AddABI(memoTransferABI))
+	assert.NoError(t, r.AddABI(erc721TransferABI, WithAddresses(nftB, tokenA)))
+
+	events := r.ListEvents()
+	assert.Len(t, events, 3)
+	assert.Equal(t, "Memo", events[0].Name)
+	assert.Equal(t, crypto.Keccak256Hash([]byte("Memo(string)")), events[0].Topic0)
+	assert.Empty(t, events[0].Addresses)
+
+	// Both Transfer declarations share their topic0
+	assert.Equal(t, "Transfer", events[1].Name)
+	assert.Equal(t, transferID, events[1].Topic0)
+	assert.Contains(t, events[1].Signature, "uint256 indexed tokenId")
+	assert.Equal(t, []common.Address{tokenA, nftB}, events[1].Addresses)
+	assert.Equal(t, transferID, events[2].Topic0)
+	assert.Contains(t, events[2].Signature, "uint256 value")
+	assert.Empty(t, events[2].Addresses)
+
+	assert.ElementsMatch(t, []common.Hash{crypto.Keccak256Hash([]byte("Memo(string)")), transferID}, r.Topics())
+}
+
+func TestRegistry_DecodeBatch(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.AddABI(erc20TransferABI, WithAddresses(tokenA)))
+	assert.NoError(t, r.AddABI(erc721TransferABI, WithAddresses(nftB)))
+
+	topics := []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())}
+	logs := []types.Log{
+		{Address: tokenA, Topics: topics, Data: common.LeftPadBytes(big.NewInt(1).Bytes(), 32)},
+		{Address: nftB, Topics: append(topics, common.BigToHash(big.NewInt(7))), TxHash: common.HexToHash("0x01"), Index: 3},
+		{Address: tokenA, Topics: topics, Data: common.LeftPadBytes(big.NewInt(2).Bytes(), 32)},
+		{Address: tokenA, Topics: topics[:2], TxHash: common.HexToHash("0x02"), Index: 5},
+		{Address: sender, Topics: topics},
+	}
+	results, errs := r.DecodeBatch(logs)
+	assert.Len(t, results, 5)
+	assert.Equal(t, big.NewInt(1), results[0].Inputs["value"])
+	assert.Equal(t, big.NewInt(7), results[1].Inputs["tokenId"])
+	assert.Equal(t, big.NewInt(2), results[2].Inputs["value"])
+	assert.Nil(t, results[3])
+	assert.Nil(t, results[4])
+
+	// Failures are reported per log, with what identifies it
+	assert.Len(t, errs, 2)
+	assert.Equal(t, 3, errs[0].Index)
+	assert.Equal(t, common.HexToHash("0x02"), errs[0].TxHash)
+	assert.Equal(t, uint(5), errs[0].LogIndex)
+	assert.ErrorContains(t, errs[0], "topic count mismatch")
+	assert.Equal(t, 4, errs[1].Index)
+	assert.ErrorContains(t, errs[1], "not found in registry")
+
+	// Results match those of Decode
+	for i, l := range logs[:3] {
+		decoded, err := r.Decode(l)
+		assert.NoError(t, err)
+		assert.Equal(t, decoded, results[i])
+	}
+}
+
+func benchmarkLogs() (*Registry, []types.Log) {
+	r := NewRegistry()
+	_ = r.AddABI(memoTransferABI)
+	_ = r.AddABI(erc721TransferABI, WithAddresses(nftB))
+	logs := make([]types.Log, 1000)
+	for i := range logs {
+		logs[i] = types.Log{
+			Address: tokenA,
+			Topics:  []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+			Data:    common.LeftPadBytes(big.NewInt(int64(i)).Bytes(), 32),
+		}
+	}
+	return r, logs
+}
+
+func BenchmarkRegistry_Decode(b *testing.B) {
+	r, logs := benchmarkLogs()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		for _, l := range logs {
+			_, _ = r.Decode(l)
+		}
+	}
+}
+
+func BenchmarkRegistry_DecodeBatch(b *testing.B) {
+	r, logs := benchmarkLogs()
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		_, _ = r.DecodeBatch(logs)
+	}
+}
@@ -0,0 +1,227 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/time/rate"
+)
+
+// SignatureResolver looks up the text signatures, e.g.
+// "Transfer(address,address,uint256)", of an event topic0. It returns no
+// signatures and no error for an unknown topic.
+type SignatureResolver interface {
+	ResolveEvent(ctx context.Context, topic0 common.Hash) ([]string, error)
+}
+
+// SignatureFile is a SignatureResolver on a local signature database.
+type SignatureFile struct {
+	signatures map[common.Hash][]string
+}
+
+var _ SignatureResolver = (*SignatureFile)(nil)
+
+// NewSignatureFile loads a signature database, see LoadSignatures.
+func NewSignatureFile(path string) (*SignatureFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db, err := LoadSignatures(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// LoadSignatures reads a signature database in one of these formats:
+//   - text, one signature per line, optionally after its topic0 and a comma,
+//     colon or spaces; blank lines and lines starting with "#" are skipped
+//   - an openchain lookup response: {"result": {"event": {"0x...": [{"name": "..."}]}}}
+//   - a 4byte.directory event signature listing: {"results": [{"hex_signature": "0x...", "text_signature": "..."}]}
+//
+// Topics given with a signature must be its keccak256 hash.
+func LoadSignatures(r io.Reader) (*SignatureFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	db := &SignatureFile{signatures: make(map[common.Hash][]string)}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return db, db.loadJSON(trimmed)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var topic string
+		if strings.HasPrefix(text, "0x") {
+			if i := strings.IndexAny(text, ",: \t"); i > 0 {
+				topic, text = text[:i], strings.TrimLeft(text[i:], ",: \t")
+			}
+		}
+		if err := db.add(topic, text); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return db, scanner.Err()
+}
+
+func (db *SignatureFile) loadJSON(data []byte) error {
+	var dump struct {
+		Result struct {
+			Event map[string][]struct {
+				Name string `json:"name"`
+			} `json:"event"`
+		} `json:"result"`
+		Results []struct {
+			Hex  string `json:"hex_signature"`
+			Text string `json:"text_signature"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return err
+	}
+	for topic, entries := range dump.Result.Event {
+		for _, e := range entries {
+			if err := db.add(topic, e.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range dump.Results {
+		if err := db.add(e.Hex, e.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add records signature under topic, which may be empty to have it computed.
+func (db *SignatureFile) add(topic, signature string) error {
+	if !strings.HasSuffix(signature, ")") || !strings.Contains(signature, "(") {
+		return fmt.Errorf("invalid event signature %q", signature)
+	}
+	id := crypto.Keccak256Hash([]byte(signature))
+	if topic != "" && common.HexToHash(topic) != id {
+		return fmt.Errorf("topic %s does not match signature %q", topic, signature)
+	}
+	for _, known := range db.signatures[id] {
+		if known == signature {
+			return nil
+		}
+	}
+	db.signatures[id] = append(db.signatures[id], signature)
+	return nil
+}
+
+// ResolveEvent returns the signatures recorded for topic0.
+func (db *SignatureFile) ResolveEvent(_ context.Context, topic0 common.Hash) ([]string, error) {
+	return db.signatures[topic0], nil
+}
+
+// HTTPResolverConfig configures an HTTPResolver.
+type HTTPResolverConfig struct {
+	URL       string        // Lookup endpoint, default "https://api.openchain.xyz/signature-database/v1/lookup"
+	RateLimit float64       // Requests per second, default 2. Lookups over the limit resolve nothing
+	Timeout   time.Duration // Per request, default 5s
+	CacheSize int           // Topics remembered, found or not, default 10000
+}
+
+// HTTPResolver is a SignatureResolver querying the openchain signature
+// database API. Results, including unknown topics, are cached; lookups over
+// the rate limit or failing are not, and are retried on a later log.
+type HTTPResolver struct {
+	url     string
+	client  *http.Client
+	limiter *rate.Limiter
+	size    int
+
+	mu    sync.Mutex
+	cache map[common.Hash][]string
+}
+
+var _ SignatureResolver = (*HTTPResolver)(nil)
+
+// NewHTTPResolver creates an HTTPResolver from cfg.
+func NewHTTPResolver(cfg HTTPResolverConfig) *HTTPResolver {
+	if cfg.URL == "" {
+		cfg.URL = "https://api.openchain.xyz/signature-database/v1/lookup"
+	}
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = 2
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = 10000
+	}
+	return &HTTPResolver{
+		url:     cfg.URL,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		limiter: rate.NewLimiter(rate.Limit(cfg.RateLimit), max(1, int(cfg.RateLimit))),
+		size:    cfg.CacheSize,
+		cache:   make(map[common.Hash][]string),
+	}
+}
+
+// ResolveEvent looks topic0 up in the cache, then in the signature database.
+func (h *HTTPResolver) ResolveEvent(ctx context.Context, topic0 common.Hash) ([]string, error) {
+	h.mu.Lock()
+	signatures, ok := h.cache[topic0]
+	h.mu.Unlock()
+	if ok {
+		return signatures, nil
+	}
+	// Decoding must not wait for the limit: skip this log instead
+	if !h.limiter.Allow() {
+		return nil, fmt.Errorf("signature lookup rate limited")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url+"?filter=true&event="+url.QueryEscape(topic0.Hex()), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signature lookup: unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	db := &SignatureFile{signatures: make(map[common.Hash][]string)}
+	if err := db.loadJSON(data); err != nil {
+		return nil, fmt.Errorf("signature lookup: %w", err)
+	}
+	signatures = db.signatures[topic0]
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.cache) >= h.size {
+		h.cache = make(map[common.Hash][]string) // Start over rather than track usage
+	}
+	h.cache[topic0] = signatures
+	return signatures, nil
+}
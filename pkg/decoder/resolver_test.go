@@ -0,0 +1,150 @@
+package decoder
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	approvalID = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+	depositID  = crypto.Keccak256Hash([]byte("Deposit(address,uint256)"))
+)
+
+func TestSignatureFile(t *testing.T) {
+	db, err := NewSignatureFile("testdata/signatures.txt")
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for id, want := range map[common.Hash]string{
+		transferID: "Transfer(address,address,uint256)",
+		approvalID: "Approval(address,address,uint256)",
+		depositID:  "Deposit(address,uint256)",
+	} {
+		sigs, err := db.ResolveEvent(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{want}, sigs)
+	}
+	sigs, err := db.ResolveEvent(ctx, common.Hash{})
+	assert.NoError(t, err)
+	assert.Empty(t, sigs)
+
+	_, err = NewSignatureFile("testdata/missing.txt")
+	assert.Error(t, err)
+}
+
+func TestLoadSignatures_Formats(t *testing.T) {
+	ctx := context.Background()
+	openchain := `{"ok":true,"result":{"event":{"` + transferID.Hex() + `":[{"name":"Transfer(address,address,uint256)","filtered":false}]},"function":{}}}`
+	fourByte := `{"count":1,"results":[{"id":1,"text_signature":"Transfer(address,address,uint256)","hex_signature":"` + transferID.Hex() + `"}]}`
+	for _, dump := range []string{openchain, fourByte} {
+		db, err := LoadSignatures(strings.NewReader(dump))
+		assert.NoError(t, err)
+		sigs, _ := db.ResolveEvent(ctx, transferID)
+		assert.Equal(t, []string{"Transfer(address,address,uint256)"}, sigs)
+	}
+
+	_, err := LoadSignatures(strings.NewReader("Transfer(address\n"))
+	assert.ErrorContains(t, err, `line 1: invalid event signature "Transfer(address"`)
+	_, err = LoadSignatures(strings.NewReader("# Wrong topic\n" + approvalID.Hex() + ":Transfer(address,address,uint256)\n"))
+	assert.ErrorContains(t, err, "line 2: topic "+approvalID.Hex()+" does not match")
+}
+
+func TestRegistry_Resolver(t *testing.T) {
+	db, err := NewSignatureFile("testdata/signatures.txt")
+	assert.NoError(t, err)
+	r := NewRegistry()
+	assert.NoError(t, r.AddABI(erc721TransferABI, WithAddresses(nftB)))
+
+	// Without a resolver, unknown events stay undecoded
+	l := types.Log{
+		Address: tokenA,
+		Topics:  []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:    common.LeftPadBytes(big.NewInt(9).Bytes(), 32),
+	}
+	_, err = r.Decode(l)
+	assert.ErrorContains(t, err, "not found in registry")
+
+	r.SetResolver(db)
+	decoded, err := r.Decode(l)
+	assert.NoError(t, err)
+	assert.True(t, decoded.Heuristic)
+	assert.Equal(t, "Transfer", decoded.Name)
+	assert.Equal(t, sender, decoded.Inputs["arg0"])
+	assert.Equal(t, receiver, decoded.Inputs["arg1"])
+	assert.Equal(t, big.NewInt(9), decoded.Inputs["arg2"])
+
+	// Registered ABIs take precedence
+	decoded, err = r.Decode(types.Log{Address: nftB, Topics: append(l.Topics, common.BigToHash(big.NewInt(1)))})
+	assert.NoError(t, err)
+	assert.False(t, decoded.Heuristic)
+	assert.Equal(t, big.NewInt(1), decoded.Inputs["tokenId"])
+
+	// The resolved signature must fit the topics and data
+	l.Data = append(l.Data, 0)
+	_, err = r.Decode(l)
+	assert.ErrorContains(t, err, "not found in registry")
+	_, err = r.Decode(types.Log{Topics: []common.Hash{crypto.Keccak256Hash([]byte("Unknown()"))}})
+	assert.ErrorContains(t, err, "not found in registry")
+}
+
+func TestHTTPResolver(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, "true", r.URL.Query().Get("filter"))
+		topic := r.URL.Query().Get("event")
+		var sigs string
+		if topic == depositID.Hex() {
+			sigs = `[{"name":"Deposit(address,uint256)","filtered":false}]`
+		} else {
+			sigs = "null"
+		}
+		fmt.Fprintf(w, `{"ok":true,"result":{"event":{%q:%s},"function":{}}}`, topic, sigs)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	h := NewHTTPResolver(HTTPResolverConfig{URL: srv.URL, RateLimit: 1000})
+	sigs, err := h.ResolveEvent(ctx, depositID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Deposit(address,uint256)"}, sigs)
+	sigs, err = h.ResolveEvent(ctx, common.Hash{})
+	assert.NoError(t, err)
+	assert.Empty(t, sigs)
+
+	// Found and unknown topics are both cached
+	_, _ = h.ResolveEvent(ctx, depositID)
+	_, _ = h.ResolveEvent(ctx, common.Hash{})
+	assert.Equal(t, int32(2), requests.Load())
+
+	// Lookups over the rate limit fail without waiting, and are not cached
+	h = NewHTTPResolver(HTTPResolverConfig{URL: srv.URL, RateLimit: 0.001})
+	_, err = h.ResolveEvent(ctx, depositID)
+	assert.NoError(t, err)
+	_, err = h.ResolveEvent(ctx, approvalID)
+	assert.ErrorContains(t, err, "rate limited")
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestHTTPResolver_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	r := NewRegistry()
+	r.SetResolver(NewHTTPResolver(HTTPResolverConfig{URL: srv.URL, RateLimit: 1000}))
+	_, err := r.Decode(types.Log{Topics: []common.Hash{depositID}})
+	assert.ErrorContains(t, err, "unexpected status 502")
+}
@@ -0,0 +1,207 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// NewFromSignatures creates a decoder from human-readable event fragments,
+// as written by ethers.js, e.g.
+//
+//	event Transfer(address indexed from, address indexed to, uint256 value)
+func NewFromSignatures(signatures []string) (*ABIWrapper, error) {
+	parsed, err := ParseSignatures(signatures)
+	if err != nil {
+		return nil, err
+	}
+	return newABIWrapper(parsed), nil
+}
+
+// ParseSignatures parses human-readable event fragments into the ABI their
+// JSON form would give. Parameters may be tuples, written "(uint256 a, address b)"
+// or "tuple(...)", and arrays; names are optional, "uint" and "int" stand for
+// their 256-bit types and "anonymous" may follow the parameter list.
+func ParseSignatures(signatures []string) (abi.ABI, error) {
+	events := make([]jsonEvent, 0, len(signatures))
+	for _, sig := range signatures {
+		p := &sigParser{src: sig}
+		event, err := p.event()
+		if err == nil {
+			// Check the types here, so that the error names the fragment
+			_, err = eventsABI([]jsonEvent{event})
+		}
+		if err != nil {
+			return abi.ABI{}, fmt.Errorf("signature %q: %w", sig, err)
+		}
+		events = append(events, event)
+	}
+	return eventsABI(events)
+}
+
+func eventsABI(events []jsonEvent) (abi.ABI, error) {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return abi.ABI{}, err
+	}
+	return abi.JSON(strings.NewReader(string(data)))
+}
+
+// jsonEvent and jsonArg are the JSON ABI entries a fragment stands for.
+type jsonEvent struct {
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	Inputs    []jsonArg `json:"inputs"`
+	Anonymous bool      `json:"anonymous"`
+}
+
+type jsonArg struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Indexed    bool      `json:"indexed,omitempty"`
+	Components []jsonArg `json:"components,omitempty"`
+}
+
+// sigParser reads one fragment.
+type sigParser struct {
+	src string
+	pos int
+}
+
+func (p *sigParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *sigParser) skipSpace() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end.
+func (p *sigParser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *sigParser) ident() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c != '_' && c != '$' && (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *sigParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *sigParser) event() (jsonEvent, error) {
+	if kw := p.ident(); kw != "event" {
+		return jsonEvent{}, p.errorf("expected \"event\", got %q", kw)
+	}
+	event := jsonEvent{Type: "event", Name: p.ident()}
+	if event.Name == "" {
+		return jsonEvent{}, p.errorf("missing event name")
+	}
+	inputs, err := p.params(true)
+	if err != nil {
+		return jsonEvent{}, err
+	}
+	event.Inputs = inputs
+	if p.peek() == 0 {
+		return event, nil
+	}
+	rest := p.pos
+	if p.ident() != "anonymous" || p.peek() != 0 {
+		p.pos = rest
+		return jsonEvent{}, p.errorf("unexpected %q", p.src[rest:])
+	}
+	event.Anonymous = true
+	return event, nil
+}
+
+// params reads a parenthesized parameter list; only event inputs may be indexed.
+func (p *sigParser) params(event bool) ([]jsonArg, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	args := []jsonArg{}
+	if p.peek() == ')' {
+		p.pos++
+		return args, nil
+	}
+	for {
+		arg, err := p.param(event)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return args, nil
+		default:
+			return nil, p.errorf("expected \",\" or \")\"")
+		}
+	}
+}
+
+func (p *sigParser) param(event bool) (jsonArg, error) {
+	var arg jsonArg
+	start := p.pos
+	if p.peek() != '(' {
+		arg.Type = p.ident()
+	}
+	switch {
+	case arg.Type == "tuple" || arg.Type == "" && p.peek() == '(':
+		components, err := p.params(false)
+		if err != nil {
+			return jsonArg{}, err
+		}
+		arg.Type, arg.Components = "tuple", components
+	case arg.Type == "":
+		return jsonArg{}, p.errorf("expected a type")
+	case arg.Type == "uint" || arg.Type == "int":
+		arg.Type += "256"
+	}
+
+	// Array dimensions, e.g. uint256[] or (address,uint256)[2]
+	for p.peek() == '[' {
+		end := strings.IndexByte(p.src[p.pos:], ']')
+		if end < 0 {
+			return jsonArg{}, p.errorf("unterminated array type")
+		}
+		arg.Type += p.src[p.pos : p.pos+end+1]
+		p.pos += end + 1
+	}
+
+	arg.Name = p.ident()
+	if arg.Name == "indexed" {
+		if !event {
+			return jsonArg{}, p.errorf("tuple components cannot be indexed")
+		}
+		arg.Indexed = true
+		arg.Name = p.ident()
+	}
+	if p.pos == start {
+		return jsonArg{}, p.errorf("expected a parameter")
+	}
+	return arg, nil
+}
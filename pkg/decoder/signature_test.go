@@ -0,0 +1,108 @@
+package decoder
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fragments and the JSON ABI of the same events
+var (
+	testSignatures = []string{
+		"event Transfer(address indexed from, address indexed to, uint256 value)",
+		"event Swap(address indexed sender, address indexed recipient, int256 amount0, int amount1, uint160 sqrtPriceX96, uint128 liquidity, int24 tick)",
+		"event Batch( address indexed operator , (address token, uint256[] ids) [] items, bytes32[2] roots )",
+		"event Order(tuple(address maker, tuple(uint8 kind, uint amount) asset) order, string)",
+	}
+	testSignaturesABI = `[
+		{"type":"event","name":"Transfer","inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"name":"value","type":"uint256"}]},
+		{"type":"event","name":"Swap","inputs":[{"indexed":true,"name":"sender","type":"address"},{"indexed":true,"name":"recipient","type":"address"},{"name":"amount0","type":"int256"},{"name":"amount1","type":"int256"},{"name":"sqrtPriceX96","type":"uint160"},{"name":"liquidity","type":"uint128"},{"name":"tick","type":"int24"}]},
+		{"type":"event","name":"Batch","inputs":[{"indexed":true,"name":"operator","type":"address"},{"name":"items","type":"tuple[]","components":[{"name":"token","type":"address"},{"name":"ids","type":"uint256[]"}]},{"name":"roots","type":"bytes32[2]"}]},
+		{"type":"event","name":"Order","inputs":[{"name":"order","type":"tuple","components":[{"name":"maker","type":"address"},{"name":"asset","type":"tuple","components":[{"name":"kind","type":"uint8"},{"name":"amount","type":"uint256"}]}]},{"name":"","type":"string"}]}
+	]`
+)
+
+func TestParseSignatures_MatchesJSON(t *testing.T) {
+	fromSigs, err := ParseSignatures(testSignatures)
+	assert.NoError(t, err)
+	fromJSON, err := NewFromJSON(testSignaturesABI)
+	assert.NoError(t, err)
+
+	assert.Len(t, fromSigs.Events, 4)
+	for name, want := range fromJSON.parsedABI.Events {
+		got, ok := fromSigs.Events[name]
+		assert.True(t, ok, name)
+		assert.Equal(t, want.ID, got.ID, name)
+		assert.Equal(t, want.String(), got.String(), name)
+	}
+}
+
+func TestNewFromSignatures_Decode(t *testing.T) {
+	bySigs, err := NewFromSignatures(testSignatures)
+	assert.NoError(t, err)
+	byJSON, err := NewFromJSON(testSignaturesABI)
+	assert.NoError(t, err)
+
+	// A Swap with negative amounts, and a Batch with tuple arrays
+	swap := byJSON.parsedABI.Events["Swap"]
+	swapData, err := swap.Inputs.NonIndexed().Pack(big.NewInt(-5), big.NewInt(7), big.NewInt(1<<40), big.NewInt(3), big.NewInt(-200))
+	assert.NoError(t, err)
+	batch := byJSON.parsedABI.Events["Batch"]
+	items := []struct {
+		Token common.Address
+		Ids   []*big.Int
+	}{{Token: receiver, Ids: []*big.Int{big.NewInt(1), big.NewInt(2)}}}
+	batchData, err := batch.Inputs.NonIndexed().Pack(items, [2][32]byte{{1}, {2}})
+	assert.NoError(t, err)
+
+	logs := []types.Log{
+		{Topics: []common.Hash{swap.ID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())}, Data: swapData},
+		{Topics: []common.Hash{batch.ID, common.BytesToHash(sender.Bytes())}, Data: batchData},
+	}
+	for _, l := range logs {
+		want, err := byJSON.Decode(l)
+		assert.NoError(t, err)
+		got, err := bySigs.Decode(l)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	decoded, err := bySigs.Decode(logs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(-5), decoded.Inputs["amount0"])
+	assert.Equal(t, sender, decoded.Inputs["sender"])
+}
+
+func TestParseSignatures_Anonymous(t *testing.T) {
+	parsed, err := ParseSignatures([]string{"event LogNote(bytes4 indexed sig, address indexed guy) anonymous"})
+	assert.NoError(t, err)
+	assert.True(t, parsed.Events["LogNote"].Anonymous)
+}
+
+func TestParseSignatures_Errors(t *testing.T) {
+	for sig, msg := range map[string]string{
+		"function transfer(address to, uint256 value)":  `expected "event"`,
+		"event (address a)":                             "missing event name",
+		"event Transfer(address indexed from":           `expected "," or ")"`,
+		"event Transfer(address from,)":                 "expected a type",
+		"event Transfer(address from) extra":            `unexpected "extra"`,
+		"event Order((address indexed maker) order)":    "cannot be indexed",
+		"event Transfer(uint256[ value)":                "unterminated array",
+		"event Transfer(address from, bytes33 value)":   "unsupported arg type: bytes33",
+		"event Transfer(address from, address to) anon": `unexpected "anon"`,
+	} {
+		_, err := ParseSignatures([]string{"event Ok()", sig})
+		assert.ErrorContains(t, err, sig, sig)
+		assert.ErrorContains(t, err, msg, sig)
+	}
+}
+
+func TestRegistry_AddSignatures(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.AddSignatures(testSignatures[:1], WithAddresses(tokenA)))
+	assert.Equal(t, []common.Hash{transferID}, r.Topics())
+	assert.ErrorContains(t, r.AddSignatures([]string{"event"}), `signature "event"`)
+}
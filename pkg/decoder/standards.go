@@ -0,0 +1,118 @@
+package decoder
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Standard is a set of well-known events, in the human-readable form
+// NewFromSignatures takes.
+type Standard struct {
+	Name   string
+	Events []string
+}
+
+// ERC20 holds the events of ERC20 tokens.
+var ERC20 = Standard{Name: "ERC20", Events: []string{
+	"event Transfer(address indexed from, address indexed to, uint256 value)",
+	"event Approval(address indexed owner, address indexed spender, uint256 value)",
+}}
+
+// ERC721 holds the events of ERC721 tokens. Its Transfer and Approval events
+// share their topic0 with the ERC20 ones but index the token ID, which a
+// Registry tells apart by the number of topics of the log.
+var ERC721 = Standard{Name: "ERC721", Events: []string{
+	"event Transfer(address indexed from, address indexed to, uint256 indexed tokenId)",
+	"event Approval(address indexed owner, address indexed approved, uint256 indexed tokenId)",
+	"event ApprovalForAll(address indexed owner, address indexed operator, bool approved)",
+}}
+
+// ERC1155 holds the transfer events of ERC1155 tokens. Its ApprovalForAll event
+// is the ERC721 one with another parameter name, and left to ERC721.
+var ERC1155 = Standard{Name: "ERC1155", Events: []string{
+	"event TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id, uint256 value)",
+	"event TransferBatch(address indexed operator, address indexed from, address indexed to, uint256[] ids, uint256[] values)",
+	"event URI(string value, uint256 indexed id)",
+}}
+
+// WETH holds the wrapping events of WETH9, which otherwise emits ERC20 events.
+var WETH = Standard{Name: "WETH", Events: []string{
+	"event Deposit(address indexed dst, uint256 wad)",
+	"event Withdrawal(address indexed src, uint256 wad)",
+}}
+
+// UniswapV2 holds the events of Uniswap V2 pairs, which also emit ERC20
+// events, and of their factory.
+var UniswapV2 = Standard{Name: "UniswapV2", Events: []string{
+	"event Mint(address indexed sender, uint256 amount0, uint256 amount1)",
+	"event Burn(address indexed sender, uint256 amount0, uint256 amount1, address indexed to)",
+	"event Swap(address indexed sender, uint256 amount0In, uint256 amount1In, uint256 amount0Out, uint256 amount1Out, address indexed to)",
+	"event Sync(uint112 reserve0, uint112 reserve1)",
+	"event PairCreated(address indexed token0, address indexed token1, address pair, uint256 pairCount)",
+}}
+
+// UniswapV3 holds the events of Uniswap V3 pools and of their factory.
+var UniswapV3 = Standard{Name: "UniswapV3", Events: []string{
+	"event Initialize(uint160 sqrtPriceX96, int24 tick)",
+	"event Mint(address sender, address indexed owner, int24 indexed tickLower, int24 indexed tickUpper, uint128 amount, uint256 amount0, uint256 amount1)",
+	"event Collect(address indexed owner, address recipient, int24 indexed tickLower, int24 indexed tickUpper, uint128 amount0, uint128 amount1)",
+	"event Burn(address indexed owner, int24 indexed tickLower, int24 indexed tickUpper, uint128 amount, uint256 amount0, uint256 amount1)",
+	"event Swap(address indexed sender, address indexed recipient, int256 amount0, int256 amount1, uint160 sqrtPriceX96, uint128 liquidity, int24 tick)",
+	"event Flash(address indexed sender, address indexed recipient, uint256 amount0, uint256 amount1, uint256 paid0, uint256 paid1)",
+	"event PoolCreated(address indexed token0, address indexed token1, uint24 indexed fee, int24 tickSpacing, address pool)",
+}}
+
+// Standards lists the built-in standards, which can all share a Registry.
+var Standards = []Standard{ERC20, ERC721, ERC1155, WETH, UniswapV2, UniswapV3}
+
+// The topic0 of the standard events, e.g. to filter on them.
+var (
+	TopicERC20Transfer         = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	TopicERC20Approval         = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+	TopicERC721Transfer        = TopicERC20Transfer // Told apart by its 4 topics
+	TopicERC721Approval        = TopicERC20Approval // Told apart by its 4 topics
+	TopicERC721ApprovalForAll  = crypto.Keccak256Hash([]byte("ApprovalForAll(address,address,bool)"))
+	TopicERC1155TransferSingle = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	TopicERC1155TransferBatch  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+	TopicERC1155URI            = crypto.Keccak256Hash([]byte("URI(string,uint256)"))
+	TopicWETHDeposit           = crypto.Keccak256Hash([]byte("Deposit(address,uint256)"))
+	TopicWETHWithdrawal        = crypto.Keccak256Hash([]byte("Withdrawal(address,uint256)"))
+	TopicUniswapV2Swap         = crypto.Keccak256Hash([]byte("Swap(address,uint256,uint256,uint256,uint256,address)"))
+	TopicUniswapV2Sync         = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+	TopicUniswapV2Mint         = crypto.Keccak256Hash([]byte("Mint(address,uint256,uint256)"))
+	TopicUniswapV2Burn         = crypto.Keccak256Hash([]byte("Burn(address,uint256,uint256,address)"))
+	TopicUniswapV2PairCreated  = crypto.Keccak256Hash([]byte("PairCreated(address,address,address,uint256)"))
+	TopicUniswapV3Swap         = crypto.Keccak256Hash([]byte("Swap(address,address,int256,int256,uint160,uint128,int24)"))
+	TopicUniswapV3Mint         = crypto.Keccak256Hash([]byte("Mint(address,address,int24,int24,uint128,uint256,uint256)"))
+	TopicUniswapV3Burn         = crypto.Keccak256Hash([]byte("Burn(address,int24,int24,uint128,uint256,uint256)"))
+	TopicUniswapV3Collect      = crypto.Keccak256Hash([]byte("Collect(address,address,int24,int24,uint128,uint128)"))
+	TopicUniswapV3Flash        = crypto.Keccak256Hash([]byte("Flash(address,address,uint256,uint256,uint256,uint256)"))
+	TopicUniswapV3Initialize   = crypto.Keccak256Hash([]byte("Initialize(uint160,int24)"))
+	TopicUniswapV3PoolCreated  = crypto.Keccak256Hash([]byte("PoolCreated(address,address,uint24,int24,address)"))
+)
+
+// ABI returns a decoder for the events of s.
+func (s Standard) ABI() (*ABIWrapper, error) {
+	return NewFromSignatures(s.Events)
+}
+
+// Register adds the events of s to r, see AddSignatures.
+func (s Standard) Register(r *Registry, opts ...ABIOption) error {
+	return r.AddSignatures(s.Events, opts...)
+}
+
+// NewStandardRegistry returns a Registry with the unscoped events of
+// standards, or of all the built-in Standards if none is given.
+func NewStandardRegistry(standards ...Standard) (*Registry, error) {
+	if len(standards) == 0 {
+		standards = Standards
+	}
+	r := NewRegistry()
+	for _, s := range standards {
+		if err := s.Register(r); err != nil {
+			return nil, fmt.Errorf("standard %s: %w", s.Name, err)
+		}
+	}
+	return r, nil
+}
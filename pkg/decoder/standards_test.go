@@ -0,0 +1,244 @@
+package decoder
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Mainnet contracts emitting the standard events
+var (
+	usdc         = common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	weth         = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	bayc         = common.HexToAddress("0xBC4CA0EdA7647A8aB7C2061c2E118A18a936f13D")
+	sharedStore  = common.HexToAddress("0x495f947276749Ce646f68AC8c248420045cb7b5e")
+	v2Factory    = common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f")
+	v2Pair       = common.HexToAddress("0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc") // USDC/WETH
+	v3Factory    = common.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984")
+	v3Pool       = common.HexToAddress("0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640") // USDC/WETH 0.05%
+	v2Router     = common.HexToAddress("0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D")
+	v3Router     = common.HexToAddress("0xE592427A0AEce92De3Edac8Ca4E2f91c9DbA2B1C")
+	openseaProxy = common.HexToAddress("0x1E0049783F008A0085193E00003D00cd54003c71")
+)
+
+// zero is 0 as decoded, which DeepEqual tells from big.NewInt(0)
+var zero = new(big.Int).SetBytes(make([]byte, 32))
+
+func word(v int64) common.Hash {
+	return common.BigToHash(math.U256(big.NewInt(v)))
+}
+
+func words(vs ...int64) []byte {
+	var data []byte
+	for _, v := range vs {
+		data = append(data, word(v).Bytes()...)
+	}
+	return data
+}
+
+func addressTopic(a common.Address) common.Hash {
+	return common.BytesToHash(a.Bytes())
+}
+
+func TestStandards_Decode(t *testing.T) {
+	r, err := NewStandardRegistry()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		log    types.Log
+		event  string
+		inputs map[string]interface{}
+	}{
+		{
+			name: "ERC20 Transfer",
+			log: types.Log{Address: usdc, Topics: []common.Hash{TopicERC20Transfer, addressTopic(sender), addressTopic(receiver)},
+				Data: words(2500000000)},
+			event:  "Transfer",
+			inputs: map[string]interface{}{"from": sender, "to": receiver, "value": big.NewInt(2500000000)},
+		},
+		{
+			name: "ERC20 Approval",
+			log: types.Log{Address: usdc, Topics: []common.Hash{TopicERC20Approval, addressTopic(sender), addressTopic(v2Router)},
+				Data: words(-1)},
+			event:  "Approval",
+			inputs: map[string]interface{}{"owner": sender, "spender": v2Router, "value": math.MaxBig256},
+		},
+		{
+			name:   "ERC721 Transfer",
+			log:    types.Log{Address: bayc, Topics: []common.Hash{TopicERC721Transfer, addressTopic(sender), addressTopic(receiver), word(8817)}},
+			event:  "Transfer",
+			inputs: map[string]interface{}{"from": sender, "to": receiver, "tokenId": big.NewInt(8817)},
+		},
+		{
+			name:   "ERC721 Approval",
+			log:    types.Log{Address: bayc, Topics: []common.Hash{TopicERC721Approval, addressTopic(sender), addressTopic(receiver), word(8817)}},
+			event:  "Approval",
+			inputs: map[string]interface{}{"owner": sender, "approved": receiver, "tokenId": big.NewInt(8817)},
+		},
+		{
+			name: "ERC721 ApprovalForAll",
+			log: types.Log{Address: bayc, Topics: []common.Hash{TopicERC721ApprovalForAll, addressTopic(sender), addressTopic(openseaProxy)},
+				Data: words(1)},
+			event:  "ApprovalForAll",
+			inputs: map[string]interface{}{"owner": sender, "operator": openseaProxy, "approved": true},
+		},
+		{
+			name: "ERC1155 TransferSingle",
+			log: types.Log{Address: sharedStore, Topics: []common.Hash{TopicERC1155TransferSingle, addressTopic(openseaProxy), addressTopic(sender), addressTopic(receiver)},
+				Data: words(42, 3)},
+			event:  "TransferSingle",
+			inputs: map[string]interface{}{"operator": openseaProxy, "from": sender, "to": receiver, "id": big.NewInt(42), "value": big.NewInt(3)},
+		},
+		{
+			name: "ERC1155 TransferBatch",
+			log: types.Log{Address: sharedStore, Topics: []common.Hash{TopicERC1155TransferBatch, addressTopic(openseaProxy), addressTopic(sender), addressTopic(receiver)},
+				Data: words(64, 160, 2, 42, 43, 2, 1, 5)},
+			event: "TransferBatch",
+			inputs: map[string]interface{}{"operator": openseaProxy, "from": sender, "to": receiver,
+				"ids": []*big.Int{big.NewInt(42), big.NewInt(43)}, "values": []*big.Int{big.NewInt(1), big.NewInt(5)}},
+		},
+		{
+			name: "ERC1155 URI",
+			log: types.Log{Address: sharedStore, Topics: []common.Hash{TopicERC1155URI, word(42)},
+				Data: append(words(32, 10), common.RightPadBytes([]byte("ipfs://abc"), 32)...)},
+			event:  "URI",
+			inputs: map[string]interface{}{"value": "ipfs://abc", "id": big.NewInt(42)},
+		},
+		{
+			name:   "WETH Deposit",
+			log:    types.Log{Address: weth, Topics: []common.Hash{TopicWETHDeposit, addressTopic(v2Router)}, Data: words(1e18)},
+			event:  "Deposit",
+			inputs: map[string]interface{}{"dst": v2Router, "wad": big.NewInt(1e18)},
+		},
+		{
+			name:   "WETH Withdrawal",
+			log:    types.Log{Address: weth, Topics: []common.Hash{TopicWETHWithdrawal, addressTopic(v2Router)}, Data: words(5e17)},
+			event:  "Withdrawal",
+			inputs: map[string]interface{}{"src": v2Router, "wad": big.NewInt(5e17)},
+		},
+		{
+			name: "Uniswap V2 Swap",
+			log: types.Log{Address: v2Pair, Topics: []common.Hash{TopicUniswapV2Swap, addressTopic(v2Router), addressTopic(receiver)},
+				Data: words(0, 1e18, 2500000000, 0)},
+			event: "Swap",
+			inputs: map[string]interface{}{"sender": v2Router, "to": receiver, "amount0In": zero, "amount1In": big.NewInt(1e18),
+				"amount0Out": big.NewInt(2500000000), "amount1Out": zero},
+		},
+		{
+			name:   "Uniswap V2 Sync",
+			log:    types.Log{Address: v2Pair, Topics: []common.Hash{TopicUniswapV2Sync}, Data: words(30000000000000, 12000e18/1e6)},
+			event:  "Sync",
+			inputs: map[string]interface{}{"reserve0": big.NewInt(30000000000000), "reserve1": big.NewInt(12000e18 / 1e6)},
+		},
+		{
+			name: "Uniswap V2 Mint",
+			log: types.Log{Address: v2Pair, Topics: []common.Hash{TopicUniswapV2Mint, addressTopic(v2Router)},
+				Data: words(2500000000, 1e18)},
+			event:  "Mint",
+			inputs: map[string]interface{}{"sender": v2Router, "amount0": big.NewInt(2500000000), "amount1": big.NewInt(1e18)},
+		},
+		{
+			name: "Uniswap V2 Burn",
+			log: types.Log{Address: v2Pair, Topics: []common.Hash{TopicUniswapV2Burn, addressTopic(v2Router), addressTopic(receiver)},
+				Data: words(2500000000, 1e18)},
+			event:  "Burn",
+			inputs: map[string]interface{}{"sender": v2Router, "to": receiver, "amount0": big.NewInt(2500000000), "amount1": big.NewInt(1e18)},
+		},
+		{
+			name: "Uniswap V2 PairCreated",
+			log: types.Log{Address: v2Factory, Topics: []common.Hash{TopicUniswapV2PairCreated, addressTopic(usdc), addressTopic(weth)},
+				Data: append(addressTopic(v2Pair).Bytes(), words(12)...)},
+			event:  "PairCreated",
+			inputs: map[string]interface{}{"token0": usdc, "token1": weth, "pair": v2Pair, "pairCount": big.NewInt(12)},
+		},
+		{
+			name: "Uniswap V3 Swap",
+			log: types.Log{Address: v3Pool, Topics: []common.Hash{TopicUniswapV3Swap, addressTopic(v3Router), addressTopic(receiver)},
+				Data: words(-2500000000, 1e18, 1<<40, 9e15, -195000)},
+			event: "Swap",
+			inputs: map[string]interface{}{"sender": v3Router, "recipient": receiver, "amount0": big.NewInt(-2500000000), "amount1": big.NewInt(1e18),
+				"sqrtPriceX96": big.NewInt(1 << 40), "liquidity": big.NewInt(9e15), "tick": big.NewInt(-195000)},
+		},
+		{
+			name: "Uniswap V3 Mint",
+			log: types.Log{Address: v3Pool, Topics: []common.Hash{TopicUniswapV3Mint, addressTopic(sender), word(-195010), word(-194990)},
+				Data: append(addressTopic(v3Router).Bytes(), words(5e12, 2500000000, 1e18)...)},
+			event: "Mint",
+			inputs: map[string]interface{}{"sender": v3Router, "owner": sender, "tickLower": big.NewInt(-195010), "tickUpper": big.NewInt(-194990),
+				"amount": big.NewInt(5e12), "amount0": big.NewInt(2500000000), "amount1": big.NewInt(1e18)},
+		},
+		{
+			name: "Uniswap V3 Burn",
+			log: types.Log{Address: v3Pool, Topics: []common.Hash{TopicUniswapV3Burn, addressTopic(sender), word(-195010), word(-194990)},
+				Data: words(5e12, 2500000000, 1e18)},
+			event: "Burn",
+			inputs: map[string]interface{}{"owner": sender, "tickLower": big.NewInt(-195010), "tickUpper": big.NewInt(-194990),
+				"amount": big.NewInt(5e12), "amount0": big.NewInt(2500000000), "amount1": big.NewInt(1e18)},
+		},
+		{
+			name: "Uniswap V3 Collect",
+			log: types.Log{Address: v3Pool, Topics: []common.Hash{TopicUniswapV3Collect, addressTopic(sender), word(-195010), word(-194990)},
+				Data: append(addressTopic(receiver).Bytes(), words(1250000, 5e14)...)},
+			event: "Collect",
+			inputs: map[string]interface{}{"owner": sender, "recipient": receiver, "tickLower": big.NewInt(-195010), "tickUpper": big.NewInt(-194990),
+				"amount0": big.NewInt(1250000), "amount1": big.NewInt(5e14)},
+		},
+		{
+			name: "Uniswap V3 Flash",
+			log: types.Log{Address: v3Pool, Topics: []common.Hash{TopicUniswapV3Flash, addressTopic(sender), addressTopic(receiver)},
+				Data: words(1e12, 0, 5e8, 0)},
+			event: "Flash",
+			inputs: map[string]interface{}{"sender": sender, "recipient": receiver, "amount0": big.NewInt(1e12), "amount1": zero,
+				"paid0": big.NewInt(5e8), "paid1": zero},
+		},
+		{
+			name:   "Uniswap V3 Initialize",
+			log:    types.Log{Address: v3Pool, Topics: []common.Hash{TopicUniswapV3Initialize}, Data: words(1<<40, -195000)},
+			event:  "Initialize",
+			inputs: map[string]interface{}{"sqrtPriceX96": big.NewInt(1 << 40), "tick": big.NewInt(-195000)},
+		},
+		{
+			name: "Uniswap V3 PoolCreated",
+			log: types.Log{Address: v3Factory, Topics: []common.Hash{TopicUniswapV3PoolCreated, addressTopic(usdc), addressTopic(weth), word(500)},
+				Data: append(words(10), addressTopic(v3Pool).Bytes()...)},
+			event:  "PoolCreated",
+			inputs: map[string]interface{}{"token0": usdc, "token1": weth, "fee": big.NewInt(500), "tickSpacing": big.NewInt(10), "pool": v3Pool},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := r.Decode(tt.log)
+			assert.NoError(t, err)
+			if assert.NotNil(t, decoded) {
+				assert.Equal(t, tt.event, decoded.Name)
+				assert.Equal(t, tt.inputs, decoded.Inputs)
+			}
+		})
+	}
+}
+
+func TestStandards_Registry(t *testing.T) {
+	assert.Equal(t, transferID, TopicERC20Transfer)
+	for _, s := range Standards {
+		w, err := s.ABI()
+		assert.NoError(t, err, s.Name)
+		assert.Len(t, w.parsedABI.Events, len(s.Events), s.Name)
+	}
+
+	// Scoped standards and the ERC20 and ERC721 events, told apart by topic count
+	r := NewRegistry()
+	assert.NoError(t, ERC20.Register(r))
+	assert.NoError(t, ERC721.Register(r))
+	assert.NoError(t, WETH.Register(r, WithAddresses(weth)))
+	assert.ElementsMatch(t, []common.Hash{TopicERC20Transfer, TopicERC20Approval, TopicERC721ApprovalForAll, TopicWETHDeposit, TopicWETHWithdrawal}, r.Topics())
+	_, err := r.Decode(types.Log{Address: usdc, Topics: []common.Hash{TopicWETHDeposit, addressTopic(sender)}, Data: words(1)})
+	assert.ErrorContains(t, err, "not found in registry")
+
+	_, err = NewStandardRegistry(ERC20, Standard{Name: "Fake", Events: []string{"event Transfer(address indexed src, address indexed dst, uint256 wad)"}})
+	assert.ErrorContains(t, err, "standard Fake: event Transfer")
+}
@@ -0,0 +1,218 @@
+package decoder
+
+import (
+	"fmt"
+	"go/format"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var bigIntType = reflect.TypeOf((*big.Int)(nil))
+
+// DecodeInto decodes log like Decode, then stores its inputs in the struct out
+// points to. Each input goes to the field tagged with its name, e.g.
+// `abi:"from"`, or else to the field named after it in CamelCase, as
+// abi.ToCamelCase spells it; tuples go into structs matched the same way.
+// Inputs without a field, tags naming no input and values the field cannot
+// hold are errors. Indexed string, bytes, array and tuple parameters need an
+// IndexedHash or common.Hash field.
+func (w *ABIWrapper) DecodeInto(log types.Log, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode into %T: not a pointer to a struct", out)
+	}
+	layout, topics, err := w.eventFor(log)
+	if err != nil {
+		return err
+	}
+	decoded, err := layout.decode(topics, log.Data)
+	if err != nil {
+		return err
+	}
+	event := layout.event
+
+	names := make([]string, len(event.Inputs))
+	for i, arg := range event.Inputs {
+		names[i] = arg.Name
+	}
+	err = setFields(v.Elem(), names, func(i int) reflect.Value {
+		return reflect.ValueOf(decoded.Inputs[names[i]])
+	})
+	if err != nil {
+		return fmt.Errorf("decode %s into %T: %w", event.Name, out, err)
+	}
+	return nil
+}
+
+// setFields stores the values of the named parameters in the fields of dst.
+func setFields(dst reflect.Value, names []string, value func(i int) reflect.Value) error {
+	fields, err := fieldsByName(dst.Type(), names)
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		index, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("no field for %q in %s", name, dst.Type())
+		}
+		if err := assign(dst.Field(index), value(i)); err != nil {
+			return fmt.Errorf("field %s: %w", dst.Type().Field(index).Name, err)
+		}
+	}
+	return nil
+}
+
+// fieldsByName maps parameter names to the index of their field in t.
+func fieldsByName(t reflect.Type, names []string) (map[string]int, error) {
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, tagged := f.Tag.Lookup("abi")
+		if !tagged || tag == "-" || !f.IsExported() {
+			continue
+		}
+		if !known[tag] {
+			return nil, fmt.Errorf("field %s: no parameter %q in %s", f.Name, tag, t)
+		}
+		fields[tag] = i
+	}
+	for _, name := range names {
+		if _, ok := fields[name]; ok {
+			continue
+		}
+		f, ok := t.FieldByName(abi.ToCamelCase(name))
+		if _, tagged := f.Tag.Lookup("abi"); ok && !tagged && len(f.Index) == 1 && f.IsExported() {
+			fields[name] = f.Index[0]
+		}
+	}
+	return fields, nil
+}
+
+// assign stores src in dst, converting between types of the same kind,
+// allocating pointers and matching tuple fields by name.
+func assign(dst, src reflect.Value) error {
+	dt, st := dst.Type(), src.Type()
+	switch {
+	case st.AssignableTo(dt):
+		dst.Set(src)
+	case st.ConvertibleTo(dt) && st.Kind() == dt.Kind():
+		dst.Set(src.Convert(dt))
+	case dt.Kind() == reflect.Ptr && dt != bigIntType:
+		ptr := reflect.New(dt.Elem())
+		if err := assign(ptr.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(ptr)
+	case dt.Kind() == reflect.Slice && st.Kind() == reflect.Slice:
+		slice := reflect.MakeSlice(dt, src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := assign(slice.Index(i), src.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		dst.Set(slice)
+	case dt.Kind() == reflect.Array && st.Kind() == reflect.Array && dt.Len() == st.Len():
+		for i := 0; i < src.Len(); i++ {
+			if err := assign(dst.Index(i), src.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	case dt.Kind() == reflect.Struct && st.Kind() == reflect.Struct:
+		// go-ethereum decodes tuples into structs tagged with the component names
+		names := make([]string, st.NumField())
+		for i := range names {
+			names[i] = st.Field(i).Tag.Get("json")
+		}
+		return setFields(dst, names, src.Field)
+	default:
+		return fmt.Errorf("cannot assign %s to %s", st, dt)
+	}
+	return nil
+}
+
+// GoStruct returns Go declarations of a struct DecodeInto can fill with the
+// inputs of the named event, followed by one per tuple parameter, for
+// copy-paste. They refer to the big, common and decoder packages.
+func (w *ABIWrapper) GoStruct(eventName string) (string, error) {
+	event, ok := w.parsedABI.Events[eventName]
+	if !ok {
+		return "", fmt.Errorf("event %q not found in ABI", eventName)
+	}
+	g := &structGen{seen: make(map[string]bool)}
+	typeName := abi.ToCamelCase(event.Name)
+	g.seen[typeName] = true
+	names := make([]string, len(event.Inputs))
+	types := make([]*abi.Type, len(event.Inputs))
+	indexed := make([]bool, len(event.Inputs))
+	for i, arg := range event.Inputs {
+		names[i], types[i], indexed[i] = arg.Name, &event.Inputs[i].Type, arg.Indexed
+	}
+	g.declare(typeName, fmt.Sprintf("holds the inputs of event %s.", event.Sig), names, types, indexed)
+
+	src, err := format.Source([]byte(strings.Join(g.decls, "\n")))
+	if err != nil {
+		return "", err
+	}
+	return string(src), nil
+}
+
+// structGen collects struct declarations.
+type structGen struct {
+	decls []string
+	seen  map[string]bool
+}
+
+func (g *structGen) declare(typeName, doc string, names []string, types []*abi.Type, indexed []bool) {
+	// Keep the declaration ahead of the ones of its tuples
+	at := len(g.decls)
+	g.decls = append(g.decls, "")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s %s\ntype %s struct {\n", typeName, doc, typeName)
+	for i, name := range names {
+		field := abi.ToCamelCase(name)
+		fmt.Fprintf(&b, "\t%s %s `abi:%q`\n", field, g.goType(typeName+field, *types[i], indexed[i]), name)
+	}
+	b.WriteString("}\n")
+	g.decls[at] = b.String()
+}
+
+// goType returns the Go type DecodeInto stores a parameter of type t in,
+// declaring a struct named name for a tuple.
+func (g *structGen) goType(name string, t abi.Type, indexed bool) string {
+	if indexed {
+		switch t.T {
+		case abi.StringTy, abi.BytesTy, abi.SliceTy, abi.ArrayTy, abi.TupleTy:
+			return "decoder.IndexedHash"
+		}
+	}
+	switch t.T {
+	case abi.TupleTy:
+		if t.TupleRawName != "" {
+			name = abi.ToCamelCase(t.TupleRawName)
+		}
+		if !g.seen[name] {
+			g.seen[name] = true
+			g.declare(name, fmt.Sprintf("is the %s tuple.", t.String()), t.TupleRawNames, t.TupleElems, make([]bool, len(t.TupleElems)))
+		}
+		return name
+	case abi.SliceTy:
+		return "[]" + g.goType(name, *t.Elem, false)
+	case abi.ArrayTy:
+		return fmt.Sprintf("[%d]%s", t.Size, g.goType(name, *t.Elem, false))
+	case abi.FixedBytesTy:
+		return fmt.Sprintf("[%d]byte", t.Size)
+	case abi.BytesTy:
+		return "[]byte"
+	default:
+		return t.GetType().String()
+	}
+}
@@ -0,0 +1,137 @@
+package decoder
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// A Uniswap V3 style swap with the amounts grouped in a tuple
+const swapSignature = "event Swap(address indexed sender, address indexed recipient, (int256 amount0, int256 amount1) amounts, uint160 sqrtPriceX96, uint128 liquidity, int24 tick)"
+
+type transferEvent struct {
+	From   common.Address `abi:"from"`
+	To     common.Address `abi:"to"`
+	Amount *big.Int       `abi:"value"`
+}
+
+type swapAmounts struct {
+	Amount0 *big.Int `abi:"amount0"`
+	Amount1 *big.Int
+}
+
+type swapEvent struct {
+	Sender       common.Address
+	Recipient    *common.Address
+	Amounts      swapAmounts `abi:"amounts"`
+	SqrtPriceX96 *big.Int    `abi:"sqrtPriceX96"`
+	Liquidity    *big.Int    `abi:"liquidity"`
+	Tick         *big.Int    `abi:"tick"`
+	Note         string      `abi:"-"`
+}
+
+func TestDecodeInto_Transfer(t *testing.T) {
+	w, err := NewFromJSON(erc20TransferABI)
+	assert.NoError(t, err)
+	l := types.Log{
+		Topics: []common.Hash{transferID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:   common.LeftPadBytes(big.NewInt(500).Bytes(), 32),
+	}
+	var got transferEvent
+	assert.NoError(t, w.DecodeInto(l, &got))
+	assert.Equal(t, transferEvent{From: sender, To: receiver, Amount: big.NewInt(500)}, got)
+
+	// Mismatched structs are reported
+	var missing struct {
+		From common.Address
+		To   common.Address
+	}
+	assert.ErrorContains(t, w.DecodeInto(l, &missing), `no field for "value"`)
+	var unknown struct {
+		transferEvent
+		Memo string `abi:"memo"`
+	}
+	assert.ErrorContains(t, w.DecodeInto(l, &unknown), `field Memo: no parameter "memo"`)
+	var wrongType struct {
+		From  common.Address
+		To    common.Address
+		Value uint64
+	}
+	assert.ErrorContains(t, w.DecodeInto(l, &wrongType), "field Value: cannot assign *big.Int to uint64")
+	assert.ErrorContains(t, w.DecodeInto(l, got), "not a pointer to a struct")
+}
+
+func TestDecodeInto_Tuple(t *testing.T) {
+	w, err := NewFromSignatures([]string{swapSignature})
+	assert.NoError(t, err)
+	event := w.parsedABI.Events["Swap"]
+	amounts := swapAmounts{Amount0: big.NewInt(-1000), Amount1: big.NewInt(2500)}
+	data, err := event.Inputs.NonIndexed().Pack(amounts, big.NewInt(1<<40), big.NewInt(77), big.NewInt(-887272))
+	assert.NoError(t, err)
+	l := types.Log{
+		Topics: []common.Hash{event.ID, common.BytesToHash(sender.Bytes()), common.BytesToHash(receiver.Bytes())},
+		Data:   data,
+	}
+
+	var got swapEvent
+	assert.NoError(t, w.DecodeInto(l, &got))
+	assert.Equal(t, swapEvent{
+		Sender:       sender,
+		Recipient:    &receiver,
+		Amounts:      amounts,
+		SqrtPriceX96: big.NewInt(1 << 40),
+		Liquidity:    big.NewInt(77),
+		Tick:         big.NewInt(-887272),
+	}, got)
+}
+
+func TestDecodeInto_IndexedHash(t *testing.T) {
+	w, err := NewFromSignatures([]string{"event Named(string indexed name, uint256 id)"})
+	assert.NoError(t, err)
+	event := w.parsedABI.Events["Named"]
+	name := crypto.Keccak256Hash([]byte("alice"))
+	l := types.Log{Topics: []common.Hash{event.ID, name}, Data: common.LeftPadBytes([]byte{1}, 32)}
+
+	var got struct {
+		Name common.Hash
+		ID   *big.Int `abi:"id"`
+	}
+	assert.NoError(t, w.DecodeInto(l, &got))
+	assert.Equal(t, name, got.Name)
+	assert.Equal(t, big.NewInt(1), got.ID)
+}
+
+func TestGoStruct(t *testing.T) {
+	w, err := NewFromSignatures([]string{swapSignature, "event Named(string indexed name, bytes32[2] keys, bytes data)"})
+	assert.NoError(t, err)
+
+	src, err := w.GoStruct("Swap")
+	assert.NoError(t, err)
+	assert.Equal(t, "// Swap holds the inputs of event Swap(address,address,(int256,int256),uint160,uint128,int24).\n"+
+		"type Swap struct {\n"+
+		"\tSender       common.Address `abi:\"sender\"`\n"+
+		"\tRecipient    common.Address `abi:\"recipient\"`\n"+
+		"\tAmounts      SwapAmounts    `abi:\"amounts\"`\n"+
+		"\tSqrtPriceX96 *big.Int       `abi:\"sqrtPriceX96\"`\n"+
+		"\tLiquidity    *big.Int       `abi:\"liquidity\"`\n"+
+		"\tTick         *big.Int       `abi:\"tick\"`\n"+
+		"}\n\n"+
+		"// SwapAmounts is the (int256,int256) tuple.\n"+
+		"type SwapAmounts struct {\n"+
+		"\tAmount0 *big.Int `abi:\"amount0\"`\n"+
+		"\tAmount1 *big.Int `abi:\"amount1\"`\n"+
+		"}\n", src)
+
+	src, err = w.GoStruct("Named")
+	assert.NoError(t, err)
+	assert.Contains(t, src, "Name decoder.IndexedHash `abi:\"name\"`")
+	assert.Contains(t, src, "Keys [2][32]byte")
+	assert.Contains(t, src, "Data []byte")
+
+	_, err = w.GoStruct("Transfer")
+	assert.ErrorContains(t, err, `event "Transfer" not found`)
+}
@@ -0,0 +1,119 @@
+package redisconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
+	"github.com/redis/go-redis/v9"
+)
+
+// Config holds connection settings for a standalone, Sentinel-managed or
+// clustered Redis deployment, shared by the Redis cursor store and output.
+type Config struct {
+	Addr     string `mapstructure:"addr"`     // Standalone server, e.g. "localhost:6379"
+	Username string `mapstructure:"username"` // ACL user, empty for the default user
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"` // Not supported with ClusterAddrs
+
+	// MasterName and SentinelAddrs connect to the master of a Sentinel-managed
+	// deployment, following it across failovers.
+	MasterName       string   `mapstructure:"master_name"`
+	SentinelAddrs    []string `mapstructure:"sentinel_addrs"`
+	SentinelPassword string   `mapstructure:"sentinel_password"`
+
+	// ClusterAddrs are seed nodes of a Redis Cluster.
+	ClusterAddrs []string `mapstructure:"cluster_addrs"`
+
+	// TLS connects over TLS trusting the system roots; TLSConfig adds a CA or
+	// a client certificate and implies TLS.
+	TLS       bool             `mapstructure:"tls"`
+	TLSConfig tlsconfig.Config `mapstructure:"tls_config"`
+
+	DialTimeout  time.Duration `mapstructure:"dial_timeout"`  // Default 5s
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`  // Default 3s
+	WriteTimeout time.Duration `mapstructure:"write_timeout"` // Default ReadTimeout
+
+	// MaxRetries retries commands failing on network errors or during a
+	// failover (default 3, -1 disables retries), backing off between
+	// MinRetryBackoff (default 8ms) and MaxRetryBackoff (default 512ms).
+	MaxRetries      int           `mapstructure:"max_retries"`
+	MinRetryBackoff time.Duration `mapstructure:"min_retry_backoff"`
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff"`
+}
+
+// Validate reports inconsistent settings.
+func (c Config) Validate() error {
+	if len(c.ClusterAddrs) > 0 && (c.MasterName != "" || len(c.SentinelAddrs) > 0) {
+		return errors.New("redis cluster_addrs and sentinel settings are mutually exclusive")
+	}
+	if (c.MasterName == "") != (len(c.SentinelAddrs) == 0) {
+		return errors.New("redis master_name and sentinel_addrs must be set together")
+	}
+	if len(c.ClusterAddrs) > 0 && c.DB != 0 {
+		return errors.New("redis db is not supported in cluster mode")
+	}
+	return nil
+}
+
+// NewClient returns a client for the deployment c describes: a failover
+// client with sentinels, a cluster client with cluster addresses, and a plain
+// client otherwise. It does not connect.
+func (c Config) NewClient() (redis.UniversalClient, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	tlsCfg, err := c.TLSConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg == nil && c.TLS {
+		tlsCfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	switch {
+	case len(c.SentinelAddrs) > 0:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       c.MasterName,
+			SentinelAddrs:    c.SentinelAddrs,
+			SentinelPassword: c.SentinelPassword,
+			Username:         c.Username,
+			Password:         c.Password,
+			DB:               c.DB,
+			TLSConfig:        tlsCfg,
+			DialTimeout:      c.DialTimeout,
+			ReadTimeout:      c.ReadTimeout,
+			WriteTimeout:     c.WriteTimeout,
+			MaxRetries:       c.MaxRetries,
+			MinRetryBackoff:  c.MinRetryBackoff,
+			MaxRetryBackoff:  c.MaxRetryBackoff,
+		}), nil
+	case len(c.ClusterAddrs) > 0:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           c.ClusterAddrs,
+			Username:        c.Username,
+			Password:        c.Password,
+			TLSConfig:       tlsCfg,
+			DialTimeout:     c.DialTimeout,
+			ReadTimeout:     c.ReadTimeout,
+			WriteTimeout:    c.WriteTimeout,
+			MaxRetries:      c.MaxRetries,
+			MinRetryBackoff: c.MinRetryBackoff,
+			MaxRetryBackoff: c.MaxRetryBackoff,
+		}), nil
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:            c.Addr,
+		Username:        c.Username,
+		Password:        c.Password,
+		DB:              c.DB,
+		TLSConfig:       tlsCfg,
+		DialTimeout:     c.DialTimeout,
+		ReadTimeout:     c.ReadTimeout,
+		WriteTimeout:    c.WriteTimeout,
+		MaxRetries:      c.MaxRetries,
+		MinRetryBackoff: c.MinRetryBackoff,
+		MaxRetryBackoff: c.MaxRetryBackoff,
+	}), nil
+}
@@ -0,0 +1,99 @@
+package redisconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient_Standalone(t *testing.T) {
+	c, err := Config{
+		Addr:         "localhost:6379",
+		Username:     "scanner",
+		Password:     "secret",
+		DB:           2,
+		TLS:          true,
+		DialTimeout:  time.Second,
+		ReadTimeout:  2 * time.Second,
+		WriteTimeout: 3 * time.Second,
+		MaxRetries:   5,
+	}.NewClient()
+	assert.NoError(t, err)
+	defer c.Close()
+
+	client, ok := c.(*redis.Client)
+	assert.True(t, ok)
+	opts := client.Options()
+	assert.Equal(t, "localhost:6379", opts.Addr)
+	assert.Equal(t, "scanner", opts.Username)
+	assert.Equal(t, "secret", opts.Password)
+	assert.Equal(t, 2, opts.DB)
+	assert.NotNil(t, opts.TLSConfig)
+	assert.Equal(t, time.Second, opts.DialTimeout)
+	assert.Equal(t, 2*time.Second, opts.ReadTimeout)
+	assert.Equal(t, 3*time.Second, opts.WriteTimeout)
+	assert.Equal(t, 5, opts.MaxRetries)
+
+	// Plain text unless TLS is asked for
+	c, err = Config{Addr: "localhost:6379"}.NewClient()
+	assert.NoError(t, err)
+	defer c.Close()
+	assert.Nil(t, c.(*redis.Client).Options().TLSConfig)
+}
+
+func TestNewClient_Sentinel(t *testing.T) {
+	c, err := Config{
+		MasterName:    "mymaster",
+		SentinelAddrs: []string{"sentinel-0:26379", "sentinel-1:26379"},
+		Password:      "secret",
+		DB:            1,
+		TLSConfig:     tlsconfig.Config{InsecureSkipVerify: true},
+	}.NewClient()
+	assert.NoError(t, err)
+	defer c.Close()
+
+	// A failover client resolves the master through the sentinels
+	client, ok := c.(*redis.Client)
+	assert.True(t, ok)
+	opts := client.Options()
+	assert.Equal(t, "FailoverClient", opts.Addr)
+	assert.Equal(t, 1, opts.DB)
+	assert.True(t, opts.TLSConfig.InsecureSkipVerify)
+}
+
+func TestNewClient_Cluster(t *testing.T) {
+	c, err := Config{
+		ClusterAddrs: []string{"node-0:6379", "node-1:6379"},
+		Username:     "scanner",
+		MaxRetries:   -1,
+	}.NewClient()
+	assert.NoError(t, err)
+	defer c.Close()
+
+	client, ok := c.(*redis.ClusterClient)
+	assert.True(t, ok)
+	opts := client.Options()
+	assert.Equal(t, []string{"node-0:6379", "node-1:6379"}, opts.Addrs)
+	assert.Equal(t, "scanner", opts.Username)
+	assert.Equal(t, -1, opts.MaxRetries)
+}
+
+func TestNewClient_Invalid(t *testing.T) {
+	_, err := Config{MasterName: "mymaster"}.NewClient()
+	assert.ErrorContains(t, err, "must be set together")
+
+	_, err = Config{SentinelAddrs: []string{"sentinel-0:26379"}}.NewClient()
+	assert.ErrorContains(t, err, "must be set together")
+
+	_, err = Config{ClusterAddrs: []string{"node-0:6379"}, MasterName: "mymaster", SentinelAddrs: []string{"sentinel-0:26379"}}.NewClient()
+	assert.ErrorContains(t, err, "mutually exclusive")
+
+	_, err = Config{ClusterAddrs: []string{"node-0:6379"}, DB: 1}.NewClient()
+	assert.ErrorContains(t, err, "cluster mode")
+
+	_, err = Config{Addr: "localhost:6379", TLSConfig: tlsconfig.Config{CertFile: "client.pem"}}.NewClient()
+	assert.ErrorContains(t, err, "must be set together")
+}
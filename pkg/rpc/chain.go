@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ChainResolver returns the default nodes of a chain, looked up by name,
+// alias or numeric chain ID. The second result is false for unknown chains.
+type ChainResolver func(chain string) ([]NodeConfig, bool)
+
+var (
+	chainResolver   ChainResolver
+	chainResolverMu sync.RWMutex
+)
+
+// SetChainResolver sets how NewClientForChain finds the nodes of a chain.
+// Package chain sets its preset registry when imported; this package cannot
+// import it without a cycle.
+func SetChainResolver(r ChainResolver) {
+	chainResolverMu.Lock()
+	defer chainResolverMu.Unlock()
+	chainResolver = r
+}
+
+// NewClientForChain creates a client for the default nodes of chain merged
+// with extraNodes, see MergeNodes. It fails with ErrNoChainNodes if neither
+// the chain nor extraNodes have any.
+func NewClientForChain(ctx context.Context, chain string, extraNodes ...NodeConfig) (*MultiClient, error) {
+	chainResolverMu.RLock()
+	resolve := chainResolver
+	chainResolverMu.RUnlock()
+
+	var defaults []NodeConfig
+	if resolve != nil {
+		defaults, _ = resolve(chain)
+	}
+	nodes := MergeNodes(defaults, extraNodes)
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w %q", ErrNoChainNodes, chain)
+	}
+	return NewClient(ctx, nodes)
+}
+
+// MergeNodes returns the nodes of user followed by the defaults, leaving out
+// the defaults that user lists again. User nodes get a higher Priority than
+// every default: the ones with a lower or equal one are raised above them.
+func MergeNodes(defaults, user []NodeConfig) []NodeConfig {
+	top := 0
+	for _, n := range defaults {
+		top = max(top, n.Priority)
+	}
+
+	merged := make([]NodeConfig, 0, len(user)+len(defaults))
+	listed := make(map[string]bool, len(user))
+	for _, n := range user {
+		if len(defaults) > 0 && n.Priority <= top {
+			n.Priority = top + 1
+		}
+		merged = append(merged, n)
+		listed[n.URL] = true
+	}
+	for _, n := range defaults {
+		if !listed[n.URL] {
+			merged = append(merged, n)
+		}
+	}
+	return merged
+}
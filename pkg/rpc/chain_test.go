@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeNodes(t *testing.T) {
+	defaults := []NodeConfig{
+		{URL: "https://public-a.example", Priority: 1, RateLimit: 5},
+		{URL: "https://public-b.example", Priority: 2, RateLimit: 5},
+	}
+	user := []NodeConfig{
+		{URL: "https://private.example", Priority: 50},
+		{URL: "https://unranked.example"},
+		{URL: "https://public-b.example", RateLimit: 25},
+	}
+
+	merged := MergeNodes(defaults, user)
+	assert.Equal(t, []NodeConfig{
+		{URL: "https://private.example", Priority: 50},
+		{URL: "https://unranked.example", Priority: 3},
+		{URL: "https://public-b.example", Priority: 3, RateLimit: 25}, // Replaces the default one
+		{URL: "https://public-a.example", Priority: 1, RateLimit: 5},
+	}, merged)
+	assert.Equal(t, 0, user[1].Priority, "user nodes are copied")
+
+	assert.Equal(t, defaults, MergeNodes(defaults, nil))
+	assert.Equal(t, user, MergeNodes(nil, user))
+	assert.Empty(t, MergeNodes(nil, nil))
+}
+
+func TestNewClientForChain(t *testing.T) {
+	t.Cleanup(func() { SetChainResolver(nil) })
+	SetChainResolver(func(chain string) ([]NodeConfig, bool) {
+		switch chain {
+		case "public-chain":
+			return []NodeConfig{{URL: "http://127.0.0.1:1", Priority: 1}}, true
+		case "bare-chain":
+			return nil, true
+		}
+		return nil, false
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Stops the background sync at once
+
+	mc, err := NewClientForChain(ctx, "public-chain", NodeConfig{URL: "http://127.0.0.1:2"})
+	assert.NoError(t, err)
+	if assert.Len(t, mc.nodes, 2) {
+		assert.Equal(t, "http://127.0.0.1:2", mc.nodes[0].config.URL)
+		assert.Equal(t, 2, mc.nodes[0].Priority())
+	}
+	mc.Close()
+
+	// Presets without endpoints and unknown chains need user nodes
+	_, err = NewClientForChain(ctx, "bare-chain")
+	assert.ErrorIs(t, err, ErrNoChainNodes)
+	assert.EqualError(t, err, `no rpc nodes configured or preset for chain "bare-chain"`)
+	_, err = NewClientForChain(ctx, "unknown-chain")
+	assert.ErrorIs(t, err, ErrNoChainNodes)
+
+	mc, err = NewClientForChain(ctx, "unknown-chain", NodeConfig{URL: "http://127.0.0.1:2"})
+	assert.NoError(t, err)
+	mc.Close()
+}
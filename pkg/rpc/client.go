@@ -3,7 +3,9 @@ package rpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
+	"slices"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -18,22 +20,79 @@ import (
 var (
 	ErrNoAvailableNodes  = errors.New("no available rpc nodes")
 	ErrNoNodeMeetsHeight = errors.New("no node meets the required block height")
+	ErrNoChainNodes      = errors.New("no rpc nodes configured or preset for chain")
+	ErrMethodUnsupported = errors.New("no rpc node supports the method")
 )
 
+// JSON-RPC methods of the calls of MultiClient, the keys of
+// NodeConfig.MethodPriorities
+const (
+	MethodChainID               = "eth_chainId"
+	MethodBlockNumber           = "eth_blockNumber"
+	MethodGetBlockByNumber      = "eth_getBlockByNumber" // Headers and blocks
+	MethodGetLogs               = "eth_getLogs"
+	MethodGetCode               = "eth_getCode"
+	MethodGetStorageAt          = "eth_getStorageAt"
+	MethodCall                  = "eth_call"
+	MethodGetBlockReceipts      = "eth_getBlockReceipts"
+	MethodGetTransactionReceipt = "eth_getTransactionReceipt"
+)
+
+// DefaultSyncInterval is how often the background sync of a MultiClient
+// polls the heights of its nodes by default.
+const DefaultSyncInterval = 5 * time.Second
+
 // MultiClient manages multiple RPC nodes, providing load balancing and failover
 type MultiClient struct {
 	nodes        []*Node
 	globalHeight uint64
+	receipts     ReceiptStrategy
 
 	mu sync.RWMutex
+
+	// Background sync, see StartSync
+	syncInterval time.Duration
+	syncDisabled bool
+	syncMu       sync.Mutex
+	syncCancel   context.CancelFunc
+	syncDone     chan struct{}
+	closed       bool
+}
+
+// ClientOption configures a MultiClient.
+type ClientOption func(*MultiClient)
+
+// WithSyncInterval sets how often the background sync polls the heights of
+// the nodes, DefaultSyncInterval if d is not positive.
+func WithSyncInterval(d time.Duration) ClientOption {
+	return func(mc *MultiClient) {
+		if d > 0 {
+			mc.syncInterval = d
+		}
+	}
+}
+
+// WithoutBackgroundSync creates the client without starting the background
+// sync, e.g. for tests and short-lived tools: the heights of the nodes are
+// then only known from their requests, until StartSync.
+func WithoutBackgroundSync() ClientOption {
+	return func(mc *MultiClient) {
+		mc.syncDisabled = true
+	}
 }
 
 // NewClient initializes a multi-node client
-func NewClient(ctx context.Context, configs []NodeConfig) (*MultiClient, error) {
+func NewClient(ctx context.Context, configs []NodeConfig, opts ...ClientOption) (*MultiClient, error) {
 	if len(configs) == 0 {
 		return nil, errors.New("no rpc configs provided")
 	}
 
+	for _, cfg := range configs {
+		if _, err := ParseTraceAPI(string(cfg.Trace)); err != nil {
+			return nil, fmt.Errorf("node %s: %w", cfg.URL, err)
+		}
+	}
+
 	nodes := make([]*Node, 0, len(configs))
 	for _, cfg := range configs {
 		n, err := NewNode(ctx, cfg)
@@ -45,28 +104,74 @@ func NewClient(ctx context.Context, configs []NodeConfig) (*MultiClient, error)
 		nodes = append(nodes, n)
 	}
 
-	return NewClientWithNodes(ctx, nodes)
+	return NewClientWithNodes(ctx, nodes, opts...)
 }
 
 // NewClientWithNodes initializes MultiClient with existing nodes (for testing or advanced usage)
-func NewClientWithNodes(ctx context.Context, nodes []*Node) (*MultiClient, error) {
+func NewClientWithNodes(ctx context.Context, nodes []*Node, opts ...ClientOption) (*MultiClient, error) {
 	if len(nodes) == 0 {
 		return nil, errors.New("failed to connect to any rpc node")
 	}
 
 	mc := &MultiClient{
-		nodes: nodes,
+		nodes:        nodes,
+		syncInterval: DefaultSyncInterval,
+	}
+	for _, opt := range opts {
+		opt(mc)
 	}
 
-	// Start background sync task to update node heights and status every 5 seconds
-	go mc.startBackgroundSync(ctx)
+	// Start background sync task to update node heights and status
+	if !mc.syncDisabled {
+		mc.StartSync(ctx)
+	}
 
 	return mc, nil
 }
 
+// StartSync starts the background sync polling the heights of the nodes
+// until ctx is done, StopSync or Close. It does nothing while the sync runs
+// or once the client is closed.
+func (mc *MultiClient) StartSync(ctx context.Context) {
+	mc.syncMu.Lock()
+	defer mc.syncMu.Unlock()
+	if mc.closed {
+		return
+	}
+	if mc.syncDone != nil {
+		select {
+		case <-mc.syncDone:
+		default:
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	mc.syncCancel, mc.syncDone = cancel, done
+	go func() {
+		defer close(done)
+		mc.startBackgroundSync(ctx)
+	}()
+}
+
+// StopSync stops the background sync, returning once it has. The heights of
+// the nodes are no longer polled until StartSync.
+func (mc *MultiClient) StopSync() {
+	mc.syncMu.Lock()
+	cancel, done := mc.syncCancel, mc.syncDone
+	mc.syncCancel, mc.syncDone = nil, nil
+	mc.syncMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
 // startBackgroundSync periodically polls all nodes to update their heights and scores
 func (mc *MultiClient) startBackgroundSync(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(mc.syncInterval)
 	defer ticker.Stop()
 
 	// Initial sync
@@ -106,8 +211,10 @@ func (mc *MultiClient) syncNodes(ctx context.Context) {
 	}
 }
 
-// execute performs an RPC request with retry logic and auto node switching
-func (mc *MultiClient) execute(ctx context.Context, op func(*Node) error) error {
+// execute performs an RPC request of a JSON-RPC method with retry logic and
+// auto node switching, preferring the nodes by their MethodScore. The node
+// serving it is recorded in a ctx of WithServed.
+func (mc *MultiClient) execute(ctx context.Context, method string, op func(*Node) error) error {
 	// Max attempts = number of nodes (capped at 3 to avoid long loops)
 	attempts := len(mc.nodes)
 	if attempts > 3 {
@@ -117,7 +224,7 @@ func (mc *MultiClient) execute(ctx context.Context, op func(*Node) error) error
 	var lastErr error
 	for i := 0; i < attempts; i++ {
 		// Pick an available node (with auto-switching)
-		node, err := mc.pickAvailableNode(ctx)
+		node, err := mc.pickAvailableNode(ctx, method)
 		if err != nil {
 			return err
 		}
@@ -127,6 +234,7 @@ func (mc *MultiClient) execute(ctx context.Context, op func(*Node) error) error
 
 		err = op(node)
 		if err == nil {
+			recordServed(ctx, method, node, i+1)
 			return nil
 		}
 
@@ -146,7 +254,7 @@ func (mc *MultiClient) execute(ctx context.Context, op func(*Node) error) error
 // ChainID retrieves the chain ID from the best available node
 func (mc *MultiClient) ChainID(ctx context.Context) (*big.Int, error) {
 	var res *big.Int
-	err := mc.execute(ctx, func(n *Node) error {
+	err := mc.execute(ctx, MethodChainID, func(n *Node) error {
 		var e error
 		res, e = n.ChainID(ctx)
 		return e
@@ -163,7 +271,7 @@ func (mc *MultiClient) BlockNumber(ctx context.Context) (uint64, error) {
 	}
 	// If cache empty (at startup), force request
 	var res uint64
-	err := mc.execute(ctx, func(n *Node) error {
+	err := mc.execute(ctx, MethodBlockNumber, func(n *Node) error {
 		var e error
 		res, e = n.BlockNumber(ctx)
 		return e
@@ -174,7 +282,7 @@ func (mc *MultiClient) BlockNumber(ctx context.Context) (uint64, error) {
 // HeaderByNumber retrieves a block header from the best available node
 func (mc *MultiClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
 	var res *types.Header
-	err := mc.execute(ctx, func(n *Node) error {
+	err := mc.execute(ctx, MethodGetBlockByNumber, func(n *Node) error {
 		var e error
 		res, e = n.HeaderByNumber(ctx, number)
 		return e
@@ -185,7 +293,7 @@ func (mc *MultiClient) HeaderByNumber(ctx context.Context, number *big.Int) (*ty
 // BlockByNumber retrieves a full block from the best available node
 func (mc *MultiClient) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
 	var res *types.Block
-	err := mc.execute(ctx, func(n *Node) error {
+	err := mc.execute(ctx, MethodGetBlockByNumber, func(n *Node) error {
 		var e error
 		res, e = n.BlockByNumber(ctx, number)
 		return e
@@ -196,7 +304,7 @@ func (mc *MultiClient) BlockByNumber(ctx context.Context, number *big.Int) (*typ
 // FilterLogs retrieves logs from the best available node based on the query
 func (mc *MultiClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
 	var res []types.Log
-	err := mc.execute(ctx, func(n *Node) error {
+	err := mc.execute(ctx, MethodGetLogs, func(n *Node) error {
 		var e error
 		res, e = n.FilterLogs(ctx, q)
 		return e
@@ -204,10 +312,51 @@ func (mc *MultiClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) (
 	return res, err
 }
 
+// FilterLogsWithin executes a filter query like FilterLogs, in requests of
+// at most limit blocks (0 for no limit) and of the MaxLogsRange of the node
+// serving each. Every request picks its node, sizing its blocks for it, so
+// that a restrictive node serving one request after a failover does not
+// shrink the next ones served by a capable node. The blocks already fetched
+// are kept when a request fails over. Queries of a block hash or an open
+// range are sent whole.
+func (mc *MultiClient) FilterLogsWithin(ctx context.Context, q ethereum.FilterQuery, limit uint64) ([]types.Log, error) {
+	if q.BlockHash != nil || q.FromBlock == nil || q.ToBlock == nil || q.FromBlock.Cmp(q.ToBlock) > 0 {
+		return mc.FilterLogs(ctx, q)
+	}
+	var logs []types.Log
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	for {
+		var end uint64
+		err := mc.execute(ctx, MethodGetLogs, func(n *Node) error {
+			end = to
+			for _, span := range []uint64{limit, n.MaxLogsRange()} {
+				if span > 0 && end-from >= span {
+					end = from + span - 1
+				}
+			}
+			part := q
+			part.FromBlock, part.ToBlock = new(big.Int).SetUint64(from), new(big.Int).SetUint64(end)
+			res, err := n.FilterLogs(ctx, part)
+			if err != nil {
+				return err
+			}
+			logs = append(logs, res...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if end == to {
+			return logs, nil
+		}
+		from = end + 1
+	}
+}
+
 // CodeAt retrieves the contract code at a given address from the best available node
 func (mc *MultiClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
 	var res []byte
-	err := mc.execute(ctx, func(n *Node) error {
+	err := mc.execute(ctx, MethodGetCode, func(n *Node) error {
 		var e error
 		res, e = n.CodeAt(ctx, account, blockNumber)
 		return e
@@ -215,20 +364,78 @@ func (mc *MultiClient) CodeAt(ctx context.Context, account common.Address, block
 	return res, err
 }
 
-// Close closes all underlying RPC connections
+// StorageAt retrieves a contract storage slot from the best available node
+func (mc *MultiClient) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	var res []byte
+	err := mc.execute(ctx, MethodGetStorageAt, func(n *Node) error {
+		var e error
+		res, e = n.StorageAt(ctx, account, key, blockNumber)
+		return e
+	})
+	return res, err
+}
+
+// CallContract executes a read-only contract call on the best available node
+func (mc *MultiClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var res []byte
+	err := mc.execute(ctx, MethodCall, func(n *Node) error {
+		var e error
+		res, e = n.CallContract(ctx, msg, blockNumber)
+		return e
+	})
+	return res, err
+}
+
+// NodeStats is the health of a node of a MultiClient.
+type NodeStats struct {
+	URL         string
+	Priority    int
+	LatestBlock uint64 // Latest block height observed
+	Latency     int64  // Average latency (ms)
+	Errors      uint64 // Consecutive errors
+	TotalErrors uint64
+	CircuitOpen bool // Skipped by the client after repeated errors
+}
+
+// NodeStats returns the health of the nodes, in their configured order.
+func (mc *MultiClient) NodeStats() []NodeStats {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	stats := make([]NodeStats, len(mc.nodes))
+	for i, n := range mc.nodes {
+		stats[i] = NodeStats{
+			URL:         n.URL(),
+			Priority:    n.Priority(),
+			LatestBlock: n.GetLatestBlock(),
+			Latency:     n.GetLatency(),
+			Errors:      n.GetErrorCount(),
+			TotalErrors: n.GetTotalErrors(),
+			CircuitOpen: n.IsCircuitBroken(),
+		}
+	}
+	return stats
+}
+
+// Close stops the background sync and closes all underlying RPC connections
 func (mc *MultiClient) Close() {
+	mc.syncMu.Lock()
+	mc.closed = true
+	mc.syncMu.Unlock()
+	mc.StopSync()
+
 	for _, n := range mc.nodes {
 		n.Close()
 	}
 }
 
-// pickAvailableNode selects an available node with auto-switching
-func (mc *MultiClient) pickAvailableNode(ctx context.Context) (*Node, error) {
-	return mc.pickAvailableNodeWithHeight(ctx, 0)
+// pickAvailableNode selects an available node for a method with auto-switching
+func (mc *MultiClient) pickAvailableNode(ctx context.Context, method string) (*Node, error) {
+	return mc.pickAvailableNodeWithHeight(ctx, method, 0)
 }
 
-// pickAvailableNodeWithHeight selects a node that meets the height requirement
-func (mc *MultiClient) pickAvailableNodeWithHeight(ctx context.Context, requiredHeight uint64) (*Node, error) {
+// pickAvailableNodeWithHeight selects a node for a method that meets the
+// height requirement
+func (mc *MultiClient) pickAvailableNodeWithHeight(ctx context.Context, method string, requiredHeight uint64) (*Node, error) {
 	mc.mu.RLock()
 	globalH := atomic.LoadUint64(&mc.globalHeight)
 
@@ -240,10 +447,15 @@ func (mc *MultiClient) pickAvailableNodeWithHeight(ctx context.Context, required
 	if len(candidates) == 0 {
 		return nil, ErrNoAvailableNodes
 	}
+	// Skip the nodes lacking the method, e.g. trace APIs
+	candidates = slices.DeleteFunc(candidates, func(n *Node) bool { return !n.Supports(method) })
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMethodUnsupported, method)
+	}
 
-	// Sort by score in descending order
+	// Sort by score for the method in descending order
 	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].Score(globalH) > candidates[j].Score(globalH)
+		return candidates[i].MethodScore(method, globalH) > candidates[j].MethodScore(method, globalH)
 	})
 
 	// Try to acquire an available node (with auto-switching)
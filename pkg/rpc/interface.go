@@ -7,6 +7,7 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 )
 
 // EthClient abstracts the underlying ethclient.Client implementation for easier mocking/testing
@@ -17,30 +18,55 @@ type EthClient interface {
 	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
 	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
 	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+	BlockReceipts(ctx context.Context, blockNrOrHash gethrpc.BlockNumberOrHash) ([]*types.Receipt, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
 	Close()
 }
 
-// Client defines the minimal set of RPC methods required by the Scanner.
-// This allows for mocking the client in tests or implementing multi-node load balancing.
-type Client interface {
-	// ChainID retrieves the chain ID
-	ChainID(ctx context.Context) (*big.Int, error)
+// Compile-time checks that the clients implement the interfaces.
+var (
+	_ Client        = (*MultiClient)(nil)
+	_ ScannerClient = (*MultiClient)(nil)
+	_ Client        = (*SingleClient)(nil)
+	_ ScannerClient = (*SingleClient)(nil)
+)
 
+// ScannerClient defines the minimal set of RPC methods required by the
+// Scanner, e.g. to mock it in tests with only these methods.
+type ScannerClient interface {
 	// BlockNumber retrieves the latest block height
 	BlockNumber(ctx context.Context) (uint64, error)
 
 	// HeaderByNumber retrieves a block header (used for fast Bloom Filter checks)
 	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
 
-	// BlockByNumber retrieves a full block (used for native transfer scanning)
-	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
-
 	// FilterLogs retrieves logs (used for ERC20 scanning)
 	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// Client adds to the ScannerClient the methods used around the Scanner, by
+// the decoders and the token metadata among others.
+// This allows for mocking the client in tests or implementing multi-node load balancing.
+type Client interface {
+	ScannerClient
+
+	// ChainID retrieves the chain ID
+	ChainID(ctx context.Context) (*big.Int, error)
+
+	// BlockByNumber retrieves a full block (used for native transfer scanning)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
 
 	// CodeAt checks contract code (used for safety validation)
 	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
 
+	// StorageAt reads a contract storage slot (used for proxy detection)
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+
+	// CallContract executes a read-only contract call (used for token metadata)
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+
 	// Close closes the connection
 	Close()
 }
@@ -3,29 +3,55 @@ package rpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
 	"golang.org/x/time/rate"
 )
 
 // NodeConfig represents configuration for a single RPC node
 type NodeConfig struct {
-	URL           string
-	Priority      int // Initial weight (1-100), higher is more preferred
-	RateLimit     int // QPS limit for this node, 0 means unlimited
-	MaxConcurrent int // Max concurrent requests for this node, 0 means unlimited
+	URL           string `mapstructure:"url"`
+	Priority      int    `mapstructure:"priority"`       // Initial weight (1-100), higher is more preferred
+	RateLimit     int    `mapstructure:"rate_limit"`     // QPS limit for this node, 0 means unlimited
+	MaxConcurrent int    `mapstructure:"max_concurrent"` // Max concurrent requests for this node, 0 means unlimited
+
+	// TLS configures client certificates and trusted CAs for https:// and wss:// nodes.
+	TLS tlsconfig.Config `mapstructure:"tls"`
+
+	// MethodPriorities overrides Priority for the calls of some JSON-RPC
+	// methods, e.g. {"eth_getLogs": 100} to send the expensive log queries
+	// to a premium node and the cheap polling to free ones. Method names are
+	// case-insensitive, see the Method constants. Health and the circuit
+	// breaker still apply: a broken preferred node is skipped.
+	MethodPriorities map[string]int `mapstructure:"method_priorities"`
+
+	// Trace is the API the node traces blocks with, empty if it has none:
+	// TraceBlock calls skip it.
+	Trace TraceAPI `mapstructure:"trace"`
+
+	// MaxLogsRange caps the blocks of the eth_getLogs requests the node
+	// serves, 0 for no limit: FilterLogsWithin sizes the requests sent to
+	// it accordingly, while nodes without the limit get longer ones.
+	MaxLogsRange uint64 `mapstructure:"max_logs_range"`
 }
 
 // Node wraps the underlying ethclient and provides health monitoring and metric tracking.
 type Node struct {
 	config NodeConfig
 	client EthClient // Interface for underlying ethclient
+	raw    rawCaller // Underlying JSON-RPC client, nil if unknown
 
 	mu          sync.RWMutex
 	errorCount  uint64 // Consecutive error count
@@ -37,6 +63,9 @@ type Node struct {
 	limiter   *rate.Limiter // QPS rate limiter
 	semaphore chan struct{} // Concurrency limiter
 
+	// Priorities by lowercase method name
+	methodPriorities map[string]int
+
 	// Circuit breaker
 	circuitBroken bool
 	lastErrorTime time.Time
@@ -45,12 +74,30 @@ type Node struct {
 
 // NewNode creates a new RPC node (Production)
 func NewNode(ctx context.Context, cfg NodeConfig) (*Node, error) {
-	client, err := ethclient.DialContext(ctx, cfg.URL)
+	if cfg.TLS.IsZero() {
+		client, err := ethclient.DialContext(ctx, cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		return NewNodeWithClient(cfg, client), nil
+	}
+
+	transport, err := cfg.TLS.Transport()
+	if err != nil {
+		return nil, fmt.Errorf("node %s: %w", cfg.URL, err)
+	}
+	rpcClient, err := gethrpc.DialOptions(ctx, cfg.URL,
+		gethrpc.WithHTTPClient(&http.Client{Transport: transport}),
+		gethrpc.WithWebsocketDialer(websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 45 * time.Second,
+			TLSClientConfig:  transport.TLSClientConfig,
+		}),
+	)
 	if err != nil {
 		return nil, err
 	}
-
-	return NewNodeWithClient(cfg, client), nil
+	return NewNodeWithClient(cfg, ethclient.NewClient(rpcClient)), nil
 }
 
 // NewNodeWithClient initializes Node with a pre-created client (Testing/DI)
@@ -61,6 +108,20 @@ func NewNodeWithClient(cfg NodeConfig, client EthClient) *Node {
 		latency: 0,
 	}
 
+	switch c := client.(type) {
+	case rawCaller:
+		node.raw = c
+	case interface{ Client() *gethrpc.Client }:
+		node.raw = c.Client()
+	}
+
+	for method, priority := range cfg.MethodPriorities {
+		if node.methodPriorities == nil {
+			node.methodPriorities = make(map[string]int, len(cfg.MethodPriorities))
+		}
+		node.methodPriorities[strings.ToLower(method)] = priority
+	}
+
 	// Initialize QPS limiter
 	if cfg.RateLimit > 0 {
 		node.limiter = rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.RateLimit)
@@ -84,14 +145,35 @@ func (n *Node) Priority() int {
 	return n.config.Priority
 }
 
+// MaxLogsRange returns the most blocks of an eth_getLogs request to the
+// node, 0 for no limit.
+func (n *Node) MaxLogsRange() uint64 {
+	return n.config.MaxLogsRange
+}
+
+// MethodPriority returns the weight of the node for the calls of a JSON-RPC
+// method: its MethodPriorities entry if any, else Priority.
+func (n *Node) MethodPriority(method string) int {
+	if priority, ok := n.methodPriorities[strings.ToLower(method)]; ok {
+		return priority
+	}
+	return n.config.Priority
+}
+
 // Score calculates the real-time score of the node. Higher is better.
 // Formula: (Priority * 100) - (Latency / 10) - (ConsecutiveErrors * 500)
 // Points are also deducted if the node lags too far behind the global max height.
 func (n *Node) Score(globalMaxHeight uint64) int64 {
+	return n.MethodScore("", globalMaxHeight)
+}
+
+// MethodScore is the Score of the node for the calls of a JSON-RPC method,
+// with its MethodPriority.
+func (n *Node) MethodScore(method string, globalMaxHeight uint64) int64 {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
-	score := int64(n.config.Priority) * 100
+	score := int64(n.MethodPriority(method)) * 100
 
 	// Latency penalty (e.g., 200ms latency = -20 points)
 	score -= (n.latency / 10)
@@ -231,6 +313,22 @@ func (n *Node) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block
 	return b, err
 }
 
+// BlockReceipts retrieves the receipts of a block with eth_getBlockReceipts
+func (n *Node) BlockReceipts(ctx context.Context, number *big.Int) ([]*types.Receipt, error) {
+	start := time.Now()
+	receipts, err := n.client.BlockReceipts(ctx, gethrpc.BlockNumberOrHashWithNumber(gethrpc.BlockNumber(number.Int64())))
+	n.RecordMetric(start, err)
+	return receipts, err
+}
+
+// TransactionReceipt retrieves the receipt of a transaction
+func (n *Node) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	start := time.Now()
+	receipt, err := n.client.TransactionReceipt(ctx, txHash)
+	n.RecordMetric(start, err)
+	return receipt, err
+}
+
 // FilterLogs retrieves logs from the node based on the query
 func (n *Node) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
 	start := time.Now()
@@ -247,6 +345,22 @@ func (n *Node) CodeAt(ctx context.Context, account common.Address, blockNumber *
 	return code, err
 }
 
+// StorageAt retrieves a contract storage slot
+func (n *Node) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	start := time.Now()
+	value, err := n.client.StorageAt(ctx, account, key, blockNumber)
+	n.RecordMetric(start, err)
+	return value, err
+}
+
+// CallContract executes a read-only contract call
+func (n *Node) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	start := time.Now()
+	result, err := n.client.CallContract(ctx, msg, blockNumber)
+	n.RecordMetric(start, err)
+	return result, err
+}
+
 // Close closes the underlying RPC connection
 func (n *Node) Close() {
 	n.client.Close()
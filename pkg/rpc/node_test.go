@@ -2,9 +2,14 @@ package rpc
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"math/big"
+	"net/http"
 	"testing"
 
+	"github.com/84hero/evm-scanner/internal/tlstest"
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -18,6 +23,37 @@ func TestNewNode(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestNewNode_MutualTLS(t *testing.T) {
+	ctx := context.Background()
+	srv, files := tlstest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"0x10"}`, req.ID)
+	}))
+
+	node, err := NewNode(ctx, NodeConfig{
+		URL: srv.URL,
+		TLS: tlsconfig.Config{CAFile: files.CAFile, CertFile: files.CertFile, KeyFile: files.KeyFile},
+	})
+	assert.NoError(t, err)
+	n, err := node.BlockNumber(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(16), n)
+
+	// Without a client certificate the server rejects the handshake
+	node, err = NewNode(ctx, NodeConfig{URL: srv.URL, TLS: tlsconfig.Config{CAFile: files.CAFile}})
+	assert.NoError(t, err)
+	_, err = node.BlockNumber(ctx)
+	assert.Error(t, err)
+
+	// Misconfigured paths fail at construction
+	_, err = NewNode(ctx, NodeConfig{URL: srv.URL, TLS: tlsconfig.Config{CertFile: "missing.pem", KeyFile: "missing-key.pem"}})
+	assert.ErrorContains(t, err, "missing.pem")
+}
+
 func TestNode_ProxyMethods(t *testing.T) {
 	ctx := context.Background()
 	mockEth := new(MockEthClient)
@@ -55,6 +91,12 @@ func TestNode_ProxyMethods(t *testing.T) {
 	mockEth.On("CodeAt", ctx, addr, big.NewInt(100)).Return([]byte{0x1}, nil).Once()
 	_, err = node.CodeAt(ctx, addr, big.NewInt(100))
 	assert.NoError(t, err)
+	mockEth.On("StorageAt", ctx, addr, common.Hash{}, big.NewInt(100)).Return([]byte{0x1}, nil).Once()
+	_, err = node.StorageAt(ctx, addr, common.Hash{}, big.NewInt(100))
+	assert.NoError(t, err)
+	mockEth.On("CallContract", ctx, ethereum.CallMsg{To: &addr}, big.NewInt(100)).Return([]byte{0x1}, nil).Once()
+	_, err = node.CallContract(ctx, ethereum.CallMsg{To: &addr}, big.NewInt(100))
+	assert.NoError(t, err)
 
 	// 7. Close
 	mockEth.On("Close").Once()
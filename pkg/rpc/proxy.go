@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// EIP-1967 storage slots of proxies: the address of their implementation,
+// or of the beacon holding it.
+var (
+	EIP1967ImplementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	EIP1967BeaconSlot         = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeee59ff6cb3582b35133d50")
+)
+
+// beaconImplementation is the selector of implementation() of beacons.
+var beaconImplementation = []byte{0x5c, 0x60, 0xda, 0x1b}
+
+// ReadEIP1967Implementation returns the current implementation of an
+// EIP-1967 proxy: the address in its implementation slot, else the
+// implementation() of the beacon in its beacon slot. It returns the zero
+// address for contracts that are not such proxies.
+func (mc *MultiClient) ReadEIP1967Implementation(ctx context.Context, proxy common.Address) (common.Address, error) {
+	value, err := mc.StorageAt(ctx, proxy, EIP1967ImplementationSlot, nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("read implementation slot: %w", err)
+	}
+	if impl := common.BytesToAddress(value); impl != (common.Address{}) {
+		return impl, nil
+	}
+
+	value, err = mc.StorageAt(ctx, proxy, EIP1967BeaconSlot, nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("read beacon slot: %w", err)
+	}
+	beacon := common.BytesToAddress(value)
+	if beacon == (common.Address{}) {
+		return common.Address{}, nil
+	}
+	out, err := mc.CallContract(ctx, ethereum.CallMsg{To: &beacon, Data: beaconImplementation}, nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("call beacon %s: %w", beacon, err)
+	}
+	if len(out) < common.HashLength {
+		return common.Address{}, fmt.Errorf("beacon %s: unexpected implementation() result %x", beacon, out)
+	}
+	return common.BytesToAddress(out[:common.HashLength]), nil
+}
@@ -0,0 +1,53 @@
+package rpc
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReadEIP1967Implementation(t *testing.T) {
+	ctx := context.Background()
+	mockEth := new(MockEthClient)
+	mockEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+	mc, _ := NewClientWithNodes(ctx, []*Node{NewNodeWithClient(NodeConfig{URL: "node1", Priority: 10}, mockEth)})
+
+	proxy, beaconProxy, plain := common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")
+	impl, beacon := common.HexToAddress("0x1111"), common.HexToAddress("0xbeac")
+	word := func(addr common.Address) []byte { return common.BytesToHash(addr.Bytes()).Bytes() }
+	noBlock := (*big.Int)(nil)
+
+	// The implementation slot
+	mockEth.On("StorageAt", ctx, proxy, EIP1967ImplementationSlot, noBlock).Return(word(impl), nil).Once()
+	got, err := mc.ReadEIP1967Implementation(ctx, proxy)
+	assert.NoError(t, err)
+	assert.Equal(t, impl, got)
+
+	// The beacon slot, then the implementation of the beacon
+	mockEth.On("StorageAt", ctx, beaconProxy, EIP1967ImplementationSlot, noBlock).Return(make([]byte, 32), nil).Once()
+	mockEth.On("StorageAt", ctx, beaconProxy, EIP1967BeaconSlot, noBlock).Return(word(beacon), nil).Once()
+	mockEth.On("CallContract", ctx, ethereum.CallMsg{To: &beacon, Data: []byte{0x5c, 0x60, 0xda, 0x1b}}, noBlock).Return(word(impl), nil).Once()
+	got, err = mc.ReadEIP1967Implementation(ctx, beaconProxy)
+	assert.NoError(t, err)
+	assert.Equal(t, impl, got)
+
+	// Not a proxy
+	mockEth.On("StorageAt", ctx, plain, mock.Anything, noBlock).Return(make([]byte, 32), nil).Twice()
+	got, err = mc.ReadEIP1967Implementation(ctx, plain)
+	assert.NoError(t, err)
+	assert.Equal(t, common.Address{}, got)
+	mockEth.AssertExpectations(t)
+
+	// Failures of the node
+	failing := new(MockEthClient)
+	failing.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+	failing.On("StorageAt", ctx, proxy, EIP1967ImplementationSlot, noBlock).Return(nil, assert.AnError)
+	mc, _ = NewClientWithNodes(ctx, []*Node{NewNodeWithClient(NodeConfig{URL: "node1", Priority: 10}, failing)})
+	_, err = mc.ReadEIP1967Implementation(ctx, proxy)
+	assert.ErrorIs(t, err, assert.AnError)
+}
@@ -0,0 +1,86 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ReceiptStrategy decides how MultiClient.BlockReceipts fetches the receipts
+// of a block.
+type ReceiptStrategy string
+
+const (
+	// ReceiptsByBlock asks for them at once with eth_getBlockReceipts (default).
+	ReceiptsByBlock ReceiptStrategy = "block"
+	// ReceiptsByTx fetches the block, then each receipt with
+	// eth_getTransactionReceipt, for nodes without eth_getBlockReceipts.
+	ReceiptsByTx ReceiptStrategy = "tx"
+)
+
+// ParseReceiptStrategy converts a configuration value into a ReceiptStrategy.
+// Empty means ReceiptsByBlock.
+func ParseReceiptStrategy(s string) (ReceiptStrategy, error) {
+	switch ReceiptStrategy(s) {
+	case "":
+		return ReceiptsByBlock, nil
+	case ReceiptsByBlock, ReceiptsByTx:
+		return ReceiptStrategy(s), nil
+	default:
+		return "", fmt.Errorf("unsupported receipt strategy: %q", s)
+	}
+}
+
+// SetReceiptStrategy sets how BlockReceipts fetches receipts.
+func (mc *MultiClient) SetReceiptStrategy(s ReceiptStrategy) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.receipts = s
+}
+
+// BlockReceipts retrieves the receipts of a block, in transaction order, as
+// the ReceiptStrategy says.
+func (mc *MultiClient) BlockReceipts(ctx context.Context, number *big.Int) (types.Receipts, error) {
+	mc.mu.RLock()
+	strategy := mc.receipts
+	mc.mu.RUnlock()
+
+	if strategy != ReceiptsByTx {
+		var res types.Receipts
+		err := mc.execute(ctx, MethodGetBlockReceipts, func(n *Node) error {
+			var e error
+			res, e = n.BlockReceipts(ctx, number)
+			return e
+		})
+		return res, err
+	}
+
+	block, err := mc.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	receipts := make(types.Receipts, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		receipt, err := mc.TransactionReceipt(ctx, tx.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("receipt of %s: %w", tx.Hash(), err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+// TransactionReceipt retrieves the receipt of a transaction from the best
+// available node
+func (mc *MultiClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var res *types.Receipt
+	err := mc.execute(ctx, MethodGetTransactionReceipt, func(n *Node) error {
+		var e error
+		res, e = n.TransactionReceipt(ctx, txHash)
+		return e
+	})
+	return res, err
+}
@@ -0,0 +1,59 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBlockReceipts(t *testing.T) {
+	ctx := context.Background()
+	mockEth := new(MockEthClient)
+	mockEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+	mc, _ := NewClientWithNodes(ctx, []*Node{NewNodeWithClient(NodeConfig{URL: "node1", Priority: 10}, mockEth)})
+
+	// By block: a single eth_getBlockReceipts
+	receipts := []*types.Receipt{{TxHash: common.HexToHash("0x01")}}
+	mockEth.On("BlockReceipts", ctx, gethrpc.BlockNumberOrHashWithNumber(50)).Return(receipts, nil).Once()
+	got, err := mc.BlockReceipts(ctx, big.NewInt(50))
+	assert.NoError(t, err)
+	assert.Equal(t, types.Receipts(receipts), got)
+
+	// By transaction: the block, then a receipt per transaction
+	mc.SetReceiptStrategy(ReceiptsByTx)
+	tx1 := types.NewTx(&types.LegacyTx{Nonce: 1})
+	tx2 := types.NewTx(&types.LegacyTx{Nonce: 2})
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(60)}).WithBody(types.Body{Transactions: []*types.Transaction{tx1, tx2}})
+	mockEth.On("BlockByNumber", ctx, big.NewInt(60)).Return(block, nil)
+	mockEth.On("TransactionReceipt", ctx, tx1.Hash()).Return(&types.Receipt{TxHash: tx1.Hash()}, nil).Once()
+	mockEth.On("TransactionReceipt", ctx, tx2.Hash()).Return(&types.Receipt{TxHash: tx2.Hash()}, nil).Once()
+	got, err = mc.BlockReceipts(ctx, big.NewInt(60))
+	assert.NoError(t, err)
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, tx1.Hash(), got[0].TxHash)
+		assert.Equal(t, tx2.Hash(), got[1].TxHash)
+	}
+
+	mockEth.On("TransactionReceipt", ctx, tx1.Hash()).Return(nil, errors.New("not found"))
+	_, err = mc.BlockReceipts(ctx, big.NewInt(60))
+	assert.ErrorContains(t, err, "receipt of "+tx1.Hash().Hex())
+	mockEth.AssertNotCalled(t, "BlockReceipts", ctx, gethrpc.BlockNumberOrHashWithNumber(60))
+}
+
+func TestParseReceiptStrategy(t *testing.T) {
+	s, err := ParseReceiptStrategy("")
+	assert.NoError(t, err)
+	assert.Equal(t, ReceiptsByBlock, s)
+	s, err = ParseReceiptStrategy("tx")
+	assert.NoError(t, err)
+	assert.Equal(t, ReceiptsByTx, s)
+	_, err = ParseReceiptStrategy("batch")
+	assert.EqualError(t, err, `unsupported receipt strategy: "batch"`)
+}
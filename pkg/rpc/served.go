@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Served is a call of a MultiClient, recorded in a context of WithServed.
+type Served struct {
+	Method string
+	// Node is the scheme and host of the URL of the node that served the
+	// call, without the path and credentials API keys are often in.
+	Node     string
+	Attempts int // Nodes tried, the failed ones included
+	At       time.Time
+}
+
+// servedKey is the context key of the calls recorded by WithServed.
+type servedKey struct{}
+
+// servedCalls are the calls recorded in a context.
+type servedCalls struct {
+	mu    sync.Mutex
+	calls []Served
+}
+
+// WithServed returns ctx recording the calls of MultiClient made with it and
+// the nodes that served them, e.g. to tell which provider served the logs of
+// a batch. Read them with ServedCalls.
+func WithServed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, servedKey{}, &servedCalls{})
+}
+
+// ServedCalls returns the calls recorded in ctx by WithServed, in the order
+// they were served, nil without WithServed.
+func ServedCalls(ctx context.Context) []Served {
+	rec, ok := ctx.Value(servedKey{}).(*servedCalls)
+	if !ok {
+		return nil
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]Served(nil), rec.calls...)
+}
+
+// recordServed records the call of method served by n after attempts tries
+// in ctx, if made WithServed.
+func recordServed(ctx context.Context, method string, n *Node, attempts int) {
+	rec, ok := ctx.Value(servedKey{}).(*servedCalls)
+	if !ok {
+		return
+	}
+	node := "REDACTED"
+	if u, err := url.Parse(n.URL()); err == nil && u.Host != "" {
+		node = u.Scheme + "://" + u.Host
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.calls = append(rec.calls, Served{Method: method, Node: node, Attempts: attempts, At: time.Now()})
+}
@@ -0,0 +1,21 @@
+package rpc
+
+import (
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// SingleClient adapts a plain ethclient.Client to Client, for unit tests and
+// simple scripts scanning a single node: there is no failover, rate limiting
+// or health tracking, use MultiClient for these.
+//
+//	ec, err := ethclient.DialContext(ctx, url)
+//	...
+//	s := scanner.New(rpc.WrapEthClient(ec), store, cfg, filter)
+type SingleClient struct {
+	*ethclient.Client
+}
+
+// WrapEthClient returns the SingleClient of ec. Closing it closes ec.
+func WrapEthClient(ec *ethclient.Client) *SingleClient {
+	return &SingleClient{Client: ec}
+}
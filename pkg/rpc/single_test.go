@@ -0,0 +1,50 @@
+package rpc
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// ethService is the eth namespace of a node at block 500.
+type ethService struct{}
+
+func (ethService) ChainId() *hexutil.Big { return (*hexutil.Big)(big.NewInt(5)) }
+
+func (ethService) BlockNumber() hexutil.Uint64 { return 500 }
+
+func (ethService) GetLogs(q struct {
+	FromBlock *hexutil.Big `json:"fromBlock"`
+}) []types.Log {
+	return []types.Log{{BlockNumber: q.FromBlock.ToInt().Uint64(), Topics: []common.Hash{}}}
+}
+
+func TestWrapEthClient(t *testing.T) {
+	server := gethrpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", ethService{}))
+	defer server.Stop()
+
+	var client Client = WrapEthClient(ethclient.NewClient(gethrpc.DialInProc(server)))
+	defer client.Close()
+	ctx := context.Background()
+
+	id, err := client.ChainID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), id.Int64())
+	head, err := client.BlockNumber(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(500), head)
+	logs, err := client.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(42), ToBlock: big.NewInt(50)})
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, uint64(42), logs[0].BlockNumber)
+	}
+}
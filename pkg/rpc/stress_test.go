@@ -116,7 +116,7 @@ func TestMultiClient_HighConcurrencyStressTest(t *testing.T) {
 	nodes := make([]*Node, 3)
 	for i := 0; i < 3; i++ {
 		mockEth := new(MockEthClient)
-		mockEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+		mockEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil)
 
 		nodes[i] = NewNodeWithClient(NodeConfig{
 			URL:           "node" + string(rune('1'+i)),
@@ -126,7 +126,7 @@ func TestMultiClient_HighConcurrencyStressTest(t *testing.T) {
 		}, mockEth)
 	}
 
-	mc, err := NewClientWithNodes(ctx, nodes)
+	mc, err := NewClientWithNodes(ctx, nodes, WithoutBackgroundSync())
 	assert.NoError(t, err)
 
 	// Launch 200 concurrent requests
@@ -284,7 +284,7 @@ func BenchmarkMultiClient_BlockNumber(b *testing.B) {
 	ctx := context.Background()
 
 	mockEth := new(MockEthClient)
-	mockEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+	mockEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil)
 
 	node := NewNodeWithClient(NodeConfig{
 		URL:           "test",
@@ -293,7 +293,7 @@ func BenchmarkMultiClient_BlockNumber(b *testing.B) {
 		MaxConcurrent: 100,
 	}, mockEth)
 
-	mc, _ := NewClientWithNodes(ctx, []*Node{node})
+	mc, _ := NewClientWithNodes(ctx, []*Node{node}, WithoutBackgroundSync())
 
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
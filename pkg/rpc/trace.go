@@ -0,0 +1,244 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// TraceAPI is the API a node traces blocks with, see NodeConfig.Trace.
+type TraceAPI string
+
+const (
+	// TraceDebug traces with debug_traceBlockByNumber and the callTracer
+	// (Geth, Erigon, Reth, Nethermind).
+	TraceDebug TraceAPI = "debug"
+	// TraceParity traces with trace_block (Erigon, OpenEthereum, Nethermind).
+	TraceParity TraceAPI = "parity"
+)
+
+// ParseTraceAPI converts a configuration value into a TraceAPI. Empty means
+// a node without trace API.
+func ParseTraceAPI(s string) (TraceAPI, error) {
+	switch TraceAPI(s) {
+	case "", TraceDebug, TraceParity:
+		return TraceAPI(s), nil
+	default:
+		return "", fmt.Errorf("unsupported trace api: %q", s)
+	}
+}
+
+// MethodTraceBlock is the key of TraceBlock calls in
+// NodeConfig.MethodPriorities, whichever the TraceAPI of the node.
+const MethodTraceBlock = "trace_block"
+
+// ErrTraceUnsupported is returned by Node.TraceBlock for nodes without a
+// TraceAPI.
+var ErrTraceUnsupported = errors.New("node has no trace api")
+
+// Trace is a call of a transaction, from the trace of its block: the
+// transaction itself at Depth 0, its internal calls deeper.
+type Trace struct {
+	BlockNumber uint64
+	TxHash      common.Hash // Zero for nodes whose callTracer omits it
+	TxIndex     uint
+	Type        string // CALL, CREATE, CREATE2, SELFDESTRUCT, DELEGATECALL, ...
+	From        common.Address
+	To          common.Address // The created contract, or the beneficiary of SELFDESTRUCT
+	Value       *big.Int       // Nil without any
+	Depth       int
+	// Reverted is set if the call or one of its callers failed: its value
+	// was not transferred.
+	Reverted bool
+}
+
+// IsTransfer reports whether the call moved value: a call, creation or
+// self-destruct with a value, not reverted.
+func (t Trace) IsTransfer() bool {
+	if t.Reverted || t.Value == nil || t.Value.Sign() <= 0 {
+		return false
+	}
+	// Delegate and static calls keep the value in the caller
+	return t.Type != "DELEGATECALL" && t.Type != "STATICCALL" && t.Type != "CALLCODE"
+}
+
+// rawCaller makes the JSON-RPC calls ethclient has no method for.
+type rawCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// Supports reports whether the node serves a JSON-RPC method: trace_block
+// only with a TraceAPI, any other method.
+func (n *Node) Supports(method string) bool {
+	if method == MethodTraceBlock {
+		return n.config.Trace != "" && n.raw != nil
+	}
+	return true
+}
+
+// TraceBlock retrieves the calls of the transactions of a block with the
+// TraceAPI of the node.
+func (n *Node) TraceBlock(ctx context.Context, number *big.Int) ([]Trace, error) {
+	if !n.Supports(MethodTraceBlock) {
+		return nil, ErrTraceUnsupported
+	}
+	var raw json.RawMessage
+	start := time.Now()
+	var err error
+	if n.config.Trace == TraceParity {
+		err = n.raw.CallContext(ctx, &raw, "trace_block", hexutil.EncodeBig(number))
+	} else {
+		err = n.raw.CallContext(ctx, &raw, "debug_traceBlockByNumber", hexutil.EncodeBig(number), map[string]string{"tracer": "callTracer"})
+	}
+	n.RecordMetric(start, err)
+	if err != nil {
+		return nil, err
+	}
+	if n.config.Trace == TraceParity {
+		return parseParityTraces(raw)
+	}
+	return parseCallTraces(number.Uint64(), raw)
+}
+
+// TraceBlock retrieves the calls of the transactions of a block from the
+// best available node with a TraceAPI, e.g. to find the value transfers of
+// internal calls, which leave no logs. Tracing costs the node far more than
+// eth_getLogs.
+func (mc *MultiClient) TraceBlock(ctx context.Context, number *big.Int) ([]Trace, error) {
+	var res []Trace
+	err := mc.execute(ctx, MethodTraceBlock, func(n *Node) error {
+		var e error
+		res, e = n.TraceBlock(ctx, number)
+		return e
+	})
+	return res, err
+}
+
+// callFrame is a call of the callTracer.
+type callFrame struct {
+	Type  string         `json:"type"`
+	From  common.Address `json:"from"`
+	To    common.Address `json:"to"`
+	Value *hexutil.Big   `json:"value"`
+	Error string         `json:"error"`
+	Calls []callFrame    `json:"calls"`
+}
+
+// parseCallTraces flattens the callTracer traces of the transactions of
+// block, in the order of their calls.
+func parseCallTraces(block uint64, raw json.RawMessage) ([]Trace, error) {
+	var txs []struct {
+		TxHash common.Hash `json:"txHash"`
+		Result *callFrame  `json:"result"`
+		Error  string      `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &txs); err != nil {
+		return nil, fmt.Errorf("decode call traces: %w", err)
+	}
+	var traces []Trace
+	var walk func(tx int, hash common.Hash, f *callFrame, depth int, reverted bool)
+	walk = func(tx int, hash common.Hash, f *callFrame, depth int, reverted bool) {
+		reverted = reverted || f.Error != ""
+		traces = append(traces, Trace{
+			BlockNumber: block,
+			TxHash:      hash,
+			TxIndex:     uint(tx),
+			Type:        strings.ToUpper(f.Type),
+			From:        f.From,
+			To:          f.To,
+			Value:       (*big.Int)(f.Value),
+			Depth:       depth,
+			Reverted:    reverted,
+		})
+		for i := range f.Calls {
+			walk(tx, hash, &f.Calls[i], depth+1, reverted)
+		}
+	}
+	for i, tx := range txs {
+		if tx.Error != "" {
+			return nil, fmt.Errorf("trace of transaction %d: %s", i, tx.Error)
+		}
+		if tx.Result != nil {
+			walk(i, tx.TxHash, tx.Result, 0, false)
+		}
+	}
+	return traces, nil
+}
+
+// parseParityTraces converts the trace_block traces of the transactions of a
+// block, skipping its rewards.
+func parseParityTraces(raw json.RawMessage) ([]Trace, error) {
+	var entries []struct {
+		Type   string `json:"type"`
+		Action struct {
+			CallType      string         `json:"callType"`
+			From          common.Address `json:"from"`
+			To            common.Address `json:"to"`
+			Value         *hexutil.Big   `json:"value"`
+			Address       common.Address `json:"address"`       // Self-destructed contract
+			RefundAddress common.Address `json:"refundAddress"` // Its beneficiary
+			Balance       *hexutil.Big   `json:"balance"`
+		} `json:"action"`
+		Result *struct {
+			Address common.Address `json:"address"` // Created contract
+		} `json:"result"`
+		Error               string       `json:"error"`
+		BlockNumber         uint64       `json:"blockNumber"`
+		TransactionHash     *common.Hash `json:"transactionHash"`
+		TransactionPosition uint         `json:"transactionPosition"`
+		TraceAddress        []int        `json:"traceAddress"`
+	}
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("decode parity traces: %w", err)
+	}
+	var traces []Trace
+	// Trace addresses of the failed calls of the current transaction
+	var failed [][]int
+	for _, e := range entries {
+		if e.TransactionHash == nil {
+			continue // Block and uncle rewards
+		}
+		if len(e.TraceAddress) == 0 {
+			failed = failed[:0]
+		}
+		t := Trace{
+			BlockNumber: e.BlockNumber,
+			TxHash:      *e.TransactionHash,
+			TxIndex:     e.TransactionPosition,
+			From:        e.Action.From,
+			To:          e.Action.To,
+			Value:       (*big.Int)(e.Action.Value),
+			Depth:       len(e.TraceAddress),
+		}
+		switch e.Type {
+		case "call":
+			t.Type = strings.ToUpper(e.Action.CallType)
+		case "create":
+			t.Type = "CREATE"
+			if e.Result != nil {
+				t.To = e.Result.Address
+			}
+		case "suicide":
+			t.Type = "SELFDESTRUCT"
+			t.From, t.To, t.Value = e.Action.Address, e.Action.RefundAddress, (*big.Int)(e.Action.Balance)
+		default:
+			t.Type = strings.ToUpper(e.Type)
+		}
+		t.Reverted = e.Error != "" || slices.ContainsFunc(failed, func(prefix []int) bool {
+			return len(prefix) <= len(e.TraceAddress) && slices.Equal(prefix, e.TraceAddress[:len(prefix)])
+		})
+		if e.Error != "" {
+			failed = append(failed, e.TraceAddress)
+		}
+		traces = append(traces, t)
+	}
+	return traces, nil
+}
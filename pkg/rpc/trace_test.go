@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	traceEOA    = common.HexToAddress("0xaa")
+	traceRouter = common.HexToAddress("0xc1")
+	traceUser   = common.HexToAddress("0xbb")
+	traceChild  = common.HexToAddress("0xd1")
+	oneEther    = big.NewInt(1e18)
+	halfEther   = big.NewInt(5e17)
+	tenthEther  = big.NewInt(1e17)
+)
+
+// transfers returns the traces moving value.
+func transfers(traces []Trace) []Trace {
+	var res []Trace
+	for _, t := range traces {
+		if t.IsTransfer() {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+func readTraceFixture(t *testing.T, name string) json.RawMessage {
+	data, err := os.ReadFile("testdata/" + name)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestParseCallTraces(t *testing.T) {
+	traces, err := parseCallTraces(100, readTraceFixture(t, "trace_debug.json"))
+	assert.NoError(t, err)
+	assert.Len(t, traces, 6)
+
+	swap := common.HexToHash("0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060")
+	// The delegate and static calls, and the calls of the reverted
+	// transaction, move no value
+	assert.Equal(t, []Trace{
+		{BlockNumber: 100, TxHash: swap, Type: "CALL", From: traceEOA, To: traceRouter, Value: oneEther},
+		{BlockNumber: 100, TxHash: swap, Type: "CALL", From: traceRouter, To: traceUser, Value: halfEther, Depth: 1},
+	}, transfers(traces))
+	assert.Equal(t, "DELEGATECALL", traces[3].Type)
+	assert.True(t, traces[5].Reverted)
+	assert.Equal(t, uint(1), traces[5].TxIndex)
+
+	_, err = parseCallTraces(100, json.RawMessage(`[{"error":"execution timeout"}]`))
+	assert.ErrorContains(t, err, "execution timeout")
+}
+
+func TestParseParityTraces(t *testing.T) {
+	traces, err := parseParityTraces(readTraceFixture(t, "trace_parity.json"))
+	assert.NoError(t, err)
+	// Without the block reward
+	assert.Len(t, traces, 6)
+
+	swap := common.HexToHash("0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060")
+	assert.Equal(t, []Trace{
+		{BlockNumber: 100, TxHash: swap, Type: "CALL", From: traceEOA, To: traceRouter, Value: oneEther},
+		{BlockNumber: 100, TxHash: swap, Type: "CALL", From: traceRouter, To: traceUser, Value: halfEther, Depth: 1},
+		{BlockNumber: 100, TxHash: swap, Type: "CREATE", From: traceRouter, To: traceChild, Value: tenthEther, Depth: 1},
+		{BlockNumber: 100, TxHash: swap, Type: "SELFDESTRUCT", From: traceChild, To: traceUser, Value: tenthEther, Depth: 2},
+	}, transfers(traces))
+	// The call of the reverted transaction reverted too
+	assert.True(t, traces[5].Reverted)
+	assert.Equal(t, uint(1), traces[5].TxIndex)
+}
+
+// tracingEthClient is a MockEthClient serving raw JSON-RPC calls.
+type tracingEthClient struct {
+	MockEthClient
+}
+
+func (m *tracingEthClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	called := m.Called(method)
+	if raw, ok := called.Get(0).(json.RawMessage); ok {
+		*result.(*json.RawMessage) = raw
+	}
+	return called.Error(1)
+}
+
+func TestMultiClient_TraceBlock(t *testing.T) {
+	ctx := context.Background()
+
+	// The preferred node cannot trace
+	plainEth := new(tracingEthClient)
+	plainEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+	tracerEth := new(tracingEthClient)
+	tracerEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+	tracerEth.On("CallContext", "trace_block").Return(readTraceFixture(t, "trace_parity.json"), nil).Once()
+
+	plain := NewNodeWithClient(NodeConfig{URL: "plain", Priority: 10}, plainEth)
+	tracer := NewNodeWithClient(NodeConfig{URL: "tracer", Priority: 1, Trace: TraceParity}, tracerEth)
+	assert.False(t, plain.Supports(MethodTraceBlock))
+	assert.True(t, tracer.Supports(MethodTraceBlock))
+	assert.True(t, plain.Supports(MethodGetLogs))
+
+	mc, err := NewClientWithNodes(ctx, []*Node{plain, tracer})
+	assert.NoError(t, err)
+	traces, err := mc.TraceBlock(ctx, big.NewInt(100))
+	assert.NoError(t, err)
+	assert.Len(t, traces, 6)
+	plainEth.AssertNotCalled(t, "CallContext", mock.Anything)
+	tracerEth.AssertExpectations(t)
+
+	// Without any tracing node
+	mc, err = NewClientWithNodes(ctx, []*Node{plain})
+	assert.NoError(t, err)
+	_, err = mc.TraceBlock(ctx, big.NewInt(100))
+	assert.ErrorIs(t, err, ErrMethodUnsupported)
+
+	// A node of the debug API
+	debugEth := new(tracingEthClient)
+	debugEth.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Maybe()
+	debugEth.On("CallContext", "debug_traceBlockByNumber").Return(readTraceFixture(t, "trace_debug.json"), nil).Once()
+	traces, err = NewNodeWithClient(NodeConfig{URL: "debug", Trace: TraceDebug}, debugEth).TraceBlock(ctx, big.NewInt(100))
+	assert.NoError(t, err)
+	assert.Len(t, traces, 6)
+	debugEth.AssertExpectations(t)
+
+	_, err = NewClient(ctx, []NodeConfig{{URL: "http://localhost:1", Trace: "geth"}})
+	assert.EqualError(t, err, `node http://localhost:1: unsupported trace api: "geth"`)
+}
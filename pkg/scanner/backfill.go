@@ -0,0 +1,63 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// BackfillKey returns the key of the cursor Backfill saves its progress under
+// for the backfill name on chainID, apart from the cursor of Start.
+func BackfillKey(chainID, name string) string {
+	return chainID + ":backfill:" + name
+}
+
+// Backfill passes the logs of the blocks from to to matching filter alone to
+// the handler, through its middleware, in batches of BatchSize blocks, e.g.
+// for a contract added while the scanner runs: backfill it up to the block
+// Start reached, then AddContractFrom the next block to the filter of the
+// scanner. It saves its progress under BackfillKey, resuming there when
+// called again with the same name, and leaves the cursor of Start alone, so
+// it may run while Start does. A failed batch returns its error. The
+// TxHandler does not apply: it saves the cursor of Start.
+func (s *Scanner) Backfill(ctx context.Context, name string, filter *Filter, from, to uint64) error {
+	return s.BackfillSet(ctx, name, NewFilterSet(filter), from, to)
+}
+
+// BackfillSet is Backfill for the logs matching any filter of set, e.g. the
+// FilterSet of the scanner to reprocess a range it already scanned.
+func (s *Scanner) BackfillSet(ctx context.Context, name string, set *FilterSet, from, to uint64) error {
+	if from > to {
+		return fmt.Errorf("invalid range: from %d is after to %d", from, to)
+	}
+	if s.txHandler != nil {
+		return errors.New("backfill does not support a TxHandler")
+	}
+	key := BackfillKey(s.config.ChainID, name)
+	saved, err := s.store.LoadCursor(ctx, key)
+	if err != nil {
+		return fmt.Errorf("load backfill cursor: %w", err)
+	}
+	start := max(from, saved)
+	log.Info("Backfill started", "chain_id", s.config.ChainID, "name", name, "from", start, "to", to, "filter", set)
+	for ; start <= to; start += s.config.BatchSize {
+		end := min(start+s.config.BatchSize-1, to)
+		fetchCtx := rpc.WithServed(ctx)
+		logs, _, err := s.fetchSetLogs(fetchCtx, set, start, end)
+		if err != nil {
+			return err
+		}
+		if err := s.handle(withProvenance(ctx, fetchCtx, start, end), s.sortLogs(logs), end+1); err != nil {
+			return err
+		}
+		if err := s.store.SaveCursor(ctx, key, end+1); err != nil {
+			return fmt.Errorf("save backfill cursor: %w", err)
+		}
+		log.Info("Backfill progress", "chain_id", s.config.ChainID, "name", name, "next", end+1, "to", to, "logs", len(logs))
+	}
+	log.Info("Backfill done", "chain_id", s.config.ChainID, "name", name, "to", to)
+	return nil
+}
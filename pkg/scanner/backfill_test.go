@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestScanner_ContractStarts(t *testing.T) {
+	client := new(MockRPC)
+	usdt := types.Log{Address: setUSDT, BlockNumber: 105}
+	usdcEarly := types.Log{Address: setUSDC, BlockNumber: 112}
+	usdc := types.Log{Address: setUSDC, BlockNumber: 116}
+	queried := func(from uint64, addrs ...common.Address) interface{} {
+		return mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Uint64() == from && assert.ObjectsAreEqual(addrs, q.Addresses)
+		})
+	}
+	// USDC is left out of the blocks before its start, and its earlier logs
+	// of the range it starts in are dropped
+	client.On("FilterLogs", mock.Anything, queried(100, setUSDT)).Return([]types.Log{usdt}, nil).Once()
+	client.On("FilterLogs", mock.Anything, queried(110, setUSDT, setUSDC)).Return([]types.Log{usdcEarly, usdc}, nil).Once()
+
+	s := New(client, new(MockStore), Config{BatchSize: 20, MaxLogsRange: 10}, NewFilter().AddContract(setUSDT).AddContractFrom(115, setUSDC))
+	var handled []types.Log
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		handled = append(handled, logs...)
+		return nil
+	})
+	assert.NoError(t, s.scanRange(context.Background(), 100, 119))
+	assert.Equal(t, []types.Log{usdt, usdc}, handled)
+	client.AssertExpectations(t)
+
+	// Without contracts before the start, nothing is requested
+	s.SetFilter(NewFilter().AddContractFrom(115, setUSDC))
+	handled = nil
+	assert.NoError(t, s.scanRange(context.Background(), 100, 109))
+	assert.Empty(t, handled)
+	client.AssertExpectations(t)
+}
+
+func TestScanner_Backfill(t *testing.T) {
+	ctx := context.Background()
+	client := new(MockRPC)
+	first := types.Log{Address: setUSDC, BlockNumber: 104}
+	second := types.Log{Address: setUSDC, BlockNumber: 112}
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Uint64() == 100 && assert.ObjectsAreEqual([]common.Address{setUSDC}, q.Addresses)
+	})).Return([]types.Log{first}, nil).Once()
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Uint64() == 110 && q.ToBlock.Uint64() == 114
+	})).Return([]types.Log{second}, nil).Once()
+
+	store := storage.NewMemoryStore("")
+	assert.NoError(t, store.SaveCursor(ctx, "1", 150))
+	s := New(client, store, Config{ChainID: "1", BatchSize: 10}, NewFilter().AddContract(setUSDT))
+	var handled []types.Log
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		handled = append(handled, logs...)
+		return nil
+	})
+	filter := NewFilter().AddContract(setUSDC)
+	assert.NoError(t, s.Backfill(ctx, "usdc", filter, 100, 114))
+	assert.Equal(t, []types.Log{first, second}, handled)
+	client.AssertExpectations(t)
+
+	// The backfill keeps its own cursor, the main one is unaffected
+	next, err := store.LoadCursor(ctx, BackfillKey("1", "usdc"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(115), next)
+	next, err = store.LoadCursor(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(150), next)
+
+	// Called again, it resumes at its cursor: nothing is left to scan
+	handled = nil
+	assert.NoError(t, s.Backfill(ctx, "usdc", filter, 100, 114))
+	assert.Empty(t, handled)
+	client.AssertExpectations(t)
+
+	assert.ErrorContains(t, s.Backfill(ctx, "usdc", filter, 115, 114), "invalid range")
+}
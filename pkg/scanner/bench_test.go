@@ -0,0 +1,138 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// benchContract is the contract the benchmarks filter on.
+var benchContract = common.HexToAddress("0x00000000000000000000000000000000000000be")
+
+// benchRPC is an in-memory node of the blocks 1 to head, each with the same
+// number of synthetic logs, as filtered by eth_getLogs. Only the methods the
+// Scanner calls to scan logs are implemented.
+type benchRPC struct {
+	rpc.Client
+	head uint64
+	logs [][]types.Log // By block
+}
+
+// newBenchRPC returns the node of blocks blocks of logsPerBlock logs, match
+// percent of them from benchContract and the others from other contracts.
+func newBenchRPC(blocks uint64, logsPerBlock, match int) *benchRPC {
+	other := common.HexToAddress("0x00000000000000000000000000000000000000ff")
+	topics := []common.Hash{common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"), {}, {}}
+	data := make([]byte, 32)
+	n := &benchRPC{head: blocks, logs: make([][]types.Log, blocks+1)}
+	for block := uint64(1); block <= blocks; block++ {
+		logs := make([]types.Log, logsPerBlock)
+		for i := range logs {
+			addr := other
+			if (int(block)*logsPerBlock+i)%100 < match {
+				addr = benchContract
+			}
+			logs[i] = types.Log{Address: addr, Topics: topics, Data: data, BlockNumber: block, TxHash: common.BigToHash(big.NewInt(int64(block))), Index: uint(i)}
+		}
+		n.logs[block] = logs
+	}
+	return n
+}
+
+func (n *benchRPC) BlockNumber(ctx context.Context) (uint64, error) { return n.head, nil }
+
+func (n *benchRPC) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for block := q.FromBlock.Uint64(); block <= q.ToBlock.Uint64() && block <= n.head; block++ {
+		for _, l := range n.logs[block] {
+			for _, addr := range q.Addresses {
+				if l.Address == addr {
+					logs = append(logs, l)
+					break
+				}
+			}
+		}
+	}
+	return logs, nil
+}
+
+// benchmarkBackfill scans the blocks of node from the first to the last with
+// a Scanner of batchSize blocks per batch, reporting the blocks and logs
+// scanned per second.
+func benchmarkBackfill(b *testing.B, node *benchRPC, batchSize uint64) {
+	var handled int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s := New(node, storage.NewMemoryStore(""), Config{
+			ChainID:    "bench",
+			StartBlock: 1,
+			EndBlock:   node.head,
+			BatchSize:  batchSize,
+			Interval:   time.Millisecond,
+		}, NewFilter().AddContract(benchContract))
+		s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+			handled += len(logs)
+			return nil
+		})
+		if err := s.Start(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+	elapsed := b.Elapsed().Seconds()
+	b.ReportMetric(float64(node.head)*float64(b.N)/elapsed, "blocks/s")
+	b.ReportMetric(float64(handled)/elapsed, "logs/s")
+}
+
+// BenchmarkScanner_Backfill measures the throughput of a backfill of 10000
+// blocks against an in-memory node, by batch size, logs per block and share
+// of the logs matching the filter. Compare runs with benchstat, see
+// "make bench".
+func BenchmarkScanner_Backfill(b *testing.B) {
+	const blocks = 10000
+	for _, logsPerBlock := range []int{1, 50} {
+		for _, match := range []int{1, 100} {
+			node := newBenchRPC(blocks, logsPerBlock, match)
+			for _, batchSize := range []uint64{10, 100, 1000} {
+				name := fmt.Sprintf("logs=%d/match=%d%%/batch=%d", logsPerBlock, match, batchSize)
+				b.Run(name, func(b *testing.B) { benchmarkBackfill(b, node, batchSize) })
+			}
+		}
+	}
+}
+
+// BenchmarkWatchlist_ContainsTopic measures matching a log topic against a
+// watchlist of 500k addresses, for addresses in it and, the common case of
+// deposit monitoring, not in it.
+func BenchmarkWatchlist_ContainsTopic(b *testing.B) {
+	const size = 500000
+	addrs := make([]common.Address, size)
+	for i := range addrs {
+		addrs[i] = common.BytesToAddress(crypto.Keccak256(big.NewInt(int64(i)).Bytes()))
+	}
+	w := NewWatchlist(addrs...)
+	topics := make([]common.Hash, 1024)
+	for _, bench := range []struct {
+		name   string
+		offset int
+	}{{"hit", 0}, {"miss", size}} {
+		for i := range topics {
+			topics[i] = common.BytesToHash(crypto.Keccak256(big.NewInt(int64(bench.offset + i)).Bytes())[12:])
+		}
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				w.ContainsTopic(topics[n%len(topics)])
+			}
+		})
+	}
+}
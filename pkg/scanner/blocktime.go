@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// SetBlockTimestamps sets Config.BlockTimestamps, also while the scanner
+// runs, from the next batch on.
+func (s *Scanner) SetBlockTimestamps(on bool) {
+	s.blockTimes.Store(on)
+}
+
+// fillBlockTimestamps sets the BlockTimestamp of the logs without one to the
+// time of the header of their block, fetched once per block.
+func (s *Scanner) fillBlockTimestamps(ctx context.Context, logs []types.Log) error {
+	times := make(map[uint64]uint64)
+	for i := range logs {
+		l := &logs[i]
+		if l.BlockTimestamp != 0 {
+			continue
+		}
+		t, ok := times[l.BlockNumber]
+		if !ok {
+			header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(l.BlockNumber))
+			if err != nil {
+				return fmt.Errorf("block %d timestamp: %w", l.BlockNumber, err)
+			}
+			t = header.Time
+			times[l.BlockNumber] = t
+		}
+		l.BlockTimestamp = t
+	}
+	return nil
+}
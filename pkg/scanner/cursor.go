@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// CursorFailurePolicy is what the scanner does once MaxUnsavedBlocks were
+// scanned past the last saved cursor.
+type CursorFailurePolicy string
+
+const (
+	// CursorFailurePause stops scanning until the cursor is saved (default).
+	CursorFailurePause CursorFailurePolicy = "pause"
+	// CursorFailureStop makes Start return an error wrapping ErrCursorUnsaved.
+	CursorFailureStop CursorFailurePolicy = "stop"
+)
+
+// ParseCursorFailurePolicy converts a configuration value into a
+// CursorFailurePolicy. Empty means CursorFailurePause.
+func ParseCursorFailurePolicy(s string) (CursorFailurePolicy, error) {
+	switch CursorFailurePolicy(s) {
+	case "":
+		return CursorFailurePause, nil
+	case CursorFailurePause, CursorFailureStop:
+		return CursorFailurePolicy(s), nil
+	default:
+		return "", fmt.Errorf("unsupported cursor failure policy: %q", s)
+	}
+}
+
+// ErrCursorUnsaved is wrapped by the error Start returns with
+// CursorFailureStop once MaxUnsavedBlocks were scanned past the last saved
+// cursor.
+var ErrCursorUnsaved = errors.New("too many blocks scanned past the saved cursor")
+
+// saveProgress saves next as the cursor after a batch. Failures are logged
+// and counted, and scanning goes on until MaxUnsavedBlocks were scanned past
+// the last saved cursor: then, per CursorFailurePolicy, it retries every
+// Interval until the cursor is saved, or returns ErrCursorUnsaved.
+func (s *Scanner) saveProgress(ctx context.Context, next uint64) error {
+	paused := false
+	for {
+		err := s.saveCursorRetry(ctx, next)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Error("Failed to save cursor", "chain_id", s.config.ChainID, "err", err)
+		s.setError(err)
+		if s.storeFailingSince.IsZero() {
+			s.storeFailingSince = time.Now()
+		}
+		unsaved := uint64(0)
+		if next > s.lastSaved {
+			unsaved = next - s.lastSaved
+		}
+		if s.config.MaxUnsavedBlocks == 0 || unsaved < s.config.MaxUnsavedBlocks {
+			return nil
+		}
+		if s.config.CursorFailurePolicy == CursorFailureStop {
+			return fmt.Errorf("%w: %d blocks since block %d: %w", ErrCursorUnsaved, unsaved, s.lastSaved, err)
+		}
+		if !paused {
+			log.Warn("Too many blocks scanned past the saved cursor, pausing scan",
+				"chain_id", s.config.ChainID, "saved", s.lastSaved, "next", next)
+			paused = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.config.Interval):
+		}
+	}
+	if paused {
+		log.Info("Cursor saved again, resuming scan", "chain_id", s.config.ChainID, "next", next)
+	}
+	s.storeFailingSince = time.Time{}
+	s.lastSaved = next
+	return nil
+}
+
+// saveCursorRetry saves next as the cursor, retrying CursorSaveRetries times
+// with a backoff doubling from CursorSaveBackoff. Stats.CursorSaveFailures
+// counts the failed attempts until one succeeds.
+func (s *Scanner) saveCursorRetry(ctx context.Context, next uint64) error {
+	backoff := s.config.CursorSaveBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.saveCursor(ctx, next)
+		if err == nil {
+			s.updateStats(func(st *Stats) { st.CursorSaveFailures = 0 })
+			return nil
+		}
+		s.updateStats(func(st *Stats) { st.CursorSaveFailures++ })
+		if attempt >= s.config.CursorSaveRetries {
+			return err
+		}
+		log.Warn("Failed to save cursor, retrying", "chain_id", s.config.ChainID, "err", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
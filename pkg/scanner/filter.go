@@ -1,11 +1,18 @@
 package scanner
 
 import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"math"
 	"math/big"
+	"slices"
+	"strings"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // Filter defines the scanning rules for the scanner.
@@ -19,6 +26,33 @@ type Filter struct {
 	// Maps to eth_getLogs topics parameter: [[A, B], [C], null, [D]]
 	// Logical relation: (Topic0 in [A, B]) AND (Topic1 in [C])
 	Topics [][]common.Hash
+
+	// ExcludedContracts and ExcludedTopics drop, from the logs matching the
+	// above, those of these contracts or with one of these topics at a
+	// position. eth_getLogs cannot express them: the logs are fetched, and
+	// dropped by the Scanner before its handler, so they still cost bandwidth
+	// and RPC quota. Bloom checks ignore them.
+	ExcludedContracts []common.Address
+	ExcludedTopics    [][]common.Hash
+
+	// Watchlists constrain topic positions like Topics, to the addresses of
+	// a Watchlist, e.g. the recipients of transfers: a log matches if the
+	// topic at every position with a Watchlist is one of its addresses. Too
+	// large for eth_getLogs, they are matched by the Scanner like the
+	// exclusions. Bloom checks ignore them. See Watch.
+	Watchlists []*Watchlist
+
+	// ContractStarts holds the first block to scan for some of Contracts,
+	// e.g. the deployment block of a contract added to a running scanner:
+	// the requests of blocks before it leave the contract out, and its logs
+	// there do not match. See AddContractFrom.
+	ContractStarts map[common.Address]uint64
+
+	// SampleRate keeps one log in SampleRate of those matching the filter,
+	// e.g. for analytics of all transfers, 0 or 1 keeping all of them. The
+	// same logs are kept on every scan: they are picked by their transaction
+	// hash and index. Stats.SampledOut counts the others. See Sampled.
+	SampleRate uint64
 }
 
 // NewFilter creates a new filter
@@ -35,6 +69,21 @@ func (f *Filter) AddContract(addrs ...common.Address) *Filter {
 	return f
 }
 
+// AddContractFrom adds contract addresses to listen to from block start on,
+// or sets the start of those already listened to, see ContractStarts.
+func (f *Filter) AddContractFrom(start uint64, addrs ...common.Address) *Filter {
+	if f.ContractStarts == nil {
+		f.ContractStarts = make(map[common.Address]uint64, len(addrs))
+	}
+	for _, addr := range addrs {
+		f.ContractStarts[addr] = start
+		if !slices.Contains(f.Contracts, addr) {
+			f.Contracts = append(f.Contracts, addr)
+		}
+	}
+	return f
+}
+
 // SetTopic sets the topics at a specific position
 // pos: 0-3 (0 is typically the event signature hash)
 func (f *Filter) SetTopic(pos int, hashes ...common.Hash) *Filter {
@@ -49,7 +98,401 @@ func (f *Filter) SetTopic(pos int, hashes ...common.Hash) *Filter {
 	return f
 }
 
-// ToQuery converts the filter to go-ethereum standard query parameters
+// Clone returns a deep copy of the filter, sharing its Watchlists.
+func (f *Filter) Clone() *Filter {
+	c := &Filter{
+		Contracts:         slices.Clone(f.Contracts),
+		Topics:            cloneTopics(f.Topics),
+		ExcludedContracts: slices.Clone(f.ExcludedContracts),
+		ExcludedTopics:    cloneTopics(f.ExcludedTopics),
+		Watchlists:        slices.Clone(f.Watchlists),
+
+		ContractStarts: maps.Clone(f.ContractStarts),
+		SampleRate:     f.SampleRate,
+	}
+	if c.Contracts == nil {
+		c.Contracts = make([]common.Address, 0)
+	}
+	if c.Topics == nil {
+		c.Topics = make([][]common.Hash, 0)
+	}
+	return c
+}
+
+// cloneTopics returns a deep copy of topics.
+func cloneTopics(topics [][]common.Hash) [][]common.Hash {
+	if topics == nil {
+		return nil
+	}
+	c := make([][]common.Hash, len(topics))
+	for i, hashes := range topics {
+		c[i] = slices.Clone(hashes)
+	}
+	return c
+}
+
+// canonical returns the filter with its contracts and the topics of every
+// position sorted and without duplicates, and without the trailing empty
+// positions, which match the same logs. Its ContractStarts are those of its
+// contracts after block 0, nil if none.
+func (f *Filter) canonical() *Filter {
+	c := &Filter{
+		Contracts:         canonicalContracts(f.Contracts),
+		Topics:            canonicalTopics(f.Topics),
+		ExcludedContracts: canonicalContracts(f.ExcludedContracts),
+		ExcludedTopics:    canonicalTopics(f.ExcludedTopics),
+		Watchlists:        canonicalWatchlists(f.Watchlists),
+	}
+	if f.SampleRate > 1 {
+		c.SampleRate = f.SampleRate
+	}
+	for _, addr := range c.Contracts {
+		if start := f.ContractStarts[addr]; start > 0 {
+			if c.ContractStarts == nil {
+				c.ContractStarts = make(map[common.Address]uint64)
+			}
+			c.ContractStarts[addr] = start
+		}
+	}
+	return c
+}
+
+func canonicalWatchlists(watchlists []*Watchlist) []*Watchlist {
+	for len(watchlists) > 0 && watchlists[len(watchlists)-1] == nil {
+		watchlists = watchlists[:len(watchlists)-1]
+	}
+	return watchlists
+}
+
+func canonicalContracts(addrs []common.Address) []common.Address {
+	addrs = slices.Clone(addrs)
+	slices.SortFunc(addrs, func(a, b common.Address) int { return a.Cmp(b) })
+	return slices.Compact(addrs)
+}
+
+func canonicalTopics(topics [][]common.Hash) [][]common.Hash {
+	topics = cloneTopics(topics)
+	for i := range topics {
+		slices.SortFunc(topics[i], func(a, b common.Hash) int { return a.Cmp(b) })
+		topics[i] = slices.Compact(topics[i])
+	}
+	for len(topics) > 0 && len(topics[len(topics)-1]) == 0 {
+		topics = topics[:len(topics)-1]
+	}
+	return topics
+}
+
+// Equal reports whether the filters match the same logs: the order and the
+// duplicates of the contracts and of the topics of a position do not matter.
+// Watchlists are equal if they are the same ones, whatever their addresses.
+func (f *Filter) Equal(other *Filter) bool {
+	if f == nil || other == nil {
+		return f == other
+	}
+	a, b := f.canonical(), other.canonical()
+	equalTopics := func(a, b []common.Hash) bool { return slices.Equal(a, b) }
+	return slices.Equal(a.Contracts, b.Contracts) &&
+		slices.EqualFunc(a.Topics, b.Topics, equalTopics) &&
+		slices.Equal(a.ExcludedContracts, b.ExcludedContracts) &&
+		slices.EqualFunc(a.ExcludedTopics, b.ExcludedTopics, equalTopics) &&
+		slices.Equal(a.Watchlists, b.Watchlists) &&
+		maps.Equal(a.ContractStarts, b.ContractStarts) &&
+		a.SampleRate == b.SampleRate
+}
+
+// Hash returns a digest of the contracts and topics of the filter, the same
+// for Equal filters, e.g. to compare the filters of several processes. Only
+// the positions of Watchlists count, not their addresses.
+func (f *Filter) Hash() common.Hash {
+	c := f.canonical()
+	data := hashFilterItems(nil, c.Contracts, c.Topics)
+	// Separators no topic position is as long as, keeping the digests of the
+	// filters without exclusions or watchlists unchanged
+	if c.hasExclusions() {
+		data = binary.BigEndian.AppendUint32(data, math.MaxUint32)
+		data = hashFilterItems(data, c.ExcludedContracts, c.ExcludedTopics)
+	}
+	if len(c.Watchlists) > 0 {
+		data = binary.BigEndian.AppendUint32(data, math.MaxUint32-1)
+		for pos, w := range c.Watchlists {
+			if w != nil {
+				data = binary.BigEndian.AppendUint32(data, uint32(pos))
+			}
+		}
+	}
+	if len(c.ContractStarts) > 0 {
+		data = binary.BigEndian.AppendUint32(data, math.MaxUint32-2)
+		// In the order of the canonical contracts
+		for _, addr := range c.Contracts {
+			if start, ok := c.ContractStarts[addr]; ok {
+				data = append(data, addr.Bytes()...)
+				data = binary.BigEndian.AppendUint64(data, start)
+			}
+		}
+	}
+	if c.SampleRate > 0 {
+		data = binary.BigEndian.AppendUint32(data, math.MaxUint32-3)
+		data = binary.BigEndian.AppendUint64(data, c.SampleRate)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// hashFilterItems appends contracts and topics to the data hashed by Hash.
+func hashFilterItems(data []byte, contracts []common.Address, topics [][]common.Hash) []byte {
+	data = binary.BigEndian.AppendUint32(data, uint32(len(contracts)))
+	for _, addr := range contracts {
+		data = append(data, addr.Bytes()...)
+	}
+	for _, hashes := range topics {
+		// Each position is prefixed with its length, so that positions cannot shift
+		data = binary.BigEndian.AppendUint32(data, uint32(len(hashes)))
+		for _, hash := range hashes {
+			data = append(data, hash.Bytes()...)
+		}
+	}
+	return data
+}
+
+// filterSummaryItems is the number of contracts or topics of a position
+// String lists before summing up the rest.
+const filterSummaryItems = 3
+
+// String summarizes the filter for logs, e.g.
+// "contracts=* topics=[[0xddf2…b3ef] * [0x0000…a11c]]", with * for any
+// contracts or topics and the number of the items left out of long lists.
+// The exclusions, the sizes of the watchlists, the contract starts and the
+// sample rate follow, if any, e.g. "starts=[0xdAC1…1ec7@19000000] sample=1/100".
+func (f *Filter) String() string {
+	c := f.canonical()
+	var b strings.Builder
+	b.WriteString("contracts=")
+	writeFilterItems(&b, c.Contracts)
+	b.WriteString(" topics=")
+	writeFilterTopics(&b, c.Topics)
+	if len(c.ExcludedContracts) > 0 {
+		b.WriteString(" exclude_contracts=")
+		writeFilterItems(&b, c.ExcludedContracts)
+	}
+	if len(c.ExcludedTopics) > 0 {
+		b.WriteString(" exclude_topics=")
+		writeFilterTopics(&b, c.ExcludedTopics)
+	}
+	if len(c.Watchlists) > 0 {
+		b.WriteString(" watchlists=[")
+		for pos, w := range c.Watchlists {
+			if pos > 0 {
+				b.WriteByte(' ')
+			}
+			if w == nil {
+				b.WriteByte('*')
+			} else {
+				fmt.Fprintf(&b, "[%d addresses]", w.Len())
+			}
+		}
+		b.WriteByte(']')
+	}
+	if len(c.ContractStarts) > 0 {
+		b.WriteString(" starts=[")
+		n := 0
+		for _, addr := range c.Contracts {
+			start, ok := c.ContractStarts[addr]
+			if !ok {
+				continue
+			}
+			if n == filterSummaryItems {
+				fmt.Fprintf(&b, " +%d more", len(c.ContractStarts)-n)
+				break
+			}
+			if n > 0 {
+				b.WriteByte(' ')
+			}
+			hex := addr.Hex()
+			fmt.Fprintf(&b, "%s…%s@%d", hex[:6], hex[len(hex)-4:], start)
+			n++
+		}
+		b.WriteByte(']')
+	}
+	if c.SampleRate > 0 {
+		fmt.Fprintf(&b, " sample=1/%d", c.SampleRate)
+	}
+	return b.String()
+}
+
+// writeFilterTopics writes the topics of every position, or * if there are
+// none.
+func writeFilterTopics(b *strings.Builder, topics [][]common.Hash) {
+	if len(topics) == 0 {
+		b.WriteByte('*')
+		return
+	}
+	b.WriteByte('[')
+	for i, hashes := range topics {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		writeFilterItems(b, hashes)
+	}
+	b.WriteByte(']')
+}
+
+// writeFilterItems writes the first filterSummaryItems of items, shortened,
+// and the number of the others, or * if there are none.
+func writeFilterItems[T interface{ Hex() string }](b *strings.Builder, items []T) {
+	if len(items) == 0 {
+		b.WriteByte('*')
+		return
+	}
+	b.WriteByte('[')
+	for i, item := range items[:min(len(items), filterSummaryItems)] {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		hex := item.Hex()
+		b.WriteString(hex[:6] + "…" + hex[len(hex)-4:])
+	}
+	if len(items) > filterSummaryItems {
+		fmt.Fprintf(b, " +%d more", len(items)-filterSummaryItems)
+	}
+	b.WriteByte(']')
+}
+
+// ExcludeContract drops the logs of contract addresses, see
+// ExcludedContracts.
+func (f *Filter) ExcludeContract(addrs ...common.Address) *Filter {
+	f.ExcludedContracts = append(f.ExcludedContracts, addrs...)
+	return f
+}
+
+// ExcludeTopic drops the logs with one of hashes at position pos, see
+// ExcludedTopics.
+func (f *Filter) ExcludeTopic(pos int, hashes ...common.Hash) *Filter {
+	if len(f.ExcludedTopics) <= pos {
+		f.ExcludedTopics = append(f.ExcludedTopics, make([][]common.Hash, pos+1-len(f.ExcludedTopics))...)
+	}
+	f.ExcludedTopics[pos] = append(f.ExcludedTopics[pos], hashes...)
+	return f
+}
+
+// Watch constrains the topic at position pos to the addresses of w, replacing
+// the watchlist of the position if any. See Watchlists.
+func (f *Filter) Watch(pos int, w *Watchlist) *Filter {
+	if len(f.Watchlists) <= pos {
+		f.Watchlists = append(f.Watchlists, make([]*Watchlist, pos+1-len(f.Watchlists))...)
+	}
+	f.Watchlists[pos] = w
+	return f
+}
+
+// hasExclusions reports whether the filter has exclusions.
+func (f *Filter) hasExclusions() bool {
+	return len(f.ExcludedContracts) > 0 || slices.ContainsFunc(f.ExcludedTopics, func(hashes []common.Hash) bool { return len(hashes) > 0 })
+}
+
+// Excludes reports whether l is dropped by the exclusions of the filter.
+func (f *Filter) Excludes(l types.Log) bool {
+	if slices.Contains(f.ExcludedContracts, l.Address) {
+		return true
+	}
+	for pos, hashes := range f.ExcludedTopics {
+		if pos < len(l.Topics) && slices.Contains(hashes, l.Topics[pos]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watches reports whether the topics of l are in the Watchlists of the
+// filter, true without any.
+func (f *Filter) Watches(l types.Log) bool {
+	for pos, w := range f.Watchlists {
+		if w != nil && (pos >= len(l.Topics) || !w.ContainsTopic(l.Topics[pos])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Started reports whether l is at or after the block its contract starts at
+// in ContractStarts, true for the other contracts.
+func (f *Filter) Started(l types.Log) bool {
+	start, ok := f.ContractStarts[l.Address]
+	return !ok || l.BlockNumber >= start
+}
+
+// Sampled reports whether l is one of the logs kept by the SampleRate of the
+// filter, true for all logs without one.
+func (f *Filter) Sampled(l types.Log) bool {
+	if f.SampleRate <= 1 {
+		return true
+	}
+	return mix64(binary.BigEndian.Uint64(l.TxHash[common.HashLength-8:])+uint64(l.Index))%f.SampleRate == 0
+}
+
+// Matches reports whether l matches the filter: its contracts and topics, as
+// eth_getLogs applies them, its exclusions, its watchlists, its contract
+// starts and its sampling.
+func (f *Filter) Matches(l types.Log) bool {
+	return f.matchesUnsampled(l) && f.Sampled(l)
+}
+
+// matchesUnsampled is Matches without sampling.
+func (f *Filter) matchesUnsampled(l types.Log) bool {
+	if len(f.Contracts) > 0 && !slices.Contains(f.Contracts, l.Address) {
+		return false
+	}
+	if !f.Started(l) {
+		return false
+	}
+	for pos, hashes := range f.Topics {
+		if len(hashes) > 0 && (pos >= len(l.Topics) || !slices.Contains(hashes, l.Topics[pos])) {
+			return false
+		}
+	}
+	return !f.Excludes(l) && f.Watches(l)
+}
+
+// dropLocal returns logs without those the filter Excludes, does not Watch
+// or has not Started, the constraints eth_getLogs cannot apply, leaving logs
+// untouched.
+func (f *Filter) dropLocal(logs []types.Log) []types.Log {
+	if !f.hasExclusions() && len(f.Watchlists) == 0 && len(f.ContractStarts) == 0 {
+		return logs
+	}
+	drop := func(l types.Log) bool { return f.Excludes(l) || !f.Watches(l) || !f.Started(l) }
+	if !slices.ContainsFunc(logs, drop) {
+		return logs
+	}
+	kept := make([]types.Log, 0, len(logs))
+	for _, l := range logs {
+		if !drop(l) {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// at returns the filter to fetch the logs of blocks up to to with: without
+// the contracts starting after to, nil if all of them do, the filter itself
+// if none does.
+func (f *Filter) at(to uint64) *Filter {
+	late := func(addr common.Address) bool {
+		start, ok := f.ContractStarts[addr]
+		return ok && start > to
+	}
+	if !slices.ContainsFunc(f.Contracts, late) {
+		return f
+	}
+	c := *f
+	c.Contracts = slices.DeleteFunc(slices.Clone(f.Contracts), late)
+	if len(c.Contracts) == 0 {
+		// No contracts would match any
+		return nil
+	}
+	return &c
+}
+
+// ToQuery converts the filter to go-ethereum standard query parameters, with
+// its positive constraints only
 func (f *Filter) ToQuery(fromBlock, toBlock uint64) ethereum.FilterQuery {
 	// Build query
 	q := ethereum.FilterQuery{
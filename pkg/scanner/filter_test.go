@@ -1,6 +1,8 @@
 package scanner
 
 import (
+	"math/big"
+	"slices"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -83,4 +85,156 @@ func TestFilter_MatchesBloom(t *testing.T) {
 	// Contract matches, but Topic doesn't -> False
 	f6 := NewFilter().AddContract(addr1).SetTopic(0, common.HexToHash("0xbb"))
 	assert.False(t, f6.MatchesBloom(bloom))
+
+	// 5. Exclusions are ignored, the block may hold other logs
+	f7 := NewFilter().ExcludeContract(addr1).ExcludeTopic(0, topic1)
+	assert.True(t, f7.MatchesBloom(bloom))
+}
+
+func TestFilter_Equal(t *testing.T) {
+	a, b, c := common.HexToAddress("0x1111"), common.HexToAddress("0x2222"), common.HexToAddress("0x3333")
+	t0, t1, t2 := common.HexToHash("0xaaaa"), common.HexToHash("0xbbbb"), common.HexToHash("0xcccc")
+	f := NewFilter().AddContract(a, b).SetTopic(0, t0, t1).SetTopic(2, t2)
+
+	// Permuted, duplicated and with trailing wildcards, the same logs match
+	for _, same := range []*Filter{
+		NewFilter().AddContract(b, a).SetTopic(0, t1, t0).SetTopic(2, t2),
+		NewFilter().AddContract(a, b, a).SetTopic(0, t0, t1, t0).SetTopic(2, t2),
+		NewFilter().AddContract(a, b).SetTopic(0, t0, t1).SetTopic(3).SetTopic(2, t2),
+		f.Clone(),
+	} {
+		assert.True(t, f.Equal(same), same)
+		assert.True(t, same.Equal(f), same)
+		assert.Equal(t, f.Hash(), same.Hash(), same)
+		assert.Equal(t, f.String(), same.String())
+	}
+
+	for _, other := range []*Filter{
+		NewFilter().AddContract(a).SetTopic(0, t0, t1).SetTopic(2, t2),
+		NewFilter().AddContract(a, b, c).SetTopic(0, t0, t1).SetTopic(2, t2),
+		NewFilter().AddContract(a, b).SetTopic(0, t0).SetTopic(2, t2),
+		NewFilter().AddContract(a, b).SetTopic(0, t0, t1).SetTopic(1, t2),
+		NewFilter().AddContract(a, b).SetTopic(0, t0, t1),
+		NewFilter().AddContract(a, b).SetTopic(0, t0, t1, t2),
+		NewFilter(),
+	} {
+		assert.False(t, f.Equal(other), other)
+		assert.NotEqual(t, f.Hash(), other.Hash(), other)
+	}
+	excluding := f.Clone().ExcludeContract(c)
+	assert.False(t, f.Equal(excluding))
+	assert.NotEqual(t, f.Hash(), excluding.Hash())
+	assert.True(t, excluding.Equal(f.Clone().ExcludeContract(c, c).ExcludeTopic(1)))
+	assert.Equal(t, excluding.Hash(), f.Clone().ExcludeContract(c, c).ExcludeTopic(1).Hash())
+	assert.False(t, excluding.Equal(f.Clone().ExcludeTopic(0, t2)))
+	w := NewWatchlist(a)
+	watching := f.Clone().Watch(2, w)
+	assert.False(t, f.Equal(watching))
+	assert.NotEqual(t, f.Hash(), watching.Hash())
+	assert.True(t, watching.Equal(f.Clone().Watch(4, nil).Watch(2, w)))
+	assert.Equal(t, watching.Hash(), f.Clone().Watch(4, nil).Watch(2, w).Hash())
+	assert.False(t, watching.Equal(f.Clone().Watch(2, NewWatchlist(a))))
+	w.Add(b)
+	assert.Equal(t, watching.Hash(), f.Clone().Watch(2, w).Hash())
+	starting := NewFilter().AddContract(a).AddContractFrom(100, b).SetTopic(0, t0, t1).SetTopic(2, t2)
+	assert.False(t, f.Equal(starting))
+	assert.NotEqual(t, f.Hash(), starting.Hash())
+	assert.True(t, starting.Equal(starting.Clone().AddContractFrom(0, a)))
+	assert.Equal(t, starting.Hash(), starting.Clone().AddContractFrom(0, a).Hash())
+	assert.False(t, starting.Equal(starting.Clone().AddContractFrom(101, b)))
+	assert.NotEqual(t, starting.Hash(), starting.Clone().AddContractFrom(101, b).Hash())
+	assert.False(t, f.Equal(nil))
+	assert.True(t, (*Filter)(nil).Equal(nil))
+	assert.True(t, NewFilter().Equal(&Filter{}))
+}
+
+func TestFilter_Clone(t *testing.T) {
+	f := NewFilter().AddContract(common.HexToAddress("0x1111")).SetTopic(0, common.HexToHash("0xaaaa"))
+	f.ExcludeContract(common.HexToAddress("0x4444")).ExcludeTopic(1, common.HexToHash("0xcccc"))
+	c := f.Clone()
+	assert.Equal(t, f, c)
+	f.Watch(1, NewWatchlist())
+	c = f.Clone()
+	assert.Same(t, f.Watchlists[1], c.Watchlists[1])
+	c.ExcludedContracts[0] = common.HexToAddress("0x5555")
+	c.ExcludedTopics[1][0] = common.HexToHash("0xdddd")
+	assert.Equal(t, []common.Address{common.HexToAddress("0x4444")}, f.ExcludedContracts)
+	assert.Equal(t, [][]common.Hash{nil, {common.HexToHash("0xcccc")}}, f.ExcludedTopics)
+
+	c.AddContract(common.HexToAddress("0x2222")).SetTopic(0, common.HexToHash("0xbbbb"))
+	c.Contracts[0] = common.HexToAddress("0x3333")
+	assert.Equal(t, []common.Address{common.HexToAddress("0x1111")}, f.Contracts)
+	assert.Equal(t, [][]common.Hash{{common.HexToHash("0xaaaa")}}, f.Topics)
+}
+
+func TestFilter_String(t *testing.T) {
+	assert.Equal(t, "contracts=* topics=*", NewFilter().String())
+
+	f := NewFilter().
+		AddContract(common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")).
+		SetTopic(0, common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")).
+		SetTopic(2, common.HexToHash("0x04"), common.HexToHash("0x01"), common.HexToHash("0x03"), common.HexToHash("0x02"), common.HexToHash("0x05"))
+	assert.Equal(t, "contracts=[0xdAC1…1ec7] topics=[[0xddf2…b3ef] * [0x0000…0001 0x0000…0002 0x0000…0003 +2 more]]", f.String())
+
+	f = NewFilter().ExcludeContract(common.HexToAddress("0x0bad")).ExcludeTopic(1, common.HexToHash("0xdead"))
+	assert.Equal(t, "contracts=* topics=* exclude_contracts=[0x0000…0Bad] exclude_topics=[* [0x0000…dead]]", f.String())
+
+	f = NewFilter().Watch(2, NewWatchlist(common.HexToAddress("0x01"), common.HexToAddress("0x02")))
+	assert.Equal(t, "contracts=* topics=* watchlists=[* * [2 addresses]]", f.String())
+
+	f = NewFilter().AddContractFrom(19000000, common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"))
+	assert.Equal(t, "contracts=[0xdAC1…1ec7] topics=* starts=[0xdAC1…1ec7@19000000]", f.String())
+}
+
+func TestFilter_Sampled(t *testing.T) {
+	f := NewFilter().SetTopic(0, common.HexToHash("0xddf2"))
+	f.SampleRate = 10
+	logs := make([]types.Log, 10000)
+	for i := range logs {
+		logs[i] = types.Log{Topics: []common.Hash{common.HexToHash("0xddf2")}, TxHash: common.BigToHash(big.NewInt(int64(i / 4))), Index: uint(i)}
+	}
+	var kept []uint
+	for _, l := range logs {
+		if f.Matches(l) {
+			kept = append(kept, l.Index)
+		}
+	}
+	assert.InDelta(t, 1000, len(kept), 150)
+
+	// The same logs on every scan, e.g. by another process
+	c := f.Clone()
+	for _, l := range logs {
+		assert.Equal(t, slices.Contains(kept, l.Index), c.Matches(l))
+	}
+	assert.False(t, f.Equal(NewFilter().SetTopic(0, common.HexToHash("0xddf2"))))
+	assert.NotEqual(t, f.Hash(), NewFilter().SetTopic(0, common.HexToHash("0xddf2")).Hash())
+	assert.Equal(t, "contracts=* topics=[[0x0000…ddf2]] sample=1/10", f.String())
+
+	// Without a rate, or of 1, all logs are kept
+	for _, rate := range []uint64{0, 1} {
+		f.SampleRate = rate
+		assert.True(t, f.Sampled(logs[1]))
+		assert.True(t, f.Matches(logs[1]))
+	}
+}
+
+func TestFilter_ContractStarts(t *testing.T) {
+	a, b := common.HexToAddress("0x1111"), common.HexToAddress("0x2222")
+	f := NewFilter().AddContract(a).AddContractFrom(100, b)
+	assert.Equal(t, []common.Address{a, b}, f.Contracts)
+	assert.True(t, f.Matches(types.Log{Address: a, BlockNumber: 99}))
+	assert.False(t, f.Matches(types.Log{Address: b, BlockNumber: 99}))
+	assert.True(t, f.Matches(types.Log{Address: b, BlockNumber: 100}))
+	assert.Equal(t, []types.Log{{Address: a, BlockNumber: 99}, {Address: b, BlockNumber: 100}},
+		f.dropLocal([]types.Log{{Address: a, BlockNumber: 99}, {Address: b, BlockNumber: 99}, {Address: b, BlockNumber: 100}}))
+
+	// Queries of earlier blocks leave the contract out
+	assert.Same(t, f, f.at(100))
+	assert.Equal(t, []common.Address{a}, f.at(99).Contracts)
+	assert.Equal(t, []common.Address{a, b}, f.Contracts)
+	assert.Nil(t, NewFilter().AddContractFrom(100, b).at(99))
+
+	c := f.Clone()
+	c.ContractStarts[b] = 200
+	assert.Equal(t, uint64(100), f.ContractStarts[b])
 }
@@ -0,0 +1,215 @@
+package scanner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// FilterSet matches the logs matched by any of its filters, each one with its
+// own contracts, topics, exclusions and watchlists: unlike merging them into
+// one Filter, the contracts of a filter are not combined with the topics of
+// another. The Scanner fetches the logs of filters with the same topics in
+// one eth_getLogs request, for the union of their contracts, and of the other
+// filters in one request each, then keeps the logs matched by a filter. See
+// Matches for which ones.
+type FilterSet struct {
+	Filters []*Filter
+}
+
+// NewFilterSet creates a FilterSet of filters. A set without filters
+// matches no logs.
+func NewFilterSet(filters ...*Filter) *FilterSet {
+	return &FilterSet{Filters: filters}
+}
+
+// Matches returns the indexes in Filters of the filters matching l, e.g. to
+// route the log to the outputs of its filters, none if it matches none.
+func (s *FilterSet) Matches(l types.Log) []int {
+	var matched []int
+	for i, f := range s.Filters {
+		if f.Matches(l) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+// matchesAny reports whether a filter of the set matches l.
+func (s *FilterSet) matchesAny(l types.Log) bool {
+	return slices.ContainsFunc(s.Filters, func(f *Filter) bool { return f.Matches(l) })
+}
+
+// keep returns the logs of logs matching a filter of the set, and the number
+// of the others matching one but for its sampling.
+func (s *FilterSet) keep(logs []types.Log) ([]types.Log, uint64) {
+	kept := make([]types.Log, 0, len(logs))
+	var sampledOut uint64
+	for _, l := range logs {
+		switch {
+		case s.matchesAny(l):
+			kept = append(kept, l)
+		case slices.ContainsFunc(s.Filters, func(f *Filter) bool { return f.SampleRate > 1 && f.matchesUnsampled(l) }):
+			sampledOut++
+		}
+	}
+	return kept, sampledOut
+}
+
+// MatchesBloom reports whether a block of bloom might contain logs matching
+// any filter of the set. See Filter.MatchesBloom.
+func (s *FilterSet) MatchesBloom(bloom types.Bloom) bool {
+	return slices.ContainsFunc(s.Filters, func(f *Filter) bool { return f.MatchesBloom(bloom) })
+}
+
+// IsHeavy reports whether a filter of the set is too complex for local Bloom
+// checks, see Filter.IsHeavy.
+func (s *FilterSet) IsHeavy() bool {
+	return slices.ContainsFunc(s.Filters, (*Filter).IsHeavy)
+}
+
+// Clone returns a deep copy of the set, see Filter.Clone.
+func (s *FilterSet) Clone() *FilterSet {
+	c := &FilterSet{Filters: make([]*Filter, len(s.Filters))}
+	for i, f := range s.Filters {
+		c.Filters[i] = f.Clone()
+	}
+	return c
+}
+
+// Equal reports whether the sets hold Equal filters in the same order, the
+// order the indexes of Matches refer to.
+func (s *FilterSet) Equal(other *FilterSet) bool {
+	if s == nil || other == nil {
+		return s == other
+	}
+	return slices.EqualFunc(s.Filters, other.Filters, (*Filter).Equal)
+}
+
+// Hash returns a digest of the filters of the set, the Hash of its filter
+// for a set of one.
+func (s *FilterSet) Hash() common.Hash {
+	if len(s.Filters) == 1 {
+		return s.Filters[0].Hash()
+	}
+	data := make([]byte, 0, len(s.Filters)*common.HashLength)
+	for _, f := range s.Filters {
+		data = append(data, f.Hash().Bytes()...)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// String summarizes the filters of the set for logs, the String of its
+// filter for a set of one, else e.g. "0: contracts=... topics=...; 1: ...".
+func (s *FilterSet) String() string {
+	if len(s.Filters) == 1 {
+		return s.Filters[0].String()
+	}
+	parts := make([]string, len(s.Filters))
+	for i, f := range s.Filters {
+		parts[i] = fmt.Sprintf("%d: %s", i, f)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Union returns the filter of the logs of any filter of the set, without its
+// exclusions and watchlists: the contracts of all filters, or any if one has
+// none, and at every topic position the topics of all filters, or any if one
+// has none there. It matches more logs than the set unless its filters share
+// their topics or their contracts.
+func (s *FilterSet) Union() *Filter {
+	if len(s.Filters) == 1 {
+		return s.Filters[0]
+	}
+	u := NewFilter()
+	if len(s.Filters) == 0 {
+		return u
+	}
+	anyContract := false
+	topics := len(s.Filters[0].Topics)
+	for _, f := range s.Filters {
+		anyContract = anyContract || len(f.Contracts) == 0
+		topics = min(topics, len(f.Topics))
+	}
+	if !anyContract {
+		for _, f := range s.Filters {
+			u.AddContract(f.Contracts...)
+		}
+		u.Contracts = canonicalContracts(u.Contracts)
+	}
+	for pos := range topics {
+		var hashes []common.Hash
+		for _, f := range s.Filters {
+			if len(f.Topics[pos]) == 0 {
+				hashes = nil
+				break
+			}
+			hashes = append(hashes, f.Topics[pos]...)
+		}
+		u.Topics = append(u.Topics, hashes)
+	}
+	u.Topics = canonicalTopics(u.Topics)
+	return u
+}
+
+// at returns the set to fetch the logs of blocks up to to with, see
+// Filter.at, the set itself if none of its filters changes.
+func (s *FilterSet) at(to uint64) *FilterSet {
+	var c *FilterSet
+	for i, f := range s.Filters {
+		af := f.at(to)
+		if af == f && c == nil {
+			continue
+		}
+		if c == nil {
+			c = &FilterSet{Filters: slices.Clone(s.Filters[:i])}
+		}
+		if af != nil {
+			c.Filters = append(c.Filters, af)
+		}
+	}
+	if c == nil {
+		return s
+	}
+	return c
+}
+
+// queries returns the filters to fetch the logs of the set with: one per
+// group of filters with the same topics, with the contracts of the group, or
+// any if one of them has none. Filters with different topics cannot share a
+// request: the topics of one would constrain the contracts of the other.
+func (s *FilterSet) queries() []*Filter {
+	var queries []*Filter
+	for _, f := range s.Filters {
+		c := f.canonical()
+		i := slices.IndexFunc(queries, func(q *Filter) bool {
+			return slices.EqualFunc(q.Topics, c.Topics, slices.Equal)
+		})
+		switch {
+		case i < 0:
+			queries = append(queries, &Filter{Contracts: c.Contracts, Topics: c.Topics})
+		case len(queries[i].Contracts) == 0:
+			// Any contract already
+		case len(c.Contracts) == 0:
+			queries[i].Contracts = nil
+		default:
+			queries[i].Contracts = canonicalContracts(append(queries[i].Contracts, c.Contracts...))
+		}
+	}
+	return queries
+}
+
+// mergeLogs returns the logs of parts, the results of several requests over
+// the same blocks, in block and index order and without duplicates.
+func mergeLogs(parts [][]types.Log) []types.Log {
+	var logs []types.Log
+	for _, part := range parts {
+		logs = append(logs, part...)
+	}
+	slices.SortStableFunc(logs, compareLogs)
+	return slices.CompactFunc(logs, func(a, b types.Log) bool { return compareLogs(a, b) == 0 })
+}
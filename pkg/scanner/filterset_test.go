@@ -0,0 +1,228 @@
+package scanner
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var (
+	setTransfer = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	setApproval = common.HexToHash("0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925")
+	setUSDT     = common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	setUSDC     = common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+)
+
+func TestFilter_Matches(t *testing.T) {
+	f := NewFilter().AddContract(setUSDT).SetTopic(0, setTransfer).SetTopic(2, common.Hash{2})
+	assert.True(t, f.Matches(types.Log{Address: setUSDT, Topics: []common.Hash{setTransfer, {1}, {2}}}))
+	assert.False(t, f.Matches(types.Log{Address: setUSDC, Topics: []common.Hash{setTransfer, {1}, {2}}}))
+	assert.False(t, f.Matches(types.Log{Address: setUSDT, Topics: []common.Hash{setApproval, {1}, {2}}}))
+	assert.False(t, f.Matches(types.Log{Address: setUSDT, Topics: []common.Hash{setTransfer, {1}}}))
+
+	// Exclusions and watchlists apply too
+	f.ExcludeTopic(1, common.Hash{1})
+	assert.False(t, f.Matches(types.Log{Address: setUSDT, Topics: []common.Hash{setTransfer, {1}, {2}}}))
+	assert.True(t, NewFilter().Matches(types.Log{}))
+}
+
+func TestFilterSet_Matches(t *testing.T) {
+	// The mis-merge of the filters of the CLI: contracts of one, topics of the other
+	set := NewFilterSet(NewFilter().AddContract(setUSDT), NewFilter().SetTopic(0, setApproval))
+	merged := set.Filters[0].Clone().SetTopic(0, setApproval)
+
+	usdtTransfer := types.Log{Address: setUSDT, Topics: []common.Hash{setTransfer}}
+	usdcApproval := types.Log{Address: setUSDC, Topics: []common.Hash{setApproval}}
+	usdtApproval := types.Log{Address: setUSDT, Topics: []common.Hash{setApproval}}
+	assert.Equal(t, []int{0}, set.Matches(usdtTransfer))
+	assert.Equal(t, []int{1}, set.Matches(usdcApproval))
+	assert.Equal(t, []int{0, 1}, set.Matches(usdtApproval))
+	assert.Empty(t, set.Matches(types.Log{Address: setUSDC, Topics: []common.Hash{setTransfer}}))
+	assert.False(t, merged.Matches(usdtTransfer))
+	assert.False(t, merged.Matches(usdcApproval))
+
+	assert.Empty(t, NewFilterSet().Matches(usdtTransfer))
+}
+
+func TestFilterSet_MatchesBloom(t *testing.T) {
+	var bloom types.Bloom
+	bloom.Add(setUSDC.Bytes())
+	bloom.Add(setApproval.Bytes())
+
+	// Either filter may match: OR of the filters
+	set := NewFilterSet(NewFilter().AddContract(setUSDT), NewFilter().SetTopic(0, setApproval))
+	assert.True(t, set.MatchesBloom(bloom))
+	set = NewFilterSet(NewFilter().AddContract(setUSDT), NewFilter().SetTopic(0, setTransfer))
+	assert.False(t, set.MatchesBloom(bloom))
+	assert.False(t, NewFilterSet().MatchesBloom(bloom))
+}
+
+func TestFilterSet_Union(t *testing.T) {
+	f := NewFilter().AddContract(setUSDT)
+	assert.Same(t, f, NewFilterSet(f).Union())
+
+	u := NewFilterSet(
+		NewFilter().AddContract(setUSDT).SetTopic(0, setTransfer).SetTopic(1, common.Hash{1}),
+		NewFilter().AddContract(setUSDC).SetTopic(0, setApproval),
+	).Union()
+	assert.True(t, u.Equal(NewFilter().AddContract(setUSDT, setUSDC).SetTopic(0, setTransfer, setApproval)))
+
+	// A filter of any contract or topic makes the union so
+	u = NewFilterSet(NewFilter().AddContract(setUSDT).SetTopic(0, setTransfer), NewFilter().SetTopic(1, common.Hash{1})).Union()
+	assert.True(t, u.Equal(NewFilter()))
+}
+
+func TestFilterSet_Queries(t *testing.T) {
+	// Filters of the same topics share a request
+	set := NewFilterSet(
+		NewFilter().AddContract(setUSDT).SetTopic(0, setTransfer),
+		NewFilter().AddContract(setUSDC).SetTopic(0, setApproval),
+		NewFilter().AddContract(setUSDC, setUSDT).SetTopic(0, setTransfer),
+	)
+	queries := set.queries()
+	assert.Len(t, queries, 2)
+	assert.True(t, queries[0].Equal(NewFilter().AddContract(setUSDT, setUSDC).SetTopic(0, setTransfer)))
+	assert.True(t, queries[1].Equal(set.Filters[1]))
+
+	// Any contract absorbs the others
+	set = NewFilterSet(NewFilter().AddContract(setUSDT), NewFilter(), NewFilter().AddContract(setUSDC))
+	queries = set.queries()
+	assert.Len(t, queries, 1)
+	assert.Empty(t, queries[0].Contracts)
+}
+
+func TestFilterSet_Equal(t *testing.T) {
+	a := NewFilterSet(NewFilter().AddContract(setUSDT), NewFilter().SetTopic(0, setApproval))
+	b := a.Clone()
+	assert.True(t, a.Equal(b))
+	assert.Equal(t, a.Hash(), b.Hash())
+
+	b.Filters[1].SetTopic(0, setTransfer)
+	assert.False(t, a.Equal(b))
+	assert.NotEqual(t, a.Hash(), b.Hash())
+
+	// The order of the filters counts, see Matches
+	assert.False(t, a.Equal(NewFilterSet(a.Filters[1], a.Filters[0])))
+	assert.False(t, a.Equal(nil))
+
+	// A set of one is its filter
+	assert.Equal(t, a.Filters[0].Hash(), NewFilterSet(a.Filters[0]).Hash())
+	assert.Equal(t, a.Filters[0].String(), NewFilterSet(a.Filters[0]).String())
+	assert.Equal(t, "0: contracts=[0xdAC1…1ec7] topics=*; 1: contracts=* topics=[[0x8c5b…b925]]", a.String())
+}
+
+func TestScanner_FilterSet(t *testing.T) {
+	client := new(MockRPC)
+	logAt := func(addr common.Address, topic common.Hash, block uint64, index uint) types.Log {
+		return types.Log{Address: addr, Topics: []common.Hash{topic}, BlockNumber: block, Index: index}
+	}
+	usdtTransfer := logAt(setUSDT, setTransfer, 100, 0)
+	usdtApproval := logAt(setUSDT, setApproval, 101, 3)
+	usdcApproval := logAt(setUSDC, setApproval, 100, 1)
+	usdcTransfer := logAt(setUSDC, setTransfer, 101, 0)
+
+	// One request per filter, as their topics differ
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return assert.ObjectsAreEqual([]common.Address{setUSDT}, q.Addresses) && len(q.Topics) == 0
+	})).Return([]types.Log{usdtTransfer, usdtApproval}, nil).Once()
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return len(q.Addresses) == 0 && assert.ObjectsAreEqual([][]common.Hash{{setApproval}}, q.Topics)
+	})).Return([]types.Log{usdcApproval, usdtApproval}, nil).Once()
+
+	s := New(client, new(MockStore), Config{BatchSize: 10}, nil)
+	s.SetFilterSet(NewFilterSet(NewFilter().AddContract(setUSDT), NewFilter().SetTopic(0, setApproval).ExcludeContract(setUSDC)))
+	var handled []types.Log
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		handled = append(handled, logs...)
+		return nil
+	})
+	assert.NoError(t, s.scanRange(context.Background(), 100, 101))
+
+	// Merged in order without duplicates, usdcApproval excluded by the only filter it matched
+	assert.Equal(t, []types.Log{usdtTransfer, usdtApproval}, handled)
+	client.AssertExpectations(t)
+
+	// Filters of the same topics share a request, the set still matching exactly
+	client = new(MockRPC)
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return len(q.Addresses) == 2 && assert.ObjectsAreEqual([][]common.Hash{{setTransfer}}, q.Topics)
+	})).Return([]types.Log{usdtTransfer, usdcTransfer}, nil).Once()
+	s = New(client, new(MockStore), Config{BatchSize: 10}, nil)
+	s.SetFilterSet(NewFilterSet(
+		NewFilter().AddContract(setUSDT).SetTopic(0, setTransfer),
+		NewFilter().AddContract(setUSDC).SetTopic(0, setTransfer).Watch(1, NewWatchlist()),
+	))
+	handled = nil
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		handled = append(handled, logs...)
+		return nil
+	})
+	assert.NoError(t, s.scanRange(context.Background(), 100, 101))
+	assert.Equal(t, []types.Log{usdtTransfer}, handled)
+	client.AssertExpectations(t)
+	assert.True(t, s.Filter().Equal(NewFilter().AddContract(setUSDT, setUSDC).SetTopic(0, setTransfer)))
+}
+
+func TestScanner_Sampling(t *testing.T) {
+	var logs []types.Log
+	for i := 0; i < 200; i++ {
+		addr := setUSDC
+		if i%2 == 0 {
+			addr = setUSDT
+		}
+		logs = append(logs, types.Log{Address: addr, Topics: []common.Hash{setTransfer}, BlockNumber: 100, TxHash: common.BigToHash(big.NewInt(int64(i))), Index: uint(i)})
+	}
+	// All transfers sampled, and those of USDT in full
+	sampled := NewFilter().SetTopic(0, setTransfer)
+	sampled.SampleRate = 5
+	usdt := NewFilter().AddContract(setUSDT)
+
+	scan := func() ([]types.Log, Stats) {
+		client := new(MockRPC)
+		client.On("FilterLogs", mock.Anything, mock.Anything).Return(logs, nil)
+		s := New(client, new(MockStore), Config{BatchSize: 10}, nil)
+		s.SetFilterSet(NewFilterSet(sampled, usdt))
+		var handled []types.Log
+		s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+			handled = append(handled, logs...)
+			return nil
+		})
+		assert.NoError(t, s.scanRange(context.Background(), 100, 100))
+		return handled, s.Stats()
+	}
+	handled, stats := scan()
+
+	var usdc int
+	for _, l := range handled {
+		if l.Address == setUSDC {
+			usdc++
+			assert.True(t, sampled.Sampled(l))
+		}
+	}
+	assert.Equal(t, 100+usdc, len(handled), "every USDT transfer passes")
+	assert.InDelta(t, 20, usdc, 12)
+	assert.Equal(t, uint64(100-usdc), stats.SampledOut)
+	assert.Equal(t, uint64(len(handled)), stats.LogsScanned)
+
+	// The same logs are kept when scanned again
+	again, _ := scan()
+	assert.Equal(t, handled, again)
+
+	// A single sampled filter
+	client := new(MockRPC)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return(logs, nil)
+	s := New(client, new(MockStore), Config{BatchSize: 10}, sampled)
+	var single []types.Log
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		single = append(single, logs...)
+		return nil
+	})
+	assert.NoError(t, s.scanRange(context.Background(), 100, 100))
+	assert.Equal(t, uint64(200-len(single)), s.Stats().SampledOut)
+}
@@ -0,0 +1,110 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Middleware wraps a Handler, e.g. to log, measure or filter the batches
+// passed to it. See Scanner.Use.
+type Middleware func(next Handler) Handler
+
+// ErrHandlerPanic is wrapped by the errors of handlers that panicked, see
+// Stats.HandlerPanics and Recover.
+var ErrHandlerPanic = errors.New("handler panicked")
+
+// Recover returns the middleware turning a panic of the next handlers into an
+// error wrapping ErrHandlerPanic, logged with its stack. The Scanner recovers
+// from the panics of its handler on its own; Recover lets the middleware
+// around it see them as errors, e.g. Timing.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, logs []types.Log) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Error("Handler panicked", "panic", r, "stack", string(debug.Stack()))
+					err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+				}
+			}()
+			return next(ctx, logs)
+		}
+	}
+}
+
+// Timing returns the middleware calling observe with the number of logs of
+// every batch, the time the next handlers took and their error, e.g. to feed
+// a latency histogram.
+func Timing(observe func(logs int, elapsed time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, logs []types.Log) error {
+			start := time.Now()
+			err := next(ctx, logs)
+			observe(len(logs), time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// logKey identifies a log.
+type logKey struct {
+	tx    common.Hash
+	index uint
+}
+
+// DedupWindow returns the middleware dropping the logs among the last size
+// ones handled, e.g. those scanned again after a restart with CursorRewind or
+// a Seek backwards. A log counts as handled once the next handlers returned
+// nil for its batch, so failed batches are passed again in full. Batches left
+// without logs are not passed on.
+func DedupWindow(size int) Middleware {
+	var (
+		mu     sync.Mutex
+		seen   = make(map[logKey]bool, size)
+		recent = make([]logKey, 0, size) // Ring of the keys of seen, oldest at next
+		next   int
+	)
+	return func(h Handler) Handler {
+		return func(ctx context.Context, logs []types.Log) error {
+			mu.Lock()
+			fresh := make([]types.Log, 0, len(logs))
+			for _, l := range logs {
+				if !seen[logKey{l.TxHash, l.Index}] {
+					fresh = append(fresh, l)
+				}
+			}
+			mu.Unlock()
+			if len(fresh) == 0 {
+				return nil
+			}
+			if err := h(ctx, fresh); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, l := range fresh {
+				key := logKey{l.TxHash, l.Index}
+				if size <= 0 || seen[key] {
+					continue
+				}
+				if len(recent) < size {
+					recent = append(recent, key)
+				} else {
+					delete(seen, recent[next])
+					recent[next] = key
+					next = (next + 1) % size
+				}
+				seen[key] = true
+			}
+			return nil
+		}
+	}
+}
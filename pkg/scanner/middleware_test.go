@@ -0,0 +1,153 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// recordMiddleware appends name to calls around the next handlers.
+func recordMiddleware(name string, calls *[]string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, logs []types.Log) error {
+			*calls = append(*calls, name+">")
+			err := next(ctx, logs)
+			*calls = append(*calls, "<"+name)
+			return err
+		}
+	}
+}
+
+func TestScanner_Use(t *testing.T) {
+	client := new(MockRPC)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{{BlockNumber: 100}}, nil)
+	s := New(client, new(MockStore), Config{BatchSize: 10}, NewFilter())
+
+	// Without a handler, the middleware is not called
+	var calls []string
+	s.Use(recordMiddleware("a", &calls))
+	assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+	assert.Empty(t, calls)
+
+	// Run in the order added, also when the handler is set after them
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+	s.Use(recordMiddleware("b", &calls))
+	assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+	assert.Equal(t, []string{"a>", "b>", "handler", "<b", "<a"}, calls)
+
+	// A handler set later replaces the one behind them
+	calls = nil
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		calls = append(calls, "other")
+		return nil
+	})
+	assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+	assert.Equal(t, []string{"a>", "b>", "other", "<b", "<a"}, calls)
+}
+
+func TestRecover(t *testing.T) {
+	h := Recover()(func(ctx context.Context, logs []types.Log) error {
+		panic("boom")
+	})
+	err := h(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrHandlerPanic)
+	assert.EqualError(t, err, "handler panicked: boom")
+
+	h = Recover()(func(ctx context.Context, logs []types.Log) error { return assert.AnError })
+	assert.ErrorIs(t, h(context.Background(), nil), assert.AnError)
+}
+
+func TestScanner_MiddlewareErrorKeepsCursor(t *testing.T) {
+	store := storage.NewMemoryStore("")
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(1000), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{{BlockNumber: 100}}, nil)
+
+	s := New(client, store, Config{ChainID: "eth", StartBlock: 100, BatchSize: 10, Interval: time.Millisecond, CursorFlushInterval: -1}, NewFilter())
+	handled := false
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		handled = true
+		return nil
+	})
+	s.Use(Recover(), func(next Handler) Handler {
+		return func(ctx context.Context, logs []types.Log) error {
+			panic("rejected")
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+	assert.Eventually(t, func() bool { return s.Stats().LastError != "" }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// The batch failed without reaching the handler, the cursor did not move
+	assert.False(t, handled)
+	assert.Equal(t, uint64(100), s.Stats().NextBlock)
+	assert.Contains(t, s.Stats().LastError, "handler panicked: rejected")
+	cursor, err := store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Zero(t, cursor)
+}
+
+func TestTiming(t *testing.T) {
+	var (
+		logs    int
+		elapsed time.Duration
+		err     error
+	)
+	h := Timing(func(n int, d time.Duration, e error) { logs, elapsed, err = n, d, e })(func(ctx context.Context, l []types.Log) error {
+		time.Sleep(5 * time.Millisecond)
+		return assert.AnError
+	})
+	assert.ErrorIs(t, h(context.Background(), make([]types.Log, 3)), assert.AnError)
+	assert.Equal(t, 3, logs)
+	assert.GreaterOrEqual(t, elapsed, 5*time.Millisecond)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestDedupWindow(t *testing.T) {
+	logAt := func(tx byte, index uint) types.Log {
+		return types.Log{TxHash: common.Hash{tx}, Index: index}
+	}
+	var (
+		handled [][]types.Log
+		fail    error
+	)
+	h := DedupWindow(2)(func(ctx context.Context, logs []types.Log) error {
+		if fail != nil {
+			return fail
+		}
+		handled = append(handled, logs)
+		return nil
+	})
+
+	// A failed batch is passed again in full
+	fail = errors.New("down")
+	assert.ErrorIs(t, h(context.Background(), []types.Log{logAt(1, 0), logAt(1, 1)}), fail)
+	fail = nil
+	assert.NoError(t, h(context.Background(), []types.Log{logAt(1, 0), logAt(1, 1)}))
+
+	// Handled logs are dropped, batches left empty are not passed on
+	assert.NoError(t, h(context.Background(), []types.Log{logAt(1, 1), logAt(2, 0)}))
+	assert.NoError(t, h(context.Background(), []types.Log{logAt(1, 1), logAt(2, 0)}))
+
+	// Older logs leave the window
+	assert.NoError(t, h(context.Background(), []types.Log{logAt(1, 0)}))
+	assert.Equal(t, [][]types.Log{
+		{logAt(1, 0), logAt(1, 1)},
+		{logAt(2, 0)},
+		{logAt(1, 0)},
+	}, handled)
+}
@@ -0,0 +1,43 @@
+package scanner
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// SetPressure sets the backpressure of the outputs the handler feeds, e.g.
+// those buffering events to deliver them asynchronously: fn returns how full
+// they are, from 0 to 1. While it reports PressureThreshold or more, the next
+// batch waits, polling it every PressureDelay, instead of the handler
+// blocking on full buffers or the outputs dropping events.
+func (s *Scanner) SetPressure(fn func() float64) {
+	s.pressure = fn
+}
+
+// waitForPressure waits while the pressure of SetPressure is at or above
+// PressureThreshold.
+func (s *Scanner) waitForPressure(ctx context.Context) error {
+	if s.pressure == nil {
+		return nil
+	}
+	p := s.pressure()
+	s.updateStats(func(st *Stats) { st.Pressure = p })
+	if p < s.config.PressureThreshold {
+		return nil
+	}
+	log.Debug("Outputs under pressure, slowing down scan", "chain_id", s.config.ChainID, "pressure", p)
+	s.updateStats(func(st *Stats) { st.Throttled++ })
+	for p >= s.config.PressureThreshold {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.config.PressureDelay):
+		}
+		p = s.pressure()
+		s.updateStats(func(st *Stats) { st.Pressure = p })
+	}
+	log.Debug("Outputs drained, resuming scan", "chain_id", s.config.ChainID, "pressure", p)
+	return nil
+}
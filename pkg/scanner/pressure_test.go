@@ -0,0 +1,64 @@
+package scanner
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestScanner_Pressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(199), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{{BlockNumber: 100}}, nil)
+
+	// A slow sink: its buffer of 4 batches is drained one batch every 5ms
+	buffer := make(chan struct{}, 4)
+	var dropped atomic.Int32
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+				select {
+				case <-buffer:
+				default:
+				}
+			}
+		}
+	}()
+
+	s := New(client, storage.NewMemoryStore(""), Config{
+		ChainID:       "eth",
+		StartBlock:    100,
+		BatchSize:     1,
+		Interval:      time.Millisecond,
+		PressureDelay: time.Millisecond,
+	}, NewFilter())
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		select {
+		case buffer <- struct{}{}:
+		default:
+			dropped.Add(1) // The handler would have blocked
+		}
+		return nil
+	})
+	s.SetPressure(func() float64 { return float64(len(buffer)) / float64(cap(buffer)) })
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+
+	// The scanner keeps pace with the sink instead of filling its buffer
+	assert.Eventually(t, func() bool { return s.Stats().NextBlock == 200 }, 5*time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Zero(t, dropped.Load())
+	assert.Greater(t, s.Stats().Throttled, uint64(10))
+}
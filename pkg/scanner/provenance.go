@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+)
+
+// Provenance tells where the logs of a batch were fetched from, e.g. for
+// audits, provider billing disputes or to correlate missing events with a
+// lagging provider. See BatchProvenance.
+type Provenance struct {
+	FromBlock uint64 `json:"from_block"`
+	ToBlock   uint64 `json:"to_block"`
+	// Nodes are the scheme and host of the nodes that served the
+	// eth_getLogs requests of the batch, in order, once each. Empty with a
+	// client other than rpc.MultiClient, or without any request.
+	Nodes     []string  `json:"nodes,omitempty"`
+	Attempts  int       `json:"attempts"` // Requests sent to the nodes, the failed ones included
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// provenanceKey is the context key of the Provenance of a batch.
+type provenanceKey struct{}
+
+// BatchProvenance returns the Provenance of the batch whose logs the handler
+// gets ctx with, false outside of a handler.
+func BatchProvenance(ctx context.Context) (Provenance, bool) {
+	p, ok := ctx.Value(provenanceKey{}).(Provenance)
+	return p, ok
+}
+
+// withProvenance returns ctx with the Provenance of the batch from to to,
+// fetched with fetchCtx of rpc.WithServed.
+func withProvenance(ctx, fetchCtx context.Context, from, to uint64) context.Context {
+	p := Provenance{FromBlock: from, ToBlock: to, FetchedAt: time.Now()}
+	for _, call := range rpc.ServedCalls(fetchCtx) {
+		if call.Method != rpc.MethodGetLogs {
+			continue
+		}
+		p.Attempts += call.Attempts
+		if !slices.Contains(p.Nodes, call.Node) {
+			p.Nodes = append(p.Nodes, call.Node)
+		}
+	}
+	return context.WithValue(ctx, provenanceKey{}, p)
+}
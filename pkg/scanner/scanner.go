@@ -1,14 +1,25 @@
 package scanner
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"math/big"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/84hero/evm-scanner/pkg/rpc"
 	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 )
 
 // Config holds configuration parameters for the Scanner.
@@ -16,83 +27,472 @@ type Config struct {
 	ChainID string
 	// Startup strategy
 	StartBlock   uint64
-	ForceStart   bool
+	ForceStart   bool // Start at StartBlock, rewinding the saved cursor
 	Rewind       uint64
 	CursorRewind uint64 // Safety rewind from saved cursor
+	// StartStrategy picks the first block explicitly. Empty keeps the implicit
+	// precedence: ForceStart with a StartBlock, the saved cursor, StartBlock,
+	// then Rewind below the head. See StartDecision.
+	StartStrategy StartStrategy
+	// EndBlock makes Start return nil once this block is scanned, e.g. for
+	// backfills. 0 follows the chain.
+	EndBlock uint64
 
 	BatchSize uint64
 	Interval  time.Duration
 	ReorgSafe uint64
 	UseBloom  bool
+	// TrackBlockHash saves the hash of the last scanned block with the cursor,
+	// at the cost of one header request per batch, and warns on resume if that
+	// block was reorganized away while the scanner was down. It requires a
+	// storage.CheckpointPersistence store and is ignored with a TxHandler.
+	TrackBlockHash bool
+	// CursorFlushInterval coalesces cursor saves during backfills: the cursor
+	// is written at most once per interval and when Start returns, so a crash
+	// rescans at most one interval of blocks. Default 2s, negative to write it
+	// after every batch. Ignored with a TxHandler.
+	CursorFlushInterval time.Duration
+	// StoreOutageLimit pauses scanning once the cursor could not be saved for
+	// this long, bounding the blocks rescanned after a restart, and resumes it
+	// when the store answers a Ping again. 0 keeps scanning.
+	StoreOutageLimit time.Duration
+	// CursorSaveRetries retries a failed cursor save this many times, waiting
+	// CursorSaveBackoff, doubled on every retry, in between. Default 2 retries
+	// after 100ms, negative not to retry.
+	CursorSaveRetries int
+	CursorSaveBackoff time.Duration
+	// MaxUnsavedBlocks bounds the blocks rescanned after a restart while the
+	// cursor cannot be saved: once this many blocks were scanned past the last
+	// saved cursor, CursorFailurePolicy applies. 0 keeps scanning.
+	MaxUnsavedBlocks    uint64
+	CursorFailurePolicy CursorFailurePolicy
+	// PressureThreshold is the pressure of the outputs at which batches wait
+	// for them to drain, polling it every PressureDelay. Default 0.8 and
+	// 100ms. See SetPressure.
+	PressureThreshold float64
+	PressureDelay     time.Duration
+	// MaxLogsRange caps the blocks of a single eth_getLogs request, for nodes
+	// limiting it: larger batches are fetched in several requests. 0 is unlimited.
+	// With a RangedClient, the requests are further capped by the node
+	// serving each.
+	MaxLogsRange uint64
+	// FinalityMode picks the head scanned up to, FinalityConfirmations by default.
+	FinalityMode FinalityMode
+	// TailInterval is how often the tail handler gets the new blocks at the
+	// head, default 1s. TailConfirmations keeps the tail this many blocks
+	// below the latest one, 0 for the latest. See SetTailHandler.
+	TailInterval      time.Duration
+	TailConfirmations uint64
+	// DisableLogSort passes the logs of a batch to the handler in the order
+	// the node returned them, skipping the sort of sortLogs.
+	DisableLogSort bool
+	// TraceTransfers traces every scanned block for the TransferHandler, at
+	// the cost of a debug or trace API call per block, keeping the traces of
+	// the last TraceCacheBlocks blocks, default 256. See SetTransferHandler.
+	TraceTransfers   bool
+	TraceCacheBlocks int
+	// BlockTimestamps fills the BlockTimestamp of the logs nodes return
+	// without it from the headers of their blocks, one request per block
+	// with logs, e.g. for outputs partitioning events by day. See
+	// SetBlockTimestamps.
+	BlockTimestamps bool
 }
 
-// Handler is a callback function type for processing scanned logs.
+// FinalityMode decides which blocks are final enough to be scanned.
+type FinalityMode string
+
+const (
+	// FinalityConfirmations scans up to ReorgSafe blocks behind the latest block (default).
+	FinalityConfirmations FinalityMode = "confirmations"
+	// FinalitySafe scans up to the "safe" block of the node, ignoring ReorgSafe.
+	FinalitySafe FinalityMode = "safe"
+	// FinalityFinalized scans up to the "finalized" block of the node, ignoring ReorgSafe.
+	FinalityFinalized FinalityMode = "finalized"
+)
+
+// ParseFinalityMode converts a configuration value into a FinalityMode. Empty
+// means FinalityConfirmations.
+func ParseFinalityMode(s string) (FinalityMode, error) {
+	switch FinalityMode(s) {
+	case "":
+		return FinalityConfirmations, nil
+	case FinalityConfirmations, FinalitySafe, FinalityFinalized:
+		return FinalityMode(s), nil
+	default:
+		return "", fmt.Errorf("unsupported finality mode: %q", s)
+	}
+}
+
+// Handler is a callback function type for processing scanned logs. An error
+// or a panic fails the batch: the cursor does not advance and the batch is
+// scanned again. The logs are ordered by block number, transaction index and
+// log index, unless Config.DisableLogSort. BatchProvenance(ctx) tells where
+// they were fetched from.
 type Handler func(ctx context.Context, logs []types.Log) error
 
+// TxHandler processes scanned logs within tx, in which the scanner then saves
+// the cursor. See SetTxHandler.
+type TxHandler func(ctx context.Context, tx *sql.Tx, logs []types.Log) error
+
 // Scanner orchestrates the scanning of blocks and processing of logs.
 type Scanner struct {
-	client  rpc.Client
-	store   storage.Persistence
-	config  Config
-	filter  *Filter
-	handler Handler
+	client    rpc.ScannerClient
+	store     storage.Persistence
+	config    Config
+	filters   atomic.Pointer[FilterSet]
+	handler   Handler
+	txHandler TxHandler
+	cursors   storage.Persistence // Store the cursor is saved to while running
+
+	tailHandler Handler        // See SetTailHandler
+	pressure    func() float64 // See SetPressure
+
+	// See SetTransferHandler
+	transferHandler   TransferHandler
+	transferWatchlist *Watchlist
+	traceMu           sync.Mutex
+	traceCache        map[uint64][]rpc.Trace // By block, see traceBlock
+
+	middleware []Middleware // See Use
+	chained    Handler      // The handler behind the middleware
+
+	logsScanned uint64 // Logs processed so far, saved with the checkpoint
+	// resumed is the saved cursor the scanner resumed below with CursorRewind.
+	// Cursors below it are not saved: the store already holds further progress.
+	resumed uint64
+	// storeFailingSince is when saving the cursor started failing, zero if it succeeds.
+	storeFailingSince time.Time
+	// lastSaved is the last cursor saved, see MaxUnsavedBlocks.
+	lastSaved uint64
+
+	paused atomic.Bool
+	seek   atomic.Pointer[uint64] // Block to move to before the next batch, see Seek
+
+	blockTimes atomic.Bool // See SetBlockTimestamps
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Stats is the progress of a Scanner.
+type Stats struct {
+	ChainID     string
+	Running     bool      // Start has not returned
+	Paused      bool      // Between Pause and Resume
+	NextBlock   uint64    // First block not scanned yet
+	SafeHead    uint64    // Last block final enough to scan, as of the last poll
+	LogsScanned uint64    // Logs scanned since Start
+	LastScan    time.Time // When the last batch was scanned
+	// HandlerPanics counts the batches whose handler panicked, see
+	// ErrHandlerPanic.
+	HandlerPanics uint64
+	// TailBlock is the last block scanned for the tail handler, see
+	// SetTailHandler.
+	TailBlock uint64
+	// LastError is the error of the last poll or batch, cleared when one
+	// succeeds, or the error Start returned.
+	LastError string
+	// Start is how the last Start chose its first block.
+	Start StartDecision
+	// CursorSaveFailures counts the consecutive failed attempts to save the
+	// cursor, retries included.
+	CursorSaveFailures uint64
+	// Pressure is the last pressure of the outputs, and Throttled counts the
+	// batches that waited for it to drop. See SetPressure.
+	Pressure  float64
+	Throttled uint64
+	// SampledOut counts the logs matching filters with a SampleRate that
+	// sampling dropped, to extrapolate totals from LogsScanned.
+	SampledOut uint64
 }
 
-// New creates and initializes a new Scanner instance.
-func New(client rpc.Client, store storage.Persistence, cfg Config, filter *Filter) *Scanner {
+// New creates and initializes a new Scanner instance. The client is usually
+// an rpc.MultiClient, or rpc.WrapEthClient of a single node.
+func New(client rpc.ScannerClient, store storage.Persistence, cfg Config, filter *Filter) *Scanner {
 	if cfg.BatchSize == 0 {
 		cfg.BatchSize = 100
 	}
 	if cfg.Interval == 0 {
 		cfg.Interval = 3 * time.Second
 	}
-	return &Scanner{
-		client: client,
-		store:  store,
-		config: cfg,
-		filter: filter,
+	if cfg.CursorFlushInterval == 0 {
+		cfg.CursorFlushInterval = 2 * time.Second
+	}
+	if cfg.FinalityMode == "" {
+		cfg.FinalityMode = FinalityConfirmations
+	}
+	if cfg.TailInterval == 0 {
+		cfg.TailInterval = time.Second
+	}
+	if cfg.CursorSaveRetries == 0 {
+		cfg.CursorSaveRetries = 2
+	}
+	if cfg.CursorSaveBackoff == 0 {
+		cfg.CursorSaveBackoff = 100 * time.Millisecond
+	}
+	if cfg.CursorFailurePolicy == "" {
+		cfg.CursorFailurePolicy = CursorFailurePause
+	}
+	if cfg.PressureThreshold == 0 {
+		cfg.PressureThreshold = 0.8
+	}
+	if cfg.PressureDelay == 0 {
+		cfg.PressureDelay = 100 * time.Millisecond
 	}
+	if cfg.TraceCacheBlocks == 0 {
+		cfg.TraceCacheBlocks = 256
+	}
+	s := &Scanner{
+		client:  client,
+		store:   store,
+		cursors: store,
+		config:  cfg,
+		stats:   Stats{ChainID: cfg.ChainID},
+	}
+	s.SetFilter(filter)
+	s.blockTimes.Store(cfg.BlockTimestamps)
+	return s
+}
+
+// Stats returns the progress of the scanner, also while it runs.
+func (s *Scanner) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// updateStats applies update to the stats under the lock.
+func (s *Scanner) updateStats(update func(st *Stats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.stats)
+}
+
+// setError records err, if any, as the last error.
+func (s *Scanner) setError(err error) {
+	if err != nil {
+		s.updateStats(func(st *Stats) { st.LastError = err.Error() })
+	}
+}
+
+// SetFilter replaces the filter of the scanner, also while it runs: the next
+// batch is fetched with it. Blocks already scanned are not scanned again.
+func (s *Scanner) SetFilter(filter *Filter) {
+	s.filters.Store(NewFilterSet(filter))
+}
+
+// SetFilterSet replaces the filter of the scanner with the filters of set,
+// like SetFilter: the scanner handles the logs matching any of them.
+func (s *Scanner) SetFilterSet(set *FilterSet) {
+	s.filters.Store(set)
+}
+
+// Filter returns the filter the next batch is fetched with, the Union of the
+// filters of a FilterSet.
+func (s *Scanner) Filter() *Filter {
+	return s.filters.Load().Union()
+}
+
+// FilterSet returns the filters the next batch is fetched with, a set of one
+// filter after SetFilter.
+func (s *Scanner) FilterSet() *FilterSet {
+	return s.filters.Load()
+}
+
+// Pause stops scanning after the running batch, until Resume. The scanner
+// keeps polling the chain head meanwhile.
+func (s *Scanner) Pause() {
+	s.paused.Store(true)
+	s.updateStats(func(st *Stats) { st.Paused = true })
+}
+
+// Resume resumes scanning after Pause.
+func (s *Scanner) Resume() {
+	s.paused.Store(false)
+	s.updateStats(func(st *Stats) { st.Paused = false })
 }
 
-// SetHandler sets the callback function to be called when logs are received
+// Seek moves the scanner to block next, also while it runs or is paused: the
+// next batch starts there, after the cursor was saved at next, moving it
+// backwards if need be. Blocks are scanned again or skipped accordingly.
+func (s *Scanner) Seek(next uint64) {
+	s.seek.Store(&next)
+}
+
+// applySeek moves *current to the block of a pending Seek, if any, saving the
+// cursor there. The Seek is kept pending if the cursor cannot be saved.
+func (s *Scanner) applySeek(ctx context.Context, current *uint64) error {
+	next := s.seek.Load()
+	if next == nil {
+		return nil
+	}
+	var err error
+	if store, ok := s.cursors.(storage.Rewinder); ok {
+		err = store.ForceRewind(ctx, s.config.ChainID, *next)
+	} else {
+		err = s.cursors.SaveCursor(ctx, s.config.ChainID, *next)
+	}
+	if err != nil {
+		return fmt.Errorf("seek to %d: %w", *next, err)
+	}
+	s.seek.CompareAndSwap(next, nil)
+	log.Info("Scanner moved", "chain_id", s.config.ChainID, "from", *current, "to", *next)
+	*current, s.resumed, s.lastSaved = *next, 0, *next
+	s.updateStats(func(st *Stats) { st.NextBlock = *next })
+	return nil
+}
+
+// SetHandler sets the callback function to be called when logs are received,
+// behind the middleware of Use.
 func (s *Scanner) SetHandler(h Handler) {
 	s.handler = h
+	s.chain()
+}
+
+// Use adds mw around the handler of SetHandler, whether it is set before or
+// after. Middleware runs in the order it is added, the first one outermost.
+// An error returned by a middleware fails the batch as one of the handler
+// does: the cursor does not advance and the batch is scanned again. Like the
+// handler, middleware only runs for batches with logs, and not around a
+// TxHandler.
+func (s *Scanner) Use(mw ...Middleware) {
+	s.middleware = append(s.middleware, mw...)
+	s.chain()
+}
+
+// chain wraps the handler in the middleware.
+func (s *Scanner) chain() {
+	s.chained = s.handler
+	if s.chained == nil {
+		return
+	}
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		s.chained = s.middleware[i](s.chained)
+	}
+}
+
+// SetTxHandler processes logs with h instead of the Handler, within a
+// transaction of the store that also saves the cursor, so events written
+// through tx (e.g. by sink.PostgresOutput.SendTx) and the scan progress commit
+// atomically: after a crash a range is either stored with its cursor, or
+// rescanned with nothing of it stored. The store must implement
+// storage.TxPersistence, and the events be written to the store's database.
+func (s *Scanner) SetTxHandler(h TxHandler) {
+	s.txHandler = h
 }
 
 // Start begins the scanning loop (blocks until context is cancelled)
-func (s *Scanner) Start(ctx context.Context) error {
+func (s *Scanner) Start(ctx context.Context) (err error) {
+	s.updateStats(func(st *Stats) { st.Running = true })
+	defer func() {
+		s.updateStats(func(st *Stats) { st.Running = false })
+		if !errors.Is(err, context.Canceled) {
+			s.setError(err)
+		}
+	}()
+	return s.start(ctx)
+}
+
+func (s *Scanner) start(ctx context.Context) error {
+	if _, ok := s.store.(storage.TxPersistence); s.txHandler != nil && !ok {
+		return fmt.Errorf("tx handler requires a storage.TxPersistence store, got %T", s.store)
+	}
+	if _, err := ParseFinalityMode(string(s.config.FinalityMode)); err != nil {
+		return err
+	}
+	if _, err := ParseStartStrategy(string(s.config.StartStrategy)); err != nil {
+		return err
+	}
+	if _, err := ParseCursorFailurePolicy(string(s.config.CursorFailurePolicy)); err != nil {
+		return err
+	}
+	if _, ok := s.client.(Tracer); s.config.TraceTransfers && (s.transferHandler == nil || !ok) {
+		return errTraceConfig
+	}
+
 	// 1. Determine starting block height
 	// Note: determineStartBlock might call RPC to get latest block (if using Rewind logic)
-	currentBlock, err := s.determineStartBlock(ctx)
+	decision, err := s.determineStartBlock(ctx)
 	if err != nil {
 		return err
 	}
+	currentBlock := decision.Block
+	s.lastSaved = currentBlock
+	if decision.overridesCursor() {
+		// A deliberate rewind: replace the saved cursor, which may be higher
+		if store, ok := s.store.(storage.Rewinder); ok {
+			if err := store.ForceRewind(ctx, s.config.ChainID, currentBlock); err != nil {
+				return fmt.Errorf("rewind cursor: %w", err)
+			}
+		}
+	}
+	s.cursors = s.store
+	if s.txHandler == nil && s.config.CursorFlushInterval > 0 {
+		coalesced := storage.Coalesce(s.store, s.config.CursorFlushInterval, 0)
+		s.cursors = coalesced
+		defer func() {
+			// ctx is done by now: give the last interval of progress its own deadline
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := coalesced.Flush(flushCtx); err != nil {
+				log.Error("Failed to save cursor", "err", err)
+			}
+		}()
+	}
 	log.Info("Scanner started", "start_block", currentBlock, "chain_id", s.config.ChainID)
+	s.updateStats(func(st *Stats) {
+		st.NextBlock = currentBlock
+		st.Start = decision
+	})
+
+	if s.tailHandler != nil {
+		tailCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.tail(tailCtx)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
 
 	ticker := time.NewTicker(s.config.Interval)
 	defer ticker.Stop()
 
 	for {
+		if s.config.EndBlock > 0 && currentBlock > s.config.EndBlock {
+			log.Info("Scanner reached end block", "chain_id", s.config.ChainID, "end_block", s.config.EndBlock)
+			return nil
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
-			// 2. Get latest block number from chain
-			head, err := s.client.BlockNumber(ctx)
+			if err := s.applySeek(ctx, &currentBlock); err != nil {
+				log.Error("Failed to save cursor", "chain_id", s.config.ChainID, "err", err)
+				s.setError(err)
+			}
+
+			// 2. Get the last block safe to scan from chain
+			safeHead, ok, err := s.safeHead(ctx)
 			if err != nil {
-				log.Error("Failed to get block number", "err", err)
+				log.Error("Failed to get block number", "chain_id", s.config.ChainID, "err", err)
+				s.setError(err)
 				continue
 			}
-
-			// Calculate safe height (latest height - confirmations)
-			safeHead := head - s.config.ReorgSafe
-			if safeHead < currentBlock {
+			s.updateStats(func(st *Stats) { st.SafeHead = safeHead })
+			if s.config.EndBlock > 0 {
+				safeHead = min(safeHead, s.config.EndBlock)
+			}
+			if !ok || safeHead < currentBlock {
 				// No new blocks yet
 				continue
 			}
 
 			// 3. Catch up loop
-			for currentBlock <= safeHead {
+			for currentBlock <= safeHead && !s.paused.Load() && s.seek.Load() == nil {
 				// Check for context cancellation
 				select {
 				case <-ctx.Done():
@@ -100,6 +500,13 @@ func (s *Scanner) Start(ctx context.Context) error {
 				default:
 				}
 
+				if err := s.waitForStore(ctx); err != nil {
+					return err
+				}
+				if err := s.waitForPressure(ctx); err != nil {
+					return err
+				}
+
 				// Calculate end block for current batch
 				endBlock := currentBlock + s.config.BatchSize - 1
 				if endBlock > safeHead {
@@ -109,7 +516,8 @@ func (s *Scanner) Start(ctx context.Context) error {
 				// 4. Perform scanning
 				err := s.scanRange(ctx, currentBlock, endBlock)
 				if err != nil {
-					log.Error("Scan range failed", "from", currentBlock, "to", endBlock, "err", err)
+					log.Error("Scan range failed", "chain_id", s.config.ChainID, "from", currentBlock, "to", endBlock, "err", err)
+					s.setError(err)
 					// Wait a bit before retrying, but respect context
 					select {
 					case <-ctx.Done():
@@ -119,69 +527,289 @@ func (s *Scanner) Start(ctx context.Context) error {
 					break // Break inner loop, wait for next ticker
 				}
 
-				// 5. Update progress
+				// 5. Update progress (already saved with the logs by a TxHandler)
 				// Next start from endBlock + 1
 				nextStart := endBlock + 1
-				if err := s.store.SaveCursor(s.config.ChainID, nextStart); err != nil {
-					log.Error("Failed to save cursor", "err", err)
+				if s.txHandler == nil {
+					if err := s.saveProgress(ctx, nextStart); err != nil {
+						return err
+					}
 				}
 
 				currentBlock = nextStart
+				s.updateStats(func(st *Stats) {
+					st.NextBlock = nextStart
+					st.LastScan = time.Now()
+					if s.storeFailingSince.IsZero() {
+						st.LastError = ""
+					}
+				})
 			}
 		}
 	}
 }
 
-func (s *Scanner) determineStartBlock(ctx context.Context) (uint64, error) {
-	// Strategy 1: Force Start (highest priority)
-	if s.config.ForceStart && s.config.StartBlock > 0 {
-		log.Info("Start strategy: Force Start", "block", s.config.StartBlock)
-		return s.config.StartBlock, nil
+// safeHead returns the last block final enough to scan per FinalityMode,
+// reporting false if there is none yet.
+func (s *Scanner) safeHead(ctx context.Context) (uint64, bool, error) {
+	var tag int64
+	switch s.config.FinalityMode {
+	case FinalitySafe:
+		tag = int64(gethrpc.SafeBlockNumber)
+	case FinalityFinalized:
+		tag = int64(gethrpc.FinalizedBlockNumber)
+	default:
+		// Latest height - confirmations
+		head, err := s.client.BlockNumber(ctx)
+		if err != nil || head < s.config.ReorgSafe {
+			return 0, false, err
+		}
+		return head - s.config.ReorgSafe, true, nil
+	}
+	header, err := s.client.HeaderByNumber(ctx, big.NewInt(tag))
+	if err != nil {
+		return 0, false, err
 	}
+	return header.Number.Uint64(), true, nil
+}
 
-	// Strategy 2: Resume from persistence
-	saved, err := s.store.LoadCursor(s.config.ChainID)
+// waitForStore pauses while the cursor store has been failing for longer than
+// StoreOutageLimit, pinging it every Interval until it answers.
+func (s *Scanner) waitForStore(ctx context.Context) error {
+	if s.config.StoreOutageLimit <= 0 || s.storeFailingSince.IsZero() ||
+		time.Since(s.storeFailingSince) < s.config.StoreOutageLimit {
+		return nil
+	}
+	log.Warn("Cursor store unreachable, pausing scan", "since", s.storeFailingSince)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.config.Interval):
+		}
+		if err := s.store.Ping(ctx); err != nil {
+			log.Debug("Cursor store still unreachable", "err", err)
+			continue
+		}
+		log.Info("Cursor store reachable again, resuming scan")
+		s.storeFailingSince = time.Time{}
+		return nil
+	}
+}
+
+// loadCursor returns the saved cursor, verifying the hash of its last scanned
+// block if the store has a checkpoint and TrackBlockHash is set.
+func (s *Scanner) loadCursor(ctx context.Context) (uint64, error) {
+	store, ok := s.store.(storage.CheckpointPersistence)
+	if !ok {
+		return s.store.LoadCursor(ctx, s.config.ChainID)
+	}
+	cp, err := store.LoadCheckpoint(ctx, s.config.ChainID)
 	if err != nil {
 		return 0, err
 	}
-	if saved > 0 {
-		start := saved
-		if s.config.CursorRewind > 0 {
-			if start > s.config.CursorRewind {
-				start = start - s.config.CursorRewind
-			} else {
-				start = 0
-			}
-			log.Info("Start strategy: Resume from persistence with safety rewind", "saved", saved, "rewind", s.config.CursorRewind, "start", start)
+	s.logsScanned = cp.LogsScanned
+	if s.config.TrackBlockHash && cp.Height > 0 && cp.BlockHash != (common.Hash{}) {
+		header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(cp.Height-1))
+		if err != nil {
+			return 0, err
+		}
+		if header.Hash() != cp.BlockHash {
+			log.Warn("Last scanned block was reorganized since the cursor was saved, consider a larger cursor_rewind",
+				"block", cp.Height-1, "saved_hash", cp.BlockHash, "hash", header.Hash(), "saved_at", cp.UpdatedAt)
+		}
+	}
+	return cp.Height, nil
+}
+
+// saveCursor saves next as the cursor, with checkpoint metadata if the store supports it.
+func (s *Scanner) saveCursor(ctx context.Context, next uint64) error {
+	if next < s.resumed {
+		return nil
+	}
+	store, ok := s.cursors.(storage.CheckpointPersistence)
+	if !ok {
+		return s.cursors.SaveCursor(ctx, s.config.ChainID, next)
+	}
+	cp := storage.Checkpoint{Height: next, LogsScanned: s.logsScanned}
+	if s.config.TrackBlockHash {
+		// The cursor matters more than its hash: save it without one on failure
+		if header, err := s.client.HeaderByNumber(ctx, new(big.Int).SetUint64(next-1)); err != nil {
+			log.Warn("Failed to get hash of last scanned block", "block", next-1, "err", err)
 		} else {
-			log.Info("Start strategy: Resume from persistence", "block", saved)
+			cp.BlockHash = header.Hash()
 		}
-		return start, nil
+	}
+	return store.SaveCheckpoint(ctx, s.config.ChainID, cp)
+}
+
+func (s *Scanner) scanRange(ctx context.Context, from, to uint64) error {
+	fetchCtx := rpc.WithServed(ctx)
+	logs, sampledOut, err := s.fetchSetLogs(fetchCtx, s.filters.Load(), from, to)
+	if err != nil {
+		return err
+	}
+	logs = s.sortLogs(logs)
+	ctx = withProvenance(ctx, fetchCtx, from, to)
+
+	// Before the handler, which may save the cursor with a TxHandler
+	if err := s.handleTransfers(ctx, from, to); err != nil {
+		return err
+	}
+	if err := s.handle(ctx, logs, to+1); err != nil {
+		return err
 	}
 
-	// Strategy 3: Config StartBlock (not forced, used as default)
-	if s.config.StartBlock > 0 {
-		log.Info("Start strategy: Config StartBlock", "block", s.config.StartBlock)
-		return s.config.StartBlock, nil
+	s.logsScanned += uint64(len(logs))
+	s.updateStats(func(st *Stats) {
+		st.LogsScanned += uint64(len(logs))
+		st.SampledOut += sampledOut
+	})
+	return nil
+}
+
+// ScanOnce returns the logs of the blocks from to to matching the filter,
+// ordered and fetched like the batches of Start: in batches of BatchSize blocks, each in
+// requests of at most MaxLogsRange blocks, checking the bloom of single
+// blocks with UseBloom, through the node failover of the client. The handler
+// is not called and the cursor does not move, so it suits one-off queries,
+// also while the scanner runs.
+func (s *Scanner) ScanOnce(ctx context.Context, from, to uint64) ([]types.Log, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid range: from %d is after to %d", from, to)
 	}
+	var logs []types.Log
+	for start := from; start <= to; start += s.config.BatchSize {
+		end := min(start+s.config.BatchSize-1, to)
+		part, err := s.fetchLogs(ctx, start, end)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, part...)
+	}
+	return s.sortLogs(logs), nil
+}
 
-	// Strategy 4: Dynamic Rewind
-	// If no saved cursor and no StartBlock, start from N blocks before Head
-	head, err := s.client.BlockNumber(ctx)
+// sortLogs returns logs ordered by block number, transaction index and log
+// index, as the handler gets them: nodes generally return them so, but not
+// the results of several requests, e.g. of MaxLogsRange or a FilterSet, and
+// outputs such as Postgres keep the order they are inserted in. Sorted logs
+// are returned untouched, others sorted in a copy.
+func (s *Scanner) sortLogs(logs []types.Log) []types.Log {
+	if s.config.DisableLogSort || slices.IsSortedFunc(logs, compareLogs) {
+		return logs
+	}
+	logs = slices.Clone(logs)
+	slices.SortStableFunc(logs, compareLogs)
+	return logs
+}
+
+// compareLogs orders logs by block number, transaction index and log index.
+func compareLogs(a, b types.Log) int {
+	return cmp.Or(cmp.Compare(a.BlockNumber, b.BlockNumber), cmp.Compare(a.TxIndex, b.TxIndex), cmp.Compare(a.Index, b.Index))
+}
+
+// handle passes the logs of a batch ending before next to the TxHandler, else
+// to the handler. A panic of the handler fails the batch, like an error, with
+// an error wrapping ErrHandlerPanic.
+func (s *Scanner) handle(ctx context.Context, logs []types.Log, next uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Handler panicked", "chain_id", s.config.ChainID, "panic", r, "stack", string(debug.Stack()))
+			s.updateStats(func(st *Stats) { st.HandlerPanics++ })
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+		}
+	}()
+	if s.txHandler != nil {
+		return s.processTx(ctx, logs, next)
+	}
+	if len(logs) > 0 && s.chained != nil {
+		return s.chained(ctx, logs)
+	}
+	return nil
+}
+
+// processTx runs the TxHandler and saves next as the cursor in one transaction.
+func (s *Scanner) processTx(ctx context.Context, logs []types.Log, next uint64) error {
+	store := s.store.(storage.TxPersistence)
+	tx, err := store.BeginTx(ctx)
 	if err != nil {
-		return 0, err
+		return err
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	start := uint64(0)
-	if head > s.config.Rewind {
-		start = head - s.config.Rewind
+	if len(logs) > 0 {
+		if err := s.txHandler(ctx, tx, logs); err != nil {
+			return err
+		}
+	}
+	if next >= s.resumed {
+		if err := store.SaveCursorTx(ctx, tx, s.config.ChainID, next); err != nil {
+			return fmt.Errorf("save cursor: %w", err)
+		}
 	}
-	log.Info("Start strategy: Rewind from Head", "head", head, "rewind", s.config.Rewind, "start", start)
+	return tx.Commit()
+}
 
-	return start, nil
+// RangedClient is implemented by clients whose nodes cap the blocks of an
+// eth_getLogs request differently, such as rpc.MultiClient: FilterLogsWithin
+// sends requests of at most limit blocks, 0 for no limit, and of the limit
+// of the node serving each.
+type RangedClient interface {
+	FilterLogsWithin(ctx context.Context, q ethereum.FilterQuery, limit uint64) ([]types.Log, error)
 }
 
-func (s *Scanner) scanRange(ctx context.Context, from, to uint64) error {
+var _ RangedClient = (*rpc.MultiClient)(nil)
+
+// filterLogs executes q, in requests sized by the client if it is a
+// RangedClient.
+func (s *Scanner) filterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var (
+		logs []types.Log
+		err  error
+	)
+	if c, ok := s.client.(RangedClient); ok {
+		logs, err = c.FilterLogsWithin(ctx, q, s.config.MaxLogsRange)
+	} else {
+		logs, err = s.client.FilterLogs(ctx, q)
+	}
+	if err != nil || !s.blockTimes.Load() {
+		return logs, err
+	}
+	return logs, s.fillBlockTimestamps(ctx, logs)
+}
+
+// fetchLogs returns the logs of [from, to] matching the filter, in requests
+// of at most MaxLogsRange blocks.
+func (s *Scanner) fetchLogs(ctx context.Context, from, to uint64) ([]types.Log, error) {
+	logs, _, err := s.fetchSetLogs(ctx, s.filters.Load(), from, to)
+	return logs, err
+}
+
+// fetchSetLogs returns the logs of [from, to] matching set, in requests of at
+// most MaxLogsRange blocks, each one leaving out the contracts starting after
+// its blocks, and the number of the logs only the sampling of set dropped.
+// A RangedClient splits the requests itself, per node: the contracts
+// starting within the range are then left to the local filtering.
+func (s *Scanner) fetchSetLogs(ctx context.Context, set *FilterSet, from, to uint64) ([]types.Log, uint64, error) {
+	_, ranged := s.client.(RangedClient)
+	if limit := s.config.MaxLogsRange; limit > 0 && to-from >= limit && !ranged {
+		var logs []types.Log
+		var sampledOut uint64
+		for start := from; start <= to; start += limit {
+			end := min(start+limit-1, to)
+			part, n, err := s.fetchSetLogs(ctx, set, start, end)
+			if err != nil {
+				return nil, 0, err
+			}
+			logs = append(logs, part...)
+			sampledOut += n
+		}
+		return logs, sampledOut, nil
+	}
+
 	// Strategy: Check if Bloom optimization should be used
 	// If:
 	// 1. Bloom optimization enabled
@@ -190,38 +818,52 @@ func (s *Scanner) scanRange(ctx context.Context, from, to uint64) error {
 	// For simplicity, we only use Bloom when BatchSize=1 or scanning single block
 	// eth_getLogs is usually fast enough anyway.
 
-	shouldCheckBloom := s.config.UseBloom && !s.filter.IsHeavy() && (to == from)
+	set = set.at(to)
+	shouldCheckBloom := s.config.UseBloom && !set.IsHeavy() && (to == from)
 
 	if shouldCheckBloom {
 		header, err := s.client.HeaderByNumber(ctx, big.NewInt(int64(from)))
 		if err != nil {
-			return err
+			return nil, 0, err
 		}
 		// Local Bloom check
-		if !s.filter.MatchesBloom(header.Bloom) {
+		if !set.MatchesBloom(header.Bloom) {
 			// Bloom says definitely not here, skip
-			return nil
+			return nil, 0, nil
 		}
 		// Bloom says possibly here, continue to eth_getLogs
 	}
 
-	// Build eth_getLogs request
-	query := s.filter.ToQuery(from, to)
-
-	// Set range
-	query.FromBlock = big.NewInt(int64(from))
-	query.ToBlock = big.NewInt(int64(to))
-
-	logs, err := s.client.FilterLogs(ctx, query)
-	if err != nil {
-		return err
+	switch {
+	case len(set.Filters) == 0:
+		return nil, 0, nil
+	case len(set.Filters) == 1 && set.Filters[0].SampleRate <= 1:
+		filter := set.Filters[0]
+		logs, err := s.filterLogs(ctx, filter.ToQuery(from, to))
+		if err != nil {
+			return nil, 0, err
+		}
+		// eth_getLogs cannot apply exclusions nor watchlists
+		return filter.dropLocal(logs), 0, nil
 	}
 
-	if len(logs) > 0 && s.handler != nil {
-		if err := s.handler(ctx, logs); err != nil {
-			return err
+	// One request per group of filters sharing their topics, whose results
+	// overlap when a log matches filters of several groups
+	queries := set.queries()
+	parts := make([][]types.Log, len(queries))
+	for i, q := range queries {
+		logs, err := s.filterLogs(ctx, q.ToQuery(from, to))
+		if err != nil {
+			return nil, 0, err
 		}
+		parts[i] = logs
 	}
-
-	return nil
+	logs := parts[0]
+	if len(parts) > 1 {
+		logs = mergeLogs(parts)
+	}
+	// Unions of contracts also match the contracts of a filter with the
+	// exclusions or the watchlists of another
+	kept, sampledOut := set.keep(logs)
+	return kept, sampledOut, nil
 }
@@ -2,13 +2,23 @@ package scanner
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"math/big"
+	"regexp"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -18,16 +28,20 @@ type MockStore struct {
 	mock.Mock
 }
 
-func (m *MockStore) LoadCursor(key string) (uint64, error) {
+func (m *MockStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
 	args := m.Called(key)
 	return args.Get(0).(uint64), args.Error(1)
 }
 
-func (m *MockStore) SaveCursor(key string, height uint64) error {
+func (m *MockStore) SaveCursor(ctx context.Context, key string, height uint64) error {
 	args := m.Called(key, height)
 	return args.Error(0)
 }
 
+func (m *MockStore) Ping(ctx context.Context) error {
+	return nil
+}
+
 func (m *MockStore) Close() error {
 	return m.Called().Error(0)
 }
@@ -82,6 +96,22 @@ func (m *MockRPC) CodeAt(ctx context.Context, account common.Address, blockNumbe
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *MockRPC) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	args := m.Called(ctx, account, key, blockNumber)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockRPC) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	args := m.Called(ctx, msg, blockNumber)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 func (m *MockRPC) Close() {
 	m.Called()
 }
@@ -92,21 +122,21 @@ func TestDetermineStartBlock(t *testing.T) {
 
 	// Case 1: Force Start
 	s := New(client, store, Config{ForceStart: true, StartBlock: 100}, nil)
-	start, err := s.DetermineStartBlockForTest(context.Background())
+	start, err := s.determineStartBlock(context.Background())
 	assert.NoError(t, err)
-	assert.Equal(t, uint64(100), start)
+	assert.Equal(t, uint64(100), start.Block)
 
 	// Case 2: Resume from Store (No Rewind)
 	s = New(client, store, Config{ChainID: "eth"}, nil)
 	store.On("LoadCursor", "eth").Return(uint64(500), nil).Once()
-	start, _ = s.DetermineStartBlockForTest(context.Background())
-	assert.Equal(t, uint64(500), start)
+	start, _ = s.determineStartBlock(context.Background())
+	assert.Equal(t, uint64(500), start.Block)
 
 	// Case 3: Resume with Cursor Rewind
 	s = New(client, store, Config{ChainID: "eth", CursorRewind: 10}, nil)
 	store.On("LoadCursor", "eth").Return(uint64(500), nil).Once()
-	start, _ = s.DetermineStartBlockForTest(context.Background())
-	assert.Equal(t, uint64(490), start)
+	start, _ = s.determineStartBlock(context.Background())
+	assert.Equal(t, uint64(490), start.Block)
 }
 
 func TestDetermineStartBlock_Rewind(t *testing.T) {
@@ -122,10 +152,10 @@ func TestDetermineStartBlock_Rewind(t *testing.T) {
 	// Mock: BlockNumber -> 1000
 	client.On("BlockNumber", mock.Anything).Return(uint64(1000), nil).Once()
 
-	start, err := s.DetermineStartBlockForTest(context.Background())
+	start, err := s.determineStartBlock(context.Background())
 	assert.NoError(t, err)
 	// Expected: 1000 - 100 = 900
-	assert.Equal(t, uint64(900), start)
+	assert.Equal(t, uint64(900), start.Block)
 }
 
 func TestScanner_Start_Errors(t *testing.T) {
@@ -169,9 +199,82 @@ func TestDetermineStartBlock_RewindBoundary(t *testing.T) {
 	store.On("LoadCursor", "eth").Return(uint64(0), nil).Once()
 	client.On("BlockNumber", mock.Anything).Return(uint64(50), nil).Once()
 
-	start, err := s.DetermineStartBlockForTest(context.Background())
+	start, err := s.determineStartBlock(context.Background())
 	assert.NoError(t, err)
-	assert.Equal(t, uint64(0), start)
+	assert.Equal(t, uint64(0), start.Block)
+}
+
+func TestDetermineStartBlock_Decision(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		saved uint64
+		want  StartDecision
+	}{
+		{"force", Config{StartBlock: 100, ForceStart: true}, 500,
+			StartDecision{Strategy: StartForce, Block: 100, Reason: "forced start_block", StartBlock: 100, ForceStart: true}},
+		{"resume", Config{StartBlock: 100}, 500,
+			StartDecision{Strategy: StartResume, Block: 500, Reason: "saved cursor", SavedCursor: 500, StartBlock: 100}},
+		{"resume with cursor rewind", Config{CursorRewind: 10}, 500,
+			StartDecision{Strategy: StartResume, Block: 490, Reason: "saved cursor less cursor_rewind", SavedCursor: 500, CursorRewind: 10}},
+		{"cursor rewind clamped to zero", Config{CursorRewind: 800}, 500,
+			StartDecision{Strategy: StartResume, Reason: "saved cursor less cursor_rewind", SavedCursor: 500, CursorRewind: 800, Clamped: true}},
+		{"start block", Config{StartBlock: 100, Rewind: 10}, 0,
+			StartDecision{Strategy: StartResume, Block: 100, Reason: "no saved cursor, start_block", StartBlock: 100, Rewind: 10}},
+		{"rewind", Config{Rewind: 10}, 0,
+			StartDecision{Strategy: StartRewind, Block: 990, Reason: "no saved cursor or start_block, rewind from head", Rewind: 10, Head: 1000}},
+		{"explicit force", Config{StartStrategy: StartForce, StartBlock: 100}, 500,
+			StartDecision{Strategy: StartForce, Block: 100, Reason: "forced start_block", Explicit: true, StartBlock: 100}},
+		{"explicit resume", Config{StartStrategy: StartResume, StartBlock: 100, ForceStart: true}, 500,
+			StartDecision{Strategy: StartResume, Block: 500, Reason: "saved cursor", Explicit: true, SavedCursor: 500, StartBlock: 100, ForceStart: true}},
+		{"explicit resume without cursor", Config{StartStrategy: StartResume, Rewind: 10}, 0,
+			StartDecision{Strategy: StartResume, Reason: "no saved cursor, start_block", Explicit: true, Rewind: 10}},
+		{"explicit rewind", Config{StartStrategy: StartRewind, StartBlock: 100, Rewind: 10}, 500,
+			StartDecision{Strategy: StartRewind, Block: 990, Reason: "rewind from head", Explicit: true, StartBlock: 100, Rewind: 10, Head: 1000}},
+		{"explicit genesis", Config{StartStrategy: StartGenesis, StartBlock: 100}, 500,
+			StartDecision{Strategy: StartGenesis, Reason: "genesis", Explicit: true, StartBlock: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStore("")
+			if tt.saved > 0 {
+				assert.NoError(t, store.SaveCursor(context.Background(), "eth", tt.saved))
+			}
+			client := new(MockRPC)
+			client.On("BlockNumber", mock.Anything).Return(uint64(1000), nil).Maybe()
+			tt.cfg.ChainID = "eth"
+			s := New(client, store, tt.cfg, nil)
+			d, err := s.determineStartBlock(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, d)
+			assert.Equal(t, tt.want.Strategy == StartForce || (tt.want.Explicit && tt.want.Strategy != StartResume), d.overridesCursor())
+		})
+	}
+}
+
+func TestScanner_StartDecisionStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := storage.NewMemoryStore("")
+	assert.NoError(t, store.SaveCursor(context.Background(), "eth", 500))
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(105), nil).Maybe()
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil).Maybe()
+
+	// An explicit genesis start rewinds the saved cursor
+	s := New(client, store, Config{ChainID: "eth", StartStrategy: StartGenesis, BatchSize: 10, Interval: time.Millisecond}, NewFilter())
+	go func() {
+		assert.Eventually(t, func() bool {
+			h, _ := store.LoadCursor(context.Background(), "eth")
+			return h > 0 && h < 500
+		}, time.Second, time.Millisecond)
+		cancel()
+	}()
+	assert.ErrorIs(t, s.Start(ctx), context.Canceled)
+	assert.Equal(t, StartDecision{Strategy: StartGenesis, Reason: "genesis", Explicit: true}, s.Stats().Start)
+
+	s = New(client, store, Config{ChainID: "eth", StartStrategy: "latest"}, NewFilter())
+	assert.ErrorContains(t, s.Start(context.Background()), "unsupported start strategy")
 }
 
 func TestScanRange_BloomHit(t *testing.T) {
@@ -191,7 +294,7 @@ func TestScanRange_BloomHit(t *testing.T) {
 	// 2. Expect FilterLogs to be called because Bloom HIT
 	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil).Once()
 
-	err := s.ScanRangeForTest(context.Background(), 100, 100)
+	err := s.scanRange(context.Background(), 100, 100)
 	assert.NoError(t, err)
 	client.AssertExpectations(t)
 }
@@ -209,7 +312,7 @@ func TestScanRange_BloomOptimization(t *testing.T) {
 
 	// Expect: scanRange should return nil WITHOUT calling FilterLogs (skipped)
 	// If FilterLogs is called, the mock would panic because we didn't define expectation
-	err := s.ScanRangeForTest(context.Background(), 100, 100)
+	err := s.scanRange(context.Background(), 100, 100)
 	assert.NoError(t, err)
 	client.AssertNotCalled(t, "FilterLogs")
 }
@@ -235,18 +338,440 @@ func TestScanRange_Hit(t *testing.T) {
 		return nil
 	})
 
-	err := s.ScanRangeForTest(context.Background(), 100, 105)
+	err := s.scanRange(context.Background(), 100, 105)
 	assert.NoError(t, err)
 	assert.True(t, handled)
 }
 
-// Expose private methods for testing
-func (s *Scanner) DetermineStartBlockForTest(ctx context.Context) (uint64, error) {
-	return s.determineStartBlock(ctx)
+func TestScanRange_Exclusions(t *testing.T) {
+	client := new(MockRPC)
+	transfer, approval := common.HexToHash("0xddf2"), common.HexToHash("0x8c5b")
+	spam, token := common.HexToAddress("0xbad"), common.HexToAddress("0x1234")
+	spammer := common.HexToHash("0xdead")
+	filter := NewFilter().SetTopic(0, transfer, approval).
+		ExcludeContract(spam).
+		ExcludeTopic(1, spammer).
+		ExcludeTopic(0, approval)
+
+	// The query keeps the positive constraints only
+	logs := []types.Log{
+		{Address: token, Topics: []common.Hash{transfer, {}}, Index: 0},
+		{Address: spam, Topics: []common.Hash{transfer, {}}, Index: 1},
+		{Address: token, Topics: []common.Hash{transfer, spammer}, Index: 2},
+		{Address: token, Topics: []common.Hash{approval, {}}, Index: 3},
+		{Address: token, Topics: []common.Hash{transfer}, Index: 4},
+	}
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return len(q.Addresses) == 0 && assert.ObjectsAreEqual([][]common.Hash{{transfer, approval}}, q.Topics)
+	})).Return(logs, nil).Once()
+
+	var handled []uint
+	s := New(client, new(MockStore), Config{BatchSize: 10}, filter)
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		for _, l := range logs {
+			handled = append(handled, l.Index)
+		}
+		return nil
+	})
+	assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+	assert.Equal(t, []uint{0, 4}, handled)
+	assert.Equal(t, uint64(2), s.Stats().LogsScanned)
+	assert.Equal(t, spam, logs[1].Address) // Untouched
+
+	// A batch left without logs does not reach the handler
+	handled = nil
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return(logs, nil).Once()
+	s.SetFilter(NewFilter().ExcludeContract(token, spam))
+	assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+	assert.Nil(t, handled)
+}
+
+func TestScanRange_MaxLogsRange(t *testing.T) {
+	client := new(MockRPC)
+	s := New(client, new(MockStore), Config{BatchSize: 250, MaxLogsRange: 100}, NewFilter())
+
+	for _, r := range [][2]int64{{100, 199}, {200, 299}, {300, 349}} {
+		client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Int64() == r[0] && q.ToBlock.Int64() == r[1]
+		})).Return([]types.Log{{BlockNumber: uint64(r[0])}}, nil).Once()
+	}
+	var handled []types.Log
+	s.SetHandler(func(ctx context.Context, l []types.Log) error {
+		handled = append(handled, l...)
+		return nil
+	})
+
+	assert.NoError(t, s.scanRange(context.Background(), 100, 349))
+	assert.Equal(t, []types.Log{{BlockNumber: 100}, {BlockNumber: 200}, {BlockNumber: 300}}, handled)
+	client.AssertExpectations(t)
+
+	// A failed sub-range fails the whole batch
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return(nil, assert.AnError)
+	assert.ErrorIs(t, s.scanRange(context.Background(), 100, 349), assert.AnError)
+}
+
+// rangedRPC is a MockRPC splitting log queries per node.
+type rangedRPC struct {
+	MockRPC
+}
+
+func (m *rangedRPC) FilterLogsWithin(ctx context.Context, q ethereum.FilterQuery, limit uint64) ([]types.Log, error) {
+	args := m.Called(ctx, q, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]types.Log), args.Error(1)
+}
+
+func TestScanRange_RangedClient(t *testing.T) {
+	client := new(rangedRPC)
+	s := New(client, new(MockStore), Config{BatchSize: 250, MaxLogsRange: 100}, NewFilter())
+	// The whole batch, the client sizes the requests for its nodes
+	client.On("FilterLogsWithin", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 100 && q.ToBlock.Int64() == 349
+	}), uint64(100)).Return([]types.Log{{BlockNumber: 300}}, nil).Once()
+	var handled []types.Log
+	s.SetHandler(func(ctx context.Context, l []types.Log) error {
+		handled = append(handled, l...)
+		return nil
+	})
+
+	assert.NoError(t, s.scanRange(context.Background(), 100, 349))
+	assert.Equal(t, []types.Log{{BlockNumber: 300}}, handled)
+	client.AssertExpectations(t)
+	client.AssertNotCalled(t, "FilterLogs", mock.Anything, mock.Anything)
+}
+
+// logsNode is the eth namespace of a node returning one log per request.
+type logsNode struct{}
+
+func (logsNode) GetLogs(q struct {
+	FromBlock *hexutil.Big `json:"fromBlock"`
+}) []types.Log {
+	return []types.Log{{BlockNumber: q.FromBlock.ToInt().Uint64(), Topics: []common.Hash{}}}
+}
+
+func TestScanRange_WrapEthClient(t *testing.T) {
+	server := gethrpc.NewServer()
+	assert.NoError(t, server.RegisterName("eth", logsNode{}))
+	defer server.Stop()
+
+	// A plain ethclient, without MultiClient
+	s := New(rpc.WrapEthClient(ethclient.NewClient(gethrpc.DialInProc(server))), new(MockStore), Config{BatchSize: 10}, NewFilter())
+	var handled []types.Log
+	s.SetHandler(func(ctx context.Context, l []types.Log) error {
+		handled = append(handled, l...)
+		return nil
+	})
+
+	assert.NoError(t, s.scanRange(context.Background(), 100, 109))
+	if assert.Len(t, handled, 1) {
+		assert.Equal(t, uint64(100), handled[0].BlockNumber)
+	}
+}
+
+func TestScanRange_BlockTimestamps(t *testing.T) {
+	client := new(MockRPC)
+	for range 3 {
+		client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{
+			{BlockNumber: 100, Index: 0}, {BlockNumber: 100, Index: 1}, {BlockNumber: 102, Index: 0, BlockTimestamp: 5},
+		}, nil).Once()
+	}
+	client.On("HeaderByNumber", mock.Anything, big.NewInt(100)).Return(&types.Header{Number: big.NewInt(100), Time: 1000}, nil).Once()
+	s := New(client, new(MockStore), Config{BatchSize: 10, BlockTimestamps: true}, NewFilter())
+	var handled []types.Log
+	s.SetHandler(func(ctx context.Context, l []types.Log) error {
+		handled = append(handled, l...)
+		return nil
+	})
+
+	// One header per block, the timestamps the node returned are kept
+	assert.NoError(t, s.scanRange(context.Background(), 100, 109))
+	if assert.Len(t, handled, 3) {
+		assert.Equal(t, []uint64{1000, 1000, 5}, []uint64{handled[0].BlockTimestamp, handled[1].BlockTimestamp, handled[2].BlockTimestamp})
+	}
+
+	// A header that cannot be fetched fails the batch
+	client.On("HeaderByNumber", mock.Anything, big.NewInt(100)).Return(nil, assert.AnError)
+	assert.ErrorIs(t, s.scanRange(context.Background(), 100, 109), assert.AnError)
+
+	s.SetBlockTimestamps(false)
+	handled = nil
+	assert.NoError(t, s.scanRange(context.Background(), 100, 109))
+	assert.Zero(t, handled[0].BlockTimestamp)
+}
+
+func TestScanRange_SortsLogs(t *testing.T) {
+	logAt := func(block uint64, tx, index uint) types.Log {
+		return types.Log{BlockNumber: block, TxIndex: tx, Index: index}
+	}
+	sorted := []types.Log{logAt(100, 0, 0), logAt(100, 0, 1), logAt(100, 2, 2), logAt(101, 0, 0), logAt(102, 1, 5)}
+	shuffled := []types.Log{sorted[3], sorted[2], sorted[4], sorted[0], sorted[1]}
+
+	for _, disable := range []bool{false, true} {
+		client := new(MockRPC)
+		client.On("FilterLogs", mock.Anything, mock.Anything).Return(shuffled, nil)
+		s := New(client, new(MockStore), Config{BatchSize: 10, DisableLogSort: disable}, NewFilter())
+		var handled []types.Log
+		s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+			handled = logs
+			return nil
+		})
+		assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+		if disable {
+			assert.Equal(t, shuffled, handled)
+		} else {
+			assert.Equal(t, sorted, handled)
+		}
+		assert.Equal(t, sorted[3], shuffled[0]) // Sorted in a copy
+
+		logs, err := s.ScanOnce(context.Background(), 100, 105)
+		assert.NoError(t, err)
+		assert.Equal(t, handled, logs)
+	}
+
+	// The sub-ranges of MaxLogsRange are put in order too
+	client := new(MockRPC)
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 100
+	})).Return([]types.Log{sorted[1], sorted[0]}, nil)
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return q.FromBlock.Int64() == 101
+	})).Return([]types.Log{sorted[4], sorted[3]}, nil)
+	s := New(client, new(MockStore), Config{BatchSize: 10, MaxLogsRange: 1}, NewFilter())
+	logs, err := s.ScanOnce(context.Background(), 100, 101)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Log{sorted[0], sorted[1], sorted[3], sorted[4]}, logs)
+}
+
+func TestScanner_ScanOnce(t *testing.T) {
+	client := new(MockRPC)
+	store := new(MockStore)
+	s := New(client, store, Config{BatchSize: 150, MaxLogsRange: 100}, NewFilter())
+	handled := false
+	s.SetHandler(func(ctx context.Context, l []types.Log) error {
+		handled = true
+		return nil
+	})
+
+	// Split into batches, and batches into requests of MaxLogsRange blocks
+	for _, r := range [][2]int64{{100, 199}, {200, 249}, {250, 349}, {350, 350}} {
+		client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+			return q.FromBlock.Int64() == r[0] && q.ToBlock.Int64() == r[1]
+		})).Return([]types.Log{{BlockNumber: uint64(r[0])}}, nil).Once()
+	}
+	logs, err := s.ScanOnce(context.Background(), 100, 350)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Log{{BlockNumber: 100}, {BlockNumber: 200}, {BlockNumber: 250}, {BlockNumber: 350}}, logs)
+	client.AssertExpectations(t)
+
+	// Neither the handler nor the cursor are touched
+	assert.False(t, handled)
+	store.AssertNotCalled(t, "SaveCursor", mock.Anything, mock.Anything, mock.Anything)
+	assert.Equal(t, Stats{}, s.Stats())
+
+	_, err = s.ScanOnce(context.Background(), 10, 9)
+	assert.EqualError(t, err, "invalid range: from 10 is after to 9")
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return(nil, assert.AnError)
+	_, err = s.ScanOnce(context.Background(), 100, 350)
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestScanner_SetFilter(t *testing.T) {
+	client := new(MockRPC)
+	s := New(client, new(MockStore), Config{BatchSize: 10}, NewFilter().AddContract(common.HexToAddress("0x01")))
+	s.SetHandler(func(ctx context.Context, l []types.Log) error { return nil })
+
+	added := common.HexToAddress("0x02")
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return len(q.Addresses) == 2 && q.Addresses[1] == added
+	})).Return([]types.Log{}, nil).Once()
+
+	s.SetFilter(NewFilter().AddContract(common.HexToAddress("0x01"), added))
+	assert.NoError(t, s.scanRange(context.Background(), 100, 109))
+	client.AssertExpectations(t)
+}
+
+func TestScanner_SafeHead(t *testing.T) {
+	ctx := context.Background()
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(105), nil)
+	client.On("HeaderByNumber", mock.Anything, big.NewInt(-4)).Return(&types.Header{Number: big.NewInt(90)}, nil)
+	client.On("HeaderByNumber", mock.Anything, big.NewInt(-3)).Return(&types.Header{Number: big.NewInt(70)}, nil)
+
+	tests := []struct {
+		mode FinalityMode
+		want uint64
+	}{
+		{"", 102},
+		{FinalitySafe, 90},
+		{FinalityFinalized, 70},
+	}
+	for _, tt := range tests {
+		s := New(client, new(MockStore), Config{ReorgSafe: 3, FinalityMode: tt.mode}, NewFilter())
+		head, ok, err := s.safeHead(ctx)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, tt.want, head, tt.mode)
+	}
+
+	// No block is safe while the chain is shorter than the confirmations
+	s := New(client, new(MockStore), Config{ReorgSafe: 200}, NewFilter())
+	_, ok, err := s.safeHead(ctx)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	mode, err := ParseFinalityMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, FinalityConfirmations, mode)
+	_, err = ParseFinalityMode("latest")
+	assert.EqualError(t, err, `unsupported finality mode: "latest"`)
+	s = New(client, new(MockStore), Config{FinalityMode: "latest"}, NewFilter())
+	assert.EqualError(t, s.Start(ctx), `unsupported finality mode: "latest"`)
+}
+
+func TestScanner_Checkpoint(t *testing.T) {
+	store := storage.NewMemoryStore("")
+	client := new(MockRPC)
+	s := New(client, store, Config{ChainID: "eth", BatchSize: 10, TrackBlockHash: true}, NewFilter())
+
+	// The checkpoint records the logs scanned and the hash of the last scanned block
+	header := &types.Header{Number: big.NewInt(105)}
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{{BlockNumber: 100}, {BlockNumber: 103}}, nil).Once()
+	client.On("HeaderByNumber", mock.Anything, big.NewInt(105)).Return(header, nil)
+	assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+	assert.NoError(t, s.saveCursor(context.Background(), 106))
+
+	cp, err := store.LoadCheckpoint(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(106), cp.Height)
+	assert.Equal(t, header.Hash(), cp.BlockHash)
+	assert.Equal(t, uint64(2), cp.LogsScanned)
+	assert.False(t, cp.UpdatedAt.IsZero())
+
+	// On resume the hash is verified and the stats carried on
+	s = New(client, store, Config{ChainID: "eth", TrackBlockHash: true}, NewFilter())
+	start, err := s.determineStartBlock(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(106), start.Block)
+	assert.Equal(t, uint64(2), s.logsScanned)
+	client.AssertNumberOfCalls(t, "HeaderByNumber", 2)
+
+	// A reorganized block only warns: the cursor still applies
+	reorged := new(MockRPC)
+	reorged.On("HeaderByNumber", mock.Anything, big.NewInt(105)).Return(&types.Header{Number: big.NewInt(105), Extra: []byte("fork")}, nil).Once()
+	s = New(reorged, store, Config{ChainID: "eth", TrackBlockHash: true}, NewFilter())
+	start, err = s.determineStartBlock(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(106), start.Block)
+	reorged.AssertExpectations(t)
+
+	// Without TrackBlockHash no header is requested
+	s = New(new(MockRPC), store, Config{ChainID: "eth"}, NewFilter())
+	assert.NoError(t, s.saveCursor(context.Background(), 107))
+	cp, err = store.LoadCheckpoint(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(107), cp.Height)
+	assert.Equal(t, common.Hash{}, cp.BlockHash)
+}
+
+func TestScanner_ForceStartRewindsCursor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := storage.NewMemoryStore("")
+	assert.NoError(t, store.SaveCursor(context.Background(), "eth", 500))
+
+	// The saved cursor is rewound explicitly, so later saves are not regressions
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(105), nil).Maybe()
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil).Maybe()
+	s := New(client, store, Config{ChainID: "eth", StartBlock: 100, ForceStart: true, Interval: time.Millisecond}, NewFilter())
+	go func() {
+		assert.Eventually(t, func() bool {
+			h, _ := store.LoadCursor(context.Background(), "eth")
+			return h == 106
+		}, time.Second, time.Millisecond)
+		cancel()
+	}()
+	assert.ErrorIs(t, s.Start(ctx), context.Canceled)
 }
 
-func (s *Scanner) ScanRangeForTest(ctx context.Context, from, to uint64) error {
-	return s.scanRange(ctx, from, to)
+func TestScanner_CursorRewindKeepsSavedCursor(t *testing.T) {
+	store := storage.NewMemoryStore("")
+	assert.NoError(t, store.SaveCursor(context.Background(), "eth", 500))
+
+	s := New(new(MockRPC), store, Config{ChainID: "eth", CursorRewind: 10}, NewFilter())
+	start, err := s.determineStartBlock(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(490), start.Block)
+
+	// Rescanning the rewound blocks does not move the saved cursor backwards
+	assert.NoError(t, s.saveCursor(context.Background(), 495))
+	h, err := store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(500), h)
+	assert.NoError(t, s.saveCursor(context.Background(), 505))
+	h, err = store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(505), h)
+}
+
+// txStore is a storage.TxPersistence over a sqlmock database.
+type txStore struct {
+	MockStore
+	db *sql.DB
+}
+
+func (s *txStore) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return s.db.BeginTx(ctx, nil)
+}
+
+func (s *txStore) SaveCursorTx(ctx context.Context, tx *sql.Tx, key string, height uint64) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO checkpoints (task_key, block_height) VALUES ($1, $2)", key, height)
+	return err
+}
+
+func TestScanRange_TxHandler(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	client := new(MockRPC)
+	s := New(client, &txStore{db: db}, Config{ChainID: "eth", BatchSize: 10}, NewFilter())
+	s.SetTxHandler(func(ctx context.Context, tx *sql.Tx, logs []types.Log) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO events (block_number) VALUES ($1)", logs[0].BlockNumber)
+		return err
+	})
+
+	// Events and cursor are written in a single transaction
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{{BlockNumber: 100}}, nil).Once()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO events")).WithArgs(100).WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO checkpoints")).WithArgs("eth", 106).WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+	assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+
+	// A failed write rolls back, leaving the cursor where it was
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{{BlockNumber: 106}}, nil).Once()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO events")).WithArgs(106).WillReturnError(assert.AnError)
+	dbMock.ExpectRollback()
+	assert.ErrorIs(t, s.scanRange(context.Background(), 106, 110), assert.AnError)
+
+	// Ranges without logs still move the cursor
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil).Once()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(regexp.QuoteMeta("INSERT INTO checkpoints")).WithArgs("eth", 111).WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+	assert.NoError(t, s.scanRange(context.Background(), 106, 110))
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestScanner_TxHandlerRequiresTxStore(t *testing.T) {
+	s := New(new(MockRPC), new(MockStore), Config{}, NewFilter())
+	s.SetTxHandler(func(ctx context.Context, tx *sql.Tx, logs []types.Log) error { return nil })
+	err := s.Start(context.Background())
+	assert.ErrorContains(t, err, "tx handler requires a storage.TxPersistence store")
 }
 
 func TestScanner_Start(t *testing.T) {
@@ -284,3 +809,300 @@ func TestScanner_Start(t *testing.T) {
 	err := s.Start(ctx)
 	assert.ErrorIs(t, err, context.Canceled)
 }
+
+func TestScanner_Stats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := new(MockStore)
+	client := new(MockRPC)
+	store.On("LoadCursor", "eth").Return(uint64(100), nil)
+	store.On("SaveCursor", "eth", uint64(103)).Return(nil)
+	client.On("BlockNumber", mock.Anything).Return(uint64(105), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{{BlockNumber: 100}, {BlockNumber: 102}}, nil).Once()
+
+	s := New(client, store, Config{ChainID: "eth", Interval: 10 * time.Millisecond, ReorgSafe: 3, CursorFlushInterval: -1}, NewFilter())
+	s.SetHandler(func(ctx context.Context, l []types.Log) error { return nil })
+	assert.Equal(t, Stats{ChainID: "eth"}, s.Stats())
+
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+	assert.Eventually(t, func() bool { return s.Stats().NextBlock == 103 }, time.Second, 5*time.Millisecond)
+	st := s.Stats()
+	assert.True(t, st.Running)
+	assert.Equal(t, uint64(102), st.SafeHead)
+	assert.Equal(t, uint64(2), st.LogsScanned)
+	assert.False(t, st.LastScan.IsZero())
+	assert.Empty(t, st.LastError)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.False(t, s.Stats().Running)
+	assert.Empty(t, s.Stats().LastError)
+
+	// The error Start fails with is kept
+	s = New(client, store, Config{ChainID: "eth", FinalityMode: "latest"}, NewFilter())
+	assert.Error(t, s.Start(context.Background()))
+	assert.Equal(t, `unsupported finality mode: "latest"`, s.Stats().LastError)
+}
+
+func TestScanner_PauseSeek(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := storage.NewMemoryStore("")
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(120), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil)
+
+	// Paused, no block is scanned
+	s := New(client, store, Config{ChainID: "eth", StartBlock: 100, BatchSize: 5, Interval: time.Millisecond, CursorFlushInterval: -1}, NewFilter())
+	s.Pause()
+	assert.True(t, s.Stats().Paused)
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, uint64(100), s.Stats().NextBlock)
+	client.AssertNotCalled(t, "FilterLogs", mock.Anything, mock.Anything)
+
+	s.Resume()
+	assert.False(t, s.Stats().Paused)
+	assert.Eventually(t, func() bool { return s.Stats().NextBlock == 121 }, time.Second, time.Millisecond)
+
+	// A seek backwards rewinds the cursor, also while paused
+	s.Pause()
+	s.Seek(110)
+	assert.Eventually(t, func() bool { return s.Stats().NextBlock == 110 }, time.Second, time.Millisecond)
+	cursor, err := store.LoadCursor(ctx, "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(110), cursor)
+
+	s.Resume()
+	assert.Eventually(t, func() bool { return s.Stats().NextBlock == 121 }, time.Second, time.Millisecond)
+	cursor, err = store.LoadCursor(ctx, "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(121), cursor)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestScanner_EndBlock(t *testing.T) {
+	store := storage.NewMemoryStore("")
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(1000), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil)
+
+	// Returns once the end block is scanned, with the cursor flushed
+	s := New(client, store, Config{ChainID: "eth", StartBlock: 100, EndBlock: 149, BatchSize: 20, Interval: time.Millisecond}, NewFilter())
+	assert.NoError(t, s.Start(context.Background()))
+	assert.Equal(t, uint64(150), s.Stats().NextBlock)
+	cursor, err := store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(150), cursor)
+	client.AssertNumberOfCalls(t, "FilterLogs", 3)
+
+	// Resuming past it returns at once
+	assert.NoError(t, s.Start(context.Background()))
+	client.AssertNumberOfCalls(t, "FilterLogs", 3)
+}
+
+// countingStore counts the checkpoints written to a memory store.
+type countingStore struct {
+	*storage.MemoryStore
+	saves atomic.Int32
+}
+
+func (c *countingStore) SaveCheckpoint(ctx context.Context, key string, cp storage.Checkpoint) error {
+	c.saves.Add(1)
+	return c.MemoryStore.SaveCheckpoint(ctx, key, cp)
+}
+
+func TestScanner_CoalescesCursorSaves(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := &countingStore{MemoryStore: storage.NewMemoryStore("")}
+
+	// A backfill of 11 single-block batches, well within one flush interval
+	var scanned atomic.Int32
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(110), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil).
+		Run(func(mock.Arguments) { scanned.Add(1) })
+	s := New(client, store, Config{ChainID: "eth", StartBlock: 100, BatchSize: 1, Interval: time.Millisecond}, NewFilter())
+	go func() {
+		assert.Eventually(t, func() bool { return scanned.Load() == 11 }, time.Second, time.Millisecond)
+		cancel()
+	}()
+	assert.ErrorIs(t, s.Start(ctx), context.Canceled)
+
+	// The first cursor is written at once, the last when Start returns
+	assert.Equal(t, int32(2), store.saves.Load())
+	h, err := store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(111), h)
+}
+
+// outageStore is a memory store that fails while down is set.
+type outageStore struct {
+	*storage.MemoryStore
+	down  atomic.Bool
+	pings atomic.Int32
+}
+
+func (o *outageStore) SaveCheckpoint(ctx context.Context, key string, cp storage.Checkpoint) error {
+	if o.down.Load() {
+		return errors.New("store unreachable")
+	}
+	return o.MemoryStore.SaveCheckpoint(ctx, key, cp)
+}
+
+func (o *outageStore) Ping(ctx context.Context) error {
+	o.pings.Add(1)
+	if o.down.Load() {
+		return errors.New("store unreachable")
+	}
+	return nil
+}
+
+func TestScanner_PausesOnStoreOutage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := &outageStore{MemoryStore: storage.NewMemoryStore("")}
+	store.down.Store(true)
+
+	// A backfill long enough to be still running when the store goes down for the limit
+	var scanned atomic.Int32
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(10_000_000), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil).
+		Run(func(mock.Arguments) { scanned.Add(1) })
+	s := New(client, store, Config{
+		ChainID:             "eth",
+		StartBlock:          100,
+		BatchSize:           1,
+		Interval:            time.Millisecond,
+		CursorFlushInterval: -1,
+		StoreOutageLimit:    20 * time.Millisecond,
+	}, NewFilter())
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+
+	// Scanning stops once saves failed for the limit, while the store is pinged
+	assert.Eventually(t, func() bool { return store.pings.Load() > 2 }, time.Second, time.Millisecond)
+	paused := scanned.Load()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, paused, scanned.Load())
+
+	// And resumes when the store is back
+	store.down.Store(false)
+	assert.Eventually(t, func() bool { return scanned.Load() > paused+5 }, time.Second, time.Millisecond)
+	h, err := store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Greater(t, h, uint64(100))
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+// failingScan returns a scanner from block 100 in batches of one block whose
+// MockStore fails the first failures cursor saves, counting the batches.
+func failingScan(cfg Config, failures int) (*Scanner, *MockStore, *atomic.Int32) {
+	store := new(MockStore)
+	store.On("LoadCursor", "eth").Return(uint64(100), nil)
+	store.On("SaveCursor", "eth", mock.Anything).Return(assert.AnError).Times(failures)
+	store.On("SaveCursor", "eth", mock.Anything).Return(nil)
+	var scanned atomic.Int32
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(10_000_000), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil).
+		Run(func(mock.Arguments) { scanned.Add(1) })
+	cfg.ChainID, cfg.BatchSize, cfg.Interval, cfg.CursorFlushInterval = "eth", 1, time.Millisecond, -1
+	cfg.CursorSaveBackoff = time.Millisecond
+	return New(client, store, cfg, NewFilter()), store, &scanned
+}
+
+func TestScanner_CursorSaveRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, store, scanned := failingScan(Config{CursorSaveRetries: 1}, 1)
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+	assert.Eventually(t, func() bool { return scanned.Load() >= 3 }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// The failed save of the first batch was retried before the next one
+	saves := 0
+	for _, call := range store.Calls {
+		if call.Method == "SaveCursor" && call.Arguments.Get(1) == uint64(101) {
+			saves++
+		}
+	}
+	assert.Equal(t, 2, saves)
+	assert.Equal(t, uint64(0), s.Stats().CursorSaveFailures)
+	assert.Empty(t, s.Stats().LastError)
+}
+
+func TestScanner_PausesOnUnsavedBlocks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Saves keep failing: scanning pauses once 3 blocks are unsaved
+	s, _, scanned := failingScan(Config{CursorSaveRetries: -1, MaxUnsavedBlocks: 3}, 300)
+	done := make(chan error, 1)
+	go func() { done <- s.Start(ctx) }()
+	assert.Eventually(t, func() bool { return s.Stats().CursorSaveFailures >= 10 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(3), scanned.Load())
+	assert.Equal(t, uint64(102), s.Stats().NextBlock)
+	assert.NotEmpty(t, s.Stats().LastError)
+
+	// and resumes once the cursor is saved again
+	assert.Eventually(t, func() bool { return scanned.Load() > 10 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, uint64(0), s.Stats().CursorSaveFailures)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestScanner_StopsOnUnsavedBlocks(t *testing.T) {
+	s, _, scanned := failingScan(Config{CursorSaveRetries: -1, MaxUnsavedBlocks: 3, CursorFailurePolicy: CursorFailureStop}, 300)
+	err := s.Start(context.Background())
+	assert.ErrorIs(t, err, ErrCursorUnsaved)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, int32(3), scanned.Load())
+	assert.Equal(t, uint64(3), s.Stats().CursorSaveFailures)
+	assert.Equal(t, err.Error(), s.Stats().LastError)
+
+	s, _, _ = failingScan(Config{CursorFailurePolicy: "crash"}, 0)
+	assert.ErrorContains(t, s.Start(context.Background()), "unsupported cursor failure policy")
+}
+
+func TestScanner_HandlerPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := storage.NewMemoryStore("")
+	client := new(MockRPC)
+	client.On("BlockNumber", mock.Anything).Return(uint64(109), nil)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{{BlockNumber: 100}}, nil)
+
+	// The batch of the panic is scanned again, the scanner keeps running
+	var calls atomic.Int32
+	s := New(client, store, Config{ChainID: "eth", StartBlock: 100, BatchSize: 10, Interval: time.Millisecond, CursorFlushInterval: -1}, NewFilter())
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		if calls.Add(1) == 1 {
+			var m map[string]int
+			m["nil"]++
+		}
+		return nil
+	})
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+	assert.Eventually(t, func() bool { return s.Stats().NextBlock == 110 }, 3*time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load())
+	st := s.Stats()
+	assert.True(t, st.Running)
+	assert.Equal(t, uint64(1), st.HandlerPanics)
+	assert.Empty(t, st.LastError)
+	cursor, err := store.LoadCursor(ctx, "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(110), cursor)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
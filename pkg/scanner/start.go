@@ -0,0 +1,153 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// StartStrategy picks the first block Start scans, see Config.StartStrategy.
+type StartStrategy string
+
+const (
+	// StartForce starts at StartBlock, rewinding the saved cursor.
+	StartForce StartStrategy = "force"
+	// StartResume starts at the saved cursor less CursorRewind, at StartBlock
+	// if there is none.
+	StartResume StartStrategy = "resume"
+	// StartRewind starts Rewind blocks below the latest block, ignoring and
+	// rewinding the saved cursor.
+	StartRewind StartStrategy = "rewind"
+	// StartGenesis starts at block 0, ignoring and rewinding the saved cursor.
+	StartGenesis StartStrategy = "genesis"
+)
+
+// ParseStartStrategy converts a configuration value into a StartStrategy.
+// Empty keeps the implicit precedence of Config.StartStrategy.
+func ParseStartStrategy(s string) (StartStrategy, error) {
+	switch StartStrategy(s) {
+	case "", StartForce, StartResume, StartRewind, StartGenesis:
+		return StartStrategy(s), nil
+	default:
+		return "", fmt.Errorf("unsupported start strategy: %q", s)
+	}
+}
+
+// StartDecision is how Start chose its first block: the strategy used and
+// the inputs it considered, see Stats.Start.
+type StartDecision struct {
+	Strategy StartStrategy
+	Block    uint64 // First block scanned
+	Reason   string // The decision in words, e.g. "saved cursor less cursor_rewind"
+	// Explicit is set when Config.StartStrategy picked the strategy, rather
+	// than the implicit precedence.
+	Explicit     bool
+	SavedCursor  uint64 // 0 if there was none, or it was not read
+	StartBlock   uint64
+	ForceStart   bool
+	Rewind       uint64
+	CursorRewind uint64
+	Head         uint64 // Latest block, 0 if it was not asked for
+	// Clamped is set when CursorRewind exceeded the saved cursor: Block is 0.
+	Clamped bool
+}
+
+// overridesCursor reports whether the decision replaces the saved cursor
+// rather than resuming from it.
+func (d StartDecision) overridesCursor() bool {
+	switch d.Strategy {
+	case StartForce:
+		return true
+	case StartRewind, StartGenesis:
+		return d.Explicit
+	}
+	return false
+}
+
+// determineStartBlock decides the first block to scan. Config.StartStrategy
+// picks the strategy if set; otherwise ForceStart with a StartBlock forces
+// it, then the saved cursor is resumed, then StartBlock is used, and last
+// the scan starts Rewind blocks below the head. The decision is logged as a
+// single record.
+func (s *Scanner) determineStartBlock(ctx context.Context) (StartDecision, error) {
+	d := StartDecision{
+		Strategy:     s.config.StartStrategy,
+		Explicit:     s.config.StartStrategy != "",
+		StartBlock:   s.config.StartBlock,
+		ForceStart:   s.config.ForceStart,
+		Rewind:       s.config.Rewind,
+		CursorRewind: s.config.CursorRewind,
+	}
+	if !d.Explicit {
+		d.Strategy = StartResume
+		if s.config.ForceStart && s.config.StartBlock > 0 {
+			d.Strategy = StartForce
+		}
+	}
+
+	var err error
+	switch d.Strategy {
+	case StartForce:
+		d.Block, d.Reason = s.config.StartBlock, "forced start_block"
+	case StartGenesis:
+		d.Block, d.Reason = 0, "genesis"
+	case StartRewind:
+		err = s.rewindFromHead(ctx, &d)
+	default:
+		err = s.resume(ctx, &d)
+	}
+	if err != nil {
+		return StartDecision{}, err
+	}
+	log.Info("Start strategy", "strategy", d.Strategy, "block", d.Block, "reason", d.Reason,
+		"explicit", d.Explicit, "saved", d.SavedCursor, "start_block", d.StartBlock, "force", d.ForceStart,
+		"rewind", d.Rewind, "cursor_rewind", d.CursorRewind, "head", d.Head, "clamped", d.Clamped)
+	return d, nil
+}
+
+// resume decides to start at the saved cursor less CursorRewind, at
+// StartBlock without one and, unless StartResume is explicit, Rewind blocks
+// below the head without either.
+func (s *Scanner) resume(ctx context.Context, d *StartDecision) error {
+	saved, err := s.loadCursor(ctx)
+	if err != nil {
+		return err
+	}
+	d.SavedCursor = saved
+	switch {
+	case saved > 0 && s.config.CursorRewind > 0:
+		if saved > s.config.CursorRewind {
+			d.Block = saved - s.config.CursorRewind
+		} else {
+			d.Clamped = true
+		}
+		d.Reason = "saved cursor less cursor_rewind"
+		s.resumed = saved
+	case saved > 0:
+		d.Block, d.Reason = saved, "saved cursor"
+	case s.config.StartBlock > 0 || d.Explicit:
+		d.Block, d.Reason = s.config.StartBlock, "no saved cursor, start_block"
+	default:
+		d.Strategy = StartRewind
+		return s.rewindFromHead(ctx, d)
+	}
+	return nil
+}
+
+// rewindFromHead decides to start Rewind blocks below the latest block.
+func (s *Scanner) rewindFromHead(ctx context.Context, d *StartDecision) error {
+	head, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	d.Head = head
+	if head > s.config.Rewind {
+		d.Block = head - s.config.Rewind
+	}
+	d.Reason = "rewind from head"
+	if !d.Explicit {
+		d.Reason = "no saved cursor or start_block, rewind from head"
+	}
+	return nil
+}
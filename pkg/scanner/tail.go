@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// unconfirmedKey is the context key marking the logs of the tail handler.
+type unconfirmedKey struct{}
+
+// Unconfirmed reports whether ctx is that of the tail handler, whose logs are
+// of blocks that may still be reorganized away. See SetTailHandler.
+func Unconfirmed(ctx context.Context) bool {
+	unconfirmed, _ := ctx.Value(unconfirmedKey{}).(bool)
+	return unconfirmed
+}
+
+// SetTailHandler sets the handler given the logs of the blocks at the chain
+// head as soon as they appear, before they are final, e.g. for alerts. While
+// Start runs, every TailInterval, it gets the logs of the new blocks up to
+// TailConfirmations below the latest one, starting with those ReorgSafe
+// below it, with a context marked Unconfirmed. The handler still gets these
+// blocks once final; blocks reorganized away meanwhile are only tailed.
+//
+// The tail keeps no cursor and leaves the one of the handler alone: a failed
+// tail batch is logged and scanned again at the next tick, and blocks more
+// than BatchSize below the head are skipped. The middleware of Use does not
+// apply to the tail handler.
+func (s *Scanner) SetTailHandler(h Handler) {
+	s.tailHandler = h
+}
+
+// tail passes the logs of the blocks at the head to the tail handler every
+// TailInterval until ctx is done.
+func (s *Scanner) tail(ctx context.Context) {
+	ticker := time.NewTicker(s.config.TailInterval)
+	defer ticker.Stop()
+
+	var next uint64 // First block not tailed yet, 0 before the first tick
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		head, err := s.client.BlockNumber(ctx)
+		if err != nil {
+			log.Warn("Failed to get block number for tail", "chain_id", s.config.ChainID, "err", err)
+			continue
+		}
+		if head < s.config.TailConfirmations {
+			continue
+		}
+		to := head - s.config.TailConfirmations
+		if next == 0 {
+			next = head - min(s.config.ReorgSafe, head) + 1
+		}
+		from := max(next, to-min(s.config.BatchSize-1, to))
+		if from > to {
+			continue
+		}
+
+		logs, err := s.fetchLogs(ctx, from, to)
+		if err == nil {
+			err = s.handleTail(ctx, s.sortLogs(logs))
+		}
+		if err != nil {
+			log.Warn("Tail scan failed", "chain_id", s.config.ChainID, "from", from, "to", to, "err", err)
+			continue
+		}
+		next = to + 1
+		s.updateStats(func(st *Stats) { st.TailBlock = to })
+	}
+}
+
+// handleTail passes logs to the tail handler, turning its panics into errors
+// like handle.
+func (s *Scanner) handleTail(ctx context.Context, logs []types.Log) (err error) {
+	if len(logs) == 0 {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Tail handler panicked", "chain_id", s.config.ChainID, "panic", r, "stack", string(debug.Stack()))
+			s.updateStats(func(st *Stats) { st.HandlerPanics++ })
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+		}
+	}()
+	return s.tailHandler(context.WithValue(ctx, unconfirmedKey{}, true), logs)
+}
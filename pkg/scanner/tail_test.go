@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// tailRPC is a benchRPC whose latest block can be moved.
+type tailRPC struct {
+	*benchRPC
+	latest atomic.Uint64
+}
+
+func (n *tailRPC) BlockNumber(ctx context.Context) (uint64, error) { return n.latest.Load(), nil }
+
+// blockRecorder records the blocks of the logs handled and whether they were
+// Unconfirmed.
+type blockRecorder struct {
+	mu     sync.Mutex
+	blocks map[uint64]bool
+}
+
+func (r *blockRecorder) handle(ctx context.Context, logs []types.Log) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, l := range logs {
+		r.blocks[l.BlockNumber] = Unconfirmed(ctx)
+	}
+	return nil
+}
+
+// has reports whether the blocks from to to were handled, Unconfirmed or not.
+func (r *blockRecorder) has(from, to uint64, unconfirmed bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for block := from; block <= to; block++ {
+		if got, ok := r.blocks[block]; !ok || got != unconfirmed {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScanner_Tail(t *testing.T) {
+	node := &tailRPC{benchRPC: newBenchRPC(30, 1, 100)}
+	node.latest.Store(20)
+	store := storage.NewMemoryStore("")
+	s := New(node, store, Config{
+		ChainID:             "eth",
+		StartBlock:          1,
+		BatchSize:           10,
+		ReorgSafe:           5,
+		Interval:            time.Millisecond,
+		TailInterval:        time.Millisecond,
+		CursorFlushInterval: -1,
+	}, NewFilter().AddContract(benchContract))
+	confirmed := &blockRecorder{blocks: make(map[uint64]bool)}
+	tailed := &blockRecorder{blocks: make(map[uint64]bool)}
+	s.SetHandler(confirmed.handle)
+	s.SetTailHandler(tailed.handle)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+
+	// The tail starts with the blocks within the confirmations
+	assert.Eventually(t, func() bool { return confirmed.has(1, 15, false) && tailed.has(16, 20, true) }, time.Second, time.Millisecond)
+	assert.False(t, tailed.has(15, 15, true))
+
+	// Both get the next blocks: the tail first, unconfirmed
+	node.latest.Store(25)
+	assert.Eventually(t, func() bool { return confirmed.has(16, 20, false) && tailed.has(21, 25, true) }, time.Second, time.Millisecond)
+	assert.False(t, confirmed.has(21, 21, false))
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// Only the handler moves the cursor
+	st := s.Stats()
+	assert.Equal(t, uint64(21), st.NextBlock)
+	assert.Equal(t, uint64(25), st.TailBlock)
+	cursor, err := store.LoadCursor(context.Background(), "eth")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(21), cursor)
+}
+
+func TestScanner_TailFailure(t *testing.T) {
+	node := &tailRPC{benchRPC: newBenchRPC(30, 1, 100)}
+	node.latest.Store(20)
+	s := New(node, storage.NewMemoryStore(""), Config{
+		StartBlock:        1,
+		BatchSize:         10,
+		ReorgSafe:         5,
+		TailConfirmations: 2,
+		Interval:          time.Millisecond,
+		TailInterval:      time.Millisecond,
+	}, NewFilter().AddContract(benchContract))
+	confirmed := &blockRecorder{blocks: make(map[uint64]bool)}
+	tailed := &blockRecorder{blocks: make(map[uint64]bool)}
+	s.SetHandler(confirmed.handle)
+
+	// A panicking tail is retried without stopping the handler
+	var calls atomic.Int32
+	s.SetTailHandler(func(ctx context.Context, logs []types.Log) error {
+		if calls.Add(1) == 1 {
+			var m map[string]int
+			m["boom"]++
+		}
+		return tailed.handle(ctx, logs)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+	assert.Eventually(t, func() bool { return confirmed.has(1, 15, false) && tailed.has(16, 18, true) }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// TailConfirmations keeps the tail below the latest block
+	assert.False(t, tailed.has(19, 19, true))
+	assert.Equal(t, uint64(1), s.Stats().HandlerPanics)
+	assert.Empty(t, s.Stats().LastError)
+}
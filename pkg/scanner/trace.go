@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime/debug"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Tracer is implemented by clients tracing the calls of blocks, such as
+// rpc.MultiClient with nodes of a trace API.
+type Tracer interface {
+	TraceBlock(ctx context.Context, number *big.Int) ([]rpc.Trace, error)
+}
+
+var _ Tracer = (*rpc.MultiClient)(nil)
+
+// TransferHandler processes the value transfers of a batch, ordered by block
+// and then like the calls of their transactions. Like the Handler, an error
+// or a panic fails the batch.
+type TransferHandler func(ctx context.Context, transfers []rpc.Trace) error
+
+// SetTransferHandler sets the handler given the native value transfers from
+// or to the addresses of w, or all of them if w is nil, e.g. deposit
+// addresses receiving ETH from multisigs and routers through internal calls,
+// which leave no logs. With Config.TraceTransfers, every block of every batch
+// is traced, before the handler gets its logs, with a client implementing
+// Tracer. The handler gets the transfers of the transactions themselves, at
+// Depth 0, and those of their internal calls, not those reverted.
+func (s *Scanner) SetTransferHandler(w *Watchlist, h TransferHandler) {
+	s.transferWatchlist = w
+	s.transferHandler = h
+}
+
+// errTraceConfig is returned by start for TraceTransfers without a
+// TransferHandler or a Tracer.
+var errTraceConfig = errors.New("trace transfers requires a transfer handler and a client implementing Tracer")
+
+// handleTransfers passes the value transfers of the blocks from to to
+// touching the transfer watchlist to the TransferHandler.
+func (s *Scanner) handleTransfers(ctx context.Context, from, to uint64) (err error) {
+	tracer, ok := s.client.(Tracer)
+	if !s.config.TraceTransfers || s.transferHandler == nil || !ok {
+		return nil
+	}
+	w := s.transferWatchlist
+	var transfers []rpc.Trace
+	for block := from; block <= to; block++ {
+		traces, err := s.traceBlock(ctx, tracer, block)
+		if err != nil {
+			return err
+		}
+		for _, t := range traces {
+			if t.IsTransfer() && (w == nil || w.Contains(t.From) || w.Contains(t.To)) {
+				transfers = append(transfers, t)
+			}
+		}
+	}
+	if len(transfers) == 0 {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Transfer handler panicked", "chain_id", s.config.ChainID, "panic", r, "stack", string(debug.Stack()))
+			s.updateStats(func(st *Stats) { st.HandlerPanics++ })
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+		}
+	}()
+	return s.transferHandler(ctx, transfers)
+}
+
+// traceBlock returns the traces of block, from the cache of the last
+// TraceCacheBlocks blocks traced if there, so that the batches scanned again
+// after a failure are not traced again.
+func (s *Scanner) traceBlock(ctx context.Context, tracer Tracer, block uint64) ([]rpc.Trace, error) {
+	s.traceMu.Lock()
+	traces, ok := s.traceCache[block]
+	s.traceMu.Unlock()
+	if ok {
+		return traces, nil
+	}
+	traces, err := tracer.TraceBlock(ctx, new(big.Int).SetUint64(block))
+	if err != nil {
+		return nil, err
+	}
+	s.traceMu.Lock()
+	defer s.traceMu.Unlock()
+	if s.traceCache == nil || len(s.traceCache) >= s.config.TraceCacheBlocks {
+		s.traceCache = make(map[uint64][]rpc.Trace) // Start over rather than track usage
+	}
+	s.traceCache[block] = traces
+	return traces, nil
+}
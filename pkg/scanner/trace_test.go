@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// tracingRPC is a MockRPC tracing blocks.
+type tracingRPC struct {
+	MockRPC
+}
+
+func (m *tracingRPC) TraceBlock(ctx context.Context, number *big.Int) ([]rpc.Trace, error) {
+	args := m.Called(ctx, number)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]rpc.Trace), args.Error(1)
+}
+
+func TestScanner_TraceTransfers(t *testing.T) {
+	deposit := common.HexToAddress("0xd0")
+	router := common.HexToAddress("0xc1")
+	internal := rpc.Trace{BlockNumber: 100, Type: "CALL", From: router, To: deposit, Value: big.NewInt(5), Depth: 1}
+	traces := []rpc.Trace{
+		{BlockNumber: 100, Type: "CALL", From: common.HexToAddress("0xaa"), To: router, Value: big.NewInt(5)},
+		internal,
+		{BlockNumber: 100, Type: "CALL", From: router, To: deposit, Value: big.NewInt(7), Depth: 1, Reverted: true},
+		{BlockNumber: 100, Type: "DELEGATECALL", From: router, To: deposit, Value: big.NewInt(9), Depth: 1},
+	}
+	client := new(tracingRPC)
+	client.On("FilterLogs", mock.Anything, mock.Anything).Return([]types.Log{}, nil)
+	// Traced once, then from the cache when the batch is scanned again
+	client.On("TraceBlock", mock.Anything, big.NewInt(100)).Return(traces, nil).Once()
+	client.On("TraceBlock", mock.Anything, big.NewInt(101)).Return([]rpc.Trace{}, nil).Once()
+
+	s := New(client, new(MockStore), Config{BatchSize: 10, TraceTransfers: true}, NewFilter())
+	var handled []rpc.Trace
+	s.SetTransferHandler(NewWatchlist(deposit), func(ctx context.Context, transfers []rpc.Trace) error {
+		handled = append(handled, transfers...)
+		return assert.AnError
+	})
+	assert.ErrorIs(t, s.scanRange(context.Background(), 100, 101), assert.AnError)
+	assert.Equal(t, []rpc.Trace{internal}, handled)
+
+	handled = nil
+	s.SetTransferHandler(NewWatchlist(deposit), func(ctx context.Context, transfers []rpc.Trace) error {
+		handled = append(handled, transfers...)
+		return nil
+	})
+	assert.NoError(t, s.scanRange(context.Background(), 100, 101))
+	assert.Equal(t, []rpc.Trace{internal}, handled)
+	client.AssertExpectations(t)
+
+	// Tracing is gated by the config
+	s = New(client, new(MockStore), Config{BatchSize: 10}, NewFilter())
+	s.SetTransferHandler(nil, func(ctx context.Context, transfers []rpc.Trace) error {
+		t.Error("transfers handled without TraceTransfers")
+		return nil
+	})
+	assert.NoError(t, s.scanRange(context.Background(), 100, 101))
+	client.AssertExpectations(t)
+}
+
+func TestScanner_TraceTransfersConfig(t *testing.T) {
+	s := New(new(tracingRPC), new(MockStore), Config{TraceTransfers: true}, NewFilter())
+	assert.ErrorIs(t, s.Start(context.Background()), errTraceConfig)
+
+	// A client without trace API
+	s = New(new(MockRPC), new(MockStore), Config{TraceTransfers: true}, NewFilter())
+	s.SetTransferHandler(nil, func(ctx context.Context, transfers []rpc.Trace) error { return nil })
+	assert.ErrorIs(t, s.Start(context.Background()), errTraceConfig)
+}
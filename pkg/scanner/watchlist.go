@@ -0,0 +1,189 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// watchlistBitsPerAddress is the least size of the bloom filter of a
+// Watchlist per address, for at most a few percent of the addresses it does
+// not hold to reach its map.
+const watchlistBitsPerAddress = 16
+
+// Watchlist is a set of addresses, e.g. the deposit addresses of the users of
+// an exchange, too many to be passed to eth_getLogs, matched against log
+// topics by Filter.Watch. A bloom filter answers for most addresses not in
+// the set without reaching its map. It is safe for concurrent use: addresses
+// can be added and removed while a Scanner matches logs against it.
+type Watchlist struct {
+	mu    sync.RWMutex
+	addrs map[common.Address]struct{}
+	bloom []uint64 // Blocked: an address sets the bits of watchlistMask in one word
+	stale int      // Removed addresses still in the bloom filter
+}
+
+// NewWatchlist creates a Watchlist of addrs.
+func NewWatchlist(addrs ...common.Address) *Watchlist {
+	w := &Watchlist{addrs: make(map[common.Address]struct{}, len(addrs))}
+	for _, addr := range addrs {
+		w.addrs[addr] = struct{}{}
+	}
+	w.rebuild()
+	return w
+}
+
+// ReadWatchlist creates a Watchlist of the addresses read from r, one per
+// line, skipping blank lines and # comments, as written by WriteTo.
+func ReadWatchlist(r io.Reader) (*Watchlist, error) {
+	var addrs []common.Address
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if !common.IsHexAddress(text) {
+			return nil, fmt.Errorf("watchlist line %d: invalid address %q", line, text)
+		}
+		addrs = append(addrs, common.HexToAddress(text))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewWatchlist(addrs...), nil
+}
+
+// WriteTo writes the addresses of the watchlist to wr, one per line, sorted.
+func (w *Watchlist) WriteTo(wr io.Writer) (int64, error) {
+	bw := bufio.NewWriter(wr)
+	var n int64
+	for _, addr := range w.Addresses() {
+		m, err := bw.WriteString(addr.Hex() + "\n")
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+// Add adds addrs to the watchlist.
+func (w *Watchlist) Add(addrs ...common.Address) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, addr := range addrs {
+		w.addrs[addr] = struct{}{}
+	}
+	if len(w.addrs)*watchlistBitsPerAddress > len(w.bloom)*64 {
+		// Grown past the size of the bloom filter
+		w.rebuild()
+		return
+	}
+	for _, addr := range addrs {
+		h := watchlistHash(addr)
+		w.bloom[h%uint64(len(w.bloom))] |= watchlistMask(h)
+	}
+}
+
+// Remove removes addrs from the watchlist.
+func (w *Watchlist) Remove(addrs ...common.Address) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, addr := range addrs {
+		if _, ok := w.addrs[addr]; ok {
+			delete(w.addrs, addr)
+			w.stale++
+		}
+	}
+	// Bloom filters cannot forget: rebuilt once most of the addresses left
+	if w.stale > len(w.addrs) && w.stale > 1024 {
+		w.rebuild()
+	}
+}
+
+// rebuild sizes the bloom filter for twice the addresses of the watchlist and
+// fills it.
+func (w *Watchlist) rebuild() {
+	words := max(2*len(w.addrs)*watchlistBitsPerAddress/64, 64)
+	w.bloom = make([]uint64, words)
+	for addr := range w.addrs {
+		h := watchlistHash(addr)
+		w.bloom[h%uint64(words)] |= watchlistMask(h)
+	}
+	w.stale = 0
+}
+
+// Contains reports whether addr is in the watchlist.
+func (w *Watchlist) Contains(addr common.Address) bool {
+	h := watchlistHash(addr)
+	mask := watchlistMask(h)
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.bloom[h%uint64(len(w.bloom))]&mask != mask {
+		return false
+	}
+	_, ok := w.addrs[addr]
+	return ok
+}
+
+// ContainsTopic reports whether topic is an address of the watchlist, left
+// padded with zeros as indexed address event arguments are.
+func (w *Watchlist) ContainsTopic(topic common.Hash) bool {
+	for _, b := range topic[:common.HashLength-common.AddressLength] {
+		if b != 0 {
+			return false
+		}
+	}
+	return w.Contains(common.BytesToAddress(topic[common.HashLength-common.AddressLength:]))
+}
+
+// Len returns the number of addresses of the watchlist.
+func (w *Watchlist) Len() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.addrs)
+}
+
+// Addresses returns the addresses of the watchlist, sorted.
+func (w *Watchlist) Addresses() []common.Address {
+	w.mu.RLock()
+	addrs := make([]common.Address, 0, len(w.addrs))
+	for addr := range w.addrs {
+		addrs = append(addrs, addr)
+	}
+	w.mu.RUnlock()
+	slices.SortFunc(addrs, func(a, b common.Address) int { return a.Cmp(b) })
+	return addrs
+}
+
+// watchlistHash mixes the bytes of addr, so that addresses sharing prefixes,
+// e.g. vanity ones, spread over the bloom filter.
+func watchlistHash(addr common.Address) uint64 {
+	h := mix64(uint64(binary.LittleEndian.Uint32(addr[16:])))
+	h = mix64(h ^ binary.LittleEndian.Uint64(addr[8:16]))
+	return mix64(h ^ binary.LittleEndian.Uint64(addr[:8]))
+}
+
+// mix64 is the finalizer of splitmix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// watchlistMask returns the 4 bits the address of hash h sets in its word of
+// the bloom filter, mixed again so that they do not depend on the word.
+func watchlistMask(h uint64) uint64 {
+	h = mix64(h)
+	return 1<<(h&63) | 1<<(h>>6&63) | 1<<(h>>12&63) | 1<<(h>>18&63)
+}
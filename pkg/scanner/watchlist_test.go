@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// watchlistAddress returns the address of the number i.
+func watchlistAddress(i int) common.Address {
+	return common.BigToAddress(big.NewInt(int64(i) + 1))
+}
+
+func TestWatchlist(t *testing.T) {
+	a, b := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), common.HexToAddress("0x1234")
+	w := NewWatchlist(a)
+	assert.True(t, w.Contains(a))
+	assert.False(t, w.Contains(b))
+
+	// Topics hold addresses left padded with zeros
+	assert.True(t, w.ContainsTopic(common.BytesToHash(a.Bytes())))
+	dirty := common.BytesToHash(a.Bytes())
+	dirty[0] = 1
+	assert.False(t, w.ContainsTopic(dirty))
+	assert.False(t, w.ContainsTopic(common.Hash{}))
+
+	w.Add(b, b)
+	assert.True(t, w.Contains(b))
+	assert.Equal(t, 2, w.Len())
+	w.Remove(a, common.HexToAddress("0x5678"))
+	assert.False(t, w.Contains(a))
+	assert.True(t, w.Contains(b))
+	assert.Equal(t, []common.Address{b}, w.Addresses())
+}
+
+func TestWatchlist_Resize(t *testing.T) {
+	// Grows past its bloom filter, and rebuilds it once most addresses left
+	w := NewWatchlist()
+	for i := range 10000 {
+		w.Add(watchlistAddress(i))
+	}
+	assert.Equal(t, 10000, w.Len())
+	for i := range 10000 {
+		assert.True(t, w.Contains(watchlistAddress(i)), i)
+	}
+	assert.False(t, w.Contains(watchlistAddress(10000)))
+
+	words := len(w.bloom)
+	for i := range 9000 {
+		w.Remove(watchlistAddress(i))
+	}
+	assert.Less(t, len(w.bloom), words)
+	for i := range 10000 {
+		assert.Equal(t, i >= 9000, w.Contains(watchlistAddress(i)), i)
+	}
+}
+
+func TestWatchlist_ReadWrite(t *testing.T) {
+	w, err := ReadWatchlist(strings.NewReader(`
+# Deposit addresses
+0xdAC17F958D2ee523a2206206994597C13D831ec7
+  0x0000000000000000000000000000000000001234  # Hot wallet
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, w.Len())
+
+	var buf bytes.Buffer
+	n, err := w.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	assert.Equal(t, "0x0000000000000000000000000000000000001234\n0xdAC17F958D2ee523a2206206994597C13D831ec7\n", buf.String())
+	read, err := ReadWatchlist(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, w.Addresses(), read.Addresses())
+
+	_, err = ReadWatchlist(strings.NewReader("0x1234\nnot-an-address\n"))
+	assert.EqualError(t, err, `watchlist line 1: invalid address "0x1234"`)
+}
+
+func TestWatchlist_Concurrent(t *testing.T) {
+	w := NewWatchlist()
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := range 2000 {
+				w.Add(watchlistAddress(g*2000 + i))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := range 2000 {
+				w.Contains(watchlistAddress(i))
+				if i%2 == 0 {
+					w.Remove(watchlistAddress(g*2000 + i))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	w.Remove(watchlistAddress(0))
+	assert.False(t, w.Contains(watchlistAddress(0)))
+	w.Add(watchlistAddress(0))
+	assert.True(t, w.Contains(watchlistAddress(0)))
+}
+
+func TestScanner_Watchlist(t *testing.T) {
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	a, b, c := watchlistAddress(1), watchlistAddress(2), watchlistAddress(3)
+	transferTo := func(to common.Address, index uint) types.Log {
+		return types.Log{Topics: []common.Hash{transfer, {}, common.BytesToHash(to.Bytes())}, Index: index}
+	}
+	client := new(MockRPC)
+	client.On("FilterLogs", mock.Anything, mock.MatchedBy(func(q ethereum.FilterQuery) bool {
+		return assert.ObjectsAreEqual([][]common.Hash{{transfer}}, q.Topics)
+	})).Return([]types.Log{transferTo(a, 0), transferTo(b, 1), transferTo(c, 2), {Topics: []common.Hash{transfer}, Index: 3}}, nil)
+
+	w := NewWatchlist(a)
+	s := New(client, new(MockStore), Config{BatchSize: 10}, NewFilter().SetTopic(0, transfer).Watch(2, w))
+	var handled []uint
+	s.SetHandler(func(ctx context.Context, logs []types.Log) error {
+		for _, l := range logs {
+			handled = append(handled, l.Index)
+		}
+		return nil
+	})
+	scan := func() []uint {
+		handled = nil
+		assert.NoError(t, s.scanRange(context.Background(), 100, 105))
+		return handled
+	}
+
+	// Updates apply from the next batch on, without replacing the filter
+	assert.Equal(t, []uint{0}, scan())
+	w.Add(b, c)
+	assert.Equal(t, []uint{0, 1, 2}, scan())
+	w.Remove(a, c)
+	assert.Equal(t, []uint{1}, scan())
+	w.Remove(b)
+	assert.Nil(t, scan())
+}
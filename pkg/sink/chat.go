@@ -0,0 +1,153 @@
+package sink
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/84hero/evm-scanner/internal/webhook"
+	"golang.org/x/time/rate"
+)
+
+// chatEvent is the chat-agnostic summary of a log shared by the Slack and
+// Telegram outputs.
+type chatEvent struct {
+	Name     string // Event name, "Log" when the log was not decoded
+	Contract string
+	Block    uint64
+	TxHash   string
+	TxURL    string      // Empty without an explorer
+	Inputs   []chatField // Decoded inputs sorted by name
+}
+
+type chatField struct {
+	Name  string
+	Value string
+}
+
+func newChatEvent(l DecodedLog, explorer string) chatEvent {
+	e := chatEvent{
+		Name:     l.EventName,
+		Contract: l.Log.Address.Hex(),
+		Block:    l.Log.BlockNumber,
+		TxHash:   l.Log.TxHash.Hex(),
+	}
+	if e.Name == "" {
+		e.Name = "Log"
+	}
+	if explorer != "" {
+		// Validated at construction, so this only fails for unknown kinds
+		e.TxURL, _ = explorerLink(explorer, "tx", e.TxHash)
+	}
+	if l.DecodedData != nil {
+		for name, v := range l.DecodedData.Inputs {
+			e.Inputs = append(e.Inputs, chatField{Name: name, Value: chatValue(v)})
+		}
+		sort.Slice(e.Inputs, func(i, j int) bool { return e.Inputs[i].Name < e.Inputs[j].Name })
+	}
+	return e
+}
+
+// chatValue renders a decoded ABI value for display.
+func chatValue(v interface{}) string {
+	switch x := v.(type) {
+	case *big.Int:
+		return x.String()
+	case []byte:
+		return "0x" + hex.EncodeToString(x)
+	case [32]byte:
+		return "0x" + hex.EncodeToString(x[:])
+	default:
+		return hexString(v)
+	}
+}
+
+// chatNotifier posts pre-built messages while honouring a per-destination
+// rate limit. Failed requests are retried by the webhook client.
+type chatNotifier struct {
+	client  *webhook.Client
+	limiter *rate.Limiter
+}
+
+func newChatNotifier(url string, perSecond float64) (*chatNotifier, error) {
+	client, err := webhook.NewClient(webhook.Config{URL: url, MaxAttempts: 3})
+	if err != nil {
+		return nil, err
+	}
+	return &chatNotifier{client: client, limiter: rate.NewLimiter(rate.Limit(perSecond), 1)}, nil
+}
+
+func (n *chatNotifier) post(ctx context.Context, body []byte) error {
+	if err := n.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return n.client.SendBody(ctx, body, "application/json")
+}
+
+// digestGroups splits logs into messages of at most size events (size <= 1
+// means one message per event).
+func digestGroups(logs []DecodedLog, size int) [][]DecodedLog {
+	if size < 1 {
+		size = 1
+	}
+	var groups [][]DecodedLog
+	for start := 0; start < len(logs); start += size {
+		end := start + size
+		if end > len(logs) {
+			end = len(logs)
+		}
+		groups = append(groups, logs[start:end])
+	}
+	return groups
+}
+
+// validateExplorer checks that explorer links can be built for a chain preset
+// name or base URL.
+func validateExplorer(explorer string) error {
+	if explorer == "" {
+		return nil
+	}
+	_, err := explorerLink(explorer, "tx", "")
+	return err
+}
+
+// plural returns "1 event" or "n events".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// markdownV2Special are the characters Telegram MarkdownV2 requires to be escaped.
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// escapeMarkdownV2 escapes text outside of code spans for Telegram MarkdownV2.
+func escapeMarkdownV2(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(markdownV2Special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeMarkdownV2Code escapes text inside `code` spans and link URLs, where
+// only the delimiters and backslashes are special.
+func escapeMarkdownV2Code(s string, delim rune) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == delim || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
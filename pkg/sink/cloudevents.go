@@ -0,0 +1,111 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CloudEvents modes of the webhook and Kafka outputs, see CloudEvent.
+const (
+	CloudEventsStructured = "structured" // One event per request or record
+	CloudEventsBatch      = "batch"      // A JSON array of events per request or record
+)
+
+// Content types of CloudEvents in structured and batched mode.
+const (
+	CloudEventsContentType      = "application/cloudevents+json"
+	CloudEventsBatchContentType = "application/cloudevents-batch+json"
+)
+
+// CloudEvent is the CloudEvents 1.0 JSON envelope of a DecodedLog.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`             // Transaction hash and log index, e.g. "0xab…-3"
+	Source          string          `json:"source"`         // Chain and contract, e.g. "eth-mainnet/0xdAC1…"
+	Type            string          `json:"type"`           // "evm.log." and the event name, "evm.log" if unknown
+	Time            string          `json:"time,omitempty"` // RFC 3339 block time, when known
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"` // The JSON encoding of the DecodedLog
+}
+
+// NewCloudEvent returns the CloudEvent of l. Its source is the chain id of l,
+// its numeric one if unset, and the contract address; its data the JSON
+// encoding of l, with normalized inputs.
+func NewCloudEvent(l DecodedLog) (CloudEvent, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return CloudEvent{}, err
+	}
+	chain := l.ChainID
+	if chain == "" && l.NumericChainID != 0 {
+		chain = strconv.FormatUint(l.NumericChainID, 10)
+	}
+	eventType := "evm.log"
+	if l.EventName != "" {
+		eventType += "." + l.EventName
+	}
+	event := CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              l.Log.TxHash.Hex() + "-" + strconv.FormatUint(uint64(l.Log.Index), 10),
+		Source:          strings.TrimPrefix(chain+"/"+l.Log.Address.Hex(), "/"),
+		Type:            eventType,
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	if l.Log.BlockTimestamp > 0 {
+		event.Time = time.Unix(int64(l.Log.BlockTimestamp), 0).UTC().Format(time.RFC3339)
+	}
+	return event, nil
+}
+
+// EncodeCloudEvents encodes logs as CloudEvents in mode: one body per log
+// with CloudEventsStructured, a single JSON array with CloudEventsBatch.
+func EncodeCloudEvents(logs []DecodedLog, mode string) ([][]byte, error) {
+	events := make([]CloudEvent, len(logs))
+	for i, l := range logs {
+		var err error
+		if events[i], err = NewCloudEvent(l); err != nil {
+			return nil, err
+		}
+	}
+	if mode == CloudEventsBatch {
+		body, err := json.Marshal(events)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{body}, nil
+	}
+	bodies := make([][]byte, len(events))
+	for i, event := range events {
+		var err error
+		if bodies[i], err = json.Marshal(event); err != nil {
+			return nil, err
+		}
+	}
+	return bodies, nil
+}
+
+// cloudEventsContentType returns the content type of the bodies of mode.
+func cloudEventsContentType(mode string) string {
+	if mode == CloudEventsBatch {
+		return CloudEventsBatchContentType
+	}
+	return CloudEventsContentType
+}
+
+// parseCloudEventsMode validates a CloudEvents mode, empty when disabled.
+func parseCloudEventsMode(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", nil
+	case strings.EqualFold(s, CloudEventsStructured):
+		return CloudEventsStructured, nil
+	case strings.EqualFold(s, CloudEventsBatch):
+		return CloudEventsBatch, nil
+	default:
+		return "", fmt.Errorf("unsupported cloudevents mode: %q", s)
+	}
+}
@@ -0,0 +1,217 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// assertCloudEvent checks raw against the CloudEvents 1.0 JSON format: the
+// required attributes, attribute naming, and the types of the optional ones.
+func assertCloudEvent(t *testing.T, raw []byte) map[string]json.RawMessage {
+	var attrs map[string]json.RawMessage
+	if !assert.NoError(t, json.Unmarshal(raw, &attrs)) {
+		return nil
+	}
+	name := regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+	for k := range attrs {
+		assert.Regexp(t, name, k)
+	}
+	str := func(k string) string {
+		var s string
+		assert.NoError(t, json.Unmarshal(attrs[k], &s), k)
+		return s
+	}
+	assert.Equal(t, "1.0", str("specversion"))
+	assert.NotEmpty(t, str("id"))
+	assert.NotEmpty(t, str("type"))
+	_, err := url.Parse(str("source"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, str("source"))
+	if _, ok := attrs["time"]; ok {
+		_, err := time.Parse(time.RFC3339, str("time"))
+		assert.NoError(t, err)
+	}
+	if _, ok := attrs["datacontenttype"]; ok {
+		assert.Equal(t, "application/json", str("datacontenttype"))
+		assert.True(t, json.Valid(attrs["data"]))
+	}
+	return attrs
+}
+
+func cloudEventsTestLog() DecodedLog {
+	return DecodedLog{
+		Log: types.Log{
+			Address:        common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"),
+			Topics:         []common.Hash{},
+			BlockNumber:    100,
+			BlockTimestamp: uint64(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Unix()),
+			TxHash:         common.HexToHash("0xabc"),
+			Index:          3,
+		},
+		DecodedData: &decoder.DecodedLog{Name: "Transfer", Inputs: map[string]interface{}{"value": big.NewInt(1e18)}},
+		EventName:   "Transfer",
+		ChainID:     "eth-mainnet",
+	}
+}
+
+func TestNewCloudEvent(t *testing.T) {
+	l := cloudEventsTestLog()
+	event, err := NewCloudEvent(l)
+	assert.NoError(t, err)
+	assert.Equal(t, l.Log.TxHash.Hex()+"-3", event.ID)
+	assert.Equal(t, "eth-mainnet/0xdAC17F958D2ee523a2206206994597C13D831ec7", event.Source)
+	assert.Equal(t, "evm.log.Transfer", event.Type)
+	assert.Equal(t, "2024-05-01T12:00:00Z", event.Time)
+
+	raw, err := json.Marshal(event)
+	assert.NoError(t, err)
+	attrs := assertCloudEvent(t, raw)
+
+	// The data is the normalized DecodedLog
+	var data struct {
+		Decoded struct{ Inputs map[string]interface{} } `json:"decoded"`
+	}
+	assert.NoError(t, json.Unmarshal(attrs["data"], &data))
+	assert.Equal(t, "1000000000000000000", data.Decoded.Inputs["value"])
+
+	// Unknown events, chains and block times
+	l = DecodedLog{Log: types.Log{Address: l.Log.Address, Topics: []common.Hash{}}, NumericChainID: 1}
+	event, err = NewCloudEvent(l)
+	assert.NoError(t, err)
+	assert.Equal(t, "1/0xdAC17F958D2ee523a2206206994597C13D831ec7", event.Source)
+	assert.Equal(t, "evm.log", event.Type)
+	raw, _ = json.Marshal(event)
+	_, ok := assertCloudEvent(t, raw)["time"]
+	assert.False(t, ok)
+
+	l.NumericChainID = 0
+	event, _ = NewCloudEvent(l)
+	assert.Equal(t, "0xdAC17F958D2ee523a2206206994597C13D831ec7", event.Source)
+}
+
+func TestEncodeCloudEvents(t *testing.T) {
+	logs := []DecodedLog{cloudEventsTestLog(), cloudEventsTestLog()}
+	logs[1].Log.Index = 4
+
+	bodies, err := EncodeCloudEvents(logs, CloudEventsStructured)
+	assert.NoError(t, err)
+	assert.Len(t, bodies, 2)
+	assert.Contains(t, string(assertCloudEvent(t, bodies[1])["id"]), "-4")
+
+	bodies, err = EncodeCloudEvents(logs, CloudEventsBatch)
+	assert.NoError(t, err)
+	assert.Len(t, bodies, 1)
+	var batch []json.RawMessage
+	assert.NoError(t, json.Unmarshal(bodies[0], &batch))
+	assert.Len(t, batch, 2)
+	for _, raw := range batch {
+		assertCloudEvent(t, raw)
+	}
+
+	mode, err := parseCloudEventsMode("Batch")
+	assert.NoError(t, err)
+	assert.Equal(t, CloudEventsBatch, mode)
+	_, err = parseCloudEventsMode("binary")
+	assert.Error(t, err)
+}
+
+func TestWebhookOutput_CloudEvents(t *testing.T) {
+	type request struct {
+		contentType string
+		body        []byte
+	}
+	var requests []request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{r.Header.Get("Content-Type"), body})
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	logs := []DecodedLog{cloudEventsTestLog(), cloudEventsTestLog()}
+
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, CloudEvents: CloudEventsStructured})
+	assert.NoError(t, err)
+	assert.NoError(t, wo.Send(context.Background(), logs))
+	assert.Len(t, requests, 2)
+	for _, r := range requests {
+		assert.Equal(t, CloudEventsContentType, r.contentType)
+		assertCloudEvent(t, r.body)
+	}
+
+	requests = nil
+	wo, err = NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, CloudEvents: CloudEventsBatch})
+	assert.NoError(t, err)
+	assert.NoError(t, wo.Send(context.Background(), logs))
+	assert.Len(t, requests, 1)
+	assert.Equal(t, CloudEventsBatchContentType, requests[0].contentType)
+	var batch []json.RawMessage
+	assert.NoError(t, json.Unmarshal(requests[0].body, &batch))
+	assert.Len(t, batch, 2)
+
+	_, err = NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, CloudEvents: "binary"})
+	assert.Error(t, err)
+	_, err = NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, CloudEvents: CloudEventsBatch, Encoder: func(logs []DecodedLog) ([][]byte, error) { return nil, nil }})
+	assert.Error(t, err)
+}
+
+func TestKafkaOutput_CloudEvents(t *testing.T) {
+	logs := []DecodedLog{cloudEventsTestLog(), cloudEventsTestLog()}
+
+	// One record per log, keyed and with headers as usual
+	producer := mocks.NewSyncProducer(t, nil)
+	for range logs {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			assert.Equal(t, CloudEventsContentType, headerMap(msg)["content-type"])
+			assert.Equal(t, "Transfer", headerMap(msg)["event_name"])
+			value, _ := msg.Value.Encode()
+			assertCloudEvent(t, value)
+			return nil
+		})
+	}
+	k := &KafkaOutput{producer: producer, topic: "events", partitionKey: KafkaKeyTxHash, cloudEvents: CloudEventsStructured}
+	assert.NoError(t, k.Send(context.Background(), logs))
+	assert.NoError(t, k.Close())
+
+	// One record per Send
+	producer = mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, map[string]string{"content-type": CloudEventsBatchContentType}, headerMap(msg))
+		key, _ := msg.Key.Encode()
+		assert.Equal(t, logs[0].Log.TxHash.Hex(), string(key))
+		value, _ := msg.Value.Encode()
+		var batch []json.RawMessage
+		assert.NoError(t, json.Unmarshal(value, &batch))
+		assert.Len(t, batch, 2)
+		return nil
+	})
+	k = &KafkaOutput{producer: producer, topic: "events", partitionKey: KafkaKeyTxHash, cloudEvents: CloudEventsBatch}
+	assert.NoError(t, k.Send(context.Background(), logs))
+	assert.NoError(t, k.Close())
+}
+
+func TestKafkaOutput_CloudEventsBatchDeadLetter(t *testing.T) {
+	var dead []DecodedLog
+	k, producer := newTestAsyncKafka(t, 10, false, func(l DecodedLog, err error) { dead = append(dead, l) })
+	k.cloudEvents = CloudEventsBatch
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+
+	// Every log of a failed batch record is dead-lettered
+	assert.NoError(t, k.Send(context.Background(), testLogs(3)))
+	assert.NoError(t, k.Close())
+	assert.Len(t, dead, 3)
+}
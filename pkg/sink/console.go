@@ -0,0 +1,177 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// ConsoleFormat selects how ConsoleOutput prints events.
+type ConsoleFormat string
+
+const (
+	// ConsoleJSON prints one JSON object per event (default).
+	ConsoleJSON ConsoleFormat = "json"
+	// ConsolePretty prints one "block | tx | event | key=value…" line per event.
+	ConsolePretty ConsoleFormat = "pretty"
+	// ConsoleTable prints events as aligned columns.
+	ConsoleTable ConsoleFormat = "table"
+)
+
+// ParseConsoleFormat converts a configuration value into a ConsoleFormat. Empty means ConsoleJSON.
+func ParseConsoleFormat(s string) (ConsoleFormat, error) {
+	switch ConsoleFormat(s) {
+	case "":
+		return ConsoleJSON, nil
+	case ConsoleJSON, ConsolePretty, ConsoleTable:
+		return ConsoleFormat(s), nil
+	default:
+		return "", fmt.Errorf("unsupported console format: %q", s)
+	}
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// ConsoleOutput implements the Output interface for printing events to stdout.
+type ConsoleOutput struct {
+	format   ConsoleFormat
+	w        io.Writer
+	maxWidth int
+	color    bool
+
+	mu          sync.Mutex
+	wroteHeader bool
+}
+
+// ConsoleOption configures a ConsoleOutput.
+type ConsoleOption func(*ConsoleOutput)
+
+// WithConsoleFormat sets the output format (default ConsoleJSON).
+func WithConsoleFormat(f ConsoleFormat) ConsoleOption {
+	return func(c *ConsoleOutput) { c.format = f }
+}
+
+// WithConsoleWriter prints to w instead of stdout, e.g. os.Stderr. Colors are
+// only used when w is a terminal unless WithConsoleColor says otherwise.
+func WithConsoleWriter(w io.Writer) ConsoleOption {
+	return func(c *ConsoleOutput) {
+		c.w = w
+		c.color = isTerminal(w)
+	}
+}
+
+// WithConsoleColor forces colors in the pretty format on or off.
+func WithConsoleColor(enabled bool) ConsoleOption {
+	return func(c *ConsoleOutput) { c.color = enabled }
+}
+
+// WithConsoleMaxFieldWidth truncates values longer than n characters in the
+// pretty and table formats, e.g. long bytes inputs. 0 disables truncation.
+func WithConsoleMaxFieldWidth(n int) ConsoleOption {
+	return func(c *ConsoleOutput) { c.maxWidth = n }
+}
+
+func NewConsoleOutput(opts ...ConsoleOption) *ConsoleOutput {
+	c := &ConsoleOutput{format: ConsoleJSON, w: os.Stdout, color: isTerminal(os.Stdout)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *ConsoleOutput) Name() string { return "console" }
+
+func (c *ConsoleOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.format {
+	case ConsolePretty:
+		return c.writePretty(logs)
+	case ConsoleTable:
+		return c.writeTable(logs)
+	default:
+		enc := json.NewEncoder(c.w)
+		for _, l := range logs {
+			if err := enc.Encode(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (c *ConsoleOutput) Close() error { return nil }
+
+func (c *ConsoleOutput) writePretty(logs []DecodedLog) error {
+	var b strings.Builder
+	for _, l := range logs {
+		e := newChatEvent(l, "")
+		fmt.Fprintf(&b, "%s | %s | %s |",
+			c.paint(ansiDim, fmt.Sprint(e.Block)),
+			shortHash(e.TxHash),
+			c.paint(ansiBold+ansiGreen, e.Name))
+		if len(e.Inputs) == 0 {
+			fmt.Fprintf(&b, " %s=%s", c.paint(ansiCyan, "contract"), e.Contract)
+		}
+		for _, f := range e.Inputs {
+			fmt.Fprintf(&b, " %s=%s", c.paint(ansiCyan, f.Name), c.truncate(f.Value))
+		}
+		b.WriteByte('\n')
+	}
+	_, err := io.WriteString(c.w, b.String())
+	return err
+}
+
+func (c *ConsoleOutput) writeTable(logs []DecodedLog) error {
+	tw := tabwriter.NewWriter(c.w, 0, 0, 2, ' ', 0)
+	if !c.wroteHeader {
+		fmt.Fprintln(tw, "BLOCK\tTX\tINDEX\tEVENT\tCONTRACT\tINPUTS")
+		c.wroteHeader = true
+	}
+	for _, l := range logs {
+		e := newChatEvent(l, "")
+		inputs := make([]string, len(e.Inputs))
+		for i, f := range e.Inputs {
+			inputs[i] = f.Name + "=" + c.truncate(f.Value)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\n",
+			e.Block, shortHash(e.TxHash), l.Log.Index, e.Name, shortHash(e.Contract), strings.Join(inputs, " "))
+	}
+	return tw.Flush()
+}
+
+func (c *ConsoleOutput) paint(code, s string) string {
+	if !c.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+func (c *ConsoleOutput) truncate(s string) string {
+	if c.maxWidth <= 0 || utf8.RuneCountInString(s) <= c.maxWidth {
+		return s
+	}
+	return string([]rune(s)[:max(c.maxWidth-1, 0)]) + "…"
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConsoleFormat(t *testing.T) {
+	f, err := ParseConsoleFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, ConsoleJSON, f)
+
+	f, err = ParseConsoleFormat("table")
+	assert.NoError(t, err)
+	assert.Equal(t, ConsoleTable, f)
+
+	_, err = ParseConsoleFormat("yaml")
+	assert.EqualError(t, err, `unsupported console format: "yaml"`)
+}
+
+func TestConsoleOutput_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewConsoleOutput(WithConsoleWriter(&buf))
+	l := transferLog()
+	l.Log.BlockNumber = 100
+	assert.NoError(t, c.Send(context.Background(), []DecodedLog{l, l}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	assert.Equal(t, "Transfer", got["event_name"])
+}
+
+func TestConsoleOutput_Pretty(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewConsoleOutput(WithConsoleWriter(&buf), WithConsoleFormat(ConsolePretty))
+	l := transferLog()
+	l.Log.BlockNumber = 100
+	assert.NoError(t, c.Send(context.Background(), []DecodedLog{l}))
+
+	assert.Equal(t, "100 | 0x5c50...2060 | Transfer | from=0x28C6c06298d514Db089934071355E5743bf21d60 to=0x21a31Ee1afC51d94C2eFcCAa2092aD1028285549 value=1500000000\n", buf.String())
+}
+
+func TestConsoleOutput_PrettyColor(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewConsoleOutput(WithConsoleWriter(&buf), WithConsoleFormat(ConsolePretty), WithConsoleColor(true))
+	assert.NoError(t, c.Send(context.Background(), []DecodedLog{transferLog()}))
+
+	assert.Contains(t, buf.String(), ansiBold+ansiGreen+"Transfer"+ansiReset)
+	assert.Contains(t, buf.String(), ansiCyan+"value"+ansiReset+"=1500000000")
+}
+
+func TestConsoleOutput_Table(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewConsoleOutput(WithConsoleWriter(&buf), WithConsoleFormat(ConsoleTable), WithConsoleMaxFieldWidth(10))
+	l := transferLog()
+	l.Log.BlockNumber = 100
+	l.Log.Index = 7
+	assert.NoError(t, c.Send(context.Background(), []DecodedLog{l}))
+	assert.NoError(t, c.Send(context.Background(), []DecodedLog{l}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3, "header is only written once")
+	assert.Equal(t, []string{"BLOCK", "TX", "INDEX", "EVENT", "CONTRACT", "INPUTS"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"100", "0x5c50...2060", "7", "Transfer", "0xdAC1...1ec7", "from=0x28C6c06…", "to=0x21a31Ee…", "value=1500000000"}, strings.Fields(lines[1]))
+	// Columns line up with the header
+	assert.Equal(t, strings.Index(lines[0], "EVENT"), strings.Index(lines[1], "Transfer"))
+}
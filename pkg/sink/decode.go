@@ -0,0 +1,237 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Decode statuses of a DecodedLog.
+const (
+	StatusDecoded      = "decoded"
+	StatusUnknownEvent = "unknown_event" // No registered event matches the log
+	StatusDecodeFailed = "decode_failed" // The event is known but the log does not fit it
+)
+
+// DecodeErrorPolicy decides what a Decoder does with the logs it cannot decode.
+type DecodeErrorPolicy string
+
+const (
+	// DecodeKeepRaw passes them on undecoded, with their DecodeStatus (default).
+	DecodeKeepRaw DecodeErrorPolicy = "keep-raw"
+	// DecodeDrop leaves them out of the batch.
+	DecodeDrop DecodeErrorPolicy = "drop"
+	// DecodeFail fails the batch, so that it is retried.
+	DecodeFail DecodeErrorPolicy = "error"
+)
+
+// ParseDecodeErrorPolicy converts a configuration value into a
+// DecodeErrorPolicy. Empty means DecodeKeepRaw.
+func ParseDecodeErrorPolicy(s string) (DecodeErrorPolicy, error) {
+	switch DecodeErrorPolicy(s) {
+	case "":
+		return DecodeKeepRaw, nil
+	case DecodeKeepRaw, DecodeDrop, DecodeFail:
+		return DecodeErrorPolicy(s), nil
+	default:
+		return "", fmt.Errorf("unsupported decode error policy: %q", s)
+	}
+}
+
+// DecoderConfig configures a Decoder.
+type DecoderConfig struct {
+	Registry      *decoder.Registry
+	Normalizer    *decoder.Normalizer // Adds token fields to the decoded events, optional
+	OnDecodeError DecodeErrorPolicy   // Default DecodeKeepRaw
+	// ChainID and NumericChainID tag the logs with the chain they were scanned from
+	ChainID        string
+	NumericChainID uint64
+
+	// Provenance attaches the scanner.Provenance of their batch to the logs
+	// decoded by DecodeContext.
+	Provenance bool
+}
+
+// DecodeStats counts the logs a Decoder went through.
+type DecodeStats struct {
+	Decoded       uint64
+	UnknownEvents uint64
+	Failures      uint64 // Logs of known events that failed to decode
+}
+
+// Decoder turns scanned logs into DecodedLogs, the input of outputs.
+type Decoder struct {
+	cfg      DecoderConfig
+	registry atomic.Pointer[decoder.Registry]
+
+	decoded atomic.Uint64
+	unknown atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// NewDecoderWithConfig creates a Decoder.
+func NewDecoderWithConfig(cfg DecoderConfig) (*Decoder, error) {
+	if cfg.Registry == nil {
+		return nil, errors.New("decoder registry is required")
+	}
+	policy, err := ParseDecodeErrorPolicy(string(cfg.OnDecodeError))
+	if err != nil {
+		return nil, err
+	}
+	cfg.OnDecodeError = policy
+	d := &Decoder{cfg: cfg}
+	d.registry.Store(cfg.Registry)
+	return d, nil
+}
+
+// SetRegistry replaces the registry logs are decoded with, also while Decode
+// runs: the next batch is decoded with it.
+func (d *Decoder) SetRegistry(registry *decoder.Registry) {
+	d.registry.Store(registry)
+}
+
+// Decode decodes logs, setting the DecodeStatus of each. The logs that cannot
+// be decoded are handled according to the DecodeErrorPolicy.
+func (d *Decoder) Decode(logs []types.Log) ([]DecodedLog, error) {
+	results, errs := d.registry.Load().DecodeBatch(logs)
+	failures := make(map[int]decoder.DecodeError, len(errs))
+	for _, e := range errs {
+		failures[e.Index] = e
+	}
+
+	decoded := make([]DecodedLog, 0, len(logs))
+	for i, l := range logs {
+		dl := DecodedLog{Log: l, ChainID: d.cfg.ChainID, NumericChainID: d.cfg.NumericChainID, DecodeStatus: StatusDecoded}
+		if err, failed := failures[i]; failed {
+			dl.DecodeError = err.Err.Error()
+			if errors.Is(err, decoder.ErrUnknownEvent) {
+				dl.DecodeStatus = StatusUnknownEvent
+				d.unknown.Add(1)
+			} else {
+				dl.DecodeStatus = StatusDecodeFailed
+				d.failed.Add(1)
+			}
+			switch d.cfg.OnDecodeError {
+			case DecodeFail:
+				return nil, err
+			case DecodeDrop:
+				continue
+			}
+		} else {
+			d.decoded.Add(1)
+			if d.cfg.Normalizer != nil {
+				d.cfg.Normalizer.Normalize(results[i], l)
+			}
+			dl.DecodedData = results[i]
+			dl.EventName = results[i].Name
+		}
+		decoded = append(decoded, dl)
+	}
+	return decoded, nil
+}
+
+// DecodeContext is Decode for the logs a scanner handler gets with ctx: they
+// are marked Unconfirmed in a tail handler, Replayed with a context of
+// WithReplayed, and given the Provenance of their batch if configured.
+func (d *Decoder) DecodeContext(ctx context.Context, logs []types.Log) ([]DecodedLog, error) {
+	decoded, err := d.Decode(logs)
+	if err != nil {
+		return nil, err
+	}
+	unconfirmed, replayed := scanner.Unconfirmed(ctx), Replayed(ctx)
+	var provenance *scanner.Provenance
+	if p, ok := scanner.BatchProvenance(ctx); ok && d.cfg.Provenance {
+		provenance = &p
+	}
+	for i := range decoded {
+		decoded[i].Unconfirmed = unconfirmed
+		decoded[i].Replayed = replayed
+		decoded[i].Provenance = provenance
+	}
+	return decoded, nil
+}
+
+// DecodedScanOnce returns the logs of the blocks from to to matching the
+// filter of s, see Scanner.ScanOnce, decoded with d.
+func DecodedScanOnce(ctx context.Context, s *scanner.Scanner, d *Decoder, from, to uint64) ([]DecodedLog, error) {
+	logs, err := s.ScanOnce(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return d.Decode(logs)
+}
+
+// Stats returns the counts of the logs decoded so far.
+func (d *Decoder) Stats() DecodeStats {
+	return DecodeStats{
+		Decoded:       d.decoded.Load(),
+		UnknownEvents: d.unknown.Load(),
+		Failures:      d.failed.Load(),
+	}
+}
+
+// decodedKey is the context key of the logs decoded by the Decode middleware.
+type decodedKey struct{}
+
+// DecodedHandler handles a batch of decoded logs, like a scanner.Handler.
+type DecodedHandler func(ctx context.Context, logs []DecodedLog) error
+
+// Decode returns the scanner middleware decoding every batch with d, failing it
+// on decode errors, and passing the decoded logs to the next handlers in their
+// context, see DecodedLogs.
+func Decode(d *Decoder) scanner.Middleware {
+	return func(next scanner.Handler) scanner.Handler {
+		return func(ctx context.Context, logs []types.Log) error {
+			decoded, err := d.DecodeContext(ctx, logs)
+			if err != nil {
+				return err
+			}
+			return next(context.WithValue(ctx, decodedKey{}, decoded), logs)
+		}
+	}
+}
+
+// DecodedLogs returns the logs decoded by the Decode middleware from the
+// context of a handler, nil without it.
+func DecodedLogs(ctx context.Context) []DecodedLog {
+	logs, _ := ctx.Value(decodedKey{}).([]DecodedLog)
+	return logs
+}
+
+// HandleDecoded returns the scanner handler passing the logs decoded with d to
+// h. Behind the Decode middleware, the logs it decoded are reused instead.
+// As a tail handler, the logs are marked Unconfirmed, and Replayed with a
+// context of WithReplayed.
+func HandleDecoded(d *Decoder, h DecodedHandler) scanner.Handler {
+	return func(ctx context.Context, logs []types.Log) error {
+		if decoded, ok := ctx.Value(decodedKey{}).([]DecodedLog); ok {
+			return h(ctx, decoded)
+		}
+		decoded, err := d.DecodeContext(ctx, logs)
+		if err != nil {
+			return err
+		}
+		return h(ctx, decoded)
+	}
+}
+
+// replayedKey is the context key marking the logs of a rescan.
+type replayedKey struct{}
+
+// WithReplayed returns ctx marking the logs decoded by the handlers it is
+// passed to as Replayed, e.g. the context of Scanner.BackfillSet reprocessing
+// blocks already delivered.
+func WithReplayed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replayedKey{}, true)
+}
+
+// Replayed reports whether ctx is marked by WithReplayed.
+func Replayed(ctx context.Context) bool {
+	replayed, _ := ctx.Value(replayedKey{}).(bool)
+	return replayed
+}
@@ -0,0 +1,194 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/rpc"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// decodeTestLogs returns an ERC20 transfer, a log of an unknown event and a
+// transfer whose data is truncated.
+func decodeTestLogs() []types.Log {
+	return []types.Log{
+		{TxHash: common.HexToHash("0x01"), Topics: []common.Hash{decoder.TopicERC20Transfer, {}, {}}, Data: common.LeftPadBytes(big.NewInt(5).Bytes(), 32)},
+		{TxHash: common.HexToHash("0x02"), Topics: []common.Hash{common.HexToHash("0xdead")}},
+		{TxHash: common.HexToHash("0x03"), Topics: []common.Hash{decoder.TopicERC20Transfer, {}, {}}, Data: []byte{1}},
+	}
+}
+
+func newTestDecoder(t *testing.T, policy DecodeErrorPolicy) *Decoder {
+	registry, err := decoder.NewStandardRegistry(decoder.ERC20)
+	assert.NoError(t, err)
+	d, err := NewDecoderWithConfig(DecoderConfig{Registry: registry, OnDecodeError: policy, ChainID: "eth", NumericChainID: 1})
+	assert.NoError(t, err)
+	return d
+}
+
+func TestDecoder_KeepRaw(t *testing.T) {
+	d := newTestDecoder(t, "")
+	logs, err := d.Decode(decodeTestLogs())
+	assert.NoError(t, err)
+	assert.Len(t, logs, 3)
+
+	assert.Equal(t, StatusDecoded, logs[0].DecodeStatus)
+	assert.Equal(t, "Transfer", logs[0].EventName)
+	assert.Equal(t, "eth", logs[0].ChainID)
+	assert.Empty(t, logs[0].DecodeError)
+
+	assert.Equal(t, StatusUnknownEvent, logs[1].DecodeStatus)
+	assert.Equal(t, "event signature not found in registry", logs[1].DecodeError)
+	assert.Empty(t, logs[1].EventName)
+	assert.Nil(t, logs[1].DecodedData)
+
+	assert.Equal(t, StatusDecodeFailed, logs[2].DecodeStatus)
+	assert.NotEmpty(t, logs[2].DecodeError)
+	assert.Equal(t, DecodeStats{Decoded: 1, UnknownEvents: 1, Failures: 1}, d.Stats())
+
+	data, err := json.Marshal(logs[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"decode_status":"unknown_event","decode_error":"event signature not found in registry"`)
+
+	match, err := ParseFilterExpr(`decode_status != "decoded"`)
+	assert.NoError(t, err)
+	assert.False(t, match(logs[0]))
+	assert.True(t, match(logs[2]))
+}
+
+func TestDecoder_SetRegistry(t *testing.T) {
+	d := newTestDecoder(t, "")
+	d.SetRegistry(decoder.NewRegistry())
+	logs, err := d.Decode(decodeTestLogs()[:1])
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, StatusUnknownEvent, logs[0].DecodeStatus)
+	}
+}
+
+func TestDecoder_Drop(t *testing.T) {
+	d := newTestDecoder(t, DecodeDrop)
+	logs, err := d.Decode(decodeTestLogs())
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, common.HexToHash("0x01"), logs[0].Log.TxHash)
+	}
+	assert.Equal(t, DecodeStats{Decoded: 1, UnknownEvents: 1, Failures: 1}, d.Stats())
+}
+
+func TestDecoder_Error(t *testing.T) {
+	d := newTestDecoder(t, DecodeFail)
+	_, err := d.Decode(decodeTestLogs())
+	assert.ErrorIs(t, err, decoder.ErrUnknownEvent)
+	assert.ErrorContains(t, err, "log 1 (tx 0x0000000000000000000000000000000000000000000000000000000000000002")
+
+	logs, err := d.Decode(decodeTestLogs()[:1])
+	assert.NoError(t, err)
+	assert.Len(t, logs, 1)
+
+	_, err = NewDecoderWithConfig(DecoderConfig{Registry: decoder.NewRegistry(), OnDecodeError: "skip"})
+	assert.EqualError(t, err, `unsupported decode error policy: "skip"`)
+	_, err = NewDecoderWithConfig(DecoderConfig{})
+	assert.Error(t, err)
+}
+
+func TestDecodeMiddleware(t *testing.T) {
+	d := newTestDecoder(t, DecodeDrop)
+	var got []DecodedLog
+	h := HandleDecoded(d, func(ctx context.Context, logs []DecodedLog) error {
+		assert.Equal(t, DecodedLogs(ctx), logs)
+		got = logs
+		return nil
+	})
+
+	// Behind Decode, the logs it decoded are reused
+	assert.NoError(t, Decode(d)(h)(context.Background(), decodeTestLogs()))
+	assert.Len(t, got, 1)
+	assert.Equal(t, "Transfer", got[0].EventName)
+	assert.Equal(t, DecodeStats{Decoded: 1, UnknownEvents: 1, Failures: 1}, d.Stats())
+
+	// On its own, the handler decodes them
+	got = nil
+	assert.Nil(t, DecodedLogs(context.Background()))
+	h = HandleDecoded(d, func(ctx context.Context, logs []DecodedLog) error {
+		got = logs
+		return nil
+	})
+	assert.NoError(t, h(context.Background(), decodeTestLogs()))
+	assert.Len(t, got, 1)
+	assert.Equal(t, DecodeStats{Decoded: 2, UnknownEvents: 2, Failures: 2}, d.Stats())
+
+	// A decode error fails the batch before the next handlers
+	d = newTestDecoder(t, DecodeFail)
+	called := false
+	err := Decode(d)(func(ctx context.Context, logs []types.Log) error {
+		called = true
+		return nil
+	})(context.Background(), decodeTestLogs())
+	assert.ErrorIs(t, err, decoder.ErrUnknownEvent)
+	assert.False(t, called)
+}
+
+// logsRPC answers eth_getLogs with logs, whatever the query, at block 100.
+type logsRPC struct {
+	rpc.Client
+	logs []types.Log
+}
+
+func (c logsRPC) BlockNumber(ctx context.Context) (uint64, error) { return 100, nil }
+
+func (c logsRPC) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return c.logs, nil
+}
+
+func TestDecodedScanOnce(t *testing.T) {
+	s := scanner.New(logsRPC{logs: decodeTestLogs()}, storage.NewMemoryStore(""), scanner.Config{}, scanner.NewFilter())
+	logs, err := DecodedScanOnce(context.Background(), s, newTestDecoder(t, DecodeDrop), 100, 109)
+	assert.NoError(t, err)
+	if assert.Len(t, logs, 1) {
+		assert.Equal(t, "Transfer", logs[0].EventName)
+	}
+
+	_, err = DecodedScanOnce(context.Background(), s, newTestDecoder(t, DecodeFail), 100, 109)
+	assert.ErrorIs(t, err, decoder.ErrUnknownEvent)
+}
+
+func TestHandleDecoded_Unconfirmed(t *testing.T) {
+	s := scanner.New(logsRPC{logs: decodeTestLogs()[:1]}, storage.NewMemoryStore(""), scanner.Config{
+		StartBlock:   101, // Nothing confirmed to scan
+		ReorgSafe:    5,
+		Interval:     time.Millisecond,
+		TailInterval: time.Millisecond,
+	}, scanner.NewFilter())
+	got := make(chan DecodedLog, 1)
+	s.SetTailHandler(HandleDecoded(newTestDecoder(t, ""), func(ctx context.Context, logs []DecodedLog) error {
+		select {
+		case got <- logs[0]:
+		default:
+		}
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Start(ctx) }()
+	l := <-got
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.True(t, l.Unconfirmed)
+	assert.Equal(t, "Transfer", l.EventName)
+
+	// Outputs writing JSON keep the mark
+	data, err := json.Marshal(l)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"unconfirmed":true`)
+}
@@ -0,0 +1,95 @@
+package sink
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DryRunOutput counts the events sent to it instead of delivering them, to
+// preview what filters match before pointing them at real outputs. It prints
+// a line for each of the first samples events of every event name, and
+// WriteReport the counts by contract and event.
+type DryRunOutput struct {
+	preview *ConsoleOutput
+	samples int
+
+	mu      sync.Mutex
+	counts  map[DryRunCount]uint64 // By DryRunCount without Count
+	printed map[string]int         // By event name
+}
+
+// DryRunCount is the number of events of an event name emitted by a contract.
+type DryRunCount struct {
+	ChainID  string
+	Contract common.Address
+	Event    string // "Log" for events that were not decoded
+	Count    uint64
+}
+
+// NewDryRunOutput returns a DryRunOutput printing to w the first samples
+// events of every event name, or all of them if samples is 0.
+func NewDryRunOutput(w io.Writer, samples int) *DryRunOutput {
+	return &DryRunOutput{
+		preview: NewConsoleOutput(WithConsoleFormat(ConsolePretty), WithConsoleWriter(w), WithConsoleMaxFieldWidth(66)),
+		samples: samples,
+		counts:  make(map[DryRunCount]uint64),
+		printed: make(map[string]int),
+	}
+}
+
+func (d *DryRunOutput) Name() string { return "dry-run" }
+
+func (d *DryRunOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	d.mu.Lock()
+	var sampled []DecodedLog
+	for _, l := range logs {
+		name := newChatEvent(l, "").Name
+		d.counts[DryRunCount{ChainID: l.ChainID, Contract: l.Log.Address, Event: name}]++
+		if d.samples <= 0 || d.printed[name] < d.samples {
+			d.printed[name]++
+			sampled = append(sampled, l)
+		}
+	}
+	d.mu.Unlock()
+	if len(sampled) == 0 {
+		return nil
+	}
+	return d.preview.Send(ctx, sampled)
+}
+
+func (d *DryRunOutput) Close() error { return nil }
+
+// Counts returns the events counted so far, by chain, contract and event name.
+func (d *DryRunOutput) Counts() []DryRunCount {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	counts := make([]DryRunCount, 0, len(d.counts))
+	for key, n := range d.counts {
+		key.Count = n
+		counts = append(counts, key)
+	}
+	slices.SortFunc(counts, func(a, b DryRunCount) int {
+		return cmp.Or(cmp.Compare(a.ChainID, b.ChainID), a.Contract.Cmp(b.Contract), cmp.Compare(a.Event, b.Event))
+	})
+	return counts
+}
+
+// WriteReport writes the Counts to w as a table, with their total.
+func (d *DryRunOutput) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHAIN\tCONTRACT\tEVENT\tCOUNT")
+	var total uint64
+	for _, c := range d.Counts() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", cmp.Or(c.ChainID, "-"), c.Contract.Hex(), c.Event, c.Count)
+		total += c.Count
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t\t%d\n", total)
+	return tw.Flush()
+}
@@ -0,0 +1,45 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunOutput(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewDryRunOutput(&buf, 2)
+	usdt, other := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"), common.HexToAddress("0x0b")
+	transfer := transferLog()
+	otherTransfer := transferLog()
+	otherTransfer.Log.Address = other
+	unknown := DecodedLog{Log: types.Log{Address: usdt, Topics: []common.Hash{}}}
+
+	assert.NoError(t, d.Send(context.Background(), []DecodedLog{transfer, transfer, otherTransfer}))
+	assert.NoError(t, d.Send(context.Background(), []DecodedLog{transfer, unknown}))
+
+	// Two Transfers and the unknown event are printed
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[2], "| Log | contract="+usdt.Hex())
+
+	assert.Equal(t, []DryRunCount{
+		{Contract: other, Event: "Transfer", Count: 1},
+		{Contract: usdt, Event: "Log", Count: 1},
+		{Contract: usdt, Event: "Transfer", Count: 3},
+	}, d.Counts())
+
+	buf.Reset()
+	assert.NoError(t, d.WriteReport(&buf))
+	assert.Equal(t, `CHAIN  CONTRACT                                    EVENT     COUNT
+-      0x000000000000000000000000000000000000000b  Transfer  1
+-      0xdAC17F958D2ee523a2206206994597C13D831ec7  Log       1
+-      0xdAC17F958D2ee523a2206206994597C13D831ec7  Transfer  3
+TOTAL                                                        5
+`, buf.String())
+}
@@ -0,0 +1,328 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// esDateLayout matches "{<go time layout>}" segments in an index name, e.g. "events-{2006.01.02}".
+var esDateLayout = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// ErrNoBlockTime is returned by outputs that place events by the time of their
+// block when a log has no BlockTimestamp.
+var ErrNoBlockTime = errors.New("log has no block timestamp")
+
+// ElasticsearchIndexDated reports whether an index name contains date layouts,
+// so that its logs need a block timestamp.
+func ElasticsearchIndexDated(index string) bool {
+	return esDateLayout.MatchString(index)
+}
+
+// ElasticsearchAuth holds credentials for ElasticsearchOutput.
+// APIKey takes precedence over basic auth when both are set.
+type ElasticsearchAuth struct {
+	Username string
+	Password string
+	APIKey   string
+}
+
+// ElasticsearchOutput implements the Output interface for indexing events into
+// Elasticsearch or OpenSearch through the _bulk API.
+type ElasticsearchOutput struct {
+	urls        []string
+	index       string
+	auth        ElasticsearchAuth
+	httpClient  *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	next        uint32 // Round-robin cursor over urls
+}
+
+// NewElasticsearchOutput initializes a new Elasticsearch/OpenSearch output sink.
+// index may contain Go time layouts in braces (e.g. "events-{2006.01.02}") which are
+// formatted with the block timestamp in UTC, so that a replayed event lands in
+// the index it was first written to. Sending a log without a block timestamp
+// to such an index fails with ErrNoBlockTime; see scanner.Config.BlockTimestamps.
+func NewElasticsearchOutput(urls []string, index string, auth ElasticsearchAuth) (*ElasticsearchOutput, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no elasticsearch urls provided")
+	}
+	if index == "" {
+		return nil, fmt.Errorf("elasticsearch index is required")
+	}
+	trimmed := make([]string, len(urls))
+	for i, u := range urls {
+		trimmed[i] = strings.TrimRight(u, "/")
+	}
+
+	e := &ElasticsearchOutput{
+		urls:        trimmed,
+		index:       index,
+		auth:        auth,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		maxAttempts: 3,
+		backoff:     500 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.ping(ctx); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *ElasticsearchOutput) Name() string { return "elasticsearch" }
+
+// esDocument is the flattened document indexed for each log.
+type esDocument struct {
+	Timestamp    string                 `json:"@timestamp,omitempty"`
+	BlockNumber  uint64                 `json:"block_number"`
+	BlockHash    string                 `json:"block_hash"`
+	TxHash       string                 `json:"tx_hash"`
+	TxIndex      uint                   `json:"tx_index"`
+	LogIndex     uint                   `json:"log_index"`
+	Address      string                 `json:"address"`
+	Topics       []string               `json:"topics"`
+	Data         string                 `json:"data"`
+	Removed      bool                   `json:"removed"`
+	EventName    string                 `json:"event_name,omitempty"`
+	ChainID      string                 `json:"chain_id,omitempty"`
+	DecodeStatus string                 `json:"decode_status,omitempty"`
+	DecodeError  string                 `json:"decode_error,omitempty"`
+	Decoded      map[string]interface{} `json:"decoded,omitempty"`
+}
+
+// esBulkItem is a single pending action of a bulk request.
+type esBulkItem struct {
+	meta []byte
+	doc  []byte
+}
+
+func (e *ElasticsearchOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	items := make([]esBulkItem, 0, len(logs))
+	for _, l := range logs {
+		item, err := e.buildItem(l)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	backoff := e.backoff
+	for attempt := 1; ; attempt++ {
+		failed, err := e.bulk(ctx, items)
+		if err == nil && len(failed) == 0 {
+			return nil
+		}
+		if err == nil {
+			// Only retry items rejected with a transient status
+			var retryable []esBulkItem
+			for _, f := range failed {
+				if !f.retryable {
+					return fmt.Errorf("elasticsearch bulk item failed: status %d: %s", f.status, f.reason)
+				}
+				retryable = append(retryable, items[f.pos])
+			}
+			items = retryable
+			err = fmt.Errorf("elasticsearch bulk: %d items failed: status %d: %s", len(failed), failed[0].status, failed[0].reason)
+		}
+		if attempt >= e.maxAttempts {
+			return fmt.Errorf("elasticsearch failed after %d attempts: %w", attempt, err)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (e *ElasticsearchOutput) Close() error {
+	e.httpClient.CloseIdleConnections()
+	return nil
+}
+
+func (e *ElasticsearchOutput) buildItem(l DecodedLog) (esBulkItem, error) {
+	var ts time.Time
+	doc := esDocument{
+		BlockNumber:  l.Log.BlockNumber,
+		BlockHash:    l.Log.BlockHash.Hex(),
+		TxHash:       l.Log.TxHash.Hex(),
+		TxIndex:      l.Log.TxIndex,
+		LogIndex:     l.Log.Index,
+		Address:      l.Log.Address.Hex(),
+		Topics:       make([]string, len(l.Log.Topics)),
+		Data:         fmt.Sprintf("0x%x", l.Log.Data),
+		Removed:      l.Log.Removed,
+		EventName:    l.EventName,
+		ChainID:      l.ChainID,
+		DecodeStatus: l.DecodeStatus,
+		DecodeError:  l.DecodeError,
+	}
+	if l.Log.BlockTimestamp > 0 {
+		ts = time.Unix(int64(l.Log.BlockTimestamp), 0).UTC()
+		doc.Timestamp = ts.Format(time.RFC3339)
+	}
+	for i, t := range l.Log.Topics {
+		doc.Topics[i] = t.Hex()
+	}
+	if l.DecodedData != nil {
+		doc.Decoded = NormalizeInputs(l.DecodedData.Inputs, l.NumberFormat())
+	}
+
+	index, err := e.indexName(ts)
+	if err != nil {
+		return esBulkItem{}, fmt.Errorf("%s:%d: %w", l.Log.TxHash.Hex(), l.Log.Index, err)
+	}
+	meta, err := json.Marshal(map[string]map[string]string{
+		"index": {
+			"_index": index,
+			"_id":    fmt.Sprintf("%s:%d", l.Log.TxHash.Hex(), l.Log.Index),
+		},
+	})
+	if err != nil {
+		return esBulkItem{}, err
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return esBulkItem{}, err
+	}
+	return esBulkItem{meta: meta, doc: body}, nil
+}
+
+// indexName formats the date layouts of the index with the block time t,
+// which is zero when the log has no block timestamp.
+func (e *ElasticsearchOutput) indexName(t time.Time) (string, error) {
+	if t.IsZero() && esDateLayout.MatchString(e.index) {
+		return "", ErrNoBlockTime
+	}
+	return esDateLayout.ReplaceAllStringFunc(e.index, func(m string) string {
+		return t.Format(m[1 : len(m)-1])
+	}), nil
+}
+
+// esFailedItem describes an item rejected within a bulk response.
+type esFailedItem struct {
+	pos       int
+	status    int
+	reason    string
+	retryable bool
+}
+
+// bulk sends items and returns the items the cluster rejected.
+// A non-nil error means the whole request failed and every item should be retried.
+func (e *ElasticsearchOutput) bulk(ctx context.Context, items []esBulkItem) ([]esFailedItem, error) {
+	var buf bytes.Buffer
+	for _, it := range items {
+		buf.Write(it.meta)
+		buf.WriteByte('\n')
+		buf.Write(it.doc)
+		buf.WriteByte('\n')
+	}
+
+	resp, err := e.do(ctx, http.MethodPost, "/_bulk", buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("decode bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+
+	var failed []esFailedItem
+	for i, item := range result.Items {
+		for _, res := range item {
+			if res.Status >= 200 && res.Status < 300 {
+				continue
+			}
+			failed = append(failed, esFailedItem{
+				pos:       i,
+				status:    res.Status,
+				reason:    string(res.Error),
+				retryable: res.Status == http.StatusTooManyRequests || res.Status >= 500,
+			})
+		}
+	}
+	return failed, nil
+}
+
+func (e *ElasticsearchOutput) ping(ctx context.Context) error {
+	resp, err := e.do(ctx, http.MethodGet, "/", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("elasticsearch ping: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// do sends the request to the next url, failing over to the others on transport errors.
+func (e *ElasticsearchOutput) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	start := atomic.AddUint32(&e.next, 1)
+	var lastErr error
+	for i := 0; i < len(e.urls); i++ {
+		base := e.urls[(int(start)+i)%len(e.urls)]
+		req, err := http.NewRequestWithContext(ctx, method, base+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/x-ndjson")
+		}
+		if e.auth.APIKey != "" {
+			req.Header.Set("Authorization", "ApiKey "+e.auth.APIKey)
+		} else if e.auth.Username != "" {
+			req.SetBasicAuth(e.auth.Username, e.auth.Password)
+		}
+
+		resp, err := e.httpClient.Do(req)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, lastErr
+}
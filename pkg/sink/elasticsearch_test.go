@@ -0,0 +1,170 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// bulkRequest captures the action/document pairs of a _bulk request.
+type bulkRequest struct {
+	meta []map[string]map[string]string
+	docs []map[string]interface{}
+}
+
+func parseBulk(t *testing.T, r *http.Request) bulkRequest {
+	var br bulkRequest
+	sc := bufio.NewScanner(r.Body)
+	for i := 0; sc.Scan(); i++ {
+		if i%2 == 0 {
+			var m map[string]map[string]string
+			assert.NoError(t, json.Unmarshal(sc.Bytes(), &m))
+			br.meta = append(br.meta, m)
+		} else {
+			var d map[string]interface{}
+			assert.NoError(t, json.Unmarshal(sc.Bytes(), &d))
+			br.docs = append(br.docs, d)
+		}
+	}
+	return br
+}
+
+func TestElasticsearchOutput_Send(t *testing.T) {
+	var got bulkRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "elastic", user)
+		assert.Equal(t, "changeme", pass)
+		got = parseBulk(t, r)
+		_, _ = w.Write([]byte(`{"errors":false,"items":[{"index":{"status":201}}]}`))
+	}))
+	defer ts.Close()
+
+	es, err := NewElasticsearchOutput([]string{ts.URL}, "events-{2006.01.02}", ElasticsearchAuth{Username: "elastic", Password: "changeme"})
+	assert.NoError(t, err)
+	assert.Equal(t, "elasticsearch", es.Name())
+
+	amount, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	logs := []DecodedLog{{
+		Log: types.Log{
+			BlockNumber:    100,
+			BlockTimestamp: uint64(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Unix()),
+			TxHash:         common.HexToHash("0xabc"),
+			Index:          7,
+		},
+		EventName:   "Transfer",
+		DecodedData: &decoder.DecodedLog{Name: "Transfer", Inputs: map[string]interface{}{"value": amount}},
+		ChainID:     "eth-mainnet",
+	}}
+	assert.NoError(t, es.Send(context.Background(), logs))
+
+	assert.Len(t, got.meta, 1)
+	assert.Equal(t, "events-2024.05.01", got.meta[0]["index"]["_index"])
+	assert.Equal(t, common.HexToHash("0xabc").Hex()+":7", got.meta[0]["index"]["_id"])
+	assert.Equal(t, "123456789012345678901234567890", got.docs[0]["decoded"].(map[string]interface{})["value"])
+	assert.Equal(t, "Transfer", got.docs[0]["event_name"])
+	assert.Equal(t, "eth-mainnet", got.docs[0]["chain_id"])
+	assert.NoError(t, es.Close())
+}
+
+func TestElasticsearchOutput_IndexByBlockTime(t *testing.T) {
+	var indexes []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		indexes = append(indexes, parseBulk(t, r).meta[0]["index"]["_index"])
+		_, _ = w.Write([]byte(`{"errors":false,"items":[{"index":{"status":201}}]}`))
+	}))
+	defer ts.Close()
+
+	es := &ElasticsearchOutput{urls: []string{ts.URL}, index: "events-{2006.01.02}", httpClient: ts.Client(), maxAttempts: 1}
+	l := DecodedLog{Log: types.Log{BlockNumber: 100, TxHash: common.HexToHash("0xabc"), Index: 7}}
+
+	// Without a block time the day is unknown: today's index would get a
+	// second copy of the document when it is replayed on another day
+	err := es.Send(context.Background(), []DecodedLog{l})
+	assert.ErrorIs(t, err, ErrNoBlockTime)
+	assert.Empty(t, indexes)
+
+	// Filled by the scanner, the same index however late the log is re-sent
+	l.Log.BlockTimestamp = uint64(time.Now().Add(-72 * time.Hour).Unix())
+	assert.NoError(t, es.Send(context.Background(), []DecodedLog{l}))
+	assert.NoError(t, es.Send(context.Background(), []DecodedLog{l}))
+	want := "events-" + time.Unix(int64(l.Log.BlockTimestamp), 0).UTC().Format("2006.01.02")
+	assert.Equal(t, []string{want, want}, indexes)
+
+	// Indexes without dates take any log
+	es.index = "events"
+	l.Log.BlockTimestamp = 0
+	assert.NoError(t, es.Send(context.Background(), []DecodedLog{l}))
+	assert.Equal(t, "events", indexes[2])
+}
+
+func TestElasticsearchOutput_RetryFailedItems(t *testing.T) {
+	var mu sync.Mutex
+	var calls []bulkRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		br := parseBulk(t, r)
+		mu.Lock()
+		calls = append(calls, br)
+		n := len(calls)
+		mu.Unlock()
+		if n == 1 {
+			_, _ = w.Write([]byte(`{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errors":false,"items":[{"index":{"status":201}}]}`))
+	}))
+	defer ts.Close()
+
+	es := &ElasticsearchOutput{urls: []string{ts.URL}, index: "events", httpClient: ts.Client(), maxAttempts: 3, backoff: time.Millisecond}
+	logs := []DecodedLog{
+		{Log: types.Log{TxHash: common.HexToHash("0x1"), Index: 1}},
+		{Log: types.Log{TxHash: common.HexToHash("0x2"), Index: 2}},
+	}
+	assert.NoError(t, es.Send(context.Background(), logs))
+
+	assert.Len(t, calls, 2)
+	assert.Len(t, calls[1].meta, 1)
+	assert.True(t, strings.HasSuffix(calls[1].meta[0]["index"]["_id"], ":2"))
+}
+
+func TestElasticsearchOutput_PermanentFailure(t *testing.T) {
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte(`{"errors":true,"items":[{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`))
+	}))
+	defer ts.Close()
+
+	es := &ElasticsearchOutput{urls: []string{ts.URL}, index: "events", httpClient: ts.Client(), maxAttempts: 3, backoff: time.Millisecond}
+	err := es.Send(context.Background(), []DecodedLog{{Log: types.Log{Index: 1}}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "mapper_parsing_exception")
+	assert.Equal(t, 1, calls)
+}
+
+func TestElasticsearchOutput_Init(t *testing.T) {
+	_, err := NewElasticsearchOutput(nil, "events", ElasticsearchAuth{})
+	assert.Error(t, err)
+
+	_, err = NewElasticsearchOutput([]string{"http://localhost:1"}, "events", ElasticsearchAuth{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,204 @@
+package sink
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NumberFormat selects how decoded integers are written in JSON.
+type NumberFormat string
+
+const (
+	// NumberDecimal writes big and 64-bit integers as decimal strings, smaller
+	// integers as JSON numbers (default).
+	NumberDecimal NumberFormat = "decimal"
+	// NumberHex writes every integer as a 0x-prefixed hex string.
+	NumberHex NumberFormat = "hex"
+)
+
+// ParseNumberFormat converts a configuration value into a NumberFormat. Empty means NumberDecimal.
+func ParseNumberFormat(s string) (NumberFormat, error) {
+	switch NumberFormat(s) {
+	case "":
+		return NumberDecimal, nil
+	case NumberDecimal, NumberHex:
+		return NumberFormat(s), nil
+	default:
+		return "", fmt.Errorf("unsupported number format: %q", s)
+	}
+}
+
+// WithNumberFormat wraps out so that the decoded integers of the logs it
+// writes are in format, see DecodedLog.NumberFormat. Outputs write
+// NumberDecimal otherwise.
+func WithNumberFormat(out Output, format NumberFormat) Output {
+	if format == "" || format == NumberDecimal {
+		return out
+	}
+	return WithTransform(out, func(l DecodedLog) (DecodedLog, bool) {
+		l.numbers = format
+		return l, true
+	})
+}
+
+// FormatNumbers returns copies of logs whose decoded integers are written in
+// format, for outputs written without WithNumberFormat.
+func FormatNumbers(logs []DecodedLog, format NumberFormat) []DecodedLog {
+	out := make([]DecodedLog, len(logs))
+	for i, l := range logs {
+		l.numbers = format
+		out[i] = l
+	}
+	return out
+}
+
+// NumberFormat returns the format of the decoded integers of l, set by
+// WithNumberFormat: custom sinks pass it to NormalizeInputs.
+func (l DecodedLog) NumberFormat() NumberFormat {
+	if l.numbers == "" {
+		return NumberDecimal
+	}
+	return l.numbers
+}
+
+// MarshalJSON encodes l with its decoded inputs normalized by NormalizeInputs
+// in its NumberFormat, so that values keep their precision in JavaScript
+// consumers.
+func (l DecodedLog) MarshalJSON() ([]byte, error) {
+	type decoded struct {
+		Name      string
+		Inputs    map[string]interface{}
+		Heuristic bool `json:",omitempty"`
+	}
+	// plain has the fields of DecodedLog without its MarshalJSON, the decoded
+	// field of out taking precedence over its own
+	type plain DecodedLog
+	out := struct {
+		plain
+		DecodedData *decoded `json:"decoded,omitempty"`
+	}{plain: plain(l)}
+	if l.DecodedData != nil {
+		out.DecodedData = &decoded{
+			Name:      l.DecodedData.Name,
+			Inputs:    NormalizeInputs(l.DecodedData.Inputs, l.NumberFormat()),
+			Heuristic: l.DecodedData.Heuristic,
+		}
+	}
+	return json.Marshal(out)
+}
+
+// NormalizeInputs converts values produced by the go-ethereum ABI unpacker into
+// JSON-safe ones: big integers become strings, addresses checksummed hex, byte
+// slices and arrays 0x-hex, and tuple structs maps keyed by their ABI names.
+func NormalizeInputs(inputs map[string]interface{}, format NumberFormat) map[string]interface{} {
+	if inputs == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(inputs))
+	for k, v := range inputs {
+		out[k] = normalizeValue(reflect.ValueOf(v), format)
+	}
+	return out
+}
+
+var (
+	bigIntType  = reflect.TypeOf(big.Int{})
+	addressType = reflect.TypeOf(common.Address{})
+	hashType    = reflect.TypeOf(common.Hash{})
+)
+
+func normalizeValue(v reflect.Value, format NumberFormat) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return normalizeValue(v.Elem(), format)
+	}
+
+	switch v.Type() {
+	case bigIntType:
+		n := new(big.Int)
+		if v.CanAddr() {
+			n = v.Addr().Interface().(*big.Int)
+		} else {
+			b := v.Interface().(big.Int)
+			n.Set(&b)
+		}
+		return formatBigInt(n, format)
+	case addressType:
+		return v.Interface().(common.Address).Hex()
+	case hashType:
+		return v.Interface().(common.Hash).Hex()
+	}
+
+	switch v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int, reflect.Int64:
+		if format == NumberHex || v.Kind() == reflect.Int64 || v.Kind() == reflect.Int {
+			return formatBigInt(big.NewInt(v.Int()), format)
+		}
+		return v.Int()
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		if format == NumberHex || v.Kind() == reflect.Uint64 || v.Kind() == reflect.Uint {
+			return formatBigInt(new(big.Int).SetUint64(v.Uint()), format)
+		}
+		return v.Uint()
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return "0x" + hex.EncodeToString(b)
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = normalizeValue(v.Index(i), format)
+		}
+		return out
+	case reflect.Struct:
+		// ABI tuples are anonymous structs whose json tags carry the ABI names
+		out := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name := f.Name
+			if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+				name = tag
+			}
+			out[name] = normalizeValue(v.Field(i), format)
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = normalizeValue(iter.Value(), format)
+		}
+		return out
+	default:
+		return v.Interface()
+	}
+}
+
+func formatBigInt(n *big.Int, format NumberFormat) string {
+	if format != NumberHex {
+		return n.String()
+	}
+	if n.Sign() < 0 {
+		return "-0x" + new(big.Int).Neg(n).Text(16)
+	}
+	return "0x" + n.Text(16)
+}
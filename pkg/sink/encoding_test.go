@@ -0,0 +1,187 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden files")
+
+const swapABI = `[{"anonymous":false,"name":"Swap","type":"event","inputs":[
+	{"indexed":true,"name":"sender","type":"address"},
+	{"indexed":false,"name":"result","type":"tuple","components":[
+		{"name":"amount0","type":"int256"},
+		{"name":"sqrtPriceX96","type":"uint160"},
+		{"name":"tick","type":"int24"},
+		{"name":"poolId","type":"bytes32"}
+	]},
+	{"indexed":false,"name":"fee","type":"uint24"},
+	{"indexed":false,"name":"data","type":"bytes"}
+]}]`
+
+// swapLog decodes a Swap event with int24/uint160 tuple fields through the real decoder.
+func swapLog(t *testing.T) DecodedLog {
+	parsed, err := abi.JSON(strings.NewReader(swapABI))
+	assert.NoError(t, err)
+	event := parsed.Events["Swap"]
+
+	sqrtPrice, _ := new(big.Int).SetString("1461446703485210103287273052203988822378723970341", 10)
+	type result struct {
+		Amount0      *big.Int
+		SqrtPriceX96 *big.Int
+		Tick         *big.Int
+		PoolId       [32]byte
+	}
+	data, err := event.Inputs.NonIndexed().Pack(
+		result{
+			Amount0:      big.NewInt(-123456789012345678),
+			SqrtPriceX96: sqrtPrice,
+			Tick:         big.NewInt(-887272),
+			PoolId:       common.HexToHash("0x01"),
+		},
+		big.NewInt(3000),
+		[]byte{0xde, 0xad, 0xbe, 0xef},
+	)
+	assert.NoError(t, err)
+
+	l := types.Log{
+		Address:     common.HexToAddress("0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640"),
+		Topics:      []common.Hash{event.ID, common.BytesToHash(common.HexToAddress("0xE592427A0AEce92De3Edee1F18E0157C05861564").Bytes())},
+		Data:        data,
+		BlockNumber: 19000000,
+		TxHash:      common.HexToHash("0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060"),
+		BlockHash:   common.HexToHash("0xaa"),
+		Index:       7,
+	}
+	dec, err := decoder.NewFromJSON(swapABI)
+	assert.NoError(t, err)
+	decoded, err := dec.Decode(l)
+	assert.NoError(t, err)
+	return DecodedLog{Log: l, DecodedData: decoded, EventName: decoded.Name}
+}
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		assert.NoError(t, os.WriteFile(path, got, 0o644))
+	}
+	want, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestDecodedLog_MarshalJSON(t *testing.T) {
+	l := swapLog(t)
+
+	t.Run("Decimal", func(t *testing.T) {
+		data, err := json.MarshalIndent(l, "", "  ")
+		assert.NoError(t, err)
+		assertGolden(t, "swap_decimal.golden", append(data, '\n'))
+	})
+
+	t.Run("Hex", func(t *testing.T) {
+		data, err := json.MarshalIndent(FormatNumbers([]DecodedLog{l}, NumberHex)[0], "", "  ")
+		assert.NoError(t, err)
+		assertGolden(t, "swap_hex.golden", append(data, '\n'))
+	})
+
+	t.Run("Undecoded", func(t *testing.T) {
+		data, err := json.Marshal(DecodedLog{Log: types.Log{Topics: []common.Hash{}}})
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), `"decoded"`)
+		assert.NotContains(t, string(data), `"event_name"`)
+		assert.NotContains(t, string(data), `"chain_id"`)
+	})
+
+	t.Run("Chain", func(t *testing.T) {
+		data, err := json.Marshal(DecodedLog{Log: types.Log{Topics: []common.Hash{}}, ChainID: "eth-mainnet", NumericChainID: 1})
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), `"chain_id":"eth-mainnet","numeric_chain_id":1`)
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		// Every field of DecodedLog is written, not only the decoded one
+		data, err := json.Marshal(DecodedLog{Log: types.Log{Topics: []common.Hash{}}, DecodeStatus: StatusUnknownEvent,
+			Unconfirmed: true, Replayed: true, Provenance: &scanner.Provenance{FromBlock: 1, ToBlock: 2}})
+		assert.NoError(t, err)
+		for _, field := range []string{`"decode_status":"unknown_event"`, `"unconfirmed":true`, `"replayed":true`, `"provenance":{"from_block":1`} {
+			assert.Contains(t, string(data), field)
+		}
+	})
+}
+
+func TestWithNumberFormat(t *testing.T) {
+	l := swapLog(t)
+	encode := func(format NumberFormat) Output {
+		return WithNumberFormat(&recordingOutput{fn: func(logs []DecodedLog) {
+			data, err := json.MarshalIndent(logs[0], "", "  ")
+			assert.NoError(t, err)
+			assertGolden(t, "swap_"+string(format)+".golden", append(data, '\n'))
+			assert.Equal(t, format, logs[0].NumberFormat())
+		}}, format)
+	}
+
+	// Outputs of different formats side by side, the batch left as is
+	batch := []DecodedLog{l}
+	assert.NoError(t, encode(NumberHex).Send(context.Background(), batch))
+	assert.NoError(t, encode(NumberDecimal).Send(context.Background(), batch))
+	assert.Equal(t, NumberDecimal, batch[0].NumberFormat())
+
+	out := &recordingOutput{}
+	assert.Same(t, out, WithNumberFormat(out, NumberDecimal))
+}
+
+func TestNormalizeInputs(t *testing.T) {
+	b := *big.NewInt(42)
+	in := map[string]interface{}{
+		"big":    b,
+		"small":  uint8(7),
+		"wide":   uint64(1 << 60),
+		"list":   []*big.Int{big.NewInt(1), nil},
+		"fixed":  [2]byte{0xab, 0xcd},
+		"hash":   common.HexToHash("0x01"),
+		"nested": [][]common.Address{{common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")}},
+	}
+
+	out := NormalizeInputs(in, NumberDecimal)
+	assert.Equal(t, "42", out["big"])
+	assert.Equal(t, uint64(7), out["small"])
+	assert.Equal(t, "1152921504606846976", out["wide"])
+	assert.Equal(t, []interface{}{"1", nil}, out["list"])
+	assert.Equal(t, "0xabcd", out["fixed"])
+	assert.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000001", out["hash"])
+	assert.Equal(t, []interface{}{[]interface{}{"0xdAC17F958D2ee523a2206206994597C13D831ec7"}}, out["nested"])
+
+	out = NormalizeInputs(in, NumberHex)
+	assert.Equal(t, "0x2a", out["big"])
+	assert.Equal(t, "0x7", out["small"])
+	assert.Equal(t, "0x1000000000000000", out["wide"])
+
+	assert.Nil(t, NormalizeInputs(nil, NumberDecimal))
+}
+
+func TestParseNumberFormat(t *testing.T) {
+	f, err := ParseNumberFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, NumberDecimal, f)
+
+	f, err = ParseNumberFormat("hex")
+	assert.NoError(t, err)
+	assert.Equal(t, NumberHex, f)
+
+	_, err = ParseNumberFormat("octal")
+	assert.Error(t, err)
+}
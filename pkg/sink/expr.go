@@ -0,0 +1,313 @@
+package sink
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// ParseFilterExpr compiles a filter expression into a predicate for WithFilter.
+//
+// An expression compares fields with literals, combined with && and || and
+// grouped with parentheses:
+//
+//	event_name == "Transfer" && value > 1e18
+//	address == 0xdAC17F958D2ee523a2206206994597C13D831ec7 || (block_number >= 19000000 && to != '0x0000000000000000000000000000000000000000')
+//
+// Fields are event_name, address, tx_hash, block_number and log_index; any
+// other name refers to a decoded input of the event. Comparisons with numeric
+// literals (decimal, hex or 1e18 notation) are numeric when the field is an
+// integer; otherwise only == and != are allowed and compare case-insensitively
+// as text. A comparison on a field the log does not have (e.g. an input of an
+// undecoded log) is false.
+func ParseFilterExpr(expr string) (func(DecodedLog) bool, error) {
+	p := &exprParser{input: expr}
+	if err := p.lex(); err != nil {
+		return nil, fmt.Errorf("filter expression: %w", err)
+	}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("filter expression: empty")
+	}
+	node, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q at position %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter expression: %w", err)
+	}
+	return node.eval, nil
+}
+
+type exprNode interface {
+	eval(l DecodedLog) bool
+}
+
+type exprAnd struct{ left, right exprNode }
+
+func (n exprAnd) eval(l DecodedLog) bool { return n.left.eval(l) && n.right.eval(l) }
+
+type exprOr struct{ left, right exprNode }
+
+func (n exprOr) eval(l DecodedLog) bool { return n.left.eval(l) || n.right.eval(l) }
+
+type exprCompare struct {
+	field string
+	op    string
+	text  string   // Literal as written, without quotes
+	num   *big.Int // Literal as an integer, nil for strings
+}
+
+func (c exprCompare) eval(l DecodedLog) bool {
+	v, ok := filterField(l, c.field)
+	if !ok {
+		return false
+	}
+	if c.num != nil {
+		if n, err := toBigInt(v); err == nil {
+			cmp := n.Cmp(c.num)
+			switch c.op {
+			case "==":
+				return cmp == 0
+			case "!=":
+				return cmp != 0
+			case ">":
+				return cmp > 0
+			case ">=":
+				return cmp >= 0
+			case "<":
+				return cmp < 0
+			default:
+				return cmp <= 0
+			}
+		}
+	}
+	switch c.op {
+	case "==":
+		return strings.EqualFold(hexString(v), c.text)
+	case "!=":
+		return !strings.EqualFold(hexString(v), c.text)
+	default:
+		return false // Ordering a non-numeric field
+	}
+}
+
+// filterField looks up a named field of l for filter expressions.
+func filterField(l DecodedLog, name string) (interface{}, bool) {
+	switch name {
+	case "event_name":
+		return l.EventName, true
+	case "decode_status":
+		return l.DecodeStatus, true
+	case "address":
+		return l.Log.Address, true
+	case "tx_hash":
+		return l.Log.TxHash, true
+	case "block_number":
+		return l.Log.BlockNumber, true
+	case "log_index":
+		return l.Log.Index, true
+	}
+	if l.DecodedData == nil {
+		return nil, false
+	}
+	v, ok := l.DecodedData.Inputs[name]
+	return v, ok
+}
+
+type exprTokenKind int
+
+const (
+	tokIdent exprTokenKind = iota
+	tokNumber
+	tokString
+	tokOp     // Comparison operator
+	tokAnd    // &&
+	tokOr     // ||
+	tokLParen // (
+	tokRParen // )
+)
+
+type exprToken struct {
+	kind   exprTokenKind
+	text   string
+	offset int
+}
+
+type exprParser struct {
+	input  string
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) lex() error {
+	s := p.input
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, exprToken{tokLParen, "(", i})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, exprToken{tokRParen, ")", i})
+			i++
+		case strings.HasPrefix(s[i:], "&&"):
+			p.tokens = append(p.tokens, exprToken{tokAnd, "&&", i})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			p.tokens = append(p.tokens, exprToken{tokOr, "||", i})
+			i += 2
+		case strings.ContainsRune("=!<>", rune(c)):
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			if op == "=" || op == "!" {
+				return fmt.Errorf("invalid operator %q at position %d, use == or !=", op, i)
+			}
+			p.tokens = append(p.tokens, exprToken{tokOp, op, i})
+			i += len(op)
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return fmt.Errorf("unterminated string at position %d", i)
+			}
+			p.tokens = append(p.tokens, exprToken{tokString, s[i+1 : i+1+end], i})
+			i += end + 2
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(s) && (isIdentByte(s[i]) || s[i] == '.') {
+				i++
+			}
+			p.tokens = append(p.tokens, exprToken{tokNumber, s[start:i], start})
+		case isIdentByte(c):
+			start := i
+			for i < len(s) && isIdentByte(s[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, exprToken{tokIdent, s[start:i], start})
+		default:
+			return fmt.Errorf("unexpected %q at position %d", c, i)
+		}
+	}
+	return nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokOr; t = p.peek() {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = exprOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.kind == tokAnd; t = p.peek() {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = exprAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseTerm() (exprNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	if t.kind == tokLParen {
+		open := t.offset
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != tokRParen {
+			return nil, fmt.Errorf("missing ) for ( at position %d", open)
+		}
+		p.pos++
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	field, op, lit := p.next(), p.next(), p.next()
+	switch {
+	case field == nil || field.kind != tokIdent:
+		return nil, p.expected("field name", field)
+	case op == nil || op.kind != tokOp:
+		return nil, p.expected("comparison operator", op)
+	case lit == nil || (lit.kind != tokNumber && lit.kind != tokString && lit.kind != tokIdent):
+		return nil, p.expected("value", lit)
+	}
+
+	c := exprCompare{field: field.text, op: op.text, text: lit.text}
+	if lit.kind == tokNumber {
+		n, err := parseExprNumber(lit.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", lit.text, lit.offset)
+		}
+		c.num = n
+	}
+	if c.num == nil && op.text != "==" && op.text != "!=" {
+		return nil, fmt.Errorf("operator %s at position %d needs a numeric value", op.text, op.offset)
+	}
+	return c, nil
+}
+
+func (p *exprParser) next() *exprToken {
+	t := p.peek()
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) expected(what string, got *exprToken) error {
+	if got == nil {
+		return fmt.Errorf("expected %s at end of expression", what)
+	}
+	return fmt.Errorf("expected %s at position %d, got %q", what, got.offset, got.text)
+}
+
+// parseExprNumber parses decimal, 0x-prefixed hex and exponent (1e18) integers.
+func parseExprNumber(s string) (*big.Int, error) {
+	if n, ok := new(big.Int).SetString(s, 0); ok {
+		return n, nil
+	}
+	f, ok := new(big.Float).SetPrec(256).SetString(s)
+	if !ok || !f.IsInt() {
+		return nil, fmt.Errorf("not an integer")
+	}
+	n, _ := f.Int(nil)
+	return n, nil
+}
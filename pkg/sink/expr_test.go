@@ -0,0 +1,80 @@
+package sink
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilterExpr(t *testing.T) {
+	transfer := transferLog() // 1500000000 USDT units from 0x28C6... to 0x21a3...
+	transfer.Log.BlockNumber = 100
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{`event_name == "Transfer"`, true},
+		{`event_name == 'transfer'`, true},
+		{`event_name != Transfer`, false},
+		{`value > 1000000000`, true},
+		{`value >= 1500000000 && value <= 1.5e9`, true},
+		{`value > 1e18`, false},
+		{`value == 0x59682f00`, true},
+		{`address == 0xdac17f958d2ee523a2206206994597c13d831ec7`, true},
+		{`from == "0x28C6c06298d514Db089934071355E5743bf21d60"`, true},
+		{`to != '0x0000000000000000000000000000000000000000'`, true},
+		{`block_number < 100 || log_index == 0`, true},
+		{`block_number < 100 || (log_index == 0 && value < 1)`, false},
+		{`(event_name == Approval || event_name == Transfer) && value > 1`, true},
+		{`owner == 0x1`, false},    // Missing input
+		{`from > 1`, false},        // Ordering a non-numeric field
+		{`event_name == 1`, false}, // Numeric literal on a text field compares as text
+	}
+	for _, c := range cases {
+		pred, err := ParseFilterExpr(c.expr)
+		if assert.NoError(t, err, c.expr) {
+			assert.Equal(t, c.want, pred(transfer), c.expr)
+		}
+	}
+
+	// Inputs of undecoded logs never match, whatever the operator
+	pred, err := ParseFilterExpr(`value != 0`)
+	assert.NoError(t, err)
+	assert.False(t, pred(DecodedLog{Log: types.Log{}}))
+
+	// Small integer ABI types compare numerically
+	pred, err = ParseFilterExpr(`decimals == 6`)
+	assert.NoError(t, err)
+	assert.True(t, pred(DecodedLog{DecodedData: &decoder.DecodedLog{Inputs: map[string]interface{}{"decimals": uint8(6)}}}))
+	pred, err = ParseFilterExpr(`amount < 0`)
+	assert.NoError(t, err)
+	assert.True(t, pred(DecodedLog{DecodedData: &decoder.DecodedLog{Inputs: map[string]interface{}{"amount": big.NewInt(-5)}}}))
+}
+
+func TestParseFilterExpr_Errors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`value`,
+		`value >`,
+		`value = 1`,
+		`!value`,
+		`value > "abc"`,
+		`event_name == Transfer &&`,
+		`(value > 1`,
+		`value > 1)`,
+		`value > 1.5`,
+		`event_name == "Transfer`,
+		`value > 1 # comment`,
+		`1 == value`,
+	} {
+		_, err := ParseFilterExpr(expr)
+		assert.Error(t, err, expr)
+	}
+
+	_, err := ParseFilterExpr(`value > 1 && (to == 0x1`)
+	assert.EqualError(t, err, "filter expression: missing ) for ( at position 13")
+}
@@ -0,0 +1,528 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Supported FileOutput formats.
+const (
+	FormatJSONL   = "jsonl"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// rotationTimeFormat is embedded into rotated file names. It sorts lexicographically
+// in chronological order, which retention pruning relies on.
+const rotationTimeFormat = "20060102T150405.000"
+
+// FileConfig holds the configuration for FileOutput.
+type FileConfig struct {
+	Path string
+	// Format is one of "jsonl" (default), "csv" or "parquet".
+	// CSV appends to Path; Parquet cannot be appended to, so every run (and every
+	// rotation) writes a new timestamped file next to Path.
+	Format string
+
+	// Rotation (all optional, zero disables the corresponding trigger)
+	MaxSize        int64         // Rotate once the active file reaches this many bytes
+	MaxAge         time.Duration // Rotate once the active file has been open this long
+	RotateOnSIGHUP bool          // Rotate when the process receives SIGHUP
+	Compress       bool          // Gzip rotated files (ignored for parquet, which is compressed internally)
+	MaxBackups     int           // Number of rotated files to keep, 0 keeps all
+}
+
+// FileOutput implements the Output interface for writing events to a file.
+type FileOutput struct {
+	cfg        FileConfig
+	mu         sync.Mutex
+	file       *os.File
+	activePath string
+	writer     recordWriter
+	size       int64
+	openedAt   time.Time
+
+	bgMu   sync.Mutex     // Serializes compression and pruning of rotated files
+	bgWG   sync.WaitGroup // Tracks in-flight compression/pruning
+	sighup chan os.Signal
+	done   chan struct{}
+
+	closeOnce sync.Once
+}
+
+// NewFileOutput initializes a new file-based output sink.
+func NewFileOutput(path string) (*FileOutput, error) {
+	return NewFileOutputWithConfig(FileConfig{Path: path})
+}
+
+// NewFileOutputWithConfig initializes a file-based output sink with rotation options.
+func NewFileOutputWithConfig(cfg FileConfig) (*FileOutput, error) {
+	switch cfg.Format {
+	case "":
+		cfg.Format = FormatJSONL
+	case FormatJSONL, FormatCSV, FormatParquet:
+	default:
+		return nil, fmt.Errorf("unsupported file format: %s", cfg.Format)
+	}
+
+	f := &FileOutput{cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	if cfg.RotateOnSIGHUP {
+		f.sighup = make(chan os.Signal, 1)
+		f.done = make(chan struct{})
+		signal.Notify(f.sighup, syscall.SIGHUP)
+		go f.watchSignals()
+	}
+
+	return f, nil
+}
+
+func (f *FileOutput) Name() string { return "file" }
+
+func (f *FileOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cfg.MaxAge > 0 && time.Since(f.openedAt) >= f.cfg.MaxAge && f.size > 0 {
+		if err := f.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	if err := f.writer.WriteLogs(logs); err != nil {
+		return err
+	}
+
+	if f.cfg.MaxSize > 0 && f.size >= f.cfg.MaxSize {
+		return f.rotateLocked()
+	}
+	return nil
+}
+
+// Rotate closes the active file, renames it with a timestamp suffix and opens a fresh one.
+// Parquet files are timestamped from the start, so they are only finalized.
+func (f *FileOutput) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotateLocked()
+}
+
+func (f *FileOutput) Close() error {
+	if f.done != nil {
+		f.closeOnce.Do(func() {
+			signal.Stop(f.sighup)
+			close(f.done)
+		})
+	}
+
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.writer.Close()
+		if syncErr := f.file.Sync(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+		if closeErr := f.file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.bgWG.Wait()
+	return err
+}
+
+func (f *FileOutput) open() error {
+	var (
+		path string
+		file *os.File
+		err  error
+	)
+	if f.cfg.Format == FormatParquet {
+		path, file, err = f.createTimestamped(time.Now())
+	} else {
+		path = f.cfg.Path
+		file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if info.IsDir() {
+		file.Close()
+		return fmt.Errorf("%s is a directory", path)
+	}
+	f.file = file
+	f.activePath = path
+	f.size = info.Size()
+	f.openedAt = time.Now()
+
+	w := &countingWriter{w: file, n: &f.size}
+	switch f.cfg.Format {
+	case FormatCSV:
+		f.writer, err = newCSVWriter(w, f.size == 0)
+	case FormatParquet:
+		f.writer = &parquetWriter{pw: parquet.NewGenericWriter[fileRow](w)}
+	default:
+		f.writer = &jsonlWriter{w: w}
+	}
+	if err != nil {
+		file.Close()
+		f.file = nil
+		return err
+	}
+	return nil
+}
+
+// createTimestamped creates a new, previously non-existent timestamped file.
+// Never truncating protects finalized files when two rotations share a timestamp:
+// the name moves on by a millisecond while it is taken, also by a compressed
+// backup, so that names keep sorting in rotation order.
+func (f *FileOutput) createTimestamped(t time.Time) (string, *os.File, error) {
+	for ; ; t = t.Add(time.Millisecond) {
+		path := f.rotatedName(t)
+		if _, err := os.Lstat(path + ".gz"); err == nil {
+			continue
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if !os.IsExist(err) {
+			return path, file, err
+		}
+	}
+}
+
+// rotateLocked must be called with f.mu held.
+func (f *FileOutput) rotateLocked() error {
+	if f.file == nil {
+		return fmt.Errorf("file output is closed")
+	}
+	if err := f.writer.Close(); err != nil {
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	// Parquet files are already timestamped and only need to be finalized
+	if f.cfg.Format == FormatParquet {
+		rotated := f.activePath
+		if err := f.open(); err != nil {
+			return err
+		}
+		f.bgWG.Add(1)
+		go f.finishRotation(rotated)
+		return nil
+	}
+
+	// Reserve a free name, then move the active file over the empty placeholder
+	rotated, placeholder, err := f.createTimestamped(time.Now())
+	if err == nil {
+		placeholder.Close()
+		if err = os.Rename(f.cfg.Path, rotated); err != nil {
+			os.Remove(rotated)
+		}
+	}
+	if err != nil {
+		// Keep writing to the original file rather than losing events
+		if openErr := f.open(); openErr != nil {
+			return fmt.Errorf("rotate: %v (reopen: %w)", err, openErr)
+		}
+		return fmt.Errorf("rotate: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.bgWG.Add(1)
+	go f.finishRotation(rotated)
+	return nil
+}
+
+// rotatedName returns "<dir>/<base>-<timestamp><ext>" for the active file path.
+func (f *FileOutput) rotatedName(t time.Time) string {
+	dir, base := filepath.Split(f.cfg.Path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	return filepath.Join(dir, fmt.Sprintf("%s-%s%s", stem, t.Format(rotationTimeFormat), ext))
+}
+
+// finishRotation compresses the rotated file (if enabled) and prunes old backups.
+func (f *FileOutput) finishRotation(rotated string) {
+	defer f.bgWG.Done()
+	f.bgMu.Lock()
+	defer f.bgMu.Unlock()
+
+	if f.cfg.Compress && f.cfg.Format != FormatParquet {
+		if err := gzipFile(rotated); err != nil {
+			fmt.Fprintf(os.Stderr, "[File Rotation Error] compress %s: %v\n", rotated, err)
+		}
+	}
+	if f.cfg.MaxBackups > 0 {
+		f.pruneBackups()
+	}
+}
+
+func (f *FileOutput) pruneBackups() {
+	dir, base := filepath.Split(f.cfg.Path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	matches, err := filepath.Glob(filepath.Join(dir, stem+"-*"+ext+"*"))
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, m := range matches {
+		if m == f.currentPath() {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(m), ".gz")
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, stem+"-"), ext)
+		if _, err := time.Parse(rotationTimeFormat, ts); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	if len(backups) <= f.cfg.MaxBackups {
+		return
+	}
+	sort.Strings(backups)
+	for _, old := range backups[:len(backups)-f.cfg.MaxBackups] {
+		_ = os.Remove(old)
+	}
+}
+
+func (f *FileOutput) currentPath() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.activePath
+}
+
+func (f *FileOutput) watchSignals() {
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-f.sighup:
+			if err := f.Rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "[File Rotation Error] %v\n", err)
+			}
+		}
+	}
+}
+
+// gzipFile compresses path into path.gz and removes the original.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// countingWriter tracks the number of bytes written to the active file.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// recordWriter encodes batches of logs in a specific file format.
+type recordWriter interface {
+	WriteLogs(logs []DecodedLog) error
+	// Close flushes any trailer (e.g. the Parquet footer); it does not close the file.
+	Close() error
+}
+
+// fileRow is the flat, one-row-per-log schema shared by the CSV and Parquet formats.
+type fileRow struct {
+	BlockNumber   uint64 `parquet:"block_number"`
+	BlockHash     string `parquet:"block_hash"`
+	TxHash        string `parquet:"tx_hash"`
+	LogIndex      uint32 `parquet:"log_index"`
+	Address       string `parquet:"address"`
+	EventName     string `parquet:"event_name"`
+	Topic0        string `parquet:"topic0"`
+	Topic1        string `parquet:"topic1"`
+	Topic2        string `parquet:"topic2"`
+	Topic3        string `parquet:"topic3"`
+	DataHex       string `parquet:"data_hex"`
+	DecodedInputs string `parquet:"decoded_inputs"`
+}
+
+var csvHeader = []string{
+	"block_number", "block_hash", "tx_hash", "log_index", "address", "event_name",
+	"topic0", "topic1", "topic2", "topic3", "data_hex", "decoded_inputs",
+}
+
+func newFileRow(l DecodedLog) (fileRow, error) {
+	row := fileRow{
+		BlockNumber: l.Log.BlockNumber,
+		BlockHash:   l.Log.BlockHash.Hex(),
+		TxHash:      l.Log.TxHash.Hex(),
+		LogIndex:    uint32(l.Log.Index),
+		Address:     l.Log.Address.Hex(),
+		EventName:   l.EventName,
+		DataHex:     "0x" + hex.EncodeToString(l.Log.Data),
+	}
+	topics := []*string{&row.Topic0, &row.Topic1, &row.Topic2, &row.Topic3}
+	for i, t := range l.Log.Topics {
+		if i >= len(topics) {
+			break
+		}
+		*topics[i] = t.Hex()
+	}
+	if l.DecodedData != nil {
+		inputs, err := json.Marshal(NormalizeInputs(l.DecodedData.Inputs, l.NumberFormat()))
+		if err != nil {
+			return row, err
+		}
+		row.DecodedInputs = string(inputs)
+	}
+	return row, nil
+}
+
+func (r fileRow) csvRecord() []string {
+	return []string{
+		strconv.FormatUint(r.BlockNumber, 10), r.BlockHash, r.TxHash,
+		strconv.FormatUint(uint64(r.LogIndex), 10), r.Address, r.EventName,
+		r.Topic0, r.Topic1, r.Topic2, r.Topic3, r.DataHex, r.DecodedInputs,
+	}
+}
+
+type jsonlWriter struct {
+	w io.Writer
+}
+
+func (j *jsonlWriter) WriteLogs(logs []DecodedLog) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, l := range logs {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	_, err := j.w.Write(buf.Bytes())
+	return err
+}
+
+func (j *jsonlWriter) Close() error { return nil }
+
+type csvWriter struct {
+	w io.Writer
+}
+
+// newCSVWriter writes the header only for new files so appends keep a single header.
+func newCSVWriter(w io.Writer, writeHeader bool) (*csvWriter, error) {
+	c := &csvWriter{w: w}
+	if writeHeader {
+		if err := c.write([][]string{csvHeader}); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *csvWriter) WriteLogs(logs []DecodedLog) error {
+	records := make([][]string, 0, len(logs))
+	for _, l := range logs {
+		row, err := newFileRow(l)
+		if err != nil {
+			return err
+		}
+		records = append(records, row.csvRecord())
+	}
+	return c.write(records)
+}
+
+func (c *csvWriter) write(records [][]string) error {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	_, err := c.w.Write(buf.Bytes())
+	return err
+}
+
+func (c *csvWriter) Close() error { return nil }
+
+type parquetWriter struct {
+	pw *parquet.GenericWriter[fileRow]
+}
+
+// WriteLogs writes one row group per batch.
+func (p *parquetWriter) WriteLogs(logs []DecodedLog) error {
+	rows := make([]fileRow, 0, len(logs))
+	for _, l := range logs {
+		row, err := newFileRow(l)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	if _, err := p.pw.Write(rows); err != nil {
+		return err
+	}
+	return p.pw.Flush()
+}
+
+func (p *parquetWriter) Close() error { return p.pw.Close() }
@@ -0,0 +1,261 @@
+package sink
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func testLogs(n int) []DecodedLog {
+	logs := make([]DecodedLog, n)
+	for i := range logs {
+		logs[i] = DecodedLog{Log: types.Log{Index: uint(i), Topics: []common.Hash{}}}
+	}
+	return logs
+}
+
+func TestFileOutput_RotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+
+	fo, err := NewFileOutputWithConfig(FileConfig{Path: path, MaxSize: 100})
+	assert.NoError(t, err)
+
+	assert.NoError(t, fo.Send(context.Background(), testLogs(3)))
+	assert.NoError(t, fo.Close())
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+	assert.Len(t, rotated, 1)
+
+	data, err := os.ReadFile(rotated[0])
+	assert.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 3)
+
+	// Fresh active file is created empty
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestFileOutput_RotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+
+	fo, err := NewFileOutputWithConfig(FileConfig{Path: path, MaxSize: 1, Compress: true})
+	assert.NoError(t, err)
+
+	assert.NoError(t, fo.Send(context.Background(), testLogs(1)))
+	assert.NoError(t, fo.Close())
+
+	plain, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+	assert.Empty(t, plain)
+	compressed, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl.gz"))
+	assert.Len(t, compressed, 1)
+
+	gz, err := os.Open(compressed[0])
+	assert.NoError(t, err)
+	defer gz.Close()
+	zr, err := gzip.NewReader(gz)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+
+	var decoded DecodedLog
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, uint(0), decoded.Log.Index)
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestFileOutput_MaxBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+
+	fo, err := NewFileOutputWithConfig(FileConfig{Path: path, MaxSize: 1, MaxBackups: 2})
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, fo.Send(context.Background(), testLogs(1)))
+		time.Sleep(2 * time.Millisecond) // Distinct rotation timestamps
+	}
+	assert.NoError(t, fo.Close())
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+	assert.Len(t, rotated, 2)
+}
+
+func TestFileOutput_RotateSameMillisecond(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "events.jsonl")
+		fo, err := NewFileOutputWithConfig(FileConfig{Path: path, Compress: compress})
+		assert.NoError(t, err)
+
+		// Back-to-back rotations share their timestamp, and a backup may be
+		// compressed already: none of them is overwritten
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, fo.Send(context.Background(), testLogs(1)))
+			assert.NoError(t, fo.Rotate())
+		}
+		assert.NoError(t, fo.Close())
+
+		rotated, _ := filepath.Glob(filepath.Join(dir, "events-*"))
+		assert.Len(t, rotated, 5, "compress: %v", compress)
+	}
+}
+
+func TestFileOutput_CloseTwice(t *testing.T) {
+	fo, err := NewFileOutputWithConfig(FileConfig{Path: filepath.Join(t.TempDir(), "events.jsonl"), RotateOnSIGHUP: true})
+	assert.NoError(t, err)
+	assert.NoError(t, fo.Close())
+	assert.NoError(t, fo.Close())
+}
+
+func TestFileOutput_RotateByAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+
+	fo, err := NewFileOutputWithConfig(FileConfig{Path: path, MaxAge: 10 * time.Millisecond})
+	assert.NoError(t, err)
+
+	assert.NoError(t, fo.Send(context.Background(), testLogs(1)))
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, fo.Send(context.Background(), testLogs(1)))
+	assert.NoError(t, fo.Close())
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+	assert.Len(t, rotated, 1)
+}
+
+func TestFileOutput_ManualRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events")
+
+	fo, err := NewFileOutput(path)
+	assert.NoError(t, err)
+	assert.NoError(t, fo.Send(context.Background(), testLogs(1)))
+	assert.NoError(t, fo.Rotate())
+	assert.NoError(t, fo.Close())
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "events-*"))
+	assert.Len(t, rotated, 1)
+	assert.Error(t, fo.Rotate())
+}
+
+func formatTestLogs() []DecodedLog {
+	return []DecodedLog{
+		{
+			Log: types.Log{
+				BlockNumber: 100,
+				TxHash:      common.HexToHash("0xabc"),
+				Index:       1,
+				Address:     common.HexToAddress("0x1111111111111111111111111111111111111111"),
+				Topics:      []common.Hash{common.HexToHash("0xaa"), common.HexToHash("0xbb")},
+				Data:        []byte{0x01, 0x02},
+			},
+			EventName:   "Transfer",
+			DecodedData: &decoder.DecodedLog{Name: "Transfer", Inputs: map[string]interface{}{"value": "1"}},
+		},
+		{Log: types.Log{BlockNumber: 101, Index: 2}},
+	}
+}
+
+func TestFileOutput_CSV(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.csv")
+
+	fo, err := NewFileOutputWithConfig(FileConfig{Path: path, Format: FormatCSV})
+	assert.NoError(t, err)
+	assert.NoError(t, fo.Send(context.Background(), formatTestLogs()))
+	assert.NoError(t, fo.Close())
+
+	// Reopening appends rows without repeating the header
+	fo, err = NewFileOutputWithConfig(FileConfig{Path: path, Format: FormatCSV})
+	assert.NoError(t, err)
+	assert.NoError(t, fo.Send(context.Background(), formatTestLogs()[:1]))
+	assert.NoError(t, fo.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, csvHeader, records[0])
+
+	first := records[1]
+	assert.Equal(t, "100", first[0])
+	assert.Equal(t, common.HexToHash("0xabc").Hex(), first[2])
+	assert.Equal(t, "1", first[3])
+	assert.Equal(t, "Transfer", first[5])
+	assert.Equal(t, common.HexToHash("0xaa").Hex(), first[6])
+	assert.Equal(t, "", first[8])
+	assert.Equal(t, "0x0102", first[10])
+	assert.JSONEq(t, `{"value":"1"}`, first[11])
+	assert.Equal(t, "", records[2][11])
+}
+
+func TestFileOutput_Parquet(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.parquet")
+
+	fo, err := NewFileOutputWithConfig(FileConfig{Path: path, Format: FormatParquet})
+	assert.NoError(t, err)
+	assert.NoError(t, fo.Send(context.Background(), formatTestLogs()))
+	assert.NoError(t, fo.Send(context.Background(), formatTestLogs()[:1]))
+	assert.NoError(t, fo.Close())
+
+	// Each run writes its own timestamped file
+	files, _ := filepath.Glob(filepath.Join(dir, "events-*.parquet"))
+	assert.Len(t, files, 1)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	rows, err := parquet.ReadFile[fileRow](files[0])
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, uint64(100), rows[0].BlockNumber)
+	assert.Equal(t, "Transfer", rows[0].EventName)
+	assert.Equal(t, common.HexToHash("0xbb").Hex(), rows[0].Topic1)
+	assert.JSONEq(t, `{"value":"1"}`, rows[0].DecodedInputs)
+	assert.Equal(t, uint64(101), rows[1].BlockNumber)
+}
+
+func TestFileOutput_ParquetRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.parquet")
+
+	fo, err := NewFileOutputWithConfig(FileConfig{Path: path, Format: FormatParquet})
+	assert.NoError(t, err)
+	assert.NoError(t, fo.Send(context.Background(), formatTestLogs()))
+	assert.NoError(t, fo.Rotate())
+	assert.NoError(t, fo.Send(context.Background(), formatTestLogs()))
+	assert.NoError(t, fo.Close())
+
+	files, _ := filepath.Glob(filepath.Join(dir, "events-*.parquet"))
+	assert.Len(t, files, 2)
+	for _, file := range files {
+		rows, err := parquet.ReadFile[fileRow](file)
+		assert.NoError(t, err)
+		assert.Len(t, rows, 2)
+	}
+}
+
+func TestFileOutput_UnsupportedFormat(t *testing.T) {
+	_, err := NewFileOutputWithConfig(FileConfig{Path: filepath.Join(t.TempDir(), "x"), Format: "xml"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package sink
+
+import "context"
+
+// filterOutput forwards only the logs accepted by a predicate.
+type filterOutput struct {
+	Output
+	pred func(DecodedLog) bool
+}
+
+// WithFilter wraps out so that it only receives logs for which pred returns
+// true, e.g. to route large transfers to a chat sink. A batch left empty by the
+// filter is not sent at all. See ParseFilterExpr for building pred from a
+// configuration string.
+func WithFilter(out Output, pred func(DecodedLog) bool) Output {
+	f := &filterOutput{Output: out, pred: pred}
+	if raw, ok := out.(RawSender); ok {
+		return &rawFilterOutput{filterOutput: f, raw: raw}
+	}
+	return f
+}
+
+func (f *filterOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	kept := make([]DecodedLog, 0, len(logs))
+	for _, l := range logs {
+		if f.pred(l) {
+			kept = append(kept, l)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return f.Output.Send(ctx, kept)
+}
+
+// rawFilterOutput is a filterOutput over a RawSender, so that a filtered output
+// can still be wrapped by WithTemplate.
+type rawFilterOutput struct {
+	*filterOutput
+	raw RawSender
+}
+
+// SendRaw filters logs together with their rendered payloads.
+func (f *rawFilterOutput) SendRaw(ctx context.Context, logs []DecodedLog, payloads [][]byte) error {
+	keptLogs := make([]DecodedLog, 0, len(logs))
+	keptPayloads := make([][]byte, 0, len(payloads))
+	for i, l := range logs {
+		if f.pred(l) {
+			keptLogs = append(keptLogs, l)
+			keptPayloads = append(keptPayloads, payloads[i])
+		}
+	}
+	if len(keptLogs) == 0 {
+		return nil
+	}
+	return f.raw.SendRaw(ctx, keptLogs, keptPayloads)
+}
+
+// transformOutput rewrites or drops logs before forwarding them.
+type transformOutput struct {
+	Output
+	fn func(DecodedLog) (DecodedLog, bool)
+}
+
+// WithTransform wraps out so that every log is passed through fn first. fn
+// returns the log to send and false to drop it. A batch left empty is not
+// sent. To render transformed logs with a template, apply WithTemplate first:
+// WithTransform(WithTemplate(out, tmpl), fn).
+func WithTransform(out Output, fn func(DecodedLog) (DecodedLog, bool)) Output {
+	return &transformOutput{Output: out, fn: fn}
+}
+
+func (t *transformOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	out := make([]DecodedLog, 0, len(logs))
+	for _, l := range logs {
+		if l, ok := t.fn(l); ok {
+			out = append(out, l)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return t.Output.Send(ctx, out)
+}
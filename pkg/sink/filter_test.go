@@ -0,0 +1,78 @@
+package sink
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFilter(t *testing.T) {
+	f := &fakeOutput{name: "slack"}
+	out := WithFilter(f, func(l DecodedLog) bool { return l.Log.Index%2 == 0 })
+	assert.Equal(t, "slack", out.Name())
+
+	assert.NoError(t, out.Send(context.Background(), testLogs(5)))
+	assert.Equal(t, 3, f.sent)
+
+	// Empty post-filter batches are not sent
+	f.err = assert.AnError
+	out = WithFilter(f, func(DecodedLog) bool { return false })
+	assert.NoError(t, out.Send(context.Background(), testLogs(3)))
+	assert.Equal(t, 3, f.sent)
+
+	assert.ErrorIs(t, out.Close(), assert.AnError)
+	assert.True(t, f.closed)
+}
+
+func TestWithFilter_Template(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	filtered := WithFilter(&RedisOutput{client: db, key: "k"}, func(l DecodedLog) bool { return l.Log.Index == 1 })
+	out, err := WithTemplate(filtered, `log {{.Log.Index}}`)
+	assert.NoError(t, err)
+
+	mock.ExpectLPush("k", []byte("log 1")).SetVal(1)
+	assert.NoError(t, out.Send(context.Background(), testLogs(3)))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// A filtered structured output still ignores the template
+	f := &fakeOutput{name: "postgres"}
+	out, err = WithTemplate(WithFilter(f, func(l DecodedLog) bool { return l.Log.Index > 0 }), `{{.EventName}}`)
+	assert.NoError(t, err)
+	assert.NoError(t, out.Send(context.Background(), testLogs(3)))
+	assert.Equal(t, 2, f.sent)
+}
+
+func TestWithTransform(t *testing.T) {
+	var got []DecodedLog
+	rec := &recordingOutput{fn: func(logs []DecodedLog) { got = logs }}
+	out := WithTransform(rec, func(l DecodedLog) (DecodedLog, bool) {
+		if l.Log.Index == 0 {
+			return l, false
+		}
+		l.EventName = "Renamed"
+		return l, true
+	})
+
+	logs := testLogs(3)
+	assert.NoError(t, out.Send(context.Background(), logs))
+	assert.Len(t, got, 2)
+	assert.Equal(t, "Renamed", got[0].EventName)
+	assert.Equal(t, "", logs[1].EventName) // Input batch untouched
+
+	got = nil
+	assert.NoError(t, out.Send(context.Background(), testLogs(1)))
+	assert.Nil(t, got)
+}
+
+// recordingOutput hands every batch to fn.
+type recordingOutput struct {
+	fakeOutput
+	fn func([]DecodedLog)
+}
+
+func (r *recordingOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	r.fn(logs)
+	return nil
+}
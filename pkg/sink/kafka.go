@@ -0,0 +1,474 @@
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// Kafka partition key strategies.
+const (
+	KafkaKeyTxHash  = "txHash"  // All logs of a transaction land on the same partition
+	KafkaKeyAddress = "address" // Per-contract ordering
+	KafkaKeyTopic0  = "topic0"  // Per-event-signature ordering
+)
+
+// KafkaConfig holds the configuration for KafkaOutput.
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+
+	// Authentication
+	User          string
+	Password      string
+	SASLMechanism string // "PLAIN" (default when User is set), "SCRAM-SHA-256" or "SCRAM-SHA-512"
+
+	// TLS
+	TLS                bool
+	TLSCAFile          string // PEM CA bundle, system roots when empty
+	InsecureSkipVerify bool
+
+	// Producer tuning (zero values keep sarama defaults)
+	Acks           string        // "all", "leader" (default) or "none"
+	Compression    string        // "none" (default), "gzip", "snappy", "lz4" or "zstd"
+	Idempotent     bool          // Exactly-once per partition across broker failovers, implies acks=all
+	FlushBytes     int           // Best-effort batch size in bytes
+	FlushMessages  int           // Best-effort batch size in messages
+	FlushFrequency time.Duration // Best-effort batch linger time
+
+	PartitionKey string // KafkaKeyTxHash (default), KafkaKeyAddress or KafkaKeyTopic0
+	ChainID      string // "chain_id" record header for logs without DecodedLog.ChainID
+
+	// CloudEvents writes the records as CloudEvents in structured mode, with
+	// a "content-type" header: one per log with CloudEventsStructured, one per
+	// Send with CloudEventsBatch, keyed by its first log.
+	CloudEvents string
+
+	// Async mode: Send returns once messages are queued instead of after broker acks.
+	// Messages failing after that are only reported to DeadLetter and
+	// DeadLetterOutput: without the latter, delivery is at most once.
+	Async       bool
+	QueueSize   int            // Max messages awaiting acks (default 1000)
+	BlockOnFull bool           // Block Send while the queue is full instead of returning ErrKafkaQueueFull
+	DeadLetter  DeadLetterFunc // Receives messages that failed delivery, logged to stderr when nil
+
+	// DeadLetterOutput receives the events of messages that failed delivery in
+	// async mode, e.g. a FileOutput to replay them from. Closed by Close.
+	DeadLetterOutput Output
+}
+
+// ErrKafkaQueueFull is returned by an async KafkaOutput when its queue cannot take the
+// whole batch. Nothing from the batch has been queued, so it is safe to retry.
+var ErrKafkaQueueFull = errors.New("kafka output queue is full")
+
+// KafkaOutput implements the Output interface for sending events to Kafka.
+type KafkaOutput struct {
+	producer     sarama.SyncProducer
+	topic        string
+	partitionKey string
+	chainID      string
+	cloudEvents  string
+
+	// Async mode
+	async       sarama.AsyncProducer
+	slots       chan struct{} // One token per message awaiting an ack
+	blockOnFull bool
+	deadLetter  DeadLetterFunc
+	deadOut     Output
+	mu          sync.RWMutex // Guards closed against concurrent Send
+	closed      bool
+	drained     chan struct{}
+}
+
+// NewKafkaOutput initializes a new Kafka output sink.
+func NewKafkaOutput(brokers []string, topic, user, password string) (*KafkaOutput, error) {
+	return NewKafkaOutputWithConfig(KafkaConfig{Brokers: brokers, Topic: topic, User: user, Password: password})
+}
+
+// NewKafkaOutputWithConfig initializes a new Kafka output sink from cfg.
+func NewKafkaOutputWithConfig(cfg KafkaConfig) (*KafkaOutput, error) {
+	config, err := newSaramaConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	partitionKey, err := kafkaPartitionKey(cfg.PartitionKey)
+	if err != nil {
+		return nil, err
+	}
+	cloudEvents, err := parseCloudEventsMode(cfg.CloudEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &KafkaOutput{topic: cfg.Topic, partitionKey: partitionKey, chainID: cfg.ChainID, cloudEvents: cloudEvents, deadOut: cfg.DeadLetterOutput}
+	if cfg.Async {
+		producer, err := sarama.NewAsyncProducer(cfg.Brokers, config)
+		if err != nil {
+			return nil, err
+		}
+		k.startAsync(producer, cfg.QueueSize, cfg.BlockOnFull, cfg.DeadLetter)
+		return k, nil
+	}
+
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	k.producer = producer
+	return k, nil
+}
+
+// startAsync switches k to async mode and starts consuming delivery reports.
+func (k *KafkaOutput) startAsync(producer sarama.AsyncProducer, queueSize int, blockOnFull bool, deadLetter DeadLetterFunc) {
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	k.async = producer
+	k.slots = make(chan struct{}, queueSize)
+	k.blockOnFull = blockOnFull
+	k.deadLetter = deadLetter
+	k.drained = make(chan struct{})
+	go k.handleDeliveries()
+}
+
+func (k *KafkaOutput) Name() string { return "kafka" }
+
+func (k *KafkaOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	msgs, err := k.messages(logs)
+	if err != nil {
+		return err
+	}
+	if k.async != nil {
+		return k.enqueue(ctx, msgs)
+	}
+	return k.producer.SendMessages(msgs)
+}
+
+// Pressure returns how full the queue of messages awaiting acks is in async
+// mode, 0 otherwise. See PressureReporter.
+func (k *KafkaOutput) Pressure() float64 {
+	if k.async == nil {
+		return 0
+	}
+	return float64(len(k.slots)) / float64(cap(k.slots))
+}
+
+// Close flushes and closes the producer. In async mode it returns once every
+// queued message has been acknowledged or handed to the dead-letter handler.
+// The dead-letter output, if any, is closed last.
+func (k *KafkaOutput) Close() error {
+	if k.async == nil {
+		return errors.Join(k.producer.Close(), k.closeDeadLetter())
+	}
+
+	k.mu.Lock()
+	if k.closed {
+		k.mu.Unlock()
+		return nil
+	}
+	k.closed = true
+	k.mu.Unlock()
+
+	k.async.AsyncClose()
+	<-k.drained
+	return k.closeDeadLetter()
+}
+
+func (k *KafkaOutput) closeDeadLetter() error {
+	if k.deadOut == nil {
+		return nil
+	}
+	return k.deadOut.Close()
+}
+
+func (k *KafkaOutput) enqueue(ctx context.Context, msgs []*sarama.ProducerMessage) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.closed {
+		return fmt.Errorf("kafka output is closed")
+	}
+
+	if !k.blockOnFull {
+		// Reserve room for the whole batch first so it is never half-queued
+		for i := range msgs {
+			select {
+			case k.slots <- struct{}{}:
+			default:
+				for ; i > 0; i-- {
+					<-k.slots
+				}
+				return ErrKafkaQueueFull
+			}
+		}
+		for _, msg := range msgs {
+			k.async.Input() <- msg
+		}
+		return nil
+	}
+
+	for _, msg := range msgs {
+		select {
+		case k.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		k.async.Input() <- msg
+	}
+	return nil
+}
+
+// handleDeliveries consumes delivery reports until the producer is closed.
+func (k *KafkaOutput) handleDeliveries() {
+	defer close(k.drained)
+	successes, errs := k.async.Successes(), k.async.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case _, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			<-k.slots
+		case perr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			<-k.slots
+			// The logs of a batch record, else the one of the record
+			logs, ok := perr.Msg.Metadata.([]DecodedLog)
+			if !ok {
+				l, _ := perr.Msg.Metadata.(DecodedLog)
+				logs = []DecodedLog{l}
+			}
+			if k.deadOut != nil {
+				if err := k.deadOut.Send(context.Background(), logs); err != nil {
+					fmt.Fprintf(os.Stderr, "[Kafka Dead Letter Error] %s: %v\n", k.deadOut.Name(), err)
+				}
+			}
+			for _, l := range logs {
+				if k.deadLetter != nil {
+					k.deadLetter(l, perr.Err)
+				} else {
+					fmt.Fprintf(os.Stderr, "[Kafka Async Error] tx %s log %d: %v\n", l.Log.TxHash.Hex(), l.Log.Index, perr.Err)
+				}
+			}
+		}
+	}
+}
+
+// messages builds the Kafka records for logs, one per log unless in
+// CloudEventsBatch mode.
+func (k *KafkaOutput) messages(logs []DecodedLog) ([]*sarama.ProducerMessage, error) {
+	if k.cloudEvents == CloudEventsBatch {
+		bodies, err := EncodeCloudEvents(logs, CloudEventsBatch)
+		if err != nil {
+			return nil, err
+		}
+		return []*sarama.ProducerMessage{{
+			Topic:    k.topic,
+			Key:      sarama.StringEncoder(k.key(logs[0])),
+			Value:    sarama.ByteEncoder(bodies[0]),
+			Headers:  []sarama.RecordHeader{{Key: []byte("content-type"), Value: []byte(CloudEventsBatchContentType)}},
+			Metadata: logs,
+		}}, nil
+	}
+
+	msgs := make([]*sarama.ProducerMessage, 0, len(logs))
+	for _, l := range logs {
+		msg, err := k.message(l)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// message builds the Kafka record for a single log.
+func (k *KafkaOutput) message(l DecodedLog) (*sarama.ProducerMessage, error) {
+	var data []byte
+	var err error
+	if k.cloudEvents == CloudEventsStructured {
+		var bodies [][]byte
+		if bodies, err = EncodeCloudEvents([]DecodedLog{l}, CloudEventsStructured); err == nil {
+			data = bodies[0]
+		}
+	} else {
+		data, err = json.Marshal(l)
+	}
+	if err != nil {
+		return nil, err
+	}
+	headers := []sarama.RecordHeader{
+		{Key: []byte("event_name"), Value: []byte(l.EventName)},
+		{Key: []byte("block_number"), Value: []byte(strconv.FormatUint(l.Log.BlockNumber, 10))},
+	}
+	if k.cloudEvents == CloudEventsStructured {
+		headers = append(headers, sarama.RecordHeader{Key: []byte("content-type"), Value: []byte(CloudEventsContentType)})
+	}
+	chainID := l.ChainID
+	if chainID == "" {
+		chainID = k.chainID
+	}
+	if chainID != "" {
+		headers = append(headers, sarama.RecordHeader{Key: []byte("chain_id"), Value: []byte(chainID)})
+	}
+	return &sarama.ProducerMessage{
+		Topic:    k.topic,
+		Key:      sarama.StringEncoder(k.key(l)),
+		Value:    sarama.ByteEncoder(data),
+		Headers:  headers,
+		Metadata: l,
+	}, nil
+}
+
+// key returns the partition key of l according to the configured strategy.
+func (k *KafkaOutput) key(l DecodedLog) string {
+	switch k.partitionKey {
+	case KafkaKeyAddress:
+		return l.Log.Address.Hex()
+	case KafkaKeyTopic0:
+		if len(l.Log.Topics) > 0 {
+			return l.Log.Topics[0].Hex()
+		}
+	}
+	return l.Log.TxHash.Hex()
+}
+
+func kafkaPartitionKey(s string) (string, error) {
+	switch {
+	case s == "" || strings.EqualFold(s, KafkaKeyTxHash):
+		return KafkaKeyTxHash, nil
+	case strings.EqualFold(s, KafkaKeyAddress):
+		return KafkaKeyAddress, nil
+	case strings.EqualFold(s, KafkaKeyTopic0):
+		return KafkaKeyTopic0, nil
+	default:
+		return "", fmt.Errorf("unsupported kafka partition key: %q", s)
+	}
+}
+
+// newSaramaConfig translates cfg into a validated sarama producer configuration.
+func newSaramaConfig(cfg KafkaConfig) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	switch strings.ToLower(cfg.Acks) {
+	case "":
+	case "all", "-1":
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	case "leader", "1":
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	case "none", "0":
+		config.Producer.RequiredAcks = sarama.NoResponse
+	default:
+		return nil, fmt.Errorf("unsupported kafka acks: %q", cfg.Acks)
+	}
+
+	switch strings.ToLower(cfg.Compression) {
+	case "", "none":
+	case "gzip":
+		config.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		config.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		config.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		config.Producer.Compression = sarama.CompressionZSTD
+	default:
+		return nil, fmt.Errorf("unsupported kafka compression: %q", cfg.Compression)
+	}
+
+	if cfg.Idempotent {
+		if cfg.Acks != "" && config.Producer.RequiredAcks != sarama.WaitForAll {
+			return nil, fmt.Errorf("kafka idempotent producer requires acks=all")
+		}
+		config.Producer.Idempotent = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Net.MaxOpenRequests = 1
+	}
+
+	config.Producer.Flush.Bytes = cfg.FlushBytes
+	config.Producer.Flush.Messages = cfg.FlushMessages
+	config.Producer.Flush.Frequency = cfg.FlushFrequency
+
+	if cfg.User != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = cfg.User
+		config.Net.SASL.Password = cfg.Password
+		switch strings.ToUpper(cfg.SASLMechanism) {
+		case "", sarama.SASLTypePlaintext:
+			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{hashGen: scram.SHA256}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &scramClient{hashGen: scram.SHA512}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported kafka sasl mechanism: %q", cfg.SASLMechanism)
+		}
+	}
+
+	if cfg.TLS {
+		tlsCfg := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+		if cfg.TLSCAFile != "" {
+			pem, err := os.ReadFile(cfg.TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read kafka ca file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCAFile)
+			}
+			tlsCfg.RootCAs = pool
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsCfg
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// scramClient adapts xdg-go/scram to sarama's SCRAMClient interface.
+type scramClient struct {
+	hashGen scram.HashGeneratorFcn
+	conv    *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGen.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conv = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conv.Step(challenge)
+}
+
+func (c *scramClient) Done() bool { return c.conv.Done() }
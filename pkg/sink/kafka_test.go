@@ -0,0 +1,231 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/xdg-go/scram"
+)
+
+func kafkaTestLog() DecodedLog {
+	return DecodedLog{
+		Log: types.Log{
+			BlockNumber: 123,
+			TxHash:      common.HexToHash("0xabc"),
+			Address:     common.HexToAddress("0x1111111111111111111111111111111111111111"),
+			Topics:      []common.Hash{common.HexToHash("0xddf2")},
+		},
+		EventName: "Transfer",
+	}
+}
+
+func headerMap(msg *sarama.ProducerMessage) map[string]string {
+	m := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		m[string(h.Key)] = string(h.Value)
+	}
+	return m
+}
+
+func TestKafkaOutput_KeysAndHeaders(t *testing.T) {
+	l := kafkaTestLog()
+	tests := []struct {
+		strategy string
+		wantKey  string
+	}{
+		{"", l.Log.TxHash.Hex()},
+		{KafkaKeyTxHash, l.Log.TxHash.Hex()},
+		{KafkaKeyAddress, l.Log.Address.Hex()},
+		{KafkaKeyTopic0, l.Log.Topics[0].Hex()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			strategy, err := kafkaPartitionKey(tt.strategy)
+			assert.NoError(t, err)
+
+			producer := mocks.NewSyncProducer(t, nil)
+			producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+				assert.Equal(t, "events", msg.Topic)
+				key, _ := msg.Key.Encode()
+				assert.Equal(t, tt.wantKey, string(key))
+				assert.Equal(t, map[string]string{
+					"event_name":   "Transfer",
+					"block_number": "123",
+					"chain_id":     "1",
+				}, headerMap(msg))
+				return nil
+			})
+
+			k := &KafkaOutput{producer: producer, topic: "events", partitionKey: strategy, chainID: "1"}
+			assert.NoError(t, k.Send(context.Background(), []DecodedLog{l}))
+			assert.NoError(t, k.Close())
+		})
+	}
+}
+
+func TestKafkaOutput_Topic0Fallback(t *testing.T) {
+	k := &KafkaOutput{partitionKey: KafkaKeyTopic0}
+	l := DecodedLog{Log: types.Log{TxHash: common.HexToHash("0x1")}}
+	assert.Equal(t, l.Log.TxHash.Hex(), k.key(l))
+
+	// No chain_id header unless configured
+	msg, err := k.message(l)
+	assert.NoError(t, err)
+	_, ok := headerMap(msg)["chain_id"]
+	assert.False(t, ok)
+
+	// The chain of the event takes precedence over the configured one
+	k.chainID = "1"
+	l.ChainID = "bsc-mainnet"
+	msg, err = k.message(l)
+	assert.NoError(t, err)
+	assert.Equal(t, "bsc-mainnet", headerMap(msg)["chain_id"])
+}
+
+func TestKafkaOutput_SendError(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(errors.New("broker down"))
+
+	k := &KafkaOutput{producer: producer, topic: "events", partitionKey: KafkaKeyTxHash}
+	assert.Error(t, k.Send(context.Background(), []DecodedLog{kafkaTestLog()}))
+	assert.NoError(t, k.Close())
+}
+
+func TestNewSaramaConfig(t *testing.T) {
+	cfg, err := newSaramaConfig(KafkaConfig{Idempotent: true, Compression: "zstd"})
+	assert.NoError(t, err)
+	assert.True(t, cfg.Producer.Idempotent)
+	assert.Equal(t, sarama.WaitForAll, cfg.Producer.RequiredAcks)
+	assert.Equal(t, 1, cfg.Net.MaxOpenRequests)
+	assert.Equal(t, sarama.CompressionZSTD, cfg.Producer.Compression)
+
+	cfg, err = newSaramaConfig(KafkaConfig{User: "u", Password: "p", SASLMechanism: "scram-sha-512", Acks: "none"})
+	assert.NoError(t, err)
+	assert.True(t, cfg.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), cfg.Net.SASL.Mechanism)
+	assert.NotNil(t, cfg.Net.SASL.SCRAMClientGeneratorFunc)
+	assert.Equal(t, sarama.NoResponse, cfg.Producer.RequiredAcks)
+
+	cfg, err = newSaramaConfig(KafkaConfig{TLS: true})
+	assert.NoError(t, err)
+	assert.True(t, cfg.Net.TLS.Enable)
+
+	invalid := []KafkaConfig{
+		{Acks: "some"},
+		{Compression: "brotli"},
+		{Idempotent: true, Acks: "leader"},
+		{User: "u", SASLMechanism: "GSSAPI"},
+		{TLS: true, TLSCAFile: "/nonexistent/ca.pem"},
+	}
+	for _, c := range invalid {
+		_, err := newSaramaConfig(c)
+		assert.Error(t, err, "%+v", c)
+	}
+
+	_, err = NewKafkaOutputWithConfig(KafkaConfig{Brokers: []string{"localhost:9092"}, PartitionKey: "block"})
+	assert.Error(t, err)
+}
+
+func TestScramClient(t *testing.T) {
+	c := &scramClient{hashGen: scram.SHA256}
+	assert.NoError(t, c.Begin("user", "pencil", ""))
+	first, err := c.Step("")
+	assert.NoError(t, err)
+	assert.Contains(t, first, "n=user")
+	assert.False(t, c.Done())
+}
+
+func newTestAsyncKafka(t *testing.T, queueSize int, blockOnFull bool, deadLetter DeadLetterFunc) (*KafkaOutput, *mocks.AsyncProducer) {
+	cfg, err := newSaramaConfig(KafkaConfig{})
+	assert.NoError(t, err)
+	producer := mocks.NewAsyncProducer(t, cfg)
+	k := &KafkaOutput{topic: "events", partitionKey: KafkaKeyTxHash}
+	k.startAsync(producer, queueSize, blockOnFull, deadLetter)
+	return k, producer
+}
+
+func TestKafkaOutput_AsyncDrainOnClose(t *testing.T) {
+	k, producer := newTestAsyncKafka(t, 10, false, nil)
+	for i := 0; i < 3; i++ {
+		producer.ExpectInputAndSucceed()
+	}
+
+	assert.NoError(t, k.Send(context.Background(), testLogs(3)))
+	assert.NoError(t, k.Close())
+
+	// Every message was acknowledged before Close returned
+	assert.Len(t, k.slots, 0)
+	assert.NoError(t, k.Close())
+	assert.Error(t, k.Send(context.Background(), testLogs(1)))
+}
+
+func TestKafkaOutput_AsyncDeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	var dead []DecodedLog
+	var deadErr error
+	k, producer := newTestAsyncKafka(t, 10, false, func(l DecodedLog, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		dead = append(dead, l)
+		deadErr = err
+	})
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+
+	assert.NoError(t, k.Send(context.Background(), testLogs(2)))
+	assert.NoError(t, k.Close())
+
+	assert.Len(t, dead, 1)
+	assert.Equal(t, uint(1), dead[0].Log.Index)
+	assert.ErrorIs(t, deadErr, sarama.ErrNotLeaderForPartition)
+}
+
+func TestKafkaOutput_AsyncDeadLetterOutput(t *testing.T) {
+	k, producer := newTestAsyncKafka(t, 10, false, func(DecodedLog, error) {})
+	dead := &fakeOutput{name: "file"}
+	k.deadOut = dead
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+
+	// Events failing after Send returned are not lost
+	assert.NoError(t, k.Send(context.Background(), testLogs(3)))
+	assert.NoError(t, k.Close())
+	assert.Equal(t, 2, dead.sent)
+	assert.True(t, dead.closed)
+}
+
+func TestKafkaOutput_AsyncQueueFull(t *testing.T) {
+	k, _ := newTestAsyncKafka(t, 2, false, nil)
+
+	// Occupy the queue as if a message were awaiting its ack
+	k.slots <- struct{}{}
+	err := k.Send(context.Background(), testLogs(2))
+	assert.ErrorIs(t, err, ErrKafkaQueueFull)
+	// The partial reservation was released
+	assert.Len(t, k.slots, 1)
+
+	<-k.slots
+	assert.NoError(t, k.Close())
+}
+
+func TestKafkaOutput_AsyncBlockOnFull(t *testing.T) {
+	k, _ := newTestAsyncKafka(t, 1, true, nil)
+
+	k.slots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, k.Send(ctx, testLogs(1)), context.DeadlineExceeded)
+
+	<-k.slots
+	assert.NoError(t, k.Close())
+}
@@ -0,0 +1,200 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the Send latency histogram, matching
+// the Prometheus client defaults.
+var LatencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// SinkStats is a snapshot of the metrics recorded by an InstrumentedOutput.
+type SinkStats struct {
+	Name                string
+	Sends               uint64 // Send calls
+	Failures            uint64 // Failed Send calls
+	ConsecutiveFailures uint64 // Failed Send calls since the last success
+	Events              uint64 // Events delivered by successful sends
+	Bytes               uint64 // JSON-encoded size of the delivered events
+	LastError           string
+	LastErrorAt         time.Time
+	Pressure            float64 // Fullness of the buffer of the output, see PressureReporter
+
+	// HighWater is the highest block of the events delivered by successful
+	// sends, by chain id: compare those of two outputs to see how far one
+	// lags behind. Async outputs count events once queued.
+	HighWater map[string]uint64
+
+	// Latency histogram of Send: LatencyCounts[i] is the number of sends that
+	// took at most LatencyBuckets[i] (cumulative), LatencyCount the total.
+	LatencyCounts []uint64
+	LatencySum    time.Duration
+	LatencyCount  uint64
+}
+
+// StatsReporter is implemented by outputs that record SinkStats.
+type StatsReporter interface {
+	Stats() SinkStats
+}
+
+// InstrumentedOutput records delivery metrics for the output it wraps.
+type InstrumentedOutput struct {
+	Output
+
+	mu    sync.Mutex
+	stats SinkStats
+	saved map[string]uint64 // High-water marks last saved or loaded, see SavePositions
+}
+
+// Instrument wraps out so that every Send is counted and timed; read the
+// metrics with Stats. Apply WithTemplate before Instrument, not after.
+func Instrument(out Output) *InstrumentedOutput {
+	return &InstrumentedOutput{
+		Output: out,
+		stats: SinkStats{
+			Name:          out.Name(),
+			LatencyCounts: make([]uint64, len(LatencyBuckets)),
+			HighWater:     make(map[string]uint64),
+		},
+		saved: make(map[string]uint64),
+	}
+}
+
+func (o *InstrumentedOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	start := time.Now()
+	err := o.Output.Send(ctx, logs)
+	elapsed := time.Since(start)
+
+	var size int
+	if err == nil {
+		if data, mErr := json.Marshal(logs); mErr == nil {
+			size = len(data)
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := &o.stats
+	s.Sends++
+	s.LatencyCount++
+	s.LatencySum += elapsed
+	for i, bound := range LatencyBuckets {
+		if elapsed <= bound {
+			s.LatencyCounts[i]++
+		}
+	}
+	if err != nil {
+		s.Failures++
+		s.ConsecutiveFailures++
+		s.LastError = err.Error()
+		s.LastErrorAt = time.Now()
+		return err
+	}
+	s.ConsecutiveFailures = 0
+	s.Events += uint64(len(logs))
+	s.Bytes += uint64(size)
+	for _, l := range logs {
+		o.raise(l.ChainID, l.Log.BlockNumber)
+	}
+	return nil
+}
+
+// raise raises the high-water mark of chainID to block. o.mu must be held.
+func (o *InstrumentedOutput) raise(chainID string, block uint64) {
+	if block > o.stats.HighWater[chainID] {
+		o.stats.HighWater[chainID] = block
+	}
+}
+
+// Stats returns a snapshot of the recorded metrics.
+func (o *InstrumentedOutput) Stats() SinkStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := o.stats
+	s.LatencyCounts = append([]uint64(nil), o.stats.LatencyCounts...)
+	s.HighWater = maps.Clone(o.stats.HighWater)
+	s.Pressure = o.Pressure()
+	return s
+}
+
+// Stats returns the metrics of every output that implements StatsReporter.
+func (m *MultiSink) Stats() []SinkStats {
+	var stats []SinkStats
+	for _, out := range m.outputs {
+		if r, ok := out.(StatsReporter); ok {
+			stats = append(stats, r.Stats())
+		}
+	}
+	return stats
+}
+
+// WritePrometheus writes stats in the Prometheus text exposition format, e.g.
+// to serve them from a /metrics endpoint.
+func WritePrometheus(w io.Writer, stats []SinkStats) error {
+	var b strings.Builder
+	metric := func(name, kind, help string, value func(SinkStats) string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, s := range stats {
+			fmt.Fprintf(&b, "%s{sink=%q} %s\n", name, s.Name, value(s))
+		}
+	}
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+
+	metric("scanner_sink_sends_total", "counter", "Send calls per sink.", func(s SinkStats) string { return u(s.Sends) })
+	metric("scanner_sink_failures_total", "counter", "Failed Send calls per sink.", func(s SinkStats) string { return u(s.Failures) })
+	metric("scanner_sink_events_total", "counter", "Events delivered per sink.", func(s SinkStats) string { return u(s.Events) })
+	metric("scanner_sink_bytes_total", "counter", "JSON-encoded bytes delivered per sink.", func(s SinkStats) string { return u(s.Bytes) })
+	metric("scanner_sink_consecutive_failures", "gauge", "Failed Send calls since the last success.", func(s SinkStats) string { return u(s.ConsecutiveFailures) })
+	metric("scanner_sink_last_error_timestamp_seconds", "gauge", "Unix time of the last failed Send, 0 if none.", func(s SinkStats) string {
+		if s.LastErrorAt.IsZero() {
+			return "0"
+		}
+		return strconv.FormatInt(s.LastErrorAt.Unix(), 10)
+	})
+	metric("scanner_sink_pressure", "gauge", "Fullness of the buffer of the sink, from 0 to 1.", func(s SinkStats) string {
+		return strconv.FormatFloat(s.Pressure, 'g', -1, 64)
+	})
+
+	const mark = "scanner_sink_high_water_block"
+	fmt.Fprintf(&b, "# HELP %s Highest block delivered per sink and chain.\n# TYPE %s gauge\n", mark, mark)
+	for _, s := range stats {
+		for _, chainID := range slices.Sorted(maps.Keys(s.HighWater)) {
+			fmt.Fprintf(&b, "%s{sink=%q,chain=%q} %d\n", mark, s.Name, chainID, s.HighWater[chainID])
+		}
+	}
+
+	const hist = "scanner_sink_send_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Send latency per sink.\n# TYPE %s histogram\n", hist, hist)
+	for _, s := range stats {
+		for i, bound := range LatencyBuckets {
+			fmt.Fprintf(&b, "%s_bucket{sink=%q,le=%q} %d\n", hist, s.Name, strconv.FormatFloat(bound.Seconds(), 'g', -1, 64), s.LatencyCounts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{sink=%q,le=\"+Inf\"} %d\n", hist, s.Name, s.LatencyCount)
+		fmt.Fprintf(&b, "%s_sum{sink=%q} %s\n", hist, s.Name, strconv.FormatFloat(s.LatencySum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(&b, "%s_count{sink=%q} %d\n", hist, s.Name, s.LatencyCount)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrument(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeOutput{name: "kafka", delay: 20 * time.Millisecond}
+	out := Instrument(fake)
+	assert.Equal(t, "kafka", out.Name())
+
+	logs := testLogs(3)
+	assert.NoError(t, out.Send(ctx, logs))
+	encoded, _ := json.Marshal(logs)
+
+	s := out.Stats()
+	assert.Equal(t, "kafka", s.Name)
+	assert.Equal(t, uint64(1), s.Sends)
+	assert.Equal(t, uint64(0), s.Failures)
+	assert.Equal(t, uint64(3), s.Events)
+	assert.Equal(t, uint64(len(encoded)), s.Bytes)
+	assert.Equal(t, uint64(1), s.LatencyCount)
+	assert.GreaterOrEqual(t, s.LatencySum, 20*time.Millisecond)
+	assert.Equal(t, uint64(0), s.LatencyCounts[0], "5ms bucket")
+	assert.Equal(t, uint64(1), s.LatencyCounts[len(s.LatencyCounts)-1], "10s bucket")
+	assert.Empty(t, s.LastError)
+
+	t.Run("Failures", func(t *testing.T) {
+		fake.delay = 0
+		fake.err = errors.New("broker down")
+		before := time.Now()
+		assert.Error(t, out.Send(ctx, logs))
+		assert.Error(t, out.Send(ctx, logs))
+
+		s := out.Stats()
+		assert.Equal(t, uint64(3), s.Sends)
+		assert.Equal(t, uint64(2), s.Failures)
+		assert.Equal(t, uint64(2), s.ConsecutiveFailures)
+		assert.Equal(t, uint64(3), s.Events, "failed sends are not delivered")
+		assert.Equal(t, "broker down", s.LastError)
+		assert.False(t, s.LastErrorAt.Before(before))
+
+		fake.err = nil
+		assert.NoError(t, out.Send(ctx, logs[:1]))
+		s = out.Stats()
+		assert.Equal(t, uint64(0), s.ConsecutiveFailures)
+		assert.Equal(t, uint64(4), s.Events)
+		assert.Equal(t, "broker down", s.LastError, "last error is kept after recovery")
+	})
+
+	t.Run("SnapshotIsCopy", func(t *testing.T) {
+		s := out.Stats()
+		s.LatencyCounts[0] = 99
+		assert.NotEqual(t, uint64(99), out.Stats().LatencyCounts[0])
+	})
+}
+
+func TestMultiSink_Stats(t *testing.T) {
+	a := Instrument(&fakeOutput{name: "a"})
+	m := NewMultiSink([]Output{a, &fakeOutput{name: "plain"}})
+	assert.NoError(t, m.Send(context.Background(), testLogs(2)))
+
+	stats := m.Stats()
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "a", stats[0].Name)
+	assert.Equal(t, uint64(2), stats[0].Events)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	out := Instrument(&fakeOutput{name: "webhook", err: errors.New("boom")})
+	_ = out.Send(context.Background(), testLogs(1))
+
+	var b strings.Builder
+	assert.NoError(t, WritePrometheus(&b, []SinkStats{out.Stats()}))
+	text := b.String()
+	assert.Contains(t, text, "# TYPE scanner_sink_sends_total counter\n")
+	assert.Contains(t, text, `scanner_sink_sends_total{sink="webhook"} 1`)
+	assert.Contains(t, text, `scanner_sink_failures_total{sink="webhook"} 1`)
+	assert.Contains(t, text, `scanner_sink_consecutive_failures{sink="webhook"} 1`)
+	assert.Contains(t, text, "# TYPE scanner_sink_send_duration_seconds histogram\n")
+	assert.Contains(t, text, `scanner_sink_send_duration_seconds_bucket{sink="webhook",le="0.005"} 1`)
+	assert.Contains(t, text, `scanner_sink_send_duration_seconds_bucket{sink="webhook",le="+Inf"} 1`)
+	assert.Contains(t, text, `scanner_sink_send_duration_seconds_count{sink="webhook"} 1`)
+	assert.NotContains(t, text, `scanner_sink_last_error_timestamp_seconds{sink="webhook"} 0`)
+}
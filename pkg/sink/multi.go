@@ -0,0 +1,247 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Policy decides when a MultiSink.Send reports failure.
+type Policy string
+
+const (
+	// PolicyAll fails the batch if any output fails, so the cursor is not advanced (default).
+	PolicyAll Policy = "all"
+	// PolicyAny fails the batch only if every output fails.
+	PolicyAny Policy = "any"
+	// PolicyBestEffort never fails the batch; errors only reach the error handler.
+	PolicyBestEffort Policy = "best-effort"
+)
+
+// ParsePolicy converts a configuration value into a Policy. Empty means PolicyAll.
+func ParsePolicy(s string) (Policy, error) {
+	switch Policy(s) {
+	case "":
+		return PolicyAll, nil
+	case PolicyAll, PolicyAny, PolicyBestEffort:
+		return Policy(s), nil
+	default:
+		return "", fmt.Errorf("unsupported output policy: %q", s)
+	}
+}
+
+// SinkError is the failure of a single output within a MultiSink.
+type SinkError struct {
+	Sink string
+	Err  error
+}
+
+func (e *SinkError) Error() string { return e.Sink + ": " + e.Err.Error() }
+
+func (e *SinkError) Unwrap() error { return e.Err }
+
+// MultiSink fans every batch out to several outputs and implements Output itself.
+// By default outputs are called concurrently and every failure is collected.
+type MultiSink struct {
+	outputs        []Output
+	policy         Policy
+	sequential     bool
+	failFast       bool
+	defaultTimeout time.Duration
+	timeouts       map[string]time.Duration
+	onError        func(name string, err error)
+	onSend         func(name string, elapsed time.Duration, err error)
+}
+
+// MultiSinkOption configures a MultiSink.
+type MultiSinkOption func(*MultiSink)
+
+// WithPolicy sets the error policy (default PolicyAll).
+func WithPolicy(p Policy) MultiSinkOption {
+	return func(m *MultiSink) { m.policy = p }
+}
+
+// WithTimeout bounds every output's Send unless overridden by WithSinkTimeout.
+func WithTimeout(d time.Duration) MultiSinkOption {
+	return func(m *MultiSink) { m.defaultTimeout = d }
+}
+
+// WithSinkTimeout bounds Send of the output with the given Name().
+func WithSinkTimeout(name string, d time.Duration) MultiSinkOption {
+	return func(m *MultiSink) { m.timeouts[name] = d }
+}
+
+// WithSequential calls outputs one after another in the given order instead of concurrently.
+func WithSequential() MultiSinkOption {
+	return func(m *MultiSink) { m.sequential = true }
+}
+
+// WithFailFast returns the first failure immediately: remaining outputs are skipped
+// (sequential) or cancelled (parallel). Only meaningful with PolicyAll.
+func WithFailFast() MultiSinkOption {
+	return func(m *MultiSink) { m.failFast = true }
+}
+
+// WithLatencyHook is called after every output's Send with its duration and result,
+// e.g. to record per-sink latency metrics.
+func WithLatencyHook(fn func(name string, elapsed time.Duration, err error)) MultiSinkOption {
+	return func(m *MultiSink) { m.onSend = fn }
+}
+
+// WithErrorHandler is called with every output failure, whatever the policy.
+func WithErrorHandler(fn func(name string, err error)) MultiSinkOption {
+	return func(m *MultiSink) { m.onError = fn }
+}
+
+// NewMultiSink creates a dispatcher over outputs.
+func NewMultiSink(outputs []Output, opts ...MultiSinkOption) *MultiSink {
+	m := &MultiSink{
+		outputs:  outputs,
+		policy:   PolicyAll,
+		timeouts: make(map[string]time.Duration),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *MultiSink) Name() string { return "multi" }
+
+// Outputs returns the wrapped outputs.
+func (m *MultiSink) Outputs() []Output { return m.outputs }
+
+// Send delivers logs to every output. An output that exceeds its timeout is
+// reported as failed without waiting for it to return, so a hung sink cannot
+// stall the others or the scanner. Failures are returned as *SinkError values,
+// joined when there are several.
+func (m *MultiSink) Send(ctx context.Context, logs []DecodedLog) error {
+	if len(m.outputs) == 0 {
+		return nil
+	}
+
+	var failed []error
+	if m.sequential {
+		failed = m.sendSequential(ctx, logs)
+	} else {
+		failed = m.sendParallel(ctx, logs)
+	}
+
+	switch {
+	case len(failed) == 0, m.policy == PolicyBestEffort:
+		return nil
+	case m.policy == PolicyAny && len(failed) < len(m.outputs):
+		return nil
+	default:
+		return errors.Join(failed...)
+	}
+}
+
+func (m *MultiSink) failFastEnabled() bool {
+	return m.failFast && m.policy == PolicyAll
+}
+
+func (m *MultiSink) sendSequential(ctx context.Context, logs []DecodedLog) []error {
+	var failed []error
+	for _, out := range m.outputs {
+		if err := m.sendOne(ctx, out, logs); err != nil {
+			failed = append(failed, err)
+			if m.failFastEnabled() {
+				break
+			}
+		}
+	}
+	return failed
+}
+
+func (m *MultiSink) sendParallel(ctx context.Context, logs []DecodedLog) []error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(m.outputs))
+	var first error
+	var once sync.Once
+	var wg sync.WaitGroup
+	for i, out := range m.outputs {
+		wg.Add(1)
+		go func(i int, out Output) {
+			defer wg.Done()
+			if err := m.sendOne(ctx, out, logs); err != nil {
+				errs[i] = err
+				if m.failFastEnabled() {
+					once.Do(func() {
+						first = err
+						cancel()
+					})
+				}
+			}
+		}(i, out)
+	}
+	wg.Wait()
+
+	if first != nil {
+		// Siblings only failed because they were cancelled
+		return []error{first}
+	}
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	return failed
+}
+
+// sendOne sends to a single output and reports the outcome to the hooks.
+func (m *MultiSink) sendOne(ctx context.Context, out Output, logs []DecodedLog) error {
+	start := time.Now()
+	err := m.send(ctx, out, logs)
+	if m.onSend != nil {
+		m.onSend(out.Name(), time.Since(start), err)
+	}
+	if err == nil {
+		return nil
+	}
+	if m.onError != nil {
+		m.onError(out.Name(), err)
+	}
+	return &SinkError{Sink: out.Name(), Err: err}
+}
+
+// send calls out.Send, giving up once its timeout expires.
+func (m *MultiSink) send(ctx context.Context, out Output, logs []DecodedLog) error {
+	timeout, ok := m.timeouts[out.Name()]
+	if !ok {
+		timeout = m.defaultTimeout
+	}
+	if timeout <= 0 {
+		return out.Send(ctx, logs)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- out.Send(ctx, logs) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("send timed out after %s: %w", timeout, ctx.Err())
+		}
+		return ctx.Err()
+	}
+}
+
+// Close closes every output and returns their combined errors.
+func (m *MultiSink) Close() error {
+	var errs []error
+	for _, out := range m.outputs {
+		if err := out.Close(); err != nil {
+			errs = append(errs, &SinkError{Sink: out.Name(), Err: err})
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,212 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOutput records batches and can be made to fail or hang.
+type fakeOutput struct {
+	name   string
+	err    error
+	delay  time.Duration
+	ignore bool // Ignore context cancellation while delaying
+
+	mu     sync.Mutex
+	sent   int
+	closed bool
+}
+
+func (f *fakeOutput) Name() string { return f.name }
+
+func (f *fakeOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	if f.delay > 0 {
+		if f.ignore {
+			time.Sleep(f.delay)
+		} else {
+			select {
+			case <-time.After(f.delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent += len(logs)
+	return f.err
+}
+
+func (f *fakeOutput) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return f.err
+}
+
+func TestMultiSink_PolicyAll(t *testing.T) {
+	ok := &fakeOutput{name: "ok"}
+	bad := &fakeOutput{name: "bad", err: errors.New("boom")}
+	var handled []string
+	var mu sync.Mutex
+	m := NewMultiSink([]Output{ok, bad}, WithErrorHandler(func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, name)
+	}))
+	assert.Equal(t, "multi", m.Name())
+
+	err := m.Send(context.Background(), testLogs(2))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bad: boom")
+
+	var sinkErr *SinkError
+	assert.True(t, errors.As(err, &sinkErr))
+	assert.Equal(t, "bad", sinkErr.Sink)
+	assert.Equal(t, []string{"bad"}, handled)
+	assert.Equal(t, 2, ok.sent)
+}
+
+func TestMultiSink_PolicyAny(t *testing.T) {
+	ok := &fakeOutput{name: "ok"}
+	bad := &fakeOutput{name: "bad", err: errors.New("boom")}
+
+	m := NewMultiSink([]Output{ok, bad}, WithPolicy(PolicyAny))
+	assert.NoError(t, m.Send(context.Background(), testLogs(1)))
+
+	m = NewMultiSink([]Output{bad, &fakeOutput{name: "bad2", err: errors.New("down")}}, WithPolicy(PolicyAny))
+	err := m.Send(context.Background(), testLogs(1))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bad: boom")
+	assert.Contains(t, err.Error(), "bad2: down")
+}
+
+func TestMultiSink_PolicyBestEffort(t *testing.T) {
+	bad := &fakeOutput{name: "bad", err: errors.New("boom")}
+	calls := 0
+	m := NewMultiSink([]Output{bad}, WithPolicy(PolicyBestEffort), WithErrorHandler(func(string, error) { calls++ }))
+	assert.NoError(t, m.Send(context.Background(), testLogs(1)))
+	assert.Equal(t, 1, calls)
+}
+
+func TestMultiSink_Timeout(t *testing.T) {
+	fast := &fakeOutput{name: "fast"}
+	hung := &fakeOutput{name: "hung", delay: time.Second, ignore: true}
+	slow := &fakeOutput{name: "slow", delay: 50 * time.Millisecond}
+
+	m := NewMultiSink([]Output{fast, hung, slow},
+		WithTimeout(20*time.Millisecond),
+		WithSinkTimeout("slow", time.Second),
+	)
+
+	start := time.Now()
+	err := m.Send(context.Background(), testLogs(1))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// Only the hung sink, which ignores its context, is reported
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "hung: send timed out")
+	assert.NotContains(t, err.Error(), "slow")
+	assert.Equal(t, 1, fast.sent)
+	assert.Equal(t, 1, slow.sent)
+}
+
+// orderedOutput appends its name to a shared slice, to observe call order.
+type orderedOutput struct {
+	fakeOutput
+	order *[]string
+}
+
+func (o *orderedOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	*o.order = append(*o.order, o.name)
+	return o.err
+}
+
+func TestMultiSink_Sequential(t *testing.T) {
+	var order []string
+	outputs := []Output{
+		&orderedOutput{fakeOutput: fakeOutput{name: "a"}, order: &order},
+		&orderedOutput{fakeOutput: fakeOutput{name: "b", err: errors.New("boom")}, order: &order},
+		&orderedOutput{fakeOutput: fakeOutput{name: "c", err: errors.New("bang")}, order: &order},
+	}
+
+	// Collect-all: every output is called, every failure returned
+	err := NewMultiSink(outputs, WithSequential()).Send(context.Background(), testLogs(1))
+	assert.Equal(t, []string{"a", "b", "c"}, order)
+	assert.Contains(t, err.Error(), "b: boom")
+	assert.Contains(t, err.Error(), "c: bang")
+
+	// Fail-fast: stops at the first failure
+	order = nil
+	err = NewMultiSink(outputs, WithSequential(), WithFailFast()).Send(context.Background(), testLogs(1))
+	assert.Equal(t, []string{"a", "b"}, order)
+	assert.EqualError(t, err, "b: boom")
+}
+
+func TestMultiSink_ParallelFailFast(t *testing.T) {
+	bad := &fakeOutput{name: "bad", err: errors.New("boom")}
+	slow := &fakeOutput{name: "slow", delay: time.Second}
+
+	start := time.Now()
+	err := NewMultiSink([]Output{bad, slow}, WithFailFast()).Send(context.Background(), testLogs(1))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// Only the root cause is returned, not the cancelled sibling
+	assert.EqualError(t, err, "bad: boom")
+	assert.Equal(t, 0, slow.sent)
+}
+
+func TestMultiSink_LatencyHook(t *testing.T) {
+	var mu sync.Mutex
+	latencies := map[string]time.Duration{}
+	results := map[string]error{}
+	m := NewMultiSink(
+		[]Output{&fakeOutput{name: "slow", delay: 20 * time.Millisecond}, &fakeOutput{name: "bad", err: errors.New("boom")}},
+		WithPolicy(PolicyBestEffort),
+		WithLatencyHook(func(name string, elapsed time.Duration, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			latencies[name] = elapsed
+			results[name] = err
+		}),
+	)
+	assert.NoError(t, m.Send(context.Background(), testLogs(1)))
+
+	assert.GreaterOrEqual(t, latencies["slow"], 20*time.Millisecond)
+	assert.NoError(t, results["slow"])
+	assert.EqualError(t, results["bad"], "boom")
+}
+
+func TestMultiSink_Close(t *testing.T) {
+	a := &fakeOutput{name: "a"}
+	b := &fakeOutput{name: "b", err: errors.New("close failed")}
+	m := NewMultiSink([]Output{a, b})
+	assert.Len(t, m.Outputs(), 2)
+
+	err := m.Close()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "b: close failed")
+	assert.True(t, a.closed)
+	assert.True(t, b.closed)
+
+	assert.NoError(t, NewMultiSink(nil).Send(context.Background(), testLogs(1)))
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("")
+	assert.NoError(t, err)
+	assert.Equal(t, PolicyAll, p)
+
+	p, err = ParsePolicy("best-effort")
+	assert.NoError(t, err)
+	assert.Equal(t, PolicyBestEffort, p)
+
+	_, err = ParsePolicy("majority")
+	assert.Error(t, err)
+}
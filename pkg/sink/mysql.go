@@ -0,0 +1,96 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// mysqlMaxRowsPerInsert keeps multi-row inserts well below MySQL's 65535 placeholder limit.
+const mysqlMaxRowsPerInsert = 1000
+
+// MySQLOutput implements the Output interface for saving events to MySQL/MariaDB.
+type MySQLOutput struct {
+	db    *sql.DB
+	table string
+}
+
+// NewMySQLOutput initializes a new MySQL output sink.
+// dsn uses the go-sql-driver format, e.g. "user:pass@tcp(localhost:3306)/dbname".
+func NewMySQLOutput(dsn, table string) (*MySQLOutput, error) {
+	if !validTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			block_number BIGINT UNSIGNED,
+			tx_hash VARCHAR(66),
+			log_index INT UNSIGNED,
+			event_name VARCHAR(255),
+			data JSON,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY uniq_%s_tx_log (tx_hash, log_index),
+			KEY idx_%s_block (block_number)
+		)
+	`, table, table, table)
+	if _, err := db.Exec(query); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+	return &MySQLOutput{db: db, table: table}, nil
+}
+
+func (m *MySQLOutput) Name() string { return "mysql" }
+
+func (m *MySQLOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for start := 0; start < len(logs); start += mysqlMaxRowsPerInsert {
+		end := start + mysqlMaxRowsPerInsert
+		if end > len(logs) {
+			end = len(logs)
+		}
+		stmt, args := m.insertStatement(logs[start:end])
+		if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertStatement builds a multi-row upsert keyed on (tx_hash, log_index).
+func (m *MySQLOutput) insertStatement(logs []DecodedLog) (string, []interface{}) {
+	valueStrings := make([]string, 0, len(logs))
+	valueArgs := make([]interface{}, 0, len(logs)*5)
+	for _, l := range logs {
+		jsonData, _ := json.Marshal(l)
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?)")
+		valueArgs = append(valueArgs, l.Log.BlockNumber, l.Log.TxHash.Hex(), l.Log.Index, l.EventName, jsonData)
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (block_number, tx_hash, log_index, event_name, data) VALUES %s ON DUPLICATE KEY UPDATE block_number = VALUES(block_number), event_name = VALUES(event_name), data = VALUES(data)", m.table, strings.Join(valueStrings, ","))
+	return stmt, valueArgs
+}
+
+func (m *MySQLOutput) Close() error { return m.db.Close() }
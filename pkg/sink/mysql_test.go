@@ -0,0 +1,121 @@
+package sink
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLOutput_Init(t *testing.T) {
+	mo, err := NewMySQLOutput("invalid", "table")
+	assert.Error(t, err)
+	assert.Nil(t, mo)
+}
+
+func TestMySQLOutput_Safety(t *testing.T) {
+	_, err := NewMySQLOutput("user:pass@tcp(localhost:1)/db", "valid_table")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "invalid table name")
+
+	_, err = NewMySQLOutput("user:pass@tcp(localhost:1)/db", "events; DROP TABLE users;")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid table name")
+}
+
+func TestMySQLOutput_Send(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	m := &MySQLOutput{db: db, table: "events"}
+
+	logs := []DecodedLog{
+		{
+			Log:       types.Log{BlockNumber: 100, TxHash: common.HexToHash("0xabc"), Index: 1},
+			EventName: "Transfer",
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO events (block_number, tx_hash, log_index, event_name, data) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE")).
+		WithArgs(uint64(100), "0x0000000000000000000000000000000000000000000000000000000000000abc", uint(1), "Transfer", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := m.Send(context.Background(), logs)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLOutput_Send_Multiple(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	m := &MySQLOutput{db: db, table: "events"}
+
+	logs := []DecodedLog{
+		{Log: types.Log{BlockNumber: 100, TxHash: common.HexToHash("0x1"), Index: 1}, EventName: "E1"},
+		{Log: types.Log{BlockNumber: 101, TxHash: common.HexToHash("0x2"), Index: 2}, EventName: "E2"},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("VALUES (?, ?, ?, ?, ?),(?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE")).
+		WithArgs(
+			uint64(100), "0x0000000000000000000000000000000000000000000000000000000000000001", uint(1), "E1", sqlmock.AnyArg(),
+			uint64(101), "0x0000000000000000000000000000000000000000000000000000000000000002", uint(2), "E2", sqlmock.AnyArg(),
+		).
+		WillReturnResult(sqlmock.NewResult(2, 2))
+	mock.ExpectCommit()
+
+	err := m.Send(context.Background(), logs)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLOutput_Send_Chunked(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	m := &MySQLOutput{db: db, table: "events"}
+	logs := make([]DecodedLog, mysqlMaxRowsPerInsert+1)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO events").WillReturnResult(sqlmock.NewResult(0, mysqlMaxRowsPerInsert))
+	mock.ExpectExec("INSERT INTO events").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, m.Send(context.Background(), logs))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLOutput_Send_Error(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	m := &MySQLOutput{db: db, table: "events"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO events").WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	err := m.Send(context.Background(), []DecodedLog{{Log: types.Log{Index: 1}}})
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLOutput_Send_Empty(t *testing.T) {
+	m := &MySQLOutput{}
+	err := m.Send(context.Background(), []DecodedLog{})
+	assert.NoError(t, err)
+}
+
+func TestMySQLOutput_Close(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	m := &MySQLOutput{db: db}
+	mock.ExpectClose()
+	assert.NoError(t, m.Close())
+}
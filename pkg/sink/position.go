@@ -0,0 +1,79 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/84hero/evm-scanner/pkg/storage"
+)
+
+// PositionKey returns the key the high-water mark of the output name on
+// chainID is saved under.
+func PositionKey(chainID, name string) string {
+	return "sinkpos:" + chainID + ":" + name
+}
+
+// LoadPositions restores the high-water marks of the chains from store, e.g.
+// at startup, so that SinkStats.HighWater carries on where the last run left
+// it rather than from 0. A mark is only ever raised.
+func (o *InstrumentedOutput) LoadPositions(ctx context.Context, store storage.Persistence, chainIDs ...string) error {
+	for _, chainID := range chainIDs {
+		block, err := store.LoadCursor(ctx, PositionKey(chainID, o.stats.Name))
+		if err != nil {
+			return fmt.Errorf("load position of %s on %s: %w", o.stats.Name, chainID, err)
+		}
+		o.mu.Lock()
+		o.raise(chainID, block)
+		o.saved[chainID] = max(o.saved[chainID], block)
+		o.mu.Unlock()
+	}
+	return nil
+}
+
+// SavePositions saves the high-water marks raised since they were last saved
+// or loaded to store.
+func (o *InstrumentedOutput) SavePositions(ctx context.Context, store storage.Persistence) error {
+	pending := make(map[string]uint64)
+	o.mu.Lock()
+	for chainID, block := range o.stats.HighWater {
+		if block > o.saved[chainID] {
+			pending[chainID] = block
+		}
+	}
+	o.mu.Unlock()
+	for chainID, block := range pending {
+		if err := store.SaveCursor(ctx, PositionKey(chainID, o.stats.Name), block); err != nil {
+			return fmt.Errorf("save position of %s on %s: %w", o.stats.Name, chainID, err)
+		}
+		o.mu.Lock()
+		o.saved[chainID] = max(o.saved[chainID], block)
+		o.mu.Unlock()
+	}
+	return nil
+}
+
+// LoadPositions loads the high-water marks of the instrumented outputs, see
+// InstrumentedOutput.LoadPositions.
+func (m *MultiSink) LoadPositions(ctx context.Context, store storage.Persistence, chainIDs ...string) error {
+	for _, out := range m.outputs {
+		if o, ok := out.(*InstrumentedOutput); ok {
+			if err := o.LoadPositions(ctx, store, chainIDs...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SavePositions saves the high-water marks of the instrumented outputs, see
+// InstrumentedOutput.SavePositions. Every output is saved even if one fails.
+func (m *MultiSink) SavePositions(ctx context.Context, store storage.Persistence) error {
+	var errs []error
+	for _, out := range m.outputs {
+		if o, ok := out.(*InstrumentedOutput); ok {
+			errs = append(errs, o.SavePositions(ctx, store))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockLogs returns a log of chainID at each block.
+func blockLogs(chainID string, blocks ...uint64) []DecodedLog {
+	logs := testLogs(len(blocks))
+	for i, block := range blocks {
+		logs[i].ChainID = chainID
+		logs[i].Log.BlockNumber = block
+	}
+	return logs
+}
+
+func TestInstrument_HighWater(t *testing.T) {
+	ctx := context.Background()
+	postgres := Instrument(&fakeOutput{name: "postgres"})
+	slow := &fakeOutput{name: "kafka"}
+	kafka := Instrument(slow)
+	m := NewMultiSink([]Output{postgres, kafka}, WithPolicy(PolicyBestEffort), WithSinkTimeout("kafka", 10*time.Millisecond))
+
+	assert.NoError(t, m.Send(ctx, blockLogs("eth", 100, 102, 101)))
+	assert.NoError(t, m.Send(ctx, blockLogs("bsc", 7)))
+	// Kafka falls behind
+	slow.delay = time.Second
+	assert.NoError(t, m.Send(ctx, blockLogs("eth", 600)))
+
+	assert.Equal(t, map[string]uint64{"eth": 600, "bsc": 7}, postgres.Stats().HighWater)
+	assert.Equal(t, map[string]uint64{"eth": 102, "bsc": 7}, kafka.Stats().HighWater)
+
+	var b strings.Builder
+	assert.NoError(t, WritePrometheus(&b, m.Stats()))
+	assert.Contains(t, b.String(), `scanner_sink_high_water_block{sink="postgres",chain="eth"} 600`)
+	assert.Contains(t, b.String(), `scanner_sink_high_water_block{sink="kafka",chain="eth"} 102`)
+
+	// Round trip through the store
+	store := storage.NewMemoryStore("")
+	assert.NoError(t, m.SavePositions(ctx, store))
+	saved, err := store.LoadCursor(ctx, PositionKey("eth", "kafka"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(102), saved)
+
+	postgres = Instrument(&fakeOutput{name: "postgres"})
+	restarted := Instrument(&fakeOutput{name: "kafka"})
+	m = NewMultiSink([]Output{postgres, restarted})
+	// Nothing saved for polygon
+	assert.NoError(t, m.LoadPositions(ctx, store, "eth", "bsc", "polygon"))
+	assert.Equal(t, map[string]uint64{"eth": 102, "bsc": 7}, restarted.Stats().HighWater)
+	assert.Equal(t, uint64(600), postgres.Stats().HighWater["eth"])
+
+	// Marks are only raised, and saved once raised
+	assert.NoError(t, restarted.Send(ctx, blockLogs("eth", 50)))
+	assert.Equal(t, uint64(102), restarted.Stats().HighWater["eth"])
+	assert.NoError(t, restarted.Send(ctx, blockLogs("eth", 103)))
+	assert.NoError(t, m.SavePositions(ctx, store))
+	saved, err = store.LoadCursor(ctx, PositionKey("eth", "kafka"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(103), saved)
+}
@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// pgMaxParams is PostgreSQL's limit on bind parameters per statement.
+const pgMaxParams = 65535
+
+// pgTarget is a table rows are written to and how conflicts with existing
+// rows are resolved.
+type pgTarget struct {
+	table      string
+	columns    []string
+	onConflict string // e.g. "ON CONFLICT (tx_hash, log_index) DO NOTHING"
+}
+
+// write stores rows in t within tx, with COPY when the batch reaches the bulk
+// threshold and multi-row INSERTs otherwise.
+func (p *PostgresOutput) write(ctx context.Context, tx *sql.Tx, t pgTarget, rows [][]interface{}) error {
+	if p.bulkThreshold > 0 && len(rows) >= p.bulkThreshold {
+		return t.copyRows(ctx, tx, rows)
+	}
+	perStmt := pgMaxParams / len(t.columns)
+	for start := 0; start < len(rows); start += perStmt {
+		end := min(start+perStmt, len(rows))
+		stmt, args := t.insertStatement(rows[start:end])
+		if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t pgTarget) insertStatement(rows [][]interface{}) (string, []interface{}) {
+	values := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(t.columns))
+	for _, row := range rows {
+		placeholders := make([]string, len(row))
+		for i := range row {
+			placeholders[i] = fmt.Sprintf("$%d", len(args)+i+1)
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+		args = append(args, row...)
+	}
+	cols := strings.Join(t.columns, ", ")
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s %s", t.table, cols, strings.Join(values, ","), t.onConflict), args
+}
+
+// stagingTable is the temporary table COPY loads into. It is dropped when the
+// transaction ends.
+func (t pgTarget) stagingTable() string { return t.table + "_staging" }
+
+// stagingStatements return the statements creating the staging table, with the
+// column types of the target but none of its constraints, and moving its rows
+// into the target with the target's conflict handling.
+func (t pgTarget) stagingStatements() (create, move string) {
+	cols := strings.Join(t.columns, ", ")
+	create = fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA", t.stagingTable(), cols, t.table)
+	move = fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s %s", t.table, cols, cols, t.stagingTable(), t.onConflict)
+	return create, move
+}
+
+// copyRows loads rows with COPY into a staging table and moves them into the
+// target, so duplicates are still resolved by the target's unique constraint.
+func (t pgTarget) copyRows(ctx context.Context, tx *sql.Tx, rows [][]interface{}) error {
+	create, move := t.stagingStatements()
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("create staging table: %w", err)
+	}
+	// CopyIn quotes identifiers, which the unquoted statements fold to lower case
+	cols := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		cols[i] = strings.ToLower(c)
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(strings.ToLower(t.stagingTable()), cols...))
+	if err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, copyValues(row)...); err != nil {
+			return fmt.Errorf("copy: %w", err)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, move); err != nil {
+		return fmt.Errorf("move staged rows: %w", err)
+	}
+	return nil
+}
+
+// copyValues converts byte slices to the "\x" hex form BYTEA accepts in COPY's
+// text format; other values are written as their text representation.
+func copyValues(row []interface{}) []interface{} {
+	out := make([]interface{}, len(row))
+	for i, v := range row {
+		if b, ok := v.([]byte); ok {
+			v = `\x` + hex.EncodeToString(b)
+		}
+		out[i] = v
+	}
+	return out
+}
@@ -0,0 +1,289 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// eventTableBaseColumns are written for every mapped event ahead of its inputs.
+var eventTableBaseColumns = []string{"block_number", "tx_hash", "log_index", "contract", "chain_id"}
+
+// EventTable routes decoded logs of one event into a dedicated table with a
+// column per event input instead of the generic JSONB table.
+type EventTable struct {
+	Event   string // Decoded event name, e.g. "Transfer"
+	Table   string
+	Columns []EventColumn
+}
+
+// EventColumn maps a decoded input to a table column.
+type EventColumn struct {
+	Input string // Decoded input name, e.g. "from"
+	Name  string // Column name, e.g. "from_addr"
+	Type  string // PostgreSQL type, e.g. "NUMERIC(78)"
+}
+
+// NewEventTable derives an EventTable from an ABI event. Column names are the
+// snake_cased input names, with an "_addr" suffix for addresses (so "from"
+// becomes "from_addr"). Integers that do not fit a BIGINT are stored as
+// NUMERIC(78), which holds any uint256; bytes as BYTEA and arrays and tuples as JSONB.
+func NewEventTable(event abi.Event, table string) (EventTable, error) {
+	t := EventTable{Event: event.Name, Table: table}
+	for _, in := range event.Inputs {
+		name := snakeCase(in.Name)
+		if in.Type.T == abi.AddressTy && !strings.HasSuffix(name, "addr") && !strings.HasSuffix(name, "address") {
+			name += "_addr"
+		}
+		t.Columns = append(t.Columns, EventColumn{Input: in.Name, Name: name, Type: pgColumnType(in.Type)})
+	}
+	return t, t.validate()
+}
+
+func (t EventTable) validate() error {
+	if t.Event == "" {
+		return fmt.Errorf("event table %s: missing event name", t.Table)
+	}
+	if !validTableName.MatchString(t.Table) {
+		return fmt.Errorf("invalid table name: %s", t.Table)
+	}
+	seen := make(map[string]bool)
+	for _, c := range eventTableBaseColumns {
+		seen[c] = true
+	}
+	seen["id"], seen["created_at"] = true, true
+	for _, c := range t.Columns {
+		if !validTableName.MatchString(c.Name) {
+			return fmt.Errorf("event table %s: invalid column name: %q", t.Table, c.Name)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("event table %s: duplicate column %q", t.Table, c.Name)
+		}
+		seen[c.Name] = true
+		if _, ok := pgColumnTypes[c.Type]; !ok {
+			return fmt.Errorf("event table %s: unsupported column type %q", t.Table, c.Type)
+		}
+	}
+	return nil
+}
+
+// createStatement returns the DDL creating the table, or adding columns missing
+// from an existing one, e.g. after the ABI gained an input.
+func (t EventTable) createStatement() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n", t.Table)
+	b.WriteString("\tid BIGSERIAL PRIMARY KEY,\n\tblock_number BIGINT NOT NULL,\n\ttx_hash TEXT NOT NULL,\n\tlog_index INT NOT NULL,\n\tcontract TEXT NOT NULL,\n\tchain_id TEXT,\n")
+	for _, c := range t.Columns {
+		fmt.Fprintf(&b, "\t%s %s,\n", c.Name, c.Type)
+	}
+	b.WriteString("\tcreated_at TIMESTAMPTZ DEFAULT NOW(),\n\tUNIQUE (tx_hash, log_index)\n);\n")
+	fmt.Fprintf(&b, "ALTER TABLE %s ADD COLUMN IF NOT EXISTS chain_id TEXT;\n", t.Table)
+	for _, c := range t.Columns {
+		fmt.Fprintf(&b, "ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s;\n", t.Table, c.Name, c.Type)
+	}
+	fmt.Fprintf(&b, "CREATE INDEX IF NOT EXISTS idx_%s_block ON %s (block_number);", t.Table, t.Table)
+	return b.String()
+}
+
+// target describes the upsert of rows built by row.
+func (t EventTable) target() pgTarget {
+	cols := append([]string{}, eventTableBaseColumns...)
+	for _, c := range t.Columns {
+		cols = append(cols, c.Name)
+	}
+	updates := make([]string, 0, len(cols)-2)
+	for _, c := range cols {
+		if c != "tx_hash" && c != "log_index" {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", c, c))
+		}
+	}
+	return pgTarget{
+		table:      t.Table,
+		columns:    cols,
+		onConflict: "ON CONFLICT (tx_hash, log_index) DO UPDATE SET " + strings.Join(updates, ", "),
+	}
+}
+
+// row returns the values of l for the columns of target. Logs of one statement
+// must be free of duplicate (tx_hash, log_index) pairs: PostgreSQL rejects
+// updating a row twice, see dedupeLogs.
+func (t EventTable) row(l DecodedLog) []interface{} {
+	row := make([]interface{}, 0, len(eventTableBaseColumns)+len(t.Columns))
+	row = append(row, l.Log.BlockNumber, l.Log.TxHash.Hex(), l.Log.Index, l.Log.Address.Hex(), pgChainID(l))
+	var inputs map[string]interface{}
+	if l.DecodedData != nil {
+		inputs = l.DecodedData.Inputs
+	}
+	for _, c := range t.Columns {
+		row = append(row, pgColumnValue(inputs[c.Input], c.Type))
+	}
+	return row
+}
+
+// MapEvent creates the table for t and routes decoded logs of t.Event into it
+// from then on. Other events keep going to the generic table.
+func (p *PostgresOutput) MapEvent(t EventTable) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	if _, err := p.db.Exec(t.createStatement()); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", t.Table, err)
+	}
+	p.eventsMu.Lock()
+	defer p.eventsMu.Unlock()
+	if p.events == nil {
+		p.events = make(map[string]EventTable)
+	}
+	p.events[t.Event] = t
+	return nil
+}
+
+// splitMapped separates logs of mapped events, grouped per table in the order
+// the tables were first seen, from the logs for the generic table.
+func (p *PostgresOutput) splitMapped(logs []DecodedLog) (generic []DecodedLog, tables []EventTable, mapped [][]DecodedLog) {
+	p.eventsMu.RLock()
+	defer p.eventsMu.RUnlock()
+	if len(p.events) == 0 {
+		return logs, nil, nil
+	}
+	index := make(map[string]int)
+	for _, l := range logs {
+		t, ok := p.events[l.EventName]
+		if !ok || l.DecodedData == nil {
+			generic = append(generic, l)
+			continue
+		}
+		i, seen := index[t.Event]
+		if !seen {
+			i = len(tables)
+			index[t.Event] = i
+			tables = append(tables, t)
+			mapped = append(mapped, nil)
+		}
+		mapped[i] = append(mapped[i], l)
+	}
+	return generic, tables, mapped
+}
+
+// pgChainID stores logs without a chain id as NULL.
+func pgChainID(l DecodedLog) interface{} {
+	if l.ChainID == "" {
+		return nil
+	}
+	return l.ChainID
+}
+
+// dedupeLogs keeps the last log for each (tx_hash, log_index).
+func dedupeLogs(logs []DecodedLog) []DecodedLog {
+	type key struct {
+		tx    common.Hash
+		index uint
+	}
+	last := make(map[key]int, len(logs))
+	for i, l := range logs {
+		last[key{l.Log.TxHash, l.Log.Index}] = i
+	}
+	if len(last) == len(logs) {
+		return logs
+	}
+	out := make([]DecodedLog, 0, len(last))
+	for i, l := range logs {
+		if last[key{l.Log.TxHash, l.Log.Index}] == i {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+const (
+	pgNumeric = "NUMERIC(78)"
+	pgBigint  = "BIGINT"
+	pgBoolean = "BOOLEAN"
+	pgText    = "TEXT"
+	pgBytea   = "BYTEA"
+	pgJSONB   = "JSONB"
+)
+
+var pgColumnTypes = map[string]struct{}{
+	pgNumeric: {}, pgBigint: {}, pgBoolean: {}, pgText: {}, pgBytea: {}, pgJSONB: {},
+}
+
+func pgColumnType(t abi.Type) string {
+	switch t.T {
+	case abi.UintTy:
+		if t.Size < 64 {
+			return pgBigint
+		}
+		return pgNumeric
+	case abi.IntTy:
+		if t.Size <= 64 {
+			return pgBigint
+		}
+		return pgNumeric
+	case abi.BoolTy:
+		return pgBoolean
+	case abi.AddressTy, abi.StringTy:
+		return pgText
+	case abi.BytesTy, abi.FixedBytesTy, abi.HashTy, abi.FunctionTy:
+		return pgBytea
+	default:
+		return pgJSONB
+	}
+}
+
+// pgColumnValue converts a decoded input into a bind parameter for a column
+// of type typ. Missing inputs become NULL.
+func pgColumnValue(v interface{}, typ string) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch typ {
+	case pgNumeric, pgBigint:
+		if n, ok := v.(*big.Int); ok {
+			return n.String()
+		}
+		if typ == pgNumeric {
+			return fmt.Sprint(v)
+		}
+		return v
+	case pgText:
+		if a, ok := v.(common.Address); ok {
+			return a.Hex()
+		}
+		return fmt.Sprint(v)
+	case pgBytea:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Array {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return b
+		}
+		return v
+	case pgJSONB:
+		data, _ := json.Marshal(normalizeValue(reflect.ValueOf(v), NumberDecimal))
+		return string(data)
+	default:
+		return v
+	}
+}
+
+// snakeCase converts an ABI input name such as "sqrtPriceX96" or "_value" to
+// "sqrt_price_x96" or "value".
+func snakeCase(s string) string {
+	s = strings.Trim(s, "_")
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package sink
+
+import (
+	"context"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const eventTableABI = `[
+	{"type":"event","name":"Transfer","inputs":[
+		{"name":"from","type":"address","indexed":true},
+		{"name":"to","type":"address","indexed":true},
+		{"name":"value","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Mixed","inputs":[
+		{"name":"_owner","type":"address","indexed":false},
+		{"name":"sqrtPriceX96","type":"uint160","indexed":false},
+		{"name":"tick","type":"int24","indexed":false},
+		{"name":"ok","type":"bool","indexed":false},
+		{"name":"salt","type":"bytes32","indexed":false},
+		{"name":"memo","type":"string","indexed":false},
+		{"name":"ids","type":"uint256[]","indexed":false}]}
+]`
+
+func testEventTable(t *testing.T, event, table string) EventTable {
+	parsed, err := abi.JSON(strings.NewReader(eventTableABI))
+	assert.NoError(t, err)
+	et, err := NewEventTable(parsed.Events[event], table)
+	assert.NoError(t, err)
+	return et
+}
+
+func TestNewEventTable(t *testing.T) {
+	et := testEventTable(t, "Transfer", "transfer_events")
+	assert.Equal(t, EventTable{Event: "Transfer", Table: "transfer_events", Columns: []EventColumn{
+		{Input: "from", Name: "from_addr", Type: "TEXT"},
+		{Input: "to", Name: "to_addr", Type: "TEXT"},
+		{Input: "value", Name: "value", Type: "NUMERIC(78)"},
+	}}, et)
+
+	et = testEventTable(t, "Mixed", "mixed_events")
+	assert.Equal(t, []EventColumn{
+		{Input: "_owner", Name: "owner_addr", Type: "TEXT"},
+		{Input: "sqrtPriceX96", Name: "sqrt_price_x96", Type: "NUMERIC(78)"},
+		{Input: "tick", Name: "tick", Type: "BIGINT"},
+		{Input: "ok", Name: "ok", Type: "BOOLEAN"},
+		{Input: "salt", Name: "salt", Type: "BYTEA"},
+		{Input: "memo", Name: "memo", Type: "TEXT"},
+		{Input: "ids", Name: "ids", Type: "JSONB"},
+	}, et.Columns)
+}
+
+func TestEventTable_Validate(t *testing.T) {
+	et := testEventTable(t, "Transfer", "transfer_events")
+
+	bad := et
+	bad.Table = "t; DROP TABLE users"
+	assert.EqualError(t, bad.validate(), "invalid table name: t; DROP TABLE users")
+
+	bad = et
+	bad.Columns = append([]EventColumn{}, et.Columns...)
+	bad.Columns[2].Name = "tx_hash"
+	assert.EqualError(t, bad.validate(), `event table transfer_events: duplicate column "tx_hash"`)
+
+	bad.Columns[2] = EventColumn{Input: "value", Name: "value", Type: "TEXT); DROP TABLE x; --"}
+	assert.Contains(t, bad.validate().Error(), "unsupported column type")
+}
+
+func TestPostgresOutput_MapEvent(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	p := &PostgresOutput{db: db, table: "events"}
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS transfer_events (
+	id BIGSERIAL PRIMARY KEY,
+	block_number BIGINT NOT NULL,
+	tx_hash TEXT NOT NULL,
+	log_index INT NOT NULL,
+	contract TEXT NOT NULL,
+	chain_id TEXT,
+	from_addr TEXT,
+	to_addr TEXT,
+	value NUMERIC(78),
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	UNIQUE (tx_hash, log_index)
+);
+ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS chain_id TEXT;
+ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS from_addr TEXT;
+ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS to_addr TEXT;
+ALTER TABLE transfer_events ADD COLUMN IF NOT EXISTS value NUMERIC(78);
+CREATE INDEX IF NOT EXISTS idx_transfer_events_block ON transfer_events (block_number);`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, p.MapEvent(testEventTable(t, "Transfer", "transfer_events")))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresOutput_Send_Mapped(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	p := &PostgresOutput{db: db, table: "events"}
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS transfer_events").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, p.MapEvent(testEventTable(t, "Transfer", "transfer_events")))
+
+	transfer := transferLog()
+	transfer.Log.BlockNumber = 100
+	transfer.Log.Index = 3
+	transfer.ChainID = "eth-mainnet"
+	approval := DecodedLog{Log: types.Log{BlockNumber: 100, TxHash: common.HexToHash("0x1"), Index: 4}, EventName: "Approval"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO transfer_events (block_number, tx_hash, log_index, contract, chain_id, from_addr, to_addr, value) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) "+
+		"ON CONFLICT (tx_hash, log_index) DO UPDATE SET block_number = EXCLUDED.block_number, contract = EXCLUDED.contract, chain_id = EXCLUDED.chain_id, from_addr = EXCLUDED.from_addr, to_addr = EXCLUDED.to_addr, value = EXCLUDED.value")).
+		WithArgs(uint64(100), transfer.Log.TxHash.Hex(), uint(3), "0xdAC17F958D2ee523a2206206994597C13D831ec7", "eth-mainnet",
+			"0x28C6c06298d514Db089934071355E5743bf21d60", "0x21a31Ee1afC51d94C2eFcCAa2092aD1028285549", "1500000000").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO events").
+		WithArgs(uint64(100), approval.Log.TxHash.Hex(), uint(4), "Approval", sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// The duplicate transfer is upserted once
+	assert.NoError(t, p.Send(context.Background(), []DecodedLog{transfer, approval, transfer}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresOutput_Send_MappedError(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	p := &PostgresOutput{db: db, table: "events"}
+	mock.ExpectExec("CREATE TABLE").WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, p.MapEvent(testEventTable(t, "Transfer", "transfer_events")))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO transfer_events").WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	err := p.Send(context.Background(), []DecodedLog{transferLog()})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Contains(t, err.Error(), "table transfer_events")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPgColumnValue(t *testing.T) {
+	assert.Nil(t, pgColumnValue(nil, "TEXT"))
+	assert.Equal(t, "18446744073709551615", pgColumnValue(uint64(18446744073709551615), "NUMERIC(78)"))
+	assert.Equal(t, int32(-5), pgColumnValue(int32(-5), "BIGINT"))
+	assert.Equal(t, []byte{1, 2}, pgColumnValue([2]byte{1, 2}, "BYTEA"))
+	assert.Equal(t, true, pgColumnValue(true, "BOOLEAN"))
+	assert.JSONEq(t, `["1","2"]`, string(pgColumnValue([]*big.Int{big.NewInt(1), big.NewInt(2)}, "JSONB").(string)))
+}
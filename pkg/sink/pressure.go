@@ -0,0 +1,35 @@
+package sink
+
+// PressureReporter is implemented by outputs buffering events internally,
+// e.g. to deliver them asynchronously. Pressure is how full the buffer is,
+// from 0 (empty) to 1 (full), for the scanner to slow down before Send
+// blocks. See scanner.SetPressure.
+type PressureReporter interface {
+	Pressure() float64
+}
+
+// OutputPressure returns the pressure of out, 0 if it does not buffer events.
+func OutputPressure(out Output) float64 {
+	if r, ok := out.(PressureReporter); ok {
+		return min(max(r.Pressure(), 0), 1)
+	}
+	return 0
+}
+
+// Pressure returns the highest pressure of the outputs: the scanner goes no
+// faster than the slowest of them.
+func (m *MultiSink) Pressure() float64 {
+	var p float64
+	for _, out := range m.outputs {
+		p = max(p, OutputPressure(out))
+	}
+	return p
+}
+
+func (o *InstrumentedOutput) Pressure() float64 { return OutputPressure(o.Output) }
+
+func (f *filterOutput) Pressure() float64 { return OutputPressure(f.Output) }
+
+func (t *transformOutput) Pressure() float64 { return OutputPressure(t.Output) }
+
+func (t *templateOutput) Pressure() float64 { return OutputPressure(t.Output) }
@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pressureOutput is a fakeOutput reporting a fixed pressure.
+type pressureOutput struct {
+	fakeOutput
+	pressure float64
+}
+
+func (p *pressureOutput) Pressure() float64 { return p.pressure }
+
+func TestWebhookOutput_Pressure(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// The queue fills while the receiver is slow
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, Async: true, BufferSize: 4, Workers: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, wo.Pressure())
+	assert.NoError(t, wo.Send(context.Background(), testLogs(3)))
+	assert.Equal(t, 0.75, wo.Pressure())
+
+	// and drains once it catches up
+	close(release)
+	assert.Eventually(t, func() bool { return wo.Pressure() == 0 }, time.Second, time.Millisecond)
+	assert.NoError(t, wo.Close())
+
+	wo, err = NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, wo.Pressure())
+}
+
+func TestKafkaOutput_Pressure(t *testing.T) {
+	k, _ := newTestAsyncKafka(t, 4, false, nil)
+	k.slots <- struct{}{}
+	assert.Equal(t, 0.25, k.Pressure())
+	<-k.slots
+	assert.NoError(t, k.Close())
+
+	assert.Equal(t, 0.0, (&KafkaOutput{}).Pressure())
+}
+
+func TestMultiSink_Pressure(t *testing.T) {
+	// The most pressed output sets the pressure, through the wrappers
+	slow := &pressureOutput{fakeOutput: fakeOutput{name: "slow"}, pressure: 0.9}
+	filtered := WithFilter(slow, func(DecodedLog) bool { return true })
+	templated, err := WithTemplate(&pressureOutput{pressure: 0.5}, "{{.EventName}}")
+	assert.NoError(t, err)
+	instrumented := Instrument(filtered)
+	m := NewMultiSink([]Output{&fakeOutput{name: "console"}, WithTransform(templated, func(l DecodedLog) (DecodedLog, bool) { return l, true }), instrumented})
+	assert.Equal(t, 0.9, m.Pressure())
+	slow.pressure = 2
+	assert.Equal(t, 1.0, m.Pressure())
+	assert.Equal(t, 0.0, OutputPressure(&fakeOutput{}))
+
+	// and is exported with the stats
+	slow.pressure = 0.25
+	var b strings.Builder
+	assert.NoError(t, WritePrometheus(&b, []SinkStats{instrumented.Stats()}))
+	assert.Contains(t, b.String(), "# TYPE scanner_sink_pressure gauge\n")
+	assert.Contains(t, b.String(), `scanner_sink_pressure{sink="slow"} 0.25`)
+}
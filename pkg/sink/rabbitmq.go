@@ -0,0 +1,315 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// rabbitConfirmWindow bounds unconfirmed publishings per wait, which must not
+	// exceed the buffer of the NotifyPublish channel.
+	rabbitConfirmWindow = 256
+	rabbitMaxReconnect  = 30 * time.Second
+)
+
+// RabbitMQConfig holds the configuration for RabbitMQOutput.
+type RabbitMQConfig struct {
+	URL          string
+	Exchange     string
+	ExchangeType string // "topic" (default), "direct", "fanout" or "headers"
+	RoutingKey   string
+	QueueName    string // Declared and bound on (re)connect when set
+	Durable      bool
+
+	// Confirm enables publisher confirms: Send returns only after the broker
+	// acknowledged every message of the batch, giving at-least-once delivery.
+	Confirm        bool
+	ConfirmTimeout time.Duration // Default 10s
+}
+
+// amqpChannel is the subset of *amqp.Channel used by RabbitMQOutput.
+type amqpChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+// RabbitMQOutput implements the Output interface for sending events to RabbitMQ.
+// The connection is re-established in the background when the broker closes it.
+type RabbitMQOutput struct {
+	cfg            RabbitMQConfig
+	connect        func() (io.Closer, amqpChannel, error)
+	reconnectDelay time.Duration
+
+	mu       sync.Mutex // Serializes publishing and (re)connection
+	conn     io.Closer
+	ch       amqpChannel // nil while disconnected
+	confirms chan amqp.Confirmation
+	closed   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRabbitMQOutput initializes a new RabbitMQ output sink.
+func NewRabbitMQOutput(url, exchange, routingKey, queueName string, durable bool) (*RabbitMQOutput, error) {
+	return NewRabbitMQOutputWithConfig(RabbitMQConfig{
+		URL:        url,
+		Exchange:   exchange,
+		RoutingKey: routingKey,
+		QueueName:  queueName,
+		Durable:    durable,
+	})
+}
+
+// NewRabbitMQOutputWithConfig initializes a new RabbitMQ output sink from cfg.
+func NewRabbitMQOutputWithConfig(cfg RabbitMQConfig) (*RabbitMQOutput, error) {
+	return newRabbitMQOutput(cfg, func() (io.Closer, amqpChannel, error) {
+		conn, err := amqp.Dial(cfg.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		return conn, ch, nil
+	})
+}
+
+func newRabbitMQOutput(cfg RabbitMQConfig, connect func() (io.Closer, amqpChannel, error)) (*RabbitMQOutput, error) {
+	switch cfg.ExchangeType {
+	case "":
+		cfg.ExchangeType = amqp.ExchangeTopic
+	case amqp.ExchangeTopic, amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeHeaders:
+	default:
+		return nil, fmt.Errorf("unsupported rabbitmq exchange type: %q", cfg.ExchangeType)
+	}
+	if cfg.ConfirmTimeout <= 0 {
+		cfg.ConfirmTimeout = 10 * time.Second
+	}
+
+	r := &RabbitMQOutput{
+		cfg:            cfg,
+		connect:        connect,
+		reconnectDelay: time.Second,
+		done:           make(chan struct{}),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.setupLocked(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RabbitMQOutput) Name() string { return "rabbitmq" }
+
+func (r *RabbitMQOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	return r.send(ctx, logs, nil)
+}
+
+// SendRaw publishes payloads[i] as the body for logs[i] instead of its JSON encoding.
+func (r *RabbitMQOutput) SendRaw(ctx context.Context, logs []DecodedLog, payloads [][]byte) error {
+	return r.send(ctx, logs, payloads)
+}
+
+func (r *RabbitMQOutput) send(ctx context.Context, logs []DecodedLog, payloads [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return fmt.Errorf("rabbitmq output is closed")
+	}
+	if r.ch == nil {
+		return fmt.Errorf("rabbitmq: not connected, reconnecting")
+	}
+
+	for start := 0; start < len(logs); start += rabbitConfirmWindow {
+		end := start + rabbitConfirmWindow
+		if end > len(logs) {
+			end = len(logs)
+		}
+		for i := start; i < end; i++ {
+			l := logs[i]
+			data, err := encodePayload(l, payloads, i)
+			if err != nil {
+				return err
+			}
+			err = r.ch.PublishWithContext(ctx, r.cfg.Exchange, r.cfg.RoutingKey, false, false, amqp.Publishing{
+				ContentType:  payloadContentType(data),
+				DeliveryMode: amqp.Persistent,
+				Headers: amqp.Table{
+					"event_name":   l.EventName,
+					"block_number": int64(l.Log.BlockNumber),
+				},
+				Body: data,
+			})
+			if err != nil {
+				if errors.Is(err, amqp.ErrClosed) {
+					r.resetLocked()
+				}
+				return err
+			}
+		}
+		if r.cfg.Confirm {
+			if err := r.waitConfirmsLocked(ctx, end-start); err != nil {
+				// Outstanding confirms would be attributed to the next batch, start over
+				r.resetLocked()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *RabbitMQOutput) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	ch, conn := r.ch, r.conn
+	r.ch, r.conn = nil, nil
+	r.mu.Unlock()
+
+	var err error
+	if ch != nil {
+		ch.Close()
+	}
+	if conn != nil {
+		err = conn.Close()
+	}
+	r.wg.Wait()
+	return err
+}
+
+// waitConfirmsLocked waits for the broker to ack the last n publishings.
+func (r *RabbitMQOutput) waitConfirmsLocked(ctx context.Context, n int) error {
+	timer := time.NewTimer(r.cfg.ConfirmTimeout)
+	defer timer.Stop()
+	for i := 0; i < n; i++ {
+		select {
+		case c, ok := <-r.confirms:
+			if !ok {
+				return fmt.Errorf("rabbitmq: channel closed while waiting for confirms")
+			}
+			if !c.Ack {
+				return fmt.Errorf("rabbitmq: message %d was nacked by the broker", c.DeliveryTag)
+			}
+		case <-timer.C:
+			return fmt.Errorf("rabbitmq: timed out waiting for %d publisher confirms", n-i)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// setupLocked connects, declares the topology and starts watching for closes.
+func (r *RabbitMQOutput) setupLocked() error {
+	conn, ch, err := r.connect()
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		ch.Close()
+		conn.Close()
+		return err
+	}
+
+	if r.cfg.Exchange != "" {
+		if err := ch.ExchangeDeclare(r.cfg.Exchange, r.cfg.ExchangeType, r.cfg.Durable, false, false, false, nil); err != nil {
+			return fail(err)
+		}
+	}
+	if r.cfg.QueueName != "" {
+		q, err := ch.QueueDeclare(r.cfg.QueueName, r.cfg.Durable, false, false, false, nil)
+		if err != nil {
+			return fail(err)
+		}
+		if err := ch.QueueBind(q.Name, r.cfg.RoutingKey, r.cfg.Exchange, false, nil); err != nil {
+			return fail(err)
+		}
+	}
+	if r.cfg.Confirm {
+		if err := ch.Confirm(false); err != nil {
+			return fail(err)
+		}
+		r.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, rabbitConfirmWindow))
+	}
+
+	r.conn, r.ch = conn, ch
+	closes := ch.NotifyClose(make(chan *amqp.Error, 1))
+	r.wg.Add(1)
+	go r.watch(ch, closes)
+	return nil
+}
+
+// resetLocked drops the current session; its watcher then reconnects.
+func (r *RabbitMQOutput) resetLocked() {
+	if r.ch == nil {
+		return
+	}
+	r.ch.Close()
+	r.conn.Close()
+	r.ch, r.conn = nil, nil
+}
+
+// watch waits for ch to be closed and re-establishes the session unless the output is closed.
+func (r *RabbitMQOutput) watch(ch amqpChannel, closes chan *amqp.Error) {
+	defer r.wg.Done()
+	select {
+	case <-r.done:
+		return
+	case amqpErr := <-closes:
+		if amqpErr != nil {
+			fmt.Fprintf(os.Stderr, "[RabbitMQ] channel closed: %v, reconnecting\n", amqpErr)
+		}
+	}
+
+	r.mu.Lock()
+	if r.ch == ch {
+		r.resetLocked()
+	}
+	r.mu.Unlock()
+
+	delay := r.reconnectDelay
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(delay):
+		}
+
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			return
+		}
+		err := r.setupLocked()
+		r.mu.Unlock()
+		if err == nil {
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "[RabbitMQ] reconnect failed: %v\n", err)
+		delay *= 2
+		if delay > rabbitMaxReconnect {
+			delay = rabbitMaxReconnect
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAMQPChannel simulates an AMQP channel with optional publisher confirms.
+type fakeAMQPChannel struct {
+	mu        sync.Mutex
+	exchanges []string
+	published []amqp.Publishing
+	confirms  chan amqp.Confirmation
+	notify    []chan *amqp.Error
+	tag       uint64
+	nack      bool
+	noConfirm bool // Never confirm, to simulate a timeout
+	closed    bool
+}
+
+func (f *fakeAMQPChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.exchanges = append(f.exchanges, name+":"+kind)
+	return nil
+}
+
+func (f *fakeAMQPChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+
+func (f *fakeAMQPChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return nil
+}
+
+func (f *fakeAMQPChannel) Confirm(noWait bool) error { return nil }
+
+func (f *fakeAMQPChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	f.confirms = confirm
+	return confirm
+}
+
+func (f *fakeAMQPChannel) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notify = append(f.notify, receiver)
+	return receiver
+}
+
+func (f *fakeAMQPChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return amqp.ErrClosed
+	}
+	f.published = append(f.published, msg)
+	if f.confirms != nil && !f.noConfirm {
+		f.tag++
+		f.confirms <- amqp.Confirmation{DeliveryTag: f.tag, Ack: !f.nack}
+	}
+	return nil
+}
+
+func (f *fakeAMQPChannel) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		for _, c := range f.notify {
+			close(c)
+		}
+	}
+	return nil
+}
+
+// drop simulates the broker closing the channel.
+func (f *fakeAMQPChannel) drop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for _, c := range f.notify {
+		c <- &amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restart"}
+	}
+}
+
+// fakeAMQPBroker hands out a new fakeAMQPChannel per connection.
+type fakeAMQPBroker struct {
+	mu       sync.Mutex
+	channels []*fakeAMQPChannel
+	setup    func(*fakeAMQPChannel)
+}
+
+func (b *fakeAMQPBroker) connect() (io.Closer, amqpChannel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := &fakeAMQPChannel{}
+	if b.setup != nil {
+		b.setup(ch)
+	}
+	b.channels = append(b.channels, ch)
+	return io.NopCloser(nil), ch, nil
+}
+
+func (b *fakeAMQPBroker) connections() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.channels)
+}
+
+func (b *fakeAMQPBroker) last() *fakeAMQPChannel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.channels[len(b.channels)-1]
+}
+
+func TestRabbitMQOutput_ConfirmAndHeaders(t *testing.T) {
+	broker := &fakeAMQPBroker{}
+	r, err := newRabbitMQOutput(RabbitMQConfig{Exchange: "events", ExchangeType: "headers", Confirm: true}, broker.connect)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	logs := []DecodedLog{{Log: types.Log{BlockNumber: 42}, EventName: "Transfer"}}
+	assert.NoError(t, r.Send(context.Background(), logs))
+
+	ch := broker.last()
+	assert.Equal(t, []string{"events:headers"}, ch.exchanges)
+	assert.Len(t, ch.published, 1)
+	assert.Equal(t, "Transfer", ch.published[0].Headers["event_name"])
+	assert.Equal(t, int64(42), ch.published[0].Headers["block_number"])
+}
+
+func TestRabbitMQOutput_Nack(t *testing.T) {
+	broker := &fakeAMQPBroker{setup: func(ch *fakeAMQPChannel) { ch.nack = true }}
+	r, err := newRabbitMQOutput(RabbitMQConfig{Confirm: true}, broker.connect)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	err = r.Send(context.Background(), testLogs(1))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "nacked")
+}
+
+func TestRabbitMQOutput_ConfirmTimeout(t *testing.T) {
+	broker := &fakeAMQPBroker{setup: func(ch *fakeAMQPChannel) { ch.noConfirm = true }}
+	r, err := newRabbitMQOutput(RabbitMQConfig{Confirm: true, ConfirmTimeout: 10 * time.Millisecond}, broker.connect)
+	assert.NoError(t, err)
+	r.reconnectDelay = time.Millisecond
+	defer r.Close()
+
+	err = r.Send(context.Background(), testLogs(2))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+
+	// The session with unaccounted confirms is replaced
+	assert.Eventually(t, func() bool { return broker.connections() == 2 }, time.Second, time.Millisecond)
+}
+
+func TestRabbitMQOutput_Reconnect(t *testing.T) {
+	broker := &fakeAMQPBroker{}
+	r, err := newRabbitMQOutput(RabbitMQConfig{Exchange: "events", Confirm: true}, broker.connect)
+	assert.NoError(t, err)
+	r.reconnectDelay = time.Millisecond
+	defer r.Close()
+
+	first := broker.last()
+	first.drop()
+
+	assert.Eventually(t, func() bool { return broker.connections() == 2 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return r.Send(context.Background(), testLogs(1)) == nil }, time.Second, time.Millisecond)
+
+	// Topology re-declared on the new channel
+	second := broker.last()
+	assert.Equal(t, []string{"events:topic"}, second.exchanges)
+	assert.Len(t, second.published, 1)
+	assert.Empty(t, first.published)
+}
+
+func TestRabbitMQOutput_Close(t *testing.T) {
+	broker := &fakeAMQPBroker{}
+	r, err := newRabbitMQOutput(RabbitMQConfig{}, broker.connect)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Close())
+	assert.NoError(t, r.Close())
+	assert.Error(t, r.Send(context.Background(), testLogs(1)))
+
+	// No reconnect after Close
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, broker.connections())
+}
+
+func TestRabbitMQOutput_Config(t *testing.T) {
+	broker := &fakeAMQPBroker{}
+	_, err := newRabbitMQOutput(RabbitMQConfig{ExchangeType: "x-delayed"}, broker.connect)
+	assert.Error(t, err)
+
+	_, err = newRabbitMQOutput(RabbitMQConfig{}, func() (io.Closer, amqpChannel, error) {
+		return nil, nil, errors.New("connection refused")
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// replayFile writes n events of blocks 1..n through the file output,
+// alternating between Transfer and Approval events.
+func replayFile(t *testing.T, n int) string {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	fo, err := NewFileOutput(path)
+	assert.NoError(t, err)
+	logs := make([]DecodedLog, n)
+	for i := range logs {
+		name := "Transfer"
+		if i%2 == 1 {
+			name = "Approval"
+		}
+		logs[i] = DecodedLog{
+			Log:         types.Log{BlockNumber: uint64(i + 1), Index: uint(i), Topics: []common.Hash{}},
+			EventName:   name,
+			DecodedData: &decoder.DecodedLog{Name: name, Inputs: map[string]interface{}{"value": big.NewInt(int64(i) * 1e18)}},
+			ChainID:     "eth-mainnet",
+		}
+	}
+	assert.NoError(t, fo.Send(context.Background(), logs))
+	assert.NoError(t, fo.Close())
+	return path
+}
+
+func replayed(batches *[][]DecodedLog) *recordingOutput {
+	return &recordingOutput{fakeOutput: fakeOutput{name: "kafka"}, fn: func(logs []DecodedLog) {
+		*batches = append(*batches, append([]DecodedLog(nil), logs...))
+	}}
+}
+
+func TestReplay(t *testing.T) {
+	f, err := os.Open(replayFile(t, 10))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var batches [][]DecodedLog
+	var checkpoints []int64
+	stats, err := Replay(context.Background(), f, replayed(&batches), ReplayOptions{
+		BatchSize:  4,
+		Checkpoint: func(offset int64) error { checkpoints = append(checkpoints, offset); return nil },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, stats.Read)
+	assert.Equal(t, 10, stats.Sent)
+	assert.Len(t, batches, 3)
+	assert.Len(t, batches[2], 2)
+
+	first := batches[0][0]
+	assert.Equal(t, "Transfer", first.EventName)
+	assert.Equal(t, "eth-mainnet", first.ChainID)
+	assert.Equal(t, "0", first.DecodedData.Inputs["value"])
+	assert.Equal(t, "9000000000000000000", batches[2][1].DecodedData.Inputs["value"])
+
+	info, _ := f.Stat()
+	assert.Equal(t, info.Size(), stats.Offset)
+	assert.Equal(t, info.Size(), checkpoints[len(checkpoints)-1])
+}
+
+func TestReplay_Filter(t *testing.T) {
+	data, err := os.ReadFile(replayFile(t, 10))
+	assert.NoError(t, err)
+
+	var batches [][]DecodedLog
+	stats, err := Replay(context.Background(), bytes.NewReader(data), replayed(&batches), ReplayOptions{
+		FromBlock: 3,
+		ToBlock:   8,
+		Events:    []string{"Transfer"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, stats.Read)
+	assert.Equal(t, 7, stats.Skipped)
+	assert.Equal(t, 3, stats.Sent)
+	var blocks []uint64
+	for _, l := range batches[0] {
+		blocks = append(blocks, l.Log.BlockNumber)
+	}
+	assert.Equal(t, []uint64{3, 5, 7}, blocks)
+
+	_, err = Replay(context.Background(), bytes.NewReader(data), replayed(&batches), ReplayOptions{FromBlock: 5, ToBlock: 4})
+	assert.Error(t, err)
+}
+
+func TestReplay_DryRun(t *testing.T) {
+	data, err := os.ReadFile(replayFile(t, 5))
+	assert.NoError(t, err)
+
+	stats, err := Replay(context.Background(), bytes.NewReader(data), nil, ReplayOptions{DryRun: true, Events: []string{"Approval"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Sent)
+	assert.Equal(t, 3, stats.Skipped)
+
+	_, err = Replay(context.Background(), bytes.NewReader(data), nil, ReplayOptions{})
+	assert.EqualError(t, err, "replay: no output")
+}
+
+func TestReplay_Resume(t *testing.T) {
+	data, err := os.ReadFile(replayFile(t, 10))
+	assert.NoError(t, err)
+
+	// The second batch fails: the replay stops after the first
+	var batches [][]DecodedLog
+	out := &failAfter{Output: replayed(&batches), ok: 1}
+	stats, err := Replay(context.Background(), bytes.NewReader(data), out, ReplayOptions{BatchSize: 3})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "replay: send to kafka: broker down")
+	assert.Equal(t, 3, stats.Sent)
+	lines := strings.SplitAfter(string(data), "\n")
+	assert.Equal(t, int64(len(strings.Join(lines[:3], ""))), stats.Offset)
+
+	// Resuming from the offset, through a reader that cannot seek, sends the rest
+	batches = nil
+	stats, err = Replay(context.Background(), io.MultiReader(bytes.NewReader(data)), replayed(&batches), ReplayOptions{BatchSize: 100, Offset: stats.Offset})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, stats.Sent)
+	assert.Equal(t, uint64(4), batches[0][0].Log.BlockNumber)
+
+	_, err = Replay(context.Background(), io.MultiReader(strings.NewReader("{}")), replayed(&batches), ReplayOptions{Offset: 10})
+	assert.ErrorContains(t, err, "seek to offset 10")
+}
+
+func TestReplay_RateLimit(t *testing.T) {
+	data, err := os.ReadFile(replayFile(t, 6))
+	assert.NoError(t, err)
+
+	var batches [][]DecodedLog
+	start := time.Now()
+	_, err = Replay(context.Background(), bytes.NewReader(data), replayed(&batches), ReplayOptions{BatchSize: 2, RateLimit: 40})
+	assert.NoError(t, err)
+	// The first batch uses the burst, the other 4 events wait 25ms each
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestReplay_InvalidLine(t *testing.T) {
+	var batches [][]DecodedLog
+	_, err := Replay(context.Background(), strings.NewReader("\nnot json\n"), replayed(&batches), ReplayOptions{})
+	assert.ErrorContains(t, err, "replay: invalid event at offset 1")
+}
+
+// failAfter fails every Send after the first ok ones.
+type failAfter struct {
+	Output
+	ok int
+}
+
+func (f *failAfter) Send(ctx context.Context, logs []DecodedLog) error {
+	if f.ok == 0 {
+		return errors.New("broker down")
+	}
+	f.ok--
+	return f.Output.Send(ctx, logs)
+}
@@ -0,0 +1,442 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/parquet-go/parquet-go"
+)
+
+// DefaultS3Prefix partitions objects by chain, UTC date and hour, e.g.
+// "chain=eth-mainnet/date=2024-05-01/hour=13".
+const DefaultS3Prefix = "chain={{.Chain}}/date={{.Date}}/hour={{.Hour}}"
+
+// s3MinPartSize is the smallest part S3 accepts in a multipart upload (except the last).
+const s3MinPartSize = 5 << 20
+
+// S3Config holds the configuration for S3Output.
+type S3Config struct {
+	Bucket string
+	// Prefix is a text/template for the key prefix of each event's object,
+	// with .Chain, .EventName, .Date (2006-01-02), .Hour (15), .Year, .Month
+	// and .Day taken from the block timestamp (or the time the event was
+	// buffered when the node does not report it). Defaults to DefaultS3Prefix.
+	Prefix string
+	// Format is "jsonl" (default, gzip compressed) or "parquet".
+	Format string
+
+	FlushSize     int           // Events buffered per prefix before writing an object, default 10000
+	FlushInterval time.Duration // Maximum age of a buffered event, default 5m
+	MaxAttempts   int           // Upload attempts per object, default 3
+	PartSize      int64         // Objects above this size use multipart uploads, default 8 MiB (min 5 MiB)
+
+	AWS          aws.Config
+	Endpoint     string // S3-compatible endpoint, e.g. "http://localhost:9000" for MinIO
+	UsePathStyle bool   // Bucket in the path instead of the host name, required by most S3-compatible stores
+}
+
+// s3API is the subset of *s3.Client used by S3Output.
+type s3API interface {
+	PutObject(ctx context.Context, in *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, in *s3.CreateMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, in *s3.UploadPartInput, opts ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, opts ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, in *s3.AbortMultipartUploadInput, opts ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// S3Output implements the Output interface for writing events to S3 or an
+// S3-compatible object store. Events are buffered per key prefix and written
+// as one object once FlushSize events are buffered, the oldest event is
+// FlushInterval old, or the output is closed.
+//
+// Objects are named after their first event ("part-<block>-<log index>"), so
+// replaying a range after a restart overwrites rather than duplicates them.
+// The date placeholders of the prefix are taken from the block timestamp for
+// the same reason: logs without one are rejected with ErrNoBlockTime by a
+// prefix using them, see scanner.Config.BlockTimestamps.
+type S3Output struct {
+	client  s3API
+	cfg     S3Config
+	prefix  *template.Template
+	backoff time.Duration // Initial delay between upload attempts
+
+	mu    sync.Mutex
+	parts map[string]*s3Partition
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// s3Partition buffers the events of one key prefix.
+type s3Partition struct {
+	prefix string
+	logs   []DecodedLog
+	since  time.Time // When the oldest buffered event arrived
+}
+
+// NewS3Output initializes an S3 output sink writing to bucket.
+func NewS3Output(bucket, prefixTemplate, format string, flushSize int, flushInterval time.Duration, awsCfg aws.Config) (*S3Output, error) {
+	return NewS3OutputWithConfig(S3Config{
+		Bucket:        bucket,
+		Prefix:        prefixTemplate,
+		Format:        format,
+		FlushSize:     flushSize,
+		FlushInterval: flushInterval,
+		AWS:           awsCfg,
+	})
+}
+
+// NewS3OutputWithConfig initializes an S3 output sink from cfg.
+func NewS3OutputWithConfig(cfg S3Config) (*S3Output, error) {
+	if cfg.PartSize != 0 && cfg.PartSize < s3MinPartSize {
+		return nil, fmt.Errorf("s3 part size must be at least %d bytes", s3MinPartSize)
+	}
+	client := s3.NewFromConfig(cfg.AWS, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+	return newS3Output(client, cfg)
+}
+
+func newS3Output(client s3API, cfg S3Config) (*S3Output, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = FormatJSONL
+	case FormatJSONL, FormatParquet:
+	default:
+		return nil, fmt.Errorf("unsupported s3 format: %q", cfg.Format)
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultS3Prefix
+	}
+	prefix, err := template.New("s3").Option("missingkey=error").Parse(cfg.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 prefix: %w", err)
+	}
+	if cfg.FlushSize <= 0 {
+		cfg.FlushSize = 10000
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Minute
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = 8 << 20
+	}
+
+	s := &S3Output{
+		client:  client,
+		cfg:     cfg,
+		prefix:  prefix,
+		backoff: time.Second,
+		parts:   make(map[string]*s3Partition),
+		done:    make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.flushLoop()
+	return s, nil
+}
+
+func (s *S3Output) Name() string { return "s3" }
+
+// Send buffers logs and writes the objects of prefixes that reached
+// FlushSize. When a write fails, the logs of this call are removed from the
+// buffer again so that retrying the batch does not duplicate them.
+func (s *S3Output) Send(ctx context.Context, logs []DecodedLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	before := make(map[string]int) // Buffered events per touched prefix before this call
+	for _, l := range logs {
+		prefix, err := s.render(l)
+		if err != nil {
+			s.rollback(before)
+			return err
+		}
+		p, ok := s.parts[prefix]
+		if !ok {
+			p = &s3Partition{prefix: prefix, since: now}
+			s.parts[prefix] = p
+		}
+		if _, ok := before[prefix]; !ok {
+			before[prefix] = len(p.logs)
+		}
+		p.logs = append(p.logs, l)
+	}
+
+	for _, prefix := range sortedKeys(before) {
+		p := s.parts[prefix]
+		if len(p.logs) < s.cfg.FlushSize {
+			continue
+		}
+		if err := s.flushLocked(ctx, p); err != nil {
+			s.rollback(before)
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback truncates the touched partitions to their previous length.
+func (s *S3Output) rollback(before map[string]int) {
+	for prefix, n := range before {
+		p, ok := s.parts[prefix]
+		if !ok {
+			continue // Already written
+		}
+		if n == 0 {
+			delete(s.parts, prefix)
+			continue
+		}
+		p.logs = p.logs[:n]
+	}
+}
+
+// Flush writes all buffered events.
+func (s *S3Output) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, prefix := range sortedKeys(s.parts) {
+		if err := s.flushLocked(ctx, s.parts[prefix]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the flush loop and writes the buffered events. Later calls only
+// write what was buffered since.
+func (s *S3Output) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.wg.Wait()
+	return s.Flush(context.Background())
+}
+
+func (s *S3Output) flushLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(max(s.cfg.FlushInterval/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.flushExpired()
+		}
+	}
+}
+
+// flushExpired writes prefixes whose oldest event is FlushInterval old. Failed
+// objects stay buffered and are retried on the next tick.
+func (s *S3Output) flushExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, prefix := range sortedKeys(s.parts) {
+		p := s.parts[prefix]
+		if time.Since(p.since) < s.cfg.FlushInterval {
+			continue
+		}
+		if err := s.flushLocked(context.Background(), p); err != nil {
+			fmt.Fprintf(os.Stderr, "[S3 Flush Error] %s: %v\n", prefix, err)
+		}
+	}
+}
+
+// flushLocked writes p as one object and drops it from the buffer.
+func (s *S3Output) flushLocked(ctx context.Context, p *s3Partition) error {
+	body, err := s.encode(p.logs)
+	if err != nil {
+		return err
+	}
+	key := path.Join(p.prefix, s.objectName(p.logs[0]))
+	if err := s.upload(ctx, key, body); err != nil {
+		return fmt.Errorf("s3 object %s: %w", key, err)
+	}
+	delete(s.parts, p.prefix)
+	return nil
+}
+
+// s3PrefixData is passed to the prefix template. The date placeholders are
+// methods so that only prefixes using them need the block timestamp.
+type s3PrefixData struct {
+	Chain, EventName string
+	block            uint64 // Block timestamp, 0 when unknown
+}
+
+func (d s3PrefixData) format(layout string) (string, error) {
+	if d.block == 0 {
+		return "", ErrNoBlockTime
+	}
+	return time.Unix(int64(d.block), 0).UTC().Format(layout), nil
+}
+
+func (d s3PrefixData) Date() (string, error)  { return d.format("2006-01-02") }
+func (d s3PrefixData) Hour() (string, error)  { return d.format("15") }
+func (d s3PrefixData) Year() (string, error)  { return d.format("2006") }
+func (d s3PrefixData) Month() (string, error) { return d.format("01") }
+func (d s3PrefixData) Day() (string, error)   { return d.format("02") }
+
+func (s *S3Output) render(l DecodedLog) (string, error) {
+	data := s3PrefixData{
+		Chain:     l.ChainID,
+		EventName: l.EventName,
+		block:     l.Log.BlockTimestamp,
+	}
+	if data.Chain == "" {
+		data.Chain = "unknown"
+	}
+	if data.EventName == "" {
+		data.EventName = "unknown"
+	}
+	var b strings.Builder
+	if err := s.prefix.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("s3 prefix: %w", err)
+	}
+	return strings.Trim(b.String(), "/"), nil
+}
+
+func (s *S3Output) objectName(first DecodedLog) string {
+	ext := ".jsonl.gz"
+	if s.cfg.Format == FormatParquet {
+		ext = ".parquet"
+	}
+	return fmt.Sprintf("part-%012d-%06d%s", first.Log.BlockNumber, first.Log.Index, ext)
+}
+
+func (s *S3Output) encode(logs []DecodedLog) ([]byte, error) {
+	var buf bytes.Buffer
+	if s.cfg.Format == FormatParquet {
+		w := &parquetWriter{pw: parquet.NewGenericWriter[fileRow](&buf)}
+		if err := w.WriteLogs(logs); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	gz := gzip.NewWriter(&buf)
+	if err := (&jsonlWriter{w: gz}).WriteLogs(logs); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *S3Output) contentType() string {
+	if s.cfg.Format == FormatParquet {
+		return "application/vnd.apache.parquet"
+	}
+	return "application/gzip"
+}
+
+// upload writes body to key, retrying the whole object with exponential backoff.
+func (s *S3Output) upload(ctx context.Context, key string, body []byte) error {
+	backoff := s.backoff
+	var err error
+	for attempt := 1; attempt <= s.cfg.MaxAttempts; attempt++ {
+		if int64(len(body)) > s.cfg.PartSize {
+			err = s.multipartUpload(ctx, key, body)
+		} else {
+			_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+				Bucket:      aws.String(s.cfg.Bucket),
+				Key:         aws.String(key),
+				Body:        bytes.NewReader(body),
+				ContentType: aws.String(s.contentType()),
+			})
+		}
+		if err == nil || attempt == s.cfg.MaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+func (s *S3Output) multipartUpload(ctx context.Context, key string, body []byte) error {
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.cfg.Bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(s.contentType()),
+	})
+	if err != nil {
+		return err
+	}
+	var parts []types.CompletedPart
+	for start, n := int64(0), int32(1); start < int64(len(body)); start, n = start+s.cfg.PartSize, n+1 {
+		end := min(start+s.cfg.PartSize, int64(len(body)))
+		out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.cfg.Bucket),
+			Key:        aws.String(key),
+			UploadId:   created.UploadId,
+			PartNumber: aws.Int32(n),
+			Body:       bytes.NewReader(body[start:end]),
+		})
+		if err != nil {
+			s.abort(key, created.UploadId)
+			return fmt.Errorf("part %d: %w", n, err)
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(n)})
+	}
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.cfg.Bucket),
+		Key:             aws.String(key),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		s.abort(key, created.UploadId)
+	}
+	return err
+}
+
+// abort releases the parts of a failed multipart upload. It runs detached from
+// the send context, which may be what cancelled the upload.
+func (s *S3Output) abort(key string, uploadID *string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _ = s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.cfg.Bucket),
+		Key:      aws.String(key),
+		UploadId: uploadID,
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,270 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 stores objects in memory. The first failPuts uploads fail.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	failPuts int
+	puts     int
+	parts    map[string][][]byte // Upload id -> parts
+	aborted  int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: make(map[string][]byte), parts: make(map[string][][]byte)}
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.puts++
+	if f.failPuts > 0 {
+		f.failPuts--
+		return nil, errors.New("503 SlowDown")
+	}
+	body, _ := io.ReadAll(in.Body)
+	f.objects[*in.Key] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("upload-%d", len(f.parts))
+	f.parts[id] = nil
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3) UploadPart(ctx context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(in.Body)
+	f.parts[*in.UploadId] = append(f.parts[*in.UploadId], body)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", *in.PartNumber))}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(in.MultipartUpload.Parts) != len(f.parts[*in.UploadId]) {
+		return nil, errors.New("part count mismatch")
+	}
+	f.objects[*in.Key] = bytes.Join(f.parts[*in.UploadId], nil)
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedKeys(f.objects)
+}
+
+func (f *fakeS3) jsonl(t *testing.T, key string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	gz, err := gzip.NewReader(bytes.NewReader(f.objects[key]))
+	assert.NoError(t, err)
+	data, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// s3Logs returns n logs of chain eth-mainnet at 2024-05-01 13:xx UTC.
+func s3Logs(n int) []DecodedLog {
+	logs := make([]DecodedLog, n)
+	for i := range logs {
+		logs[i] = DecodedLog{
+			Log: types.Log{
+				BlockNumber:    uint64(100 + i),
+				BlockTimestamp: uint64(time.Date(2024, 5, 1, 13, i, 0, 0, time.UTC).Unix()),
+			},
+			EventName: "Transfer",
+			ChainID:   "eth-mainnet",
+		}
+	}
+	return logs
+}
+
+func TestS3Output_FlushSize(t *testing.T) {
+	fake := newFakeS3()
+	s, err := newS3Output(fake, S3Config{Bucket: "lake", Prefix: "events/" + DefaultS3Prefix, FlushSize: 3, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, "s3", s.Name())
+
+	logs := s3Logs(3)
+	assert.NoError(t, s.Send(context.Background(), logs[:2]))
+	assert.Empty(t, fake.keys())
+
+	assert.NoError(t, s.Send(context.Background(), logs[2:]))
+	key := "events/chain=eth-mainnet/date=2024-05-01/hour=13/part-000000000100-000000.jsonl.gz"
+	assert.Equal(t, []string{key}, fake.keys())
+	assert.Len(t, fake.jsonl(t, key), 3)
+	assert.Contains(t, fake.jsonl(t, key)[0], `"chain_id":"eth-mainnet"`)
+	assert.NoError(t, s.Close())
+}
+
+func TestS3Output_PartitionsAndClose(t *testing.T) {
+	fake := newFakeS3()
+	s, err := newS3Output(fake, S3Config{Bucket: "lake", FlushInterval: time.Hour})
+	assert.NoError(t, err)
+
+	logs := s3Logs(2)
+	logs[1].Log.BlockTimestamp += 3600
+	logs[1].ChainID = ""
+	assert.NoError(t, s.Send(context.Background(), logs))
+	assert.Empty(t, fake.keys())
+
+	// Close writes what is left
+	assert.NoError(t, s.Close())
+	assert.Equal(t, []string{
+		"chain=eth-mainnet/date=2024-05-01/hour=13/part-000000000100-000000.jsonl.gz",
+		"chain=unknown/date=2024-05-01/hour=14/part-000000000101-000000.jsonl.gz",
+	}, fake.keys())
+}
+
+func TestS3Output_PartitionByBlockTime(t *testing.T) {
+	fake := newFakeS3()
+	s, err := newS3Output(fake, S3Config{Bucket: "lake", FlushSize: 1, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+
+	// Without a block time the date is unknown: the wall clock would put a
+	// replay in another partition, a second copy of the events
+	l := s3Logs(1)[0]
+	l.Log.BlockTimestamp = 0
+	assert.ErrorIs(t, s.Send(context.Background(), []DecodedLog{l}), ErrNoBlockTime)
+	assert.Empty(t, s.parts)
+
+	// Replays overwrite the object, whenever they happen
+	l = s3Logs(1)[0]
+	assert.NoError(t, s.Send(context.Background(), []DecodedLog{l}))
+	assert.NoError(t, s.Send(context.Background(), []DecodedLog{l}))
+	assert.Equal(t, []string{"chain=eth-mainnet/date=2024-05-01/hour=13/part-000000000100-000000.jsonl.gz"}, fake.keys())
+	assert.Equal(t, 2, fake.puts)
+	assert.NoError(t, s.Close())
+	assert.NoError(t, s.Close())
+
+	// Prefixes without dates take any log
+	s, err = newS3Output(fake, S3Config{Bucket: "lake", Prefix: "{{.Chain}}/{{.EventName}}", FlushSize: 1, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	l.Log.BlockTimestamp = 0
+	assert.NoError(t, s.Send(context.Background(), []DecodedLog{l}))
+	assert.Contains(t, fake.keys(), "eth-mainnet/Transfer/part-000000000100-000000.jsonl.gz")
+	assert.NoError(t, s.Close())
+}
+
+func TestS3Output_FlushInterval(t *testing.T) {
+	fake := newFakeS3()
+	s, err := newS3Output(fake, S3Config{Bucket: "lake", FlushInterval: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.NoError(t, s.Send(context.Background(), s3Logs(1)))
+	assert.Eventually(t, func() bool { return len(fake.keys()) == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestS3Output_Retry(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPuts = 2
+	s, err := newS3Output(fake, S3Config{Bucket: "lake", FlushSize: 1, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	s.backoff = time.Millisecond
+
+	assert.NoError(t, s.Send(context.Background(), s3Logs(1)))
+	assert.Equal(t, 3, fake.puts)
+	assert.Len(t, fake.keys(), 1)
+	assert.NoError(t, s.Close())
+}
+
+func TestS3Output_FailureRollsBack(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPuts = 3
+	s, err := newS3Output(fake, S3Config{Bucket: "lake", FlushSize: 2, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	s.backoff = time.Millisecond
+
+	logs := s3Logs(2)
+	assert.NoError(t, s.Send(context.Background(), logs[:1]))
+	err = s.Send(context.Background(), logs[1:])
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "503 SlowDown")
+
+	// Only the event of the failed call is dropped, so retrying it does not duplicate
+	assert.NoError(t, s.Send(context.Background(), logs[1:]))
+	key := "chain=eth-mainnet/date=2024-05-01/hour=13/part-000000000100-000000.jsonl.gz"
+	assert.Len(t, fake.jsonl(t, key), 2)
+	assert.NoError(t, s.Close())
+}
+
+func TestS3Output_Multipart(t *testing.T) {
+	fake := newFakeS3()
+	s, err := newS3Output(fake, S3Config{Bucket: "lake", FlushSize: 50, FlushInterval: time.Hour, PartSize: 512})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Send(context.Background(), s3Logs(50)))
+	assert.Equal(t, 0, fake.puts)
+	assert.Greater(t, len(fake.parts["upload-0"]), 1)
+	key := "chain=eth-mainnet/date=2024-05-01/hour=13/part-000000000100-000000.jsonl.gz"
+	assert.Len(t, fake.jsonl(t, key), 50)
+	assert.NoError(t, s.Close())
+}
+
+func TestS3Output_Parquet(t *testing.T) {
+	fake := newFakeS3()
+	s, err := newS3Output(fake, S3Config{Bucket: "lake", Format: FormatParquet, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send(context.Background(), s3Logs(2)))
+	assert.NoError(t, s.Close())
+
+	key := "chain=eth-mainnet/date=2024-05-01/hour=13/part-000000000100-000000.parquet"
+	assert.Equal(t, []string{key}, fake.keys())
+	data := fake.objects[key]
+	rows, err := parquet.Read[fileRow](bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, uint64(101), rows[1].BlockNumber)
+}
+
+func TestS3Output_Config(t *testing.T) {
+	_, err := newS3Output(newFakeS3(), S3Config{})
+	assert.EqualError(t, err, "s3 bucket is required")
+
+	_, err = newS3Output(newFakeS3(), S3Config{Bucket: "lake", Format: "csv"})
+	assert.EqualError(t, err, `unsupported s3 format: "csv"`)
+
+	_, err = newS3Output(newFakeS3(), S3Config{Bucket: "lake", Prefix: "{{.Chain"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid s3 prefix")
+
+	_, err = NewS3OutputWithConfig(S3Config{Bucket: "lake", PartSize: 1024})
+	assert.Error(t, err)
+
+	s, err := NewS3Output("lake", "", "", 0, 0, aws.Config{Region: "us-east-1"})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+}
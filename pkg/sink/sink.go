@@ -4,19 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/84hero/evm-scanner/internal/webhook"
 	"github.com/84hero/evm-scanner/pkg/decoder"
-	"github.com/IBM/sarama"
+	"github.com/84hero/evm-scanner/pkg/redisconfig"
+	"github.com/84hero/evm-scanner/pkg/scanner"
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
 	"github.com/ethereum/go-ethereum/core/types"
 	_ "github.com/lib/pq"
-	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/semaphore"
 )
 
 // DecodedLog wraps raw log and its decoded result for structured output.
@@ -24,6 +32,28 @@ type DecodedLog struct {
 	Log         types.Log           `json:"log"`
 	DecodedData *decoder.DecodedLog `json:"decoded,omitempty"`
 	EventName   string              `json:"event_name,omitempty"`
+	// ChainID identifies the chain the log was scanned from, as configured in
+	// scanner.chain_id (e.g. "eth-mainnet"). Empty when not set.
+	ChainID string `json:"chain_id,omitempty"`
+	// NumericChainID is the EIP-155 chain id (e.g. 1), 0 when unknown.
+	NumericChainID uint64 `json:"numeric_chain_id,omitempty"`
+	// DecodeStatus tells decoded logs from those of unknown events and those
+	// that failed to decode, see StatusDecoded; DecodeError holds the reason.
+	// Both are empty when the log did not go through a Decoder.
+	DecodeStatus string `json:"decode_status,omitempty"`
+	DecodeError  string `json:"decode_error,omitempty"`
+	// Unconfirmed marks the logs of blocks that may still be reorganized
+	// away, those of a scanner tail handler. See scanner.SetTailHandler.
+	Unconfirmed bool `json:"unconfirmed,omitempty"`
+	// Replayed marks the logs of blocks reprocessed after they were first
+	// delivered, e.g. by a rescan, so that idempotent outputs can upsert
+	// them. See WithReplayed.
+	Replayed bool `json:"replayed,omitempty"`
+	// Provenance tells which nodes served the batch of the log and when,
+	// set by decoders configured with DecoderConfig.Provenance.
+	Provenance *scanner.Provenance `json:"provenance,omitempty"`
+
+	numbers NumberFormat // See WithNumberFormat
 }
 
 // Output defines the interface for event output pipeline
@@ -33,16 +63,80 @@ type Output interface {
 	Close() error
 }
 
+// DeadLetterFunc receives events that an asynchronous output failed to deliver
+// after its Send had already returned, e.g. to persist them for replay.
+type DeadLetterFunc func(l DecodedLog, err error)
+
 // --- 1. Webhook Output ---
 
+// ErrWebhookClosed is returned by Send on a WebhookOutput that has been closed.
+var ErrWebhookClosed = errors.New("webhook output is closed")
+
 // WebhookOutput implements the Output interface for sending events to a web service.
 type WebhookOutput struct {
-	client   *webhook.Client
-	async    bool
-	queue    chan []types.Log
-	wg       sync.WaitGroup
-	closed   bool
-	closedMu sync.Mutex
+	client      *webhook.Client
+	encoder     WebhookEncoder // Nil for the built-in payload
+	contentType string         // Of the bodies of encoder, detected when empty
+
+	// Async mode
+	async        bool
+	queue        chan webhookJob
+	buffer       *semaphore.Weighted // Events queued or in flight
+	capacity     int64
+	drainTimeout time.Duration
+	deadLetter   DeadLetterFunc
+	ctx          context.Context // Cancelled when draining on Close times out
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	closed       bool
+	closedMu     sync.RWMutex   // Guards closed against concurrent Send
+	closing      chan struct{}  // Closed by Shutdown, waking the blocked Sends
+	senders      sync.WaitGroup // Sends past the closed check, see dispatch
+
+	pending   atomic.Int64
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// WebhookSender sends the request bodies of a WebhookOutput instead of its
+// HTTP client, e.g. as signed requests to an internal API. An error is
+// retried with the backoff of the output. See WebhookConfig.Sender.
+type WebhookSender interface {
+	Send(ctx context.Context, body []byte) error
+}
+
+// WebhookEncoder renders events, all from the same chain, into the request
+// bodies of a WebhookOutput, sent in order. See WebhookConfig.Encoder.
+type WebhookEncoder func(logs []DecodedLog) ([][]byte, error)
+
+// WebhookSignature returns the X-Scanner-Signature header of body sent at
+// timestamp, the X-Scanner-Timestamp header in Unix seconds, signed with
+// secret, e.g. for a WebhookSender to sign its requests the same way. See the
+// API reference for the scheme.
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	return webhook.Sign([]byte(secret), timestamp, body)
+}
+
+// Errors of VerifyWebhookSignature.
+var (
+	ErrWebhookSignature = webhook.ErrSignature
+	ErrWebhookTimestamp = webhook.ErrStaleTimestamp
+)
+
+// VerifyWebhookSignature checks the signature and timestamp headers of a
+// webhook request of body signed with secret, for receivers: it fails with
+// ErrWebhookSignature unless the signature matches, and with
+// ErrWebhookTimestamp if the request was signed further than tolerance from
+// now, e.g. a replay.
+func VerifyWebhookSignature(secret, signature, timestamp string, body []byte, tolerance time.Duration) error {
+	return webhook.Verify([]byte(secret), signature, timestamp, body, tolerance, time.Now())
+}
+
+// WebhookStats reports the state of an async WebhookOutput.
+type WebhookStats struct {
+	QueueDepth int    // Events queued or being delivered
+	Delivered  uint64 // Events delivered by the workers
+	Dropped    uint64 // Events that failed delivery and went to the dead-letter handler
 }
 
 // WebhookConfig holds the configuration for WebhookOutput.
@@ -50,38 +144,144 @@ type WebhookConfig struct {
 	URL            string
 	Secret         string
 	MaxAttempts    int
-	InitialBackoff string
-	MaxBackoff     string
+	InitialBackoff time.Duration // 1s when 0
+	MaxBackoff     time.Duration // 10s when 0
 	Async          bool
-	BufferSize     int
+	BufferSize     int // Events buffered in async mode
 	Workers        int
+
+	Headers     map[string]string // Added to every request
+	BearerToken string            // Sent as "Authorization: Bearer <token>"
+
+	// MaxEventsPerRequest and MaxPayloadBytes split large batches into several
+	// sequential requests. 0 means no limit.
+	MaxEventsPerRequest int
+	MaxPayloadBytes     int
+
+	// TLS configures client certificates and trusted CAs for HTTPS endpoints.
+	TLS tlsconfig.Config
+
+	// RequestTimeout bounds each request attempt, 10s when 0. MaxIdleConns
+	// and IdleConnTimeout tune the keep-alive connections to the endpoint,
+	// 100 and 90s when 0. HTTPClient replaces the client built from these
+	// and TLS.
+	RequestTimeout  time.Duration
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+	HTTPClient      *http.Client
+
+	// EnableCompression gzips request bodies above CompressionThreshold
+	// bytes, 1024 when 0, falling back to uncompressed bodies for endpoints
+	// answering 415. The signature is that of the compressed body.
+	EnableCompression    bool
+	CompressionThreshold int
+
+	// LegacySignature signs the body alone, without a timestamp, for
+	// receivers not verifying the timestamped scheme yet. Deprecated: to be
+	// removed in the next release.
+	LegacySignature bool
+
+	// Sender replaces the HTTP requests to URL, which is then optional, and
+	// their headers. Encoder replaces the JSON payload of the events, see
+	// the API reference, and the MaxEventsPerRequest and MaxPayloadBytes
+	// limits. Either defaults to the built-in one.
+	Sender  WebhookSender
+	Encoder WebhookEncoder
+	// CloudEvents sends the events as CloudEvents, CloudEventsStructured or
+	// CloudEventsBatch, instead of the built-in payload or Encoder.
+	CloudEvents string
+
+	// DrainTimeout bounds how long Close waits for queued events in async
+	// mode; undelivered events then go to DeadLetter. 0 waits indefinitely.
+	DrainTimeout time.Duration
+	// DeadLetter receives events whose async delivery failed, logged to stderr when nil.
+	DeadLetter DeadLetterFunc
 }
 
-// NewWebhookOutput initializes a new Webhook output sink.
-func NewWebhookOutput(url, secret string, maxAttempts int, initialBackoff, maxBackoff string, async bool, bufferSize, workers int) *WebhookOutput {
-	// Duration conversion logic is handled at the application layer.
-	// We receive basic types or a config here.
-	client := webhook.NewClient(webhook.Config{
-		URL:         url,
-		Secret:      secret,
-		MaxAttempts: maxAttempts,
-		// internal webhook library currently receives time.Duration directly.
-		// Assuming app layer handles this or we tweak internal library.
+// NewWebhookOutput initializes a new Webhook output sink. Backoff durations
+// of 0 fall back to the client defaults.
+func NewWebhookOutput(url, secret string, maxAttempts int, initialBackoff, maxBackoff time.Duration, async bool, bufferSize, workers int) *WebhookOutput {
+	// Without TLS files the client cannot fail to build
+	client, _ := webhook.NewClient(webhook.Config{
+		URL:            url,
+		Secret:         secret,
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: initialBackoff,
+		MaxBackoff:     maxBackoff,
 	})
+	return newWebhookOutput(client, WebhookConfig{Async: async, BufferSize: bufferSize, Workers: workers}, "")
+}
 
+// NewWebhookOutputWithConfig initializes a new Webhook output sink from cfg.
+func NewWebhookOutputWithConfig(cfg WebhookConfig) (*WebhookOutput, error) {
+	if cfg.URL == "" && cfg.Sender == nil {
+		return nil, fmt.Errorf("webhook url is required")
+	}
+	mode, err := parseCloudEventsMode(cfg.CloudEvents)
+	if err != nil {
+		return nil, err
+	}
+	if mode != "" && cfg.Encoder != nil {
+		return nil, fmt.Errorf("webhook cloudevents and encoder are exclusive")
+	}
+	clientCfg := webhook.Config{
+		URL:                 cfg.URL,
+		Secret:              cfg.Secret,
+		MaxAttempts:         cfg.MaxAttempts,
+		InitialBackoff:      cfg.InitialBackoff,
+		MaxBackoff:          cfg.MaxBackoff,
+		Headers:             cfg.Headers,
+		BearerToken:         cfg.BearerToken,
+		MaxEventsPerRequest: cfg.MaxEventsPerRequest,
+		MaxPayloadBytes:     cfg.MaxPayloadBytes,
+		TLS:                 cfg.TLS,
+		Timeout:             cfg.RequestTimeout,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		HTTPClient:          cfg.HTTPClient,
+		LegacySignature:     cfg.LegacySignature,
+		Sender:              cfg.Sender,
+
+		EnableCompression:    cfg.EnableCompression,
+		CompressionThreshold: cfg.CompressionThreshold,
+	}
+	client, err := webhook.NewClient(clientCfg)
+	if err != nil {
+		return nil, err
+	}
+	var contentType string
+	if mode != "" {
+		cfg.Encoder = func(logs []DecodedLog) ([][]byte, error) { return EncodeCloudEvents(logs, mode) }
+		contentType = cloudEventsContentType(mode)
+	}
+	return newWebhookOutput(client, cfg, contentType), nil
+}
+
+// newWebhookOutput wraps client, starting the async workers when cfg.Async is
+// set. contentType is that of the bodies of cfg.Encoder, detected when empty.
+func newWebhookOutput(client *webhook.Client, cfg WebhookConfig, contentType string) *WebhookOutput {
 	wo := &WebhookOutput{
-		client: client,
-		async:  async,
+		client:      client,
+		encoder:     cfg.Encoder,
+		contentType: contentType,
+		async:       cfg.Async,
 	}
 
-	if async {
+	if cfg.Async {
+		bufferSize, workers := cfg.BufferSize, cfg.Workers
 		if bufferSize <= 0 {
 			bufferSize = 1000
 		}
 		if workers <= 0 {
 			workers = 1
 		}
-		wo.queue = make(chan []types.Log, bufferSize)
+		wo.queue = make(chan webhookJob, bufferSize)
+		wo.closing = make(chan struct{})
+		wo.buffer = semaphore.NewWeighted(int64(bufferSize))
+		wo.capacity = int64(bufferSize)
+		wo.drainTimeout = cfg.DrainTimeout
+		wo.deadLetter = cfg.DeadLetter
+		wo.ctx, wo.cancel = context.WithCancel(context.Background())
 		for i := 0; i < workers; i++ {
 			wo.wg.Add(1)
 			go wo.worker()
@@ -93,130 +293,256 @@ func NewWebhookOutput(url, secret string, maxAttempts int, initialBackoff, maxBa
 
 func (w *WebhookOutput) Name() string { return "webhook" }
 
+// webhookJob is a batch awaiting delivery: either sent as one JSON payload, or
+// as pre-rendered bodies, one request each (bodies[i] for events[i]).
+type webhookJob struct {
+	events []DecodedLog
+	bodies [][]byte
+	weight int64 // Buffer slots held in async mode
+}
+
 func (w *WebhookOutput) worker() {
 	defer w.wg.Done()
-	for logs := range w.queue {
-		if err := w.client.Send(context.Background(), logs); err != nil {
-			fmt.Fprintf(os.Stderr, "[Webhook Async Error] %v\n", err)
+	for job := range w.queue {
+		failed, err := w.deliver(w.ctx, job)
+		if err != nil {
+			w.dropped.Add(uint64(len(failed)))
+			for _, l := range failed {
+				if w.deadLetter != nil {
+					w.deadLetter(l, err)
+				} else {
+					fmt.Fprintf(os.Stderr, "[Webhook Async Error] tx %s log %d: %v\n", l.Log.TxHash.Hex(), l.Log.Index, err)
+				}
+			}
 		}
+		n := len(job.events)
+		w.delivered.Add(uint64(n - len(failed)))
+		w.pending.Add(-int64(n))
+		w.buffer.Release(job.weight)
 	}
 }
 
-func (w *WebhookOutput) Send(ctx context.Context, logs []DecodedLog) error {
-	var rawLogs []types.Log
-	for _, l := range logs {
-		rawLogs = append(rawLogs, l.Log)
-	}
-
-	if w.async {
-		w.closedMu.Lock()
-		defer w.closedMu.Unlock()
-		if w.closed {
-			return fmt.Errorf("webhook output is closed")
+// deliver sends job and returns the events that were not delivered along with the error.
+func (w *WebhookOutput) deliver(ctx context.Context, job webhookJob) ([]DecodedLog, error) {
+	if job.bodies == nil {
+		// One payload per run of events from the same chain
+		for start := 0; start < len(job.events); {
+			chain := webhook.Chain{ID: job.events[start].ChainID, NumericID: job.events[start].NumericChainID}
+			end := start + 1
+			for end < len(job.events) && job.events[end].ChainID == chain.ID && job.events[end].NumericChainID == chain.NumericID {
+				end++
+			}
+			if err := w.sendChain(ctx, chain, job.events[start:end]); err != nil {
+				return job.events[start:], err
+			}
+			start = end
 		}
-		select {
-		case w.queue <- rawLogs:
-			return nil
-		case <-ctx.Done():
-			return ctx.Err()
+		return nil, nil
+	}
+	for i, body := range job.bodies {
+		if err := w.client.SendBody(ctx, body, payloadContentType(body)); err != nil {
+			return job.events[i:], err
 		}
 	}
-	return w.client.Send(ctx, rawLogs)
+	return nil, nil
 }
 
-func (w *WebhookOutput) Close() error {
-	if w.async {
-		w.closedMu.Lock()
-		if !w.closed {
-			w.closed = true
-			close(w.queue)
+// sendChain sends events, all from chain, in the payload of the encoder if
+// any, else in the built-in one.
+func (w *WebhookOutput) sendChain(ctx context.Context, chain webhook.Chain, events []DecodedLog) error {
+	if w.encoder == nil {
+		logs := make([]types.Log, len(events))
+		for i, l := range events {
+			logs[i] = l.Log
+		}
+		return w.client.SendChain(ctx, chain, logs)
+	}
+	bodies, err := w.encoder(events)
+	if err != nil {
+		return fmt.Errorf("webhook encoder: %w", err)
+	}
+	for _, body := range bodies {
+		contentType := w.contentType
+		if contentType == "" {
+			contentType = payloadContentType(body)
+		}
+		if err := w.client.SendBody(ctx, body, contentType); err != nil {
+			return err
 		}
-		w.closedMu.Unlock()
-		w.wg.Wait()
 	}
 	return nil
 }
 
-// --- 2. File Output ---
-
-// FileOutput implements the Output interface for writing events to a file.
-type FileOutput struct {
-	path string
-	mu   sync.Mutex
-	file *os.File
+func (w *WebhookOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return w.dispatch(ctx, webhookJob{events: logs})
 }
 
-// NewFileOutput initializes a new file-based output sink.
-func NewFileOutput(path string) (*FileOutput, error) {
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, err
+// SendRaw posts every payload as its own request instead of the JSON batch.
+func (w *WebhookOutput) SendRaw(ctx context.Context, logs []DecodedLog, payloads [][]byte) error {
+	if len(payloads) == 0 {
+		return nil
 	}
-	return &FileOutput{path: path, file: f}, nil
+	return w.dispatch(ctx, webhookJob{events: logs, bodies: payloads})
 }
 
-func (f *FileOutput) Name() string { return "file" }
+func (w *WebhookOutput) dispatch(ctx context.Context, job webhookJob) error {
+	if !w.async {
+		_, err := w.deliver(ctx, job)
+		return err
+	}
 
-func (f *FileOutput) Send(ctx context.Context, logs []DecodedLog) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
-	enc := json.NewEncoder(f.file)
-	for _, l := range logs {
-		if err := enc.Encode(l); err != nil {
-			return err
+	// The lock is not held while blocking on a full buffer, so that Shutdown
+	// is not held up: it wakes the Sends through closing instead, and closes
+	// the queue once they are done
+	w.closedMu.RLock()
+	if w.closed {
+		w.closedMu.RUnlock()
+		return ErrWebhookClosed
+	}
+	w.senders.Add(1)
+	w.closedMu.RUnlock()
+	defer w.senders.Done()
+
+	acquireCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-w.closing:
+			cancel()
+		case <-acquireCtx.Done():
+		}
+	}()
+	// The buffer counts events; a batch larger than it waits for an empty buffer
+	job.weight = min(int64(len(job.events)), w.capacity)
+	if err := w.buffer.Acquire(acquireCtx, job.weight); err != nil {
+		if ctx.Err() == nil {
+			return ErrWebhookClosed
 		}
+		return err
+	}
+	w.pending.Add(int64(len(job.events)))
+	select {
+	case w.queue <- job:
+		return nil
+	case <-w.closing:
+		w.pending.Add(-int64(len(job.events)))
+		w.buffer.Release(job.weight)
+		return ErrWebhookClosed
 	}
-	return nil
 }
 
-func (f *FileOutput) Close() error {
-	if f.file != nil {
-		return f.file.Close()
+// Stats reports the queue depth and delivery counts in async mode.
+func (w *WebhookOutput) Stats() WebhookStats {
+	return WebhookStats{
+		QueueDepth: int(w.pending.Load()),
+		Delivered:  w.delivered.Load(),
+		Dropped:    w.dropped.Load(),
 	}
-	return nil
 }
 
-// --- 3. Console Output ---
-
-// ConsoleOutput implements the Output interface for printing events to stdout.
-type ConsoleOutput struct {
-	mu sync.Mutex
+// Pressure returns how full the queue is in async mode, 0 otherwise. See
+// PressureReporter.
+func (w *WebhookOutput) Pressure() float64 {
+	if !w.async {
+		return 0
+	}
+	return min(float64(w.pending.Load())/float64(w.capacity), 1)
 }
 
-func NewConsoleOutput() *ConsoleOutput {
-	return &ConsoleOutput{}
+// Close stops accepting events and, in async mode, waits for the queue to
+// drain for at most the configured DrainTimeout.
+func (w *WebhookOutput) Close() error {
+	if !w.async || w.drainTimeout <= 0 {
+		return w.Shutdown(context.Background())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.drainTimeout)
+	defer cancel()
+	return w.Shutdown(ctx)
 }
 
-func (c *ConsoleOutput) Name() string { return "console" }
-
-func (c *ConsoleOutput) Send(ctx context.Context, logs []DecodedLog) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	enc := json.NewEncoder(os.Stdout)
-	for _, l := range logs {
-		if err := enc.Encode(l); err != nil {
-			return err
-		}
+// Shutdown stops accepting events and waits for queued ones until ctx is done.
+// In-flight and remaining deliveries are then aborted and their events handed
+// to the dead-letter handler; the returned error reports how many.
+func (w *WebhookOutput) Shutdown(ctx context.Context) error {
+	if !w.async {
+		return nil
 	}
-	return nil
+	w.closedMu.Lock()
+	if w.closed {
+		w.closedMu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.closing)
+	w.closedMu.Unlock()
+	w.senders.Wait()
+	close(w.queue)
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		w.cancel()
+		return nil
+	case <-ctx.Done():
+	}
+
+	before := w.dropped.Load()
+	w.cancel()
+	<-done
+	return fmt.Errorf("webhook drain: %w, %d events undelivered", ctx.Err(), w.dropped.Load()-before)
 }
 
-func (c *ConsoleOutput) Close() error { return nil }
+// --- 2. File Output (see file.go) ---
+
+// --- 3. Console Output (see console.go) ---
 
 // --- 4. PostgreSQL Output ---
 
+// validTableName guards table names interpolated into SQL statements.
+var validTableName = regexp.MustCompile("^[a-zA-Z0-9_]+$")
+
 // PostgresOutput implements the Output interface for saving events to PostgreSQL.
 type PostgresOutput struct {
-	db    *sql.DB
-	table string
+	db            *sql.DB
+	table         string
+	bulkThreshold int
+
+	eventsMu sync.RWMutex
+	events   map[string]EventTable // Event name -> dedicated table, see MapEvent
+}
+
+// PostgresConfig configures a PostgresOutput.
+type PostgresConfig struct {
+	URL   string
+	Table string
+	// BulkThreshold loads batches of at least this many rows per table with
+	// COPY through a staging table instead of multi-row INSERTs, which is much
+	// faster for backfills. 0 disables COPY.
+	BulkThreshold int
 }
 
 // NewPostgresOutput initializes a new PostgreSQL output sink.
 func NewPostgresOutput(url, table string) (*PostgresOutput, error) {
-	if match, _ := regexp.MatchString("^[a-zA-Z0-9_]+$", table); !match {
+	return NewPostgresOutputWithConfig(PostgresConfig{URL: url, Table: table})
+}
+
+// NewPostgresOutputWithConfig initializes a PostgreSQL output sink from cfg.
+func NewPostgresOutputWithConfig(cfg PostgresConfig) (*PostgresOutput, error) {
+	table := cfg.Table
+	if !validTableName.MatchString(table) {
 		return nil, fmt.Errorf("invalid table name: %s", table)
 	}
-	db, err := sql.Open("postgres", url)
+	if cfg.BulkThreshold < 0 {
+		return nil, fmt.Errorf("invalid bulk threshold: %d", cfg.BulkThreshold)
+	}
+	db, err := sql.Open("postgres", cfg.URL)
 	if err != nil {
 		return nil, err
 	}
@@ -231,15 +557,17 @@ func NewPostgresOutput(url, table string) (*PostgresOutput, error) {
 			log_index INT,
 			event_name TEXT,
 			data JSONB,
+			chain_id TEXT,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
 			UNIQUE (tx_hash, log_index)
 		);
+		ALTER TABLE %s ADD COLUMN IF NOT EXISTS chain_id TEXT;
 		CREATE INDEX IF NOT EXISTS idx_%s_block ON %s (block_number);
-	`, table, table, table)
+	`, table, table, table, table)
 	if _, err := db.Exec(query); err != nil {
 		return nil, fmt.Errorf("failed to create table: %w", err)
 	}
-	return &PostgresOutput{db: db, table: table}, nil
+	return &PostgresOutput{db: db, table: table, bulkThreshold: cfg.BulkThreshold}, nil
 }
 
 func (p *PostgresOutput) Name() string { return "postgres" }
@@ -255,165 +583,273 @@ func (p *PostgresOutput) Send(ctx context.Context, logs []DecodedLog) error {
 	defer func() {
 		_ = tx.Rollback()
 	}()
-
-	valueStrings := make([]string, 0, len(logs))
-	valueArgs := make([]interface{}, 0, len(logs)*5)
-	for i, l := range logs {
-		jsonData, _ := json.Marshal(l)
-		n := i * 5
-		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
-		valueArgs = append(valueArgs, l.Log.BlockNumber, l.Log.TxHash.Hex(), l.Log.Index, l.EventName, jsonData)
-	}
-	stmt := fmt.Sprintf("INSERT INTO %s (block_number, tx_hash, log_index, event_name, data) VALUES %s ON CONFLICT (tx_hash, log_index) DO NOTHING", p.table, strings.Join(valueStrings, ","))
-	_, err = tx.ExecContext(ctx, stmt, valueArgs...)
-	if err != nil {
+	if err := p.SendTx(ctx, tx, logs); err != nil {
 		return err
 	}
 	return tx.Commit()
 }
 
+// SendTx writes logs within tx instead of a transaction of its own, leaving
+// the commit to the caller. tx may belong to another connection to the same
+// database, e.g. a storage.TxPersistence saving the cursor in the same
+// transaction (see scanner.Scanner.SetTxHandler). Tables are created on p's connection.
+func (p *PostgresOutput) SendTx(ctx context.Context, tx *sql.Tx, logs []DecodedLog) error {
+	generic, tables, mapped := p.splitMapped(logs)
+	for i, t := range tables {
+		events := dedupeLogs(mapped[i])
+		rows := make([][]interface{}, len(events))
+		for j, l := range events {
+			rows[j] = t.row(l)
+		}
+		if err := p.write(ctx, tx, t.target(), rows); err != nil {
+			return fmt.Errorf("table %s: %w", t.Table, err)
+		}
+	}
+	if len(generic) > 0 {
+		rows := make([][]interface{}, len(generic))
+		for i, l := range generic {
+			jsonData, _ := json.Marshal(l)
+			rows[i] = []interface{}{l.Log.BlockNumber, l.Log.TxHash.Hex(), l.Log.Index, l.EventName, string(jsonData), pgChainID(l)}
+		}
+		target := pgTarget{
+			table:      p.table,
+			columns:    []string{"block_number", "tx_hash", "log_index", "event_name", "data", "chain_id"},
+			onConflict: "ON CONFLICT (tx_hash, log_index) DO NOTHING",
+		}
+		if err := p.write(ctx, tx, target, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *PostgresOutput) Close() error { return p.db.Close() }
 
 // --- 5. Redis Output ---
 
+// Redis output modes.
+const (
+	RedisModeList   = "list"   // LPUSH onto a list
+	RedisModePubSub = "pubsub" // PUBLISH to a channel
+	RedisModeStream = "stream" // XADD to a stream, usable with consumer groups
+	RedisModeHash   = "hash"   // HSET the latest event per (address, event) into a hash
+)
+
+// RedisConfig configures a RedisOutput.
+type RedisConfig struct {
+	// Connection to a standalone, Sentinel-managed or clustered deployment
+	redisconfig.Config
+	// Key is the list, channel, stream or hash name. It may be a text/template
+	// rendered per event with .EventName (or "unknown" for undecoded logs),
+	// .Address (the checksummed contract address) and .Chain, e.g.
+	// "events:{{.EventName}}:{{.Address}}". "{event}" is short for {{.EventName}}.
+	Key  string
+	Mode string // RedisModeList (default), RedisModePubSub, RedisModeStream or RedisModeHash
+	// MaxLen trims lists to the newest MaxLen entries and streams to
+	// approximately that many (0 = no trimming).
+	MaxLen int64
+	// TTL refreshes the expiry of every key written to (0 = no expiry). Redis
+	// expires whole keys, so a list expires TTL after its last event.
+	TTL time.Duration
+}
+
 // RedisOutput implements the Output interface for sending events to Redis.
 type RedisOutput struct {
-	client *redis.Client
-	key    string
-	mode   string
+	client  redis.UniversalClient
+	key     string
+	keyTmpl *template.Template // Set when key is a template
+	mode    string
+	maxLen  int64
+	ttl     time.Duration
+}
+
+// redisKeyData is the data Redis key templates are rendered with.
+type redisKeyData struct {
+	EventName string
+	Address   string
+	Chain     string
 }
 
 // NewRedisOutput initializes a new Redis output sink.
 func NewRedisOutput(addr, password string, db int, key, mode string) (*RedisOutput, error) {
-	rdb := redis.NewClient(&redis.Options{Addr: addr, Password: password, DB: db})
-	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		return nil, err
-	}
-	return &RedisOutput{client: rdb, key: key, mode: mode}, nil
+	return NewRedisOutputWithConfig(RedisConfig{
+		Config: redisconfig.Config{Addr: addr, Password: password, DB: db},
+		Key:    key,
+		Mode:   mode,
+	})
 }
 
-func (r *RedisOutput) Name() string { return "redis" }
-
-func (r *RedisOutput) Send(ctx context.Context, logs []DecodedLog) error {
-	pipe := r.client.Pipeline()
-	for _, l := range logs {
-		data, _ := json.Marshal(l)
-		if r.mode == "pubsub" {
-			pipe.Publish(ctx, r.key, data)
-		} else {
-			pipe.LPush(ctx, r.key, data)
-		}
+// NewRedisOutputWithConfig initializes a new Redis output sink from cfg.
+func NewRedisOutputWithConfig(cfg RedisConfig) (*RedisOutput, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = RedisModeList
+	case RedisModeList, RedisModePubSub, RedisModeStream, RedisModeHash:
+	default:
+		return nil, fmt.Errorf("unsupported redis mode: %q", cfg.Mode)
 	}
-	_, err := pipe.Exec(ctx)
-	return err
-}
-
-func (r *RedisOutput) Close() error { return r.client.Close() }
-
-// --- 6. Kafka Output ---
-
-// KafkaOutput implements the Output interface for sending events to Kafka.
-type KafkaOutput struct {
-	producer sarama.SyncProducer
-	topic    string
-}
-
-// NewKafkaOutput initializes a new Kafka output sink.
-func NewKafkaOutput(brokers []string, topic, user, password string) (*KafkaOutput, error) {
-	config := sarama.NewConfig()
-	config.Producer.Return.Successes = true
-	if user != "" {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = user
-		config.Net.SASL.Password = password
+	if cfg.MaxLen < 0 {
+		return nil, fmt.Errorf("redis max_len must not be negative")
+	}
+	if cfg.MaxLen > 0 && (cfg.Mode == RedisModePubSub || cfg.Mode == RedisModeHash) {
+		return nil, fmt.Errorf("redis max_len is not supported in %s mode", cfg.Mode)
+	}
+	if cfg.TTL < 0 {
+		return nil, fmt.Errorf("redis ttl must not be negative")
 	}
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	if cfg.TTL > 0 && cfg.Mode == RedisModePubSub {
+		return nil, fmt.Errorf("redis ttl is not supported in pubsub mode")
+	}
+	keyTmpl, err := parseRedisKey(cfg.Key)
 	if err != nil {
 		return nil, err
 	}
-	return &KafkaOutput{producer: producer, topic: topic}, nil
-}
 
-func (k *KafkaOutput) Name() string { return "kafka" }
+	rdb, err := cfg.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+	return &RedisOutput{client: rdb, key: cfg.Key, keyTmpl: keyTmpl, mode: cfg.Mode, maxLen: cfg.MaxLen, ttl: cfg.TTL}, nil
+}
 
-func (k *KafkaOutput) Send(ctx context.Context, logs []DecodedLog) error {
-	var msgs []*sarama.ProducerMessage
-	for _, l := range logs {
-		data, _ := json.Marshal(l)
-		msgs = append(msgs, &sarama.ProducerMessage{
-			Topic: k.topic,
-			Key:   sarama.StringEncoder(l.Log.TxHash.Hex()),
-			Value: sarama.ByteEncoder(data),
-		})
+// parseRedisKey parses key as a template, or returns nil if it has no actions.
+func parseRedisKey(key string) (*template.Template, error) {
+	key = strings.ReplaceAll(key, "{event}", "{{.EventName}}")
+	if !strings.Contains(key, "{{") {
+		return nil, nil
+	}
+	tmpl, err := template.New("redis_key").Parse(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis key template: %w", err)
 	}
-	return k.producer.SendMessages(msgs)
+	// Catch references to unknown fields now rather than on the first event
+	if err := tmpl.Execute(io.Discard, redisKeyData{}); err != nil {
+		return nil, fmt.Errorf("invalid redis key template: %w", err)
+	}
+	return tmpl, nil
 }
 
-func (k *KafkaOutput) Close() error { return k.producer.Close() }
+func (r *RedisOutput) Name() string { return "redis" }
 
-// --- 7. RabbitMQ Output ---
+func (r *RedisOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	return r.send(ctx, logs, nil)
+}
 
-// RabbitMQOutput implements the Output interface for sending events to RabbitMQ.
-type RabbitMQOutput struct {
-	conn       *amqp.Connection
-	ch         *amqp.Channel
-	exchange   string
-	routingKey string
+// SendRaw stores payloads[i] in place of the JSON encoding of logs[i].
+func (r *RedisOutput) SendRaw(ctx context.Context, logs []DecodedLog, payloads [][]byte) error {
+	return r.send(ctx, logs, payloads)
 }
 
-// NewRabbitMQOutput initializes a new RabbitMQ output sink.
-func NewRabbitMQOutput(url, exchange, routingKey, queueName string, durable bool) (*RabbitMQOutput, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, err
-	}
-	ch, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return nil, err
+func (r *RedisOutput) send(ctx context.Context, logs []DecodedLog, payloads [][]byte) error {
+	if len(logs) == 0 {
+		return nil
 	}
-	if exchange != "" {
-		err = ch.ExchangeDeclare(exchange, "topic", durable, false, false, false, nil)
+
+	pipe := r.client.Pipeline()
+	labels := make([]string, 0, len(logs))
+	var keys []string // Written keys in first-seen order
+	seen := make(map[string]bool)
+	for i, l := range logs {
+		data, err := encodePayload(l, payloads, i)
 		if err != nil {
-			ch.Close()
-			conn.Close()
-			return nil, err
+			return err
 		}
-	}
-	if queueName != "" {
-		q, err := ch.QueueDeclare(queueName, durable, false, false, false, nil)
+		key, err := r.keyFor(l)
 		if err != nil {
-			ch.Close()
-			conn.Close()
-			return nil, err
+			return err
+		}
+		switch r.mode {
+		case RedisModePubSub:
+			pipe.Publish(ctx, key, data)
+		case RedisModeStream:
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: key,
+				MaxLen: r.maxLen,
+				Approx: r.maxLen > 0,
+				Values: []interface{}{
+					"tx_hash", l.Log.TxHash.Hex(),
+					"log_index", l.Log.Index,
+					"event_name", l.EventName,
+					"payload", data,
+				},
+			})
+		case RedisModeHash:
+			pipe.HSet(ctx, key, redisHashField(l), data)
+		default:
+			pipe.LPush(ctx, key, data)
 		}
-		if err := ch.QueueBind(q.Name, routingKey, exchange, false, nil); err != nil {
-			ch.Close()
-			conn.Close()
-			return nil, err
+		labels = append(labels, fmt.Sprintf("log %d", i))
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	// Trim and expire once per key, after all of the batch has been written
+	for _, key := range keys {
+		if r.mode == RedisModeList && r.maxLen > 0 {
+			pipe.LTrim(ctx, key, 0, r.maxLen-1)
+			labels = append(labels, "ltrim "+key)
+		}
+		if r.ttl > 0 {
+			pipe.Expire(ctx, key, r.ttl)
+			labels = append(labels, "expire "+key)
 		}
 	}
-	return &RabbitMQOutput{conn: conn, ch: ch, exchange: exchange, routingKey: routingKey}, nil
-}
-
-func (r *RabbitMQOutput) Name() string { return "rabbitmq" }
 
-func (r *RabbitMQOutput) Send(ctx context.Context, logs []DecodedLog) error {
-	for _, l := range logs {
-		data, _ := json.Marshal(l)
-		err := r.ch.PublishWithContext(ctx, r.exchange, r.routingKey, false, false, amqp.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent,
-			Body:         data,
-		})
-		if err != nil {
-			return err
+	// Exec only reports the first failure; check every command so partial
+	// failures are reported in full.
+	cmds, err := pipe.Exec(ctx)
+	if len(cmds) == 0 {
+		return err
+	}
+	var errs []error
+	for i, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", labels[i], cmdErr))
 		}
 	}
+	if len(errs) > 0 {
+		return fmt.Errorf("redis: %d of %d commands failed: %w", len(errs), len(cmds), errors.Join(errs...))
+	}
 	return nil
 }
 
-func (r *RabbitMQOutput) Close() error {
-	r.ch.Close()
-	return r.conn.Close()
+// keyFor renders the configured key for l.
+func (r *RedisOutput) keyFor(l DecodedLog) (string, error) {
+	name := l.EventName
+	if name == "" {
+		name = "unknown"
+	}
+	if r.keyTmpl == nil {
+		return strings.ReplaceAll(r.key, "{event}", name), nil
+	}
+	var b strings.Builder
+	data := redisKeyData{EventName: name, Address: l.Log.Address.Hex(), Chain: l.ChainID}
+	if err := r.keyTmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("redis key: %w", err)
+	}
+	return b.String(), nil
 }
+
+// redisHashField identifies the (address, event) pair a hash mode entry holds
+// the latest event of, e.g. "0xdAC1...1ec7:Transfer". Undecoded logs use
+// their topic0.
+func redisHashField(l DecodedLog) string {
+	name := l.EventName
+	if name == "" && len(l.Log.Topics) > 0 {
+		name = l.Log.Topics[0].Hex()
+	} else if name == "" {
+		name = "unknown"
+	}
+	return l.Log.Address.Hex() + ":" + name
+}
+
+func (r *RedisOutput) Close() error { return r.client.Close() }
+
+// --- 6. Kafka Output (see kafka.go) ---
+
+// --- 7. RabbitMQ Output (see rabbitmq.go) ---
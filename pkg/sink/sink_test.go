@@ -3,16 +3,25 @@ package sink
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/84hero/evm-scanner/internal/webhook"
+	"github.com/84hero/evm-scanner/pkg/redisconfig"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/go-redis/redismock/v9"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -74,18 +83,206 @@ func TestRedisOutput(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestRedisOutput_Stream(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	ro := &RedisOutput{client: db, key: "events", mode: RedisModeStream}
+
+	logs := []DecodedLog{{Log: types.Log{TxHash: common.HexToHash("0xabc"), Index: 3}, EventName: "Transfer"}}
+	data, _ := json.Marshal(logs[0])
+	values := []interface{}{
+		"tx_hash", common.HexToHash("0xabc").Hex(),
+		"log_index", uint(3),
+		"event_name", "Transfer",
+		"payload", data,
+	}
+
+	// No trimming by default
+	mock.ExpectXAdd(&redis.XAddArgs{Stream: "events", Values: values}).SetVal("1-0")
+	assert.NoError(t, ro.Send(context.Background(), logs))
+
+	// Approximate MAXLEN trim and per-event key
+	ro.maxLen = 1000
+	ro.key = "events:{event}"
+	mock.ExpectXAdd(&redis.XAddArgs{Stream: "events:Transfer", MaxLen: 1000, Approx: true, Values: values}).SetVal("1-1")
+	assert.NoError(t, ro.Send(context.Background(), logs))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisOutput_KeyTemplate(t *testing.T) {
+	ro := &RedisOutput{key: "events:{event}"}
+	key, _ := ro.keyFor(DecodedLog{EventName: "Swap"})
+	assert.Equal(t, "events:Swap", key)
+	key, _ = ro.keyFor(DecodedLog{})
+	assert.Equal(t, "events:unknown", key)
+
+	ro.key = "events"
+	key, _ = ro.keyFor(DecodedLog{EventName: "Swap"})
+	assert.Equal(t, "events", key)
+
+	tmpl, err := parseRedisKey("events:{{.Chain}}:{{.Address}}:{event}")
+	assert.NoError(t, err)
+	ro.keyTmpl = tmpl
+	l := DecodedLog{Log: types.Log{Address: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")}, EventName: "Transfer", ChainID: "eth-mainnet"}
+	key, err = ro.keyFor(l)
+	assert.NoError(t, err)
+	assert.Equal(t, "events:eth-mainnet:0xdAC17F958D2ee523a2206206994597C13D831ec7:Transfer", key)
+
+	tmpl, err = parseRedisKey("events")
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl)
+
+	_, err = parseRedisKey("events:{{.Contract}}")
+	assert.ErrorContains(t, err, "invalid redis key template")
+	_, err = parseRedisKey("events:{{.EventName")
+	assert.ErrorContains(t, err, "invalid redis key template")
+}
+
+func TestRedisOutput_TrimAndExpire(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	tmpl, _ := parseRedisKey("events:{{.EventName}}")
+	ro := &RedisOutput{client: db, keyTmpl: tmpl, mode: RedisModeList, maxLen: 100, ttl: time.Hour}
+
+	logs := []DecodedLog{
+		{Log: types.Log{Index: 1}, EventName: "Transfer"},
+		{Log: types.Log{Index: 2}, EventName: "Approval"},
+		{Log: types.Log{Index: 3}, EventName: "Transfer"},
+	}
+	for _, l := range logs {
+		data, _ := json.Marshal(l)
+		mock.ExpectLPush("events:"+l.EventName, data).SetVal(1)
+	}
+	// One LTRIM and EXPIRE per key, after the pushes
+	mock.ExpectLTrim("events:Transfer", 0, 99).SetVal("OK")
+	mock.ExpectExpire("events:Transfer", time.Hour).SetVal(true)
+	mock.ExpectLTrim("events:Approval", 0, 99).SetVal("OK")
+	mock.ExpectExpire("events:Approval", time.Hour).SetErr(errors.New("READONLY"))
+
+	err := ro.Send(context.Background(), logs)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 7 commands failed")
+	assert.Contains(t, err.Error(), "expire events:Approval: READONLY")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisOutput_Hash(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	ro := &RedisOutput{client: db, key: "latest", mode: RedisModeHash, ttl: time.Minute}
+
+	usdt := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	topic := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	logs := []DecodedLog{
+		{Log: types.Log{Address: usdt, BlockNumber: 1}, EventName: "Transfer"},
+		{Log: types.Log{Address: usdt, BlockNumber: 2}, EventName: "Transfer"},
+		{Log: types.Log{Address: usdt, BlockNumber: 2, Topics: []common.Hash{topic}}},
+	}
+	first, _ := json.Marshal(logs[0])
+	second, _ := json.Marshal(logs[1])
+	third, _ := json.Marshal(logs[2])
+	field := usdt.Hex() + ":Transfer"
+	mock.ExpectHSet("latest", field, first).SetVal(1)
+	mock.ExpectHSet("latest", field, second).SetVal(0)
+	mock.ExpectHSet("latest", usdt.Hex()+":"+topic.Hex(), third).SetVal(1)
+	mock.ExpectExpire("latest", time.Minute).SetVal(true)
+
+	assert.NoError(t, ro.Send(context.Background(), logs))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisOutput_PartialFailure(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	ro := &RedisOutput{client: db, key: "test_key", mode: RedisModeList}
+
+	logs := []DecodedLog{{Log: types.Log{Index: 1}}, {Log: types.Log{Index: 2}}}
+	first, _ := json.Marshal(logs[0])
+	second, _ := json.Marshal(logs[1])
+
+	mock.ExpectLPush("test_key", first).SetVal(1)
+	mock.ExpectLPush("test_key", second).SetErr(errors.New("OOM command not allowed"))
+	err := ro.Send(context.Background(), logs)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 commands failed")
+	assert.Contains(t, err.Error(), "log 1: OOM")
+}
+
+func TestRedisOutput_InvalidMode(t *testing.T) {
+	_, err := NewRedisOutputWithConfig(RedisConfig{Config: redisconfig.Config{Addr: "localhost:65432"}, Mode: "zset"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported redis mode")
+
+	_, err = NewRedisOutputWithConfig(RedisConfig{Config: redisconfig.Config{Addr: "localhost:65432"}, Mode: RedisModeStream, MaxLen: -1})
+	assert.Error(t, err)
+
+	_, err = NewRedisOutputWithConfig(RedisConfig{Config: redisconfig.Config{Addr: "localhost:65432"}, Mode: RedisModeHash, MaxLen: 10})
+	assert.EqualError(t, err, "redis max_len is not supported in hash mode")
+
+	_, err = NewRedisOutputWithConfig(RedisConfig{Config: redisconfig.Config{Addr: "localhost:65432"}, Mode: RedisModePubSub, TTL: time.Minute})
+	assert.EqualError(t, err, "redis ttl is not supported in pubsub mode")
+
+	_, err = NewRedisOutputWithConfig(RedisConfig{Config: redisconfig.Config{Addr: "localhost:65432"}, Key: "events:{{.Block}}"})
+	assert.ErrorContains(t, err, "invalid redis key template")
+}
+
 func TestWebhookOutput_Sync(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer ts.Close()
 
-	wo := NewWebhookOutput(ts.URL, "secret", 1, "1s", "10s", false, 0, 0)
+	wo := NewWebhookOutput(ts.URL, "secret", 1, time.Second, 10*time.Second, false, 0, 0)
 	logs := []DecodedLog{{Log: types.Log{Index: 1}}}
 	err := wo.Send(context.Background(), logs)
 	assert.NoError(t, err)
 }
 
+func TestWebhookOutput_WithConfig(t *testing.T) {
+	var auth, key, idempotency string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, key = r.Header.Get("Authorization"), r.Header.Get("X-Api-Key")
+		idempotency = r.Header.Get("X-Scanner-Idempotency-Key")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{
+		URL:         ts.URL,
+		MaxAttempts: 1,
+		Headers:     map[string]string{"X-Api-Key": "gw-key"},
+		BearerToken: "token",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, wo.Send(context.Background(), []DecodedLog{{Log: types.Log{Index: 1}}}))
+	assert.Equal(t, "Bearer token", auth)
+	assert.Equal(t, "gw-key", key)
+	assert.Len(t, idempotency, 64)
+
+	_, err = NewWebhookOutputWithConfig(WebhookConfig{})
+	assert.Error(t, err)
+}
+
+func TestWebhookOutput_Backoff(t *testing.T) {
+	var attempts atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	// Two retries, each waiting at least half the backoff
+	elapsed := func(initial, max time.Duration) time.Duration {
+		wo := NewWebhookOutput(ts.URL, "", 3, initial, max, false, 0, 0)
+		start := time.Now()
+		assert.NoError(t, wo.Send(context.Background(), []DecodedLog{{Log: types.Log{Index: 1}}}))
+		return time.Since(start)
+	}
+	assert.GreaterOrEqual(t, elapsed(200*time.Millisecond, 200*time.Millisecond), 200*time.Millisecond)
+	assert.Less(t, elapsed(time.Millisecond, 2*time.Millisecond), 100*time.Millisecond)
+	assert.Equal(t, int32(6), attempts.Load())
+}
+
 func TestKafkaOutput_Init(t *testing.T) {
 	ko, err := NewKafkaOutput([]string{"localhost:9092"}, "test", "", "")
 	if err != nil {
@@ -132,8 +329,8 @@ func TestPostgresOutput_Send_Multiple(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectExec("INSERT INTO events").
 		WithArgs(
-			uint64(100), "0x0000000000000000000000000000000000000000000000000000000000000001", uint(1), "E1", sqlmock.AnyArg(),
-			uint64(101), "0x0000000000000000000000000000000000000000000000000000000000000002", uint(2), "E2", sqlmock.AnyArg(),
+			uint64(100), "0x0000000000000000000000000000000000000000000000000000000000000001", uint(1), "E1", sqlmock.AnyArg(), nil,
+			uint64(101), "0x0000000000000000000000000000000000000000000000000000000000000002", uint(2), "E2", sqlmock.AnyArg(), nil,
 		).
 		WillReturnResult(sqlmock.NewResult(2, 2))
 	mock.ExpectCommit()
@@ -142,6 +339,28 @@ func TestPostgresOutput_Send_Multiple(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestPostgresOutput_SendTx(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	p := &PostgresOutput{db: db, table: "events"}
+	logs := []DecodedLog{{Log: types.Log{BlockNumber: 100, TxHash: common.HexToHash("0x1"), Index: 1}, EventName: "E1"}}
+
+	// The caller's transaction is used and left open
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO scanner_checkpoints").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, p.SendTx(context.Background(), tx, logs))
+	_, err = tx.Exec("INSERT INTO scanner_checkpoints (task_key, block_height) VALUES ('eth', 101)")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestPostgresOutput_Send_Empty(t *testing.T) {
 	p := &PostgresOutput{}
 	err := p.Send(context.Background(), []DecodedLog{})
@@ -157,9 +376,15 @@ func TestSink_InterfaceCompliance(t *testing.T) {
 		{"webhook", &WebhookOutput{}},
 		{"file", &FileOutput{}},
 		{"postgres", &PostgresOutput{}},
+		{"mysql", &MySQLOutput{}},
+		{"sqlite", &SQLiteOutput{}},
 		{"redis", &RedisOutput{}},
 		{"kafka", &KafkaOutput{}},
 		{"rabbitmq", &RabbitMQOutput{}},
+		{"elasticsearch", &ElasticsearchOutput{}},
+		{"websocket", &WebsocketBroadcastOutput{}},
+		{"slack", &SlackOutput{}},
+		{"telegram", &TelegramOutput{}},
 	}
 
 	for _, tt := range sinks {
@@ -193,12 +418,13 @@ func TestPostgresOutput_Send(t *testing.T) {
 		{
 			Log:       types.Log{BlockNumber: 100, TxHash: common.HexToHash("0xabc"), Index: 1},
 			EventName: "Transfer",
+			ChainID:   "bsc-mainnet",
 		},
 	}
 
 	mock.ExpectBegin()
 	mock.ExpectExec("INSERT INTO events").
-		WithArgs(uint64(100), "0x0000000000000000000000000000000000000000000000000000000000000abc", uint(1), "Transfer", sqlmock.AnyArg()).
+		WithArgs(uint64(100), "0x0000000000000000000000000000000000000000000000000000000000000abc", uint(1), "Transfer", sqlmock.AnyArg(), "bsc-mainnet").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
@@ -214,7 +440,7 @@ func TestWebhookOutput_Async(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	wo := NewWebhookOutput(ts.URL, "secret", 1, "1s", "10s", true, 10, 1)
+	wo := NewWebhookOutput(ts.URL, "secret", 1, time.Second, 10*time.Second, true, 10, 1)
 	logs := []DecodedLog{{Log: types.Log{Index: 1}}}
 
 	start := time.Now()
@@ -234,6 +460,295 @@ func TestWebhookOutput_Async(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestWebhookOutput_Chunking(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhook.Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		mu.Lock()
+		sizes = append(sizes, len(p.Logs))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, MaxEventsPerRequest: 100})
+	assert.NoError(t, err)
+	assert.NoError(t, wo.Send(context.Background(), testLogs(250)))
+	assert.Equal(t, []int{100, 100, 50}, sizes)
+}
+
+func TestWebhookOutput_ChainID(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []webhook.Payload
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhook.Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	logs := testLogs(3)
+	logs[0].ChainID, logs[0].NumericChainID = "eth-mainnet", 1
+	logs[1].ChainID, logs[1].NumericChainID = "eth-mainnet", 1
+	logs[2].ChainID, logs[2].NumericChainID = "bsc-mainnet", 56
+
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL})
+	assert.NoError(t, err)
+	assert.NoError(t, wo.Send(context.Background(), logs))
+
+	// Events of different chains are posted separately
+	assert.Len(t, payloads, 2)
+	assert.Equal(t, "eth-mainnet", payloads[0].ChainID)
+	assert.Equal(t, uint64(1), payloads[0].NumericChainID)
+	assert.Len(t, payloads[0].Logs, 2)
+	assert.Equal(t, "bsc-mainnet", payloads[1].ChainID)
+	assert.Len(t, payloads[1].Logs, 1)
+}
+
+// fakeSender records the bodies sent, failing the first fail ones.
+type fakeSender struct {
+	mu     sync.Mutex
+	fail   int
+	bodies []string
+}
+
+func (s *fakeSender) Send(ctx context.Context, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("internal api down")
+	}
+	s.bodies = append(s.bodies, string(body))
+	return nil
+}
+
+func TestWebhookOutput_SenderAndEncoder(t *testing.T) {
+	sender := &fakeSender{fail: 1}
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{
+		Sender:         sender,
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+		Encoder: func(logs []DecodedLog) ([][]byte, error) {
+			var bodies [][]byte
+			for _, l := range logs {
+				bodies = append(bodies, fmt.Appendf(nil, "%s:%d", l.ChainID, l.Log.Index))
+			}
+			return bodies, nil
+		},
+	})
+	assert.NoError(t, err)
+
+	// One encoding per chain, the failed body retried
+	logs := []DecodedLog{{ChainID: "eth", Log: types.Log{Index: 1}}, {ChainID: "eth", Log: types.Log{Index: 2}}, {ChainID: "bsc", Log: types.Log{Index: 3}}}
+	assert.NoError(t, wo.Send(context.Background(), logs))
+	assert.Equal(t, []string{"eth:1", "eth:2", "bsc:3"}, sender.bodies)
+
+	sender.fail = 2
+	assert.ErrorContains(t, wo.Send(context.Background(), logs), "internal api down")
+
+	// The built-in payload by default
+	sender = &fakeSender{}
+	wo, err = NewWebhookOutputWithConfig(WebhookConfig{Sender: sender})
+	assert.NoError(t, err)
+	assert.NoError(t, wo.Send(context.Background(), logs[:1]))
+	if assert.Len(t, sender.bodies, 1) {
+		var p struct {
+			ChainID string            `json:"chain_id"`
+			Logs    []json.RawMessage `json:"logs"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(sender.bodies[0]), &p))
+		assert.Equal(t, "eth", p.ChainID)
+		assert.Len(t, p.Logs, 1)
+	}
+
+	wo, err = NewWebhookOutputWithConfig(WebhookConfig{Sender: sender, Encoder: func(logs []DecodedLog) ([][]byte, error) {
+		return nil, assert.AnError
+	}})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, wo.Send(context.Background(), logs), assert.AnError)
+}
+
+func TestWebhookSignature(t *testing.T) {
+	var signature, timestamp string
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature, timestamp = r.Header.Get("X-Scanner-Signature"), r.Header.Get("X-Scanner-Timestamp")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	wo := NewWebhookOutput(ts.URL, "secret", 1, time.Second, 10*time.Second, false, 0, 0)
+	assert.NoError(t, wo.Send(context.Background(), []DecodedLog{{Log: types.Log{Index: 1}}}))
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, signature, WebhookSignature("secret", sent, body))
+	assert.NoError(t, VerifyWebhookSignature("secret", signature, timestamp, body, time.Minute))
+	assert.ErrorIs(t, VerifyWebhookSignature("other", signature, timestamp, body, time.Minute), ErrWebhookSignature)
+
+	// A replay past the tolerance
+	old := time.Now().Add(-time.Hour).Unix()
+	signature = WebhookSignature("secret", old, body)
+	assert.ErrorIs(t, VerifyWebhookSignature("secret", signature, strconv.FormatInt(old, 10), body, time.Minute), ErrWebhookTimestamp)
+
+	// The legacy scheme signs the body alone
+	wo, err = NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, Secret: "secret", LegacySignature: true})
+	assert.NoError(t, err)
+	assert.NoError(t, wo.Send(context.Background(), []DecodedLog{{Log: types.Log{Index: 1}}}))
+	assert.Empty(t, timestamp)
+	assert.Len(t, signature, 64)
+}
+
+func TestWebhookOutput_AsyncBufferCountsEvents(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, Async: true, BufferSize: 3, Workers: 1})
+	assert.NoError(t, err)
+
+	// Two events fit, two more would exceed the 3 event buffer
+	assert.NoError(t, wo.Send(context.Background(), testLogs(2)))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, wo.Send(ctx, testLogs(2)), context.DeadlineExceeded)
+
+	// A batch larger than the buffer is accepted once the buffer drains
+	close(release)
+	assert.NoError(t, wo.Send(context.Background(), testLogs(5)))
+	assert.NoError(t, wo.Close())
+}
+
+func TestWebhookOutput_AsyncDeadLetter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var dead []DecodedLog
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{
+		URL:   ts.URL,
+		Async: true,
+		DeadLetter: func(l DecodedLog, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			dead = append(dead, l)
+			assert.ErrorContains(t, err, "status 400")
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, wo.Send(context.Background(), testLogs(3)))
+	assert.NoError(t, wo.Close())
+
+	assert.Len(t, dead, 3)
+	assert.Equal(t, uint(2), dead[2].Log.Index)
+	assert.Equal(t, WebhookStats{QueueDepth: 0, Delivered: 0, Dropped: 3}, wo.Stats())
+
+	// Sending after Close is a typed error
+	assert.ErrorIs(t, wo.Send(context.Background(), testLogs(1)), ErrWebhookClosed)
+}
+
+func TestWebhookOutput_DrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	var dead atomic.Int64
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{
+		URL:          ts.URL,
+		Async:        true,
+		Workers:      1,
+		DrainTimeout: 50 * time.Millisecond,
+		DeadLetter:   func(DecodedLog, error) { dead.Add(1) },
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, wo.Send(context.Background(), testLogs(2)))
+	assert.NoError(t, wo.Send(context.Background(), testLogs(3)))
+	assert.Equal(t, 5, wo.Stats().QueueDepth)
+
+	start := time.Now()
+	err = wo.Close()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "5 events undelivered")
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int64(5), dead.Load())
+	assert.Equal(t, WebhookStats{QueueDepth: 0, Delivered: 0, Dropped: 5}, wo.Stats())
+}
+
+func TestWebhookOutput_CloseWithBlockedSend(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{
+		URL:          ts.URL,
+		Async:        true,
+		BufferSize:   2,
+		Workers:      1,
+		DrainTimeout: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	// The buffer is full: the next Send blocks until Close
+	assert.NoError(t, wo.Send(context.Background(), testLogs(2)))
+	blocked := make(chan error, 1)
+	go func() { blocked <- wo.Send(context.Background(), testLogs(1)) }()
+	time.Sleep(20 * time.Millisecond)
+
+	// Close stays bounded by the drain timeout, and the Send is refused
+	start := time.Now()
+	assert.ErrorIs(t, wo.Close(), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	select {
+	case err := <-blocked:
+		assert.ErrorIs(t, err, ErrWebhookClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Send still blocked after Close")
+	}
+	assert.Equal(t, WebhookStats{QueueDepth: 0, Delivered: 0, Dropped: 2}, wo.Stats())
+}
+
+func TestWebhookOutput_Drain(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	wo, err := NewWebhookOutputWithConfig(WebhookConfig{URL: ts.URL, Async: true, DrainTimeout: time.Second})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, wo.Send(context.Background(), testLogs(2)))
+	}
+	assert.NoError(t, wo.Close())
+	assert.Equal(t, WebhookStats{QueueDepth: 0, Delivered: 6, Dropped: 0}, wo.Stats())
+}
+
 func TestConsoleOutput(t *testing.T) {
 	c := NewConsoleOutput()
 	assert.Equal(t, "console", c.Name())
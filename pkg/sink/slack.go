@@ -0,0 +1,156 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// slackMaxDigest keeps a digest within Slack's 50 blocks per message
+	// (one header plus one section per event).
+	slackMaxDigest = 49
+	// slackMaxFields is Slack's limit of fields per section block.
+	slackMaxFields = 10
+)
+
+// SlackChannelOptions override the defaults of a Slack incoming webhook.
+type SlackChannelOptions struct {
+	Channel   string // e.g. "#alerts", only honoured by legacy webhooks
+	Username  string
+	IconEmoji string // e.g. ":rotating_light:"
+}
+
+// SlackConfig holds the configuration for SlackOutput.
+type SlackConfig struct {
+	WebhookURL string
+	SlackChannelOptions
+
+	// Digest batches up to this many events into one message (max 49).
+	// 0 or 1 posts one message per event.
+	Digest int
+	// Explorer is a chain preset name (e.g. "eth-mainnet") or explorer base URL
+	// used to link transactions. No links when empty.
+	Explorer string
+	// RateLimit in messages per second, default 1 as allowed per Slack webhook.
+	RateLimit float64
+}
+
+// SlackOutput implements the Output interface by posting Block Kit messages to
+// a Slack incoming webhook.
+type SlackOutput struct {
+	cfg      SlackConfig
+	notifier *chatNotifier
+}
+
+// NewSlackOutput initializes a new Slack output posting one message per event.
+func NewSlackOutput(webhookURL string, opts SlackChannelOptions) (*SlackOutput, error) {
+	return NewSlackOutputWithConfig(SlackConfig{WebhookURL: webhookURL, SlackChannelOptions: opts})
+}
+
+// NewSlackOutputWithConfig initializes a new Slack output from cfg.
+func NewSlackOutputWithConfig(cfg SlackConfig) (*SlackOutput, error) {
+	if cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("slack webhook url is required")
+	}
+	if cfg.Digest > slackMaxDigest {
+		return nil, fmt.Errorf("slack digest must not exceed %d events", slackMaxDigest)
+	}
+	if err := validateExplorer(cfg.Explorer); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = 1
+	}
+	notifier, err := newChatNotifier(cfg.WebhookURL, cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &SlackOutput{cfg: cfg, notifier: notifier}, nil
+}
+
+func (s *SlackOutput) Name() string { return "slack" }
+
+func (s *SlackOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	for _, group := range digestGroups(logs, s.cfg.Digest) {
+		body, err := json.Marshal(s.message(group))
+		if err != nil {
+			return err
+		}
+		if err := s.notifier.post(ctx, body); err != nil {
+			return fmt.Errorf("slack: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *SlackOutput) Close() error { return nil }
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackMessage struct {
+	Channel   string       `json:"channel,omitempty"`
+	Username  string       `json:"username,omitempty"`
+	IconEmoji string       `json:"icon_emoji,omitempty"`
+	Text      string       `json:"text"` // Notification fallback
+	Blocks    []slackBlock `json:"blocks"`
+}
+
+func (s *SlackOutput) message(logs []DecodedLog) slackMessage {
+	msg := slackMessage{
+		Channel:   s.cfg.Channel,
+		Username:  s.cfg.Username,
+		IconEmoji: s.cfg.IconEmoji,
+	}
+
+	events := make([]chatEvent, len(logs))
+	for i, l := range logs {
+		events[i] = newChatEvent(l, s.cfg.Explorer)
+	}
+	if len(events) == 1 {
+		msg.Text = fmt.Sprintf("%s in block %d", events[0].Name, events[0].Block)
+		msg.Blocks = []slackBlock{slackSection(events[0])}
+		return msg
+	}
+
+	msg.Text = plural(len(events), "event")
+	msg.Blocks = append(msg.Blocks, slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: msg.Text}})
+	for _, e := range events {
+		msg.Blocks = append(msg.Blocks, slackSection(e))
+	}
+	return msg
+}
+
+// slackSection renders one event: a summary line plus its decoded inputs as fields.
+func slackSection(e chatEvent) slackBlock {
+	tx := "`" + shortHash(e.TxHash) + "`"
+	if e.TxURL != "" {
+		tx = "<" + e.TxURL + "|" + shortHash(e.TxHash) + ">"
+	}
+	block := slackBlock{
+		Type: "section",
+		Text: &slackText{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*%s* on `%s` · block %d · tx %s", slackEscaper.Replace(e.Name), e.Contract, e.Block, tx),
+		},
+	}
+	for _, f := range e.Inputs {
+		if len(block.Fields) == slackMaxFields {
+			break
+		}
+		block.Fields = append(block.Fields, slackText{
+			Type: "mrkdwn",
+			Text: fmt.Sprintf("*%s*\n`%s`", slackEscaper.Replace(f.Name), slackEscaper.Replace(f.Value)),
+		})
+	}
+	return block
+}
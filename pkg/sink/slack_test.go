@@ -0,0 +1,133 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chatServer records request bodies and arrival times.
+type chatServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies [][]byte
+	times  []time.Time
+	paths  []string
+}
+
+func newChatServer() *chatServer {
+	s := &chatServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.bodies = append(s.bodies, body)
+		s.times = append(s.times, time.Now())
+		s.paths = append(s.paths, r.URL.Path)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	return s
+}
+
+func TestSlackOutput_PerEvent(t *testing.T) {
+	srv := newChatServer()
+	defer srv.Close()
+
+	so, err := NewSlackOutputWithConfig(SlackConfig{
+		WebhookURL:          srv.URL,
+		SlackChannelOptions: SlackChannelOptions{Channel: "#alerts", Username: "scanner"},
+		Explorer:            "eth-mainnet",
+		RateLimit:           1000,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "slack", so.Name())
+
+	l := transferLog()
+	l.Log.BlockNumber = 19000000
+	assert.NoError(t, so.Send(context.Background(), []DecodedLog{l, l}))
+	assert.Len(t, srv.bodies, 2)
+
+	var msg slackMessage
+	assert.NoError(t, json.Unmarshal(srv.bodies[0], &msg))
+	assert.Equal(t, "#alerts", msg.Channel)
+	assert.Equal(t, "scanner", msg.Username)
+	assert.Equal(t, "Transfer in block 19000000", msg.Text)
+	assert.Len(t, msg.Blocks, 1)
+	assert.Equal(t, "section", msg.Blocks[0].Type)
+	assert.Equal(t, "mrkdwn", msg.Blocks[0].Text.Type)
+	assert.Equal(t, "*Transfer* on `0xdAC17F958D2ee523a2206206994597C13D831ec7` · block 19000000 · tx "+
+		"<https://etherscan.io/tx/0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060|0x5c50...2060>", msg.Blocks[0].Text.Text)
+	assert.Equal(t, []slackText{
+		{Type: "mrkdwn", Text: "*from*\n`0x28C6c06298d514Db089934071355E5743bf21d60`"},
+		{Type: "mrkdwn", Text: "*to*\n`0x21a31Ee1afC51d94C2eFcCAa2092aD1028285549`"},
+		{Type: "mrkdwn", Text: "*value*\n`1500000000`"},
+	}, msg.Blocks[0].Fields)
+}
+
+func TestSlackOutput_Digest(t *testing.T) {
+	srv := newChatServer()
+	defer srv.Close()
+
+	so, err := NewSlackOutputWithConfig(SlackConfig{WebhookURL: srv.URL, Digest: 3, RateLimit: 1000})
+	assert.NoError(t, err)
+	assert.NoError(t, so.Send(context.Background(), testLogs(5)))
+	assert.Len(t, srv.bodies, 2)
+
+	var msg slackMessage
+	assert.NoError(t, json.Unmarshal(srv.bodies[0], &msg))
+	assert.Equal(t, "3 events", msg.Text)
+	assert.Len(t, msg.Blocks, 4)
+	assert.Equal(t, "header", msg.Blocks[0].Type)
+	// Undecoded logs have no fields and no explorer link
+	assert.Contains(t, msg.Blocks[1].Text.Text, "*Log* on")
+	assert.Contains(t, msg.Blocks[1].Text.Text, "tx `0x0000...0000`")
+	assert.Empty(t, msg.Blocks[1].Fields)
+
+	assert.NoError(t, json.Unmarshal(srv.bodies[1], &msg))
+	assert.Equal(t, "2 events", msg.Text)
+}
+
+func TestSlackOutput_RateLimit(t *testing.T) {
+	srv := newChatServer()
+	defer srv.Close()
+
+	so, err := NewSlackOutputWithConfig(SlackConfig{WebhookURL: srv.URL, RateLimit: 20})
+	assert.NoError(t, err)
+	assert.NoError(t, so.Send(context.Background(), testLogs(3)))
+
+	assert.Len(t, srv.times, 3)
+	for i := 1; i < len(srv.times); i++ {
+		assert.GreaterOrEqual(t, srv.times[i].Sub(srv.times[i-1]), 40*time.Millisecond)
+	}
+
+	// Waiting for the limiter respects cancellation
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	so, _ = NewSlackOutput(srv.URL, SlackChannelOptions{})
+	assert.Error(t, so.Send(ctx, testLogs(2)))
+}
+
+func TestSlackOutput_Config(t *testing.T) {
+	_, err := NewSlackOutput("", SlackChannelOptions{})
+	assert.Error(t, err)
+
+	_, err = NewSlackOutputWithConfig(SlackConfig{WebhookURL: "http://localhost", Digest: 50})
+	assert.Error(t, err)
+
+	_, err = NewSlackOutputWithConfig(SlackConfig{WebhookURL: "http://localhost", Explorer: "unknown-chain"})
+	assert.Error(t, err)
+}
+
+func TestSlackOutput_Escaping(t *testing.T) {
+	e := chatEvent{Name: "A<b>&c", TxHash: "0x1", Inputs: []chatField{{Name: "memo", Value: "<!channel>"}}}
+	block := slackSection(e)
+	assert.Contains(t, block.Text.Text, "*A&lt;b&gt;&amp;c*")
+	assert.Equal(t, "*memo*\n`&lt;!channel&gt;`", block.Fields[0].Text)
+}
@@ -0,0 +1,86 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/84hero/evm-scanner/internal/sqlitedb"
+)
+
+// sqliteMaxRowsPerInsert keeps multi-row inserts below SQLite's bound-variable limit.
+const sqliteMaxRowsPerInsert = 1000
+
+// SQLiteOutput implements the Output interface for saving events to a local SQLite file.
+// It shares its database handle with storage.SQLiteStore when both point at the same file.
+type SQLiteOutput struct {
+	db    *sqlitedb.DB
+	table string
+}
+
+// NewSQLiteOutput initializes a new SQLite output sink.
+func NewSQLiteOutput(path, table string) (*SQLiteOutput, error) {
+	if !validTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+	db, err := sqlitedb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			block_number BIGINT,
+			tx_hash TEXT,
+			log_index INT,
+			event_name TEXT,
+			data TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (tx_hash, log_index)
+		);
+		CREATE INDEX IF NOT EXISTS idx_%s_block ON %s (block_number);
+	`, table, table, table)
+	if _, err := db.Exec(query); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+	return &SQLiteOutput{db: db, table: table}, nil
+}
+
+func (s *SQLiteOutput) Name() string { return "sqlite" }
+
+func (s *SQLiteOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for start := 0; start < len(logs); start += sqliteMaxRowsPerInsert {
+		end := start + sqliteMaxRowsPerInsert
+		if end > len(logs) {
+			end = len(logs)
+		}
+		batch := logs[start:end]
+		valueStrings := make([]string, 0, len(batch))
+		valueArgs := make([]interface{}, 0, len(batch)*5)
+		for _, l := range batch {
+			jsonData, _ := json.Marshal(l)
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, l.Log.BlockNumber, l.Log.TxHash.Hex(), l.Log.Index, l.EventName, string(jsonData))
+		}
+		stmt := fmt.Sprintf("INSERT INTO %s (block_number, tx_hash, log_index, event_name, data) VALUES %s ON CONFLICT (tx_hash, log_index) DO NOTHING", s.table, strings.Join(valueStrings, ","))
+		if _, err := tx.ExecContext(ctx, stmt, valueArgs...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteOutput) Close() error { return s.db.Close() }
@@ -0,0 +1,81 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/84hero/evm-scanner/pkg/storage"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteOutput_Send(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+
+	so, err := NewSQLiteOutput(path, "events")
+	assert.NoError(t, err)
+	assert.Equal(t, "sqlite", so.Name())
+
+	logs := []DecodedLog{
+		{Log: types.Log{BlockNumber: 100, TxHash: common.HexToHash("0x1"), Index: 1}, EventName: "E1"},
+		{Log: types.Log{BlockNumber: 101, TxHash: common.HexToHash("0x2"), Index: 2}, EventName: "E2"},
+	}
+	assert.NoError(t, so.Send(context.Background(), logs))
+	// Duplicates are ignored
+	assert.NoError(t, so.Send(context.Background(), logs))
+
+	var count int
+	assert.NoError(t, so.db.QueryRow("SELECT COUNT(*) FROM events").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	var name string
+	assert.NoError(t, so.db.QueryRow("SELECT event_name FROM events WHERE block_number = 101").Scan(&name))
+	assert.Equal(t, "E2", name)
+
+	assert.NoError(t, so.Send(context.Background(), nil))
+	assert.NoError(t, so.Close())
+}
+
+func TestSQLiteOutput_Safety(t *testing.T) {
+	_, err := NewSQLiteOutput(filepath.Join(t.TempDir(), "events.db"), "events; DROP TABLE users;")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid table name")
+}
+
+func TestSQLiteOutput_SharedWithStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "indexer.db")
+
+	so, err := NewSQLiteOutput(path, "events")
+	assert.NoError(t, err)
+	defer so.Close()
+	store, err := storage.NewSQLiteStore(path, "")
+	assert.NoError(t, err)
+	defer store.Close()
+
+	// Concurrent event inserts and cursor saves against the same file
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			logs := []DecodedLog{{Log: types.Log{BlockNumber: uint64(i), TxHash: common.BigToHash(common.Big1), Index: uint(i)}}}
+			assert.NoError(t, so.Send(context.Background(), logs))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, store.SaveCursor(context.Background(), fmt.Sprintf("task%d", i), uint64(i)))
+		}(i)
+	}
+	wg.Wait()
+
+	var count int
+	assert.NoError(t, so.db.QueryRow("SELECT COUNT(*) FROM events").Scan(&count))
+	assert.Equal(t, 20, count)
+	h, err := store.LoadCursor(context.Background(), "task19")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(19), h)
+}
@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// telegramMaxText is the Bot API limit on the length of a message.
+const telegramMaxText = 4096
+
+// TelegramConfig holds the configuration for TelegramOutput.
+type TelegramConfig struct {
+	BotToken string
+	ChatID   string // Numeric chat ID or "@channelusername"
+
+	// Digest batches up to this many events into one message, split further
+	// when the text exceeds Telegram's 4096 character limit. 0 or 1 posts one
+	// message per event.
+	Digest int
+	// Explorer is a chain preset name (e.g. "eth-mainnet") or explorer base URL
+	// used to link transactions. No links when empty.
+	Explorer string
+	// RateLimit in messages per second, default 30 as allowed per bot.
+	RateLimit float64
+	// APIURL is the Bot API server, default "https://api.telegram.org".
+	APIURL string
+}
+
+// TelegramOutput implements the Output interface by sending MarkdownV2
+// messages through the Telegram Bot API.
+type TelegramOutput struct {
+	cfg      TelegramConfig
+	notifier *chatNotifier
+}
+
+// NewTelegramOutput initializes a new Telegram output posting one message per event.
+func NewTelegramOutput(botToken, chatID string) (*TelegramOutput, error) {
+	return NewTelegramOutputWithConfig(TelegramConfig{BotToken: botToken, ChatID: chatID})
+}
+
+// NewTelegramOutputWithConfig initializes a new Telegram output from cfg.
+func NewTelegramOutputWithConfig(cfg TelegramConfig) (*TelegramOutput, error) {
+	if cfg.BotToken == "" || cfg.ChatID == "" {
+		return nil, fmt.Errorf("telegram bot token and chat id are required")
+	}
+	if err := validateExplorer(cfg.Explorer); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit <= 0 {
+		cfg.RateLimit = 30
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.telegram.org"
+	}
+	url := strings.TrimRight(cfg.APIURL, "/") + "/bot" + cfg.BotToken + "/sendMessage"
+	notifier, err := newChatNotifier(url, cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	return &TelegramOutput{cfg: cfg, notifier: notifier}, nil
+}
+
+func (t *TelegramOutput) Name() string { return "telegram" }
+
+func (t *TelegramOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	for _, group := range digestGroups(logs, t.cfg.Digest) {
+		for _, text := range t.messages(group) {
+			body, err := json.Marshal(telegramMessage{
+				ChatID:                t.cfg.ChatID,
+				Text:                  text,
+				ParseMode:             "MarkdownV2",
+				DisableWebPagePreview: true,
+			})
+			if err != nil {
+				return err
+			}
+			if err := t.notifier.post(ctx, body); err != nil {
+				return fmt.Errorf("telegram: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *TelegramOutput) Close() error { return nil }
+
+type telegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+}
+
+// messages renders a group of events, packing as many as fit into each message.
+func (t *TelegramOutput) messages(logs []DecodedLog) []string {
+	var texts []string
+	var current strings.Builder
+	for _, l := range logs {
+		entry := telegramEntry(newChatEvent(l, t.cfg.Explorer))
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+2+utf8.RuneCountInString(entry) > telegramMaxText {
+			texts = append(texts, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(entry)
+	}
+	if current.Len() > 0 {
+		texts = append(texts, current.String())
+	}
+	return texts
+}
+
+// telegramEntry renders one event in MarkdownV2.
+func telegramEntry(e chatEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s* on `%s`\n", escapeMarkdownV2(e.Name), escapeMarkdownV2Code(e.Contract, '`'))
+	for _, f := range e.Inputs {
+		fmt.Fprintf(&b, "%s: `%s`\n", escapeMarkdownV2(f.Name), escapeMarkdownV2Code(f.Value, '`'))
+	}
+	fmt.Fprintf(&b, "Block %d, tx ", e.Block)
+	if e.TxURL != "" {
+		fmt.Fprintf(&b, "[%s](%s)", escapeMarkdownV2(shortHash(e.TxHash)), escapeMarkdownV2Code(e.TxURL, ')'))
+	} else {
+		fmt.Fprintf(&b, "`%s`", escapeMarkdownV2Code(e.TxHash, '`'))
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegramOutput_PerEvent(t *testing.T) {
+	srv := newChatServer()
+	defer srv.Close()
+
+	to, err := NewTelegramOutputWithConfig(TelegramConfig{
+		BotToken: "123:abc",
+		ChatID:   "-100123",
+		Explorer: "eth-mainnet",
+		APIURL:   srv.URL,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "telegram", to.Name())
+
+	l := transferLog()
+	l.Log.BlockNumber = 19000000
+	assert.NoError(t, to.Send(context.Background(), []DecodedLog{l}))
+	assert.Equal(t, []string{"/bot123:abc/sendMessage"}, srv.paths)
+
+	var msg telegramMessage
+	assert.NoError(t, json.Unmarshal(srv.bodies[0], &msg))
+	assert.Equal(t, "-100123", msg.ChatID)
+	assert.Equal(t, "MarkdownV2", msg.ParseMode)
+	assert.True(t, msg.DisableWebPagePreview)
+	assert.Equal(t, "*Transfer* on `0xdAC17F958D2ee523a2206206994597C13D831ec7`\n"+
+		"from: `0x28C6c06298d514Db089934071355E5743bf21d60`\n"+
+		"to: `0x21a31Ee1afC51d94C2eFcCAa2092aD1028285549`\n"+
+		"value: `1500000000`\n"+
+		"Block 19000000, tx [0x5c50\\.\\.\\.2060](https://etherscan.io/tx/0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060)", msg.Text)
+}
+
+func TestTelegramOutput_Digest(t *testing.T) {
+	srv := newChatServer()
+	defer srv.Close()
+
+	to, err := NewTelegramOutputWithConfig(TelegramConfig{BotToken: "t", ChatID: "1", Digest: 10, APIURL: srv.URL})
+	assert.NoError(t, err)
+	assert.NoError(t, to.Send(context.Background(), testLogs(4)))
+	assert.Len(t, srv.bodies, 1)
+
+	var msg telegramMessage
+	assert.NoError(t, json.Unmarshal(srv.bodies[0], &msg))
+	assert.Equal(t, 4, strings.Count(msg.Text, "*Log* on"))
+
+	// A digest that exceeds the message size limit is split
+	logs := make([]DecodedLog, 50)
+	for i := range logs {
+		logs[i] = transferLog()
+	}
+	to.cfg.Digest = 50
+	texts := to.messages(logs)
+	assert.Greater(t, len(texts), 1)
+	for _, text := range texts {
+		assert.LessOrEqual(t, len([]rune(text)), telegramMaxText)
+	}
+}
+
+func TestTelegramOutput_RateLimit(t *testing.T) {
+	srv := newChatServer()
+	defer srv.Close()
+
+	to, err := NewTelegramOutputWithConfig(TelegramConfig{BotToken: "t", ChatID: "1", RateLimit: 20, APIURL: srv.URL})
+	assert.NoError(t, err)
+	assert.NoError(t, to.Send(context.Background(), testLogs(3)))
+
+	assert.Len(t, srv.times, 3)
+	for i := 1; i < len(srv.times); i++ {
+		assert.GreaterOrEqual(t, srv.times[i].Sub(srv.times[i-1]), 40*time.Millisecond)
+	}
+}
+
+func TestTelegramOutput_Config(t *testing.T) {
+	_, err := NewTelegramOutput("", "1")
+	assert.Error(t, err)
+
+	_, err = NewTelegramOutputWithConfig(TelegramConfig{BotToken: "t", ChatID: "1", Explorer: "unknown-chain"})
+	assert.Error(t, err)
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	assert.Equal(t, `Approval\_For\_All \(v1\.0\)\!`, escapeMarkdownV2("Approval_For_All (v1.0)!"))
+	assert.Equal(t, "a\\`b\\\\c", escapeMarkdownV2Code("a`b\\c", '`'))
+	assert.Equal(t, `https://x.org/a(b\)`, escapeMarkdownV2Code("https://x.org/a(b)", ')'))
+}
@@ -0,0 +1,209 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"text/template"
+
+	"github.com/84hero/evm-scanner/pkg/chain"
+	"github.com/84hero/evm-scanner/pkg/decoder"
+)
+
+// RawSender is implemented by outputs that can deliver arbitrary bytes in place
+// of their default JSON encoding (webhook, Redis, RabbitMQ). payloads[i] is the
+// body for logs[i].
+type RawSender interface {
+	SendRaw(ctx context.Context, logs []DecodedLog, payloads [][]byte) error
+}
+
+// templateOutput renders every log through a text/template before handing it
+// to the wrapped output.
+type templateOutput struct {
+	Output
+	tmpl *template.Template
+	raw  RawSender // nil when the wrapped output only accepts structured logs
+}
+
+// WithTemplate wraps out so that each DecodedLog is rendered with the Go
+// text/template tmpl and the result replaces the JSON body, e.g. to post
+// human-readable messages to chat integrations. Outputs that store structured
+// data (Postgres, Kafka, files, ...) ignore the template. Events rendering to
+// blank output are skipped. An invalid template is reported here rather than
+// on the first Send.
+//
+// Besides the text/template builtins, templates can use:
+//
+//	weiToEther      format a wei amount with 18 decimals
+//	formatUnits     format an integer amount with the given decimals
+//	shortHash       abbreviate a hash or address (0x1234...abcd)
+//	explorerTx      transaction link for a chain preset, e.g. explorerTx "eth-mainnet" .Log.TxHash
+//	explorerAddress address link for a chain preset
+//	explorerBlock   block link for a chain preset
+//	json            encode a value as JSON, e.g. to embed text in a JSON body
+func WithTemplate(out Output, tmpl string) (Output, error) {
+	t, err := template.New(out.Name()).Funcs(TemplateFuncs()).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", out.Name(), err)
+	}
+	raw, _ := out.(RawSender)
+	return &templateOutput{Output: out, tmpl: t, raw: raw}, nil
+}
+
+func (t *templateOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	if t.raw == nil {
+		return t.Output.Send(ctx, logs)
+	}
+
+	rendered := make([]DecodedLog, 0, len(logs))
+	payloads := make([][]byte, 0, len(logs))
+	for i, l := range logs {
+		var buf bytes.Buffer
+		if err := t.tmpl.Execute(&buf, l); err != nil {
+			return fmt.Errorf("render template for log %d: %w", i, err)
+		}
+		if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+			continue // Template chose to skip this event
+		}
+		rendered = append(rendered, l)
+		payloads = append(payloads, buf.Bytes())
+	}
+	if len(rendered) == 0 {
+		return nil
+	}
+	return t.raw.SendRaw(ctx, rendered, payloads)
+}
+
+// TemplateFuncs returns the helper functions available to WithTemplate templates.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"weiToEther": func(v interface{}) (string, error) {
+			return formatUnits(v, 18)
+		},
+		"formatUnits": formatUnits,
+		"shortHash":   shortHash,
+		"explorerTx": func(chainName string, hash interface{}) (string, error) {
+			return explorerLink(chainName, "tx", hash)
+		},
+		"explorerAddress": func(chainName string, addr interface{}) (string, error) {
+			return explorerLink(chainName, "address", addr)
+		},
+		"explorerBlock": func(chainName string, number interface{}) (string, error) {
+			return explorerLink(chainName, "block", number)
+		},
+		"json": func(v interface{}) (string, error) {
+			// Keep <, > and & readable for HTML-formatted chat messages
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if err := enc.Encode(v); err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(buf.String(), "\n"), nil
+		},
+	}
+}
+
+// formatUnits renders an integer amount as a decimal with the given number of
+// decimals, trimming trailing zeros (1500000 with 6 decimals is "1.5").
+func formatUnits(v interface{}, decimals int) (string, error) {
+	n, err := toBigInt(v)
+	if err != nil {
+		return "", err
+	}
+	return decoder.FormatUnits(n, decimals), nil
+}
+
+func toBigInt(v interface{}) (*big.Int, error) {
+	switch x := v.(type) {
+	case *big.Int:
+		if x == nil {
+			return new(big.Int), nil
+		}
+		return x, nil
+	case big.Int:
+		return &x, nil
+	case int:
+		return big.NewInt(int64(x)), nil
+	case int8:
+		return big.NewInt(int64(x)), nil
+	case int16:
+		return big.NewInt(int64(x)), nil
+	case int32:
+		return big.NewInt(int64(x)), nil
+	case int64:
+		return big.NewInt(x), nil
+	case uint:
+		return new(big.Int).SetUint64(uint64(x)), nil
+	case uint8:
+		return new(big.Int).SetUint64(uint64(x)), nil
+	case uint16:
+		return new(big.Int).SetUint64(uint64(x)), nil
+	case uint32:
+		return new(big.Int).SetUint64(uint64(x)), nil
+	case uint64:
+		return new(big.Int).SetUint64(x), nil
+	case string:
+		n, ok := new(big.Int).SetString(x, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", x)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("cannot format %T as an amount", v)
+	}
+}
+
+// shortHash abbreviates a hash or address to its first and last characters.
+func shortHash(v interface{}) string {
+	s := hexString(v)
+	if len(s) <= 12 {
+		return s
+	}
+	return s[:6] + "..." + s[len(s)-4:]
+}
+
+func hexString(v interface{}) string {
+	switch x := v.(type) {
+	case interface{ Hex() string }:
+		return x.Hex()
+	case string:
+		return x
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// explorerLink builds "<explorer>/<kind>/<id>" from the Explorer of a chain
+// preset. A base URL may be given instead of a preset name.
+func explorerLink(chainName, kind string, id interface{}) (string, error) {
+	base := chainName
+	if !strings.HasPrefix(chainName, "http://") && !strings.HasPrefix(chainName, "https://") {
+		p, ok := chain.Get(chainName)
+		if !ok || p.Explorer == "" {
+			return "", fmt.Errorf("no block explorer known for chain %q", chainName)
+		}
+		base = p.Explorer
+	}
+	return strings.TrimRight(base, "/") + "/" + kind + "/" + hexString(id), nil
+}
+
+// encodePayload returns payloads[i] when the batch was rendered by a template
+// and the JSON encoding of l otherwise.
+func encodePayload(l DecodedLog, payloads [][]byte, i int) ([]byte, error) {
+	if payloads != nil {
+		return payloads[i], nil
+	}
+	return json.Marshal(l)
+}
+
+// payloadContentType reports whether a payload is JSON or plain text.
+func payloadContentType(data []byte) string {
+	if json.Valid(data) {
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
@@ -0,0 +1,182 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/decoder"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/go-redis/redismock/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// telegramTemplate builds a Telegram Bot API sendMessage body.
+const telegramTemplate = `{{with .DecodedData}}{"chat_id": "-100123", "parse_mode": "HTML", "text": {{printf "<b>%s</b> %s USDT\n%s → %s\n<a href=\"%s\">%s</a>" $.EventName (formatUnits .Inputs.value 6) (shortHash .Inputs.from) (shortHash .Inputs.to) (explorerTx "eth-mainnet" $.Log.TxHash) (shortHash $.Log.TxHash) | json}}}{{end}}`
+
+func transferLog() DecodedLog {
+	value, _ := new(big.Int).SetString("1500000000", 10)
+	return DecodedLog{
+		Log: types.Log{
+			Address: common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7"),
+			Topics:  []common.Hash{},
+			TxHash:  common.HexToHash("0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060"),
+		},
+		EventName: "Transfer",
+		DecodedData: &decoder.DecodedLog{
+			Name: "Transfer",
+			Inputs: map[string]interface{}{
+				"from":  common.HexToAddress("0x28C6c06298d514Db089934071355E5743bf21d60"),
+				"to":    common.HexToAddress("0x21a31Ee1afC51d94C2eFcCAa2092aD1028285549"),
+				"value": value,
+			},
+		},
+	}
+}
+
+func TestWithTemplate_Webhook(t *testing.T) {
+	bodies := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	out, err := WithTemplate(NewWebhookOutput(ts.URL, "", 1, time.Second, 10*time.Second, false, 0, 0), telegramTemplate)
+	assert.NoError(t, err)
+	assert.Equal(t, "webhook", out.Name())
+
+	assert.NoError(t, out.Send(context.Background(), []DecodedLog{transferLog()}))
+	assert.JSONEq(t, `{
+		"chat_id": "-100123",
+		"parse_mode": "HTML",
+		"text": "<b>Transfer</b> 1500 USDT\n0x28C6...1d60 → 0x21a3...5549\n<a href=\"https://etherscan.io/tx/0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060\">0x5c50...2060</a>"
+	}`, <-bodies)
+}
+
+func TestWithTemplate_Redis(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	out, err := WithTemplate(&RedisOutput{client: db, key: "alerts", mode: RedisModeList},
+		`{{.EventName}} of {{weiToEther .DecodedData.Inputs.value}} ETH`)
+	assert.NoError(t, err)
+
+	l := transferLog()
+	l.DecodedData.Inputs["value"] = big.NewInt(2500000000000000000)
+	mock.ExpectLPush("alerts", []byte("Transfer of 2.5 ETH")).SetVal(1)
+	assert.NoError(t, out.Send(context.Background(), []DecodedLog{l}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithTemplate_RabbitMQ(t *testing.T) {
+	broker := &fakeAMQPBroker{}
+	r, err := newRabbitMQOutput(RabbitMQConfig{Exchange: "alerts"}, broker.connect)
+	assert.NoError(t, err)
+	out, err := WithTemplate(r, `{{.EventName}} in {{shortHash .Log.TxHash}}`)
+	assert.NoError(t, err)
+	defer out.Close()
+
+	assert.NoError(t, out.Send(context.Background(), []DecodedLog{transferLog()}))
+	published := broker.last().published
+	assert.Len(t, published, 1)
+	assert.Equal(t, "Transfer in 0x5c50...2060", string(published[0].Body))
+	assert.Equal(t, "text/plain; charset=utf-8", published[0].ContentType)
+	assert.Equal(t, "Transfer", published[0].Headers["event_name"])
+}
+
+func TestWithTemplate_TelegramExample(t *testing.T) {
+	tmpl, err := os.ReadFile("../../examples/telegram-alerts/transfer.tmpl")
+	assert.NoError(t, err)
+
+	bodies := make(chan []byte, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	out, err := WithTemplate(NewWebhookOutput(ts.URL, "", 1, time.Second, 10*time.Second, false, 0, 0), string(tmpl))
+	assert.NoError(t, err)
+
+	// Undecoded logs render to nothing and are skipped
+	l := transferLog()
+	l.Log.BlockNumber = 19000000
+	assert.NoError(t, out.Send(context.Background(), append(testLogs(1), l)))
+	assert.Len(t, bodies, 1)
+
+	var msg struct {
+		ParseMode string `json:"parse_mode"`
+		Text      string `json:"text"`
+	}
+	assert.NoError(t, json.Unmarshal(<-bodies, &msg))
+	assert.Equal(t, "HTML", msg.ParseMode)
+	assert.Equal(t, "💸 <b>Transfer</b> 1500 USDT\n"+
+		"From: <a href=\"https://etherscan.io/address/0x28C6c06298d514Db089934071355E5743bf21d60\">0x28C6...1d60</a>\n"+
+		"To: <a href=\"https://etherscan.io/address/0x21a31Ee1afC51d94C2eFcCAa2092aD1028285549\">0x21a3...5549</a>\n"+
+		"Tx: <a href=\"https://etherscan.io/tx/0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060\">0x5c50...2060</a> (block 19000000)", msg.Text)
+}
+
+func TestWithTemplate_StructuredOutputIgnoresTemplate(t *testing.T) {
+	f := &fakeOutput{name: "postgres"}
+	out, err := WithTemplate(f, `{{.EventName}}`)
+	assert.NoError(t, err)
+	assert.NoError(t, out.Send(context.Background(), testLogs(2)))
+	assert.Equal(t, 2, f.sent)
+}
+
+func TestWithTemplate_Errors(t *testing.T) {
+	_, err := WithTemplate(&fakeOutput{name: "webhook"}, `{{.EventName`)
+	assert.Error(t, err)
+
+	_, err = WithTemplate(&fakeOutput{name: "webhook"}, `{{noSuchFunc .}}`)
+	assert.Error(t, err)
+
+	// Rendering failures fail the batch
+	db, _ := redismock.NewClientMock()
+	out, err := WithTemplate(&RedisOutput{client: db, key: "k"}, `{{explorerTx "unknown-chain" .Log.TxHash}}`)
+	assert.NoError(t, err)
+	err = out.Send(context.Background(), []DecodedLog{transferLog()})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown-chain")
+}
+
+func TestTemplateHelpers(t *testing.T) {
+	cases := []struct {
+		v        interface{}
+		decimals int
+		want     string
+	}{
+		{big.NewInt(1000000000000000000), 18, "1"},
+		{big.NewInt(1), 18, "0.000000000000000001"},
+		{big.NewInt(-1500000), 6, "-1.5"},
+		{"0x0f4240", 6, "1"},
+		{uint64(42), 0, "42"},
+	}
+	for _, c := range cases {
+		got, err := formatUnits(c.v, c.decimals)
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, got)
+	}
+	_, err := formatUnits(1.5, 18)
+	assert.Error(t, err)
+
+	assert.Equal(t, "0xdAC1...1ec7", shortHash(common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")))
+	assert.Equal(t, "0x1234", shortHash("0x1234"))
+
+	link, err := explorerLink("bsc-mainnet", "address", common.HexToAddress("0x1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://bscscan.com/address/0x0000000000000000000000000000000000000001", link)
+
+	link, err = explorerLink("https://explorer.example.org/", "block", uint64(100))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://explorer.example.org/block/100", link)
+}
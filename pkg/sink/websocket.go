@@ -0,0 +1,293 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsDefaultQueueSize = 256
+	wsWriteTimeout     = 10 * time.Second
+	wsPingInterval     = 30 * time.Second
+)
+
+// WebsocketBroadcastOutput implements the Output interface by pushing events to
+// every connected WebSocket client.
+//
+// Clients may narrow what they receive with query parameters evaluated server-side:
+//
+//	ws://host:port/ws?address=0xA,0xB&event=Transfer
+//
+// Each client has a bounded send queue. A client that cannot keep up (full queue)
+// is disconnected so that it never slows down the scanner or other clients.
+type WebsocketBroadcastOutput struct {
+	server    *http.Server
+	listener  net.Listener
+	upgrader  websocket.Upgrader
+	queueSize int
+
+	mu      sync.RWMutex
+	clients map[*wsClient]struct{}
+	closed  bool
+
+	dropped uint64
+	wg      sync.WaitGroup
+}
+
+// wsClient is a single connected subscriber.
+type wsClient struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	addresses map[string]struct{} // Lower-cased hex addresses, empty means all
+	events    map[string]struct{} // Event names, empty means all
+	closeOnce sync.Once
+}
+
+// NewWebsocketBroadcastOutput starts an HTTP server on listenAddr serving WebSocket
+// subscriptions on path (e.g. "/ws").
+func NewWebsocketBroadcastOutput(listenAddr, path string) (*WebsocketBroadcastOutput, error) {
+	return newWebsocketBroadcastOutput(listenAddr, path, wsDefaultQueueSize)
+}
+
+func newWebsocketBroadcastOutput(listenAddr, path string, queueSize int) (*WebsocketBroadcastOutput, error) {
+	if path == "" {
+		path = "/ws"
+	}
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WebsocketBroadcastOutput{
+		listener:  ln,
+		queueSize: queueSize,
+		clients:   make(map[*wsClient]struct{}),
+		upgrader: websocket.Upgrader{
+			// Browsers on other origins (explorer frontends) are expected consumers
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, w.handleWS)
+	w.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := w.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "[WebSocket Server Error] %v\n", err)
+		}
+	}()
+
+	return w, nil
+}
+
+func (w *WebsocketBroadcastOutput) Name() string { return "websocket" }
+
+// Addr returns the address the server is listening on.
+func (w *WebsocketBroadcastOutput) Addr() string { return w.listener.Addr().String() }
+
+// Connections returns the number of currently connected clients.
+func (w *WebsocketBroadcastOutput) Connections() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.clients)
+}
+
+// Dropped returns the number of messages dropped because a client's queue was full.
+func (w *WebsocketBroadcastOutput) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+func (w *WebsocketBroadcastOutput) Send(ctx context.Context, logs []DecodedLog) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed || len(w.clients) == 0 {
+		return nil
+	}
+
+	for _, l := range logs {
+		data, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		addr := strings.ToLower(l.Log.Address.Hex())
+		for c := range w.clients {
+			if !c.matches(addr, l.EventName) {
+				continue
+			}
+			select {
+			case c.send <- data:
+			default:
+				// Slow client: drop it instead of blocking the broadcast
+				atomic.AddUint64(&w.dropped, 1)
+				go w.dropClient(c)
+			}
+		}
+	}
+	return nil
+}
+
+func (w *WebsocketBroadcastOutput) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	clients := make([]*wsClient, 0, len(w.clients))
+	for c := range w.clients {
+		clients = append(clients, c)
+	}
+	w.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := w.server.Shutdown(ctx)
+
+	// Hijacked WebSocket connections are not tracked by Shutdown
+	for _, c := range clients {
+		w.removeClient(c)
+	}
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// Writers stuck on unresponsive clients: force the connections closed
+		for _, c := range clients {
+			c.conn.Close()
+		}
+		<-done
+	}
+	return err
+}
+
+func (w *WebsocketBroadcastOutput) handleWS(rw http.ResponseWriter, r *http.Request) {
+	conn, err := w.upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		return // Upgrade already replied with an error
+	}
+
+	c := &wsClient{
+		conn:      conn,
+		send:      make(chan []byte, w.queueSize),
+		addresses: splitQuery(r.URL.Query()["address"], true),
+		events:    splitQuery(r.URL.Query()["event"], false),
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		conn.Close()
+		return
+	}
+	w.clients[c] = struct{}{}
+	w.wg.Add(2)
+	w.mu.Unlock()
+
+	go w.writeLoop(c)
+	go w.readLoop(c)
+}
+
+// writeLoop delivers queued messages and keeps the connection alive with pings.
+func (w *WebsocketBroadcastOutput) writeLoop(c *wsClient) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				_ = c.conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+				c.conn.Close()
+				return
+			}
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				go w.removeClient(c)
+				c.conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				go w.removeClient(c)
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// readLoop discards client messages and detects disconnects.
+func (w *WebsocketBroadcastOutput) readLoop(c *wsClient) {
+	defer w.wg.Done()
+	c.conn.SetReadLimit(4096)
+	for {
+		if _, _, err := c.conn.NextReader(); err != nil {
+			w.removeClient(c)
+			return
+		}
+	}
+}
+
+// dropClient disconnects c immediately, without waiting for queued messages.
+func (w *WebsocketBroadcastOutput) dropClient(c *wsClient) {
+	w.removeClient(c)
+	c.conn.Close()
+}
+
+// removeClient unregisters c and stops its writer. Safe to call multiple times.
+func (w *WebsocketBroadcastOutput) removeClient(c *wsClient) {
+	w.mu.Lock()
+	delete(w.clients, c)
+	w.mu.Unlock()
+	c.closeOnce.Do(func() { close(c.send) })
+}
+
+func (c *wsClient) matches(address, event string) bool {
+	if len(c.addresses) > 0 {
+		if _, ok := c.addresses[address]; !ok {
+			return false
+		}
+	}
+	if len(c.events) > 0 {
+		if _, ok := c.events[event]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitQuery flattens repeated and comma-separated query values into a set.
+func splitQuery(values []string, lower bool) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			if lower {
+				part = strings.ToLower(part)
+			}
+			set[part] = struct{}{}
+		}
+	}
+	return set
+}
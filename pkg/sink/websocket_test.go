@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func dialWS(t *testing.T, w *WebsocketBroadcastOutput, query string, wantConns int) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+w.Addr()+"/ws"+query, nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return w.Connections() == wantConns }, time.Second, 5*time.Millisecond)
+	return conn
+}
+
+func TestWebsocketBroadcastOutput_Delivery(t *testing.T) {
+	w, err := NewWebsocketBroadcastOutput("127.0.0.1:0", "/ws")
+	assert.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, "websocket", w.Name())
+
+	// No clients: Send is a no-op
+	assert.NoError(t, w.Send(context.Background(), []DecodedLog{{Log: types.Log{Index: 1, Topics: []common.Hash{}}}}))
+
+	all := dialWS(t, w, "", 1)
+	defer all.Close()
+	transfers := dialWS(t, w, "?event=Transfer", 2)
+	defer transfers.Close()
+
+	addr := common.HexToAddress("0xdAC17F958D2ee523a2206206994597C13D831ec7")
+	logs := []DecodedLog{
+		{Log: types.Log{Address: addr, Index: 1, Topics: []common.Hash{}}, EventName: "Approval"},
+		{Log: types.Log{Address: addr, Index: 2, Topics: []common.Hash{}}, EventName: "Transfer"},
+	}
+	assert.NoError(t, w.Send(context.Background(), logs))
+
+	var got DecodedLog
+	_ = all.SetReadDeadline(time.Now().Add(time.Second))
+	_, msg, err := all.ReadMessage()
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(msg, &got))
+	assert.Equal(t, uint(1), got.Log.Index)
+	_, msg, err = all.ReadMessage()
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(msg, &got))
+	assert.Equal(t, uint(2), got.Log.Index)
+
+	// Filtered client only receives the Transfer
+	_ = transfers.SetReadDeadline(time.Now().Add(time.Second))
+	_, msg, err = transfers.ReadMessage()
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(msg, &got))
+	assert.Equal(t, "Transfer", got.EventName)
+}
+
+func TestWebsocketBroadcastOutput_AddressFilter(t *testing.T) {
+	w, err := NewWebsocketBroadcastOutput("127.0.0.1:0", "")
+	assert.NoError(t, err)
+	defer w.Close()
+
+	watched := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	conn := dialWS(t, w, "?address="+watched.Hex(), 1)
+	defer conn.Close()
+
+	logs := []DecodedLog{
+		{Log: types.Log{Address: common.HexToAddress("0x2222222222222222222222222222222222222222"), Index: 1, Topics: []common.Hash{}}},
+		{Log: types.Log{Address: watched, Index: 2, Topics: []common.Hash{}}},
+	}
+	assert.NoError(t, w.Send(context.Background(), logs))
+
+	var got DecodedLog
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(msg, &got))
+	assert.Equal(t, uint(2), got.Log.Index)
+}
+
+func TestWebsocketBroadcastOutput_DropSlowClient(t *testing.T) {
+	w, err := newWebsocketBroadcastOutput("127.0.0.1:0", "/ws", 1)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	// Never reads, so socket buffers and then its queue fill up
+	slow := dialWS(t, w, "", 1)
+	defer slow.Close()
+
+	big := []DecodedLog{{Log: types.Log{Data: make([]byte, 256*1024)}}}
+	for i := 0; i < 100 && w.Dropped() == 0; i++ {
+		assert.NoError(t, w.Send(context.Background(), big))
+	}
+
+	assert.Greater(t, w.Dropped(), uint64(0))
+	assert.Eventually(t, func() bool { return w.Connections() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestWebsocketBroadcastOutput_Close(t *testing.T) {
+	w, err := NewWebsocketBroadcastOutput("127.0.0.1:0", "/ws")
+	assert.NoError(t, err)
+
+	conn := dialWS(t, w, "", 1)
+	defer conn.Close()
+
+	assert.NoError(t, w.Close())
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure))
+	assert.Equal(t, 0, w.Connections())
+
+	// Idempotent and Send after Close is a no-op
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Send(context.Background(), []DecodedLog{{}}))
+}
+
+func TestWebsocketBroadcastOutput_ListenFail(t *testing.T) {
+	_, err := NewWebsocketBroadcastOutput("256.0.0.1:0", "/ws")
+	assert.Error(t, err)
+}
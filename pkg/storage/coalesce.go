@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	_ CheckpointPersistence = (*CoalescingStore)(nil)
+	_ Rewinder              = (*CoalescingStore)(nil)
+	_ CursorAdmin           = (*CoalescingStore)(nil)
+)
+
+// CoalescingStore buffers the cursors saved to another store and writes them
+// at most once per interval, so that fast backfills do not hit the store after
+// every batch. Progress saved since the last write is lost on a crash; Flush
+// and Close write it. Create one with Coalesce.
+type CoalescingStore struct {
+	store    Persistence
+	interval time.Duration
+	maxDelta uint64
+	now      func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]Checkpoint
+	written map[string]coalescedWrite
+}
+
+// coalescedWrite is the last cursor of a key written to the underlying store.
+type coalescedWrite struct {
+	height uint64
+	at     time.Time
+}
+
+// Coalesce wraps store so that each cursor is written at most every
+// maxInterval, or sooner once it advanced maxDelta blocks (0 for no limit).
+// The first save of a cursor and saves moving it backwards are written
+// immediately. Checkpoint metadata is kept if store is a CheckpointPersistence.
+func Coalesce(store Persistence, maxInterval time.Duration, maxDelta uint64) *CoalescingStore {
+	return &CoalescingStore{
+		store:    store,
+		interval: maxInterval,
+		maxDelta: maxDelta,
+		now:      time.Now,
+		pending:  make(map[string]Checkpoint),
+		written:  make(map[string]coalescedWrite),
+	}
+}
+
+// LoadCursor returns the buffered cursor, or the one of the underlying store.
+func (c *CoalescingStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	cp, err := c.LoadCheckpoint(ctx, key)
+	return cp.Height, err
+}
+
+// SaveCursor buffers height, writing it if the cursor is due.
+func (c *CoalescingStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	return c.SaveCheckpoint(ctx, key, Checkpoint{Height: height})
+}
+
+// LoadCheckpoint returns the buffered checkpoint, or the one of the underlying store.
+func (c *CoalescingStore) LoadCheckpoint(ctx context.Context, key string) (Checkpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cp, ok := c.pending[key]; ok {
+		return cp, nil
+	}
+	if store, ok := c.store.(CheckpointPersistence); ok {
+		return store.LoadCheckpoint(ctx, key)
+	}
+	height, err := c.store.LoadCursor(ctx, key)
+	return Checkpoint{Height: height}, err
+}
+
+// SaveCheckpoint buffers cp, writing it if the cursor is due.
+func (c *CoalescingStore) SaveCheckpoint(ctx context.Context, key string, cp Checkpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	last, seen := c.written[key]
+	// Saves moving the cursor backwards go through, after the buffered one,
+	// so that the underlying store refuses them as it would without buffering
+	backwards := seen && cp.Height < last.height
+	if pending, ok := c.pending[key]; ok && cp.Height < pending.Height {
+		if err := c.flushLocked(ctx, key); err != nil {
+			return err
+		}
+		backwards = true
+	}
+
+	c.pending[key] = cp
+	due := !seen || c.now().Sub(last.at) >= c.interval ||
+		(c.maxDelta > 0 && cp.Height >= last.height+c.maxDelta)
+	if backwards || due {
+		return c.flushLocked(ctx, key)
+	}
+	return nil
+}
+
+// ForceRewind drops the buffered cursor and rewinds the underlying store.
+func (c *CoalescingStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, key)
+
+	var err error
+	if store, ok := c.store.(Rewinder); ok {
+		err = store.ForceRewind(ctx, key, height)
+	} else {
+		err = c.store.SaveCursor(ctx, key, height)
+	}
+	if err != nil {
+		return err
+	}
+	c.written[key] = coalescedWrite{height: height, at: c.now()}
+	return nil
+}
+
+// ListCursors writes the buffered cursors and lists those of the underlying store.
+func (c *CoalescingStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	admin, ok := c.store.(CursorAdmin)
+	if !ok {
+		return nil, fmt.Errorf("store %T cannot list cursors", c.store)
+	}
+	if err := c.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return admin.ListCursors(ctx)
+}
+
+// DeleteCursor drops the buffered cursor and deletes it from the underlying store.
+func (c *CoalescingStore) DeleteCursor(ctx context.Context, key string) error {
+	admin, ok := c.store.(CursorAdmin)
+	if !ok {
+		return fmt.Errorf("store %T cannot delete cursors", c.store)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, key)
+	delete(c.written, key)
+	return admin.DeleteCursor(ctx, key)
+}
+
+// Flush writes the buffered cursors to the underlying store.
+func (c *CoalescingStore) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for key := range c.pending {
+		if err := c.flushLocked(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping checks the underlying store.
+func (c *CoalescingStore) Ping(ctx context.Context) error {
+	return c.store.Ping(ctx)
+}
+
+// Close writes the buffered cursors and closes the underlying store.
+func (c *CoalescingStore) Close() error {
+	return errors.Join(c.Flush(context.Background()), c.store.Close())
+}
+
+// flushLocked writes the buffered cursor of key. Cursors failing with a
+// transient error stay buffered for the next write; regressions are dropped.
+func (c *CoalescingStore) flushLocked(ctx context.Context, key string) error {
+	cp, ok := c.pending[key]
+	if !ok {
+		return nil
+	}
+	var err error
+	if store, ok := c.store.(CheckpointPersistence); ok {
+		err = store.SaveCheckpoint(ctx, key, cp)
+	} else {
+		err = c.store.SaveCursor(ctx, key, cp.Height)
+	}
+	if err != nil {
+		if errors.Is(err, ErrCursorRegression) {
+			delete(c.pending, key)
+		}
+		return err
+	}
+	delete(c.pending, key)
+	c.written[key] = coalescedWrite{height: cp.Height, at: c.now()}
+	return nil
+}
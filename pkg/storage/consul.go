@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+var (
+	_ Rewinder    = (*ConsulStore)(nil)
+	_ CursorAdmin = (*ConsulStore)(nil)
+)
+
+// consulKV is the part of the Consul KV API used by ConsulStore, implemented by *api.KV.
+type consulKV interface {
+	Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error)
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error)
+	CAS(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error)
+	Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+// ConsulStoreConfig configures a ConsulStore.
+type ConsulStoreConfig struct {
+	Addr       string // HTTP API address, e.g. "localhost:8500"
+	Token      string // ACL token, optional
+	Datacenter string // Defaults to the agent's datacenter
+	Prefix     string // Key prefix (e.g., "evm_scanner/"). Final Key is prefix + task_key
+}
+
+// ConsulStore implements the Persistence interface on the Consul KV store,
+// keeping cursors as plain numbers visible in the Consul UI.
+type ConsulStore struct {
+	monotonic
+	client *api.Client
+	kv     consulKV
+	prefix string
+}
+
+// NewConsulStore initializes Consul storage
+// addr: e.g., "localhost:8500"
+// prefix: Key prefix (e.g., "evm_scanner/"). Final Key is prefix + task_key
+func NewConsulStore(addr, token, prefix string) (*ConsulStore, error) {
+	return NewConsulStoreWithConfig(ConsulStoreConfig{Addr: addr, Token: token, Prefix: prefix})
+}
+
+// NewConsulStoreWithConfig initializes Consul storage from cfg.
+func NewConsulStoreWithConfig(cfg ConsulStoreConfig) (*ConsulStore, error) {
+	apiCfg := api.DefaultConfig()
+	if cfg.Addr != "" {
+		apiCfg.Address = cfg.Addr
+	}
+	apiCfg.Token = cfg.Token
+	apiCfg.Datacenter = cfg.Datacenter
+	client, err := api.NewClient(apiCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "scanner/"
+	}
+	c := &ConsulStore{
+		client: client,
+		kv:     client.KV(),
+		prefix: prefix,
+	}
+
+	// Fail now on an unreachable agent or a rejected token rather than on the first cursor
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, err := c.kv.Get(prefix, c.query(ctx)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *ConsulStore) query(ctx context.Context) *api.QueryOptions {
+	return (&api.QueryOptions{RequireConsistent: true}).WithContext(ctx)
+}
+
+func (c *ConsulStore) write(ctx context.Context) *api.WriteOptions {
+	return (&api.WriteOptions{}).WithContext(ctx)
+}
+
+// LoadCursor retrieves the last scanned block height from Consul
+func (c *ConsulStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	pair, _, err := c.kv.Get(c.prefix+key, c.query(ctx))
+	if err != nil {
+		return 0, err
+	}
+	if pair == nil {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(pair.Value), 10, 64)
+}
+
+// SaveCursor updates the last scanned block height in Consul
+func (c *ConsulStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	if c.allowRegression {
+		return c.ForceRewind(ctx, key, height)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	fullKey := c.prefix + key
+	value := []byte(strconv.FormatUint(height, 10))
+	// Check-and-set on the index read, retried if another writer got in between
+	for {
+		pair, _, err := c.kv.Get(fullKey, c.query(ctx))
+		if err != nil {
+			return err
+		}
+		var index uint64 // 0 only creates the key
+		if pair != nil {
+			saved, err := strconv.ParseUint(string(pair.Value), 10, 64)
+			if err != nil {
+				return err
+			}
+			if height < saved {
+				return regressionError(key, height)
+			}
+			index = pair.ModifyIndex
+		}
+		ok, _, err := c.kv.CAS(&api.KVPair{Key: fullKey, Value: value, ModifyIndex: index}, c.write(ctx))
+		if err != nil || ok {
+			return err
+		}
+	}
+}
+
+// ForceRewind saves height in Consul even if it is below the saved cursor
+func (c *ConsulStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, err := c.kv.Put(&api.KVPair{Key: c.prefix + key, Value: []byte(strconv.FormatUint(height, 10))}, c.write(ctx))
+	return err
+}
+
+// ListCursors returns the cursors stored under the prefix
+func (c *ConsulStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	pairs, _, err := c.kv.List(c.prefix, c.query(ctx))
+	if err != nil {
+		return nil, err
+	}
+	cursors := make(map[string]uint64, len(pairs))
+	for _, pair := range pairs {
+		if pair.Flags == api.LockFlagValue {
+			continue // Held by Lock
+		}
+		height, err := strconv.ParseUint(string(pair.Value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cursor %s: %w", pair.Key, err)
+		}
+		cursors[strings.TrimPrefix(pair.Key, c.prefix)] = height
+	}
+	return cursors, nil
+}
+
+// DeleteCursor removes a cursor from Consul
+func (c *ConsulStore) DeleteCursor(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, err := c.kv.Delete(c.prefix+key, c.write(ctx))
+	return err
+}
+
+// Ping checks that the Consul agent serves KV requests
+func (c *ConsulStore) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, _, err := c.kv.Get(c.prefix, c.query(ctx))
+	return err
+}
+
+// Lock acquires a session-based lock on a task, so that only one of several
+// replicas scans it while the others wait as hot standbys. It blocks until the
+// lock is held or ctx is done. The returned channel is closed if the lock is
+// lost, e.g. when the session expires after a network partition; the scan must
+// then stop. unlock releases the lock.
+func (c *ConsulStore) Lock(ctx context.Context, key string) (lost <-chan struct{}, unlock func() error, err error) {
+	lock, err := c.client.LockOpts(&api.LockOptions{
+		Key:         c.prefix + key + ".lock",
+		SessionName: "evm-scanner " + key,
+		SessionTTL:  "15s",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stop := make(chan struct{})
+	acquired := make(chan struct{})
+	defer close(acquired)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(stop)
+		case <-acquired:
+		}
+	}()
+
+	lostCh, err := lock.Lock(stop)
+	if err != nil {
+		return nil, nil, err
+	}
+	if lostCh == nil {
+		return nil, nil, ctx.Err() // Stopped waiting
+	}
+	return lostCh, lock.Unlock, nil
+}
+
+// Close implements the Persistence interface. The Consul client holds no connection to close.
+func (c *ConsulStore) Close() error {
+	return nil
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// etcdAttempts bounds the attempts of an operation failing during a leader election.
+const etcdAttempts = 3
+
+// EtcdAuth holds credentials for EtcdStore. Both are optional.
+type EtcdAuth struct {
+	Username string
+	Password string
+	TLS      tlsconfig.Config
+}
+
+// EtcdStore implements the Persistence interface using etcd as a backend.
+type EtcdStore struct {
+	monotonic
+	client  *clientv3.Client
+	prefix  string
+	backoff time.Duration
+}
+
+// NewEtcdStore initializes etcd storage
+// endpoints: e.g., []string{"etcd-0:2379", "etcd-1:2379"}
+// prefix: Key prefix (e.g., "evm_scanner/"). Final Key is prefix + task_key
+func NewEtcdStore(endpoints []string, prefix string, auth EtcdAuth) (*EtcdStore, error) {
+	tlsCfg, err := auth.TLS.Build()
+	if err != nil {
+		return nil, err
+	}
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+		Username:    auth.Username,
+		Password:    auth.Password,
+		TLS:         tlsCfg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix == "" {
+		prefix = "scanner/"
+	}
+
+	// The client connects lazily; fail now rather than on the first cursor
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := cli.Get(ctx, prefix, clientv3.WithCountOnly()); err != nil {
+		cli.Close()
+		return nil, err
+	}
+
+	return &EtcdStore{
+		client:  cli,
+		prefix:  prefix,
+		backoff: 200 * time.Millisecond,
+	}, nil
+}
+
+// LoadCursor retrieves the last scanned block height from etcd
+func (e *EtcdStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	var resp *clientv3.GetResponse
+	err := e.retry(ctx, func(ctx context.Context) (err error) {
+		resp, err = e.client.Get(ctx, e.prefix+key)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(resp.Kvs[0].Value), 10, 64)
+}
+
+// SaveCursor updates the last scanned block height in etcd
+func (e *EtcdStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	if e.allowRegression {
+		return e.ForceRewind(ctx, key, height)
+	}
+	fullKey := e.prefix + key
+	value := strconv.FormatUint(height, 10)
+	return e.retry(ctx, func(ctx context.Context) error {
+		// Compare-and-swap on the revision read, retried if another writer got in between
+		for {
+			resp, err := e.client.Get(ctx, fullKey)
+			if err != nil {
+				return err
+			}
+			var rev int64
+			if len(resp.Kvs) > 0 {
+				saved, err := strconv.ParseUint(string(resp.Kvs[0].Value), 10, 64)
+				if err != nil {
+					return err
+				}
+				if height < saved {
+					return regressionError(key, height)
+				}
+				rev = resp.Kvs[0].ModRevision
+			}
+			txn, err := e.client.Txn(ctx).
+				If(clientv3.Compare(clientv3.ModRevision(fullKey), "=", rev)).
+				Then(clientv3.OpPut(fullKey, value)).
+				Commit()
+			if err != nil || txn.Succeeded {
+				return err
+			}
+		}
+	})
+}
+
+// ForceRewind saves height in etcd even if it is below the saved cursor
+func (e *EtcdStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	return e.retry(ctx, func(ctx context.Context) error {
+		_, err := e.client.Put(ctx, e.prefix+key, strconv.FormatUint(height, 10))
+		return err
+	})
+}
+
+// ListCursors returns the cursors stored under the prefix
+func (e *EtcdStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	var resp *clientv3.GetResponse
+	err := e.retry(ctx, func(ctx context.Context) (err error) {
+		resp, err = e.client.Get(ctx, e.prefix, clientv3.WithPrefix())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	cursors := make(map[string]uint64, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		height, err := strconv.ParseUint(string(kv.Value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cursor %s: %w", kv.Key, err)
+		}
+		cursors[strings.TrimPrefix(string(kv.Key), e.prefix)] = height
+	}
+	return cursors, nil
+}
+
+// DeleteCursor removes a cursor from etcd
+func (e *EtcdStore) DeleteCursor(ctx context.Context, key string) error {
+	return e.retry(ctx, func(ctx context.Context) error {
+		_, err := e.client.Delete(ctx, e.prefix+key)
+		return err
+	})
+}
+
+// Ping checks that the etcd cluster serves requests
+func (e *EtcdStore) Ping(ctx context.Context) error {
+	return e.retry(ctx, func(ctx context.Context) error {
+		_, err := e.client.Get(ctx, e.prefix, clientv3.WithCountOnly())
+		return err
+	})
+}
+
+// Close closes the etcd client connection
+func (e *EtcdStore) Close() error {
+	return e.client.Close()
+}
+
+// retry runs op with a timeout per attempt, retrying errors caused by a
+// leader change or an unavailable member until ctx is done.
+func (e *EtcdStore) retry(ctx context.Context, op func(ctx context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		opCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		err = op(opCtx)
+		cancel()
+		if err == nil || attempt == etcdAttempts || ctx.Err() != nil || !etcdRetryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(e.backoff * time.Duration(attempt)):
+		}
+	}
+}
+
+// etcdRetryable reports whether err is transient, e.g. raised during a leader election.
+func etcdRetryable(err error) bool {
+	switch rpctypes.Error(err) {
+	case rpctypes.ErrLeaderChanged, rpctypes.ErrNoLeader, rpctypes.ErrTimeoutDueToLeaderFail, rpctypes.ErrTimeout:
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.Unavailable
+}
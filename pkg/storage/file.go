@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// FileStoreConfig configures a FileStore.
+type FileStoreConfig struct {
+	Path   string // JSON file holding the cursors, created on the first save
+	Prefix string
+	// FlushInterval coalesces saves: cursors are written at most once per
+	// interval and on Close instead of on every SaveCursor. 0 writes every save.
+	// A crash loses at most the saves of the last interval.
+	FlushInterval time.Duration
+}
+
+// FileStore implements the Persistence interface on a local JSON file, for
+// single-node deployments that should survive a restart without a database.
+// The file is replaced atomically on every write, so a crash leaves either the
+// previous or the new cursors, never a partial file.
+type FileStore struct {
+	monotonic
+	path     string
+	prefix   string
+	interval time.Duration
+
+	mu      sync.Mutex
+	cursors map[string]uint64
+	dirty   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// fileStoreData is the file layout. Checksum is the hex SHA-256 of the JSON
+// encoding of Cursors, detecting files corrupted outside of the store.
+type fileStoreData struct {
+	Checksum string            `json:"checksum"`
+	Cursors  map[string]uint64 `json:"cursors"`
+}
+
+// NewFileStore initializes file storage writing path on every save.
+func NewFileStore(path, prefix string) (*FileStore, error) {
+	return NewFileStoreWithConfig(FileStoreConfig{Path: path, Prefix: prefix})
+}
+
+// NewFileStoreWithConfig initializes file storage from cfg, loading the
+// cursors saved in cfg.Path. A corrupt file is an error rather than a reason to
+// start over from block 0.
+func NewFileStoreWithConfig(cfg FileStoreConfig) (*FileStore, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("cursor file path is required")
+	}
+	if info, err := os.Stat(filepath.Dir(cfg.Path)); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", filepath.Dir(cfg.Path))
+	}
+	cursors, err := readCursorFile(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FileStore{
+		path:     cfg.Path,
+		prefix:   cfg.Prefix,
+		interval: cfg.FlushInterval,
+		cursors:  cursors,
+		done:     make(chan struct{}),
+	}
+	if f.interval > 0 {
+		f.wg.Add(1)
+		go f.flushLoop()
+	}
+	return f, nil
+}
+
+// LoadCursor retrieves the last scanned block height from the file.
+func (f *FileStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cursors[f.prefix+key], nil
+}
+
+// SaveCursor updates the last scanned block height, writing the file unless
+// saves are coalesced.
+func (f *FileStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	return f.save(key, height, false)
+}
+
+// ForceRewind saves height even if it is below the saved cursor.
+func (f *FileStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	return f.save(key, height, true)
+}
+
+func (f *FileStore) save(key string, height uint64, force bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !force && !f.allowRegression && height < f.cursors[f.prefix+key] {
+		return regressionError(key, height)
+	}
+	f.cursors[f.prefix+key] = height
+	f.dirty = true
+	if f.interval > 0 {
+		return nil
+	}
+	return f.flushLocked()
+}
+
+// ListCursors returns the cursors of the file.
+func (f *FileStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cursors := make(map[string]uint64, len(f.cursors))
+	for key, height := range f.cursors {
+		if strings.HasPrefix(key, f.prefix) {
+			cursors[strings.TrimPrefix(key, f.prefix)] = height
+		}
+	}
+	return cursors, nil
+}
+
+// DeleteCursor removes a cursor, writing the file unless saves are coalesced.
+func (f *FileStore) DeleteCursor(ctx context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.cursors[f.prefix+key]; !ok {
+		return nil
+	}
+	delete(f.cursors, f.prefix+key)
+	f.dirty = true
+	if f.interval > 0 {
+		return nil
+	}
+	return f.flushLocked()
+}
+
+// Ping checks that the directory of the file still exists.
+func (f *FileStore) Ping(ctx context.Context) error {
+	_, err := os.Stat(filepath.Dir(f.path))
+	return err
+}
+
+// Close writes pending cursors and stops the flush loop.
+func (f *FileStore) Close() error {
+	select {
+	case <-f.done:
+		return nil
+	default:
+		close(f.done)
+	}
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flushLocked()
+}
+
+func (f *FileStore) flushLoop() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+			f.mu.Lock()
+			if err := f.flushLocked(); err != nil {
+				log.Error("Failed to write cursor file", "path", f.path, "err", err)
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+func (f *FileStore) flushLocked() error {
+	if !f.dirty {
+		return nil
+	}
+	if err := writeCursorFile(f.path, f.cursors); err != nil {
+		return err
+	}
+	f.dirty = false
+	return nil
+}
+
+func cursorChecksum(cursors map[string]uint64) (string, error) {
+	data, err := json.Marshal(cursors) // Map keys are sorted, so the encoding is stable
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readCursorFile loads the cursors of path, or none if it does not exist yet.
+func readCursorFile(path string) (map[string]uint64, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]uint64), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data fileStoreData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("corrupt cursor file %s: %w", path, err)
+	}
+	if data.Cursors == nil {
+		data.Cursors = make(map[string]uint64)
+	}
+	sum, err := cursorChecksum(data.Cursors)
+	if err != nil {
+		return nil, err
+	}
+	if sum != data.Checksum {
+		return nil, fmt.Errorf("corrupt cursor file %s: checksum mismatch", path)
+	}
+	return data.Cursors, nil
+}
+
+// writeCursorFile replaces path atomically with the cursors and their checksum.
+func writeCursorFile(path string, cursors map[string]uint64) error {
+	sum, err := cursorChecksum(cursors)
+	if err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(fileStoreData{Checksum: sum, Cursors: cursors}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(raw, '\n'))
+}
+
+// writeFileAtomic replaces path with data: data is written and synced to a
+// temporary file in the same directory, which is then renamed over path.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
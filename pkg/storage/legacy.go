@@ -0,0 +1,43 @@
+package storage
+
+import "context"
+
+// LegacyPersistence is the Persistence interface of earlier versions, whose
+// methods take no context.
+type LegacyPersistence interface {
+	LoadCursor(key string) (uint64, error)
+	SaveCursor(key string, height uint64) error
+	Close() error
+}
+
+// FromLegacy adapts a store written against LegacyPersistence. Its calls cannot
+// be cancelled: the context is checked before each one only.
+func FromLegacy(store LegacyPersistence) Persistence {
+	return legacyStore{store}
+}
+
+type legacyStore struct {
+	store LegacyPersistence
+}
+
+func (l legacyStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return l.store.LoadCursor(key)
+}
+
+func (l legacyStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return l.store.SaveCursor(key, height)
+}
+
+func (l legacyStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (l legacyStore) Close() error {
+	return l.store.Close()
+}
@@ -1,53 +1,260 @@
 package storage
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
-// Persistence defines the interface for saving scanner progress
+// Persistence defines the interface for saving scanner progress. Stores stop
+// waiting on their backend once ctx is done; stores written against the
+// context-free interface of earlier versions are adapted by FromLegacy.
 type Persistence interface {
 	// LoadCursor reads the last scanned block height
 	// key: task identifier (e.g., "erc20-scanner-v1")
-	LoadCursor(key string) (uint64, error)
+	LoadCursor(ctx context.Context, key string) (uint64, error)
 
 	// SaveCursor saves the current block height
-	SaveCursor(key string, height uint64) error
+	SaveCursor(ctx context.Context, key string, height uint64) error
+
+	// Ping checks that the store is reachable
+	Ping(ctx context.Context) error
 
 	// Close releases resources
 	Close() error
 }
 
-// MemoryStore is a simple in-memory implementation (Note: data lost on restart, for testing/temp tasks only)
+// Checkpoint is the scan progress of a task with metadata to verify it.
+type Checkpoint struct {
+	Height      uint64      `json:"height"`       // Next block to scan, as saved by SaveCursor
+	BlockHash   common.Hash `json:"block_hash"`   // Hash of block Height-1, the last one scanned; zero if not tracked
+	UpdatedAt   time.Time   `json:"updated_at"`   // When the checkpoint was saved; set on save if zero
+	LogsScanned uint64      `json:"logs_scanned"` // Logs processed by the task so far
+}
+
+// CheckpointPersistence is a Persistence that also stores checkpoint metadata,
+// e.g. to tell when a chain last advanced or whether the last scanned block was
+// reorganized away while the scanner was down. LoadCursor and SaveCursor
+// operate on the checkpoint height: SaveCursor(key, h) saves Checkpoint{Height: h}.
+type CheckpointPersistence interface {
+	Persistence
+
+	// LoadCheckpoint reads the last saved checkpoint, zero if there is none.
+	LoadCheckpoint(ctx context.Context, key string) (Checkpoint, error)
+
+	// SaveCheckpoint saves the current checkpoint.
+	SaveCheckpoint(ctx context.Context, key string, cp Checkpoint) error
+}
+
+var (
+	_ CheckpointPersistence = (*MemoryStore)(nil)
+	_ CheckpointPersistence = (*RedisStore)(nil)
+	_ CheckpointPersistence = (*PostgresStore)(nil)
+)
+
+// ErrCursorRegression is returned when saving a cursor below the saved one.
+var ErrCursorRegression = errors.New("cursor regression")
+
+// Rewinder is a Persistence whose saves never move a cursor backwards, so that
+// a misconfigured start block or a second replica cannot silently overwrite
+// progress and cause events to be emitted again. Such saves fail with
+// ErrCursorRegression; deliberate rewinds go through ForceRewind.
+// All stores of this package are Rewinders, see SetMonotonic.
+type Rewinder interface {
+	Persistence
+
+	// ForceRewind saves height even if it is below the saved cursor.
+	ForceRewind(ctx context.Context, key string, height uint64) error
+}
+
+var (
+	_ Rewinder = (*MemoryStore)(nil)
+	_ Rewinder = (*RedisStore)(nil)
+	_ Rewinder = (*PostgresStore)(nil)
+	_ Rewinder = (*SQLiteStore)(nil)
+	_ Rewinder = (*EtcdStore)(nil)
+	_ Rewinder = (*FileStore)(nil)
+)
+
+// CursorAdmin is a Persistence whose cursors can be listed and deleted, e.g.
+// to inspect and fix the progress of many scan tasks. All stores of this
+// package are CursorAdmins.
+type CursorAdmin interface {
+	Persistence
+
+	// ListCursors returns the saved cursors by task key.
+	ListCursors(ctx context.Context) (map[string]uint64, error)
+
+	// DeleteCursor removes the cursor of a task, which then starts over as on
+	// its first run. Deleting a missing cursor is not an error.
+	DeleteCursor(ctx context.Context, key string) error
+}
+
+var (
+	_ CursorAdmin = (*MemoryStore)(nil)
+	_ CursorAdmin = (*RedisStore)(nil)
+	_ CursorAdmin = (*PostgresStore)(nil)
+	_ CursorAdmin = (*SQLiteStore)(nil)
+	_ CursorAdmin = (*EtcdStore)(nil)
+	_ CursorAdmin = (*FileStore)(nil)
+)
+
+// monotonic holds the regression protection setting of a store.
+type monotonic struct {
+	allowRegression bool
+}
+
+// SetMonotonic turns the protection against saving a cursor below the saved
+// one on or off. It is on by default.
+func (m *monotonic) SetMonotonic(enabled bool) {
+	m.allowRegression = !enabled
+}
+
+func regressionError(key string, height uint64) error {
+	return fmt.Errorf("%w: refusing to move %s back to %d, use ForceRewind", ErrCursorRegression, key, height)
+}
+
+// MemoryStore is a simple in-memory implementation (Note: data lost on restart
+// unless created by NewMemoryStoreFromFile, for testing/temp tasks only)
 type MemoryStore struct {
-	data   map[string]uint64
+	monotonic
+	data   map[string]Checkpoint
 	prefix string
+	path   string // Snapshot written on Close, if any
 	mu     sync.RWMutex
 }
 
 // NewMemoryStore initializes a new in-memory storage.
 func NewMemoryStore(prefix string) *MemoryStore {
 	return &MemoryStore{
-		data:   make(map[string]uint64),
+		data:   make(map[string]Checkpoint),
 		prefix: prefix,
 	}
 }
 
+// NewMemoryStoreFromFile initializes in-memory storage restored from the
+// snapshot at path, if it exists, and writing a snapshot there on Close.
+// Unlike FileStore, progress since the last Close is lost on a crash, which
+// suits development runs.
+func NewMemoryStoreFromFile(path, prefix string) (*MemoryStore, error) {
+	m := NewMemoryStore(prefix)
+	m.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Restore(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Snapshot returns the checkpoints of all prefixes as JSON, for Restore.
+func (m *MemoryStore) Snapshot() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return json.Marshal(m.data)
+}
+
+// Restore replaces the checkpoints with those of a Snapshot. The store is
+// unchanged if the snapshot is corrupt.
+func (m *MemoryStore) Restore(snapshot []byte) error {
+	data := make(map[string]Checkpoint)
+	if err := json.Unmarshal(snapshot, &data); err != nil {
+		return fmt.Errorf("corrupt memory store snapshot: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = data
+	return nil
+}
+
 // LoadCursor retrieves the last scanned block height from memory.
-func (m *MemoryStore) LoadCursor(key string) (uint64, error) {
+func (m *MemoryStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	cp, err := m.LoadCheckpoint(ctx, key)
+	return cp.Height, err
+}
+
+// SaveCursor updates the last scanned block height in memory.
+func (m *MemoryStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	return m.SaveCheckpoint(ctx, key, Checkpoint{Height: height})
+}
+
+// LoadCheckpoint retrieves the last checkpoint from memory.
+func (m *MemoryStore) LoadCheckpoint(ctx context.Context, key string) (Checkpoint, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	return m.data[m.prefix+key], nil
 }
 
-// SaveCursor updates the last scanned block height in memory.
-func (m *MemoryStore) SaveCursor(key string, height uint64) error {
+// SaveCheckpoint updates the checkpoint in memory.
+func (m *MemoryStore) SaveCheckpoint(ctx context.Context, key string, cp Checkpoint) error {
+	return m.save(key, cp, false)
+}
+
+// ForceRewind saves height in memory even if it is below the saved cursor.
+func (m *MemoryStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	return m.save(key, Checkpoint{Height: height}, true)
+}
+
+// ListCursors returns the cursors in memory.
+func (m *MemoryStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cursors := make(map[string]uint64, len(m.data))
+	for key, cp := range m.data {
+		if strings.HasPrefix(key, m.prefix) {
+			cursors[strings.TrimPrefix(key, m.prefix)] = cp.Height
+		}
+	}
+	return cursors, nil
+}
+
+// DeleteCursor removes a cursor from memory.
+func (m *MemoryStore) DeleteCursor(ctx context.Context, key string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.data[m.prefix+key] = height
+	delete(m.data, m.prefix+key)
 	return nil
 }
 
-// Close implements the Persistence interface.
-func (m *MemoryStore) Close() error {
+func (m *MemoryStore) save(key string, cp Checkpoint, force bool) error {
+	if cp.UpdatedAt.IsZero() {
+		cp.UpdatedAt = time.Now()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !force && !m.allowRegression && cp.Height < m.data[m.prefix+key].Height {
+		return regressionError(key, cp.Height)
+	}
+	m.data[m.prefix+key] = cp
 	return nil
 }
+
+// Ping implements the Persistence interface. Memory is always reachable.
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close implements the Persistence interface, writing the snapshot file of a
+// store created by NewMemoryStoreFromFile.
+func (m *MemoryStore) Close() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := m.Snapshot()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, data)
+}
@@ -1,66 +1,136 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	_ "github.com/lib/pq"
 )
 
-// PostgresStore implements the Persistence interface
+// TxPersistence is a Persistence that can save the cursor within a database
+// transaction shared with other writes, so that events written to the same
+// database and the scan progress are committed atomically.
+type TxPersistence interface {
+	Persistence
+
+	// BeginTx starts a transaction on the store's database.
+	BeginTx(ctx context.Context) (*sql.Tx, error)
+
+	// SaveCursorTx saves the current block height within tx. It takes effect when tx commits.
+	SaveCursorTx(ctx context.Context, tx *sql.Tx, key string, height uint64) error
+}
+
+var _ TxPersistence = (*PostgresStore)(nil)
+
+// PostgresStoreConfig configures a PostgresStore.
+type PostgresStoreConfig struct {
+	URL         string // Connection string
+	TablePrefix string // Defaults to "scanner_" -> Resulting table is prefix + "checkpoints"
+
+	// Connection pool, see sql.DB. Zero values keep the database/sql defaults.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+
+	// StatementTimeout bounds each query of the store, so that a hung database
+	// fails SaveCursor instead of stalling the scan loop. Default 5s, negative
+	// for no limit besides the caller's context.
+	StatementTimeout time.Duration
+}
+
+// PostgresStore implements the Persistence and TxPersistence interfaces
 type PostgresStore struct {
+	monotonic
 	db        *sql.DB
 	tableName string
+	timeout   time.Duration
 }
 
 // NewPostgresStore initializes PostgreSQL storage.
 // connStr: Connection string
 // tablePrefix: Table prefix (defaults to "scanner_") -> Resulting table is prefix + "checkpoints"
 func NewPostgresStore(connStr string, tablePrefix string) (*PostgresStore, error) {
-	db, err := sql.Open("postgres", connStr)
+	return NewPostgresStoreWithConfig(PostgresStoreConfig{URL: connStr, TablePrefix: tablePrefix})
+}
+
+// NewPostgresStoreWithConfig initializes PostgreSQL storage from cfg.
+func NewPostgresStoreWithConfig(cfg PostgresStoreConfig) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", cfg.URL)
 	if err != nil {
 		return nil, err
 	}
-
-	if err := db.Ping(); err != nil {
-		return nil, err
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
 	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
+	tablePrefix := cfg.TablePrefix
 	if tablePrefix == "" {
 		tablePrefix = "scanner_"
 	}
-	tableName := tablePrefix + "checkpoints"
-
+	timeout := cfg.StatementTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
 	store := &PostgresStore{
 		db:        db,
-		tableName: tableName,
+		tableName: tablePrefix + "checkpoints",
+		timeout:   timeout,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	if err := store.initTable(); err != nil {
+	if err := store.initTable(ctx); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return store, nil
 }
 
-// initTable automatically creates the scan progress table
-func (p *PostgresStore) initTable() error {
+// withTimeout bounds a query by the statement timeout.
+func (p *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+// initTable automatically creates the scan progress table, adding the
+// checkpoint metadata columns to tables created by older versions
+func (p *PostgresStore) initTable(ctx context.Context) error {
 	query := fmt.Sprintf(`
-	CREATE TABLE IF NOT EXISTS %s (
+	CREATE TABLE IF NOT EXISTS %[1]s (
 		task_key VARCHAR(255) PRIMARY KEY,
 		block_height BIGINT NOT NULL,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
+	ALTER TABLE %[1]s
+		ADD COLUMN IF NOT EXISTS block_hash VARCHAR(66),
+		ADD COLUMN IF NOT EXISTS logs_scanned BIGINT NOT NULL DEFAULT 0;
 	`, p.tableName)
-	_, err := p.db.Exec(query)
+	_, err := p.db.ExecContext(ctx, query)
 	return err
 }
 
 // LoadCursor retrieves the last scanned block height for a given task key
-func (p *PostgresStore) LoadCursor(key string) (uint64, error) {
+func (p *PostgresStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
 	var height uint64
 	query := fmt.Sprintf("SELECT block_height FROM %s WHERE task_key = $1", p.tableName)
-	err := p.db.QueryRow(query, key).Scan(&height)
+	err := p.db.QueryRowContext(ctx, query, key).Scan(&height)
 	if err == sql.ErrNoRows {
 		return 0, nil
 	}
@@ -71,16 +141,161 @@ func (p *PostgresStore) LoadCursor(key string) (uint64, error) {
 }
 
 // SaveCursor updates or inserts the last scanned block height for a given task key
-func (p *PostgresStore) SaveCursor(key string, height uint64) error {
-	// Upsert using Postgres ON CONFLICT syntax
+func (p *PostgresStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, p.saveQuery(false), key, height)
+	return checkSaved(res, err, key, height)
+}
+
+// ForceRewind saves height for a given task key even if it is below the saved cursor
+func (p *PostgresStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, p.saveQuery(true), key, height)
+	return err
+}
+
+// ListCursors returns the block heights of all task keys in the table
+func (p *PostgresStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return listCursors(ctx, p.db, p.tableName)
+}
+
+// DeleteCursor removes the progress of a given task key
+func (p *PostgresStore) DeleteCursor(ctx context.Context, key string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE task_key = $1", p.tableName), key)
+	return err
+}
+
+// listCursors reads the checkpoints table of a SQL store.
+func listCursors(ctx context.Context, db *sql.DB, table string) (map[string]uint64, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT task_key, block_height FROM %s", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cursors := make(map[string]uint64)
+	for rows.Next() {
+		var (
+			key    string
+			height uint64
+		)
+		if err := rows.Scan(&key, &height); err != nil {
+			return nil, err
+		}
+		cursors[key] = height
+	}
+	return cursors, rows.Err()
+}
+
+// LoadCheckpoint retrieves the last checkpoint for a given task key
+func (p *PostgresStore) LoadCheckpoint(ctx context.Context, key string) (Checkpoint, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		cp        Checkpoint
+		hash      sql.NullString
+		updatedAt sql.NullTime
+	)
+	query := fmt.Sprintf("SELECT block_height, block_hash, logs_scanned, updated_at FROM %s WHERE task_key = $1", p.tableName)
+	err := p.db.QueryRowContext(ctx, query, key).Scan(&cp.Height, &hash, &cp.LogsScanned, &updatedAt)
+	if err == sql.ErrNoRows {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if hash.Valid {
+		cp.BlockHash = common.HexToHash(hash.String)
+	}
+	cp.UpdatedAt = updatedAt.Time
+	return cp, nil
+}
+
+// SaveCheckpoint updates or inserts the checkpoint for a given task key
+func (p *PostgresStore) SaveCheckpoint(ctx context.Context, key string, cp Checkpoint) error {
+	var hash sql.NullString
+	if cp.BlockHash != (common.Hash{}) {
+		hash = sql.NullString{String: cp.BlockHash.Hex(), Valid: true}
+	}
+	if cp.UpdatedAt.IsZero() {
+		cp.UpdatedAt = time.Now()
+	}
 	query := fmt.Sprintf(`
-	INSERT INTO %s (task_key, block_height, updated_at)
+	INSERT INTO %[1]s (task_key, block_height, block_hash, logs_scanned, updated_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (task_key)
+	DO UPDATE SET block_height = EXCLUDED.block_height, block_hash = EXCLUDED.block_hash,
+		logs_scanned = EXCLUDED.logs_scanned, updated_at = EXCLUDED.updated_at
+	%[2]s;
+	`, p.tableName, p.monotonicClause(false))
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, query, key, cp.Height, hash, cp.LogsScanned, cp.UpdatedAt.UTC())
+	return checkSaved(res, err, key, cp.Height)
+}
+
+// Ping checks the connection to the database
+func (p *PostgresStore) Ping(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return p.db.PingContext(ctx)
+}
+
+// BeginTx starts a transaction on the store's database.
+func (p *PostgresStore) BeginTx(ctx context.Context) (*sql.Tx, error) {
+	return p.db.BeginTx(ctx, nil)
+}
+
+// SaveCursorTx is SaveCursor within tx.
+func (p *PostgresStore) SaveCursorTx(ctx context.Context, tx *sql.Tx, key string, height uint64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, p.saveQuery(false), key, height)
+	return checkSaved(res, err, key, height)
+}
+
+func (p *PostgresStore) saveQuery(force bool) string {
+	// Upsert using Postgres ON CONFLICT syntax
+	return fmt.Sprintf(`
+	INSERT INTO %[1]s (task_key, block_height, updated_at)
 	VALUES ($1, $2, NOW())
 	ON CONFLICT (task_key) 
-	DO UPDATE SET block_height = EXCLUDED.block_height, updated_at = NOW();
-	`, p.tableName)
-	_, err := p.db.Exec(query, key, height)
-	return err
+	DO UPDATE SET block_height = EXCLUDED.block_height, block_hash = NULL, logs_scanned = 0, updated_at = NOW()
+	%[2]s;
+	`, p.tableName, p.monotonicClause(force))
+}
+
+// monotonicClause restricts an upsert to heights not below the saved one.
+func (p *PostgresStore) monotonicClause(force bool) string {
+	if force || p.allowRegression {
+		return ""
+	}
+	return fmt.Sprintf("WHERE %s.block_height <= EXCLUDED.block_height", p.tableName)
+}
+
+// checkSaved turns an upsert that changed no row, skipped by its monotonic
+// clause, into ErrCursorRegression.
+func checkSaved(res sql.Result, err error, key string, height uint64) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return regressionError(key, height)
+	}
+	return nil
 }
 
 // Close closes the database connection
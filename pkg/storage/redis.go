@@ -2,14 +2,59 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/84hero/evm-scanner/pkg/redisconfig"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/redis/go-redis/v9"
 )
 
+// checkpointSuffix names the hash holding the checkpoint metadata of a cursor,
+// next to the plain cursor value that LoadCursor reads.
+const checkpointSuffix = ":checkpoint"
+
+// checkpointKey returns the metadata hash of the cursor fullKey. The cursor is
+// its hash tag, so that both are in the same Redis Cluster slot and can be
+// written by one script.
+func checkpointKey(fullKey string) string {
+	if strings.ContainsAny(fullKey, "{}") {
+		return fullKey + checkpointSuffix // Already tagged, or cannot be
+	}
+	return "{" + fullKey + "}" + checkpointSuffix
+}
+
+// saveScript sets the cursor KEYS[1] to ARGV[1] unless that moves it backwards
+// and ARGV[2] is not "1" (force), then stores the remaining arguments as field
+// value pairs in the metadata hash KEYS[2]. It returns 0 if the save was refused.
+var saveScript = redis.NewScript(`
+local saved = tonumber(redis.call('GET', KEYS[1]) or '0')
+if ARGV[2] ~= '1' and tonumber(ARGV[1]) < saved then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1])
+if #ARGV > 2 then
+	redis.call('HSET', KEYS[2], unpack(ARGV, 3))
+end
+return 1
+`)
+
+// RedisStoreConfig configures a RedisStore.
+type RedisStoreConfig struct {
+	redisconfig.Config
+	// Prefix: Key prefix (e.g., "evm_scanner:"). Final Key is prefix + task_key
+	Prefix string
+}
+
 // RedisStore implements the Persistence interface using Redis as a backend.
+// Commands failing during a Sentinel or Cluster failover are retried by the
+// client within the 2s budget of each operation.
 type RedisStore struct {
-	client *redis.Client
+	monotonic
+	client redis.UniversalClient
 	prefix string
 }
 
@@ -17,19 +62,30 @@ type RedisStore struct {
 // addr: e.g., "localhost:6379"
 // prefix: Key prefix (e.g., "evm_scanner:"). Final Key is prefix + task_key
 func NewRedisStore(addr, password string, db int, prefix string) (*RedisStore, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
+	return NewRedisStoreWithConfig(RedisStoreConfig{
+		Config: redisconfig.Config{Addr: addr, Password: password, DB: db},
+		Prefix: prefix,
 	})
+}
+
+// NewRedisStoreWithConfig initializes Redis storage on a standalone,
+// Sentinel-managed or clustered deployment.
+func NewRedisStoreWithConfig(cfg RedisStoreConfig) (*RedisStore, error) {
+	rdb, err := cfg.NewClient()
+	if err != nil {
+		return nil, err
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
 		return nil, err
 	}
 
+	prefix := cfg.Prefix
+
 	if prefix == "" {
 		prefix = "scanner:"
 	}
@@ -41,8 +97,8 @@ func NewRedisStore(addr, password string, db int, prefix string) (*RedisStore, e
 }
 
 // LoadCursor retrieves the last scanned block height from Redis
-func (r *RedisStore) LoadCursor(key string) (uint64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+func (r *RedisStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
 	fullKey := r.prefix + key
@@ -58,14 +114,148 @@ func (r *RedisStore) LoadCursor(key string) (uint64, error) {
 }
 
 // SaveCursor updates the last scanned block height in Redis
-func (r *RedisStore) SaveCursor(key string, height uint64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+func (r *RedisStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	return r.save(ctx, key, height, false)
+}
+
+// ForceRewind saves height in Redis even if it is below the saved cursor
+func (r *RedisStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	return r.save(ctx, key, height, true)
+}
+
+// LoadCheckpoint retrieves the last checkpoint from Redis. Metadata saved for
+// another height, e.g. before a SaveCursor, is ignored.
+func (r *RedisStore) LoadCheckpoint(ctx context.Context, key string) (Checkpoint, error) {
+	height, err := r.LoadCursor(ctx, key)
+	if err != nil || height == 0 {
+		return Checkpoint{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	fields, err := r.client.HGetAll(ctx, checkpointKey(r.prefix+key)).Result()
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	cp := Checkpoint{Height: height}
+	if fields["height"] != strconv.FormatUint(height, 10) {
+		return cp, nil
+	}
+	cp.BlockHash = common.HexToHash(fields["block_hash"])
+	cp.LogsScanned, _ = strconv.ParseUint(fields["logs_scanned"], 10, 64)
+	if ms, err := strconv.ParseInt(fields["updated_at"], 10, 64); err == nil {
+		cp.UpdatedAt = time.UnixMilli(ms)
+	}
+	return cp, nil
+}
+
+// SaveCheckpoint updates the cursor and its metadata hash atomically.
+func (r *RedisStore) SaveCheckpoint(ctx context.Context, key string, cp Checkpoint) error {
+	if cp.UpdatedAt.IsZero() {
+		cp.UpdatedAt = time.Now()
+	}
+	return r.save(ctx, key, cp.Height, false,
+		"height", cp.Height,
+		"block_hash", cp.BlockHash.Hex(),
+		"updated_at", cp.UpdatedAt.UnixMilli(),
+		"logs_scanned", cp.LogsScanned,
+	)
+}
+
+// save runs saveScript, with the cursor set to no expiration.
+func (r *RedisStore) save(ctx context.Context, key string, height uint64, force bool, meta ...interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
 	fullKey := r.prefix + key
+	forced := "0"
+	if force || r.allowRegression {
+		forced = "1"
+	}
+	saved, err := saveScript.Run(ctx, r.client, []string{fullKey, checkpointKey(fullKey)},
+		append([]interface{}{height, forced}, meta...)...).Int()
+	if err != nil {
+		return err
+	}
+	if saved == 0 {
+		return regressionError(key, height)
+	}
+	return nil
+}
 
-	// Set value with no expiration (0)
-	return r.client.Set(ctx, fullKey, height, 0).Err()
+// ListCursors returns the cursors stored under the prefix, scanning the keyspace
+func (r *RedisStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	scan := func(ctx context.Context, client redis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, globEscape(r.prefix)+"*", 1000).Iterator()
+		for iter.Next(ctx) {
+			if key := iter.Val(); !strings.HasSuffix(key, checkpointSuffix) {
+				mu.Lock()
+				keys = append(keys, key)
+				mu.Unlock()
+			}
+		}
+		return iter.Err()
+	}
+	var err error
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		// SCAN covers a single node: scan every master
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
+	} else {
+		err = scan(ctx, r.client)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cursors := make(map[string]uint64, len(keys))
+	for _, key := range keys {
+		height, err := r.client.Get(ctx, key).Uint64()
+		if err == redis.Nil {
+			continue // Deleted since the scan
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cursor %s: %w", key, err)
+		}
+		cursors[strings.TrimPrefix(key, r.prefix)] = height
+	}
+	return cursors, nil
+}
+
+// DeleteCursor removes a cursor and its checkpoint metadata from Redis
+func (r *RedisStore) DeleteCursor(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	fullKey := r.prefix + key
+	return r.client.Del(ctx, fullKey, checkpointKey(fullKey)).Err()
+}
+
+// Ping checks the connection to Redis
+func (r *RedisStore) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	return r.client.Ping(ctx).Err()
+}
+
+// globEscape escapes the pattern characters of s for SCAN MATCH.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
 }
 
 // Close closes the Redis client connection
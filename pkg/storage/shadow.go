@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+var _ Rewinder = (*ShadowStore)(nil)
+
+// ShadowStore reads the cursors of another store but keeps the cursors saved
+// in memory, leaving the store untouched, e.g. for dry runs: a later run with
+// the store resumes where it was. Create one with Shadow.
+type ShadowStore struct {
+	store Persistence
+
+	mu    sync.Mutex
+	saved map[string]uint64
+}
+
+// Shadow wraps store so that saves do not reach it.
+func Shadow(store Persistence) *ShadowStore {
+	return &ShadowStore{store: store, saved: make(map[string]uint64)}
+}
+
+// LoadCursor returns the cursor saved in memory, or else the one of the store.
+func (s *ShadowStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	s.mu.Lock()
+	height, ok := s.saved[key]
+	s.mu.Unlock()
+	if ok {
+		return height, nil
+	}
+	return s.store.LoadCursor(ctx, key)
+}
+
+// SaveCursor saves height in memory.
+func (s *ShadowStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved[key] = height
+	return nil
+}
+
+// ForceRewind saves height in memory, as SaveCursor.
+func (s *ShadowStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	return s.SaveCursor(ctx, key, height)
+}
+
+// Ping pings the store.
+func (s *ShadowStore) Ping(ctx context.Context) error {
+	return s.store.Ping(ctx)
+}
+
+// Close closes the store.
+func (s *ShadowStore) Close() error {
+	return s.store.Close()
+}
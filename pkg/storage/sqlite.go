@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/84hero/evm-scanner/internal/sqlitedb"
+)
+
+// SQLiteStore implements the Persistence interface on a local SQLite file.
+// It shares its database handle with sink.SQLiteOutput when both point at the same file.
+type SQLiteStore struct {
+	monotonic
+	db        *sqlitedb.DB
+	tableName string
+}
+
+// NewSQLiteStore initializes SQLite storage.
+// path: Database file (created if missing, opened in WAL mode)
+// tablePrefix: Table prefix (defaults to "scanner_") -> Resulting table is prefix + "checkpoints"
+func NewSQLiteStore(path string, tablePrefix string) (*SQLiteStore, error) {
+	db, err := sqlitedb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if tablePrefix == "" {
+		tablePrefix = "scanner_"
+	}
+
+	store := &SQLiteStore{
+		db:        db,
+		tableName: sqlitedb.QuoteIdent(tablePrefix + "checkpoints"),
+	}
+
+	if err := store.initTable(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// initTable automatically creates the scan progress table
+func (s *SQLiteStore) initTable(ctx context.Context) error {
+	query := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		task_key VARCHAR(255) PRIMARY KEY,
+		block_height BIGINT NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`, s.tableName)
+	_, err := s.db.ExecContext(ctx, query)
+	return err
+}
+
+// LoadCursor retrieves the last scanned block height for a given task key
+func (s *SQLiteStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	var height uint64
+	query := fmt.Sprintf("SELECT block_height FROM %s WHERE task_key = ?", s.tableName)
+	err := s.db.QueryRowContext(ctx, query, key).Scan(&height)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return height, nil
+}
+
+// SaveCursor updates or inserts the last scanned block height for a given task key
+func (s *SQLiteStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	res, err := s.db.ExecContext(ctx, s.saveQuery(false), key, height)
+	return checkSaved(res, err, key, height)
+}
+
+// ForceRewind saves height for a given task key even if it is below the saved cursor
+func (s *SQLiteStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	_, err := s.db.ExecContext(ctx, s.saveQuery(true), key, height)
+	return err
+}
+
+// ListCursors returns the block heights of all task keys in the table
+func (s *SQLiteStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	return listCursors(ctx, s.db.DB, s.tableName)
+}
+
+// DeleteCursor removes the progress of a given task key
+func (s *SQLiteStore) DeleteCursor(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE task_key = ?", s.tableName), key)
+	return err
+}
+
+func (s *SQLiteStore) saveQuery(force bool) string {
+	where := ""
+	if !force && !s.allowRegression {
+		where = fmt.Sprintf("WHERE %s.block_height <= excluded.block_height", s.tableName)
+	}
+	return fmt.Sprintf(`
+	INSERT INTO %s (task_key, block_height, updated_at)
+	VALUES (?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT (task_key)
+	DO UPDATE SET block_height = excluded.block_height, updated_at = CURRENT_TIMESTAMP
+	%s;
+	`, s.tableName, where)
+}
+
+// Ping checks that the database is usable
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close releases the database handle
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
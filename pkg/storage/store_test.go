@@ -1,30 +1,92 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/84hero/evm-scanner/pkg/redisconfig"
+	"github.com/84hero/evm-scanner/pkg/tlsconfig"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/go-redis/redismock/v9"
+	"github.com/hashicorp/consul/api"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/server/v3/embed"
 )
 
+// assertMonotonic checks that s refuses to move a cursor backwards unless
+// forced or with the protection turned off.
+func assertMonotonic(t *testing.T, s interface {
+	Rewinder
+	SetMonotonic(bool)
+}) {
+	t.Helper()
+	assert.NoError(t, s.SaveCursor(context.Background(), "mono", 200))
+	assert.NoError(t, s.SaveCursor(context.Background(), "mono", 200))
+	assert.ErrorIs(t, s.SaveCursor(context.Background(), "mono", 100), ErrCursorRegression)
+	h, err := s.LoadCursor(context.Background(), "mono")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), h)
+
+	assert.NoError(t, s.ForceRewind(context.Background(), "mono", 100))
+	h, err = s.LoadCursor(context.Background(), "mono")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+	assert.NoError(t, s.SaveCursor(context.Background(), "mono", 150))
+
+	s.SetMonotonic(false)
+	defer s.SetMonotonic(true)
+	assert.NoError(t, s.SaveCursor(context.Background(), "mono", 50))
+	h, err = s.LoadCursor(context.Background(), "mono")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(50), h)
+}
+
+// assertCursorAdmin checks listing and deleting the cursors of an empty store.
+func assertCursorAdmin(t *testing.T, s CursorAdmin) {
+	t.Helper()
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, s.SaveCursor(context.Background(), "task2", 200))
+	cursors, err := s.ListCursors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"task1": 100, "task2": 200}, cursors)
+
+	assert.NoError(t, s.DeleteCursor(context.Background(), "task1"))
+	assert.NoError(t, s.DeleteCursor(context.Background(), "missing"))
+	cursors, err = s.ListCursors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"task2": 200}, cursors)
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), h)
+}
+
 // --- Memory Store Tests ---
 
 func TestMemoryStore(t *testing.T) {
 	s := NewMemoryStore("test_")
-	err := s.SaveCursor("task1", 100)
+	err := s.SaveCursor(context.Background(), "task1", 100)
 	assert.NoError(t, err)
 
-	h, err := s.LoadCursor("task1")
+	h, err := s.LoadCursor(context.Background(), "task1")
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(100), h)
 
-	h, err = s.LoadCursor("unknown")
+	h, err = s.LoadCursor(context.Background(), "unknown")
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(0), h)
 
@@ -32,6 +94,444 @@ func TestMemoryStore(t *testing.T) {
 	assert.NoError(t, s.Close())
 }
 
+func TestMemoryStore_Monotonic(t *testing.T) {
+	s := NewMemoryStore("test_")
+	assertMonotonic(t, s)
+
+	// Checkpoints are protected too
+	assert.ErrorIs(t, s.SaveCheckpoint(context.Background(), "mono", Checkpoint{Height: 10}), ErrCursorRegression)
+}
+
+func TestMemoryStore_ListDelete(t *testing.T) {
+	assertCursorAdmin(t, NewMemoryStore("test_"))
+}
+
+func TestMemoryStore_Checkpoint(t *testing.T) {
+	s := NewMemoryStore("test_")
+	hash := common.HexToHash("0xabc")
+	assert.NoError(t, s.SaveCheckpoint(context.Background(), "task1", Checkpoint{Height: 100, BlockHash: hash, LogsScanned: 7}))
+
+	cp, err := s.LoadCheckpoint(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), cp.Height)
+	assert.Equal(t, hash, cp.BlockHash)
+	assert.Equal(t, uint64(7), cp.LogsScanned)
+	assert.False(t, cp.UpdatedAt.IsZero())
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+
+	// SaveCursor replaces the whole checkpoint
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 120))
+	cp, err = s.LoadCheckpoint(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{Height: 120, UpdatedAt: cp.UpdatedAt}, cp)
+}
+
+func TestMemoryStore_Snapshot(t *testing.T) {
+	s := NewMemoryStore("test_")
+	hash := common.HexToHash("0xabc")
+	assert.NoError(t, s.SaveCheckpoint(context.Background(), "task1", Checkpoint{Height: 100, BlockHash: hash, LogsScanned: 7}))
+	assert.NoError(t, s.SaveCursor(context.Background(), "task2", 50))
+	snapshot, err := s.Snapshot()
+	assert.NoError(t, err)
+
+	restored := NewMemoryStore("test_")
+	assert.NoError(t, restored.Restore(snapshot))
+	cp, err := restored.LoadCheckpoint(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), cp.Height)
+	assert.Equal(t, hash, cp.BlockHash)
+	assert.Equal(t, uint64(7), cp.LogsScanned)
+	assert.False(t, cp.UpdatedAt.IsZero())
+	cursors, err := restored.ListCursors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"task1": 100, "task2": 50}, cursors)
+
+	// A corrupt snapshot leaves the store as it was
+	assert.ErrorContains(t, restored.Restore([]byte(`{"test_task1": `)), "corrupt")
+	h, err := restored.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+}
+
+func TestMemoryStore_FromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursors.json")
+
+	// Missing file: start empty
+	s, err := NewMemoryStoreFromFile(path, "test_")
+	assert.NoError(t, err)
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, s.Close())
+
+	// The snapshot written on Close is loaded on the next start
+	s, err = NewMemoryStoreFromFile(path, "test_")
+	assert.NoError(t, err)
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+
+	assert.NoError(t, os.WriteFile(path, []byte("not json"), 0o644))
+	_, err = NewMemoryStoreFromFile(path, "test_")
+	assert.ErrorContains(t, err, "corrupt memory store snapshot")
+
+	_, err = NewMemoryStoreFromFile(t.TempDir(), "test_")
+	assert.Error(t, err)
+}
+
+// --- Coalescing Store Tests ---
+
+func TestCoalesce(t *testing.T) {
+	inner := NewMemoryStore("test_")
+	c := Coalesce(inner, 2*time.Second, 1000)
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+	written := func() uint64 {
+		h, err := inner.LoadCursor(ctx, "task1")
+		assert.NoError(t, err)
+		return h
+	}
+
+	// The first save is written, the next ones are buffered
+	assert.NoError(t, c.SaveCursor(ctx, "task1", 100))
+	assert.Equal(t, uint64(100), written())
+	assert.NoError(t, c.SaveCursor(ctx, "task1", 200))
+	now = now.Add(time.Second)
+	assert.NoError(t, c.SaveCursor(ctx, "task1", 300))
+	assert.Equal(t, uint64(100), written())
+	h, err := c.LoadCursor(ctx, "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(300), h)
+
+	// Written once the interval elapsed
+	now = now.Add(time.Second)
+	assert.NoError(t, c.SaveCursor(ctx, "task1", 400))
+	assert.Equal(t, uint64(400), written())
+
+	// Or once the cursor advanced maxDelta blocks
+	assert.NoError(t, c.SaveCursor(ctx, "task1", 1399))
+	assert.Equal(t, uint64(400), written())
+	assert.NoError(t, c.SaveCursor(ctx, "task1", 1400))
+	assert.Equal(t, uint64(1400), written())
+
+	// Backwards saves are refused by the store as without buffering
+	assert.NoError(t, c.SaveCursor(ctx, "task1", 1500))
+	assert.ErrorIs(t, c.SaveCursor(ctx, "task1", 1450), ErrCursorRegression)
+	assert.Equal(t, uint64(1500), written())
+	assert.NoError(t, c.ForceRewind(ctx, "task1", 1450))
+	assert.Equal(t, uint64(1450), written())
+
+	// Close writes the buffered cursor
+	assert.NoError(t, c.SaveCursor(ctx, "task1", 1600))
+	assert.Equal(t, uint64(1450), written())
+	assert.NoError(t, c.Close())
+	assert.Equal(t, uint64(1600), written())
+}
+
+func TestCoalesce_Checkpoint(t *testing.T) {
+	inner := NewMemoryStore("test_")
+	c := Coalesce(inner, time.Hour, 0)
+	hash := common.HexToHash("0xabc")
+	assert.NoError(t, c.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, c.SaveCheckpoint(context.Background(), "task1", Checkpoint{Height: 200, BlockHash: hash, LogsScanned: 7}))
+
+	cp, err := c.LoadCheckpoint(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{Height: 200, BlockHash: hash, LogsScanned: 7}, cp)
+
+	assert.NoError(t, c.Flush(context.Background()))
+	cp, err = inner.LoadCheckpoint(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, hash, cp.BlockHash)
+	assert.Equal(t, uint64(7), cp.LogsScanned)
+
+	// Stores without checkpoints get the height only
+	legacy := &legacyMemoryStore{cursors: make(map[string]uint64)}
+	c = Coalesce(FromLegacy(legacy), time.Hour, 0)
+	assert.NoError(t, c.SaveCheckpoint(context.Background(), "task1", Checkpoint{Height: 200, BlockHash: hash}))
+	assert.Equal(t, uint64(200), legacy.cursors["task1"])
+	_, err = c.ListCursors(context.Background())
+	assert.ErrorContains(t, err, "cannot list cursors")
+}
+
+func TestCoalesce_ListDelete(t *testing.T) {
+	c := Coalesce(NewMemoryStore("test_"), time.Hour, 0)
+	assertCursorAdmin(t, c)
+
+	// Buffered cursors are written before listing
+	assert.NoError(t, c.SaveCursor(context.Background(), "task2", 300))
+	cursors, err := c.ListCursors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"task2": 300}, cursors)
+}
+
+// --- Tiered Store Tests ---
+
+// flakyStore is a MemoryStore whose saves fail while fail is set.
+type flakyStore struct {
+	*MemoryStore
+	fail atomic.Bool
+}
+
+func (f *flakyStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	if f.fail.Load() {
+		return assert.AnError
+	}
+	return f.MemoryStore.SaveCursor(ctx, key, height)
+}
+
+func (f *flakyStore) SaveCheckpoint(ctx context.Context, key string, cp Checkpoint) error {
+	if f.fail.Load() {
+		return assert.AnError
+	}
+	return f.MemoryStore.SaveCheckpoint(ctx, key, cp)
+}
+
+func TestShadowStore(t *testing.T) {
+	ctx := context.Background()
+	inner := NewMemoryStore("test_")
+	assert.NoError(t, inner.SaveCursor(ctx, "task1", 100))
+	s := Shadow(inner)
+
+	h, err := s.LoadCursor(ctx, "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+
+	// Saves and rewinds stay in memory
+	assert.NoError(t, s.SaveCursor(ctx, "task1", 200))
+	assert.NoError(t, s.ForceRewind(ctx, "task2", 50))
+	h, _ = s.LoadCursor(ctx, "task1")
+	assert.Equal(t, uint64(200), h)
+	h, _ = s.LoadCursor(ctx, "task2")
+	assert.Equal(t, uint64(50), h)
+	h, _ = inner.LoadCursor(ctx, "task1")
+	assert.Equal(t, uint64(100), h)
+	h, _ = inner.LoadCursor(ctx, "task2")
+	assert.Zero(t, h)
+	assert.NoError(t, s.Ping(ctx))
+}
+
+func TestTieredStore(t *testing.T) {
+	primary, secondary := NewMemoryStore(""), NewMemoryStore("")
+	s := NewTieredStore(primary, secondary)
+	ctx := context.Background()
+
+	h, err := s.LoadCursor(ctx, "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), h)
+
+	// The primary is written at once, the secondary in the background
+	assert.NoError(t, s.SaveCursor(ctx, "task1", 100))
+	h, err = primary.LoadCursor(ctx, "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+	assert.Eventually(t, func() bool {
+		h, _ := secondary.LoadCursor(ctx, "task1")
+		return h == 100
+	}, time.Second, time.Millisecond)
+
+	// Rewinds reach both stores
+	assert.NoError(t, s.ForceRewind(ctx, "task1", 50))
+	h, _ = primary.LoadCursor(ctx, "task1")
+	assert.Equal(t, uint64(50), h)
+	h, _ = secondary.LoadCursor(ctx, "task1")
+	assert.Equal(t, uint64(50), h)
+
+	// Close writes what is still queued
+	assert.NoError(t, s.SaveCursor(ctx, "task1", 60))
+	assert.NoError(t, s.Close())
+	h, _ = secondary.LoadCursor(ctx, "task1")
+	assert.Equal(t, uint64(60), h)
+}
+
+func TestTieredStore_Reconcile(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := NewMemoryStore(""), NewMemoryStore("")
+	assert.NoError(t, primary.SaveCursor(ctx, "behind", 100))
+	assert.NoError(t, secondary.SaveCursor(ctx, "behind", 200))
+	assert.NoError(t, primary.SaveCursor(ctx, "ahead", 300))
+	assert.NoError(t, secondary.SaveCursor(ctx, "ahead", 200))
+	assert.NoError(t, secondary.SaveCursor(ctx, "missing", 150))
+	s := NewTieredStore(primary, secondary)
+	defer s.Close()
+
+	// The higher cursor wins and the other store catches up
+	h, err := s.LoadCursor(ctx, "behind")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), h)
+	h, _ = primary.LoadCursor(ctx, "behind")
+	assert.Equal(t, uint64(200), h)
+
+	h, err = s.LoadCursor(ctx, "ahead")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(300), h)
+	assert.Eventually(t, func() bool {
+		h, _ := secondary.LoadCursor(ctx, "ahead")
+		return h == 300
+	}, time.Second, time.Millisecond)
+
+	h, err = s.LoadCursor(ctx, "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(150), h)
+}
+
+func TestTieredStore_SecondaryFailure(t *testing.T) {
+	ctx := context.Background()
+	primary := NewMemoryStore("")
+	secondary := &flakyStore{MemoryStore: NewMemoryStore("")}
+	assert.NoError(t, secondary.SaveCursor(ctx, "task1", 100))
+
+	var (
+		mu     sync.Mutex
+		alerts []uint64
+	)
+	s := NewTieredStore(primary, secondary, WithSecondaryBackoff(time.Millisecond),
+		WithLagAlert(50, func(key string, lag uint64, err error) {
+			assert.Equal(t, "task1", key)
+			assert.ErrorIs(t, err, assert.AnError)
+			mu.Lock()
+			alerts = append(alerts, lag)
+			mu.Unlock()
+		}))
+	_, err := s.LoadCursor(ctx, "task1")
+	assert.NoError(t, err)
+
+	// Failed writes are retried; falling behind more than 50 blocks alerts
+	secondary.fail.Store(true)
+	assert.NoError(t, s.SaveCursor(ctx, "task1", 120))
+	assert.NoError(t, s.SaveCursor(ctx, "task1", 160))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(alerts) > 0 && alerts[len(alerts)-1] == 60
+	}, time.Second, time.Millisecond)
+
+	secondary.fail.Store(false)
+	assert.Eventually(t, func() bool {
+		h, _ := secondary.LoadCursor(ctx, "task1")
+		return h == 160
+	}, 2*time.Second, time.Millisecond)
+
+	// Reads do not depend on the secondary once reconciled
+	secondary.fail.Store(true)
+	h, err := s.LoadCursor(ctx, "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(160), h)
+	secondary.fail.Store(false)
+	assert.NoError(t, s.Close())
+}
+
+func TestTieredStore_LagWithoutLoad(t *testing.T) {
+	ctx := context.Background()
+	secondary := &flakyStore{MemoryStore: NewMemoryStore("")}
+	assert.NoError(t, secondary.SaveCursor(ctx, "task1", 100))
+	secondary.fail.Store(true)
+
+	var (
+		mu     sync.Mutex
+		alerts = make(map[string]uint64)
+	)
+	s := NewTieredStore(NewMemoryStore(""), secondary, WithSecondaryBackoff(time.Millisecond),
+		WithLagAlert(50, func(key string, lag uint64, err error) {
+			mu.Lock()
+			alerts[key] = lag
+			mu.Unlock()
+		}))
+
+	// Saved without loading them first, the lag is from the secondary's
+	// cursor, or from 0 without one
+	assert.NoError(t, s.SaveCursor(ctx, "task1", 160))
+	assert.NoError(t, s.SaveCursor(ctx, "task2", 70))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return alerts["task1"] == 60 && alerts["task2"] == 70
+	}, time.Second, time.Millisecond)
+
+	secondary.fail.Store(false)
+	assert.NoError(t, s.Close())
+}
+
+func TestTieredStore_Checkpoints(t *testing.T) {
+	ctx := context.Background()
+	// A primary keeping only heights, e.g. a plain file
+	primary := FromLegacy(&legacyMemoryStore{cursors: make(map[string]uint64)})
+	secondary := NewMemoryStore("")
+	s := NewTieredStore(primary, secondary)
+
+	cp := Checkpoint{Height: 100, BlockHash: common.HexToHash("0xabc"), LogsScanned: 7}
+	assert.NoError(t, s.SaveCheckpoint(ctx, "task1", cp))
+	assert.NoError(t, s.Close())
+
+	// The metadata reaches the secondary and comes back from it on the next start
+	saved, err := secondary.LoadCheckpoint(ctx, "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, cp.BlockHash, saved.BlockHash)
+	s = NewTieredStore(primary, secondary)
+	got, err := s.LoadCheckpoint(ctx, "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), got.Height)
+	assert.Equal(t, cp.BlockHash, got.BlockHash)
+	assert.Equal(t, uint64(7), got.LogsScanned)
+	assert.NoError(t, s.Close())
+}
+
+func TestTieredStore_CursorAdmin(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := NewMemoryStore(""), NewMemoryStore("")
+	s := NewTieredStore(primary, secondary)
+	assert.NoError(t, s.SaveCursor(ctx, "task1", 100))
+	assert.NoError(t, s.SaveCursor(ctx, "task2", 200))
+
+	cursors, err := s.ListCursors(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"task1": 100, "task2": 200}, cursors)
+
+	// Deleted from both stores, it does not come back on the next start
+	assert.NoError(t, s.DeleteCursor(ctx, "task1"))
+	assert.NoError(t, s.Close())
+	s = NewTieredStore(primary, secondary)
+	h, err := s.LoadCursor(ctx, "task1")
+	assert.NoError(t, err)
+	assert.Zero(t, h)
+	assert.NoError(t, s.Close())
+
+	s = NewTieredStore(FromLegacy(&legacyMemoryStore{}), secondary)
+	_, err = s.ListCursors(ctx)
+	assert.Error(t, err)
+	assert.Error(t, s.DeleteCursor(ctx, "task2"))
+	assert.NoError(t, s.Close())
+}
+
+type legacyMemoryStore struct {
+	cursors map[string]uint64
+}
+
+func (l *legacyMemoryStore) LoadCursor(key string) (uint64, error) { return l.cursors[key], nil }
+
+func (l *legacyMemoryStore) SaveCursor(key string, height uint64) error {
+	l.cursors[key] = height
+	return nil
+}
+
+func (l *legacyMemoryStore) Close() error { return nil }
+
+func TestFromLegacy(t *testing.T) {
+	s := FromLegacy(&legacyMemoryStore{cursors: make(map[string]uint64)})
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, s.SaveCursor(ctx, "task1", 200), context.Canceled)
+	_, err = s.LoadCursor(ctx, "task1")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoError(t, s.Close())
+}
+
 // --- Postgres Store Tests ---
 
 func TestPostgresStore_InitTable(t *testing.T) {
@@ -47,10 +547,39 @@ func TestPostgresStore_InitTable(t *testing.T) {
 	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS custom_checkpoints")).
 		WillReturnResult(sqlmock.NewResult(0, 0))
 
-	err = store.initTable()
+	err = store.initTable(context.Background())
 	assert.NoError(t, err)
 }
 
+func TestPostgresStore_ContextCancel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	store := &PostgresStore{db: db, tableName: "scanner_checkpoints"}
+
+	// A cancelled caller stops waiting on a hung database
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scanner_checkpoints")).
+		WillDelayFor(5 * time.Second).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err = store.SaveCursor(ctx, "task1", 100)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+
+	// So does one without a deadline, after the statement timeout
+	store.timeout = 50 * time.Millisecond
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT block_height FROM scanner_checkpoints")).
+		WillDelayFor(5 * time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"block_height"}).AddRow(200))
+	start = time.Now()
+	_, err = store.LoadCursor(context.Background(), "task1")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
 func TestPostgresStore_SaveLoad(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
@@ -66,13 +595,13 @@ func TestPostgresStore_SaveLoad(t *testing.T) {
 		WithArgs("task1", 100).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = store.SaveCursor("task1", 100)
+	err = store.SaveCursor(context.Background(), "task1", 100)
 	assert.NoError(t, err)
 
 	// 2. Test Save Error
 	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scanner_checkpoints")).
 		WillReturnError(assert.AnError)
-	err = store.SaveCursor("task1", 100)
+	err = store.SaveCursor(context.Background(), "task1", 100)
 	assert.Error(t, err)
 
 	// 3. Test Load Success
@@ -81,7 +610,7 @@ func TestPostgresStore_SaveLoad(t *testing.T) {
 		WithArgs("task1").
 		WillReturnRows(rows)
 
-	h, err := store.LoadCursor("task1")
+	h, err := store.LoadCursor(context.Background(), "task1")
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(200), h)
 
@@ -89,14 +618,14 @@ func TestPostgresStore_SaveLoad(t *testing.T) {
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT block_height")).
 		WithArgs("task2").
 		WillReturnError(sql.ErrNoRows)
-	h, err = store.LoadCursor("task2")
+	h, err = store.LoadCursor(context.Background(), "task2")
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(0), h)
 
 	// 5. Test Load Error
 	mock.ExpectQuery(regexp.QuoteMeta("SELECT block_height")).
 		WillReturnError(assert.AnError)
-	_, err = store.LoadCursor("task3")
+	_, err = store.LoadCursor(context.Background(), "task3")
 	assert.Error(t, err)
 
 	// 6. Test Close
@@ -107,10 +636,147 @@ func TestPostgresStore_SaveLoad(t *testing.T) {
 
 }
 
+func TestPostgresStore_InitTableMigration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	store := &PostgresStore{db: db, tableName: "scanner_checkpoints"}
+
+	// Tables created by older versions get the checkpoint metadata columns
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS scanner_checkpoints(.|\n)*` +
+		`ALTER TABLE scanner_checkpoints\s+ADD COLUMN IF NOT EXISTS block_hash VARCHAR\(66\),\s+` +
+		`ADD COLUMN IF NOT EXISTS logs_scanned BIGINT NOT NULL DEFAULT 0`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, store.initTable(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresStore_Checkpoint(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	store := &PostgresStore{db: db, tableName: "scanner_checkpoints"}
+	hash := common.HexToHash("0xabc")
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scanner_checkpoints (task_key, block_height, block_hash, logs_scanned, updated_at)")).
+		WithArgs("task1", 100, hash.Hex(), 7, updated).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, store.SaveCheckpoint(context.Background(), "task1", Checkpoint{Height: 100, BlockHash: hash, LogsScanned: 7, UpdatedAt: updated}))
+
+	// No hash is stored as NULL
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scanner_checkpoints")).
+		WithArgs("task2", 50, nil, 0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, store.SaveCheckpoint(context.Background(), "task2", Checkpoint{Height: 50}))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT block_height, block_hash, logs_scanned, updated_at FROM scanner_checkpoints")).
+		WithArgs("task1").
+		WillReturnRows(sqlmock.NewRows([]string{"block_height", "block_hash", "logs_scanned", "updated_at"}).
+			AddRow(100, hash.Hex(), 7, updated))
+	cp, err := store.LoadCheckpoint(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{Height: 100, BlockHash: hash, LogsScanned: 7, UpdatedAt: updated}, cp)
+
+	// Rows saved by SaveCursor or before the migration have no hash
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT block_height, block_hash")).
+		WithArgs("task2").
+		WillReturnRows(sqlmock.NewRows([]string{"block_height", "block_hash", "logs_scanned", "updated_at"}).
+			AddRow(50, nil, 0, nil))
+	cp, err = store.LoadCheckpoint(context.Background(), "task2")
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{Height: 50}, cp)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT block_height, block_hash")).
+		WithArgs("task3").
+		WillReturnError(sql.ErrNoRows)
+	cp, err = store.LoadCheckpoint(context.Background(), "task3")
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{}, cp)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // Note: NewPostgresStore involves real sql.Open, making it difficult to fully mock the driver layer.
 
 // However, we can test passing an invalid URL.
 
+func TestPostgresStore_SaveCursorTx(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	store := &PostgresStore{db: db, tableName: "scanner_checkpoints"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scanner_checkpoints")).
+		WithArgs("task1", 100).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tx, err := store.BeginTx(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, store.SaveCursorTx(context.Background(), tx, "task1", 100))
+	assert.NoError(t, tx.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresStore_Monotonic(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	store := &PostgresStore{db: db, tableName: "scanner_checkpoints"}
+
+	// The upsert skips lower heights, changing no row
+	mock.ExpectExec(regexp.QuoteMeta("WHERE scanner_checkpoints.block_height <= EXCLUDED.block_height")).
+		WithArgs("task1", 100).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, store.SaveCursor(context.Background(), "task1", 100), ErrCursorRegression)
+
+	mock.ExpectExec(regexp.QuoteMeta("WHERE scanner_checkpoints.block_height <= EXCLUDED.block_height")).
+		WithArgs("task1", 100, nil, 0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, store.SaveCheckpoint(context.Background(), "task1", Checkpoint{Height: 100}), ErrCursorRegression)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("WHERE scanner_checkpoints.block_height")).
+		WithArgs("task1", 100).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	tx, err := store.BeginTx(context.Background())
+	assert.NoError(t, err)
+	assert.ErrorIs(t, store.SaveCursorTx(context.Background(), tx, "task1", 100), ErrCursorRegression)
+
+	// ForceRewind and a store with the protection off upsert unconditionally
+	forced := `updated_at = NOW\(\)\s*;`
+	mock.ExpectExec(forced).WithArgs("task1", 100).WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, store.ForceRewind(context.Background(), "task1", 100))
+	store.SetMonotonic(false)
+	mock.ExpectExec(forced).WithArgs("task1", 90).WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, store.SaveCursor(context.Background(), "task1", 90))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresStore_ListDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	store := &PostgresStore{db: db, tableName: "scanner_checkpoints"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT task_key, block_height FROM scanner_checkpoints")).
+		WillReturnRows(sqlmock.NewRows([]string{"task_key", "block_height"}).AddRow("eth", 100).AddRow("bsc", 200))
+	cursors, err := store.ListCursors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"eth": 100, "bsc": 200}, cursors)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT task_key")).WillReturnError(assert.AnError)
+	_, err = store.ListCursors(context.Background())
+	assert.ErrorIs(t, err, assert.AnError)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM scanner_checkpoints WHERE task_key = $1")).
+		WithArgs("eth").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, store.DeleteCursor(context.Background(), "eth"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestNewPostgresStore_InvalidURL(t *testing.T) {
 
 	// This is a malformed connection string
@@ -144,17 +810,18 @@ func TestRedisStore_SaveLoad(t *testing.T) {
 
 	// 1. Test Save Success
 
-	mock.ExpectSet("scan:task1", uint64(100), time.Duration(0)).SetVal("OK")
+	keys := []string{"scan:task1", "{scan:task1}:checkpoint"}
+	mock.ExpectEvalSha(saveScript.Hash(), keys, uint64(100), "0").SetVal(int64(1))
 
-	err := store.SaveCursor("task1", 100)
+	err := store.SaveCursor(context.Background(), "task1", 100)
 
 	assert.NoError(t, err)
 
 	// 2. Test Save Error
 
-	mock.ExpectSet("scan:task1", uint64(100), time.Duration(0)).SetErr(assert.AnError)
+	mock.ExpectEvalSha(saveScript.Hash(), keys, uint64(100), "0").SetErr(assert.AnError)
 
-	err = store.SaveCursor("task1", 100)
+	err = store.SaveCursor(context.Background(), "task1", 100)
 
 	assert.Error(t, err)
 
@@ -162,7 +829,7 @@ func TestRedisStore_SaveLoad(t *testing.T) {
 
 	mock.ExpectGet("scan:task1").SetVal("500")
 
-	h, err := store.LoadCursor("task1")
+	h, err := store.LoadCursor(context.Background(), "task1")
 
 	assert.NoError(t, err)
 
@@ -172,7 +839,7 @@ func TestRedisStore_SaveLoad(t *testing.T) {
 
 	mock.ExpectGet("scan:task2").SetErr(redis.Nil)
 
-	h, err = store.LoadCursor("task2")
+	h, err = store.LoadCursor(context.Background(), "task2")
 
 	assert.NoError(t, err)
 
@@ -182,7 +849,7 @@ func TestRedisStore_SaveLoad(t *testing.T) {
 
 	mock.ExpectGet("scan:task3").SetErr(assert.AnError)
 
-	_, err = store.LoadCursor("task3")
+	_, err = store.LoadCursor(context.Background(), "task3")
 
 	assert.Error(t, err)
 
@@ -200,6 +867,72 @@ func TestRedisStore_SaveLoad(t *testing.T) {
 
 }
 
+func TestRedisStore_Checkpoint(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	store := &RedisStore{client: db, prefix: "scan:"}
+	hash := common.HexToHash("0xabc")
+	updated := time.UnixMilli(1700000000000)
+
+	mock.ExpectEvalSha(saveScript.Hash(), []string{"scan:task1", "{scan:task1}:checkpoint"}, uint64(100), "0",
+		"height", uint64(100), "block_hash", hash.Hex(), "updated_at", int64(1700000000000), "logs_scanned", uint64(7)).
+		SetVal(int64(1))
+	assert.NoError(t, store.SaveCheckpoint(context.Background(), "task1", Checkpoint{Height: 100, BlockHash: hash, LogsScanned: 7, UpdatedAt: updated}))
+
+	mock.ExpectGet("scan:task1").SetVal("100")
+	mock.ExpectHGetAll("{scan:task1}:checkpoint").SetVal(map[string]string{
+		"height": "100", "block_hash": hash.Hex(), "updated_at": "1700000000000", "logs_scanned": "7",
+	})
+	cp, err := store.LoadCheckpoint(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{Height: 100, BlockHash: hash, LogsScanned: 7, UpdatedAt: updated}, cp)
+
+	// Metadata of another height, left behind by SaveCursor, is ignored
+	mock.ExpectGet("scan:task1").SetVal("120")
+	mock.ExpectHGetAll("{scan:task1}:checkpoint").SetVal(map[string]string{"height": "100", "block_hash": hash.Hex()})
+	cp, err = store.LoadCheckpoint(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{Height: 120}, cp)
+
+	mock.ExpectGet("scan:task2").SetErr(redis.Nil)
+	cp, err = store.LoadCheckpoint(context.Background(), "task2")
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{}, cp)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisStore_Monotonic(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	store := &RedisStore{client: db, prefix: "scan:"}
+	keys := []string{"scan:task1", "{scan:task1}:checkpoint"}
+
+	// The script refuses lower heights unless forced
+	mock.ExpectEvalSha(saveScript.Hash(), keys, uint64(100), "0").SetVal(int64(0))
+	assert.ErrorIs(t, store.SaveCursor(context.Background(), "task1", 100), ErrCursorRegression)
+	mock.ExpectEvalSha(saveScript.Hash(), keys, uint64(100), "1").SetVal(int64(1))
+	assert.NoError(t, store.ForceRewind(context.Background(), "task1", 100))
+	store.SetMonotonic(false)
+	mock.ExpectEvalSha(saveScript.Hash(), keys, uint64(90), "1").SetVal(int64(1))
+	assert.NoError(t, store.SaveCursor(context.Background(), "task1", 90))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedisStore_ListDelete(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	store := &RedisStore{client: db, prefix: "scan:*"}
+
+	// Pattern characters of the prefix are escaped and metadata hashes skipped
+	mock.ExpectScan(0, `scan:\**`, 1000).SetVal([]string{"scan:*eth", "{scan:*eth}:checkpoint", "scan:*bsc"}, 0)
+	mock.ExpectGet("scan:*eth").SetVal("100")
+	mock.ExpectGet("scan:*bsc").SetVal("200")
+	cursors, err := store.ListCursors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"eth": 100, "bsc": 200}, cursors)
+
+	mock.ExpectDel("scan:*eth", "{scan:*eth}:checkpoint").SetVal(2)
+	assert.NoError(t, store.DeleteCursor(context.Background(), "eth"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestNewRedisStore_Mock(t *testing.T) {
 	// redismock doesn't directly mock NewRedisStore because it calls redis.NewClient inside.
 	// But we can verify our Load/Save tests already cover the logic.
@@ -221,6 +954,17 @@ func TestNewRedisStore_PingFail(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestNewRedisStoreWithConfig(t *testing.T) {
+	// Invalid settings fail before connecting
+	_, err := NewRedisStoreWithConfig(RedisStoreConfig{Config: redisconfig.Config{MasterName: "mymaster"}})
+	assert.ErrorContains(t, err, "must be set together")
+
+	_, err = NewRedisStoreWithConfig(RedisStoreConfig{
+		Config: redisconfig.Config{MasterName: "mymaster", SentinelAddrs: []string{"127.0.0.1:1"}, DialTimeout: 100 * time.Millisecond},
+	})
+	assert.Error(t, err)
+}
+
 func TestRedisStore_Integration(t *testing.T) {
 	// If Redis is running in CI or local (default port)
 	s, err := NewRedisStore("localhost:6379", "", 0, "integration:")
@@ -230,10 +974,487 @@ func TestRedisStore_Integration(t *testing.T) {
 	}
 	defer s.Close()
 
-	err = s.SaveCursor("chain1", 12345)
+	err = s.SaveCursor(context.Background(), "chain1", 12345)
 	assert.NoError(t, err)
 
-	val, err := s.LoadCursor("chain1")
+	val, err := s.LoadCursor(context.Background(), "chain1")
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(12345), val)
+
+	assert.NoError(t, s.ForceRewind(context.Background(), "mono", 0))
+	assertMonotonic(t, s)
+}
+
+// --- SQLite Store Tests ---
+
+func TestSQLiteStore_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scanner.db")
+
+	s, err := NewSQLiteStore(path, "evm-scan_")
+	assert.NoError(t, err)
+
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), h)
+
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 200))
+	h, err = s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), h)
+	assert.NoError(t, s.Close())
+
+	// Restart: a new store on the same file resumes from the saved cursor
+	s, err = NewSQLiteStore(path, "evm-scan_")
+	assert.NoError(t, err)
+	defer s.Close()
+	h, err = s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), h)
+
+	h, err = s.LoadCursor(context.Background(), "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), h)
+}
+
+func TestSQLiteStore_Monotonic(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "scanner.db"), "")
+	assert.NoError(t, err)
+	defer s.Close()
+	assertMonotonic(t, s)
+}
+
+func TestSQLiteStore_ListDelete(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "scanner.db"), "")
+	assert.NoError(t, err)
+	defer s.Close()
+	assertCursorAdmin(t, s)
+}
+
+func TestNewSQLiteStore_InvalidPath(t *testing.T) {
+	_, err := NewSQLiteStore(filepath.Join(t.TempDir(), "missing", "scanner.db"), "")
+	assert.Error(t, err)
+}
+
+// --- File Store Tests ---
+
+func TestFileStore_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursors.json")
+
+	s, err := NewFileStore(path, "evm-scan_")
+	assert.NoError(t, err)
+
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), h)
+
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 200))
+	assert.NoError(t, s.SaveCursor(context.Background(), "task2", 50))
+	assert.NoError(t, s.Close())
+
+	// Restart: a new store on the same file resumes from the saved cursors
+	s, err = NewFileStore(path, "evm-scan_")
+	assert.NoError(t, err)
+	defer s.Close()
+	h, err = s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), h)
+	h, err = s.LoadCursor(context.Background(), "task2")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(50), h)
+}
+
+func TestFileStore_PartialTempFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cursors.json")
+
+	s, err := NewFileStore(path, "")
+	assert.NoError(t, err)
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, s.Close())
+
+	// A crash during the next write leaves a truncated temp file next to the cursors
+	assert.NoError(t, os.WriteFile(path+".tmp123", []byte(`{"checksum":"ab`), 0o644))
+
+	s, err = NewFileStore(path, "")
+	assert.NoError(t, err)
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 150))
+	assert.NoError(t, s.Close())
+	s, err = NewFileStore(path, "")
+	assert.NoError(t, err)
+	h, err = s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(150), h)
+	assert.NoError(t, s.Close())
+}
+
+func TestFileStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursors.json")
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"checksum":"ab`), 0o644))
+	_, err := NewFileStore(path, "")
+	assert.ErrorContains(t, err, "corrupt cursor file")
+
+	// Valid JSON whose cursors were edited without updating the checksum
+	s, err := NewFileStore(path+"2", "")
+	assert.NoError(t, err)
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, s.Close())
+	data, err := os.ReadFile(path + "2")
+	assert.NoError(t, err)
+	data = bytes.Replace(data, []byte(`"task1": 100`), []byte(`"task1": 900`), 1)
+	assert.NoError(t, os.WriteFile(path+"2", data, 0o644))
+	_, err = NewFileStore(path+"2", "")
+	assert.ErrorContains(t, err, "checksum mismatch")
+}
+
+func TestFileStore_FlushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursors.json")
+
+	s, err := NewFileStoreWithConfig(FileStoreConfig{Path: path, FlushInterval: 20 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 200))
+
+	// Coalesced: nothing is written until the interval elapses
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.Eventually(t, func() bool {
+		cursors, err := readCursorFile(path)
+		return err == nil && cursors["task1"] == 200
+	}, time.Second, 10*time.Millisecond)
+
+	// Close flushes saves of the last interval
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 300))
+	assert.NoError(t, s.Close())
+	cursors, err := readCursorFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(300), cursors["task1"])
+}
+
+func TestFileStore_Concurrent(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "cursors.json"), "")
+	assert.NoError(t, err)
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("task%d", i)
+			for h := uint64(1); h <= 10; h++ {
+				assert.NoError(t, s.SaveCursor(context.Background(), key, h))
+				_, err := s.LoadCursor(context.Background(), key)
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	h, err := s.LoadCursor(context.Background(), "task7")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), h)
+}
+
+func TestFileStore_Monotonic(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "cursors.json"), "")
+	assert.NoError(t, err)
+	defer s.Close()
+	assertMonotonic(t, s)
+}
+
+func TestFileStore_ListDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursors.json")
+	s, err := NewFileStore(path, "evm_")
+	assert.NoError(t, err)
+	assertCursorAdmin(t, s)
+	assert.NoError(t, s.Close())
+
+	// Deletions are persisted
+	cursors, err := readCursorFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"evm_task2": 200}, cursors)
+}
+
+func TestNewFileStore_InvalidPath(t *testing.T) {
+	_, err := NewFileStore(filepath.Join(t.TempDir(), "missing", "cursors.json"), "")
+	assert.Error(t, err)
+	_, err = NewFileStore("", "")
+	assert.Error(t, err)
+}
+
+// --- Etcd Store Tests ---
+
+// startEtcd runs a single-member etcd server and returns its client endpoint.
+func startEtcd(t *testing.T) string {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, _ := url.Parse("http://" + freeAddr(t))
+	peerURL, _ := url.Parse("http://" + freeAddr(t))
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd did not start")
+	}
+	return clientURL.Host
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestEtcdStore(t *testing.T) {
+	endpoint := startEtcd(t)
+
+	s, err := NewEtcdStore([]string{endpoint}, "evm/", EtcdAuth{})
+	assert.NoError(t, err)
+
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), h)
+
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 200))
+	h, err = s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(200), h)
+
+	// Keys are namespaced by the prefix
+	other, err := NewEtcdStore([]string{endpoint}, "", EtcdAuth{})
+	assert.NoError(t, err)
+	defer other.Close()
+	h, err = other.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), h)
+	resp, err := other.client.Get(context.Background(), "evm/task1")
+	assert.NoError(t, err)
+	assert.Equal(t, "200", string(resp.Kvs[0].Value))
+
+	assertMonotonic(t, s)
+	assert.NoError(t, s.DeleteCursor(context.Background(), "mono"))
+	assert.NoError(t, s.DeleteCursor(context.Background(), "task1"))
+
+	// Cursors of other prefixes are not listed
+	assert.NoError(t, other.SaveCursor(context.Background(), "task9", 1))
+	assertCursorAdmin(t, s)
+	assert.NoError(t, s.Close())
+}
+
+func TestEtcdStore_Retry(t *testing.T) {
+	s := &EtcdStore{backoff: time.Millisecond}
+
+	calls := 0
+	err := s.retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return rpctypes.ErrGRPCLeaderChanged
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = s.retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return rpctypes.ErrGRPCPermissionDenied
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err = s.retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return rpctypes.ErrGRPCNoLeader
+	})
+	assert.Error(t, err)
+	assert.Equal(t, etcdAttempts, calls)
+
+	// No retries once the caller gave up
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	err = s.retry(ctx, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return rpctypes.ErrGRPCNoLeader
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNewEtcdStore_Unreachable(t *testing.T) {
+	_, err := NewEtcdStore([]string{freeAddr(t)}, "", EtcdAuth{})
+	assert.Error(t, err)
+
+	_, err = NewEtcdStore([]string{"localhost:2379"}, "", EtcdAuth{TLS: tlsconfig.Config{CAFile: "missing.pem"}})
+	assert.Error(t, err)
+}
+
+// --- Consul Store Tests ---
+
+// fakeConsulKV is an in-memory consulKV with Consul's index semantics.
+type fakeConsulKV struct {
+	mu    sync.Mutex
+	pairs map[string]*api.KVPair
+	index uint64
+	// beforeCAS runs before each CAS, e.g. to simulate a concurrent writer
+	beforeCAS func()
+	err       error
+}
+
+func newFakeConsulKV() *fakeConsulKV {
+	return &fakeConsulKV{pairs: make(map[string]*api.KVPair)}
+}
+
+func (f *fakeConsulKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	if p, ok := f.pairs[key]; ok {
+		cp := *p
+		return &cp, &api.QueryMeta{}, nil
+	}
+	return nil, &api.QueryMeta{}, nil
+}
+
+func (f *fakeConsulKV) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var pairs api.KVPairs
+	for key, p := range f.pairs {
+		if strings.HasPrefix(key, prefix) {
+			cp := *p
+			pairs = append(pairs, &cp)
+		}
+	}
+	return pairs, &api.QueryMeta{}, nil
+}
+
+func (f *fakeConsulKV) Put(p *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.index++
+	f.pairs[p.Key] = &api.KVPair{Key: p.Key, Value: p.Value, Flags: p.Flags, ModifyIndex: f.index}
+	return &api.WriteMeta{}, nil
+}
+
+func (f *fakeConsulKV) CAS(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	if f.beforeCAS != nil {
+		f.beforeCAS()
+	}
+	f.mu.Lock()
+	var index uint64
+	if saved, ok := f.pairs[p.Key]; ok {
+		index = saved.ModifyIndex
+	}
+	f.mu.Unlock()
+	if index != p.ModifyIndex {
+		return false, &api.WriteMeta{}, nil
+	}
+	_, err := f.Put(p, q)
+	return true, &api.WriteMeta{}, err
+}
+
+func (f *fakeConsulKV) Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pairs, key)
+	return &api.WriteMeta{}, nil
+}
+
+func TestConsulStore(t *testing.T) {
+	kv := newFakeConsulKV()
+	s := &ConsulStore{kv: kv, prefix: "evm/"}
+
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), h)
+
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+	h, err = s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), h)
+	assert.Equal(t, "100", string(kv.pairs["evm/task1"].Value))
+
+	assertMonotonic(t, s)
+
+	kv.err = assert.AnError
+	_, err = s.LoadCursor(context.Background(), "task1")
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestConsulStore_CASConflict(t *testing.T) {
+	kv := newFakeConsulKV()
+	s := &ConsulStore{kv: kv, prefix: "evm/"}
+	assert.NoError(t, s.SaveCursor(context.Background(), "task1", 100))
+
+	// Another writer moves the cursor between the read and the write: the save
+	// is retried against the new value
+	kv.beforeCAS = func() {
+		kv.beforeCAS = nil
+		_, _ = kv.Put(&api.KVPair{Key: "evm/task1", Value: []byte("300")}, nil)
+	}
+	assert.ErrorIs(t, s.SaveCursor(context.Background(), "task1", 200), ErrCursorRegression)
+	h, err := s.LoadCursor(context.Background(), "task1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(300), h)
+}
+
+func TestConsulStore_ListDelete(t *testing.T) {
+	kv := newFakeConsulKV()
+	s := &ConsulStore{kv: kv, prefix: "evm/"}
+	assertCursorAdmin(t, s)
+
+	// Lock keys are not cursors
+	_, _ = kv.Put(&api.KVPair{Key: "evm/task2.lock", Flags: api.LockFlagValue}, nil)
+	cursors, err := s.ListCursors(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"task2": 200}, cursors)
+}
+
+func TestConsulStore_Integration(t *testing.T) {
+	// Against a dev agent (consul agent -dev) in CI or local
+	s, err := NewConsulStore(os.Getenv("CONSUL_ADDR"), "", "integration/")
+	if err != nil {
+		t.Skip("Consul agent not available, skipping integration test")
+		return
+	}
+	defer s.Close()
+
+	assert.NoError(t, s.ForceRewind(context.Background(), "mono", 0))
+	assertMonotonic(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	lost, unlock, err := s.Lock(ctx, "task1")
+	assert.NoError(t, err)
+	assert.NotNil(t, lost)
+
+	// A second replica waits for the lock until it gives up
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer waitCancel()
+	_, _, err = s.Lock(waitCtx, "task1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoError(t, unlock())
 }
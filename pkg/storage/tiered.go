@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	_ CheckpointPersistence = (*TieredStore)(nil)
+	_ Rewinder              = (*TieredStore)(nil)
+	_ CursorAdmin           = (*TieredStore)(nil)
+)
+
+// LagAlertFunc is called when cursors fail to reach the secondary store of a
+// TieredStore while it is lag blocks behind the primary.
+type LagAlertFunc func(key string, lag uint64, err error)
+
+// TieredOption configures a TieredStore.
+type TieredOption func(*TieredStore)
+
+// WithLagAlert calls alert on every failed write to the secondary store once
+// it is more than maxLag blocks behind the primary.
+func WithLagAlert(maxLag uint64, alert LagAlertFunc) TieredOption {
+	return func(t *TieredStore) {
+		t.maxLag = maxLag
+		t.alert = alert
+	}
+}
+
+// WithSecondaryBackoff sets the delay before retrying a failed write to the
+// secondary store, doubled on each failure up to 30s. Default 1s.
+func WithSecondaryBackoff(backoff time.Duration) TieredOption {
+	return func(t *TieredStore) {
+		t.backoff = backoff
+	}
+}
+
+// TieredStore saves cursors to a fast primary store, e.g. a MemoryStore or a
+// FileStore, and copies them to a durable secondary store in the background,
+// so that a slow or briefly unavailable secondary does not hold up scanning.
+// Checkpoint metadata is kept by the stores that are CheckpointPersistences,
+// e.g. a durable secondary behind a FileStore. Create one with NewTieredStore.
+type TieredStore struct {
+	primary   Persistence
+	secondary Persistence
+	maxLag    uint64
+	alert     LagAlertFunc
+	backoff   time.Duration
+
+	syncMu  sync.Mutex // Serializes writes to the secondary
+	mu      sync.Mutex
+	loaded  map[string]bool       // Keys reconciled between both stores
+	pending map[string]Checkpoint // Checkpoints not yet written to the secondary
+	synced  map[string]uint64     // Cursors last written to the secondary
+
+	wake   chan struct{}
+	ctx    context.Context // Cancelled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewTieredStore returns a store writing to primary synchronously and to
+// secondary asynchronously, retrying failed writes. The first load of a cursor
+// reads both stores and resumes from the higher one, bringing the other up to
+// date; later loads read the primary.
+func NewTieredStore(primary, secondary Persistence, opts ...TieredOption) *TieredStore {
+	t := &TieredStore{
+		primary:   primary,
+		secondary: secondary,
+		backoff:   time.Second,
+		loaded:    make(map[string]bool),
+		pending:   make(map[string]Checkpoint),
+		synced:    make(map[string]uint64),
+		wake:      make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	t.wg.Add(1)
+	go t.syncLoop()
+	return t
+}
+
+// LoadCursor retrieves the cursor from the primary store, reconciling it with
+// the secondary on the first load of key. A failing store is skipped.
+func (t *TieredStore) LoadCursor(ctx context.Context, key string) (uint64, error) {
+	cp, err := t.LoadCheckpoint(ctx, key)
+	return cp.Height, err
+}
+
+// SaveCursor saves height to the primary store and queues it for the secondary.
+func (t *TieredStore) SaveCursor(ctx context.Context, key string, height uint64) error {
+	return t.SaveCheckpoint(ctx, key, Checkpoint{Height: height})
+}
+
+// LoadCheckpoint is LoadCursor with the checkpoint metadata. The first load
+// of key takes the metadata of the secondary unless the primary is ahead.
+func (t *TieredStore) LoadCheckpoint(ctx context.Context, key string) (Checkpoint, error) {
+	t.mu.Lock()
+	loaded := t.loaded[key]
+	t.mu.Unlock()
+
+	primary, primaryErr := loadCheckpoint(ctx, t.primary, key)
+	if loaded && primaryErr == nil {
+		return primary, nil
+	}
+	secondary, secondaryErr := loadCheckpoint(ctx, t.secondary, key)
+	switch {
+	case primaryErr != nil && secondaryErr != nil:
+		return Checkpoint{}, errors.Join(primaryErr, secondaryErr)
+	case primaryErr != nil:
+		log.Warn("Primary cursor store failed, using secondary", "key", key, "err", primaryErr)
+		return secondary, nil
+	case secondaryErr != nil:
+		log.Warn("Secondary cursor store failed, using primary", "key", key, "err", secondaryErr)
+		return primary, nil
+	}
+
+	// E.g. a primary file lost with its node, or a secondary behind after a crash
+	if secondary.Height > primary.Height {
+		if err := saveCheckpoint(ctx, t.primary, key, secondary); err != nil {
+			return Checkpoint{}, err
+		}
+	}
+	t.mu.Lock()
+	t.loaded[key] = true
+	t.synced[key] = secondary.Height
+	if primary.Height > secondary.Height {
+		t.pending[key] = primary
+		t.notify()
+	}
+	t.mu.Unlock()
+	if primary.Height > secondary.Height {
+		return primary, nil
+	}
+	return secondary, nil
+}
+
+// SaveCheckpoint saves cp to the primary store and queues it for the secondary.
+func (t *TieredStore) SaveCheckpoint(ctx context.Context, key string, cp Checkpoint) error {
+	if err := saveCheckpoint(ctx, t.primary, key, cp); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.pending[key] = cp
+	t.mu.Unlock()
+	t.notify()
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint of key, only its height if store keeps
+// no checkpoints.
+func loadCheckpoint(ctx context.Context, store Persistence, key string) (Checkpoint, error) {
+	if store, ok := store.(CheckpointPersistence); ok {
+		return store.LoadCheckpoint(ctx, key)
+	}
+	height, err := store.LoadCursor(ctx, key)
+	return Checkpoint{Height: height}, err
+}
+
+// saveCheckpoint saves cp, only its height if store keeps no checkpoints.
+func saveCheckpoint(ctx context.Context, store Persistence, key string, cp Checkpoint) error {
+	if store, ok := store.(CheckpointPersistence); ok {
+		return store.SaveCheckpoint(ctx, key, cp)
+	}
+	return store.SaveCursor(ctx, key, cp.Height)
+}
+
+// ListCursors lists the cursors of the primary store, which is up to date.
+func (t *TieredStore) ListCursors(ctx context.Context) (map[string]uint64, error) {
+	admin, ok := t.primary.(CursorAdmin)
+	if !ok {
+		return nil, fmt.Errorf("store %T cannot list cursors", t.primary)
+	}
+	return admin.ListCursors(ctx)
+}
+
+// DeleteCursor deletes the cursor from both stores, so that the next start
+// does not bring it back from the secondary.
+func (t *TieredStore) DeleteCursor(ctx context.Context, key string) error {
+	primary, ok := t.primary.(CursorAdmin)
+	if !ok {
+		return fmt.Errorf("store %T cannot delete cursors", t.primary)
+	}
+	secondary, ok := t.secondary.(CursorAdmin)
+	if !ok {
+		return fmt.Errorf("store %T cannot delete cursors", t.secondary)
+	}
+	t.syncMu.Lock()
+	defer t.syncMu.Unlock()
+	if err := primary.DeleteCursor(ctx, key); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	delete(t.pending, key)
+	delete(t.synced, key)
+	delete(t.loaded, key)
+	t.mu.Unlock()
+	return secondary.DeleteCursor(ctx, key)
+}
+
+// ForceRewind rewinds both stores synchronously.
+func (t *TieredStore) ForceRewind(ctx context.Context, key string, height uint64) error {
+	t.syncMu.Lock()
+	defer t.syncMu.Unlock()
+	if err := forceRewind(ctx, t.primary, key, height); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	delete(t.pending, key)
+	t.mu.Unlock()
+	if err := forceRewind(ctx, t.secondary, key, height); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.synced[key] = height
+	t.mu.Unlock()
+	return nil
+}
+
+// forceRewind rewinds store if it is a Rewinder, and saves height otherwise.
+func forceRewind(ctx context.Context, store Persistence, key string, height uint64) error {
+	if rewinder, ok := store.(Rewinder); ok {
+		return rewinder.ForceRewind(ctx, key, height)
+	}
+	return store.SaveCursor(ctx, key, height)
+}
+
+// Ping checks the primary store. An unreachable secondary only delays copies.
+func (t *TieredStore) Ping(ctx context.Context) error {
+	return t.primary.Ping(ctx)
+}
+
+// Close makes a last attempt to write queued cursors to the secondary store
+// and closes both stores.
+func (t *TieredStore) Close() error {
+	t.cancel()
+	t.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return errors.Join(t.syncPending(ctx), t.primary.Close(), t.secondary.Close())
+}
+
+func (t *TieredStore) notify() {
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// syncLoop writes queued cursors to the secondary store until Close.
+func (t *TieredStore) syncLoop() {
+	defer t.wg.Done()
+	backoff := t.backoff
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-t.wake:
+		}
+		for t.syncPending(t.ctx) != nil {
+			select {
+			case <-t.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, 30*time.Second)
+		}
+		backoff = t.backoff
+	}
+}
+
+// syncPending writes each queued cursor to the secondary store, returning the
+// last error. Failed cursors stay queued unless the secondary refuses them as
+// regressions, e.g. because another replica moved it further.
+func (t *TieredStore) syncPending(ctx context.Context) error {
+	t.syncMu.Lock()
+	defer t.syncMu.Unlock()
+
+	t.mu.Lock()
+	pending := make(map[string]Checkpoint, len(t.pending))
+	for key, cp := range t.pending {
+		pending[key] = cp
+	}
+	t.mu.Unlock()
+
+	var lastErr error
+	for key, cp := range pending {
+		height := cp.Height
+		err := saveCheckpoint(ctx, t.secondary, key, cp)
+
+		t.mu.Lock()
+		if err == nil || errors.Is(err, ErrCursorRegression) {
+			if t.pending[key] == cp {
+				delete(t.pending, key)
+			}
+		}
+		if err == nil {
+			t.synced[key] = height
+		}
+		synced, known := t.synced[key]
+		t.mu.Unlock()
+		if err != nil && !known {
+			// Saved without a load first: the lag is from the secondary's cursor,
+			// or from 0 if it cannot be read either
+			if h, loadErr := t.secondary.LoadCursor(ctx, key); loadErr == nil {
+				synced = h
+				t.mu.Lock()
+				t.synced[key] = h
+				t.mu.Unlock()
+			}
+		}
+		lag := height - min(height, synced)
+
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrCursorRegression):
+			log.Warn("Secondary cursor store is ahead, not copying cursor", "key", key, "height", height, "err", err)
+		default:
+			lastErr = err
+			log.Warn("Failed to copy cursor to secondary store", "key", key, "height", height, "lag", lag, "err", err)
+			if t.alert != nil && lag > t.maxLag {
+				t.alert(key, lag, err)
+			}
+		}
+	}
+	return lastErr
+}
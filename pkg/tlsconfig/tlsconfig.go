@@ -0,0 +1,130 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config holds TLS settings for outgoing HTTPS connections.
+type Config struct {
+	CertFile           string `mapstructure:"cert_file"`            // Client certificate (PEM) for mutual TLS
+	KeyFile            string `mapstructure:"key_file"`             // Private key (PEM) of CertFile
+	CAFile             string `mapstructure:"ca_file"`              // CA bundle (PEM) trusted in addition to the system roots
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Skip server verification (development only)
+}
+
+// IsZero reports whether no TLS option is set.
+func (c Config) IsZero() bool {
+	return c == Config{}
+}
+
+// Build returns the tls.Config for c, or nil when c is zero. The client
+// certificate is reloaded when its files change, so rotated certificates are
+// picked up without a restart.
+func (c Config) Build() (*tls.Config, error) {
+	if c.IsZero() {
+		return nil, nil
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca_file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls ca_file %s contains no PEM certificates", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		r := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = r.get
+	}
+	return cfg, nil
+}
+
+// Transport returns a clone of http.DefaultTransport using the TLS settings of c.
+func (c Config) Transport() (*http.Transport, error) {
+	tlsCfg, err := c.Build()
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsCfg != nil {
+		t.TLSClientConfig = tlsCfg
+	}
+	return t, nil
+}
+
+// certReloader serves a client certificate, reloading it when either file's
+// modification time changes.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load tls client certificate %s: %w", r.certFile, err)
+	}
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("tls client certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if modTime, err := r.latestModTime(); err == nil {
+		r.mu.Lock()
+		changed := !modTime.Equal(r.modTime)
+		r.mu.Unlock()
+		if changed {
+			// A half-written pair fails to load; keep serving the previous one
+			_ = r.load()
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, nil
+}
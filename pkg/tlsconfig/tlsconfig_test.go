@@ -0,0 +1,84 @@
+package tlsconfig
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/84hero/evm-scanner/internal/tlstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	cfg, err := Config{}.Build()
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	cfg, err = Config{InsecureSkipVerify: true}.Build()
+	assert.NoError(t, err)
+	assert.True(t, cfg.InsecureSkipVerify)
+
+	_, err = Config{CertFile: "client.pem"}.Build()
+	assert.ErrorContains(t, err, "must be set together")
+
+	_, err = Config{CertFile: "missing.pem", KeyFile: "missing-key.pem"}.Build()
+	assert.ErrorContains(t, err, "missing.pem")
+
+	_, err = Config{CAFile: "missing-ca.pem"}.Build()
+	assert.ErrorContains(t, err, "ca_file")
+
+	notPEM := t.TempDir() + "/ca.pem"
+	assert.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	_, err = Config{CAFile: notPEM}.Build()
+	assert.ErrorContains(t, err, "no PEM certificates")
+}
+
+func TestTransport_MutualTLS(t *testing.T) {
+	srv, files := tlstest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	transport, err := Config{CAFile: files.CAFile, CertFile: files.CertFile, KeyFile: files.KeyFile}.Transport()
+	assert.NoError(t, err)
+	resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+
+	// Trusting the server is not enough without a client certificate
+	transport, err = Config{CAFile: files.CAFile}.Transport()
+	assert.NoError(t, err)
+	_, err = (&http.Client{Transport: transport}).Get(srv.URL)
+	assert.Error(t, err)
+
+	// Neither is presenting a certificate to an untrusted server
+	transport, err = Config{CertFile: files.CertFile, KeyFile: files.KeyFile}.Transport()
+	assert.NoError(t, err)
+	_, err = (&http.Client{Transport: transport}).Get(srv.URL)
+	assert.Error(t, err)
+}
+
+func TestClientCertificateReload(t *testing.T) {
+	_, first := tlstest.NewServer(t, http.NotFoundHandler())
+	_, second := tlstest.NewServer(t, http.NotFoundHandler())
+
+	cfg, err := Config{CertFile: first.CertFile, KeyFile: first.KeyFile}.Build()
+	assert.NoError(t, err)
+	before, err := cfg.GetClientCertificate(nil)
+	assert.NoError(t, err)
+
+	// Rotate the files in place
+	for src, dst := range map[string]string{second.CertFile: first.CertFile, second.KeyFile: first.KeyFile} {
+		data, err := os.ReadFile(src)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(dst, data, 0o600))
+		later := time.Now().Add(time.Minute)
+		assert.NoError(t, os.Chtimes(dst, later, later))
+	}
+
+	after, err := cfg.GetClientCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, before.Certificate[0], after.Certificate[0])
+}